@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akamensky/argparse"
+	"github.com/spf13/viper"
+
+	"github.com/nxtrace/NTrace-core/config"
+	"github.com/nxtrace/NTrace-core/dn42"
+	"github.com/nxtrace/NTrace-core/printer"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func registerAnycastFlag(parser *argparse.Parser) *bool {
+	return parser.Flag("", "anycast", &argparse.Options{Help: "Identify the anycast site that answered: query DNS CHAOS hostname.bind/id.server with NSID on port 53 of the destination and use PTR/geo hints of the last hops. In MTR report mode, also shows catchment flips"})
+}
+
+// checkAnycastConflicts returns the first option --anycast cannot be combined
+// with: modes that do not trace one destination from here, and outputs the
+// site report cannot follow.
+func checkAnycastConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+		{"--dual-stack", flags["dualStack"]},
+		{"--fan-out", flags["fanOut"]},
+		{"--raw", flags["raw"]},
+		{"--json", flags["json"]},
+		{"--report-format", flags["reportFormat"]},
+		{"--mtr without --report", flags["mtrTUI"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// loadAnycastPtrTable points the site lookup at the ptrPath of nt_config.yaml,
+// or ./ptr.csv, without creating a default config file as DN42 mode does.
+func loadAnycastPtrTable() {
+	if viper.GetString("ptrPath") != "" {
+		return
+	}
+	path := "./ptr.csv"
+	if v, err := config.Load(""); err == nil && v != nil && v.GetString("ptrPath") != "" {
+		path = v.GetString("ptrPath")
+	}
+	viper.SetDefault("ptrPath", path)
+}
+
+// anycastSiteLookup maps a PTR name or DNS identity to a site with the
+// ptr.csv table DN42 mode uses. A trailing dot lets bare codes such as "fra"
+// match the delimited patterns of that table.
+func anycastSiteLookup(name string) (string, bool) {
+	row, err := dn42.FindPtrRecord(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return "", false
+	}
+	var parts []string
+	for _, v := range []string{row.City, row.Region, strings.ToUpper(row.LtdCode)} {
+		if v != "" && (len(parts) == 0 || parts[len(parts)-1] != v) {
+			parts = append(parts, v)
+		}
+	}
+	if row.IATACode == "" {
+		return strings.Join(parts, ", "), len(parts) > 0
+	}
+	if len(parts) == 0 {
+		return row.IATACode, true
+	}
+	return fmt.Sprintf("%s (%s)", row.IATACode, strings.Join(parts, ", ")), true
+}
+
+// printAnycastSite queries the destination's DNS identity after a trace and
+// prints the inferred site.
+func printAnycastSite(ctx context.Context, conf trace.Config, domain string, res *trace.Result) {
+	fmt.Printf("Querying the DNS identity of %s on port 53...\n", conf.DstIP)
+	id := trace.QueryAnycastIdentity(ctx, conf.SrcAddr, conf.DstIP, conf.Timeout)
+	if ctx.Err() != nil {
+		return
+	}
+	printer.PrintAnycastSite(trace.AnycastSiteFromResult(domain, conf.DstIP, res, &id, anycastSiteLookup))
+}
+
+// anycastMTRWatch queries the destination's DNS identity once per MTR round
+// and records catchment changes for the report.
+type anycastMTRWatch struct {
+	conf      trace.Config
+	catchment trace.AnycastCatchment
+	wg        sync.WaitGroup
+
+	mu     sync.Mutex
+	round  int
+	busy   bool
+	latest *trace.AnycastIdentity
+}
+
+func newAnycastMTRWatch(conf trace.Config) *anycastMTRWatch {
+	return &anycastMTRWatch{conf: conf, round: -1}
+}
+
+// snapshot is called with every MTR snapshot. An identity query still in
+// flight when the next round starts is not duplicated.
+func (w *anycastMTRWatch) snapshot(ctx context.Context, iteration int, stats []trace.MTRHopStat) {
+	w.catchment.ObserveStats(time.Now(), iteration, w.conf.DstIP, stats)
+	w.mu.Lock()
+	if w.busy || iteration <= w.round {
+		w.mu.Unlock()
+		return
+	}
+	w.round, w.busy = iteration, true
+	w.mu.Unlock()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		id := trace.QueryAnycastIdentity(ctx, w.conf.SrcAddr, w.conf.DstIP, w.conf.Timeout)
+		w.catchment.ObserveIdentity(time.Now(), iteration, id)
+		w.mu.Lock()
+		w.latest, w.busy = &id, false
+		w.mu.Unlock()
+	}()
+}
+
+// finish waits for the last identity query and prints the site inferred from
+// the final statistics, followed by the catchment flips.
+func (w *anycastMTRWatch) finish(domain string, stats []trace.MTRHopStat) {
+	w.wg.Wait()
+	fmt.Println()
+	printer.PrintAnycastSite(trace.AnycastSiteFromMTR(domain, w.conf.DstIP, stats, w.latest, anycastSiteLookup))
+	printer.PrintAnycastCatchment(&w.catchment)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCheckAnycastConflicts(t *testing.T) {
+	if name, ok := checkAnycastConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --anycast rejected: %s", name)
+	}
+	if name, ok := checkAnycastConflicts(map[string]bool{"mtrTUI": true}); ok || name != "--mtr without --report" {
+		t.Fatalf("mtr TUI: got %q ok=%v", name, ok)
+	}
+	if name, ok := checkAnycastConflicts(map[string]bool{"json": true}); ok || name != "--json" {
+		t.Fatalf("json: got %q ok=%v", name, ok)
+	}
+}
+
+func TestAnycastSiteLookupUsesPtrTable(t *testing.T) {
+	ptrPath := filepath.Join(t.TempDir(), "ptr.csv")
+	if err := os.WriteFile(ptrPath, []byte("FRA,de,Hesse,Frankfurt\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("ptrPath", ptrPath)
+	t.Cleanup(viper.Reset)
+
+	for name, want := range map[string]string{
+		"b4.fra":                 "fra (Frankfurt, Hesse, DE)",
+		"ae-1.fra01.example.net": "fra (Frankfurt, Hesse, DE)",
+	} {
+		if got, ok := anycastSiteLookup(name); !ok || got != want {
+			t.Fatalf("anycastSiteLookup(%q) = %q, %v", name, got, ok)
+		}
+	}
+	if got, ok := anycastSiteLookup("core.example.net"); ok {
+		t.Fatalf("unexpected site %q", got)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/nxtrace/NTrace-core/assets/windivert"
 	"github.com/nxtrace/NTrace-core/config"
 	fastTrace "github.com/nxtrace/NTrace-core/fast_trace"
+	"github.com/nxtrace/NTrace-core/internal/traceexport"
 	"github.com/nxtrace/NTrace-core/ipgeo"
 	"github.com/nxtrace/NTrace-core/printer"
 	"github.com/nxtrace/NTrace-core/reporter"
@@ -50,6 +51,7 @@ const (
 
 var (
 	domainLookupFn                = util.DomainLookUpWithContext
+	domainLookupAllFn             = util.DomainLookUpAllWithContext
 	prepareNextTraceAPIV4FastIPFn = ipgeo.PrepareNextTraceAPIV4FastIP
 	newLeoWebsocketFn             = wshandle.NewWithContext
 	newLeoWebsocketAsyncFn        = wshandle.NewWithContextAsync
@@ -82,10 +84,14 @@ func splitListenAddr(effective string) (host, port string, ok bool) {
 }
 
 func formatHTTPListenURL(host, port string) string {
+	return formatListenURL("http", host, port)
+}
+
+func formatListenURL(scheme, host, port string) string {
 	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
 		host = "[" + host + "]"
 	}
-	return fmt.Sprintf("http://%s:%s", host, port)
+	return fmt.Sprintf("%s://%s:%s", scheme, host, port)
 }
 
 func resolveListenAccessHost(host string) string {
@@ -96,6 +102,14 @@ func resolveListenAccessHost(host string) string {
 }
 
 func buildListenInfo(addr string) listenInfo {
+	return buildListenInfoWithScheme(addr, false)
+}
+
+func buildListenInfoWithScheme(addr string, https bool) listenInfo {
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
 	effective := normalizeListenAddr(addr)
 	host, port, ok := splitListenAddr(effective)
 	if !ok {
@@ -108,12 +122,12 @@ func buildListenInfo(addr string) listenInfo {
 	}
 
 	info := listenInfo{
-		Binding: formatHTTPListenURL(rawHost, port),
+		Binding: formatListenURL(scheme, rawHost, port),
 	}
 
 	accessHost := resolveListenAccessHost(host)
 	if accessHost != "" {
-		info.Access = formatHTTPListenURL(accessHost, port)
+		info.Access = formatListenURL(scheme, accessHost, port)
 	}
 
 	return info
@@ -303,6 +317,9 @@ type effectiveMTRModes struct {
 	report bool
 	wide   bool
 	raw    bool
+	format string
+	// resultFormat is --result-format; only MTR raw mode honours it.
+	resultFormat string
 }
 
 type tracerouteOutputFlags struct {
@@ -317,23 +334,60 @@ type tracerouteOutputFlags struct {
 type webUIFlags struct {
 	deployListen *string
 	deployToken  *string
+	deployTokens *string
+	auditLog     *string
+	tlsCert      *string
+	tlsKey       *string
+	tlsSelfSign  *bool
+	tlsClientCA  *string
+	historyDir   *string
 	mcp          *bool
 	deploy       *bool
 }
 
 type deployRunOptions struct {
-	ListenAddr  string
-	EnableMCP   bool
-	AuthEnabled bool
-	DeployToken string
+	ListenAddr       string
+	EnableMCP        bool
+	AuthEnabled      bool
+	DeployToken      string
+	AccessConfigPath string
+	AuditLogPath     string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSSelfSigned    bool
+	TLSClientCAFile  string
+	HistoryDir       string
+	// OnTLSCertificate receives the SHA-256 fingerprint of the serving
+	// certificate and whether it was generated.
+	OnTLSCertificate func(fingerprint string, selfSigned bool)
+}
+
+// deployCLIOptions collects the --deploy related flags as parsed.
+type deployCLIOptions struct {
+	Deploy     bool
+	Listen     string
+	EnableMCP  bool
+	Token      string
+	TokensFile string
+	AuditLog   string
+	TLSCert    string
+	TLSKey     string
+	TLSSelf    bool
+	TLSCA      string
+	HistoryDir string
+}
+
+func (o deployCLIOptions) tlsEnabled() bool {
+	return o.TLSSelf || strings.TrimSpace(o.TLSCert) != "" || strings.TrimSpace(o.TLSKey) != ""
 }
 
 type mtrCLIFlags struct {
-	mtrMode    *bool
-	reportMode *bool
-	wideMode   *bool
-	showIPs    *bool
-	ipInfoMode *int
+	mtrMode      *bool
+	reportMode   *bool
+	wideMode     *bool
+	showIPs      *bool
+	ipInfoMode   *int
+	reportFormat *string
 }
 
 const windowsInitHelpText = "Extract WinDivert runtime to executable directory"
@@ -431,6 +485,13 @@ func registerWebUIFlagsWithAvailability(parser *argparse.Parser, enabled bool) w
 		return webUIFlags{
 			deployListen: parser.String("", "listen", &argparse.Options{Help: "Set listen address for web console (e.g. 127.0.0.1:30080)"}),
 			deployToken:  parser.String("", "deploy-token", &argparse.Options{Help: "Set bearer token for --deploy WebUI/API/WebSocket/MCP access"}),
+			deployTokens: parser.String("", "deploy-tokens", &argparse.Options{Help: "Load named --deploy tokens with scopes, quotas and expiry from FILE (default: deploy section of nt_config.yaml)"}),
+			auditLog:     parser.String("", "audit-log", &argparse.Options{Help: "Append a JSON audit record for every --deploy probe request to FILE"}),
+			tlsCert:      parser.String("", "tls-cert", &argparse.Options{Help: "Serve --deploy over HTTPS with this PEM certificate (reloaded on change or SIGHUP)"}),
+			tlsKey:       parser.String("", "tls-key", &argparse.Options{Help: "PEM private key for --tls-cert"}),
+			tlsSelfSign:  parser.Flag("", "tls-self-signed", &argparse.Options{Help: "Serve --deploy over HTTPS with a generated self-signed certificate (written to --tls-cert/--tls-key when they do not exist)"}),
+			tlsClientCA:  parser.String("", "tls-client-ca", &argparse.Options{Help: "Accept --deploy clients presenting a certificate signed by this CA (mutual TLS) in place of a token"}),
+			historyDir:   parser.String("", "history-dir", &argparse.Options{Help: "Keep --deploy trace, MTR and MTU results in DIR for the history API and web view"}),
 			mcp:          parser.Flag("", "mcp", &argparse.Options{Help: "Enable MCP endpoint under --deploy at /mcp"}),
 			deploy:       parser.Flag("", "deploy", &argparse.Options{Help: "Start the Gin powered web console"}),
 		}
@@ -438,6 +499,13 @@ func registerWebUIFlagsWithAvailability(parser *argparse.Parser, enabled bool) w
 	return webUIFlags{
 		deployListen: ptrStr(""),
 		deployToken:  ptrStr(""),
+		deployTokens: ptrStr(""),
+		auditLog:     ptrStr(""),
+		tlsCert:      ptrStr(""),
+		tlsKey:       ptrStr(""),
+		tlsSelfSign:  ptrBool(false),
+		tlsClientCA:  ptrStr(""),
+		historyDir:   ptrStr(""),
 		mcp:          ptrBool(false),
 		deploy:       ptrBool(false),
 	}
@@ -509,6 +577,20 @@ func registerGlobalpingFlagWithAvailability(parser *argparse.Parser, enabled boo
 	return parser.String("", "from", &argparse.Options{Help: "Run traceroute via Globalping (full build only; unavailable in this binary)"})
 }
 
+func registerGlobalpingProbesFlag(parser *argparse.Parser) *int {
+	if enableGlobalping {
+		return parser.Int("", "from-probes", &argparse.Options{Help: "With --from, request N Globalping probes in total and compare them side by side (reachability, AS path, ASN matrix). Separate several --from locations with commas"})
+	}
+	return parser.Int("", "from-probes", &argparse.Options{Help: "Compare several Globalping probes (full build only; unavailable in this binary)"})
+}
+
+func registerGlobalpingCompareLocalFlag(parser *argparse.Parser) *bool {
+	if enableGlobalping {
+		return parser.Flag("", "compare-local", &argparse.Options{Help: "With --from, also trace the target from this machine and show both paths side by side aligned by TTL, marking where they converge and diverge"})
+	}
+	return parser.Flag("", "compare-local", &argparse.Options{Help: "Compare a local trace with a Globalping trace (full build only; unavailable in this binary)"})
+}
+
 func registerMTRFlags(parser *argparse.Parser) mtrCLIFlags {
 	if enableMTR {
 		mtrMode := ptrBool(true)
@@ -521,14 +603,17 @@ func registerMTRFlags(parser *argparse.Parser) mtrCLIFlags {
 			wideMode:   parser.Flag("w", "wide", &argparse.Options{Help: "MTR wide report mode (implies --mtr --report); alone equals --mtr --report --wide"}),
 			showIPs:    parser.Flag("", "show-ips", &argparse.Options{Help: "MTR only: display both PTR hostnames and numeric IPs (PTR first, IP in parentheses)"}),
 			ipInfoMode: parser.Int("y", "ipinfo", &argparse.Options{Default: 0, Help: "Set initial MTR TUI host info mode (0-4). TUI only; ignored in --report/--raw. 0:IP/PTR 1:ASN 2:City 3:Owner 4:Full"}),
+			reportFormat: parser.Selector("", "report-format", printer.MTRReportFormats, &argparse.Options{Default: printer.MTRFormatText,
+				Help: "MTR report output format [" + strings.Join(printer.MTRReportFormats, ", ") + "]; json, xml and csv follow mtr --json/--xml/--csv plus a nexttrace geo block (implies --report)"}),
 		}
 	}
 	return mtrCLIFlags{
-		mtrMode:    ptrBool(false),
-		reportMode: ptrBool(false),
-		wideMode:   ptrBool(false),
-		showIPs:    ptrBool(false),
-		ipInfoMode: ptrInt(0),
+		mtrMode:      ptrBool(false),
+		reportMode:   ptrBool(false),
+		wideMode:     ptrBool(false),
+		showIPs:      ptrBool(false),
+		ipInfoMode:   ptrInt(0),
+		reportFormat: ptrStr(printer.MTRFormatText),
 	}
 }
 
@@ -602,10 +687,12 @@ type deployAuthPlan struct {
 	Enabled       bool
 	Token         string
 	AutoGenerated bool
+	NamedTokens   int
+	ClientCerts   bool
 }
 
-func maybeRunDeployMode(deploy bool, deployListen string, enableMCP bool, deployToken string) bool {
-	if !deploy {
+func maybeRunDeployMode(opts deployCLIOptions) bool {
+	if !opts.Deploy {
 		return false
 	}
 	if !enableWebUI {
@@ -619,7 +706,7 @@ func maybeRunDeployMode(deploy bool, deployListen string, enableMCP bool, deploy
 	}
 
 	capabilitiesCheck()
-	listenAddr := strings.TrimSpace(deployListen)
+	listenAddr := strings.TrimSpace(opts.Listen)
 	envAddr := strings.TrimSpace(util.EnvDeployAddr)
 	userProvided := listenAddr != "" || envAddr != ""
 	if listenAddr == "" {
@@ -628,7 +715,13 @@ func maybeRunDeployMode(deploy bool, deployListen string, enableMCP bool, deploy
 	if listenAddr == "" {
 		listenAddr = defaultLocalListenAddr()
 	}
-	authPlan, err := resolveDeployAuthPlan(listenAddr, deployToken)
+	authPlan, err := resolveDeployAuthPlan(listenAddr, opts.Token)
+	if err == nil {
+		var namedTokens int
+		namedTokens, err = countDeployAccessTokens(opts.TokensFile)
+		authPlan = applyNamedDeployTokens(authPlan, namedTokens)
+		authPlan = applyClientCertAuth(authPlan, strings.TrimSpace(opts.TLSCA) != "")
+	}
 	if err != nil {
 		if util.EnvDevMode {
 			panic(err)
@@ -636,15 +729,28 @@ func maybeRunDeployMode(deploy bool, deployListen string, enableMCP bool, deploy
 		log.Fatal(err)
 	}
 
+	var tlsFingerprint string
+	var tlsSelfSigned bool
 	onReady := func(addr net.Addr) {
-		info := buildListenInfo(addr.String())
+		info := buildListenInfoWithScheme(addr.String(), opts.tlsEnabled())
 		fmt.Printf("启动 NextTrace Web 控制台，监听地址: %s\n", info.Binding)
-		if enableMCP {
+		if opts.EnableMCP {
 			fmt.Printf("MCP Endpoint: %s\n", mcpEndpointURL(info))
 		}
+		if tlsFingerprint != "" {
+			if tlsSelfSigned {
+				fmt.Printf("TLS 自签名证书 SHA-256 指纹: %s\n", tlsFingerprint)
+			} else {
+				fmt.Printf("TLS 证书 SHA-256 指纹: %s\n", tlsFingerprint)
+			}
+		}
 		if authPlan.Enabled {
 			if authPlan.AutoGenerated {
 				fmt.Printf("Deploy token: %s\n", authPlan.Token)
+			} else if authPlan.NamedTokens > 0 {
+				fmt.Printf("Deploy token 鉴权已启用（%d 个命名令牌）\n", authPlan.NamedTokens)
+			} else if authPlan.ClientCerts && authPlan.Token == "" {
+				fmt.Println("Deploy 鉴权已启用（仅限 TLS 客户端证书）")
 			} else {
 				fmt.Println("Deploy token 鉴权已启用")
 			}
@@ -660,10 +766,20 @@ func maybeRunDeployMode(deploy bool, deployListen string, enableMCP bool, deploy
 		fmt.Println("注意：Web 控制台的安全性有限，请在确保安全的前提下使用，如有必要请使用ACL等方式加强安全性")
 	}
 	if err := runDeploy(deployRunOptions{
-		ListenAddr:  listenAddr,
-		EnableMCP:   enableMCP,
-		AuthEnabled: authPlan.Enabled,
-		DeployToken: authPlan.Token,
+		ListenAddr:       listenAddr,
+		EnableMCP:        opts.EnableMCP,
+		AuthEnabled:      authPlan.Enabled,
+		DeployToken:      authPlan.Token,
+		AccessConfigPath: strings.TrimSpace(opts.TokensFile),
+		AuditLogPath:     strings.TrimSpace(opts.AuditLog),
+		TLSCertFile:      strings.TrimSpace(opts.TLSCert),
+		TLSKeyFile:       strings.TrimSpace(opts.TLSKey),
+		TLSSelfSigned:    opts.TLSSelf,
+		TLSClientCAFile:  strings.TrimSpace(opts.TLSCA),
+		HistoryDir:       strings.TrimSpace(opts.HistoryDir),
+		OnTLSCertificate: func(fingerprint string, selfSigned bool) {
+			tlsFingerprint, tlsSelfSigned = fingerprint, selfSigned
+		},
 	}, onReady); err != nil {
 		if util.EnvDevMode {
 			panic(err)
@@ -691,6 +807,36 @@ func resolveDeployAuthPlan(listenAddr, cliToken string) (deployAuthPlan, error)
 	return deployAuthPlan{}, nil
 }
 
+// applyNamedDeployTokens turns auth on when named tokens are configured and
+// drops the auto-generated single token, which would otherwise bypass scopes.
+func applyNamedDeployTokens(plan deployAuthPlan, namedTokens int) deployAuthPlan {
+	if namedTokens <= 0 {
+		return plan
+	}
+	plan.Enabled = true
+	plan.NamedTokens = namedTokens
+	if plan.AutoGenerated {
+		plan.Token = ""
+		plan.AutoGenerated = false
+	}
+	return plan
+}
+
+// applyClientCertAuth turns auth on for mutual TLS. Client certificates are
+// the alternative credential, so no token is generated for them.
+func applyClientCertAuth(plan deployAuthPlan, enabled bool) deployAuthPlan {
+	if !enabled {
+		return plan
+	}
+	plan.Enabled = true
+	plan.ClientCerts = true
+	if plan.AutoGenerated {
+		plan.Token = ""
+		plan.AutoGenerated = false
+	}
+	return plan
+}
+
 func generateDeployToken() (string, error) {
 	var b [32]byte
 	if _, err := rand.Read(b[:]); err != nil {
@@ -718,13 +864,13 @@ func deployListenRequiresToken(listenAddr string) bool {
 	return !ip.IsLoopback()
 }
 
-func handleStartupModes(noColor, jsonPrint bool, modes effectiveMTRModes, ver, deploy bool, deployListen string, enableMCP bool, deployToken string, init bool, osType int) bool {
+func handleStartupModes(noColor, jsonPrint bool, modes effectiveMTRModes, ver bool, deploy deployCLIOptions, init bool, osType int) bool {
 	applyColorMode(noColor)
 	printStartupBanner(jsonPrint, modes.mtr)
 	if maybePrintVersion(ver) {
 		return true
 	}
-	if maybeRunDeployMode(deploy, deployListen, enableMCP, deployToken) {
+	if maybeRunDeployMode(deploy) {
 		return true
 	}
 	return maybePrepareWinDivert(init, osType)
@@ -787,8 +933,10 @@ func clampProbeSettings(tcp bool, numMeasurements, maxAttempts *int) {
 	}
 }
 
-func resolveTraceMethod(tcp, udp bool) trace.Method {
+func resolveTraceMethod(tcp, udp, sctp bool) trace.Method {
 	switch {
+	case sctp:
+		return trace.SCTPTrace
 	case tcp:
 		return trace.TCPTrace
 	case udp:
@@ -930,13 +1078,77 @@ func closeLeoWebsocket(leoWs *wshandle.WsConn) {
 }
 
 func maybeHandleGlobalping(from string, opts *trace.GlobalpingOptions, conf *trace.Config) bool {
-	if from == "" {
+	if from == "" || opts.CompareLocal {
 		return false
 	}
+	if opts.MTRPrint {
+		handleGlobalpingMTR(opts, conf)
+		return true
+	}
+	if globalpingCompareRequested(opts) {
+		handleGlobalpingCompare(opts, conf)
+		return true
+	}
 	handleGlobalpingTrace(opts, conf)
 	return true
 }
 
+// splitGlobalpingLocations splits a comma-separated --from value the way the
+// Globalping CLI does.
+func splitGlobalpingLocations(from string) []string {
+	var locations []string
+	for _, loc := range strings.Split(from, ",") {
+		if loc = strings.TrimSpace(loc); loc != "" {
+			locations = append(locations, loc)
+		}
+	}
+	return locations
+}
+
+// globalpingCompareRequested reports whether --from asks for more than one
+// vantage point; a single location and probe keeps the classic output.
+func globalpingCompareRequested(opts *trace.GlobalpingOptions) bool {
+	return opts != nil && (len(opts.Locations) > 1 || opts.Probes > 1)
+}
+
+// checkCompareLocalConflicts returns the message for the first option
+// --compare-local cannot be combined with.
+func checkCompareLocalConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		key string
+		msg string
+	}{
+		{"noFrom", "--compare-local 需要与 --from 一起使用"},
+		{"multi", "--compare-local 只支持单个 --from 位置和探针"},
+		{"mtr", "--compare-local 不能与 --mtr 同时使用"},
+		{"table", "--compare-local 不能与 --table 同时使用"},
+		{"classic", "--compare-local 不能与 --classic 同时使用"},
+		{"raw", "--compare-local 不能与 --raw 同时使用"},
+		{"routePath", "--compare-local 不能与 --route-path 同时使用"},
+		{"output", "--compare-local 不能与 --output 同时使用"},
+		{"outputDefault", "--compare-local 不能与 --output-default 同时使用"},
+	}
+	for _, c := range conflicts {
+		if flags[c.key] {
+			return c.msg, false
+		}
+	}
+	return "", true
+}
+
+// globalpingMaxPackets is the per-hop packet limit of the Globalping API.
+const globalpingMaxPackets = 16
+
+// globalpingPackets picks the per-hop packet count for --from. A remote MTR
+// cannot run until interrupted, so --mtr without -q uses the report default.
+func globalpingPackets(modes effectiveMTRModes, queriesExplicit bool, numMeasurements int) int {
+	if !modes.mtr {
+		return numMeasurements
+	}
+	packets, _ := deriveMTRProbeParams(true, queriesExplicit, numMeasurements, false, 0)
+	return min(packets, globalpingMaxPackets)
+}
+
 func lookupTargetIP(ctx context.Context, domain string, ipv4Only, ipv6Only bool, dot string, jsonPrint bool) (net.IP, error) {
 	switch {
 	case ipv6Only:
@@ -1029,6 +1241,41 @@ func buildTraceConfig(
 	}
 }
 
+// retargetTraceConfig points conf at another destination ip. The source
+// address, the default packet size and the UDP payload size all depend on the
+// address family.
+func retargetTraceConfig(method trace.Method, conf trace.Config, ip net.IP, srcDev string, packetSize int, packetSizeExplicit bool) (trace.Config, error) {
+	srcAddr, _, err := trace.ResolveConfiguredSrcAddr(ip, "", srcDev)
+	if err != nil {
+		return conf, err
+	}
+	sourceCfg, err := trace.NormalizeExplicitSourceConfig(method, trace.Config{
+		OSType:       conf.OSType,
+		DstIP:        ip,
+		SourceDevice: srcDev,
+	})
+	if err != nil {
+		return conf, err
+	}
+	if sourceCfg.SrcAddr != "" {
+		srcAddr = sourceCfg.SrcAddr
+	}
+	size := resolvePacketSizeArg(packetSize, packetSizeExplicit, method, ip)
+	if s, ok := trace.UDPPayloadPacketSize(conf.UDPPayload, ip, conf.DstPort); ok {
+		size = s
+	}
+	spec, err := trace.NormalizePacketSize(method, ip, size)
+	if err != nil {
+		return conf, err
+	}
+	conf.DstIP = ip
+	conf.SrcAddr = srcAddr
+	conf.SourceDevice = sourceCfg.SourceDevice
+	conf.PktSize = spec.PayloadSize
+	conf.RandomPacketSize = spec.Random
+	return conf, nil
+}
+
 func maybeRunMTRMode(
 	modes effectiveMTRModes,
 	method trace.Method,
@@ -1041,6 +1288,8 @@ func maybeRunMTRMode(
 	dataOrigin string,
 	showIPs bool,
 	ipInfoMode int,
+	packetSize int,
+	anycast bool,
 ) bool {
 	if !modes.mtr {
 		return false
@@ -1055,9 +1304,13 @@ func maybeRunMTRMode(
 
 	switch chooseMTRRunMode(modes.raw, modes.report) {
 	case mtrRunRaw:
-		runMTRRaw(method, conf, mtrHopIntervalMs, mtrMaxPerHop, dataOrigin)
+		runMTRRaw(method, conf, mtrHopIntervalMs, mtrMaxPerHop, dataOrigin, modes.resultFormat, domain, packetSize)
 	case mtrRunReport:
-		runMTRReport(method, conf, mtrHopIntervalMs, mtrMaxPerHop, domain, dataOrigin, modes.wide, showIPs)
+		var watch *anycastMTRWatch
+		if anycast {
+			watch = newAnycastMTRWatch(conf)
+		}
+		runMTRReport(method, conf, mtrHopIntervalMs, mtrMaxPerHop, domain, dataOrigin, modes.wide, showIPs, modes.format, watch)
 	default:
 		if ipInfoMode < 0 || ipInfoMode > 4 {
 			fmt.Fprintf(os.Stderr, "--ipinfo/-y 必须在 0-4 范围内，当前值: %d\n", ipInfoMode)
@@ -1210,9 +1463,10 @@ func Execute() {
 	ipv6Only := parser.Flag("6", "ipv6", &argparse.Options{Help: "Use IPv6 only"})
 	tcp := parser.Flag("T", "tcp", &argparse.Options{Help: "Use TCP SYN for tracerouting (default dest-port is 80)"})
 	udp := parser.Flag("U", "udp", &argparse.Options{Help: "Use UDP SYN for tracerouting (default dest-port is 33494)"})
+	sctp := parser.Flag("", "sctp", &argparse.Options{Help: "Use SCTP INIT for tracerouting (default dest-port is 80)"})
 	mtuMode := registerMTUFlag(parser)
 	fastTraceFlag := registerFastTraceFlag(parser)
-	port := parser.Int("p", "port", &argparse.Options{Help: "Set the destination port to use. With default of 80 for \"tcp\", 33494 for \"udp\""})
+	port := parser.Int("p", "port", &argparse.Options{Help: "Set the destination port to use. With default of 80 for \"tcp\" and \"sctp\", 33494 for \"udp\""})
 	icmpMode := registerICMPModeFlag(parser)
 	numMeasurements := parser.Int("q", "queries", &argparse.Options{Default: 3, Help: buildQueriesHelp()})
 	maxAttempts := parser.Int("", "max-attempts", &argparse.Options{Help: buildMaxAttemptsHelp()})
@@ -1231,6 +1485,17 @@ func Execute() {
 	tablePrint := outputFlags.tablePrint
 	jsonPrint := outputFlags.jsonPrint
 	classicPrint := outputFlags.classicPrint
+	resultFormat := registerResultFormatFlag(parser)
+	topologyFlags := registerTopologyFlags(parser)
+	mapFile := registerMapFileFlag(parser)
+	pcapPath := registerPcapFlag(parser)
+	udpPayload := registerUDPPayloadFlag(parser)
+	tcpProbe := registerTCPProbeFlags(parser)
+	tosCheck := registerTOSCheckFlags(parser)
+	ipv6Flags := registerIPv6OptionFlags(parser)
+	dualStack := registerDualStackFlag(parser)
+	fanOut := registerFanOutFlags(parser)
+	anycast := registerAnycastFlag(parser)
 	dn42 := parser.Flag("", "dn42", &argparse.Options{Help: "DN42 Mode"})
 	rawPrint := parser.Flag("", "raw", &argparse.Options{Help: buildRawHelp()})
 	beginHop := parser.Int("f", "first", &argparse.Options{Default: 1, Help: "Start from the first_ttl hop (instead of 1)"})
@@ -1240,9 +1505,11 @@ func Execute() {
 	setupNextTraceAPIV4Token := parser.Flag("x", "setup-api-v4-token", &argparse.Options{Help: "Store a session-only NextTrace API v4 token in a temporary file"})
 	speedMode := registerSpeedFlag(parser)
 	naliMode := registerNaliFlag(parser)
+	importFlags := registerImportFlags(parser)
 	srcAddr := parser.String("s", "source", &argparse.Options{Help: "Use source address src_addr for outgoing packets"})
 	srcPort := parser.Int("", "source-port", &argparse.Options{Help: "Use source port src_port for outgoing packets"})
 	srcDev := parser.String("D", "dev", &argparse.Options{Help: "Use the specified network device for explicit source selection. On Windows, this selects the device source address; routing may still choose the egress interface"})
+	sockFlags := registerSocketFlags(parser)
 
 	webFlags := registerWebUIFlags(parser)
 	deployListen := webFlags.deployListen
@@ -1257,7 +1524,7 @@ func Execute() {
 	timeout := parser.Int("", "timeout", &argparse.Options{Default: 1000, Help: buildTimeoutHelp()})
 	packetSize := parser.Int("", "psize", &argparse.Options{Help: buildPayloadSizeHelp()})
 	tos := parser.Int("Q", "tos", &argparse.Options{Default: 0, Help: buildTOSHelp()})
-	dot := parser.Selector("", "dot-server", []string{"dnssb", "aliyun", "dnspod", "google", "cloudflare"}, &argparse.Options{
+	dot := parser.Selector("", "dot-server", util.DoTServerNames, &argparse.Options{
 		Help: "Use DoT Server for DNS Parse [dnssb, aliyun, dnspod, google, cloudflare]"})
 	lang := parser.Selector("g", "language", []string{"en", "cn"}, &argparse.Options{Default: "cn",
 		Help: "Choose the language for displaying [en, cn]"})
@@ -1265,6 +1532,8 @@ func Execute() {
 
 	// ── Globalping flag (full only) ──
 	from := registerGlobalpingFlag(parser)
+	fromProbes := registerGlobalpingProbesFlag(parser)
+	compareLocal := registerGlobalpingCompareLocalFlag(parser)
 
 	// ── MTR flags (full & ntr only) ──
 	mtrFlags := registerMTRFlags(parser)
@@ -1273,6 +1542,7 @@ func Execute() {
 	wideMode := mtrFlags.wideMode
 	showIPs := mtrFlags.showIPs
 	ipInfoMode := mtrFlags.ipInfoMode
+	reportFormat := mtrFlags.reportFormat
 
 	// ── File: hidden in ntr (conflicts with default MTR mode) ──
 	file := registerFileFlag(parser)
@@ -1299,7 +1569,146 @@ func Execute() {
 	defer stop()
 	util.SrcDev = ""
 
-	mtrModes := deriveEffectiveMTRModes(*mtrMode, *reportMode, *wideMode, *rawPrint)
+	mtrModes := deriveEffectiveMTRModes(*mtrMode, *reportMode || *reportFormat != printer.MTRFormatText, *wideMode, *rawPrint)
+	mtrModes.format = *reportFormat
+	mtrModes.resultFormat = *resultFormat
+	if err := checkMTRReportFormat(mtrModes.format, mtrModes.raw, *from); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *resultFormat != "" {
+		if conflict, ok := checkResultFormatConflicts(map[string]bool{
+			"table":         *tablePrint,
+			"classic":       *classicPrint,
+			"json":          *jsonPrint,
+			"routePath":     *routePath,
+			"output":        *outputPath != "",
+			"outputDefault": *outputDefault,
+			"raw":           *rawPrint && !mtrModes.mtr,
+			"mtrNoRaw":      mtrModes.mtr && !mtrModes.raw,
+			"from":          *from != "",
+			"mtu":           *mtuMode,
+			"fastTrace":     *fastTraceFlag,
+			"file":          *file != "",
+			"nali":          *naliMode,
+			"deploy":        enableWebUI && *deploy,
+		}); !ok {
+			fmt.Printf("--result-format 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+	}
+	var topologyRec *topologyRecorder
+	if *topologyFlags.path != "" {
+		if conflict, ok := checkTopologyConflicts(map[string]bool{
+			"mtr":    mtrModes.mtr,
+			"mtu":    *mtuMode,
+			"from":   *from != "",
+			"nali":   *naliMode,
+			"deploy": enableWebUI && *deploy,
+		}); !ok {
+			fmt.Printf("--topology 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		format, err := resolveTopologyFormat(*topologyFlags.path, *topologyFlags.format)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		topologyRec = newTopologyRecorder(*topologyFlags.path, format, *lang)
+	}
+	var mapOut *mapFileOutput
+	if *mapFile != "" {
+		if conflict, ok := checkMapFileConflicts(map[string]bool{
+			"mtr":       mtrModes.mtr,
+			"mtu":       *mtuMode,
+			"from":      *from != "",
+			"nali":      *naliMode,
+			"fastTrace": *fastTraceFlag,
+			"file":      *file != "",
+			"deploy":    enableWebUI && *deploy,
+		}); !ok {
+			fmt.Printf("--map-file 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		format, err := resolveMapFileFormat(*mapFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		mapOut = newMapFileOutput(*mapFile, format, *lang)
+		// The map is drawn locally, so the result must not leave the host.
+		*disableMaptrace = true
+	}
+	if *pcapPath != "" {
+		if conflict, ok := checkPcapConflicts(map[string]bool{
+			"mtr":       mtrModes.mtr,
+			"mtu":       *mtuMode,
+			"from":      *from != "",
+			"nali":      *naliMode,
+			"fastTrace": *fastTraceFlag,
+			"file":      *file != "",
+			"deploy":    enableWebUI && *deploy,
+			"import":    *importFlags.path != "",
+		}); !ok {
+			fmt.Printf("--pcap 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+	}
+	// Exported results go to stdout alone, like --json.
+	quietOutput := *jsonPrint || *resultFormat != ""
+	if *importFlags.path != "" {
+		applyColorMode(*noColor)
+		if maybePrintVersion(*ver) {
+			return
+		}
+		if conflict, ok := checkImportConflicts(map[string]bool{
+			"target":        *str != "",
+			"nali":          *naliMode,
+			"from":          *from != "",
+			"mtu":           *mtuMode,
+			"fastTrace":     *fastTraceFlag,
+			"file":          *file != "",
+			"deploy":        enableWebUI && *deploy,
+			"output":        *outputPath != "",
+			"outputDefault": *outputDefault,
+			"mtrRaw":        mtrModes.raw,
+		}); !ok {
+			fmt.Printf("--import 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		if err := runImportMode(rootCtx, importRunOptions{
+			path:            *importFlags.path,
+			format:          *importFlags.format,
+			stdin:           os.Stdin,
+			dn42:            *dn42,
+			data:            *dataOrigin,
+			dot:             *dot,
+			pow:             *powProvider,
+			lang:            *lang,
+			timeoutMs:       *timeout,
+			noRDNS:          *norDNS,
+			alwaysRDNS:      *alwaysrDNS,
+			disableMaptrace: *disableMaptrace,
+			mtrModes:        mtrModes,
+			showIPs:         *showIPs,
+			table:           *tablePrint,
+			classic:         *classicPrint,
+			raw:             *rawPrint,
+			json:            *jsonPrint,
+			routePath:       *routePath,
+			resultFormat:    *resultFormat,
+			topology:        topologyRec,
+			mapFile:         mapOut,
+			stdoutIsTTY:     CheckTTY(int(os.Stdout.Fd())),
+		}); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	if *naliMode {
 		applyColorMode(*noColor)
 		if maybePrintVersion(*ver) {
@@ -1311,6 +1720,7 @@ func Execute() {
 			ipv6Only:      *ipv6Only,
 			tcp:           *tcp,
 			udp:           *udp,
+			sctp:          *sctp,
 			mtu:           *mtuMode,
 			mtrModes:      mtrModes,
 			raw:           *rawPrint,
@@ -1398,7 +1808,6 @@ func Execute() {
 			"output":        *outputPath != "",
 			"outputDefault": *outputDefault,
 			"routePath":     *routePath,
-			"from":          enableGlobalping && *from != "",
 			"fastTrace":     *fastTraceFlag,
 			"file":          *file != "",
 			"deploy":        enableWebUI && *deploy,
@@ -1410,6 +1819,181 @@ func Execute() {
 	}
 
 	queriesExplicit, ttlTimeExplicit, packetSizeExplicit, tosExplicit := detectExplicitProbeFlags(parser)
+	udpPayloadProfile := trace.UDPPayloadRandom
+	if *udpPayload != "" {
+		if conflict, ok := checkUDPPayloadConflicts(map[string]bool{
+			"tcp":       *tcp,
+			"psize":     packetSizeExplicit,
+			"mtu":       *mtuMode,
+			"from":      *from != "",
+			"fastTrace": *fastTraceFlag,
+			"file":      *file != "",
+		}); !ok {
+			fmt.Printf("--udp-payload 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		udpPayloadProfile = trace.UDPPayloadProfile(*udpPayload)
+		applyUDPPayloadProfile(udpPayloadProfile, udp, port)
+	}
+	var tcpProbeProfile trace.TCPProbeProfile
+	if tcpProbe.set() {
+		if conflict, ok := checkTCPProbeConflicts(map[string]bool{
+			"udp":        *udp,
+			"udpPayload": *udpPayload != "",
+			"mtu":        *mtuMode,
+			"from":       *from != "",
+			"fastTrace":  *fastTraceFlag,
+			"file":       *file != "",
+		}); !ok {
+			fmt.Printf("--tcp-flags/--tcp-options/--tcp-ecn 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		tcpProbeProfile, err = trace.ParseTCPProbeProfile(*tcpProbe.flags, *tcpProbe.options, *tcpProbe.ecn)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		*tcp = true
+	}
+	if tosCheck.set() {
+		if conflict, ok := checkTOSCheckConflicts(map[string]bool{
+			"tos":       tosExplicit,
+			"mtr":       mtrModes.mtr,
+			"mtu":       *mtuMode,
+			"from":      *from != "",
+			"fastTrace": *fastTraceFlag,
+			"file":      *file != "",
+		}); !ok {
+			fmt.Printf("--dscp/--ecn 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		*tos, err = tosCheck.tos()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	var ipv6Opts trace.IPv6Options
+	if ipv6Flags.set() {
+		if conflict, ok := checkIPv6OptionConflicts(map[string]bool{
+			"ipv4":      *ipv4Only,
+			"mtu":       *mtuMode,
+			"from":      *from != "",
+			"fastTrace": *fastTraceFlag,
+			"file":      *file != "",
+		}); !ok {
+			fmt.Printf("--flow-label/--ipv6-ext 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		ipv6Opts, err = ipv6Flags.options()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *sctp {
+		if conflict, ok := checkSCTPConflicts(map[string]bool{
+			"udpPayload": *udpPayload != "",
+			"tcpProbe":   tcpProbe.set(),
+			"tcp":        *tcp,
+			"udp":        *udp,
+			"mtu":        *mtuMode,
+			"from":       *from != "",
+			"fastTrace":  *fastTraceFlag,
+			"file":       *file != "",
+		}); !ok {
+			fmt.Printf("--sctp 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+	}
+	if *dualStack {
+		if conflict, ok := checkDualStackConflicts(map[string]bool{
+			"ipv4":          *ipv4Only,
+			"ipv6":          *ipv6Only,
+			"source":        *srcAddr != "",
+			"ipv6Options":   ipv6Flags.set(),
+			"tosCheck":      tosCheck.set(),
+			"mtu":           *mtuMode,
+			"from":          *from != "",
+			"fastTrace":     *fastTraceFlag,
+			"file":          *file != "",
+			"table":         *tablePrint,
+			"classic":       *classicPrint,
+			"raw":           *rawPrint,
+			"routePath":     *routePath,
+			"output":        *outputPath != "",
+			"outputDefault": *outputDefault,
+			"pcap":          *pcapPath != "",
+			"resultFormat":  *resultFormat != "",
+			"reportFormat":  *reportFormat != printer.MTRFormatText,
+			"topology":      *topologyFlags.path != "",
+			"mapFile":       *mapFile != "",
+		}); !ok {
+			fmt.Printf("--dual-stack 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+	}
+	var fanOutResolvers []string
+	if fanOut.set() {
+		if conflict, ok := checkFanOutConflicts(map[string]bool{
+			"dualStack":     *dualStack,
+			"source":        *srcAddr != "",
+			"mtr":           mtrModes.mtr,
+			"ipv6Options":   ipv6Flags.set(),
+			"tosCheck":      tosCheck.set(),
+			"mtu":           *mtuMode,
+			"from":          *from != "",
+			"fastTrace":     *fastTraceFlag,
+			"file":          *file != "",
+			"table":         *tablePrint,
+			"classic":       *classicPrint,
+			"raw":           *rawPrint,
+			"routePath":     *routePath,
+			"output":        *outputPath != "",
+			"outputDefault": *outputDefault,
+			"pcap":          *pcapPath != "",
+			"resultFormat":  *resultFormat != "",
+			"topology":      *topologyFlags.path != "",
+			"mapFile":       *mapFile != "",
+		}); !ok {
+			fmt.Printf("--fan-out 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		if fanOutResolvers, err = fanOut.resolverNames(*dot); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *anycast {
+		if conflict, ok := checkAnycastConflicts(map[string]bool{
+			"mtu":          *mtuMode,
+			"from":         *from != "",
+			"fastTrace":    *fastTraceFlag,
+			"file":         *file != "",
+			"dualStack":    *dualStack,
+			"fanOut":       fanOut.set(),
+			"raw":          *rawPrint,
+			"json":         *jsonPrint,
+			"reportFormat": *reportFormat != printer.MTRFormatText,
+			"mtrTUI":       mtrModes.mtr && !mtrModes.report,
+		}); !ok {
+			fmt.Printf("--anycast 不能与 %s 同时使用\n", conflict)
+			os.Exit(1)
+		}
+		loadAnycastPtrTable()
+	}
+	if sockFlags.set() {
+		if *from != "" && !*compareLocal {
+			fmt.Println("--netns/--vrf/--fwmark 不能与 --from 同时使用（除非指定 --compare-local）")
+			os.Exit(1)
+		}
+		sockOpts, err := sockFlags.options()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		util.SetSocketOptions(sockOpts)
+	}
 	applyTTLIntervalDefault(ttlInterval, ttlTimeExplicit, mtrModes.mtr)
 	osType := resolveOSType()
 	stdoutIsTTY := CheckTTY(int(os.Stdout.Fd()))
@@ -1420,7 +2004,19 @@ func Execute() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	if handleStartupModes(*noColor, *jsonPrint, mtrModes, *ver, *deploy, *deployListen, *deployMCP, *deployToken, *init, osType) {
+	if handleStartupModes(*noColor, quietOutput, mtrModes, *ver, deployCLIOptions{
+		Deploy:     *deploy,
+		Listen:     *deployListen,
+		EnableMCP:  *deployMCP,
+		Token:      *deployToken,
+		TokensFile: *webFlags.deployTokens,
+		AuditLog:   *webFlags.auditLog,
+		TLSCert:    *webFlags.tlsCert,
+		TLSKey:     *webFlags.tlsKey,
+		TLSSelf:    *webFlags.tlsSelfSign,
+		TLSCA:      *webFlags.tlsClientCA,
+		HistoryDir: *webFlags.historyDir,
+	}, *init, osType) {
 		return
 	}
 	if *speedMode {
@@ -1429,7 +2025,7 @@ func Execute() {
 		fmt.Fprintln(os.Stderr, "internal error: speed mode dispatch failed")
 		os.Exit(1)
 	}
-	restoreFastIPOutput := setFastIPOutputSuppression(*jsonPrint || mtrModes.mtr)
+	restoreFastIPOutput := setFastIPOutputSuppression(quietOutput || mtrModes.mtr)
 	defer restoreFastIPOutput()
 
 	if *tos < 0 || *tos > 255 {
@@ -1438,7 +2034,7 @@ func Execute() {
 	}
 
 	applyDefaultPort(port, *udp)
-	clampProbeSettings(*tcp, numMeasurements, maxAttempts)
+	clampProbeSettings(*tcp || *sctp, numMeasurements, maxAttempts)
 	configureGeoDNS(*dot)
 
 	if *mtuMode {
@@ -1514,7 +2110,7 @@ func Execute() {
 		return
 	}
 
-	method := resolveTraceMethod(*tcp, *udp)
+	method := resolveTraceMethod(*tcp, *udp, *sctp)
 	paramsFastTrace := fastTrace.ParamsFastTrace{
 		Context:        rootCtx,
 		OSType:         osType,
@@ -1536,7 +2132,13 @@ func Execute() {
 		Dot:            *dot,
 		OutputPath:     resolvedOutputPath,
 	}
+	if topologyRec != nil {
+		paramsFastTrace.OnResult = topologyRec.add
+	}
 	if runFastTraceModeWithRuntime(rootCtx, *dn42, dataOrigin, disableMaptrace, powProvider, *from, *fastTraceFlag, *file, paramsFastTrace, method) {
+		if err := topologyRec.write(); err != nil {
+			fmt.Println(err)
+		}
 		return
 	}
 
@@ -1549,6 +2151,30 @@ func Execute() {
 	leoWs := prepareRuntimeEnvironment(rootCtx, *dn42, dataOrigin, disableMaptrace, powProvider, asyncLeo)
 	defer closeLeoWebsocket(leoWs)
 
+	if *fromProbes != 0 && *from == "" {
+		fmt.Println("--from-probes 需要与 --from 一起使用")
+		os.Exit(1)
+	}
+	if *fromProbes < 0 {
+		fmt.Println("--from-probes 必须为正整数")
+		os.Exit(1)
+	}
+	if *compareLocal {
+		if conflict, ok := checkCompareLocalConflicts(map[string]bool{
+			"noFrom":        *from == "",
+			"multi":         len(splitGlobalpingLocations(*from)) > 1 || *fromProbes > 1,
+			"mtr":           mtrModes.mtr,
+			"table":         *tablePrint,
+			"classic":       *classicPrint,
+			"raw":           *rawPrint,
+			"routePath":     *routePath,
+			"output":        *outputPath != "",
+			"outputDefault": *outputDefault,
+		}); !ok {
+			fmt.Println(conflict)
+			os.Exit(1)
+		}
+	}
 	if *from != "" {
 		if packetSizeExplicit {
 			fmt.Println("Globalping 模式不支持 --psize")
@@ -1560,47 +2186,75 @@ func Execute() {
 		}
 	}
 
-	if maybeHandleGlobalping(
-		*from,
-		&trace.GlobalpingOptions{
-			Target:  *str,
-			From:    *from,
-			IPv4:    *ipv4Only,
-			IPv6:    *ipv6Only,
-			TCP:     *tcp,
-			UDP:     *udp,
-			Port:    *port,
-			Packets: *numMeasurements,
-			MaxHops: *maxHops,
-
-			DisableMaptrace: *disableMaptrace,
-			DataOrigin:      *dataOrigin,
-
-			TablePrint:   *tablePrint,
-			ClassicPrint: *classicPrint,
-			RawPrint:     *rawPrint,
-			JSONPrint:    *jsonPrint,
-			ClearScreen:  stdoutIsTTY,
-		},
-		&trace.Config{
-			Context:         rootCtx,
-			OSType:          osType,
-			DN42:            *dn42,
-			NumMeasurements: *numMeasurements,
-			Lang:            *lang,
-			RDNS:            !*norDNS,
-			AlwaysWaitRDNS:  *alwaysrDNS,
-			IPGeoSource:     ipgeo.GetSource(*dataOrigin),
-			Timeout:         time.Duration(*timeout) * time.Millisecond,
-		},
-	) {
+	gpOpts := &trace.GlobalpingOptions{
+		Target:  *str,
+		From:    *from,
+		IPv4:    *ipv4Only,
+		IPv6:    *ipv6Only,
+		TCP:     *tcp,
+		UDP:     *udp,
+		Port:    *port,
+		Packets: globalpingPackets(mtrModes, queriesExplicit, *numMeasurements),
+		MaxHops: *maxHops,
+
+		Locations: splitGlobalpingLocations(*from),
+		Probes:    *fromProbes,
+
+		CompareLocal: *compareLocal,
+
+		DisableMaptrace: *disableMaptrace,
+		DataOrigin:      *dataOrigin,
+
+		TablePrint:   *tablePrint,
+		ClassicPrint: *classicPrint,
+		RawPrint:     *rawPrint,
+		JSONPrint:    *jsonPrint,
+		ClearScreen:  stdoutIsTTY,
+
+		MTRPrint:    mtrModes.mtr,
+		ReportPrint: mtrModes.report,
+		WidePrint:   mtrModes.wide,
+		ShowIPs:     *showIPs,
+	}
+	gpConf := &trace.Config{
+		Context:         rootCtx,
+		OSType:          osType,
+		DN42:            *dn42,
+		NumMeasurements: *numMeasurements,
+		Lang:            *lang,
+		RDNS:            !*norDNS,
+		AlwaysWaitRDNS:  *alwaysrDNS,
+		IPGeoSource:     ipgeo.GetSource(*dataOrigin),
+		Timeout:         time.Duration(*timeout) * time.Millisecond,
+	}
+	if maybeHandleGlobalping(*from, gpOpts, gpConf) {
 		return
 	}
 
-	ip, ok := lookupTargetIPOrExit(rootCtx, domain, *ipv4Only, *ipv6Only, *dot, *jsonPrint)
-	if !ok {
+	var ip net.IP
+	var ok bool
+	var fanOutAnswers []trace.FanOutResolver
+	if fanOut.set() {
+		if fanOutAnswers, err = resolveFanOut(rootCtx, domain, fanOutIPVersion(*ipv4Only, *ipv6Only), fanOutResolvers); err != nil {
+			if isContextStop(err) {
+				return
+			}
+			log.Fatal(err)
+		}
+		ip = trace.FanOutAddresses(fanOutAnswers)[0]
+	} else if ip, ok = lookupTargetIPOrExit(rootCtx, domain, *ipv4Only || *dualStack, *ipv6Only, *dot, quietOutput); !ok {
 		return
 	}
+	var dualStackIPv6 net.IP
+	if *dualStack {
+		if dualStackIPv6, ok = lookupTargetIPOrExit(rootCtx, domain, false, true, *dot, true); !ok {
+			return
+		}
+	}
+	if ipv6Opts.Enabled() && ip.To4() != nil {
+		fmt.Println("--flow-label/--ipv6-ext 仅适用于 IPv6 目标")
+		os.Exit(1)
+	}
 
 	// ResolveConfiguredSrcAddr is used for display/source-IP fallback before tracer runtime normalization.
 	resolvedSrcAddr, _, srcResolveErr := trace.ResolveConfiguredSrcAddr(ip, *srcAddr, *srcDev)
@@ -1624,7 +2278,13 @@ func Execute() {
 	}
 	resolvedSrcDev := sourceCfg.SourceDevice
 	effectivePacketSize := resolvePacketSizeArg(*packetSize, packetSizeExplicit, method, ip)
-	printTraceNav(*jsonPrint, mtrModes.mtr, ip, domain, *dataOrigin, *maxHops, effectivePacketSize, resolvedSrcAddr, method)
+	if size, ok := trace.UDPPayloadPacketSize(udpPayloadProfile, ip, *port); ok {
+		effectivePacketSize = size
+	}
+	printTraceNav(quietOutput || *dualStack || fanOut.set(), mtrModes.mtr, ip, domain, *dataOrigin, *maxHops, effectivePacketSize, resolvedSrcAddr, method)
+	if ipv6Opts.Enabled() && !quietOutput && !mtrModes.mtr {
+		fmt.Printf("IPv6 probe options: %s\n", ipv6Opts)
+	}
 
 	packetSizeSpec, packetSizeErr := trace.NormalizePacketSize(method, ip, effectivePacketSize)
 	if packetSizeErr != nil {
@@ -1661,8 +2321,41 @@ func Execute() {
 		*disableMPLS,
 	)
 	conf.Context = rootCtx
+	conf.UDPPayload = udpPayloadProfile
+	conf.TCPProbe = tcpProbeProfile
+	conf.IPv6 = ipv6Opts
+
+	if fanOut.set() {
+		if err := runFanOut(method, conf, domain, fanOutAnswers, *srcDev, *packetSize, packetSizeExplicit, *jsonPrint); err != nil && !isContextStop(err) {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *dualStack {
+		var confs [2]trace.Config
+		for i, target := range []net.IP{ip, dualStackIPv6} {
+			if confs[i], err = retargetTraceConfig(method, conf, target, *srcDev, *packetSize, packetSizeExplicit); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		if mtrModes.mtr {
+			mtrMaxPerHop, mtrHopIntervalMs := deriveMTRProbeParams(true, queriesExplicit, *numMeasurements, ttlTimeExplicit, *ttlInterval)
+			runDualStackMTR(method, confs, mtrHopIntervalMs, mtrMaxPerHop, domain, mtrModes.wide, *showIPs)
+			return
+		}
+		runDualStack(method, confs, domain, *jsonPrint)
+		return
+	}
 
-	if maybeRunMTRMode(mtrModes, method, conf, queriesExplicit, *numMeasurements, ttlTimeExplicit, *ttlInterval, domain, *dataOrigin, *showIPs, *ipInfoMode) {
+	if gpOpts.CompareLocal {
+		handleGlobalpingLocalCompare(method, conf, gpOpts, gpConf)
+		return
+	}
+
+	if maybeRunMTRMode(mtrModes, method, conf, queriesExplicit, *numMeasurements, ttlTimeExplicit, *ttlInterval, domain, *dataOrigin, *showIPs, *ipInfoMode, effectivePacketSize, *anycast) {
 		return
 	}
 
@@ -1678,17 +2371,66 @@ func Execute() {
 			}
 		}()
 	}
-	applyJSONOutputMode(&conf, *jsonPrint)
+	applyJSONOutputMode(&conf, quietOutput)
+	if *pcapPath != "" {
+		capture, closeCapture, err := openPacketCapture(*pcapPath, domain)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		conf.Capture = capture
+		defer func() {
+			if closeErr := closeCapture(); closeErr != nil {
+				fmt.Println(closeErr)
+			}
+		}()
+	}
 	if maybeRunUninterruptedRaw(*rawPrint, method, conf) {
 		return
 	}
 
+	startTime := time.Now()
 	res, ok := runTraceOnce(method, conf)
 	if !ok {
 		return
 	}
+	topologyRec.add(ip, res)
+	if err := topologyRec.write(); err != nil {
+		fmt.Println(err)
+	}
+	if err := mapOut.write(res, domain); err != nil {
+		fmt.Println(err)
+	}
+	if *resultFormat != "" {
+		meta := buildExportMeta(domain, method, conf, effectivePacketSize, *numMeasurements, startTime)
+		if err := traceexport.Write(os.Stdout, traceexport.Format(*resultFormat), res, meta); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	finalizeTraceResult(rootCtx, res, *tablePrint, stdoutIsTTY, *routePath, ip, *disableMaptrace, *jsonPrint, *dataOrigin)
+	if method == trace.TCPTrace && !tcpProbeProfile.IsDefault() && !*jsonPrint {
+		printer.PrintTCPDestinationReply(tcpProbeProfile.String(), res.TCPDestinationReply())
+	}
+	if method == trace.SCTPTrace && !*jsonPrint {
+		printer.PrintSCTPDestinationReply(res.SCTPDestinationReply())
+	}
+	if *anycast {
+		printAnycastSite(rootCtx, conf, domain, res)
+	}
+	if tosCheck.set() && !*jsonPrint {
+		printer.PrintTOSReport(trace.AnalyzeTOS(res, ip, *tos))
+	}
+	if len(ipv6Opts.ExtHeaders) > 0 && !*jsonPrint {
+		fmt.Println("Running a baseline trace without IPv6 extension headers...")
+		baseline, ok := runTraceOnce(method, ipv6ExtBaselineConfig(conf))
+		if !ok {
+			return
+		}
+		printer.PrintIPv6ExtReport(trace.AnalyzeIPv6Ext(res, baseline, ip, ipv6Opts.ExtHeadersString()))
+	}
 }
 
 type mtrRunMode int
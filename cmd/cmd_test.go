@@ -617,6 +617,28 @@ func TestResolveDeployAuthPlan(t *testing.T) {
 	}
 }
 
+func TestApplyNamedDeployTokens(t *testing.T) {
+	loopback := applyNamedDeployTokens(deployAuthPlan{}, 2)
+	if !loopback.Enabled || loopback.NamedTokens != 2 {
+		t.Fatalf("loopback plan = %+v, want auth enabled with 2 named tokens", loopback)
+	}
+
+	auto := applyNamedDeployTokens(deployAuthPlan{Enabled: true, Token: "generated", AutoGenerated: true}, 1)
+	if auto.Token != "" || auto.AutoGenerated {
+		t.Fatalf("auto plan = %+v, want generated token dropped", auto)
+	}
+
+	manual := applyNamedDeployTokens(deployAuthPlan{Enabled: true, Token: "manual"}, 1)
+	if manual.Token != "manual" {
+		t.Fatalf("manual plan token = %q, want manual kept alongside named tokens", manual.Token)
+	}
+
+	none := applyNamedDeployTokens(deployAuthPlan{Token: "x"}, 0)
+	if none.Enabled || none.NamedTokens != 0 {
+		t.Fatalf("plan without named tokens = %+v, want unchanged", none)
+	}
+}
+
 func TestRegisterTTLIntervalFlagWithMTRSupport_HelpOmitsTracerouteDefault(t *testing.T) {
 	parser := argparse.NewParser("ntr", "")
 	registerTTLIntervalFlagWithMTRSupport(parser, true)
@@ -899,3 +921,64 @@ func TestShouldForceNoColorForMTUNonTTY(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyClientCertAuth(t *testing.T) {
+	auto := applyClientCertAuth(deployAuthPlan{Enabled: true, Token: "generated", AutoGenerated: true}, true)
+	if !auto.Enabled || !auto.ClientCerts || auto.Token != "" {
+		t.Fatalf("auto plan = %+v, want client certificates replacing the generated token", auto)
+	}
+
+	manual := applyClientCertAuth(deployAuthPlan{Enabled: true, Token: "manual"}, true)
+	if manual.Token != "manual" || !manual.ClientCerts {
+		t.Fatalf("manual plan = %+v, want token kept alongside client certificates", manual)
+	}
+
+	off := applyClientCertAuth(deployAuthPlan{Token: "x"}, false)
+	if off.Enabled || off.ClientCerts {
+		t.Fatalf("plan without client CA = %+v, want unchanged", off)
+	}
+}
+
+func TestBuildListenInfoWithSchemeUsesHTTPS(t *testing.T) {
+	info := buildListenInfoWithScheme("127.0.0.1:1080", true)
+	if info.Binding != "https://127.0.0.1:1080" {
+		t.Fatalf("binding = %q, want https URL", info.Binding)
+	}
+}
+
+func TestSplitGlobalpingLocations(t *testing.T) {
+	got := splitGlobalpingLocations(" Germany, Japan ,,AS13335")
+	if strings.Join(got, "|") != "Germany|Japan|AS13335" {
+		t.Fatalf("splitGlobalpingLocations() = %q", got)
+	}
+	if globalpingCompareRequested(&trace.GlobalpingOptions{Locations: []string{"Germany"}}) {
+		t.Fatal("single location without --from-probes should keep the classic output")
+	}
+	if !globalpingCompareRequested(&trace.GlobalpingOptions{Locations: []string{"Germany"}, Probes: 3}) {
+		t.Fatal("--from-probes 3 should select the comparison view")
+	}
+}
+
+func TestGlobalpingPackets(t *testing.T) {
+	if got := globalpingPackets(effectiveMTRModes{}, false, 3); got != 3 {
+		t.Fatalf("traceroute packets = %d, want -q value 3", got)
+	}
+	if got := globalpingPackets(effectiveMTRModes{mtr: true}, false, 3); got != 10 {
+		t.Fatalf("--mtr packets = %d, want report default 10", got)
+	}
+	if got := globalpingPackets(effectiveMTRModes{mtr: true, report: true}, true, 50); got != globalpingMaxPackets {
+		t.Fatalf("--report -q 50 packets = %d, want Globalping limit %d", got, globalpingMaxPackets)
+	}
+}
+
+func TestCheckCompareLocalConflicts(t *testing.T) {
+	if msg, ok := checkCompareLocalConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --from --compare-local rejected: %s", msg)
+	}
+	if msg, ok := checkCompareLocalConflicts(map[string]bool{"noFrom": true, "mtr": true}); ok || !strings.Contains(msg, "--from") {
+		t.Fatalf("missing --from message = %q, ok=%v", msg, ok)
+	}
+	if msg, ok := checkCompareLocalConflicts(map[string]bool{"table": true}); ok || !strings.Contains(msg, "--table") {
+		t.Fatalf("--table message = %q, ok=%v", msg, ok)
+	}
+}
@@ -10,9 +10,31 @@ import (
 
 func runDeploy(opts deployRunOptions, onReady func(net.Addr)) error {
 	return server.RunWithOptions(server.Options{
-		ListenAddr:  opts.ListenAddr,
-		EnableMCP:   opts.EnableMCP,
-		AuthEnabled: opts.AuthEnabled,
-		DeployToken: opts.DeployToken,
+		ListenAddr:       opts.ListenAddr,
+		EnableMCP:        opts.EnableMCP,
+		AuthEnabled:      opts.AuthEnabled,
+		DeployToken:      opts.DeployToken,
+		AccessConfigPath: opts.AccessConfigPath,
+		AuditLogPath:     opts.AuditLogPath,
+		HistoryDir:       opts.HistoryDir,
+		TLS: server.TLSOptions{
+			CertFile:     opts.TLSCertFile,
+			KeyFile:      opts.TLSKeyFile,
+			SelfSigned:   opts.TLSSelfSigned,
+			ClientCAFile: opts.TLSClientCAFile,
+			OnCertificate: func(info server.CertificateInfo) {
+				if opts.OnTLSCertificate != nil {
+					opts.OnTLSCertificate(info.Fingerprint, info.SelfSigned)
+				}
+			},
+		},
 	}, onReady)
 }
+
+func countDeployAccessTokens(path string) (int, error) {
+	access, err := server.LoadAccessConfig(path)
+	if err != nil {
+		return 0, err
+	}
+	return len(access.Tokens), nil
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/printer"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func registerDualStackFlag(parser *argparse.Parser) *bool {
+	return parser.Flag("", "dual-stack", &argparse.Options{Help: "Resolve both the A and AAAA records of the target, trace IPv4 and IPv6 at the same time and compare hop counts, RTT/loss and AS paths side by side. In MTR modes, runs two MTR reports instead"})
+}
+
+// checkDualStackConflicts returns the first option --dual-stack cannot be
+// combined with: options that pin one address family, and outputs that expect
+// a single trace.
+func checkDualStackConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--ipv4", flags["ipv4"]},
+		{"--ipv6", flags["ipv6"]},
+		{"--source", flags["source"]},
+		{"--flow-label/--ipv6-ext", flags["ipv6Options"]},
+		{"--dscp/--ecn", flags["tosCheck"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+		{"--table", flags["table"]},
+		{"--classic", flags["classic"]},
+		{"--raw", flags["raw"]},
+		{"--route-path", flags["routePath"]},
+		{"--output", flags["output"]},
+		{"--output-default", flags["outputDefault"]},
+		{"--pcap", flags["pcap"]},
+		{"--result-format", flags["resultFormat"]},
+		{"--report-format", flags["reportFormat"]},
+		{"--topology", flags["topology"]},
+		{"--map-file", flags["mapFile"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// runDualStack traces the IPv4 and IPv6 addresses of domain concurrently and
+// prints or emits the comparison.
+func runDualStack(method trace.Method, confs [2]trace.Config, domain string, jsonPrint bool) {
+	if !jsonPrint {
+		fmt.Printf("Tracing %s over IPv4 (%s) and IPv6 (%s)...\n", domain, confs[0].DstIP, confs[1].DstIP)
+	}
+	var sides [2]trace.DualStackSide
+	var wg sync.WaitGroup
+	for i := range confs {
+		conf := confs[i]
+		conf.RealtimePrinter = nil
+		conf.AsyncPrinter = nil
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := trace.Traceroute(method, conf)
+			if err != nil {
+				sides[i] = trace.DualStackSideError(conf.DstIP, err)
+				return
+			}
+			sides[i] = trace.DualStackSideFromResult(conf.DstIP, res)
+		}()
+	}
+	wg.Wait()
+	if ctx := confs[0].Context; ctx != nil && ctx.Err() != nil {
+		return
+	}
+	printDualStackComparison(trace.CompareDualStack(domain, sides[0], sides[1]), jsonPrint)
+}
+
+// runDualStackMTR runs an MTR report per address family at the same time,
+// prints both reports and then the comparison of their final statistics.
+func runDualStackMTR(method trace.Method, confs [2]trace.Config, hopIntervalMs, maxPerHop int, domain string, wide, showIPs bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Running MTR reports for %s over IPv4 (%s) and IPv6 (%s)...\n", domain, confs[0].DstIP, confs[1].DstIP)
+	startTime := time.Now()
+	opts := trace.MTROptions{
+		HopInterval: time.Duration(hopIntervalMs) * time.Millisecond,
+		MaxPerHop:   maxPerHop,
+	}
+	var stats [2][]trace.MTRHopStat
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i := range confs {
+		// AS 路径需要 GeoIP，两侧都按宽报告查询
+		conf := normalizeMTRReportConfig(confs[i], true)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = trace.RunMTR(ctx, method, conf, opts, func(_ int, s []trace.MTRHopStat) {
+				stats[i] = s
+			})
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	srcHost, _ := os.Hostname()
+	if srcHost == "" {
+		srcHost = "unknown-host"
+	}
+	lang := confs[0].Lang
+	if lang == "" {
+		lang = "cn"
+	}
+	var sides [2]trace.DualStackSide
+	for i, conf := range confs {
+		if errs[i] != nil && !errors.Is(errs[i], context.Canceled) {
+			sides[i] = trace.DualStackSideError(conf.DstIP, errs[i])
+			continue
+		}
+		sides[i] = trace.DualStackSideFromMTR(conf.DstIP, stats[i])
+		printer.MTRReportPrint(stats[i], printer.MTRReportOptions{
+			StartTime: startTime,
+			SrcHost:   fmt.Sprintf("%s -> %s", srcHost, conf.DstIP),
+			Wide:      wide,
+			ShowIPs:   showIPs,
+			Lang:      lang,
+		})
+		fmt.Println()
+	}
+	printDualStackComparison(trace.CompareDualStack(domain, sides[0], sides[1]), false)
+}
+
+func printDualStackComparison(cmp *trace.DualStackComparison, jsonPrint bool) {
+	if jsonPrint {
+		r, err := json.Marshal(cmp)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(string(r))
+		return
+	}
+	printer.PrintDualStackComparison(cmp)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestCheckDualStackConflicts(t *testing.T) {
+	if name, ok := checkDualStackConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --dual-stack rejected: %s", name)
+	}
+	if name, ok := checkDualStackConflicts(map[string]bool{"ipv6": true, "table": true}); ok || name != "--ipv6" {
+		t.Fatalf("ipv6: got %q ok=%v", name, ok)
+	}
+}
+
+func TestRetargetTraceConfigUsesFamilyDefaults(t *testing.T) {
+	base := trace.Config{DstPort: 80, NumMeasurements: 3}
+	v4, err := retargetTraceConfig(trace.ICMPTrace, base, net.ParseIP("127.0.0.1"), "", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v6, err := retargetTraceConfig(trace.ICMPTrace, base, net.ParseIP("::1"), "", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v4.DstIP.Equal(net.ParseIP("127.0.0.1")) || !v6.DstIP.Equal(net.ParseIP("::1")) || v6.NumMeasurements != 3 {
+		t.Fatalf("configs = %+v / %+v", v4, v6)
+	}
+	want4, _ := trace.NormalizePacketSize(trace.ICMPTrace, v4.DstIP, trace.DefaultPacketSize(trace.ICMPTrace, v4.DstIP))
+	want6, _ := trace.NormalizePacketSize(trace.ICMPTrace, v6.DstIP, trace.DefaultPacketSize(trace.ICMPTrace, v6.DstIP))
+	if v4.PktSize != want4.PayloadSize || v6.PktSize != want6.PayloadSize {
+		t.Fatalf("payload sizes = %d / %d, want %d / %d", v4.PktSize, v6.PktSize, want4.PayloadSize, want6.PayloadSize)
+	}
+}
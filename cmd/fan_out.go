@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/printer"
+	"github.com/nxtrace/NTrace-core/trace"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+type fanOutFlags struct {
+	fanOut    *bool
+	resolvers *string
+}
+
+func registerFanOutFlags(parser *argparse.Parser) fanOutFlags {
+	return fanOutFlags{
+		fanOut: parser.Flag("", "fan-out", &argparse.Options{
+			Help: "Trace every address the target resolves to, one after another, and rank the paths by latency"}),
+		resolvers: parser.String("", "fan-out-resolvers", &argparse.Options{
+			Help: "Comma-separated DoT servers to also resolve the target with in --fan-out mode: " + strings.Join(util.DoTServerNames, ", ") +
+				", or all; implies --fan-out"}),
+	}
+}
+
+func (f fanOutFlags) set() bool {
+	return *f.fanOut || *f.resolvers != ""
+}
+
+// resolverNames returns the resolvers to ask: the default one (the system
+// resolver, or --dot-server when given) first, then the extra DoT servers.
+func (f fanOutFlags) resolverNames(dot string) ([]string, error) {
+	names := []string{dot}
+	if dot == "" {
+		names[0] = "system"
+	}
+	for _, item := range strings.Split(*f.resolvers, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		var add []string
+		switch {
+		case item == "":
+		case item == "all":
+			add = util.DoTServerNames
+		case slices.Contains(util.DoTServerNames, item):
+			add = []string{item}
+		default:
+			return nil, fmt.Errorf("unsupported resolver %q; choose from %s or all", item, strings.Join(util.DoTServerNames, ", "))
+		}
+		for _, name := range add {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// checkFanOutConflicts returns the first option --fan-out cannot be combined
+// with: options that pick one address or source, and outputs that expect a
+// single trace.
+func checkFanOutConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--dual-stack", flags["dualStack"]},
+		{"--source", flags["source"]},
+		{"--mtr", flags["mtr"]},
+		{"--flow-label/--ipv6-ext", flags["ipv6Options"]},
+		{"--dscp/--ecn", flags["tosCheck"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+		{"--table", flags["table"]},
+		{"--classic", flags["classic"]},
+		{"--raw", flags["raw"]},
+		{"--route-path", flags["routePath"]},
+		{"--output", flags["output"]},
+		{"--output-default", flags["outputDefault"]},
+		{"--pcap", flags["pcap"]},
+		{"--result-format", flags["resultFormat"]},
+		{"--topology", flags["topology"]},
+		{"--map-file", flags["mapFile"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// resolveFanOut asks every resolver for the addresses of domain. A resolver
+// that fails is recorded with its error; it is an error only when none answers.
+func resolveFanOut(ctx context.Context, domain, ipVersion string, names []string) ([]trace.FanOutResolver, error) {
+	answers := make([]trace.FanOutResolver, 0, len(names))
+	for _, name := range names {
+		dot := name
+		if name == "system" {
+			dot = ""
+		}
+		ips, err := domainLookupAllFn(ctx, domain, ipVersion, dot)
+		if err != nil {
+			if isContextStop(err) {
+				return nil, err
+			}
+			answers = append(answers, trace.FanOutResolver{Name: name, Error: err.Error()})
+			continue
+		}
+		answer := trace.FanOutResolver{Name: name}
+		for _, ip := range ips {
+			answer.Addresses = append(answer.Addresses, ip.String())
+		}
+		answers = append(answers, answer)
+	}
+	if len(trace.FanOutAddresses(answers)) == 0 {
+		return nil, fmt.Errorf("no resolver returned an address for %s", domain)
+	}
+	return answers, nil
+}
+
+// runFanOut traces each resolved address in turn, so concurrent probes of one
+// method never share the same sockets, and prints or emits the ranking.
+func runFanOut(method trace.Method, conf trace.Config, domain string, answers []trace.FanOutResolver, srcDev string, packetSize int, packetSizeExplicit, jsonPrint bool) error {
+	conf.RealtimePrinter = nil
+	conf.AsyncPrinter = nil
+	ips := trace.FanOutAddresses(answers)
+	sides := make([]trace.DualStackSide, 0, len(ips))
+	for i, ip := range ips {
+		if !jsonPrint {
+			fmt.Printf("[%d/%d] Tracing %s...\n", i+1, len(ips), ip)
+		}
+		ipConf, err := retargetTraceConfig(method, conf, ip, srcDev, packetSize, packetSizeExplicit)
+		if err != nil {
+			sides = append(sides, trace.DualStackSideError(ip, err))
+			continue
+		}
+		res, err := trace.Traceroute(method, ipConf)
+		if ctx := conf.Context; ctx != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			sides = append(sides, trace.DualStackSideError(ip, err))
+			continue
+		}
+		sides = append(sides, trace.DualStackSideFromResult(ip, res))
+	}
+	report := trace.NewFanOutReport(domain, answers, sides)
+	if jsonPrint {
+		r, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(r))
+		return nil
+	}
+	fmt.Println()
+	printer.PrintFanOutReport(report)
+	return nil
+}
+
+func fanOutIPVersion(ipv4Only, ipv6Only bool) string {
+	switch {
+	case ipv4Only:
+		return "4"
+	case ipv6Only:
+		return "6"
+	default:
+		return "all"
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestFanOutResolverNames(t *testing.T) {
+	value := "google, all"
+	f := fanOutFlags{fanOut: new(bool), resolvers: &value}
+	names, err := f.resolverNames("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "system,google,dnssb,aliyun,dnspod,cloudflare" {
+		t.Fatalf("names = %s", got)
+	}
+	value = "cloudflare"
+	if names, _ = f.resolverNames("aliyun"); strings.Join(names, ",") != "aliyun,cloudflare" {
+		t.Fatalf("names with --dot-server = %v", names)
+	}
+	value = "quad9"
+	if _, err = f.resolverNames(""); err == nil {
+		t.Fatal("unknown resolver accepted")
+	}
+}
+
+func TestCheckFanOutConflicts(t *testing.T) {
+	if name, ok := checkFanOutConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --fan-out rejected: %s", name)
+	}
+	if name, ok := checkFanOutConflicts(map[string]bool{"mtr": true, "raw": true}); ok || name != "--mtr" {
+		t.Fatalf("mtr: got %q ok=%v", name, ok)
+	}
+}
+
+func TestResolveFanOutKeepsFailedResolvers(t *testing.T) {
+	oldLookup := domainLookupAllFn
+	defer func() { domainLookupAllFn = oldLookup }()
+	var dots []string
+	domainLookupAllFn = func(_ context.Context, _ string, ipVersion string, dot string) ([]net.IP, error) {
+		dots = append(dots, dot+"/"+ipVersion)
+		if dot == "google" {
+			return nil, errors.New("i/o timeout")
+		}
+		return []net.IP{net.ParseIP("192.0.2.1")}, nil
+	}
+
+	answers, err := resolveFanOut(context.Background(), "example.com", "4", []string{"system", "google"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []trace.FanOutResolver{{Name: "system", Addresses: []string{"192.0.2.1"}}, {Name: "google", Error: "i/o timeout"}}
+	if len(answers) != 2 || answers[0].Addresses[0] != want[0].Addresses[0] || answers[1].Error != want[1].Error {
+		t.Fatalf("answers = %+v", answers)
+	}
+	if strings.Join(dots, ",") != "/4,google/4" {
+		t.Fatalf("lookups = %v", dots)
+	}
+
+	if _, err = resolveFanOut(context.Background(), "example.com", "4", []string{"google"}); err == nil {
+		t.Fatal("resolveFanOut succeeded without any address")
+	}
+}
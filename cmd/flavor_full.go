@@ -10,5 +10,6 @@ const (
 	enableMTU        = true
 	enableSpeed      = true
 	enableNali       = true
+	enableImport     = true
 	defaultMTR       = false
 )
@@ -10,5 +10,6 @@ const (
 	enableMTU        = false
 	enableSpeed      = false
 	enableNali       = false
+	enableImport     = false
 	defaultMTR       = true
 )
@@ -10,5 +10,6 @@ const (
 	enableMTU        = true
 	enableSpeed      = false
 	enableNali       = false
+	enableImport     = false
 	defaultMTR       = false
 )
@@ -13,3 +13,15 @@ func handleGlobalpingTrace(_ *trace.GlobalpingOptions, _ *trace.Config) {
 	fmt.Fprintf(os.Stderr, "--from (Globalping) is not available in %s; please use the full nexttrace build\n", appBinName)
 	os.Exit(1)
 }
+
+func handleGlobalpingCompare(opts *trace.GlobalpingOptions, config *trace.Config) {
+	handleGlobalpingTrace(opts, config)
+}
+
+func handleGlobalpingMTR(opts *trace.GlobalpingOptions, config *trace.Config) {
+	handleGlobalpingTrace(opts, config)
+}
+
+func handleGlobalpingLocalCompare(_ trace.Method, _ trace.Config, opts *trace.GlobalpingOptions, config *trace.Config) {
+	handleGlobalpingTrace(opts, config)
+}
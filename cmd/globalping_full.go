@@ -5,8 +5,12 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/fatih/color"
 
@@ -84,3 +88,278 @@ func globalpingNoResultMessage(lang string) string {
 	}
 	return "Globalping 未返回可用的探测结果，已跳过输出。"
 }
+
+func handleGlobalpingCompare(opts *trace.GlobalpingOptions, config *trace.Config) {
+	cmp, _, err := trace.GlobalpingCompare(opts, config)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if opts.JSONPrint {
+		r, err := json.Marshal(cmp)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(string(r))
+		return
+	}
+	printGlobalpingComparison(color.Output, cmp, config.Lang)
+}
+
+// printGlobalpingComparison renders the per-probe summary, the ASN matrix and
+// the merged hop geo table of a multi-vantage run.
+func printGlobalpingComparison(w io.Writer, cmp *trace.GlobalpingComparison, lang string) {
+	en := strings.EqualFold(strings.TrimSpace(lang), "en")
+	pick := func(cn, enText string) string {
+		if en {
+			return enText
+		}
+		return cn
+	}
+	heading := color.New(color.FgGreen, color.Bold)
+
+	fmt.Fprintln(w, heading.Sprintf("> %s %s (%d %s)", pick("Globalping 多点对比:", "Globalping comparison:"), cmp.Target, len(cmp.Probes), pick("个探针", "probes")))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{"#", pick("位置", "Location"), pick("到达", "Reached"), pick("跳数", "Hops"), pick("末跳 RTT", "Final RTT"), pick("AS 路径", "AS path")}, "\t"))
+	for i, probe := range cmp.Probes {
+		reached := pick("否", "no")
+		if probe.Reached {
+			reached = pick("是", "yes")
+		}
+		rtt := "-"
+		if probe.FinalRTTMs > 0 {
+			rtt = fmt.Sprintf("%.2f ms", probe.FinalRTTMs)
+		}
+		path := formatGlobalpingASPath(probe.ASPath)
+		if probe.Error != "" {
+			reached = "-"
+			path = probe.Error
+		}
+		location := probe.Location
+		if location == "" {
+			location = "?"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", i+1, location, reached, probe.HopCount, rtt, path)
+	}
+	_ = tw.Flush()
+
+	if len(cmp.ASNs) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, heading.Sprint(pick("ASN 矩阵（列为探针序号）", "ASN matrix (columns are probe numbers)")))
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		header := []string{"ASN"}
+		for i := range cmp.Probes {
+			header = append(header, fmt.Sprint(i+1))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, asn := range cmp.ASNs {
+			row := []string{"AS" + asn}
+			for i := range cmp.Probes {
+				mark := "."
+				if cmp.Crosses(i, asn) {
+					mark = "x"
+				}
+				row = append(row, mark)
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		_ = tw.Flush()
+	}
+
+	if len(cmp.Hops) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, heading.Sprint(pick("合并跳点地理信息", "Merged hop geo")))
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join([]string{"IP", pick("经过探针数", "Seen by"), pick("归属", "Geo")}, "\t"))
+		for _, hop := range cmp.Hops {
+			geo := "*"
+			if hop.Geo != nil {
+				geo = printer.FormatIPGeoData(hop.IP, hop.Geo)
+			}
+			fmt.Fprintf(tw, "%s\t%d/%d\t%s\n", hop.IP, hop.SeenBy, len(cmp.Probes), geo)
+		}
+		_ = tw.Flush()
+	}
+}
+
+func formatGlobalpingASPath(path []string) string {
+	if len(path) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(path))
+	for i, asn := range path {
+		parts[i] = "AS" + asn
+	}
+	return strings.Join(parts, " > ")
+}
+
+// handleGlobalpingMTR prints a Globalping MTR measurement with the local MTR
+// printers. The remote run is already finished, so --mtr renders the final
+// table in the wide report layout instead of the live TUI; --report keeps
+// the narrow layout unless --wide is set.
+func handleGlobalpingMTR(opts *trace.GlobalpingOptions, config *trace.Config) {
+	conf := *config
+	wide := opts.WidePrint || !opts.ReportPrint
+	if !wide {
+		conf.IPGeoSource = nil
+	}
+	probes, measurement, err := trace.GlobalpingMTR(opts, &conf)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	startTime := time.Now()
+	if measurement != nil {
+		if created, err := time.Parse(time.RFC3339, measurement.CreatedAt); err == nil {
+			startTime = created.Local()
+		}
+	}
+	lang := conf.Lang
+	if lang == "" {
+		lang = "cn"
+	}
+
+	printed := false
+	for i, probe := range probes {
+		location := probe.Location
+		if location == "" {
+			location = "globalping"
+		}
+		if opts.RawPrint {
+			for _, rec := range probe.Records {
+				fmt.Println(printer.FormatMTRRawLine(rec))
+			}
+			printed = printed || len(probe.Records) > 0
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		if probe.Error != "" {
+			fmt.Fprintln(color.Output, color.New(color.FgRed).Sprintf("> %s: %s", location, probe.Error))
+			continue
+		}
+		printer.MTRReportPrint(probe.Stats, printer.MTRReportOptions{
+			StartTime: startTime,
+			SrcHost:   location,
+			Wide:      wide,
+			ShowIPs:   opts.ShowIPs,
+			Lang:      lang,
+		})
+		printed = true
+	}
+	if !printed && !opts.RawPrint {
+		fmt.Println(globalpingNoResultMessage(lang))
+	}
+}
+
+// handleGlobalpingLocalCompare traces the target locally while the Globalping
+// probe runs, then prints both paths side by side.
+func handleGlobalpingLocalCompare(method trace.Method, conf trace.Config, opts *trace.GlobalpingOptions, gpConf *trace.Config) {
+	type remoteOutcome struct {
+		res      *trace.Result
+		location string
+		err      error
+	}
+	remoteCh := make(chan remoteOutcome, 1)
+	go func() {
+		res, measurement, err := trace.GlobalpingTraceroute(opts, gpConf)
+		out := remoteOutcome{res: res, err: err}
+		if measurement != nil && len(measurement.Results) > 0 {
+			out.location = trace.GlobalpingFormatLocation(&measurement.Results[0])
+		}
+		remoteCh <- out
+	}()
+
+	conf.RealtimePrinter = nil
+	conf.AsyncPrinter = nil
+	local, err := trace.Traceroute(method, conf)
+	remote := <-remoteCh
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			fmt.Println(err)
+		}
+		return
+	}
+	if remote.err != nil {
+		fmt.Println(remote.err)
+		return
+	}
+
+	cmp := trace.ComparePaths(opts.Target, remote.location, local, remote.res)
+	if opts.JSONPrint {
+		r, err := json.Marshal(cmp)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(string(r))
+		return
+	}
+	printPathComparison(color.Output, cmp, conf.Lang)
+}
+
+// printPathComparison renders a local and a remote path aligned by TTL. "="
+// marks rows where both sides answered from the same address; the convergence
+// and divergence hops are tagged in place and summarized below the table.
+func printPathComparison(w io.Writer, cmp *trace.PathComparison, lang string) {
+	en := strings.EqualFold(strings.TrimSpace(lang), "en")
+	pick := func(cn, enText string) string {
+		if en {
+			return enText
+		}
+		return cn
+	}
+	heading := color.New(color.FgGreen, color.Bold)
+	remoteName := cmp.RemoteLocation
+	if remoteName == "" {
+		remoteName = "Globalping"
+	}
+
+	fmt.Fprintln(w, heading.Sprintf("> %s %s", pick("本地 vs 远端:", "Local vs remote:"), cmp.Target))
+	fmt.Fprintf(w, "  %s: %s\n", pick("远端", "Remote"), remoteName)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{"TTL", pick("本地", "Local"), "ASN", "RTT", "", pick("远端", "Remote"), "ASN", "RTT"}, "\t"))
+	for _, row := range cmp.Rows() {
+		mark := ""
+		if row.Local != nil && row.Remote != nil && row.Local.Address.String() == row.Remote.Address.String() {
+			mark = "="
+		}
+		local := pathCompareCells(row.Local, row.TTL, cmp, true, pick)
+		remote := pathCompareCells(row.Remote, row.TTL, cmp, false, pick)
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", row.TTL, local, mark, remote)
+	}
+	_ = tw.Flush()
+
+	fmt.Fprintln(w)
+	if p := cmp.ConvergeIP; p != nil {
+		fmt.Fprintln(w, heading.Sprintf(pick("首个共同 IP: %s（本地第 %d 跳，远端第 %d 跳）", "First common IP: %s (local hop %d, remote hop %d)"), p.IP, p.LocalTTL, p.RemoteTTL))
+	} else {
+		fmt.Fprintln(w, color.New(color.FgYellow).Sprint(pick("两条路径没有共同的 IP", "The paths share no IP address")))
+	}
+	if p := cmp.ConvergeASN; p != nil {
+		fmt.Fprintf(w, pick("首个共同 ASN: AS%s（本地第 %d 跳，远端第 %d 跳）\n", "First common ASN: AS%s (local hop %d, remote hop %d)\n"), p.ASN, p.LocalTTL, p.RemoteTTL)
+	}
+	if p := cmp.Diverge; p != nil {
+		fmt.Fprintln(w, color.New(color.FgYellow).Sprintf(pick("汇合后再次分叉: 本地第 %d 跳，远端第 %d 跳", "Split again after converging: local hop %d, remote hop %d"), p.LocalTTL, p.RemoteTTL))
+	}
+}
+
+func pathCompareCells(hop *trace.Hop, ttl int, cmp *trace.PathComparison, local bool, pick func(cn, en string) string) string {
+	if hop == nil {
+		return "*\t-\t-"
+	}
+	ip := hop.Address.String()
+	if p := cmp.ConvergeIP; p != nil && ((local && p.LocalTTL == ttl) || (!local && p.RemoteTTL == ttl)) {
+		ip += pick(" <汇合>", " <converge>")
+	}
+	if p := cmp.Diverge; p != nil && ((local && p.LocalTTL == ttl) || (!local && p.RemoteTTL == ttl)) {
+		ip += pick(" <分叉>", " <diverge>")
+	}
+	asn := "-"
+	if v := trace.PathHopASN(hop); v != "" {
+		asn = "AS" + v
+	}
+	return fmt.Sprintf("%s\t%s\t%.2f ms", ip, asn, trace.PathHopRTT(hop))
+}
@@ -0,0 +1,87 @@
+//go:build !flavor_tiny && !flavor_ntr
+
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestPrintGlobalpingComparison(t *testing.T) {
+	prev := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prev }()
+
+	cmp := &trace.GlobalpingComparison{
+		Target: "example.com",
+		Probes: []trace.GlobalpingProbeSummary{
+			{Location: "Berlin, DE", Reached: true, HopCount: 3, FinalRTTMs: 12.5, ASPath: []string{"3320", "13335"}},
+			{Location: "Tokyo, JP", HopCount: 5, ASPath: []string{"2497"}},
+			{Location: "Paris, FR", Error: "probe failed"},
+		},
+		ASNs: []string{"3320", "13335", "2497"},
+		Hops: []trace.GlobalpingHopGeo{{IP: "192.0.2.1", SeenBy: 2, Geo: &ipgeo.IPGeoData{Asnumber: "13335", CountryEn: "United States"}}},
+	}
+	var buf bytes.Buffer
+	printGlobalpingComparison(&buf, cmp, "en")
+	out := buf.String()
+	for _, want := range []string{
+		"Globalping comparison: example.com (3 probes)",
+		"AS3320 > AS13335",
+		"12.50 ms",
+		"probe failed",
+		"ASN matrix",
+		"192.0.2.1",
+		"2/3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "AS2497 ") && strings.Fields(line)[1] != "." {
+			t.Fatalf("probe 1 marked as crossing AS2497: %q", line)
+		}
+	}
+}
+
+func TestPrintPathComparison(t *testing.T) {
+	prev := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prev }()
+
+	hop := func(ttl int, ip, asn string) []trace.Hop {
+		return []trace.Hop{{Success: true, TTL: ttl, Address: &net.IPAddr{IP: net.ParseIP(ip)}, RTT: 2 * time.Millisecond, Geo: &ipgeo.IPGeoData{Asnumber: asn}}}
+	}
+	local := &trace.Result{Hops: [][]trace.Hop{hop(1, "10.0.0.1", "64512"), hop(2, "203.0.113.1", "1299"), hop(3, "192.0.2.1", "13335")}}
+	remote := &trace.Result{Hops: [][]trace.Hop{hop(1, "172.16.0.1", ""), hop(2, "203.0.113.1", "1299"), hop(3, "198.51.100.3", "13335")}}
+	cmp := trace.ComparePaths("example.com", "Frankfurt, DE", local, remote)
+
+	var buf bytes.Buffer
+	printPathComparison(&buf, cmp, "en")
+	out := buf.String()
+	for _, want := range []string{
+		"Local vs remote: example.com",
+		"Remote: Frankfurt, DE",
+		"203.0.113.1 <converge>",
+		"192.0.2.1 <diverge>",
+		"First common IP: 203.0.113.1 (local hop 2, remote hop 2)",
+		"First common ASN: AS1299",
+		"Split again after converging: local hop 3, remote hop 3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, "=") {
+		t.Fatalf("rows with the same address are not marked:\n%s", out)
+	}
+}
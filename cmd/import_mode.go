@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/config"
+	"github.com/nxtrace/NTrace-core/internal/traceexport"
+	"github.com/nxtrace/NTrace-core/internal/traceimport"
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/printer"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// maxImportBytes bounds what --import reads. Saved traces are a few KiB;
+// captures larger than this should be filtered down to the trace first.
+const maxImportBytes = 16 << 20
+
+type importCLIFlags struct {
+	path   *string
+	format *string
+}
+
+func registerImportFlags(parser *argparse.Parser) importCLIFlags {
+	if !enableImport {
+		return importCLIFlags{path: ptrStr(""), format: ptrStr(string(traceimport.FormatAuto))}
+	}
+	formats := []string{string(traceimport.FormatAuto)}
+	for _, f := range traceimport.Formats {
+		formats = append(formats, string(f))
+	}
+	return importCLIFlags{
+		path: parser.String("", "import", &argparse.Options{Help: "Re-render saved traceroute, tracert or mtr --json/--xml/--csv output, or rebuild a traceroute from a pcap/pcapng capture, with NextTrace GeoIP data; use - for stdin"}),
+		format: parser.Selector("", "import-format", formats, &argparse.Options{Default: string(traceimport.FormatAuto),
+			Help: "Format of the --import input [" + strings.Join(formats, ", ") + "]"}),
+	}
+}
+
+// checkImportConflicts returns the first option --import cannot be combined
+// with. Imports are rendered offline, so anything that probes is rejected.
+func checkImportConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"TARGET", flags["target"]},
+		{"--nali", flags["nali"]},
+		{"--from", flags["from"]},
+		{"--mtu", flags["mtu"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+		{"--deploy", flags["deploy"]},
+		{"--output", flags["output"]},
+		{"--output-default", flags["outputDefault"]},
+		{"--mtr --raw", flags["mtrRaw"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+type importRunOptions struct {
+	path   string
+	format string
+	stdin  io.Reader
+
+	dn42            bool
+	data            string
+	dot             string
+	pow             string
+	lang            string
+	timeoutMs       int
+	noRDNS          bool
+	alwaysRDNS      bool
+	disableMaptrace bool
+
+	mtrModes    effectiveMTRModes
+	showIPs     bool
+	table       bool
+	classic     bool
+	raw         bool
+	json        bool
+	routePath   bool
+	stdoutIsTTY bool
+
+	// resultFormat converts the input to Atlas or scamper JSON instead of
+	// rendering it.
+	resultFormat string
+	topology     *topologyRecorder
+	mapFile      *mapFileOutput
+}
+
+func readImportInput(path string, stdin io.Reader) ([]byte, error) {
+	var r io.Reader = stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxImportBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportBytes {
+		return nil, fmt.Errorf("--import 输入超过 %d MiB", maxImportBytes>>20)
+	}
+	return data, nil
+}
+
+func runImportMode(ctx context.Context, opts importRunOptions) error {
+	data, err := readImportInput(opts.path, opts.stdin)
+	if err != nil {
+		return err
+	}
+	imp, err := traceimport.ParseFormat(data, traceimport.Format(opts.format))
+	if err != nil {
+		return err
+	}
+
+	configureGeoDNS(opts.dot)
+	restoreFastIPOutput := setFastIPOutputSuppression(true)
+	defer restoreFastIPOutput()
+	if opts.dn42 {
+		applyDN42DataOrigin(&opts.data)
+		opts.disableMaptrace = true
+	}
+	leoWs := initLeoWebsocket(ctx, &opts.data, &opts.pow, false)
+	defer closeLeoWebsocket(leoWs)
+
+	imp.Enrich(trace.Config{
+		Context:        ctx,
+		DN42:           opts.dn42,
+		Lang:           opts.lang,
+		RDNS:           !opts.noRDNS,
+		AlwaysWaitRDNS: opts.alwaysRDNS,
+		IPGeoSource:    ipgeo.GetSourceWithGeoDNS(opts.data, opts.dot),
+		Timeout:        time.Duration(opts.timeoutMs) * time.Millisecond,
+	})
+	opts.topology.add(net.ParseIP(imp.TargetIP), imp.Result)
+	if err := opts.topology.write(); err != nil {
+		return err
+	}
+	if err := opts.mapFile.write(imp.Result, imp.Target); err != nil {
+		return err
+	}
+	if opts.resultFormat != "" {
+		return traceexport.Write(os.Stdout, traceexport.Format(opts.resultFormat), imp.Result, traceexport.Meta{
+			Target:  imp.Target,
+			DstAddr: imp.TargetIP,
+			Start:   time.Now(),
+			End:     time.Now(),
+		})
+	}
+
+	if opts.mtrModes.mtr {
+		srcHost := imp.Source
+		if srcHost == "" {
+			srcHost = string(imp.Format)
+		}
+		stats := imp.Stats()
+		if format := opts.mtrModes.format; format != "" && format != printer.MTRFormatText {
+			tests := 0
+			for _, s := range stats {
+				tests = max(tests, s.Snt)
+			}
+			return printer.WriteMTRReport(os.Stdout, format, stats, printer.MTRExportOptions{
+				StartTime: time.Now(),
+				SrcHost:   srcHost,
+				Dst:       imp.Target,
+				Tests:     tests,
+				ShowIPs:   opts.showIPs,
+				Lang:      opts.lang,
+				Version:   config.Version,
+			})
+		}
+		printer.MTRReportPrint(stats, printer.MTRReportOptions{
+			StartTime: time.Now(),
+			SrcHost:   srcHost,
+			Wide:      opts.mtrModes.wide || !opts.mtrModes.report,
+			ShowIPs:   opts.showIPs,
+			Lang:      opts.lang,
+		})
+		return nil
+	}
+
+	res := imp.Result
+	if !opts.json && !opts.table {
+		fmt.Printf("导入 %s 结果: %s", imp.Format, imp.Target)
+		if imp.TargetIP != "" && imp.TargetIP != imp.Target {
+			fmt.Printf(" (%s)", imp.TargetIP)
+		}
+		fmt.Println()
+		for i := range res.Hops {
+			switch {
+			case opts.classic:
+				printer.ClassicPrinter(res, i)
+			case opts.raw:
+				printer.EasyPrinter(res, i)
+			default:
+				printer.RealtimePrinter(res, i)
+			}
+		}
+	}
+	finalizeTraceResult(ctx, res, opts.table, opts.stdoutIsTTY, opts.routePath, net.ParseIP(imp.TargetIP), opts.disableMaptrace, opts.json, opts.data)
+	return nil
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckImportConflicts(t *testing.T) {
+	if name, ok := checkImportConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --import rejected: %s", name)
+	}
+	for key, want := range map[string]string{
+		"target": "TARGET",
+		"from":   "--from",
+		"mtrRaw": "--mtr --raw",
+	} {
+		if name, ok := checkImportConflicts(map[string]bool{key: true}); ok || name != want {
+			t.Fatalf("%s: got %q ok=%v, want %q", key, name, ok, want)
+		}
+	}
+}
+
+func TestReadImportInput(t *testing.T) {
+	got, err := readImportInput("-", strings.NewReader("traceroute to x"))
+	if err != nil || string(got) != "traceroute to x" {
+		t.Fatalf("stdin = %q, %v", got, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "trace.txt")
+	if err := os.WriteFile(path, []byte(" 1  10.0.0.1  1.0 ms\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = readImportInput(path, nil)
+	if err != nil || !strings.HasPrefix(string(got), " 1  10.0.0.1") {
+		t.Fatalf("file = %q, %v", got, err)
+	}
+
+	if _, err := readImportInput(filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Fatal("missing file accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+type ipv6OptionFlags struct {
+	flowLabel  *string
+	extHeaders *string
+}
+
+func registerIPv6OptionFlags(parser *argparse.Parser) ipv6OptionFlags {
+	return ipv6OptionFlags{
+		flowLabel: parser.String("", "flow-label", &argparse.Options{
+			Help: "Set the IPv6 flow label of probes: a value 0-1048575, or random for a new label per probe"}),
+		extHeaders: parser.String("", "ipv6-ext", &argparse.Options{
+			Help: "Comma-separated IPv6 extension headers to add to probes: " + strings.Join(trace.IPv6ExtHeaderNames, ", ") +
+				"; hbh and dst take a size such as hbh:64. Also runs a baseline without them and reports where probes stop"}),
+	}
+}
+
+func (f ipv6OptionFlags) set() bool {
+	return *f.flowLabel != "" || *f.extHeaders != ""
+}
+
+func (f ipv6OptionFlags) options() (trace.IPv6Options, error) {
+	return trace.ParseIPv6Options(*f.flowLabel, *f.extHeaders)
+}
+
+// checkIPv6OptionConflicts returns the first option --flow-label/--ipv6-ext
+// cannot be combined with: IPv4-only tracing, and modes that do not send
+// probes through the local tracers.
+func checkIPv6OptionConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--ipv4", flags["ipv4"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// ipv6ExtBaselineConfig is the plain run the extension header check compares
+// against. It keeps the flow label so both runs hash onto the same ECMP path,
+// and skips printing, capture and metadata lookups.
+func ipv6ExtBaselineConfig(conf trace.Config) trace.Config {
+	conf.IPv6 = conf.IPv6.WithoutExtHeaders()
+	conf.RealtimePrinter = nil
+	conf.AsyncPrinter = nil
+	conf.Capture = nil
+	conf.IPGeoSource = nil
+	conf.RDNS = false
+	conf.AlwaysWaitRDNS = false
+	conf.Maptrace = false
+	return conf
+}
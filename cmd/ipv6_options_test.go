@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestCheckIPv6OptionConflicts(t *testing.T) {
+	if name, ok := checkIPv6OptionConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --ipv6-ext rejected: %s", name)
+	}
+	if name, ok := checkIPv6OptionConflicts(map[string]bool{"ipv4": true, "file": true}); ok || name != "--ipv4" {
+		t.Fatalf("ipv4: got %q ok=%v", name, ok)
+	}
+}
+
+func TestIPv6ExtBaselineConfig(t *testing.T) {
+	opts, err := trace.ParseIPv6Options("42", "hbh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := trace.Config{IPv6: opts, RDNS: true, AsyncPrinter: func(*trace.Result) {}}
+	base := ipv6ExtBaselineConfig(conf)
+	if base.IPv6.ExtHeaders != nil || base.IPv6.FlowLabel == nil || *base.IPv6.FlowLabel != 42 {
+		t.Fatalf("baseline ipv6 = %+v", base.IPv6)
+	}
+	if base.RDNS || base.AsyncPrinter != nil || len(conf.IPv6.ExtHeaders) != 1 {
+		t.Fatalf("baseline config = %+v", base)
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/trace"
+	"github.com/nxtrace/NTrace-core/tracemap"
+)
+
+func registerMapFileFlag(parser *argparse.Parser) *string {
+	if defaultMTR {
+		return ptrStr("")
+	}
+	return parser.String("", "map-file", &argparse.Options{Help: "Draw the hop locations to FILE offline instead of uploading them to the MapTrace service: GeoJSON for .geojson/.json, a standalone HTML map for .html/.htm"})
+}
+
+// resolveMapFileFormat checks the --map-file extension before any probe is
+// sent.
+func resolveMapFileFormat(path string) (tracemap.Format, error) {
+	if f, ok := tracemap.FormatForPath(path); ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("无法从 %s 的扩展名判断地图格式，请使用 .geojson、.json、.html 或 .htm", path)
+}
+
+// checkMapFileConflicts returns the first option --map-file cannot be
+// combined with: modes that produce no single traceroute path.
+func checkMapFileConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--mtr", flags["mtr"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--nali", flags["nali"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+		{"--deploy", flags["deploy"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// mapFileOutput renders the result for --map-file. A nil output ignores
+// everything.
+type mapFileOutput struct {
+	path   string
+	format tracemap.Format
+	lang   string
+}
+
+func newMapFileOutput(path string, format tracemap.Format, lang string) *mapFileOutput {
+	if path == "" {
+		return nil
+	}
+	return &mapFileOutput{path: path, format: format, lang: lang}
+}
+
+func (m *mapFileOutput) write(res *trace.Result, target string) error {
+	if m == nil || res == nil {
+		return nil
+	}
+	f, err := os.Create(m.path)
+	if err != nil {
+		return err
+	}
+	if err := tracemap.WriteLocal(f, m.format, tracemap.Points(res), target, m.lang); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
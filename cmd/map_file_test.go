@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+	"github.com/nxtrace/NTrace-core/tracemap"
+)
+
+func TestResolveMapFileFormat(t *testing.T) {
+	if f, err := resolveMapFileFormat("path.geojson"); err != nil || f != tracemap.FormatGeoJSON {
+		t.Fatalf(".geojson = %q, %v", f, err)
+	}
+	if _, err := resolveMapFileFormat("path.png"); err == nil {
+		t.Fatal("unknown extension accepted")
+	}
+}
+
+func TestCheckMapFileConflicts(t *testing.T) {
+	if name, ok := checkMapFileConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --map-file rejected: %s", name)
+	}
+	if name, ok := checkMapFileConflicts(map[string]bool{"fastTrace": true}); ok || name != "--fast-trace" {
+		t.Fatalf("fast-trace: got %q ok=%v", name, ok)
+	}
+}
+
+func TestMapFileOutputWritesHTML(t *testing.T) {
+	var nilOut *mapFileOutput
+	if err := nilOut.write(&trace.Result{}, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "path.html")
+	out := newMapFileOutput(path, tracemap.FormatHTML, "en")
+	err := out.write(&trace.Result{Hops: [][]trace.Hop{
+		{{Success: true, TTL: 1, Address: &net.IPAddr{IP: net.ParseIP("192.0.2.1")}, Geo: &ipgeo.IPGeoData{CityEn: "Frankfurt", Lat: 50.11, Lng: 8.68}}},
+		{{Success: true, TTL: 2, Address: &net.IPAddr{IP: net.ParseIP("192.0.2.2")}, Geo: &ipgeo.IPGeoData{CityEn: "Paris", Lat: 48.86, Lng: 2.35}}},
+	}}, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "NextTrace · example.com") || !strings.Contains(string(data), "Paris") {
+		t.Fatalf("page = %s", data)
+	}
+}
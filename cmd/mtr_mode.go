@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/nxtrace/NTrace-core/config"
+	"github.com/nxtrace/NTrace-core/internal/traceexport"
 	"github.com/nxtrace/NTrace-core/printer"
 	"github.com/nxtrace/NTrace-core/trace"
 	"github.com/nxtrace/NTrace-core/util"
@@ -32,7 +33,6 @@ func checkMTRConflicts(flags map[string]bool) (conflict string, ok bool) {
 		{"--output", flags["output"]},
 		{"--output-default", flags["outputDefault"]},
 		{"--route-path", flags["routePath"]},
-		{"--from", flags["from"]},
 		{"--fast-trace", flags["fastTrace"]},
 		{"--file", flags["file"]},
 		{"--deploy", flags["deploy"]},
@@ -45,6 +45,20 @@ func checkMTRConflicts(flags map[string]bool) (conflict string, ok bool) {
 	return "", true
 }
 
+// checkMTRReportFormat 校验 --report-format：导出格式只适用于本地的最终报告。
+func checkMTRReportFormat(format string, raw bool, from string) error {
+	if format == "" || format == printer.MTRFormatText {
+		return nil
+	}
+	if raw {
+		return errors.New("--report-format 不能与 --raw 同时使用")
+	}
+	if from != "" {
+		return errors.New("--report-format 不能与 --from 同时使用")
+	}
+	return nil
+}
+
 // runMTRTUI 执行 MTR 交互式 TUI 模式。
 // 当 stdin 为 TTY 时启用全屏 TUI（备用屏幕、按键控制）；
 // 非 TTY 时降级为简单表格刷新。
@@ -143,7 +157,9 @@ func attachMTRHistoryIfTTY(ui *mtrUI, opts *trace.MTROptions) *printer.MTRHistor
 
 // runMTRReport 执行 MTR 非全屏报告模式（对齐 mtr -rzw 风格）。
 // 探测完 maxPerHop 后一次性输出最终统计到 stdout，不进入 alternate screen。
-func runMTRReport(method trace.Method, conf trace.Config, hopIntervalMs int, maxPerHop int, domain string, dataOrigin string, wide bool, showIPs bool) {
+// format 不为 text 时输出 mtr 兼容的 JSON/XML/CSV。
+// anycast 非 nil 时每轮查询目标的 DNS 身份，报告之后输出站点推断与切换记录。
+func runMTRReport(method trace.Method, conf trace.Config, hopIntervalMs int, maxPerHop int, domain string, dataOrigin string, wide bool, showIPs bool, format string, anycast *anycastMTRWatch) {
 	if hopIntervalMs <= 0 {
 		hopIntervalMs = 1000
 	}
@@ -170,6 +186,9 @@ func runMTRReport(method trace.Method, conf trace.Config, hopIntervalMs int, max
 	var finalStats []trace.MTRHopStat
 	onSnapshot := func(iteration int, stats []trace.MTRHopStat) {
 		finalStats = stats
+		if anycast != nil {
+			anycast.snapshot(ctx, iteration, stats)
+		}
 	}
 
 	opts := trace.MTROptions{
@@ -177,13 +196,36 @@ func runMTRReport(method trace.Method, conf trace.Config, hopIntervalMs int, max
 		MaxPerHop:   maxPerHop,
 	}
 
-	roundConf := normalizeMTRReportConfig(conf, wide)
+	exported := format != "" && format != printer.MTRFormatText
+	// 导出格式总是带地理信息扩展块，需要与宽报告一样查询 GeoIP。
+	roundConf := normalizeMTRReportConfig(conf, wide || exported)
 	err := trace.RunMTR(ctx, method, roundConf, opts, onSnapshot)
 	if err != nil && !errors.Is(err, context.Canceled) {
 		fmt.Println(err)
 		return
 	}
 
+	if exported {
+		dst := domain
+		if dst == "" {
+			dst = conf.DstIP.String()
+		}
+		if err := printer.WriteMTRReport(os.Stdout, format, finalStats, printer.MTRExportOptions{
+			StartTime:  startTime,
+			SrcHost:    srcHost,
+			Dst:        dst,
+			TOS:        conf.TOS,
+			PacketSize: conf.PktSize,
+			Tests:      maxPerHop,
+			ShowIPs:    showIPs,
+			Lang:       lang,
+			Version:    config.Version,
+		}); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
 	if len(finalStats) == 0 {
 		fmt.Println("No data collected.")
 		return
@@ -196,12 +238,16 @@ func runMTRReport(method trace.Method, conf trace.Config, hopIntervalMs int, max
 		ShowIPs:   showIPs,
 		Lang:      lang,
 	})
+	if anycast != nil {
+		anycast.finish(domain, finalStats)
+	}
 }
 
 // runMTRRaw 执行 MTR 原始流式模式（逐事件输出，'|' 分隔）。
 // 行格式固定为 12 列：
 // ttl|ip|ptr|rtt|asn|country|prov|city|district|owner|lat|lng
-func runMTRRaw(method trace.Method, conf trace.Config, hopIntervalMs int, maxPerHop int, dataOrigin string) {
+// 指定 resultFormat 时不逐行输出，结束后按轮次写出 Atlas/scamper JSON。
+func runMTRRaw(method trace.Method, conf trace.Config, hopIntervalMs int, maxPerHop int, dataOrigin string, resultFormat string, domain string, packetSize int) {
 	if hopIntervalMs <= 0 {
 		hopIntervalMs = 1000
 	}
@@ -215,16 +261,30 @@ func runMTRRaw(method trace.Method, conf trace.Config, hopIntervalMs int, maxPer
 	}
 
 	roundConf := normalizeMTRTraceConfig(conf)
-	if apiLine := buildRawAPIInfoLine(dataOrigin); apiLine != "" {
-		fmt.Println(apiLine)
+	if resultFormat == "" {
+		if apiLine := buildRawAPIInfoLine(dataOrigin); apiLine != "" {
+			fmt.Println(apiLine)
+		}
 	}
 
+	startTime := time.Now()
+	var records []trace.MTRRawRecord
 	err := trace.RunMTRRaw(ctx, method, roundConf, opts, func(rec trace.MTRRawRecord) {
+		if resultFormat != "" {
+			records = append(records, rec)
+			return
+		}
 		fmt.Println(printer.FormatMTRRawLine(rec))
 	})
 	if err != nil && !errors.Is(err, context.Canceled) {
 		writeMTRRawRuntimeError(os.Stderr, err)
 	}
+	if resultFormat != "" {
+		meta := buildExportMeta(domain, method, conf, packetSize, maxPerHop, startTime)
+		if err := traceexport.WriteMTRRecords(os.Stdout, traceexport.Format(resultFormat), records, meta); err != nil {
+			writeMTRRawRuntimeError(os.Stderr, err)
+		}
+	}
 }
 
 func normalizeMTRTraceConfig(conf trace.Config) trace.Config {
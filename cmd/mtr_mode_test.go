@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -107,19 +108,32 @@ func TestCheckMTRConflicts_Deploy(t *testing.T) {
 	}
 }
 
-func TestCheckMTRConflicts_From(t *testing.T) {
+func TestCheckMTRConflicts_FromAllowed(t *testing.T) {
+	// --from 会改为创建 Globalping MTR 测量，不再与 --mtr 冲突
 	flags := map[string]bool{
 		"table": false, "raw": false, "classic": false,
 		"json": false, "output": false,
 		"routePath": false, "from": true, "fastTrace": false,
 		"file": false, "deploy": false,
 	}
-	conflict, ok := checkMTRConflicts(flags)
-	if ok {
-		t.Fatal("expected conflict with --from")
+	if conflict, ok := checkMTRConflicts(flags); !ok {
+		t.Fatalf("--from should be allowed in MTR mode, got conflict=%q", conflict)
+	}
+}
+
+func TestCheckMTRReportFormat(t *testing.T) {
+	// text 报告不受限制；导出格式只适用于本地最终报告
+	if err := checkMTRReportFormat("text", true, "Frankfurt"); err != nil {
+		t.Fatalf("text format rejected: %v", err)
+	}
+	if err := checkMTRReportFormat("json", false, ""); err != nil {
+		t.Fatalf("json format rejected: %v", err)
+	}
+	if err := checkMTRReportFormat("csv", true, ""); err == nil || !strings.Contains(err.Error(), "--raw") {
+		t.Fatalf("--raw error = %v", err)
 	}
-	if conflict != "--from" {
-		t.Errorf("conflict = %q, want --from", conflict)
+	if err := checkMTRReportFormat("xml", false, "Frankfurt"); err == nil || !strings.Contains(err.Error(), "--from") {
+		t.Fatalf("--from error = %v", err)
 	}
 }
 
@@ -29,6 +29,7 @@ type naliModeOptions struct {
 	ipv6Only         bool
 	tcp              bool
 	udp              bool
+	sctp             bool
 	mtu              bool
 	mtr              bool
 	raw              bool
@@ -71,6 +72,7 @@ type naliModeOptionInputs struct {
 	ipv6Only      bool
 	tcp           bool
 	udp           bool
+	sctp          bool
 	mtu           bool
 	mtrModes      effectiveMTRModes
 	raw           bool
@@ -133,6 +135,7 @@ func validateNaliModeOptions(opts naliModeOptions) error {
 		{"--file", opts.file},
 		{"--tcp", opts.tcp},
 		{"--udp", opts.udp},
+		{"--sctp", opts.sctp},
 		{"--port", opts.port},
 		{"--icmp-mode", opts.icmpMode},
 		{"--queries", opts.queries},
@@ -167,6 +170,7 @@ func buildNaliModeOptions(input naliModeOptionInputs) naliModeOptions {
 		ipv6Only:         input.ipv6Only,
 		tcp:              input.tcp,
 		udp:              input.udp,
+		sctp:             input.sctp,
 		mtu:              input.mtu,
 		mtr:              input.mtrModes.mtr,
 		raw:              input.raw,
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func registerPcapFlag(parser *argparse.Parser) *string {
+	if defaultMTR {
+		return ptrStr("")
+	}
+	return parser.String("", "pcap", &argparse.Options{Help: "Write every probe sent and every reply received to FILE in pcapng format, with comments giving the TTL, the attempt and the match decision"})
+}
+
+// checkPcapConflicts returns the first option --pcap cannot be combined
+// with: modes that do not run the local tracers once.
+func checkPcapConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--mtr", flags["mtr"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--nali", flags["nali"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+		{"--deploy", flags["deploy"]},
+		{"--import", flags["import"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// openPacketCapture creates the --pcap file. The returned function flushes
+// and closes it.
+func openPacketCapture(path, target string) (*trace.PacketCapture, func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	capture, err := trace.NewPacketCapture(f, target)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+	return capture, func() error {
+		err := capture.Close()
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPcapConflicts(t *testing.T) {
+	if name, ok := checkPcapConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --pcap rejected: %s", name)
+	}
+	if name, ok := checkPcapConflicts(map[string]bool{"import": true}); ok || name != "--import" {
+		t.Fatalf("import: got %q ok=%v", name, ok)
+	}
+}
+
+func TestOpenPacketCaptureWritesHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.pcapng")
+	capture, closeCapture, err := openPacketCapture(path, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capture == nil {
+		t.Fatal("no capture returned")
+	}
+	if err := closeCapture(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 4 || string(data[:4]) != "\x0a\x0d\x0d\x0a" {
+		t.Fatalf("file does not start with a pcapng section header: %x", data)
+	}
+}
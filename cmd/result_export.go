@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/internal/traceexport"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func registerResultFormatFlag(parser *argparse.Parser) *string {
+	formats := make([]string, 0, len(traceexport.Formats))
+	for _, f := range traceexport.Formats {
+		formats = append(formats, string(f))
+	}
+	return parser.Selector("", "result-format", formats, &argparse.Options{
+		Help: "Print the result as RIPE Atlas or scamper (sc_warts2json) traceroute JSON [" + strings.Join(formats, ", ") + "]. With --mtr --raw, one result per round is written on exit"})
+}
+
+// checkResultFormatConflicts returns the first option --result-format cannot
+// be combined with: the other printers, and modes that produce no
+// traceroute result.
+func checkResultFormatConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--table", flags["table"]},
+		{"--classic", flags["classic"]},
+		{"--json", flags["json"]},
+		{"--route-path", flags["routePath"]},
+		{"--output", flags["output"]},
+		{"--output-default", flags["outputDefault"]},
+		{"--raw", flags["raw"]},
+		{"--mtr (without --raw)", flags["mtrNoRaw"]},
+		{"--from", flags["from"]},
+		{"--mtu", flags["mtu"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+		{"--nali", flags["nali"]},
+		{"--deploy", flags["deploy"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// buildExportMeta collects the measurement parameters both schemas record.
+func buildExportMeta(domain string, method trace.Method, conf trace.Config, packetSize, attempts int, start time.Time) traceexport.Meta {
+	meta := traceexport.Meta{
+		Target:     domain,
+		Method:     method,
+		PacketSize: packetSize,
+		TOS:        conf.TOS,
+		FirstHop:   conf.BeginHop,
+		MaxHops:    conf.MaxHops,
+		Attempts:   attempts,
+		Timeout:    conf.Timeout,
+		Start:      start,
+		End:        time.Now(),
+	}
+	if conf.DstIP != nil {
+		meta.DstAddr = conf.DstIP.String()
+	}
+	if src := resolveSrcIP(conf); net.ParseIP(src) != nil {
+		meta.SrcAddr = src
+	}
+	return meta
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestCheckResultFormatConflicts(t *testing.T) {
+	if name, ok := checkResultFormatConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --result-format rejected: %s", name)
+	}
+	for key, want := range map[string]string{
+		"json":     "--json",
+		"raw":      "--raw",
+		"mtrNoRaw": "--mtr (without --raw)",
+		"from":     "--from",
+	} {
+		if name, ok := checkResultFormatConflicts(map[string]bool{key: true}); ok || name != want {
+			t.Fatalf("%s: got %q ok=%v, want %q", key, name, ok, want)
+		}
+	}
+}
+
+func TestBuildExportMeta(t *testing.T) {
+	conf := trace.Config{
+		DstIP:    net.ParseIP("192.0.2.1"),
+		SrcAddr:  "192.0.2.10",
+		BeginHop: 2,
+		MaxHops:  20,
+		TOS:      8,
+		Timeout:  time.Second,
+	}
+	start := time.Unix(1700000000, 0)
+	meta := buildExportMeta("example.com", trace.UDPTrace, conf, 52, 3, start)
+	if meta.Target != "example.com" || meta.DstAddr != "192.0.2.1" || meta.SrcAddr != "192.0.2.10" {
+		t.Fatalf("addresses = %+v", meta)
+	}
+	if meta.FirstHop != 2 || meta.MaxHops != 20 || meta.Attempts != 3 || meta.PacketSize != 52 || meta.TOS != 8 || !meta.Start.Equal(start) {
+		t.Fatalf("parameters = %+v", meta)
+	}
+}
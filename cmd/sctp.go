@@ -0,0 +1,26 @@
+package cmd
+
+// checkSCTPConflicts returns the first option --sctp cannot be combined with:
+// the other probe protocols and their probe shapes, and modes that do not run
+// the local tracer.
+func checkSCTPConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--mtu", flags["mtu"]},
+		{"--udp-payload", flags["udpPayload"]},
+		{"--tcp-flags/--tcp-options/--tcp-ecn", flags["tcpProbe"]},
+		{"--tcp", flags["tcp"]},
+		{"--udp", flags["udp"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
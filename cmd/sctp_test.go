@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestCheckSCTPConflicts(t *testing.T) {
+	if name, ok := checkSCTPConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --sctp rejected: %s", name)
+	}
+	// --udp-payload implies --udp; name the flag the user typed
+	if name, ok := checkSCTPConflicts(map[string]bool{"udpPayload": true, "udp": true}); ok || name != "--udp-payload" {
+		t.Fatalf("udp-payload: got %q ok=%v", name, ok)
+	}
+	// --mtu switches to UDP before the check runs
+	if name, ok := checkSCTPConflicts(map[string]bool{"mtu": true, "udp": true}); ok || name != "--mtu" {
+		t.Fatalf("mtu: got %q ok=%v", name, ok)
+	}
+}
+
+func TestResolveTraceMethodSCTP(t *testing.T) {
+	if got := resolveTraceMethod(false, false, true); got != trace.SCTPTrace {
+		t.Fatalf("resolveTraceMethod(sctp) = %q", got)
+	}
+	if got := resolveTraceMethod(false, false, false); got != trace.ICMPTrace {
+		t.Fatalf("resolveTraceMethod() = %q", got)
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+type socketFlags struct {
+	netns  *string
+	vrf    *string
+	fwmark *string
+}
+
+func registerSocketFlags(parser *argparse.Parser) socketFlags {
+	return socketFlags{
+		netns: parser.String("", "netns", &argparse.Options{
+			Help: "(Linux) Open every probe socket inside this network namespace: a name under /var/run/netns or a path such as /proc/PID/ns/net"}),
+		vrf: parser.String("", "vrf", &argparse.Options{
+			Help: "(Linux) Bind every probe socket to this VRF device so routing uses the VRF table"}),
+		fwmark: parser.String("", "fwmark", &argparse.Options{
+			Help: "(Linux) Set this firewall mark (SO_MARK, decimal or 0x hex) on every probe socket for policy routing"}),
+	}
+}
+
+func (f socketFlags) set() bool {
+	return strings.TrimSpace(*f.netns) != "" || strings.TrimSpace(*f.vrf) != "" || strings.TrimSpace(*f.fwmark) != ""
+}
+
+// options parses and validates the flags. The namespace and VRF device must
+// exist before any socket is opened.
+func (f socketFlags) options() (util.SocketOptions, error) {
+	mark, err := util.ParseFwMark(*f.fwmark)
+	if err != nil {
+		return util.SocketOptions{}, err
+	}
+	o := util.SocketOptions{
+		NetNS:  strings.TrimSpace(*f.netns),
+		VRF:    strings.TrimSpace(*f.vrf),
+		FwMark: mark,
+	}
+	if err := o.Validate(); err != nil {
+		return util.SocketOptions{}, err
+	}
+	return o, nil
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+func TestSocketFlagsOptions(t *testing.T) {
+	flags := func(netns, vrf, fwmark string) socketFlags {
+		return socketFlags{netns: &netns, vrf: &vrf, fwmark: &fwmark}
+	}
+	if f := flags("", "", ""); f.set() {
+		t.Fatal("empty flags reported as set")
+	}
+	if _, err := flags("", "", "mark").options(); err == nil || !strings.Contains(err.Error(), "invalid fwmark") {
+		t.Fatalf("bad fwmark err = %v", err)
+	}
+	if runtime.GOOS != "linux" {
+		if _, err := flags("", "", "1").options(); err == nil {
+			t.Fatal("fwmark accepted outside Linux")
+		}
+		return
+	}
+	got, err := flags(" ", "lo", "0x10").options()
+	if err != nil || got != (util.SocketOptions{VRF: "lo", FwMark: 16}) {
+		t.Fatalf("options() = %+v, %v", got, err)
+	}
+	if _, err := flags("nexttrace-missing-ns", "", "").options(); err == nil {
+		t.Fatal("missing netns accepted")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	speedconfig "github.com/nxtrace/NTrace-core/internal/speedtest/config"
 	speedrender "github.com/nxtrace/NTrace-core/internal/speedtest/render"
 	speedrunner "github.com/nxtrace/NTrace-core/internal/speedtest/runner"
+	"github.com/nxtrace/NTrace-core/util"
 	"github.com/nxtrace/NTrace-core/wshandle"
 )
 
@@ -78,6 +79,12 @@ func runSpeedMode(rawArgs []string, stdout, stderr io.Writer) int {
 		_, _ = fmt.Fprintf(stderr, "speed mode error: %v\n\n%s", err, speedconfig.Usage())
 		return 1
 	}
+	sockOpts := cfg.SocketOptions()
+	if err := sockOpts.Validate(); err != nil {
+		_, _ = fmt.Fprintf(stderr, "speed mode error: %v\n", err)
+		return 1
+	}
+	util.SetSocketOptions(sockOpts)
 
 	rootCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+type tcpProbeFlags struct {
+	flags   *string
+	options *string
+	ecn     *bool
+}
+
+func registerTCPProbeFlags(parser *argparse.Parser) tcpProbeFlags {
+	return tcpProbeFlags{
+		flags: parser.Selector("", "tcp-flags", trace.TCPProbeFlagNames, &argparse.Options{
+			Help: "Send TCP probes with these control bits instead of SYN. Implies --tcp"}),
+		options: parser.String("", "tcp-options", &argparse.Options{
+			Help: "Comma-separated TCP options to carry: " + strings.Join(trace.TCPProbeOptionNames, ", ") + ", or none. Default: mss. Implies --tcp"}),
+		ecn: parser.Flag("", "tcp-ecn", &argparse.Options{
+			Help: "Set the ECE and CWR bits on TCP probes (an ECN-setup SYN). Implies --tcp"}),
+	}
+}
+
+func (f tcpProbeFlags) set() bool {
+	return *f.flags != "" || *f.options != "" || *f.ecn
+}
+
+// checkTCPProbeConflicts returns the first option the TCP probe flags cannot
+// be combined with: other probe protocols and modes that do not run the
+// local TCP tracer.
+func checkTCPProbeConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--udp", flags["udp"]},
+		{"--udp-payload", flags["udpPayload"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,12 @@
+package cmd
+
+import "testing"
+
+func TestCheckTCPProbeConflicts(t *testing.T) {
+	if name, ok := checkTCPProbeConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --tcp-flags rejected: %s", name)
+	}
+	if name, ok := checkTCPProbeConflicts(map[string]bool{"udpPayload": true}); ok || name != "--udp-payload" {
+		t.Fatalf("udp-payload: got %q ok=%v", name, ok)
+	}
+}
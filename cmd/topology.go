@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/internal/topology"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+const topologyFormatAuto = "auto"
+
+type topologyCLIFlags struct {
+	path   *string
+	format *string
+}
+
+func registerTopologyFlags(parser *argparse.Parser) topologyCLIFlags {
+	if defaultMTR {
+		return topologyCLIFlags{path: ptrStr(""), format: ptrStr(topologyFormatAuto)}
+	}
+	formats := []string{topologyFormatAuto}
+	for _, f := range topology.Formats {
+		formats = append(formats, string(f))
+	}
+	return topologyCLIFlags{
+		path: parser.String("", "topology", &argparse.Options{Help: "Write the traced path as a topology graph to FILE. With --file or --fast-trace all traces are merged into one graph"}),
+		format: parser.Selector("", "topology-format", formats, &argparse.Options{Default: topologyFormatAuto,
+			Help: "Format of the --topology file [" + strings.Join(formats, ", ") + "]; auto picks it from the extension (.dot/.gv, .mmd/.mermaid, .graphml)"}),
+	}
+}
+
+// resolveTopologyFormat checks --topology-format before any probe is sent,
+// so a long batch does not end with an unwritable graph.
+func resolveTopologyFormat(path, format string) (topology.Format, error) {
+	if format != "" && format != topologyFormatAuto {
+		return topology.Format(format), nil
+	}
+	if f, ok := topology.FormatForPath(path); ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("无法从 %s 的扩展名判断拓扑图格式，请使用 --topology-format 指定", path)
+}
+
+// checkTopologyConflicts returns the first option --topology cannot be
+// combined with: modes that produce no traceroute result.
+func checkTopologyConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--mtr", flags["mtr"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--nali", flags["nali"]},
+		{"--deploy", flags["deploy"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// topologyRecorder merges the results of a run for --topology and writes
+// them once at the end. A nil recorder ignores everything.
+type topologyRecorder struct {
+	path   string
+	format topology.Format
+	graph  *topology.Graph
+}
+
+func newTopologyRecorder(path string, format topology.Format, lang string) *topologyRecorder {
+	if path == "" {
+		return nil
+	}
+	return &topologyRecorder{path: path, format: format, graph: topology.New(lang)}
+}
+
+func (r *topologyRecorder) add(dst net.IP, res *trace.Result) {
+	if r == nil || res == nil {
+		return
+	}
+	target := ""
+	if dst != nil {
+		target = dst.String()
+	}
+	r.graph.Add(res, target)
+}
+
+func (r *topologyRecorder) write() error {
+	if r == nil || r.graph.Traces == 0 {
+		return nil
+	}
+	f, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	if err := topology.Write(f, r.format, r.graph); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/internal/topology"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestResolveTopologyFormat(t *testing.T) {
+	if f, err := resolveTopologyFormat("paths.gv", topologyFormatAuto); err != nil || f != topology.FormatDOT {
+		t.Fatalf("auto .gv = %q, %v", f, err)
+	}
+	if f, err := resolveTopologyFormat("paths.txt", "mermaid"); err != nil || f != topology.FormatMermaid {
+		t.Fatalf("explicit mermaid = %q, %v", f, err)
+	}
+	if _, err := resolveTopologyFormat("paths.txt", topologyFormatAuto); err == nil {
+		t.Fatal("unknown extension accepted")
+	}
+}
+
+func TestCheckTopologyConflicts(t *testing.T) {
+	if name, ok := checkTopologyConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --topology rejected: %s", name)
+	}
+	if name, ok := checkTopologyConflicts(map[string]bool{"mtr": true}); ok || name != "--mtr" {
+		t.Fatalf("mtr: got %q ok=%v", name, ok)
+	}
+}
+
+func TestTopologyRecorderWritesMergedGraph(t *testing.T) {
+	var nilRec *topologyRecorder
+	nilRec.add(nil, &trace.Result{})
+	if err := nilRec.write(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "paths.mmd")
+	rec := newTopologyRecorder(path, topology.FormatMermaid, "en")
+	for _, dst := range []string{"192.0.2.1", "192.0.2.2"} {
+		rec.add(net.ParseIP(dst), &trace.Result{Hops: [][]trace.Hop{
+			{{Success: true, TTL: 1, Address: &net.IPAddr{IP: net.ParseIP("10.0.0.1")}}},
+			{{Success: true, TTL: 2, Address: &net.IPAddr{IP: net.ParseIP(dst)}}},
+		}})
+	}
+	if err := rec.write(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "flowchart LR\n") || !strings.Contains(string(data), "src -->|2| n1") {
+		t.Fatalf("graph = %s", data)
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+type tosCheckFlags struct {
+	dscp *string
+	ecn  *string
+}
+
+func registerTOSCheckFlags(parser *argparse.Parser) tosCheckFlags {
+	return tosCheckFlags{
+		dscp: parser.String("", "dscp", &argparse.Options{
+			Help: "Mark probes with this DSCP (ef, af11-af43, cs0-cs7, le, va or 0-63) and report where hops remark or bleach it"}),
+		ecn: parser.Selector("", "ecn", trace.ECNNames, &argparse.Options{
+			Help: "Mark probes with this ECN codepoint and report where hops clear or change it"}),
+	}
+}
+
+func (f tosCheckFlags) set() bool {
+	return *f.dscp != "" || *f.ecn != ""
+}
+
+// tos combines the requested DSCP and ECN codepoint into the TOS byte; an
+// omitted DSCP is CS0 and an omitted ECN codepoint is Not-ECT.
+func (f tosCheckFlags) tos() (int, error) {
+	dscp, ecn := 0, trace.ECNNotECT
+	var err error
+	if *f.dscp != "" {
+		if dscp, err = trace.ParseDSCP(*f.dscp); err != nil {
+			return 0, err
+		}
+	}
+	if *f.ecn != "" {
+		if ecn, err = trace.ParseECN(*f.ecn); err != nil {
+			return 0, err
+		}
+	}
+	return dscp<<2 | ecn, nil
+}
+
+// checkTOSCheckConflicts returns the first option --dscp/--ecn cannot be
+// combined with: an explicit --tos, and modes that do not produce a single
+// local traceroute to check.
+func checkTOSCheckConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--tos", flags["tos"]},
+		{"--mtr", flags["mtr"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import "testing"
+
+func TestTOSCheckFlags(t *testing.T) {
+	dscp, ecn := "af41", "ect0"
+	tos, err := tosCheckFlags{dscp: &dscp, ecn: &ecn}.tos()
+	if err != nil || tos != 34<<2|2 {
+		t.Fatalf("tos = %d, %v", tos, err)
+	}
+	dscp, ecn = "", "ce"
+	if tos, err = (tosCheckFlags{dscp: &dscp, ecn: &ecn}).tos(); err != nil || tos != 3 {
+		t.Fatalf("ecn only tos = %d, %v", tos, err)
+	}
+	dscp = "af50"
+	if _, err = (tosCheckFlags{dscp: &dscp, ecn: &ecn}).tos(); err == nil {
+		t.Fatal("unknown dscp accepted")
+	}
+}
+
+func TestCheckTOSCheckConflicts(t *testing.T) {
+	if name, ok := checkTOSCheckConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --dscp rejected: %s", name)
+	}
+	if name, ok := checkTOSCheckConflicts(map[string]bool{"tos": true}); ok || name != "--tos" {
+		t.Fatalf("tos: got %q ok=%v", name, ok)
+	}
+}
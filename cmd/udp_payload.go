@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/akamensky/argparse"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func registerUDPPayloadFlag(parser *argparse.Parser) *string {
+	return parser.Selector("", "udp-payload", trace.UDPPayloadProfiles, &argparse.Options{
+		Help: "Send UDP probes carrying a well-formed request instead of random bytes: dns, quic, ntp, stun, or auto to pick one by the destination port. Implies --udp and, without -p, the protocol's well-known port"})
+}
+
+// checkUDPPayloadConflicts returns the first option --udp-payload cannot be
+// combined with: other probe protocols, fixed-size probes and modes that do
+// not run the local UDP tracer.
+func checkUDPPayloadConflicts(flags map[string]bool) (string, bool) {
+	conflicts := []struct {
+		name string
+		set  bool
+	}{
+		{"--tcp", flags["tcp"]},
+		{"--psize", flags["psize"]},
+		{"--mtu", flags["mtu"]},
+		{"--from", flags["from"]},
+		{"--fast-trace", flags["fastTrace"]},
+		{"--file", flags["file"]},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return c.name, false
+		}
+	}
+	return "", true
+}
+
+// applyUDPPayloadProfile switches the trace to UDP and, when no port was
+// given, to the profile's well-known port.
+func applyUDPPayloadProfile(profile trace.UDPPayloadProfile, udp *bool, port *int) {
+	*udp = true
+	if *port == 0 {
+		*port = profile.DefaultPort()
+	}
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestCheckUDPPayloadConflicts(t *testing.T) {
+	if name, ok := checkUDPPayloadConflicts(map[string]bool{}); !ok {
+		t.Fatalf("plain --udp-payload rejected: %s", name)
+	}
+	if name, ok := checkUDPPayloadConflicts(map[string]bool{"tcp": true}); ok || name != "--tcp" {
+		t.Fatalf("tcp: got %q ok=%v", name, ok)
+	}
+	if name, ok := checkUDPPayloadConflicts(map[string]bool{"psize": true}); ok || name != "--psize" {
+		t.Fatalf("psize: got %q ok=%v", name, ok)
+	}
+}
+
+func TestApplyUDPPayloadProfile(t *testing.T) {
+	udp, port := false, 0
+	applyUDPPayloadProfile(trace.UDPPayloadDNS, &udp, &port)
+	if !udp || port != 53 {
+		t.Fatalf("dns: udp=%v port=%d", udp, port)
+	}
+
+	udp, port = false, 5353
+	applyUDPPayloadProfile(trace.UDPPayloadDNS, &udp, &port)
+	if port != 5353 {
+		t.Fatalf("explicit port overridden: %d", port)
+	}
+
+	// auto has no port of its own; applyDefaultPort picks the UDP default.
+	udp, port = false, 0
+	applyUDPPayloadProfile(trace.UDPPayloadAuto, &udp, &port)
+	applyDefaultPort(&port, udp)
+	if port != 33494 {
+		t.Fatalf("auto: port=%d", port)
+	}
+}
@@ -10,12 +10,71 @@ import (
 	"github.com/spf13/viper"
 )
 
+const configName = "nt_config"
+
 func InitConfig() {
 	// 配置文件名， 不加扩展
-	viper.SetConfigName("nt_config") // name of config file (without extension)
+	viper.SetConfigName(configName) // name of config file (without extension)
 	// 设置文件的扩展名
 	viper.SetConfigType("yaml") // REQUIRED if the config file does not have the extension in the name
 	// 查找配置文件所在路径
+	for _, path := range searchPaths() {
+		viper.AddConfigPath(path)
+	}
+
+	// 配置默认值
+	viper.SetDefault("ptrPath", "./ptr.csv")
+	viper.SetDefault("geoFeedPath", "./geofeed.csv")
+
+	// 开始查找并读取配置文件
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			fmt.Println("未能找到配置文件，我们将在您的运行目录为您创建 nt_config.yaml 默认配置")
+			if err := viper.SafeWriteConfigAs("./nt_config.yaml"); err != nil {
+				fmt.Println("创建默认配置文件失败:", err)
+				return
+			}
+			if err := viper.ReadInConfig(); err != nil {
+				fmt.Println("加载默认配置失败:", err)
+			}
+			return
+		}
+
+		fmt.Println("加载配置文件失败:", err)
+		return
+	}
+}
+
+// Load reads a standalone config file into a fresh viper instance. An empty
+// path searches the nt_config.yaml locations used by InitConfig without
+// creating a default file; it returns (nil, nil) when none exists.
+func Load(path string) (*viper.Viper, error) {
+	v := viper.New()
+	if path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("read config %s: %w", path, err)
+		}
+		return v, nil
+	}
+
+	v.SetConfigName(configName)
+	v.SetConfigType("yaml")
+	for _, p := range searchPaths() {
+		v.AddConfigPath(p)
+	}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	return v, nil
+}
+
+func searchPaths() []string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		homeDir = ""
@@ -48,36 +107,9 @@ func InitConfig() {
 		)
 	}
 
-	configPaths = append(configPaths,
+	return append(configPaths,
 		"/usr/share/nexttrace",
 		"/usr/local/share/nexttrace",
 		".",
 	)
-
-	for _, path := range configPaths {
-		viper.AddConfigPath(path)
-	}
-
-	// 配置默认值
-	viper.SetDefault("ptrPath", "./ptr.csv")
-	viper.SetDefault("geoFeedPath", "./geofeed.csv")
-
-	// 开始查找并读取配置文件
-	if err := viper.ReadInConfig(); err != nil {
-		var notFound viper.ConfigFileNotFoundError
-		if errors.As(err, &notFound) {
-			fmt.Println("未能找到配置文件，我们将在您的运行目录为您创建 nt_config.yaml 默认配置")
-			if err := viper.SafeWriteConfigAs("./nt_config.yaml"); err != nil {
-				fmt.Println("创建默认配置文件失败:", err)
-				return
-			}
-			if err := viper.ReadInConfig(); err != nil {
-				fmt.Println("加载默认配置失败:", err)
-			}
-			return
-		}
-
-		fmt.Println("加载配置文件失败:", err)
-		return
-	}
 }
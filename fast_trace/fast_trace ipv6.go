@@ -80,10 +80,11 @@ func (f *FastTracer) tracert_v6(location string, ispCollection ISPCollection) {
 		}()
 	}
 
-	_, err = trace.Traceroute(f.TracerouteMethod, conf)
+	res, err := trace.Traceroute(f.TracerouteMethod, conf)
 	if shouldStopFastTrace(err) {
 		return
 	}
+	f.ParamsFastTrace.reportResult(ip, res)
 
 	fmt.Println()
 }
@@ -48,6 +48,15 @@ type ParamsFastTrace struct {
 	Dot             string
 	OutputPath      string
 	RuntimePrepared bool
+	// OnResult, when set, receives every finished trace, e.g. to merge the
+	// batch into one topology.
+	OnResult func(dst net.IP, res *trace.Result)
+}
+
+func (p ParamsFastTrace) reportResult(dst net.IP, res *trace.Result) {
+	if p.OnResult != nil && res != nil {
+		p.OnResult(dst, res)
+	}
 }
 
 type IpListElement struct {
@@ -319,9 +328,11 @@ func runFileTraceTarget(params ParamsFastTrace, tracerouteMethod trace.Method, i
 		}()
 	}
 
-	if _, err := trace.Traceroute(tracerouteMethod, conf); shouldStopFastTrace(err) {
+	res, err := trace.Traceroute(tracerouteMethod, conf)
+	if shouldStopFastTrace(err) {
 		return
 	}
+	params.reportResult(conf.DstIP, res)
 	fmt.Println()
 }
 
@@ -390,11 +401,12 @@ func (f *FastTracer) tracert(location string, ispCollection ISPCollection) {
 		}()
 	}
 
-	_, err = trace.Traceroute(f.TracerouteMethod, conf)
+	res, err := trace.Traceroute(f.TracerouteMethod, conf)
 
 	if shouldStopFastTrace(err) {
 		return
 	}
+	f.ParamsFastTrace.reportResult(ip, res)
 	fmt.Println()
 }
 
@@ -0,0 +1,394 @@
+// Package history keeps finished deploy results (traces, MTR reports, MTU
+// runs) on disk so they can be listed, filtered and reopened later.
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KindTrace = "trace"
+	KindMTR   = "mtr"
+	KindMTU   = "mtu"
+)
+
+const (
+	DefaultMaxEntries = 1000
+	DefaultMaxAge     = 90 * 24 * time.Hour
+	defaultListLimit  = 100
+	entryFileSuffix   = ".json"
+)
+
+// ErrNotFound is returned for unknown or malformed entry IDs.
+var ErrNotFound = errors.New("history entry not found")
+
+// Summary is the index record of an entry; List returns summaries only.
+type Summary struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind"`
+	Source     string         `json:"source,omitempty"`
+	Target     string         `json:"target"`
+	ResolvedIP string         `json:"resolved_ip,omitempty"`
+	Params     map[string]any `json:"params,omitempty"`
+	Token      string         `json:"token,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	DurationMs int64          `json:"duration_ms"`
+	ASNs       []string       `json:"asns,omitempty"`
+}
+
+// Entry is one stored result. Result holds the JSON the originating endpoint
+// returned, so the web UI can render it with the same code.
+type Entry struct {
+	Summary
+	Result json.RawMessage `json:"result"`
+}
+
+// Filter selects entries in List. Zero fields match everything.
+type Filter struct {
+	Target string
+	ASN    string
+	Kind   string
+	Token  string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Retention bounds the store. Zero values disable the corresponding limit.
+type Retention struct {
+	MaxEntries int
+	MaxAge     time.Duration
+}
+
+// Store is a directory of one JSON file per entry plus an in-memory index.
+type Store struct {
+	dir       string
+	retention Retention
+	now       func() time.Time
+
+	mu    sync.RWMutex
+	index []Summary // oldest first
+}
+
+// Open loads the index from dir, creating it when missing, and applies the
+// retention policy once.
+func Open(dir string, retention Retention) (*Store, error) {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return nil, errors.New("history directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create history directory: %w", err)
+	}
+	s := &Store{dir: dir, retention: retention, now: time.Now}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if _, err := s.Prune(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	names, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read history directory: %w", err)
+	}
+	for _, de := range names {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, entryFileSuffix) {
+			continue
+		}
+		entry, err := s.readFile(filepath.Join(s.dir, name))
+		if err != nil {
+			// A torn write must not stop the server; skip the file.
+			continue
+		}
+		s.index = append(s.index, entry.Summary)
+	}
+	sort.SliceStable(s.index, func(i, j int) bool {
+		return s.index[i].CreatedAt.Before(s.index[j].CreatedAt)
+	})
+	return nil
+}
+
+func (s *Store) readFile(path string) (Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, err
+	}
+	if !validID(entry.ID) {
+		return Entry{}, fmt.Errorf("invalid history id in %s", path)
+	}
+	return entry, nil
+}
+
+// Add assigns an ID and creation time, persists the entry and prunes.
+func (s *Store) Add(entry Entry) (Entry, error) {
+	if s == nil {
+		return Entry{}, errors.New("history store is not configured")
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = s.now().UTC()
+	}
+	id, err := newID(entry.CreatedAt)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.ID = id
+	entry.ASNs = normalizeASNs(entry.ASNs)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("encode history entry: %w", err)
+	}
+	if err := writeFileAtomic(s.path(id), data); err != nil {
+		return Entry{}, err
+	}
+	s.mu.Lock()
+	s.index = append(s.index, entry.Summary)
+	sort.SliceStable(s.index, func(i, j int) bool {
+		return s.index[i].CreatedAt.Before(s.index[j].CreatedAt)
+	})
+	s.mu.Unlock()
+	if _, err := s.Prune(); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// Get returns the full entry for id.
+func (s *Store) Get(id string) (Entry, error) {
+	if s == nil || !validID(id) {
+		return Entry{}, ErrNotFound
+	}
+	s.mu.RLock()
+	known := s.indexOfLocked(id) >= 0
+	s.mu.RUnlock()
+	if !known {
+		return Entry{}, ErrNotFound
+	}
+	entry, err := s.readFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Entry{}, ErrNotFound
+	}
+	return entry, err
+}
+
+// List returns matching summaries, newest first.
+func (s *Store) List(f Filter) []Summary {
+	if s == nil {
+		return nil
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	target := strings.ToLower(strings.TrimSpace(f.Target))
+	asn := normalizeASN(f.ASN)
+	kind := strings.ToLower(strings.TrimSpace(f.Kind))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Summary, 0, min(limit, len(s.index)))
+	for i := len(s.index) - 1; i >= 0 && len(out) < limit; i-- {
+		sum := s.index[i]
+		if kind != "" && sum.Kind != kind {
+			continue
+		}
+		if f.Token != "" && sum.Token != f.Token {
+			continue
+		}
+		if !f.Since.IsZero() && sum.CreatedAt.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && !sum.CreatedAt.Before(f.Until) {
+			continue
+		}
+		if target != "" && !strings.Contains(strings.ToLower(sum.Target), target) && !strings.Contains(strings.ToLower(sum.ResolvedIP), target) {
+			continue
+		}
+		if asn != "" && !containsString(sum.ASNs, asn) {
+			continue
+		}
+		out = append(out, sum)
+	}
+	return out
+}
+
+// Delete removes one entry.
+func (s *Store) Delete(id string) error {
+	if s == nil || !validID(id) {
+		return ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.indexOfLocked(id)
+	if idx < 0 {
+		return ErrNotFound
+	}
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete history entry: %w", err)
+	}
+	s.index = append(s.index[:idx], s.index[idx+1:]...)
+	return nil
+}
+
+// Prune drops entries older than MaxAge and the oldest entries beyond
+// MaxEntries. It returns the number of entries removed.
+func (s *Store) Prune() (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	drop := 0
+	if s.retention.MaxAge > 0 {
+		cutoff := s.now().Add(-s.retention.MaxAge)
+		for drop < len(s.index) && s.index[drop].CreatedAt.Before(cutoff) {
+			drop++
+		}
+	}
+	if s.retention.MaxEntries > 0 && len(s.index)-drop > s.retention.MaxEntries {
+		drop = len(s.index) - s.retention.MaxEntries
+	}
+	var firstErr error
+	for _, sum := range s.index[:drop] {
+		if err := os.Remove(s.path(sum.ID)); err != nil && !errors.Is(err, os.ErrNotExist) && firstErr == nil {
+			firstErr = fmt.Errorf("prune history entry: %w", err)
+		}
+	}
+	s.index = append([]Summary(nil), s.index[drop:]...)
+	return drop, firstErr
+}
+
+func (s *Store) indexOfLocked(id string) int {
+	for i := range s.index {
+		if s.index[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+entryFileSuffix)
+}
+
+// newID is time-ordered for humans and random enough to be used in links.
+func newID(at time.Time) (string, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", fmt.Errorf("generate history id: %w", err)
+	}
+	return strconv.FormatInt(at.UnixMilli(), 36) + "-" + hex.EncodeToString(buf[:]), nil
+}
+
+func validID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".history-*")
+	if err != nil {
+		return fmt.Errorf("write history entry: %w", err)
+	}
+	tmpName := tmp.Name()
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Chmod(tmpName, 0o600)
+	}
+	if werr == nil {
+		werr = os.Rename(tmpName, path)
+	}
+	if werr != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("write history entry: %w", werr)
+	}
+	return nil
+}
+
+func normalizeASN(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > 2 && strings.EqualFold(raw[:2], "AS") {
+		raw = raw[2:]
+	}
+	return raw
+}
+
+func normalizeASNs(raw []string) []string {
+	seen := make(map[string]struct{}, len(raw))
+	out := make([]string, 0, len(raw))
+	for _, v := range raw {
+		asn := normalizeASN(v)
+		if asn == "" || asn == "*" {
+			continue
+		}
+		if _, ok := seen[asn]; ok {
+			continue
+		}
+		seen[asn] = struct{}{}
+		out = append(out, asn)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTime accepts RFC 3339 timestamps and YYYY-MM-DD dates (UTC). For
+// dates, endOfDay moves the bound to the start of the following day so an
+// "until" date is inclusive.
+func ParseTime(raw string, endOfDay bool) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC 3339 or YYYY-MM-DD", raw)
+	}
+	if endOfDay {
+		t = t.Add(24 * time.Hour)
+	}
+	return t, nil
+}
@@ -0,0 +1,110 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func addTestEntry(t *testing.T, s *Store, kind, target string, at time.Time, asns ...string) Entry {
+	t.Helper()
+	entry, err := s.Add(Entry{
+		Summary: Summary{Kind: kind, Target: target, CreatedAt: at, ASNs: asns, Token: "ci"},
+		Result:  json.RawMessage(`{"hops":[]}`),
+	})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	return entry
+}
+
+func TestStoreAddGetAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	added := addTestEntry(t, s, KindTrace, "1.1.1.1", time.Now().UTC(), "AS13335", "13335", "*")
+	if added.ID == "" || len(added.ASNs) != 1 || added.ASNs[0] != "13335" {
+		t.Fatalf("added = %+v, want id and normalized ASNs", added.Summary)
+	}
+
+	reopened, err := Open(dir, Retention{})
+	if err != nil {
+		t.Fatalf("Open(reopen) error = %v", err)
+	}
+	got, err := reopened.Get(added.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Target != "1.1.1.1" || got.Token != "ci" || string(got.Result) != `{"hops":[]}` {
+		t.Fatalf("Get() = %+v result=%s", got.Summary, got.Result)
+	}
+	if _, err := reopened.Get("../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(traversal) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreListFilters(t *testing.T) {
+	s, err := Open(t.TempDir(), Retention{})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	day := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	addTestEntry(t, s, KindTrace, "www.example.com", day, "64500")
+	addTestEntry(t, s, KindMTR, "www.example.com", day.Add(24*time.Hour), "64501")
+	newest := addTestEntry(t, s, KindTrace, "1.1.1.1", day.Add(48*time.Hour), "13335")
+
+	all := s.List(Filter{})
+	if len(all) != 3 || all[0].ID != newest.ID {
+		t.Fatalf("List() = %d entries first=%v, want 3 newest first", len(all), all)
+	}
+	if got := s.List(Filter{Target: "EXAMPLE"}); len(got) != 2 {
+		t.Fatalf("target filter = %d entries, want 2", len(got))
+	}
+	if got := s.List(Filter{ASN: "AS64501"}); len(got) != 1 || got[0].Kind != KindMTR {
+		t.Fatalf("asn filter = %+v", got)
+	}
+	if got := s.List(Filter{Since: day.Add(time.Hour), Until: day.Add(47 * time.Hour)}); len(got) != 1 {
+		t.Fatalf("date filter = %d entries, want 1", len(got))
+	}
+	if got := s.List(Filter{Kind: KindTrace, Limit: 1}); len(got) != 1 || got[0].ID != newest.ID {
+		t.Fatalf("kind+limit filter = %+v", got)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{MaxEntries: 2, MaxAge: 7 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	now := time.Now().UTC()
+	stale := addTestEntry(t, s, KindTrace, "old", now.Add(-8*24*time.Hour))
+	if _, err := s.Get(stale.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("stale entry kept: %v", err)
+	}
+	first := addTestEntry(t, s, KindTrace, "a", now.Add(-2*time.Hour))
+	addTestEntry(t, s, KindTrace, "b", now.Add(-time.Hour))
+	addTestEntry(t, s, KindTrace, "c", now)
+
+	if got := s.List(Filter{}); len(got) != 2 {
+		t.Fatalf("List() = %d entries, want 2 after max_entries", len(got))
+	}
+	if _, err := os.Stat(filepath.Join(dir, first.ID+entryFileSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("oldest entry file still present: %v", err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	until, err := ParseTime("2026-10-01", true)
+	if err != nil || !until.Equal(time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("ParseTime(date, endOfDay) = %v, %v", until, err)
+	}
+	if _, err := ParseTime("last week", false); err == nil {
+		t.Fatal("ParseTime(invalid) error = nil")
+	}
+}
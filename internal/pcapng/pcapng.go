@@ -0,0 +1,159 @@
+// Package pcapng writes raw IP packets to a pcapng file with a comment and
+// a direction on every packet. gopacket's pcapgo writer has no per-packet
+// options, which is what makes a capture of a trace readable.
+package pcapng
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	blockSectionHeader  = 0x0A0D0D0A
+	blockInterface      = 0x00000001
+	blockEnhancedPacket = 0x00000006
+	byteOrderMagic      = 0x1A2B3C4D
+	linkTypeRaw         = 101
+	snapLen             = 65535
+)
+
+// Option codes. Codes are scoped by block type, hence the repeats.
+const (
+	optEndOfOpt    = 0
+	optComment     = 1
+	optIfName      = 2
+	optEPBFlags    = 2
+	optSHBUserAppl = 4
+	optIfTSResol   = 9
+)
+
+const (
+	flagInbound  uint32 = 1
+	flagOutbound uint32 = 2
+)
+
+// Direction tells which way a packet went.
+type Direction int
+
+const (
+	Unknown Direction = iota
+	Inbound
+	Outbound
+)
+
+// Writer writes one section with one raw-IP interface. It is not safe for
+// concurrent use.
+type Writer struct {
+	w *bufio.Writer
+}
+
+type option struct {
+	code  uint16
+	value []byte
+}
+
+// NewWriter writes the section and interface headers. app names the
+// writing application; ifName describes the capture, such as the target.
+func NewWriter(w io.Writer, app, ifName string) (*Writer, error) {
+	pw := &Writer{w: bufio.NewWriter(w)}
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:4], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:6], 1)
+	binary.LittleEndian.PutUint16(shb[6:8], 0)
+	// Section length unknown.
+	binary.LittleEndian.PutUint64(shb[8:16], ^uint64(0))
+	if err := pw.block(blockSectionHeader, shb, nil, []option{{optSHBUserAppl, []byte(app)}}); err != nil {
+		return nil, err
+	}
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:2], linkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[4:8], snapLen)
+	// Timestamps in microseconds, the pcapng default, spelled out for
+	// readers that insist on it.
+	opts := []option{{optIfTSResol, []byte{6}}}
+	if ifName != "" {
+		opts = append(opts, option{optIfName, []byte(ifName)})
+	}
+	if err := pw.block(blockInterface, idb, nil, opts); err != nil {
+		return nil, err
+	}
+	return pw, pw.w.Flush()
+}
+
+// WritePacket writes an IPv4 or IPv6 packet.
+func (pw *Writer) WritePacket(at time.Time, data []byte, dir Direction, comment string) error {
+	head := make([]byte, 20)
+	ts := uint64(at.UnixMicro())
+	binary.LittleEndian.PutUint32(head[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(head[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(head[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(head[16:20], uint32(len(data)))
+	var opts []option
+	if comment != "" {
+		opts = append(opts, option{optComment, []byte(comment)})
+	}
+	if flags := directionFlags(dir); flags != 0 {
+		v := make([]byte, 4)
+		binary.LittleEndian.PutUint32(v, flags)
+		opts = append(opts, option{optEPBFlags, v})
+	}
+	return pw.block(blockEnhancedPacket, head, data, opts)
+}
+
+// Flush writes buffered packets to the underlying writer.
+func (pw *Writer) Flush() error {
+	return pw.w.Flush()
+}
+
+func directionFlags(dir Direction) uint32 {
+	switch dir {
+	case Inbound:
+		return flagInbound
+	case Outbound:
+		return flagOutbound
+	}
+	return 0
+}
+
+// block writes type, length, the fixed body, data padded to 32 bits, the
+// options and the trailing length.
+func (pw *Writer) block(typ uint32, body, data []byte, opts []option) error {
+	length := 12 + len(body) + pad4(len(data))
+	if len(opts) > 0 {
+		for _, o := range opts {
+			length += 4 + pad4(len(o.value))
+		}
+		length += 4
+	}
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], typ)
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(length))
+	buf := append(hdr[:], body...)
+	buf = appendPadded(buf, data)
+	if len(opts) > 0 {
+		for _, o := range opts {
+			buf = binary.LittleEndian.AppendUint16(buf, o.code)
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(len(o.value)))
+			buf = appendPadded(buf, o.value)
+		}
+		buf = binary.LittleEndian.AppendUint16(buf, optEndOfOpt)
+		buf = binary.LittleEndian.AppendUint16(buf, 0)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(length))
+	_, err := pw.w.Write(buf)
+	return err
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func appendPadded(buf, v []byte) []byte {
+	buf = append(buf, v...)
+	for i := len(v); i < pad4(len(v)); i++ {
+		buf = append(buf, 0)
+	}
+	return buf
+}
@@ -0,0 +1,84 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "NextTrace", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+	packet := []byte{0x45, 0, 0, 20, 0, 0, 0, 0, 1, 1, 0, 0, 192, 0, 2, 1, 192, 0, 2, 2, 0xAA}
+	if err := w.WritePacket(at, packet, Outbound, "probe ttl=1 attempt=1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(at.Add(time.Millisecond), packet[:20], Inbound, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len()%4 != 0 {
+		t.Fatalf("file length %d is not 32-bit aligned", buf.Len())
+	}
+
+	r, err := pcapgo.NewNgReader(bytes.NewReader(buf.Bytes()), pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LinkType() != layers.LinkTypeRaw {
+		t.Fatalf("link type = %v", r.LinkType())
+	}
+	data, ci, err := r.ReadPacketData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, packet) || !ci.Timestamp.Equal(at) || ci.CaptureLength != len(packet) {
+		t.Fatalf("first packet = %x at %v (%d bytes)", data, ci.Timestamp, ci.CaptureLength)
+	}
+	data, _, err = r.ReadPacketData()
+	if err != nil || len(data) != 20 {
+		t.Fatalf("second packet = %x, %v", data, err)
+	}
+}
+
+func TestWriterPacketOptions(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "NextTrace", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := buf.Len()
+	if err := w.WritePacket(time.Unix(0, 0), []byte{1, 2, 3}, Inbound, "matched"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	epb := buf.Bytes()[start:]
+	if typ := binary.LittleEndian.Uint32(epb); typ != blockEnhancedPacket {
+		t.Fatalf("block type = %#x", typ)
+	}
+	length := binary.LittleEndian.Uint32(epb[4:])
+	if int(length) != len(epb) || binary.LittleEndian.Uint32(epb[len(epb)-4:]) != length {
+		t.Fatalf("block length %d, trailer %d, have %d bytes", length, binary.LittleEndian.Uint32(epb[len(epb)-4:]), len(epb))
+	}
+	// Header, 3 data bytes padded to 4, then the options.
+	opts := epb[28+4 : len(epb)-4]
+	if code := binary.LittleEndian.Uint16(opts); code != optComment || string(opts[4:11]) != "matched" {
+		t.Fatalf("first option = %x", opts)
+	}
+	flags := opts[12:]
+	if code := binary.LittleEndian.Uint16(flags); code != optEPBFlags || binary.LittleEndian.Uint32(flags[4:]) != flagInbound {
+		t.Fatalf("flags option = %x", flags)
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// DualStack resolves both the A and AAAA records of the target, traces (or
+// runs MTR reports towards) both addresses at the same time and compares the
+// two paths.
+func (s *Service) DualStack(ctx context.Context, req DualStackRequest) (DualStackResponse, error) {
+	start := time.Now()
+	if req.IPv4Only || req.IPv6Only {
+		return DualStackResponse{}, errors.New("ipv4_only and ipv6_only do not apply to dual-stack comparison")
+	}
+	if strings.TrimSpace(req.SourceAddress) != "" {
+		return DualStackResponse{}, errors.New("source_address does not apply to dual-stack comparison; use source_device")
+	}
+	tool, mode := PolicyToolTrace, "trace"
+	requested, defaults := PolicyLimits{MaxHops: req.MaxHops, Queries: req.Queries}, PolicyLimits{MaxHops: defaultMaxHops, Queries: defaultQueries}
+	if req.MTR {
+		tool, mode = PolicyToolMTR, "mtr"
+		requested, defaults = PolicyLimits{MaxHops: req.MaxHops, Queries: req.MaxPerHop}, PolicyLimits{MaxHops: defaultMaxHops, Queries: 10}
+	}
+	if err := s.policy.CheckTool(tool); err != nil {
+		return DualStackResponse{}, err
+	}
+	limits, err := s.policy.CheckLimits(tool, requested, defaults)
+	if err != nil {
+		return DualStackResponse{}, err
+	}
+	base := req.TraceRequest
+	base.MaxHops, base.Queries = limits.MaxHops, limits.Queries
+	if req.MTR {
+		base.Queries = 1
+	}
+	runCtx, cancel := s.policy.WithDeadline(ctx)
+	defer cancel()
+
+	var setups [2]*traceSetup
+	for i, v6 := range []bool{false, true} {
+		familyReq := base
+		familyReq.IPv4Only, familyReq.IPv6Only = !v6, v6
+		if setups[i], err = s.prepareTrace(runCtx, tool, familyReq); err != nil {
+			return DualStackResponse{}, err
+		}
+	}
+
+	var sides [2]trace.DualStackSide
+	err = withTraceRuntimeNoResult(runCtx, setups[0], func() error {
+		var wg sync.WaitGroup
+		for i, setup := range setups {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sides[i] = runDualStackSide(runCtx, setup, req, limits.Queries)
+			}()
+		}
+		wg.Wait()
+		return ctx.Err()
+	})
+	if err != nil {
+		return DualStackResponse{}, err
+	}
+
+	cmp := trace.CompareDualStack(setups[0].Target, sides[0], sides[1])
+	return DualStackResponse{
+		Target:     setups[0].Target,
+		Protocol:   setups[0].Protocol,
+		Mode:       mode,
+		IPv4:       dualStackFamilyResponse(cmp.IPv4, setups[0].Config.Lang),
+		IPv6:       dualStackFamilyResponse(cmp.IPv6, setups[1].Config.Lang),
+		Diverge:    cmp.Diverge,
+		Verdict:    cmp.Verdict,
+		DurationMs: durationMs(start),
+		Parameters: dualStackParameterBoundaries(),
+	}, nil
+}
+
+// runDualStackSide runs one address family. Hitting the policy max_duration
+// during an MTR report keeps the statistics collected so far, like MTRReport.
+func runDualStackSide(ctx context.Context, setup *traceSetup, req DualStackRequest, maxPerHop int) trace.DualStackSide {
+	if !req.MTR {
+		res, err := trace.TracerouteWithContext(ctx, setup.Method, setup.Config)
+		if err != nil {
+			return trace.DualStackSideError(setup.IP, err)
+		}
+		return trace.DualStackSideFromResult(setup.IP, res)
+	}
+	var latest []trace.MTRHopStat
+	err := runMTRFn(ctx, setup.Method, setup.Config, trace.MTROptions{
+		HopInterval: time.Duration(positiveOrDefault(req.HopIntervalMs, defaultMTRHopIntervalMs)) * time.Millisecond,
+		MaxPerHop:   maxPerHop,
+	}, func(_ int, stats []trace.MTRHopStat) {
+		latest = cloneMTRStats(stats)
+	})
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return trace.DualStackSideError(setup.IP, err)
+	}
+	return trace.DualStackSideFromMTR(setup.IP, latest)
+}
+
+func dualStackFamilyResponse(side trace.DualStackSide, lang string) DualStackFamily {
+	return DualStackFamily{
+		ResolvedIP:  side.IP,
+		Reached:     side.Reached,
+		HopCount:    side.HopCount,
+		RTTMs:       side.RTTMs,
+		LossPercent: side.LossPct,
+		ASPath:      side.ASPath,
+		Hops:        convertTraceHops(side.Result, lang),
+		Stats:       side.MTR,
+		Error:       side.Error,
+	}
+}
+
+func dualStackParameterBoundaries() ParameterBoundaries {
+	return ParameterBoundaries{
+		Supported: append(withoutParams(traceSupportedParams(),
+			"ipv4_only",
+			"ipv6_only",
+			"source_address",
+		), "mtr", "hop_interval_ms", "max_per_hop"),
+		NotApplicable: []string{
+			"ipv4_only",
+			"ipv6_only",
+			"source_address",
+			"globalping_locations",
+			"globalping_limit",
+		},
+	}
+}
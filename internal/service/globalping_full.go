@@ -15,6 +15,19 @@ import (
 )
 
 func (s *Service) GlobalpingTrace(ctx context.Context, req GlobalpingTraceRequest) (GlobalpingMeasurementResponse, error) {
+	if err := s.policy.CheckTool(PolicyToolGlobalping); err != nil {
+		return GlobalpingMeasurementResponse{}, err
+	}
+	if target := strings.TrimSpace(req.Target); target != "" {
+		if err := s.policy.CheckRemoteHost(PolicyToolGlobalping, target); err != nil {
+			return GlobalpingMeasurementResponse{}, err
+		}
+	}
+	limits, err := s.policy.CheckLimits(PolicyToolGlobalping, PolicyLimits{Queries: req.Packets}, PolicyLimits{Queries: defaultQueries})
+	if err != nil {
+		return GlobalpingMeasurementResponse{}, err
+	}
+	req.Packets = limits.Queries
 	create, err := buildGlobalpingCreate(req)
 	if err != nil {
 		return GlobalpingMeasurementResponse{}, err
@@ -27,6 +40,9 @@ func (s *Service) GlobalpingTrace(ctx context.Context, req GlobalpingTraceReques
 }
 
 func (s *Service) GlobalpingLimits(ctx context.Context, _ GlobalpingLimitsRequest) (GlobalpingLimitsResponse, error) {
+	if err := s.policy.CheckTool(PolicyToolGlobalping); err != nil {
+		return GlobalpingLimitsResponse{}, err
+	}
 	limits, err := trace.NewGlobalpingClient(ctx).Limits()
 	if err != nil {
 		return GlobalpingLimitsResponse{}, err
@@ -46,6 +62,9 @@ func (s *Service) GlobalpingLimits(ctx context.Context, _ GlobalpingLimitsReques
 }
 
 func (s *Service) GlobalpingGetMeasurement(ctx context.Context, req GlobalpingGetMeasurementRequest) (GlobalpingMeasurementResponse, error) {
+	if err := s.policy.CheckTool(PolicyToolGlobalping); err != nil {
+		return GlobalpingMeasurementResponse{}, err
+	}
 	id := strings.TrimSpace(req.MeasurementID)
 	if id == "" {
 		return GlobalpingMeasurementResponse{}, errors.New("measurement_id is required")
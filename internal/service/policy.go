@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// Policy tool names used by the per-tool enable switches.
+const (
+	PolicyToolTrace      = "traceroute"
+	PolicyToolMTR        = "mtr"
+	PolicyToolMTU        = "mtu"
+	PolicyToolSpeed      = "speed"
+	PolicyToolAnnotate   = "annotate"
+	PolicyToolGeo        = "geo"
+	PolicyToolGlobalping = "globalping"
+)
+
+var policyTools = []string{PolicyToolTrace, PolicyToolMTR, PolicyToolMTU, PolicyToolSpeed, PolicyToolAnnotate, PolicyToolGeo, PolicyToolGlobalping}
+
+// Policy rejection codes carried by PolicyError.
+const (
+	PolicyCodeToolDisabled     = "tool_disabled"
+	PolicyCodeTargetDenied     = "target_denied"
+	PolicyCodeTargetNotAllowed = "target_not_allowed"
+	PolicyCodeReservedTarget   = "reserved_target"
+	PolicyCodeLimitExceeded    = "limit_exceeded"
+	PolicyCodeSocketNotAllowed = "socket_not_allowed"
+)
+
+// PolicyConfig is the "policy" section of the deploy configuration.
+type PolicyConfig struct {
+	AllowCIDRs    []string        `mapstructure:"allow_cidrs"`
+	DenyCIDRs     []string        `mapstructure:"deny_cidrs"`
+	AllowDomains  []string        `mapstructure:"allow_domains"`
+	DenyDomains   []string        `mapstructure:"deny_domains"`
+	BlockReserved bool            `mapstructure:"block_reserved"`
+	MaxHops       int             `mapstructure:"max_hops"`
+	MaxQueries    int             `mapstructure:"max_queries"`
+	MaxDuration   time.Duration   `mapstructure:"max_duration"`
+	Tools         map[string]bool `mapstructure:"tools"`
+	// Per-request netns, VRF and fwmark overrides are denied unless listed.
+	AllowNetNS   []string `mapstructure:"allow_netns"`
+	AllowVRFs    []string `mapstructure:"allow_vrfs"`
+	AllowFwMarks []string `mapstructure:"allow_fwmarks"`
+}
+
+// PolicyError is a structured rejection returned by every Policy check.
+type PolicyError struct {
+	Code    string `json:"code"`
+	Tool    string `json:"tool"`
+	Target  string `json:"target,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("policy %s: %s", e.Code, e.Message)
+}
+
+// PolicyLimits carries the hop, query and duration values of one request.
+// Zero means the request left the value unset.
+type PolicyLimits struct {
+	MaxHops  int
+	Queries  int
+	Duration time.Duration
+}
+
+// Policy restricts which targets the probe host may be pointed at and how
+// hard. A nil *Policy allows every target but no socket overrides.
+type Policy struct {
+	allowNets    []netip.Prefix
+	denyNets     []netip.Prefix
+	allowDomains []string
+	denyDomains  []string
+	reserved     bool
+	limits       PolicyLimits
+	disabled     map[string]struct{}
+	allowNetNS   []string
+	allowVRFs    []string
+	allowFwMarks []uint32
+}
+
+// NewPolicy validates cfg. It returns nil when cfg imposes no restriction.
+func NewPolicy(cfg PolicyConfig) (*Policy, error) {
+	p := &Policy{reserved: cfg.BlockReserved, disabled: map[string]struct{}{}}
+	var err error
+	if p.allowNets, err = parsePolicyPrefixes("allow_cidrs", cfg.AllowCIDRs); err != nil {
+		return nil, err
+	}
+	if p.denyNets, err = parsePolicyPrefixes("deny_cidrs", cfg.DenyCIDRs); err != nil {
+		return nil, err
+	}
+	p.allowDomains = normalizePolicyDomains(cfg.AllowDomains)
+	p.denyDomains = normalizePolicyDomains(cfg.DenyDomains)
+	if cfg.MaxHops < 0 || cfg.MaxQueries < 0 || cfg.MaxDuration < 0 {
+		return nil, fmt.Errorf("policy ceilings must not be negative")
+	}
+	p.limits = PolicyLimits{MaxHops: cfg.MaxHops, Queries: cfg.MaxQueries, Duration: cfg.MaxDuration}
+	p.allowNetNS = trimPolicyNames(cfg.AllowNetNS)
+	p.allowVRFs = trimPolicyNames(cfg.AllowVRFs)
+	for _, item := range trimPolicyNames(cfg.AllowFwMarks) {
+		mark, err := util.ParseFwMark(item)
+		if err != nil {
+			return nil, fmt.Errorf("policy allow_fwmarks: %w", err)
+		}
+		p.allowFwMarks = append(p.allowFwMarks, mark)
+	}
+	for tool, enabled := range cfg.Tools {
+		tool = strings.ToLower(strings.TrimSpace(tool))
+		if !containsFold(policyTools, tool) {
+			return nil, fmt.Errorf("policy tools: unknown tool %q (supported: %s)", tool, strings.Join(policyTools, ", "))
+		}
+		if !enabled {
+			p.disabled[tool] = struct{}{}
+		}
+	}
+	if p.empty() {
+		return nil, nil
+	}
+	return p, nil
+}
+
+func (p *Policy) empty() bool {
+	return len(p.allowNets) == 0 && len(p.denyNets) == 0 && len(p.allowDomains) == 0 &&
+		len(p.denyDomains) == 0 && !p.reserved && p.limits == (PolicyLimits{}) && len(p.disabled) == 0 &&
+		len(p.allowNetNS) == 0 && len(p.allowVRFs) == 0 && len(p.allowFwMarks) == 0
+}
+
+func parsePolicyPrefixes(field string, raw []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(raw))
+	for _, item := range raw {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: invalid address %q", field, item)
+			}
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: invalid CIDR %q", field, item)
+		}
+		out = append(out, prefix.Masked())
+	}
+	return out, nil
+}
+
+func normalizePolicyDomains(raw []string) []string {
+	out := make([]string, 0, len(raw))
+	for _, item := range raw {
+		item = strings.ToLower(strings.TrimSpace(item))
+		item = strings.TrimPrefix(item, "*.")
+		item = strings.Trim(item, ".")
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func trimPolicyNames(raw []string) []string {
+	out := make([]string, 0, len(raw))
+	for _, item := range raw {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// CheckTool rejects calls to tools switched off in the policy.
+func (p *Policy) CheckTool(tool string) error {
+	if p == nil {
+		return nil
+	}
+	if _, off := p.disabled[tool]; off {
+		return &PolicyError{Code: PolicyCodeToolDisabled, Tool: tool, Message: fmt.Sprintf("tool %q is disabled on this server", tool)}
+	}
+	return nil
+}
+
+// CheckHost applies the domain rules to a target before it is resolved. IP
+// literals are checked against the CIDR rules directly.
+func (p *Policy) CheckHost(tool, host string) error {
+	if p == nil {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(tool, host, ip)
+	}
+	name := strings.Trim(strings.ToLower(host), ".")
+	if rule, ok := matchPolicyDomain(p.denyDomains, name); ok {
+		return &PolicyError{Code: PolicyCodeTargetDenied, Tool: tool, Target: host, Rule: rule, Message: fmt.Sprintf("target %s matches deny_domains entry %s", host, rule)}
+	}
+	return nil
+}
+
+// CheckIP applies the CIDR, reserved-range and allow-list rules to the address
+// that will actually be probed. host is the name the caller asked for.
+func (p *Policy) CheckIP(tool, host string, ip net.IP) error {
+	if p == nil || ip == nil {
+		return nil
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return nil
+	}
+	addr = addr.Unmap()
+	if rule, ok := matchPolicyPrefix(p.denyNets, addr); ok {
+		return &PolicyError{Code: PolicyCodeTargetDenied, Tool: tool, Target: host, Rule: rule, Message: fmt.Sprintf("target %s (%s) matches deny_cidrs entry %s", host, addr, rule)}
+	}
+	if p.reserved {
+		if whois, ok := ipgeo.ReservedWhois(addr.String()); ok {
+			return &PolicyError{Code: PolicyCodeReservedTarget, Tool: tool, Target: host, Rule: whois, Message: fmt.Sprintf("target %s (%s) is in a private or reserved range (%s)", host, addr, whois)}
+		}
+	}
+	if len(p.allowNets) == 0 && len(p.allowDomains) == 0 {
+		return nil
+	}
+	if _, ok := matchPolicyPrefix(p.allowNets, addr); ok {
+		return nil
+	}
+	if net.ParseIP(host) == nil {
+		if _, ok := matchPolicyDomain(p.allowDomains, strings.Trim(strings.ToLower(host), ".")); ok {
+			return nil
+		}
+	}
+	return &PolicyError{Code: PolicyCodeTargetNotAllowed, Tool: tool, Target: host, Message: fmt.Sprintf("target %s (%s) is not covered by allow_cidrs or allow_domains", host, addr)}
+}
+
+// CheckRemoteHost is used when the target is resolved by someone else (such as
+// Globalping probes). Hostnames can only satisfy allow_domains there.
+func (p *Policy) CheckRemoteHost(tool, host string) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.CheckHost(tool, host); err != nil || net.ParseIP(host) != nil {
+		return err
+	}
+	if len(p.allowNets) == 0 && len(p.allowDomains) == 0 {
+		return nil
+	}
+	if _, ok := matchPolicyDomain(p.allowDomains, strings.Trim(strings.ToLower(host), ".")); ok {
+		return nil
+	}
+	return &PolicyError{Code: PolicyCodeTargetNotAllowed, Tool: tool, Target: host, Message: fmt.Sprintf("target %s is not covered by allow_domains", host)}
+}
+
+// CheckSocket rejects request netns, VRF and fwmark values missing from
+// allow_netns, allow_vrfs and allow_fwmarks. Without a policy every override
+// is rejected; the deploy instance defaults need no request field.
+func (p *Policy) CheckSocket(tool string, opts util.SocketOptions) error {
+	var allowNetNS, allowVRFs []string
+	var allowFwMarks []uint32
+	if p != nil {
+		allowNetNS, allowVRFs, allowFwMarks = p.allowNetNS, p.allowVRFs, p.allowFwMarks
+	}
+	deny := func(field, rule, value string) error {
+		return &PolicyError{Code: PolicyCodeSocketNotAllowed, Tool: tool, Rule: rule, Message: fmt.Sprintf("%s %s is not listed in %s on this server", field, value, rule)}
+	}
+	if opts.NetNS != "" && !slices.Contains(allowNetNS, opts.NetNS) {
+		return deny("netns", "allow_netns", fmt.Sprintf("%q", opts.NetNS))
+	}
+	if opts.VRF != "" && !slices.Contains(allowVRFs, opts.VRF) {
+		return deny("vrf", "allow_vrfs", fmt.Sprintf("%q", opts.VRF))
+	}
+	if opts.FwMark != 0 && !slices.Contains(allowFwMarks, opts.FwMark) {
+		return deny("fwmark", "allow_fwmarks", fmt.Sprintf("%#x", opts.FwMark))
+	}
+	return nil
+}
+
+// CheckLimits rejects explicit request values above the configured ceilings
+// and returns the values to use, with unset fields falling back to def capped
+// at the ceiling.
+func (p *Policy) CheckLimits(tool string, req, def PolicyLimits) (PolicyLimits, error) {
+	out := PolicyLimits{
+		MaxHops:  pickPolicyLimit(req.MaxHops, def.MaxHops),
+		Queries:  pickPolicyLimit(req.Queries, def.Queries),
+		Duration: time.Duration(pickPolicyLimit(int(req.Duration), int(def.Duration))),
+	}
+	if p == nil {
+		return out, nil
+	}
+	var err error
+	if out.MaxHops, err = applyPolicyCeiling(tool, "max_hops", req.MaxHops, out.MaxHops, p.limits.MaxHops); err != nil {
+		return PolicyLimits{}, err
+	}
+	if out.Queries, err = applyPolicyCeiling(tool, "queries", req.Queries, out.Queries, p.limits.Queries); err != nil {
+		return PolicyLimits{}, err
+	}
+	duration, err := applyPolicyCeiling(tool, "duration_ms", int(req.Duration/time.Millisecond), int(out.Duration/time.Millisecond), int(p.limits.Duration/time.Millisecond))
+	if err != nil {
+		return PolicyLimits{}, err
+	}
+	out.Duration = time.Duration(duration) * time.Millisecond
+	return out, nil
+}
+
+// WithDeadline bounds ctx by max_duration so open-ended runs still stop.
+func (p *Policy) WithDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p == nil || p.limits.Duration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.limits.Duration)
+}
+
+func pickPolicyLimit(req, def int) int {
+	if req > 0 {
+		return req
+	}
+	return def
+}
+
+func applyPolicyCeiling(tool, field string, requested, effective, ceiling int) (int, error) {
+	if ceiling <= 0 {
+		return effective, nil
+	}
+	if requested > ceiling {
+		return 0, &PolicyError{Code: PolicyCodeLimitExceeded, Tool: tool, Rule: field, Message: fmt.Sprintf("%s %d exceeds the server limit of %d", field, requested, ceiling)}
+	}
+	if effective <= 0 || effective > ceiling {
+		return ceiling, nil
+	}
+	return effective, nil
+}
+
+func matchPolicyPrefix(prefixes []netip.Prefix, addr netip.Addr) (string, bool) {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return prefix.String(), true
+		}
+	}
+	return "", false
+}
+
+func matchPolicyDomain(domains []string, name string) (string, bool) {
+	for _, domain := range domains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+type policyContextKey struct{}
+
+// WithPolicy attaches p to ctx for handlers that do not go through Service.
+func WithPolicy(ctx context.Context, p *Policy) context.Context {
+	if p == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, policyContextKey{}, p)
+}
+
+// PolicyFromContext returns the policy attached by WithPolicy, or nil.
+func PolicyFromContext(ctx context.Context) *Policy {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(policyContextKey{}).(*Policy)
+	return p
+}
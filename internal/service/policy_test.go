@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+func requirePolicyCode(t *testing.T, err error, code string) *PolicyError {
+	t.Helper()
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("error = %v, want *PolicyError %s", err, code)
+	}
+	if policyErr.Code != code {
+		t.Fatalf("policy code = %q, want %q (%v)", policyErr.Code, code, err)
+	}
+	return policyErr
+}
+
+func TestNewPolicyEmptyConfigReturnsNil(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{Tools: map[string]bool{"traceroute": true}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if p != nil {
+		t.Fatalf("NewPolicy() = %+v, want nil for a no-op config", p)
+	}
+	if err := p.CheckHost(PolicyToolTrace, "10.0.0.1"); err != nil {
+		t.Fatalf("nil policy CheckHost() error = %v", err)
+	}
+}
+
+func TestNewPolicyRejectsInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]PolicyConfig{
+		"bad cidr":      {DenyCIDRs: []string{"10.0.0.0/33"}},
+		"bad address":   {AllowCIDRs: []string{"not-an-ip"}},
+		"unknown tool":  {Tools: map[string]bool{"nmap": false}},
+		"negative hops": {MaxHops: -1},
+		"bad fwmark":    {AllowFwMarks: []string{"mark"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewPolicy(cfg); err == nil {
+				t.Fatal("NewPolicy() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestPolicyTargetRules(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{
+		AllowCIDRs:    []string{"1.1.1.0/24", "2606:4700::/32"},
+		AllowDomains:  []string{"*.example.com"},
+		DenyCIDRs:     []string{"1.1.1.1"},
+		DenyDomains:   []string{"internal.example.com"},
+		BlockReserved: true,
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	if err := p.CheckHost(PolicyToolTrace, "1.1.1.2"); err != nil {
+		t.Fatalf("allowed CIDR error = %v", err)
+	}
+	if err := p.CheckIP(PolicyToolTrace, "www.example.com", net.ParseIP("8.8.8.8")); err != nil {
+		t.Fatalf("allowed domain error = %v", err)
+	}
+	requirePolicyCode(t, p.CheckHost(PolicyToolTrace, "1.1.1.1"), PolicyCodeTargetDenied)
+	requirePolicyCode(t, p.CheckHost(PolicyToolTrace, "db.internal.example.com"), PolicyCodeTargetDenied)
+	requirePolicyCode(t, p.CheckHost(PolicyToolTrace, "8.8.8.8"), PolicyCodeTargetNotAllowed)
+	requirePolicyCode(t, p.CheckIP(PolicyToolTrace, "example.org", net.ParseIP("8.8.8.8")), PolicyCodeTargetNotAllowed)
+
+	reserved := requirePolicyCode(t, p.CheckIP(PolicyToolTrace, "www.example.com", net.ParseIP("192.168.1.1")), PolicyCodeReservedTarget)
+	if reserved.Rule != "RFC1918" || reserved.Target != "www.example.com" {
+		t.Fatalf("reserved rejection = %+v", reserved)
+	}
+	requirePolicyCode(t, p.CheckIP(PolicyToolTrace, "www.example.com", net.ParseIP("::ffff:127.0.0.1")), PolicyCodeReservedTarget)
+}
+
+func TestPolicyCheckRemoteHostRequiresAllowedDomain(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{AllowCIDRs: []string{"1.1.1.0/24"}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if err := p.CheckRemoteHost(PolicyToolGlobalping, "1.1.1.1"); err != nil {
+		t.Fatalf("allowed IP literal error = %v", err)
+	}
+	requirePolicyCode(t, p.CheckRemoteHost(PolicyToolGlobalping, "example.com"), PolicyCodeTargetNotAllowed)
+}
+
+func TestPolicyCheckLimits(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{MaxHops: 20, MaxQueries: 5, MaxDuration: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	got, err := p.CheckLimits(PolicyToolMTR, PolicyLimits{}, PolicyLimits{MaxHops: 30, Queries: 10})
+	if err != nil {
+		t.Fatalf("CheckLimits(defaults) error = %v", err)
+	}
+	want := PolicyLimits{MaxHops: 20, Queries: 5, Duration: 30 * time.Second}
+	if got != want {
+		t.Fatalf("CheckLimits(defaults) = %+v, want %+v", got, want)
+	}
+
+	got, err = p.CheckLimits(PolicyToolTrace, PolicyLimits{MaxHops: 10, Queries: 2}, PolicyLimits{MaxHops: 30, Queries: 3})
+	if err != nil || got.MaxHops != 10 || got.Queries != 2 {
+		t.Fatalf("CheckLimits(explicit) = %+v, %v", got, err)
+	}
+
+	rejected := requirePolicyCode(t, func() error {
+		_, err := p.CheckLimits(PolicyToolTrace, PolicyLimits{MaxHops: 64}, PolicyLimits{MaxHops: 30})
+		return err
+	}(), PolicyCodeLimitExceeded)
+	if rejected.Rule != "max_hops" {
+		t.Fatalf("rejected rule = %q, want max_hops", rejected.Rule)
+	}
+	requirePolicyCode(t, func() error {
+		_, err := p.CheckLimits(PolicyToolMTR, PolicyLimits{Duration: time.Minute}, PolicyLimits{})
+		return err
+	}(), PolicyCodeLimitExceeded)
+}
+
+func TestPolicyCheckSocket(t *testing.T) {
+	var none *Policy
+	if err := none.CheckSocket(PolicyToolTrace, util.SocketOptions{}); err != nil {
+		t.Fatalf("nil policy without overrides: %v", err)
+	}
+	requirePolicyCode(t, none.CheckSocket(PolicyToolTrace, util.SocketOptions{FwMark: 1}), PolicyCodeSocketNotAllowed)
+
+	p, err := NewPolicy(PolicyConfig{AllowNetNS: []string{"blue"}, AllowVRFs: []string{"vrf-blue"}, AllowFwMarks: []string{"0x10"}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if err := p.CheckSocket(PolicyToolMTR, util.SocketOptions{NetNS: "blue", VRF: "vrf-blue", FwMark: 16}); err != nil {
+		t.Fatalf("allowed overrides: %v", err)
+	}
+	for opts, rule := range map[util.SocketOptions]string{
+		{NetNS: "red"}:     "allow_netns",
+		{VRF: "vrf-red"}:   "allow_vrfs",
+		{FwMark: 0x20}:     "allow_fwmarks",
+		{NetNS: "default"}: "allow_netns",
+	} {
+		if got := requirePolicyCode(t, p.CheckSocket(PolicyToolMTR, opts), PolicyCodeSocketNotAllowed); got.Rule != rule {
+			t.Fatalf("%+v rule = %q, want %q", opts, got.Rule, rule)
+		}
+	}
+}
+
+func TestServiceRejectsDisabledToolAndDeniedTarget(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{
+		DenyCIDRs: []string{"192.0.2.0/24"},
+		Tools:     map[string]bool{PolicyToolSpeed: false, PolicyToolGeo: false},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	svc := NewWithPolicy(p)
+	ctx := context.Background()
+
+	_, err = svc.SpeedTest(ctx, SpeedTestRequest{})
+	requirePolicyCode(t, err, PolicyCodeToolDisabled)
+	_, err = svc.GeoLookup(ctx, GeoLookupRequest{Query: "1.1.1.1"})
+	requirePolicyCode(t, err, PolicyCodeToolDisabled)
+	_, err = svc.Traceroute(ctx, TraceRequest{Target: "192.0.2.10"})
+	requirePolicyCode(t, err, PolicyCodeTargetDenied)
+	_, err = svc.MTUTrace(ctx, MTUTraceRequest{Target: "192.0.2.10"})
+	requirePolicyCode(t, err, PolicyCodeTargetDenied)
+	_, err = svc.MTRRaw(ctx, MTRRawRequest{TraceRequest: TraceRequest{Target: "https://192.0.2.10/path"}})
+	requirePolicyCode(t, err, PolicyCodeTargetDenied)
+}
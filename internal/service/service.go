@@ -45,7 +45,9 @@ const (
 // RuntimeMu serializes process-global runtime mutations shared by Web, WebSocket, and MCP traces.
 var RuntimeMu sync.Mutex
 
-type Service struct{}
+type Service struct {
+	policy *Policy
+}
 
 type traceSetup struct {
 	Request      TraceRequest
@@ -63,6 +65,7 @@ type runtimeOptions struct {
 	DotServer   string
 	NeedsLeoWS  bool
 	PowProvider string
+	Socket      util.SocketOptions
 }
 
 var (
@@ -72,19 +75,34 @@ var (
 	runMTRFn                      = trace.RunMTR
 	runMTRRawFn                   = trace.RunMTRRaw
 	runMTUTraceFn                 = mtutrace.Run
+	domainLookUpFn                = util.DomainLookUpWithContext
 )
 
 func New() *Service {
 	return &Service{}
 }
 
+// NewWithPolicy returns a Service whose probing tools are restricted by p.
+func NewWithPolicy(p *Policy) *Service {
+	return &Service{policy: p}
+}
+
+// Policy returns the policy applied to this service, or nil.
+func (s *Service) Policy() *Policy {
+	if s == nil {
+		return nil
+	}
+	return s.policy
+}
+
 func (s *Service) Capabilities(context.Context, CapabilitiesRequest) (CapabilitiesResponse, error) {
 	return CapabilitiesResponse{
 		Tools: []ToolCapability{
 			toolCapability("nexttrace_capabilities", "List NextTrace MCP tools and parameter boundaries.", []string{}),
-			toolCapability("nexttrace_traceroute", "Run local ICMP/TCP/UDP traceroute and return structured hops.", traceSupportedParams()),
+			toolCapability("nexttrace_traceroute", "Run local ICMP/TCP/UDP/SCTP traceroute and return structured hops.", traceSupportedParams()),
 			toolCapabilityWithBoundaries("nexttrace_mtr_report", "Run bounded local MTR report and return per-hop statistics.", mtrReportParameterBoundaries()),
 			toolCapabilityWithBoundaries("nexttrace_mtr_raw", "Run bounded local MTR raw stream and return probe-level records.", mtrRawParameterBoundaries()),
+			toolCapabilityWithBoundaries("nexttrace_dual_stack", "Trace or MTR the IPv4 and IPv6 addresses of one hostname at the same time and compare hop counts, RTT/loss and AS paths.", dualStackParameterBoundaries()),
 			toolCapability("nexttrace_mtu_trace", "Run local UDP path-MTU discovery.", []string{"target", "port", "queries", "max_hops", "begin_hop", "timeout_ms", "ttl_interval_ms", "ipv4_only", "ipv6_only", "data_provider", "dot_server", "disable_rdns", "always_rdns", "language", "source_address", "source_port", "source_device"}),
 			toolCapability("nexttrace_speed_test", "Run a conservative local speed test.", []string{"provider", "max", "timeout_ms", "threads", "latency_count", "endpoint_ip", "no_metadata", "language", "dot_server", "source_address", "source_device"}),
 			toolCapability("nexttrace_annotate_ips", "Annotate IPv4/IPv6 literals in text with GeoIP metadata.", []string{"text", "data_provider", "timeout_ms", "language", "ipv4_only", "ipv6_only"}),
@@ -103,7 +121,19 @@ func (s *Service) Capabilities(context.Context, CapabilitiesRequest) (Capabiliti
 
 func (s *Service) Traceroute(ctx context.Context, req TraceRequest) (TraceResponse, error) {
 	start := time.Now()
-	setup, err := s.prepareTrace(ctx, req)
+	if err := s.policy.CheckTool(PolicyToolTrace); err != nil {
+		return TraceResponse{}, err
+	}
+	limits, err := s.policy.CheckLimits(PolicyToolTrace,
+		PolicyLimits{MaxHops: req.MaxHops, Queries: req.Queries},
+		PolicyLimits{MaxHops: defaultMaxHops, Queries: defaultQueries})
+	if err != nil {
+		return TraceResponse{}, err
+	}
+	req.MaxHops, req.Queries = limits.MaxHops, limits.Queries
+	ctx, cancel := s.policy.WithDeadline(ctx)
+	defer cancel()
+	setup, err := s.prepareTrace(ctx, PolicyToolTrace, req)
 	if err != nil {
 		return TraceResponse{}, err
 	}
@@ -129,25 +159,39 @@ func (s *Service) Traceroute(ctx context.Context, req TraceRequest) (TraceRespon
 
 func (s *Service) MTRReport(ctx context.Context, req MTRReportRequest) (MTRReportResponse, error) {
 	start := time.Now()
+	if err := s.policy.CheckTool(PolicyToolMTR); err != nil {
+		return MTRReportResponse{}, err
+	}
+	limits, err := s.policy.CheckLimits(PolicyToolMTR,
+		PolicyLimits{MaxHops: req.MaxHops, Queries: req.MaxPerHop},
+		PolicyLimits{MaxHops: defaultMaxHops, Queries: 10})
+	if err != nil {
+		return MTRReportResponse{}, err
+	}
 	base := req.TraceRequest
 	base.Queries = 1
-	setup, err := s.prepareTrace(ctx, base)
+	base.MaxHops = limits.MaxHops
+	setup, err := s.prepareTrace(ctx, PolicyToolMTR, base)
 	if err != nil {
 		return MTRReportResponse{}, err
 	}
 
+	runCtx, cancel := s.policy.WithDeadline(ctx)
+	defer cancel()
 	hopInterval := positiveOrDefault(req.HopIntervalMs, defaultMTRHopIntervalMs)
-	maxPerHop := positiveOrDefault(req.MaxPerHop, 10)
+	maxPerHop := limits.Queries
 	var latest []trace.MTRHopStat
-	err = withTraceRuntimeNoResult(ctx, setup, func() error {
-		return runMTRFn(ctx, setup.Method, setup.Config, trace.MTROptions{
+	err = withTraceRuntimeNoResult(runCtx, setup, func() error {
+		return runMTRFn(runCtx, setup.Method, setup.Config, trace.MTROptions{
 			HopInterval: time.Duration(hopInterval) * time.Millisecond,
 			MaxPerHop:   maxPerHop,
 		}, func(_ int, stats []trace.MTRHopStat) {
 			latest = cloneMTRStats(stats)
 		})
 	})
-	if err != nil {
+	// Hitting the policy max_duration ends the report early but keeps the
+	// statistics collected so far.
+	if err != nil && (ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded)) {
 		return MTRReportResponse{}, err
 	}
 
@@ -163,9 +207,21 @@ func (s *Service) MTRReport(ctx context.Context, req MTRReportRequest) (MTRRepor
 
 func (s *Service) MTRRaw(ctx context.Context, req MTRRawRequest) (MTRRawResponse, error) {
 	start := time.Now()
+	if err := s.policy.CheckTool(PolicyToolMTR); err != nil {
+		return MTRRawResponse{}, err
+	}
+	limits, err := s.policy.CheckLimits(PolicyToolMTR,
+		PolicyLimits{MaxHops: req.MaxHops, Queries: req.MaxPerHop, Duration: time.Duration(req.DurationMs) * time.Millisecond},
+		PolicyLimits{MaxHops: defaultMaxHops})
+	if err != nil {
+		return MTRRawResponse{}, err
+	}
+	req.MaxPerHop = limits.Queries
+	req.DurationMs = int(limits.Duration / time.Millisecond)
 	base := req.TraceRequest
 	base.Queries = 1
-	setup, err := s.prepareTrace(ctx, base)
+	base.MaxHops = limits.MaxHops
+	setup, err := s.prepareTrace(ctx, PolicyToolMTR, base)
 	if err != nil {
 		return MTRRawResponse{}, err
 	}
@@ -218,6 +274,24 @@ func (s *Service) MTRRaw(ctx context.Context, req MTRRawRequest) (MTRRawResponse
 
 func (s *Service) MTUTrace(ctx context.Context, req MTUTraceRequest) (MTUTraceResponse, error) {
 	start := time.Now()
+	if err := s.policy.CheckTool(PolicyToolMTU); err != nil {
+		return MTUTraceResponse{}, err
+	}
+	limits, err := s.policy.CheckLimits(PolicyToolMTU,
+		PolicyLimits{MaxHops: req.MaxHops, Queries: req.Queries},
+		PolicyLimits{MaxHops: defaultMaxHops, Queries: defaultQueries})
+	if err != nil {
+		return MTUTraceResponse{}, err
+	}
+	req.MaxHops, req.Queries = limits.MaxHops, limits.Queries
+	// Reject denied names before the GeoIP runtime is brought up.
+	if target, err := normalizeTarget(req.Target); err == nil {
+		if err := s.policy.CheckHost(PolicyToolMTU, target); err != nil {
+			return MTUTraceResponse{}, err
+		}
+	}
+	ctx, cancel := s.policy.WithDeadline(ctx)
+	defer cancel()
 	_, needsLeo := resolveMTUDataProvider(req.DataProvider)
 	return withServiceRuntime(ctx, runtimeOptions{
 		DotServer:  req.DotServer,
@@ -251,6 +325,16 @@ func (s *Service) MTUTrace(ctx context.Context, req MTUTraceRequest) (MTUTraceRe
 }
 
 func (s *Service) SpeedTest(ctx context.Context, req SpeedTestRequest) (SpeedTestResponse, error) {
+	if err := s.policy.CheckTool(PolicyToolSpeed); err != nil {
+		return SpeedTestResponse{}, err
+	}
+	if endpoint := strings.TrimSpace(req.EndpointIP); endpoint != "" {
+		if err := s.policy.CheckHost(PolicyToolSpeed, endpoint); err != nil {
+			return SpeedTestResponse{}, err
+		}
+	}
+	ctx, cancel := s.policy.WithDeadline(ctx)
+	defer cancel()
 	cfg, err := buildSpeedConfig(req)
 	if err != nil {
 		return SpeedTestResponse{}, err
@@ -264,6 +348,9 @@ func (s *Service) SpeedTest(ctx context.Context, req SpeedTestRequest) (SpeedTes
 }
 
 func (s *Service) AnnotateIPs(ctx context.Context, req AnnotateIPsRequest) (AnnotateIPsResponse, error) {
+	if err := s.policy.CheckTool(PolicyToolAnnotate); err != nil {
+		return AnnotateIPsResponse{}, err
+	}
 	if strings.TrimSpace(req.Text) == "" {
 		return AnnotateIPsResponse{}, errors.New("text is required")
 	}
@@ -295,6 +382,9 @@ func (s *Service) AnnotateIPs(ctx context.Context, req AnnotateIPsRequest) (Anno
 }
 
 func (s *Service) GeoLookup(ctx context.Context, req GeoLookupRequest) (GeoLookupResponse, error) {
+	if err := s.policy.CheckTool(PolicyToolGeo); err != nil {
+		return GeoLookupResponse{}, err
+	}
 	query := strings.TrimSpace(req.Query)
 	if query == "" {
 		return GeoLookupResponse{}, errors.New("query is required")
@@ -315,32 +405,53 @@ func (s *Service) GeoLookup(ctx context.Context, req GeoLookupRequest) (GeoLooku
 	})
 }
 
-func (s *Service) prepareTrace(ctx context.Context, req TraceRequest) (*traceSetup, error) {
+func (s *Service) prepareTrace(ctx context.Context, tool string, req TraceRequest) (*traceSetup, error) {
 	if req.IPv4Only && req.IPv6Only {
 		return nil, errors.New("ipv4_only and ipv6_only cannot both be true")
 	}
 	if req.TOS != nil && (*req.TOS < 0 || *req.TOS > 255) {
 		return nil, errors.New("tos must be within range 0-255")
 	}
+	// Only named namespaces: a path such as /proc/PID/ns/net would let a
+	// client enter the namespace of any process on the host.
+	if strings.ContainsRune(req.NetNS, '/') {
+		return nil, errors.New("netns must be a namespace name under /var/run/netns, not a path")
+	}
 
 	target, err := normalizeTarget(req.Target)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.policy.CheckHost(tool, target); err != nil {
+		return nil, err
+	}
+	if err := s.policy.CheckSocket(tool, requestSocketOptions(req)); err != nil {
+		return nil, err
+	}
+	if err := resolveUDPPayload(&req); err != nil {
+		return nil, err
+	}
 	method, protocol, port, err := resolveProtocol(req.Protocol, req.Port)
 	if err != nil {
 		return nil, err
 	}
 	dataProvider, needsLeo := resolveDataProvider(&req)
-	ip, err := util.DomainLookUpWithContext(ctx, target, resolveIPVersion(req), strings.ToLower(req.DotServer), true)
+	ip, err := domainLookUpFn(ctx, target, resolveIPVersion(req), strings.ToLower(req.DotServer), true)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.policy.CheckIP(tool, target, ip); err != nil {
+		return nil, err
+	}
 	cfg, err := buildTraceConfig(req, method, ip, dataProvider, port)
 	if err != nil {
 		return nil, err
 	}
-	cfg, err = trace.NormalizeExplicitSourceConfig(method, cfg)
+	// The source device lives in the namespace the trace will run in, so
+	// resolve it under the request's socket options.
+	cfg, err = withServiceRuntime(ctx, runtimeOptions{Socket: requestSocketOptions(req)}, func() (trace.Config, error) {
+		return trace.NormalizeExplicitSourceConfig(method, cfg)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -371,6 +482,9 @@ func (s *Service) buildMTUConfig(ctx context.Context, req MTUTraceRequest) (mtut
 	if err != nil {
 		return mtutrace.Config{}, err
 	}
+	if err := s.policy.CheckIP(PolicyToolMTU, target, ip); err != nil {
+		return mtutrace.Config{}, err
+	}
 	sourceCfg, err := trace.NormalizeExplicitSourceConfig(trace.UDPTrace, trace.Config{
 		OSType:       resolveOSType(),
 		DstIP:        ip,
@@ -422,6 +536,7 @@ func withTraceRuntime[T any](ctx context.Context, setup *traceSetup, fn func() (
 		DotServer:   setup.Request.DotServer,
 		NeedsLeoWS:  setup.NeedsLeoWS,
 		PowProvider: setup.PowProvider,
+		Socket:      requestSocketOptions(setup.Request),
 	}, fn)
 }
 
@@ -433,26 +548,42 @@ func withServiceRuntime[T any](ctx context.Context, opts runtimeOptions, fn func
 	if fn == nil {
 		return zero, nil
 	}
+	// Request socket options override the --netns/--vrf/--fwmark defaults of
+	// the deploy instance field by field.
+	socket := util.CurrentSocketOptions().Merge(opts.Socket)
+	if err := socket.Validate(); err != nil {
+		return zero, err
+	}
 	prevPowProvider := util.PowProviderParam
 	util.PowProviderParam = opts.PowProvider
 	defer func() {
 		util.PowProviderParam = prevPowProvider
 	}()
 
-	return util.WithGeoDNSResolver(strings.ToLower(strings.TrimSpace(opts.DotServer)), func() (T, error) {
-		if opts.NeedsLeoWS {
-			if ipgeo.NextTraceAPIV4TokenConfigured() {
-				if err := prepareNextTraceAPIV4FastIPFn(ctx, false); err != nil {
+	return util.WithSocketOptions(socket, func() (T, error) {
+		return util.WithGeoDNSResolver(strings.ToLower(strings.TrimSpace(opts.DotServer)), func() (T, error) {
+			if opts.NeedsLeoWS {
+				if ipgeo.NextTraceAPIV4TokenConfigured() {
+					if err := prepareNextTraceAPIV4FastIPFn(ctx, false); err != nil {
+						ensureLeoMoeConnectionFn(ctx)
+					}
+				} else {
 					ensureLeoMoeConnectionFn(ctx)
 				}
-			} else {
-				ensureLeoMoeConnectionFn(ctx)
 			}
-		}
-		return fn()
+			return fn()
+		})
 	})
 }
 
+func requestSocketOptions(req TraceRequest) util.SocketOptions {
+	return util.SocketOptions{
+		NetNS:  strings.TrimSpace(req.NetNS),
+		VRF:    strings.TrimSpace(req.VRF),
+		FwMark: req.FwMark,
+	}
+}
+
 func withTraceRuntimeNoResult(ctx context.Context, setup *traceSetup, fn func() error) error {
 	_, err := withTraceRuntime(ctx, setup, func() (struct{}, error) {
 		if fn == nil {
@@ -492,11 +623,41 @@ func resolveProtocol(raw string, port int) (trace.Method, string, int, error) {
 			port = 33494
 		}
 		return trace.UDPTrace, protocol, port, nil
+	case "sctp":
+		if port <= 0 {
+			port = 80
+		}
+		return trace.SCTPTrace, protocol, port, nil
 	default:
 		return "", "", 0, fmt.Errorf("unsupported protocol %q", protocol)
 	}
 }
 
+// resolveUDPPayload normalizes udp_payload. A protocol payload switches the
+// trace to UDP and, without a port, to the protocol's well-known port.
+func resolveUDPPayload(req *TraceRequest) error {
+	profile, err := trace.ParseUDPPayloadProfile(req.UDPPayload)
+	if err != nil {
+		return err
+	}
+	req.UDPPayload = string(profile)
+	if profile == trace.UDPPayloadRandom {
+		return nil
+	}
+	protocol := strings.ToLower(strings.TrimSpace(req.Protocol))
+	if protocol != "" && protocol != "udp" {
+		return fmt.Errorf("udp_payload %q requires protocol udp", profile)
+	}
+	if req.PacketSize != nil {
+		return errors.New("udp_payload cannot be combined with packet_size")
+	}
+	req.Protocol = "udp"
+	if req.Port <= 0 {
+		req.Port = profile.DefaultPort()
+	}
+	return nil
+}
+
 func resolveDataProvider(req *TraceRequest) (string, bool) {
 	provider := normalizeDataProvider(req.DataProvider, "")
 	if provider == "" {
@@ -540,6 +701,10 @@ func buildTraceConfig(req TraceRequest, method trace.Method, ip net.IP, provider
 	if req.PacketSize != nil {
 		packetSize = *req.PacketSize
 	}
+	udpPayload := trace.UDPPayloadProfile(req.UDPPayload)
+	if size, ok := trace.UDPPayloadPacketSize(udpPayload, ip, port); ok && method == trace.UDPTrace {
+		packetSize = size
+	}
 	packetSizeSpec, err := trace.NormalizePacketSize(method, ip, packetSize)
 	if err != nil {
 		return trace.Config{}, err
@@ -574,6 +739,7 @@ func buildTraceConfig(req TraceRequest, method trace.Method, ip net.IP, provider
 		TOS:              tos,
 		Maptrace:         !req.DisableMaptrace,
 		DisableMPLS:      req.DisableMPLS,
+		UDPPayload:       udpPayload,
 	}, nil
 }
 
@@ -615,8 +781,11 @@ func convertTraceHops(res *trace.Result, lang string) []Hop {
 		resp := Hop{TTL: idx + 1, Attempts: make([]Attempt, 0, len(attempts))}
 		for _, hop := range attempts {
 			attempt := Attempt{
-				Success: hop.Success,
-				MPLS:    hop.MPLS,
+				Success:    hop.Success,
+				MPLS:       hop.MPLS,
+				ReplyTTL:   hop.ReplyTTL,
+				ReturnHops: hop.ReturnHops,
+				Asymmetric: hop.Asymmetric,
 			}
 			if hop.Address != nil {
 				attempt.IP = hop.Address.String()
@@ -895,7 +1064,7 @@ func sanitizeMTUHops(hops []mtutrace.Hop, lang string) []mtutrace.Hop {
 }
 
 func traceSupportedParams() []string {
-	return []string{"target", "protocol", "port", "queries", "max_hops", "timeout_ms", "packet_size", "tos", "parallel_requests", "begin_hop", "ipv4_only", "ipv6_only", "data_provider", "pow_provider", "dot_server", "disable_rdns", "always_rdns", "disable_maptrace", "disable_mpls", "language", "dn42", "source_address", "source_port", "source_device", "icmp_mode", "packet_interval", "ttl_interval", "max_attempts"}
+	return []string{"target", "protocol", "port", "queries", "max_hops", "timeout_ms", "packet_size", "tos", "parallel_requests", "begin_hop", "ipv4_only", "ipv6_only", "data_provider", "pow_provider", "dot_server", "disable_rdns", "always_rdns", "disable_maptrace", "disable_mpls", "language", "dn42", "source_address", "source_port", "source_device", "icmp_mode", "packet_interval", "ttl_interval", "max_attempts", "netns", "vrf", "fwmark"}
 }
 
 func traceParameterBoundaries() ParameterBoundaries {
@@ -0,0 +1,53 @@
+//go:build linux
+
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestPrepareTraceResolvesSourceDeviceInRequestNetNS(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating a network namespace requires root")
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip command not available")
+	}
+	const ns = "nexttrace-svc-test"
+	run := func(args ...string) {
+		t.Helper()
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			t.Skipf("ip %v: %v: %s", args, err, out)
+		}
+	}
+	run("netns", "add", ns)
+	t.Cleanup(func() { _ = exec.Command("ip", "netns", "del", ns).Run() })
+	// lo exists in every namespace; only the request namespace gives it a
+	// public address, which the source lookup prefers over 127.0.0.1.
+	run("-n", ns, "link", "set", "lo", "up")
+	run("-n", ns, "addr", "add", "198.51.100.7/32", "dev", "lo")
+
+	defer stubServiceRuntimeForTests(t)()
+	domainLookUpFn = func(context.Context, string, string, string, bool) (net.IP, error) {
+		return net.ParseIP("192.0.2.1"), nil
+	}
+	p, err := NewPolicy(PolicyConfig{AllowNetNS: []string{ns}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	setup, err := NewWithPolicy(p).prepareTrace(context.Background(), PolicyToolTrace, TraceRequest{
+		Target:       "192.0.2.1",
+		SourceDevice: "lo",
+		NetNS:        ns,
+	})
+	if err != nil {
+		t.Fatalf("prepareTrace: %v", err)
+	}
+	if setup.Config.SrcAddr != "198.51.100.7" {
+		t.Fatalf("SrcAddr = %q, want the lo address of netns %s", setup.Config.SrcAddr, ns)
+	}
+}
@@ -3,7 +3,10 @@ package service
 import (
 	"context"
 	"errors"
+	"net"
+	"runtime"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -336,6 +339,7 @@ func stubServiceRuntimeForTests(t *testing.T) func() {
 	oldRunMTR := runMTRFn
 	oldRunMTRRaw := runMTRRawFn
 	oldRunMTU := runMTUTraceFn
+	oldDomainLookUp := domainLookUpFn
 	oldEnvDataProvider := util.EnvDataProvider
 	tokenDir := t.TempDir()
 	t.Setenv(util.EnvNextTraceAPIV4TokenKey, "")
@@ -352,6 +356,143 @@ func stubServiceRuntimeForTests(t *testing.T) func() {
 		runMTRFn = oldRunMTR
 		runMTRRawFn = oldRunMTRRaw
 		runMTUTraceFn = oldRunMTU
+		domainLookUpFn = oldDomainLookUp
 		util.EnvDataProvider = oldEnvDataProvider
 	}
 }
+
+func TestResolveProtocolSCTP(t *testing.T) {
+	method, protocol, port, err := resolveProtocol(" SCTP ", 0)
+	if err != nil || method != trace.SCTPTrace || protocol != "sctp" || port != 80 {
+		t.Fatalf("resolveProtocol(sctp) = %q %q %d %v", method, protocol, port, err)
+	}
+	if _, _, port, _ := resolveProtocol("sctp", 5060); port != 5060 {
+		t.Fatalf("explicit port = %d, want 5060", port)
+	}
+}
+
+func TestResolveUDPPayload(t *testing.T) {
+	req := TraceRequest{UDPPayload: "DNS"}
+	if err := resolveUDPPayload(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.UDPPayload != "dns" || req.Protocol != "udp" || req.Port != 53 {
+		t.Fatalf("req = %+v", req)
+	}
+
+	req = TraceRequest{UDPPayload: "auto", Port: 443}
+	if err := resolveUDPPayload(&req); err != nil || req.Port != 443 {
+		t.Fatalf("auto: port=%d err=%v", req.Port, err)
+	}
+	cfg, err := buildTraceConfig(req, trace.UDPTrace, net.ParseIP("192.0.2.1"), "disable-geoip", req.Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UDPPayload != trace.UDPPayloadAuto || cfg.PktSize != 1200 {
+		t.Fatalf("cfg payload=%q size=%d", cfg.UDPPayload, cfg.PktSize)
+	}
+
+	size := 64
+	for name, req := range map[string]TraceRequest{
+		"tcp":         {UDPPayload: "dns", Protocol: "tcp"},
+		"packet_size": {UDPPayload: "ntp", PacketSize: &size},
+		"unknown":     {UDPPayload: "http"},
+	} {
+		if err := resolveUDPPayload(&req); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestDualStackMTRComparesFamilies(t *testing.T) {
+	restore := stubServiceRuntimeForTests(t)
+	defer restore()
+
+	domainLookUpFn = func(_ context.Context, _ string, ipVersion string, _ string, _ bool) (net.IP, error) {
+		if ipVersion == "6" {
+			return net.ParseIP("2001:db8::1"), nil
+		}
+		return net.ParseIP("192.0.2.1"), nil
+	}
+	runMTRFn = func(_ context.Context, _ trace.Method, cfg trace.Config, _ trace.MTROptions, onUpdate trace.MTROnSnapshot) error {
+		if cfg.DstIP.To4() != nil {
+			onUpdate(1, []trace.MTRHopStat{
+				{TTL: 1, IP: "198.51.100.1", Received: 3, Geo: &ipgeo.IPGeoData{Asnumber: "64500"}},
+				{TTL: 2, IP: "192.0.2.1", Received: 3, Avg: 10, Geo: &ipgeo.IPGeoData{Asnumber: "64501"}},
+			})
+			return nil
+		}
+		onUpdate(1, []trace.MTRHopStat{
+			{TTL: 1, IP: "2001:db8:100::1", Received: 3, Geo: &ipgeo.IPGeoData{Asnumber: "64500"}},
+			{TTL: 2, IP: "2001:db8:200::1", Received: 3, Geo: &ipgeo.IPGeoData{Asnumber: "64502"}},
+			{TTL: 3, IP: "2001:db8::1", Received: 2, Snt: 3, Loss: 33.3, Avg: 30, Geo: &ipgeo.IPGeoData{Asnumber: "64501"}},
+		})
+		return nil
+	}
+
+	resp, err := New().DualStack(context.Background(), DualStackRequest{
+		TraceRequest: TraceRequest{Target: "dual.example", DataProvider: "disable-geoip"},
+		MTR:          true,
+	})
+	if err != nil {
+		t.Fatalf("DualStack returned error: %v", err)
+	}
+	if resp.Mode != "mtr" || resp.IPv4.ResolvedIP != "192.0.2.1" || resp.IPv6.ResolvedIP != "2001:db8::1" {
+		t.Fatalf("DualStack response = %+v", resp)
+	}
+	if !resp.IPv4.Reached || resp.IPv4.HopCount != 2 || !resp.IPv6.Reached || resp.IPv6.HopCount != 3 || resp.IPv6.LossPercent != 33.3 {
+		t.Fatalf("DualStack families = %+v / %+v", resp.IPv4, resp.IPv6)
+	}
+	if d := resp.Diverge; d == nil || d.AfterASN != "64500" || d.IPv4ASN != "64501" || d.IPv6ASN != "64502" || d.IPv6TTL != 2 {
+		t.Fatalf("Diverge = %+v", resp.Diverge)
+	}
+	if len(resp.Verdict) == 0 || !strings.HasPrefix(resp.Verdict[0], "IPv6 is 20.00 ms slower than IPv4") {
+		t.Fatalf("Verdict = %q", resp.Verdict)
+	}
+
+	if _, err := New().DualStack(context.Background(), DualStackRequest{TraceRequest: TraceRequest{Target: "dual.example", IPv6Only: true}}); err == nil {
+		t.Fatal("DualStack accepted ipv6_only")
+	}
+}
+
+func TestMTRReportAppliesRequestSocketOptions(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("netns, VRF and fwmark are Linux-only")
+	}
+	restore := stubServiceRuntimeForTests(t)
+	defer restore()
+	deployDefault := util.SocketOptions{VRF: "lo", FwMark: 7}
+	util.SetSocketOptions(deployDefault)
+	defer util.SetSocketOptions(util.SocketOptions{})
+
+	var got util.SocketOptions
+	runMTRFn = func(context.Context, trace.Method, trace.Config, trace.MTROptions, trace.MTROnSnapshot) error {
+		got = util.CurrentSocketOptions()
+		return nil
+	}
+	req := MTRReportRequest{
+		TraceRequest: TraceRequest{Target: "192.0.2.1", DataProvider: "disable-geoip", FwMark: 0x20},
+	}
+	_, err := New().MTRReport(context.Background(), req)
+	requirePolicyCode(t, err, PolicyCodeSocketNotAllowed)
+	p, err := NewPolicy(PolicyConfig{AllowFwMarks: []string{"0x20"}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	if _, err := NewWithPolicy(p).MTRReport(context.Background(), req); err != nil {
+		t.Fatalf("MTRReport returned error: %v", err)
+	}
+	if want := (util.SocketOptions{VRF: "lo", FwMark: 0x20}); got != want {
+		t.Fatalf("socket options during run = %+v, want %+v", got, want)
+	}
+	if cur := util.CurrentSocketOptions(); cur != deployDefault {
+		t.Fatalf("socket options after run = %+v, want deploy default restored", cur)
+	}
+
+	_, err = New().MTRReport(context.Background(), MTRReportRequest{
+		TraceRequest: TraceRequest{Target: "192.0.2.1", DataProvider: "disable-geoip", NetNS: "/proc/1/ns/net"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "netns must be a namespace name") {
+		t.Fatalf("netns path error = %v", err)
+	}
+}
@@ -25,6 +25,10 @@ type Attempt struct {
 	Error    string           `json:"error,omitempty"`
 	MPLS     []string         `json:"mpls,omitempty"`
 	Geo      *ipgeo.IPGeoData `json:"geo,omitempty"`
+
+	ReplyTTL   int  `json:"reply_ttl,omitempty"`
+	ReturnHops int  `json:"return_hops,omitempty"`
+	Asymmetric bool `json:"asymmetric,omitempty"`
 }
 
 type Hop struct {
@@ -34,8 +38,8 @@ type Hop struct {
 
 type TraceRequest struct {
 	Target           string `json:"target" jsonschema:"Target domain, IP, or URL host to trace"`
-	Protocol         string `json:"protocol,omitempty" jsonschema:"Probe protocol: icmp, tcp, or udp"`
-	Port             int    `json:"port,omitempty" jsonschema:"Destination port for TCP/UDP probes"`
+	Protocol         string `json:"protocol,omitempty" jsonschema:"Probe protocol: icmp, tcp, udp, or sctp"`
+	Port             int    `json:"port,omitempty" jsonschema:"Destination port for TCP/UDP/SCTP probes"`
 	Queries          int    `json:"queries,omitempty" jsonschema:"Probe samples per hop"`
 	MaxHops          int    `json:"max_hops,omitempty" jsonschema:"Maximum TTL/hop count"`
 	TimeoutMs        int    `json:"timeout_ms,omitempty" jsonschema:"Per-probe timeout in milliseconds"`
@@ -61,6 +65,10 @@ type TraceRequest struct {
 	PacketInterval   int    `json:"packet_interval,omitempty" jsonschema:"Per-packet interval in milliseconds"`
 	TTLInterval      int    `json:"ttl_interval,omitempty" jsonschema:"TTL group interval in milliseconds"`
 	MaxAttempts      int    `json:"max_attempts,omitempty" jsonschema:"Hard cap on probe attempts per hop"`
+	UDPPayload       string `json:"udp_payload,omitempty" jsonschema:"UDP probe payload: random, auto, dns, quic, ntp or stun; implies protocol udp"`
+	NetNS            string `json:"netns,omitempty" jsonschema:"Linux network namespace name under /var/run/netns to open probe sockets in; must be listed in the deploy policy allow_netns"`
+	VRF              string `json:"vrf,omitempty" jsonschema:"Linux VRF device to bind probe sockets to; must be listed in the deploy policy allow_vrfs"`
+	FwMark           uint32 `json:"fwmark,omitempty" jsonschema:"Linux firewall mark (SO_MARK) set on probe sockets; must be listed in the deploy policy allow_fwmarks"`
 }
 
 type TraceResponse struct {
@@ -106,6 +114,39 @@ type MTRRawResponse struct {
 	Parameters ParameterBoundaries  `json:"parameters"`
 }
 
+type DualStackRequest struct {
+	TraceRequest
+	MTR           bool `json:"mtr,omitempty" jsonschema:"Run bounded MTR reports instead of single traceroutes"`
+	HopIntervalMs int  `json:"hop_interval_ms,omitempty" jsonschema:"Per-hop probe interval in milliseconds when mtr is set"`
+	MaxPerHop     int  `json:"max_per_hop,omitempty" jsonschema:"Maximum probes per TTL when mtr is set"`
+}
+
+// DualStackFamily summarizes the path of one address family. Hops is set for
+// traceroutes and Stats for MTR reports.
+type DualStackFamily struct {
+	ResolvedIP  string             `json:"resolved_ip"`
+	Reached     bool               `json:"reached"`
+	HopCount    int                `json:"hop_count"`
+	RTTMs       float64            `json:"rtt_ms,omitempty"`
+	LossPercent float64            `json:"loss_percent"`
+	ASPath      []string           `json:"as_path,omitempty"`
+	Hops        []Hop              `json:"hops,omitempty"`
+	Stats       []trace.MTRHopStat `json:"stats,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+type DualStackResponse struct {
+	Target     string                  `json:"target"`
+	Protocol   string                  `json:"protocol"`
+	Mode       string                  `json:"mode"`
+	IPv4       DualStackFamily         `json:"ipv4"`
+	IPv6       DualStackFamily         `json:"ipv6"`
+	Diverge    *trace.DualStackDiverge `json:"diverge,omitempty"`
+	Verdict    []string                `json:"verdict"`
+	DurationMs int64                   `json:"duration_ms"`
+	Parameters ParameterBoundaries     `json:"parameters"`
+}
+
 type MTUTraceRequest struct {
 	Target        string `json:"target" jsonschema:"Target domain or IP"`
 	Port          int    `json:"port,omitempty" jsonschema:"Destination UDP port"`
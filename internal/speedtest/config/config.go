@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/nxtrace/NTrace-core/internal/speedtest"
+	"github.com/nxtrace/NTrace-core/util"
 )
 
 const (
@@ -49,6 +50,9 @@ type Config struct {
 	DotServer      string
 	SourceAddress  string
 	SourceDevice   string
+	NetNS          string
+	VRF            string
+	FwMark         uint32
 }
 
 func Usage() string {
@@ -71,6 +75,9 @@ Options:
   --dot-server NAME             DoT server for endpoint discovery [dnssb, aliyun, dnspod, google, cloudflare]
   -s, --source IP               Use source address for outgoing HTTP connections
   -D, --dev NAME                Resolve the source address from the specified device
+  --netns NAME|PATH             (Linux) Open HTTP connections inside this network namespace
+  --vrf NAME                    (Linux) Bind HTTP connections to this VRF device
+  --fwmark N                    (Linux) Set this firewall mark on HTTP connections
 
 Examples:
   nexttrace --speed
@@ -94,6 +101,7 @@ func Load(args ...string) (*Config, error) {
 	}
 
 	help := false
+	fwmark := ""
 	fs.BoolVar(&help, "h", false, "show help")
 	fs.BoolVar(&help, "help", false, "show help")
 	fs.StringVar(&cfg.Provider, "speed-provider", cfg.Provider, "speed provider")
@@ -114,6 +122,9 @@ func Load(args ...string) (*Config, error) {
 	fs.StringVar(&cfg.SourceAddress, "s", "", "source address")
 	fs.StringVar(&cfg.SourceDevice, "dev", "", "source device")
 	fs.StringVar(&cfg.SourceDevice, "D", "", "source device")
+	fs.StringVar(&cfg.NetNS, "netns", "", "network namespace")
+	fs.StringVar(&cfg.VRF, "vrf", "", "VRF device")
+	fs.StringVar(&fwmark, "fwmark", "", "firewall mark")
 
 	if err := fs.Parse(cleaned); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -133,6 +144,8 @@ func Load(args ...string) (*Config, error) {
 	cfg.DotServer = strings.ToLower(strings.TrimSpace(cfg.DotServer))
 	cfg.SourceAddress = strings.TrimSpace(cfg.SourceAddress)
 	cfg.SourceDevice = strings.TrimSpace(cfg.SourceDevice)
+	cfg.NetNS = strings.TrimSpace(cfg.NetNS)
+	cfg.VRF = strings.TrimSpace(cfg.VRF)
 
 	switch cfg.Provider {
 	case "apple", "cloudflare":
@@ -169,6 +182,11 @@ func Load(args ...string) (*Config, error) {
 	if cfg.SourceAddress != "" && net.ParseIP(cfg.SourceAddress) == nil {
 		return nil, fmt.Errorf("invalid source IP %q", cfg.SourceAddress)
 	}
+	mark, err := util.ParseFwMark(fwmark)
+	if err != nil {
+		return nil, err
+	}
+	cfg.FwMark = mark
 	maxBytes, err := ParseSize(cfg.Max)
 	if err != nil {
 		return nil, fmt.Errorf("invalid --max %q: %w", cfg.Max, err)
@@ -181,6 +199,14 @@ func Load(args ...string) (*Config, error) {
 	return cfg, nil
 }
 
+// SocketOptions returns the network context HTTP connections are opened in.
+func (c *Config) SocketOptions() util.SocketOptions {
+	if c == nil {
+		return util.SocketOptions{}
+	}
+	return util.SocketOptions{NetNS: c.NetNS, VRF: c.VRF, FwMark: c.FwMark}
+}
+
 func (c *Config) Summary() string {
 	if c == nil {
 		return ""
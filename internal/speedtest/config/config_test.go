@@ -103,6 +103,19 @@ func TestLoadParsesSourceDevice(t *testing.T) {
 	}
 }
 
+func TestLoadParsesSocketOptions(t *testing.T) {
+	cfg, err := Load("--speed", "--netns", "blue", "--vrf", "vrf-blue", "--fwmark", "0x10")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.SocketOptions(); got.NetNS != "blue" || got.VRF != "vrf-blue" || got.FwMark != 16 {
+		t.Fatalf("SocketOptions() = %+v", got)
+	}
+	if _, err := Load("--speed", "--fwmark", "mark"); err == nil || !strings.Contains(err.Error(), "invalid fwmark") {
+		t.Fatalf("Load() error = %v, want invalid fwmark", err)
+	}
+}
+
 func TestLoadRejectsSourceAndDeviceTogether(t *testing.T) {
 	_, err := Load("--speed", "--source", "192.0.2.10", "--dev", "eth0")
 	if err == nil || !strings.Contains(err.Error(), "--source and --dev") {
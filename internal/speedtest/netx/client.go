@@ -25,7 +25,7 @@ type Options struct {
 var (
 	resolveAllIPsFn = resolveAllIPs
 	dialContextFn   = func(d *net.Dialer, ctx context.Context, network, addr string) (net.Conn, error) {
-		return d.DialContext(ctx, network, addr)
+		return util.DialContext(ctx, d, network, addr)
 	}
 	rootCAMu     sync.RWMutex
 	extraRootCAs *x509.CertPool
@@ -0,0 +1,284 @@
+// Package topology merges traceroute results into one router-level graph and
+// writes it as Graphviz DOT, Mermaid or GraphML.
+package topology
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// Format names an output format.
+type Format string
+
+const (
+	FormatDOT     Format = "dot"
+	FormatMermaid Format = "mermaid"
+	FormatGraphML Format = "graphml"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatDOT, FormatMermaid, FormatGraphML}
+
+// FormatForPath picks the format from a file extension.
+func FormatForPath(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dot", ".gv":
+		return FormatDOT, true
+	case ".mmd", ".mermaid":
+		return FormatMermaid, true
+	case ".graphml":
+		return FormatGraphML, true
+	}
+	return "", false
+}
+
+// sourceID is the node every trace starts from.
+const sourceID = "src"
+
+// Node is one responding address, the probing host, or a run of TTLs that
+// did not answer.
+type Node struct {
+	ID       string
+	IP       string
+	Hostname string
+	ASN      string
+	Owner    string
+	Location string
+	// Source marks the probing host; Target marks a traced destination.
+	Source bool
+	Target bool
+	// Gap nodes stand for consecutive silent TTLs between the same
+	// neighbours; Hops is the longest such run seen.
+	Gap  bool
+	Hops int
+	// Traces counts the results that pass through the node.
+	Traces int
+}
+
+// Edge links nodes seen at consecutive answering TTLs.
+type Edge struct {
+	From   string
+	To     string
+	Traces int
+}
+
+// Cluster groups the nodes of one ASN.
+type Cluster struct {
+	ASN   string
+	Owner string
+	Nodes []*Node
+}
+
+// Graph is the merged topology.
+type Graph struct {
+	Nodes  []*Node
+	Edges  []*Edge
+	Traces int
+
+	lang  string
+	nodes map[string]*Node
+	edges map[[2]string]*Edge
+}
+
+// New returns an empty graph; lang selects the language of locations.
+func New(lang string) *Graph {
+	g := &Graph{lang: lang, nodes: map[string]*Node{}, edges: map[[2]string]*Edge{}}
+	g.Nodes = append(g.Nodes, &Node{ID: sourceID, Source: true})
+	g.nodes[sourceID] = g.Nodes[0]
+	return g
+}
+
+// Add merges res, a trace towards dst, into the graph. Several addresses
+// answering at one TTL become parallel nodes.
+func (g *Graph) Add(res *trace.Result, dst string) {
+	if res == nil {
+		return
+	}
+	g.Traces++
+	g.nodes[sourceID].Traces++
+	seen := map[string]bool{sourceID: true}
+	touchNode := func(n *Node) {
+		if !seen[n.ID] {
+			seen[n.ID] = true
+			n.Traces++
+		}
+	}
+	touchEdge := func(from, to string) {
+		key := [2]string{from, to}
+		e, ok := g.edges[key]
+		if !ok {
+			e = &Edge{From: from, To: to}
+			g.edges[key] = e
+			g.Edges = append(g.Edges, e)
+		}
+		if !seen["edge:"+from+">"+to] {
+			seen["edge:"+from+">"+to] = true
+			e.Traces++
+		}
+	}
+
+	prev := []string{sourceID}
+	silent := 0
+	for _, hops := range res.Hops {
+		var ids []string
+		for i := range hops {
+			h := &hops[i]
+			ip := util.AddrIP(h.Address)
+			if !h.Success || ip == nil {
+				continue
+			}
+			n := g.hopNode(ip.String(), h)
+			if n.IP == dst {
+				n.Target = true
+			}
+			if !util.StringInSlice(n.ID, ids) {
+				ids = append(ids, n.ID)
+				touchNode(n)
+			}
+		}
+		if len(ids) == 0 {
+			silent++
+			continue
+		}
+		from := prev
+		if silent > 0 {
+			gap := g.gapNode(prev, strings.Join(ids, ","), silent)
+			touchNode(gap)
+			for _, p := range prev {
+				touchEdge(p, gap.ID)
+			}
+			from = []string{gap.ID}
+		}
+		for _, p := range from {
+			for _, id := range ids {
+				touchEdge(p, id)
+			}
+		}
+		prev, silent = ids, 0
+	}
+	if silent > 0 {
+		gap := g.gapNode(prev, "end", silent)
+		touchNode(gap)
+		for _, p := range prev {
+			touchEdge(p, gap.ID)
+		}
+	}
+}
+
+func (g *Graph) hopNode(ip string, h *trace.Hop) *Node {
+	n, ok := g.nodes[ip]
+	if !ok {
+		n = &Node{ID: fmt.Sprintf("n%d", len(g.Nodes)), IP: ip}
+		g.nodes[ip] = n
+		g.Nodes = append(g.Nodes, n)
+	}
+	if n.Hostname == "" {
+		n.Hostname = h.Hostname
+	}
+	if n.ASN == "" && h.Geo != nil && h.Geo.Source != trace.PendingGeoSource {
+		n.ASN = trace.PathHopASN(h)
+		n.Owner = geoOwner(h.Geo)
+		n.Location = geoLocation(h.Geo, g.lang)
+	}
+	return n
+}
+
+// gapNode returns the node for silent TTLs between prev and next, so the
+// same gap seen by several traces is drawn once.
+func (g *Graph) gapNode(prev []string, next string, hops int) *Node {
+	key := "gap:" + strings.Join(prev, ",") + ">" + next
+	n, ok := g.nodes[key]
+	if !ok {
+		n = &Node{ID: fmt.Sprintf("n%d", len(g.Nodes)), Gap: true}
+		g.nodes[key] = n
+		g.Nodes = append(g.Nodes, n)
+	}
+	n.Hops = max(n.Hops, hops)
+	return n
+}
+
+// Clusters groups nodes with a known ASN, in order of first appearance.
+func (g *Graph) Clusters() []Cluster {
+	var out []Cluster
+	index := map[string]int{}
+	for _, n := range g.Nodes {
+		if n.ASN == "" {
+			continue
+		}
+		i, ok := index[n.ASN]
+		if !ok {
+			i = len(out)
+			index[n.ASN] = i
+			out = append(out, Cluster{ASN: n.ASN, Owner: n.Owner})
+		}
+		out[i].Nodes = append(out[i].Nodes, n)
+	}
+	return out
+}
+
+// Write writes g in format.
+func Write(w io.Writer, format Format, g *Graph) error {
+	switch format {
+	case FormatDOT:
+		return WriteDOT(w, g)
+	case FormatMermaid:
+		return WriteMermaid(w, g)
+	case FormatGraphML:
+		return WriteGraphML(w, g)
+	}
+	return fmt.Errorf("unsupported topology format %q", format)
+}
+
+// labelLines is the text shown for a node, one entry per line.
+func labelLines(n *Node) []string {
+	switch {
+	case n.Source:
+		return []string{"source"}
+	case n.Gap && n.Hops > 1:
+		return []string{fmt.Sprintf("* × %d", n.Hops)}
+	case n.Gap:
+		return []string{"*"}
+	}
+	lines := []string{n.IP}
+	if n.Hostname != "" {
+		lines = append(lines, n.Hostname)
+	}
+	if n.Location != "" {
+		lines = append(lines, n.Location)
+	}
+	return lines
+}
+
+func clusterLabel(c Cluster) string {
+	if c.Owner == "" {
+		return "AS" + c.ASN
+	}
+	return "AS" + c.ASN + " " + c.Owner
+}
+
+func geoOwner(g *ipgeo.IPGeoData) string {
+	if g.Owner != "" {
+		return g.Owner
+	}
+	return g.Isp
+}
+
+func geoLocation(g *ipgeo.IPGeoData, lang string) string {
+	var parts []string
+	for _, f := range [][2]string{{g.Country, g.CountryEn}, {g.Prov, g.ProvEn}, {g.City, g.CityEn}} {
+		v := f[0]
+		if lang == "en" && f[1] != "" || v == "" {
+			v = f[1]
+		}
+		if v != "" && !util.StringInSlice(v, parts) {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,164 @@
+package topology
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func hop(ttl int, ip, asn string) trace.Hop {
+	if ip == "" {
+		return trace.Hop{TTL: ttl}
+	}
+	h := trace.Hop{Success: true, TTL: ttl, Address: &net.IPAddr{IP: net.ParseIP(ip)}}
+	if asn != "" {
+		h.Geo = &ipgeo.IPGeoData{Asnumber: asn, Owner: "Owner " + asn, Country: "美国", CountryEn: "United States"}
+	}
+	return h
+}
+
+func result(rows ...[]trace.Hop) *trace.Result {
+	return &trace.Result{Hops: rows}
+}
+
+func batchGraph() *Graph {
+	g := New("en")
+	g.Add(result(
+		[]trace.Hop{hop(1, "192.168.1.1", "")},
+		[]trace.Hop{hop(2, "", ""), hop(2, "", "")},
+		[]trace.Hop{hop(3, "", "")},
+		[]trace.Hop{hop(4, "203.0.113.1", "64500")},
+		[]trace.Hop{hop(5, "1.1.1.1", "13335")},
+	), "1.1.1.1")
+	g.Add(result(
+		[]trace.Hop{hop(1, "192.168.1.1", "")},
+		[]trace.Hop{hop(2, "", "")},
+		[]trace.Hop{hop(3, "203.0.113.1", "64500"), hop(3, "203.0.113.2", "64500")},
+		[]trace.Hop{hop(4, "8.8.8.8", "15169")},
+		[]trace.Hop{hop(5, "", "")},
+	), "8.8.4.4")
+	return g
+}
+
+func TestGraphMergesTraces(t *testing.T) {
+	g := batchGraph()
+	if g.Traces != 2 {
+		t.Fatalf("traces = %d", g.Traces)
+	}
+	byIP := map[string]*Node{}
+	var gaps []*Node
+	for _, n := range g.Nodes {
+		if n.Gap {
+			gaps = append(gaps, n)
+		} else if n.IP != "" {
+			byIP[n.IP] = n
+		}
+	}
+	if len(byIP) != 5 {
+		t.Fatalf("hop nodes = %d, want 5", len(byIP))
+	}
+	if byIP["192.168.1.1"].Traces != 2 || byIP["203.0.113.1"].Traces != 2 || !byIP["1.1.1.1"].Target || byIP["8.8.8.8"].Target {
+		t.Fatalf("nodes = %+v", byIP)
+	}
+	// Both traces are silent between the gateway and 203.0.113.1, the
+	// second one also towards 203.0.113.2 and after 8.8.8.8.
+	if len(gaps) != 3 || gaps[0].Hops != 2 || gaps[0].Traces != 1 {
+		t.Fatalf("gaps = %+v", gaps)
+	}
+	if got := byIP["1.1.1.1"].Location; got != "United States" {
+		t.Fatalf("location = %q", got)
+	}
+	clusters := g.Clusters()
+	if len(clusters) != 3 || clusters[0].ASN != "64500" || len(clusters[0].Nodes) != 2 {
+		t.Fatalf("clusters = %+v", clusters)
+	}
+	if g.Edges[0].From != sourceID || g.Edges[0].Traces != 2 {
+		t.Fatalf("first edge = %+v", g.Edges[0])
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatDOT, batchGraph()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"digraph nexttrace {\n",
+		"subgraph cluster_0 {\n\t\tlabel=\"AS64500 Owner 64500\";",
+		`[label="1.1.1.1\nUnited States", peripheries=2];`,
+		`[label="* × 2", shape=plaintext];`,
+		"src -> n1 [label=\"2\"];",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatMermaid, batchGraph()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"flowchart LR\n",
+		"    subgraph as0[\"AS64500 Owner 64500\"]\n",
+		"    src([\"source\"])\n",
+		"    src -->|2| n1\n",
+		" target\n",
+		" gap\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatGraphML, batchGraph()); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Graph struct {
+			Nodes []struct {
+				ID   string `xml:"id,attr"`
+				Data []struct {
+					Key   string `xml:"key,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"data"`
+			} `xml:"node"`
+			Edges []struct {
+				Source string `xml:"source,attr"`
+			} `xml:"edge"`
+		} `xml:"graph"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	g := batchGraph()
+	if len(doc.Graph.Nodes) != len(g.Nodes) || len(doc.Graph.Edges) != len(g.Edges) {
+		t.Fatalf("nodes/edges = %d/%d", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	if !strings.Contains(buf.String(), `<data key="asn">13335</data>`) {
+		t.Fatalf("asn attribute missing:\n%s", buf.String())
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	for path, want := range map[string]Format{"a.gv": FormatDOT, "b.MMD": FormatMermaid, "c.graphml": FormatGraphML} {
+		if got, ok := FormatForPath(path); !ok || got != want {
+			t.Errorf("FormatForPath(%q) = %q, %v", path, got, ok)
+		}
+	}
+	if _, ok := FormatForPath("d.txt"); ok {
+		t.Error("d.txt accepted")
+	}
+}
@@ -0,0 +1,197 @@
+package topology
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteDOT writes g for Graphviz, one cluster subgraph per ASN. Edges used
+// by more than one trace are labelled with the count.
+func WriteDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph nexttrace {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, style=rounded, fontname=\"Helvetica\"];\n")
+	clustered := map[string]bool{}
+	for i, c := range g.Clusters() {
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(&b, "\t\tlabel=%s;\n\t\tstyle=dashed;\n", dotQuote(clusterLabel(c)))
+		for _, n := range c.Nodes {
+			b.WriteString("\t\t" + dotNode(n) + "\n")
+			clustered[n.ID] = true
+		}
+		b.WriteString("\t}\n")
+	}
+	for _, n := range g.Nodes {
+		if !clustered[n.ID] {
+			b.WriteString("\t" + dotNode(n) + "\n")
+		}
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s", e.From, e.To)
+		if e.Traces > 1 {
+			fmt.Fprintf(&b, " [label=\"%d\"]", e.Traces)
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotNode(n *Node) string {
+	attrs := []string{"label=" + dotQuote(strings.Join(labelLines(n), "\n"))}
+	switch {
+	case n.Source:
+		attrs = append(attrs, "shape=oval")
+	case n.Gap:
+		attrs = append(attrs, "shape=plaintext")
+	case n.Target:
+		attrs = append(attrs, "peripheries=2")
+	}
+	return n.ID + " [" + strings.Join(attrs, ", ") + "];"
+}
+
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+// WriteMermaid writes g as a Mermaid flowchart, one subgraph per ASN.
+func WriteMermaid(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	clustered := map[string]bool{}
+	for i, c := range g.Clusters() {
+		fmt.Fprintf(&b, "    subgraph as%d[%s]\n", i, mermaidQuote(clusterLabel(c)))
+		for _, n := range c.Nodes {
+			b.WriteString("        " + mermaidNode(n) + "\n")
+			clustered[n.ID] = true
+		}
+		b.WriteString("    end\n")
+	}
+	var targets, gaps []string
+	for _, n := range g.Nodes {
+		if !clustered[n.ID] {
+			b.WriteString("    " + mermaidNode(n) + "\n")
+		}
+		switch {
+		case n.Target:
+			targets = append(targets, n.ID)
+		case n.Gap:
+			gaps = append(gaps, n.ID)
+		}
+	}
+	for _, e := range g.Edges {
+		if e.Traces > 1 {
+			fmt.Fprintf(&b, "    %s -->|%d| %s\n", e.From, e.Traces, e.To)
+		} else {
+			fmt.Fprintf(&b, "    %s --> %s\n", e.From, e.To)
+		}
+	}
+	if len(targets) > 0 {
+		b.WriteString("    classDef target stroke-width:3px\n")
+		b.WriteString("    class " + strings.Join(targets, ",") + " target\n")
+	}
+	if len(gaps) > 0 {
+		b.WriteString("    classDef gap stroke-dasharray:4 4\n")
+		b.WriteString("    class " + strings.Join(gaps, ",") + " gap\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidNode(n *Node) string {
+	label := mermaidQuote(strings.Join(labelLines(n), "<br/>"))
+	if n.Source {
+		return n.ID + "([" + label + "])"
+	}
+	return n.ID + "[" + label + "]"
+}
+
+// mermaidQuote wraps s in quotes; Mermaid only knows entity codes for the
+// characters that would end the label.
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+// graphMLKeys are the attributes written for every node and edge.
+var graphMLKeys = []struct{ id, target, name, typ string }{
+	{"label", "node", "label", "string"},
+	{"kind", "node", "kind", "string"},
+	{"ip", "node", "ip", "string"},
+	{"hostname", "node", "hostname", "string"},
+	{"asn", "node", "asn", "string"},
+	{"owner", "node", "owner", "string"},
+	{"location", "node", "location", "string"},
+	{"hops", "node", "hops", "int"},
+	{"traces", "node", "traces", "int"},
+	{"edge_traces", "edge", "traces", "int"},
+}
+
+// WriteGraphML writes g as flat GraphML. Clusters are not nested graphs,
+// which many readers flatten or reject; the "asn" attribute carries them.
+func WriteGraphML(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString("<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n")
+	for _, k := range graphMLKeys {
+		fmt.Fprintf(&b, "  <key id=\"%s\" for=\"%s\" attr.name=\"%s\" attr.type=\"%s\"/>\n", k.id, k.target, k.name, k.typ)
+	}
+	b.WriteString("  <graph id=\"nexttrace\" edgedefault=\"directed\">\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", n.ID)
+		for _, d := range [][2]string{
+			{"label", strings.Join(labelLines(n), "\n")},
+			{"kind", nodeKind(n)},
+			{"ip", n.IP},
+			{"hostname", n.Hostname},
+			{"asn", n.ASN},
+			{"owner", n.Owner},
+			{"location", n.Location},
+			{"hops", intData(n.Hops)},
+			{"traces", strconv.Itoa(n.Traces)},
+		} {
+			if d[1] != "" {
+				fmt.Fprintf(&b, "      <data key=\"%s\">%s</data>\n", d[0], xmlEscape(d[1]))
+			}
+		}
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, e.From, e.To)
+		fmt.Fprintf(&b, "      <data key=\"edge_traces\">%d</data>\n", e.Traces)
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func nodeKind(n *Node) string {
+	switch {
+	case n.Source:
+		return "source"
+	case n.Gap:
+		return "gap"
+	case n.Target:
+		return "target"
+	}
+	return "hop"
+}
+
+func intData(v int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package traceexport
+
+import (
+	"strings"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// atlasFirmware is written as "fw". Atlas parsers pick the result layout by
+// firmware version; 5020 selects the current one.
+const atlasFirmware = 5020
+
+// AtlasResult is a RIPE Atlas traceroute result.
+type AtlasResult struct {
+	Fw        int        `json:"fw"`
+	Type      string     `json:"type"`
+	MsmName   string     `json:"msm_name"`
+	MsmID     int        `json:"msm_id"`
+	PrbID     int        `json:"prb_id"`
+	From      string     `json:"from,omitempty"`
+	DstName   string     `json:"dst_name"`
+	DstAddr   string     `json:"dst_addr"`
+	SrcAddr   string     `json:"src_addr,omitempty"`
+	Proto     string     `json:"proto"`
+	AF        int        `json:"af"`
+	Size      int        `json:"size"`
+	ParisID   int        `json:"paris_id"`
+	Timestamp int64      `json:"timestamp"`
+	EndTime   int64      `json:"endtime"`
+	Result    []AtlasHop `json:"result"`
+}
+
+// AtlasHop lists the replies for one TTL.
+type AtlasHop struct {
+	Hop    int          `json:"hop"`
+	Error  string       `json:"error,omitempty"`
+	Result []AtlasReply `json:"result,omitempty"`
+}
+
+// AtlasReply is one attempt: {"x":"*"} for a timeout, otherwise the
+// responder with its RTT, reply TTL and, when quoted, the MPLS label stack.
+// Results do not keep the reply size or ICMP error, so the optional "size"
+// and "err" members are not written.
+type AtlasReply struct {
+	X       string        `json:"x,omitempty"`
+	From    string        `json:"from,omitempty"`
+	RTT     *float64      `json:"rtt,omitempty"`
+	TTL     int           `json:"ttl,omitempty"`
+	ICMPExt *AtlasICMPExt `json:"icmpext,omitempty"`
+}
+
+// AtlasICMPExt is an RFC 4884 extension structure.
+type AtlasICMPExt struct {
+	Version int            `json:"version"`
+	RFC4884 int            `json:"rfc4884"`
+	Obj     []AtlasICMPObj `json:"obj"`
+}
+
+// AtlasICMPObj is one extension object; class 1 type 1 is an MPLS stack.
+type AtlasICMPObj struct {
+	Class int         `json:"class"`
+	Type  int         `json:"type"`
+	MPLS  []AtlasMPLS `json:"mpls,omitempty"`
+}
+
+// AtlasMPLS is one label stack entry.
+type AtlasMPLS struct {
+	Exp   int `json:"exp"`
+	Label int `json:"label"`
+	S     int `json:"s"`
+	TTL   int `json:"ttl"`
+}
+
+func atlasResult(r round, meta Meta) AtlasResult {
+	out := AtlasResult{
+		Fw:        atlasFirmware,
+		Type:      "traceroute",
+		MsmName:   "Traceroute",
+		DstName:   meta.Target,
+		DstAddr:   meta.DstAddr,
+		SrcAddr:   meta.SrcAddr,
+		Proto:     strings.ToUpper(string(meta.Method)),
+		AF:        addressFamily(meta.DstAddr),
+		Size:      meta.PacketSize,
+		Timestamp: meta.Start.Unix(),
+		EndTime:   meta.End.Unix(),
+		Result:    []AtlasHop{},
+	}
+	if out.DstName == "" {
+		out.DstName = meta.DstAddr
+	}
+	if out.Proto == "" {
+		out.Proto = "ICMP"
+	}
+	for i, hops := range r.hops {
+		hop := AtlasHop{Hop: i + 1}
+		for _, rep := range hops {
+			if rep.timeout {
+				hop.Result = append(hop.Result, AtlasReply{X: "*"})
+				continue
+			}
+			rtt := roundMs(rep.rtt)
+			ar := AtlasReply{From: rep.from, RTT: &rtt, TTL: rep.replyTTL}
+			if len(rep.mpls) > 0 {
+				obj := AtlasICMPObj{Class: 1, Type: 1}
+				for _, l := range rep.mpls {
+					obj.MPLS = append(obj.MPLS, AtlasMPLS{Exp: l.TC, Label: l.Label, S: l.S, TTL: l.TTL})
+				}
+				ar.ICMPExt = &AtlasICMPExt{Version: 2, RFC4884: 1, Obj: []AtlasICMPObj{obj}}
+			}
+			hop.Result = append(hop.Result, ar)
+		}
+		if len(hop.Result) == 0 {
+			hop.Result = []AtlasReply{{X: "*"}}
+		}
+		out.Result = append(out.Result, hop)
+	}
+	return out
+}
+
+// MPLSLabels converts the extension objects of a reply back to Hop.MPLS
+// entries.
+func (r AtlasReply) MPLSLabels() []string {
+	if r.ICMPExt == nil {
+		return nil
+	}
+	var out []string
+	for _, obj := range r.ICMPExt.Obj {
+		for _, m := range obj.MPLS {
+			out = append(out, trace.MPLSLabel{Label: m.Label, TC: m.Exp, S: m.S, TTL: m.TTL}.String())
+		}
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+package traceexport
+
+import (
+	"math"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// ScamperTrace is a trace object as printed by sc_warts2json.
+type ScamperTrace struct {
+	Type       string       `json:"type"`
+	Version    string       `json:"version"`
+	UserID     int          `json:"userid"`
+	Method     string       `json:"method"`
+	Src        string       `json:"src,omitempty"`
+	Dst        string       `json:"dst"`
+	StopReason string       `json:"stop_reason"`
+	StopData   int          `json:"stop_data"`
+	Start      ScamperTime  `json:"start"`
+	HopCount   int          `json:"hop_count"`
+	Attempts   int          `json:"attempts"`
+	HopLimit   int          `json:"hoplimit"`
+	FirstHop   int          `json:"firsthop"`
+	Wait       int          `json:"wait"`
+	WaitProbe  int          `json:"wait_probe"`
+	TOS        int          `json:"tos"`
+	ProbeSize  int          `json:"probe_size"`
+	ProbeCount int          `json:"probe_count"`
+	Hops       []ScamperHop `json:"hops"`
+}
+
+// ScamperTime is scamper's timestamp object.
+type ScamperTime struct {
+	Sec   int64  `json:"sec"`
+	Usec  int64  `json:"usec"`
+	Ftime string `json:"ftime"`
+}
+
+// ScamperHop is one answered probe. scamper lists no entry for timeouts.
+// Results do not keep the ICMP type and code or the size of a reply, so
+// icmp_type, icmp_code and reply_size are left out rather than guessed.
+type ScamperHop struct {
+	Addr      string           `json:"addr"`
+	Name      string           `json:"name,omitempty"`
+	ProbeTTL  int              `json:"probe_ttl"`
+	ProbeID   int              `json:"probe_id"`
+	ProbeSize int              `json:"probe_size"`
+	RTT       float64          `json:"rtt"`
+	ReplyTTL  int              `json:"reply_ttl,omitempty"`
+	ICMPExt   []ScamperICMPExt `json:"icmpext,omitempty"`
+}
+
+// ScamperICMPExt is one ICMP extension object.
+type ScamperICMPExt struct {
+	ClassNum  int           `json:"ie_cn"`
+	ClassType int           `json:"ie_ct"`
+	DataLen   int           `json:"ie_dl"`
+	MPLS      []ScamperMPLS `json:"mpls_labels,omitempty"`
+}
+
+// ScamperMPLS is one label stack entry.
+type ScamperMPLS struct {
+	TTL   int `json:"mpls_ttl"`
+	S     int `json:"mpls_s"`
+	Exp   int `json:"mpls_exp"`
+	Label int `json:"mpls_label"`
+}
+
+var scamperMethods = map[trace.Method]string{
+	trace.ICMPTrace: "icmp-echo",
+	trace.UDPTrace:  "udp",
+	trace.TCPTrace:  "tcp",
+	trace.SCTPTrace: "sctp",
+}
+
+func scamperTrace(r round, meta Meta) ScamperTrace {
+	method := scamperMethods[meta.Method]
+	if method == "" {
+		method = scamperMethods[trace.ICMPTrace]
+	}
+	out := ScamperTrace{
+		Type:      "trace",
+		Version:   "0.1",
+		Method:    method,
+		Src:       meta.SrcAddr,
+		Dst:       meta.DstAddr,
+		Start:     scamperTime(meta.Start),
+		HopCount:  len(r.hops),
+		Attempts:  meta.Attempts,
+		HopLimit:  meta.MaxHops,
+		FirstHop:  max(meta.FirstHop, 1),
+		Wait:      int(math.Ceil(meta.Timeout.Seconds())),
+		TOS:       meta.TOS,
+		ProbeSize: meta.PacketSize,
+		Hops:      []ScamperHop{},
+	}
+	switch {
+	case r.reached(meta.DstAddr):
+		out.StopReason = "COMPLETED"
+	case meta.MaxHops > 0 && len(r.hops) >= meta.MaxHops:
+		out.StopReason = "HOPLIMIT"
+	default:
+		out.StopReason = "GAPLIMIT"
+	}
+	for i, hops := range r.hops {
+		for j, rep := range hops {
+			out.ProbeCount++
+			if rep.timeout {
+				continue
+			}
+			hop := ScamperHop{
+				Addr:      rep.from,
+				Name:      rep.name,
+				ProbeTTL:  i + 1,
+				ProbeID:   j + 1,
+				ProbeSize: meta.PacketSize,
+				RTT:       roundMs(rep.rtt),
+				ReplyTTL:  rep.replyTTL,
+			}
+			if len(rep.mpls) > 0 {
+				ext := ScamperICMPExt{ClassNum: 1, ClassType: 1, DataLen: 4 * len(rep.mpls)}
+				for _, l := range rep.mpls {
+					ext.MPLS = append(ext.MPLS, ScamperMPLS{TTL: l.TTL, S: l.S, Exp: l.TC, Label: l.Label})
+				}
+				hop.ICMPExt = []ScamperICMPExt{ext}
+			}
+			out.Hops = append(out.Hops, hop)
+		}
+	}
+	return out
+}
+
+func scamperTime(t time.Time) ScamperTime {
+	return ScamperTime{
+		Sec:   t.Unix(),
+		Usec:  int64(t.Nanosecond() / 1000),
+		Ftime: t.Format("2006-01-02 15:04:05"),
+	}
+}
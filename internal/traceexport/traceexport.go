@@ -0,0 +1,191 @@
+// Package traceexport writes NextTrace results in the traceroute JSON schemas
+// of RIPE Atlas and scamper (sc_warts2json), for research tooling built
+// around those platforms.
+package traceexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/trace"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// Format names an output schema.
+type Format string
+
+const (
+	FormatAtlas   Format = "atlas"
+	FormatScamper Format = "scamper"
+)
+
+// Formats lists the supported schemas.
+var Formats = []Format{FormatAtlas, FormatScamper}
+
+// Meta describes the measurement. Both schemas carry it next to the hops;
+// zero fields are written as zero or left out.
+type Meta struct {
+	Target     string
+	DstAddr    string
+	SrcAddr    string
+	Method     trace.Method
+	PacketSize int
+	TOS        int
+	FirstHop   int
+	MaxHops    int
+	Attempts   int
+	Timeout    time.Duration
+	Start      time.Time
+	End        time.Time
+}
+
+// reply is one probe attempt, the unit both schemas list per hop.
+type reply struct {
+	from string
+	name string
+	rtt  float64
+	mpls []trace.MPLSLabel
+	// replyTTL is the TTL the reply arrived with, 0 when unknown.
+	replyTTL int
+	timeout  bool
+}
+
+// round is one pass over the TTLs; hops[i] holds the attempts for TTL i+1.
+type round struct {
+	hops [][]reply
+}
+
+// Write writes res in format.
+func Write(w io.Writer, format Format, res *trace.Result, meta Meta) error {
+	return write(w, format, []round{roundFromResult(res)}, meta)
+}
+
+// WriteMTRRecords writes MTR raw records in format, one measurement per
+// MTR iteration.
+func WriteMTRRecords(w io.Writer, format Format, records []trace.MTRRawRecord, meta Meta) error {
+	return write(w, format, roundsFromMTR(records), meta)
+}
+
+func write(w io.Writer, format Format, rounds []round, meta Meta) error {
+	switch format {
+	case FormatAtlas:
+		out := make([]AtlasResult, 0, len(rounds))
+		for _, r := range rounds {
+			out = append(out, atlasResult(r, meta))
+		}
+		return json.NewEncoder(w).Encode(out)
+	case FormatScamper:
+		// sc_warts2json prints one object per line.
+		enc := json.NewEncoder(w)
+		for _, r := range rounds {
+			if err := enc.Encode(scamperTrace(r, meta)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+func roundFromResult(res *trace.Result) round {
+	var r round
+	if res == nil {
+		return r
+	}
+	for i, hops := range res.Hops {
+		for _, h := range hops {
+			ttl := h.TTL
+			if ttl <= 0 {
+				ttl = i + 1
+			}
+			ip := util.AddrIP(h.Address)
+			if !h.Success || ip == nil {
+				r.add(ttl, reply{timeout: true})
+				continue
+			}
+			r.add(ttl, reply{
+				from:     ip.String(),
+				name:     h.Hostname,
+				rtt:      float64(h.RTT) / float64(time.Millisecond),
+				mpls:     parseMPLS(h.MPLS),
+				replyTTL: h.ReplyTTL,
+			})
+		}
+	}
+	return r
+}
+
+func roundsFromMTR(records []trace.MTRRawRecord) []round {
+	byIter := map[int]*round{}
+	for _, rec := range records {
+		r, ok := byIter[rec.Iteration]
+		if !ok {
+			r = &round{}
+			byIter[rec.Iteration] = r
+		}
+		if !rec.Success || rec.IP == "" {
+			r.add(rec.TTL, reply{timeout: true})
+			continue
+		}
+		r.add(rec.TTL, reply{from: rec.IP, name: rec.Host, rtt: rec.RTTMs, mpls: parseMPLS(rec.MPLS), replyTTL: rec.ReplyTTL})
+	}
+	iters := make([]int, 0, len(byIter))
+	for it := range byIter {
+		iters = append(iters, it)
+	}
+	sort.Ints(iters)
+	out := make([]round, 0, len(iters))
+	for _, it := range iters {
+		out = append(out, *byIter[it])
+	}
+	return out
+}
+
+func (r *round) add(ttl int, rep reply) {
+	if ttl <= 0 {
+		return
+	}
+	for len(r.hops) < ttl {
+		r.hops = append(r.hops, nil)
+	}
+	r.hops[ttl-1] = append(r.hops[ttl-1], rep)
+}
+
+// reached reports whether any attempt was answered by dst.
+func (r round) reached(dst string) bool {
+	for _, hops := range r.hops {
+		for _, rep := range hops {
+			if !rep.timeout && rep.from == dst {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseMPLS(entries []string) []trace.MPLSLabel {
+	var out []trace.MPLSLabel
+	for _, e := range entries {
+		if l, ok := trace.ParseMPLSLabel(e); ok {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func addressFamily(addr string) int {
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return 6
+	}
+	return 4
+}
+
+// roundMs keeps three decimals, the precision both platforms report.
+func roundMs(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
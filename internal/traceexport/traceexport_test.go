@@ -0,0 +1,152 @@
+package traceexport
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func exportFixture() (*trace.Result, Meta) {
+	res := &trace.Result{Hops: [][]trace.Hop{
+		{
+			{Success: true, TTL: 1, Address: &net.IPAddr{IP: net.ParseIP("192.168.1.1")}, RTT: 1234567 * time.Nanosecond},
+			{Success: true, TTL: 1, Address: &net.IPAddr{IP: net.ParseIP("192.168.1.1")}, RTT: time.Millisecond},
+		},
+		{
+			{TTL: 2},
+			{Success: true, TTL: 2, Address: &net.IPAddr{IP: net.ParseIP("10.0.0.1")}, RTT: 5 * time.Millisecond,
+				MPLS: []string{trace.MPLSLabel{Label: 24012, TC: 0, S: 1, TTL: 1}.String()}},
+		},
+		{
+			{Success: true, TTL: 3, Address: &net.IPAddr{IP: net.ParseIP("1.1.1.1")}, Hostname: "one.one.one.one", RTT: 9 * time.Millisecond, ReplyTTL: 58},
+		},
+	}}
+	return res, Meta{
+		Target:     "one.one.one.one",
+		DstAddr:    "1.1.1.1",
+		SrcAddr:    "192.168.1.10",
+		Method:     trace.UDPTrace,
+		PacketSize: 52,
+		FirstHop:   1,
+		MaxHops:    30,
+		Attempts:   2,
+		Timeout:    time.Second,
+		Start:      time.Unix(1700000000, 500000000),
+		End:        time.Unix(1700000003, 0),
+	}
+}
+
+func TestWriteAtlas(t *testing.T) {
+	res, meta := exportFixture()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatAtlas, res, meta); err != nil {
+		t.Fatal(err)
+	}
+	var out []AtlasResult
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 {
+		t.Fatalf("results = %d, want 1", len(out))
+	}
+	r := out[0]
+	if r.Proto != "UDP" || r.AF != 4 || r.DstName != "one.one.one.one" || r.Timestamp != 1700000000 || r.EndTime != 1700000003 {
+		t.Fatalf("header = %+v", r)
+	}
+	if len(r.Result) != 3 {
+		t.Fatalf("hops = %d, want 3", len(r.Result))
+	}
+	if got := *r.Result[0].Result[0].RTT; got != 1.235 {
+		t.Fatalf("rtt = %v, want 1.235", got)
+	}
+	hop2 := r.Result[1].Result
+	if hop2[0].X != "*" || hop2[1].From != "10.0.0.1" {
+		t.Fatalf("hop 2 = %+v", hop2)
+	}
+	if got := hop2[1].MPLSLabels(); len(got) != 1 || got[0] != "[MPLS: Lbl 24012, TC 0, S 1, TTL 1]" {
+		t.Fatalf("mpls = %q", got)
+	}
+	if got := r.Result[2].Result[0].TTL; got != 58 {
+		t.Fatalf("reply ttl = %d, want 58", got)
+	}
+	if !strings.Contains(buf.String(), `"icmpext":{"version":2,"rfc4884":1,"obj":[{"class":1,"type":1,"mpls":[{"exp":0,"label":24012,"s":1,"ttl":1}]}]}`) {
+		t.Fatalf("icmpext missing:\n%s", buf.String())
+	}
+}
+
+func TestWriteScamper(t *testing.T) {
+	res, meta := exportFixture()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatScamper, res, meta); err != nil {
+		t.Fatal(err)
+	}
+	var out ScamperTrace
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Method != "udp" || out.StopReason != "COMPLETED" || out.HopCount != 3 || out.ProbeCount != 5 || out.Wait != 1 {
+		t.Fatalf("header = %+v", out)
+	}
+	if out.Start.Usec != 500000 {
+		t.Fatalf("start = %+v", out.Start)
+	}
+	if len(out.Hops) != 4 {
+		t.Fatalf("hops = %d, want 4 answered probes", len(out.Hops))
+	}
+	if strings.Contains(buf.String(), "icmp_type") || strings.Contains(buf.String(), "icmp_code") {
+		t.Fatalf("scamper output invents ICMP type/code:\n%s", buf.String())
+	}
+	if h := out.Hops[0]; h.ProbeID != 1 || h.ProbeTTL != 1 {
+		t.Fatalf("first hop = %+v", h)
+	}
+	if h := out.Hops[2]; h.ProbeID != 2 || len(h.ICMPExt) != 1 || h.ICMPExt[0].MPLS[0].Label != 24012 {
+		t.Fatalf("mpls hop = %+v", h)
+	}
+	if h := out.Hops[3]; h.Name != "one.one.one.one" || h.ReplyTTL != 58 {
+		t.Fatalf("destination hop = %+v", h)
+	}
+}
+
+func TestWriteMTRRecordsOneResultPerIteration(t *testing.T) {
+	_, meta := exportFixture()
+	meta.Method = trace.ICMPTrace
+	records := []trace.MTRRawRecord{
+		{Iteration: 2, TTL: 1, Success: true, IP: "192.168.1.1", RTTMs: 1},
+		{Iteration: 1, TTL: 1, Success: true, IP: "192.168.1.1", RTTMs: 2},
+		{Iteration: 1, TTL: 2, Success: true, IP: "1.1.1.1", RTTMs: 8},
+		{Iteration: 2, TTL: 2},
+	}
+	var buf bytes.Buffer
+	if err := WriteMTRRecords(&buf, FormatScamper, records, meta); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("lines = %d, want 2", len(lines))
+	}
+	var first, second ScamperTrace
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.StopReason != "COMPLETED" || first.Hops[0].RTT != 2 || first.Hops[1].Addr != "1.1.1.1" {
+		t.Fatalf("iteration 1 = %+v", first)
+	}
+	if second.StopReason != "GAPLIMIT" || len(second.Hops) != 1 {
+		t.Fatalf("iteration 2 = %+v", second)
+	}
+}
+
+func TestWriteRejectsUnknownFormat(t *testing.T) {
+	res, meta := exportFixture()
+	if err := Write(&bytes.Buffer{}, Format("warts"), res, meta); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
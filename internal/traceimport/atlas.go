@@ -0,0 +1,73 @@
+package traceimport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/nxtrace/NTrace-core/internal/traceexport"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// parseAtlas reads RIPE Atlas traceroute results: the JSON array the API
+// returns, a single object, or one object per line. Only the first result is
+// imported; a measurement usually holds one per probe.
+func parseAtlas(data []byte) (*Import, error) {
+	var res traceexport.AtlasResult
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var all []traceexport.AtlasResult
+		if err := json.Unmarshal(trimmed, &all); err != nil {
+			return nil, err
+		}
+		if len(all) == 0 {
+			return nil, errors.New("empty result list")
+		}
+		res = all[0]
+	} else if err := json.NewDecoder(bytes.NewReader(trimmed)).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Type != "" && res.Type != "traceroute" {
+		return nil, fmt.Errorf("measurement type %q is not traceroute", res.Type)
+	}
+
+	imp := &Import{Source: res.SrcAddr, Target: res.DstName, TargetIP: res.DstAddr, Result: &trace.Result{}}
+	if res.PrbID > 0 {
+		imp.Source = fmt.Sprintf("RIPE Atlas probe %d", res.PrbID)
+	}
+	for _, hop := range res.Result {
+		if hop.Hop <= 0 {
+			continue
+		}
+		if len(hop.Result) == 0 {
+			// "error" hops carry no replies.
+			if err := addHop(imp.Result, trace.Hop{TTL: hop.Hop}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, r := range hop.Result {
+			ip := net.ParseIP(r.From)
+			if r.X == "*" || ip == nil || r.RTT == nil {
+				if err := addHop(imp.Result, trace.Hop{TTL: hop.Hop}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			h := trace.Hop{
+				Success: true,
+				TTL:     hop.Hop,
+				Address: &net.IPAddr{IP: ip},
+				RTT:     msDuration(*r.RTT),
+				MPLS:    r.MPLSLabels(),
+			}
+			h.SetReplyTTL(r.TTL)
+			if err := addHop(imp.Result, h); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return imp, nil
+}
@@ -0,0 +1,208 @@
+package traceimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// mtrHostRe matches the "name (ip)" host column of mtr -b.
+var mtrHostRe = regexp.MustCompile(`^(\S+)\s+\(([^)]+)\)$`)
+
+// mtrStat builds one row from mtr's report columns. fields is keyed by the
+// column names mtr uses in all three formats (Loss%, Snt, Last, ...).
+func mtrStat(ttl int, host, asn string, fields func(string) float64) trace.MTRHopStat {
+	s := trace.MTRHopStat{
+		TTL:   ttl,
+		Loss:  fields("Loss%"),
+		Snt:   int(fields("Snt")),
+		Last:  fields("Last"),
+		Avg:   fields("Avg"),
+		Best:  fields("Best"),
+		Wrst:  fields("Wrst"),
+		StDev: fields("StDev"),
+		Geo:   asnGeo(asn),
+	}
+	s.Received = int(math.Round(float64(s.Snt) * (100 - s.Loss) / 100))
+	host = strings.TrimSpace(host)
+	switch {
+	case host == "" || host == "???":
+		s.Loss = 100
+		s.Received = 0
+	case mtrHostRe.MatchString(host):
+		m := mtrHostRe.FindStringSubmatch(host)
+		s.Host, s.IP = trace.CanonicalHostname(m[1]), m[2]
+	case net.ParseIP(host) != nil:
+		s.IP = host
+	default:
+		// Without -n or -b mtr prints names only; the address is unknown.
+		s.Host = trace.CanonicalHostname(host)
+	}
+	return s
+}
+
+// parseMTRFloat accepts numbers and the "12.5%" strings some mtr versions
+// write for Loss%.
+func parseMTRFloat(raw string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(raw), "%"), 64)
+	return v
+}
+
+// parseMTRJSON reads mtr --json. Older releases quote numbers, so every
+// value is decoded as raw JSON and parsed leniently.
+func parseMTRJSON(data []byte) (*Import, error) {
+	var doc struct {
+		Report struct {
+			MTR struct {
+				Src string `json:"src"`
+				Dst string `json:"dst"`
+			} `json:"mtr"`
+			Hubs []map[string]json.RawMessage `json:"hubs"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Report.Hubs == nil {
+		return nil, errors.New(`missing "report.hubs"`)
+	}
+	imp := &Import{Source: doc.Report.MTR.Src, Target: doc.Report.MTR.Dst, MTR: []trace.MTRHopStat{}}
+	for _, hub := range doc.Report.Hubs {
+		field := func(name string) string {
+			raw, ok := hub[name]
+			if !ok {
+				return ""
+			}
+			var s string
+			if json.Unmarshal(raw, &s) == nil {
+				return s
+			}
+			return string(raw)
+		}
+		ttl := int(parseMTRFloat(field("count")))
+		imp.MTR = append(imp.MTR, mtrStat(ttl, field("host"), field("ASN"), func(name string) float64 {
+			return parseMTRFloat(field(name))
+		}))
+	}
+	if net.ParseIP(imp.Target) != nil {
+		imp.TargetIP = imp.Target
+	}
+	return imp, nil
+}
+
+var (
+	mtrXMLRootRe  = regexp.MustCompile(`<MTR\s([^>]*)>`)
+	mtrXMLHubRe   = regexp.MustCompile(`(?s)<HUB\s([^>]*)>(.*?)</HUB>`)
+	mtrXMLAttrRe  = regexp.MustCompile(`([A-Za-z]+)="([^"]*)"`)
+	mtrXMLFieldRe = regexp.MustCompile(`<([A-Za-z]+%?)>([^<]*)</`)
+	// mtrXMLExtRe matches the geo element NextTrace adds to each hub.
+	mtrXMLExtRe = regexp.MustCompile(`<NEXTTRACE\s([^>]*)/>`)
+)
+
+// parseMTRXML reads mtr --xml. Its <Loss%> elements are not well-formed XML,
+// so the document is scanned with patterns instead of encoding/xml.
+func parseMTRXML(data []byte) (*Import, error) {
+	root := mtrXMLRootRe.FindSubmatch(data)
+	if root == nil {
+		return nil, errors.New("missing <MTR> element")
+	}
+	attrs := xmlAttrs(root[1])
+	imp := &Import{Source: attrs["SRC"], Target: attrs["DST"], MTR: []trace.MTRHopStat{}}
+	for _, hub := range mtrXMLHubRe.FindAllSubmatch(data, -1) {
+		hubAttrs := xmlAttrs(hub[1])
+		fields := map[string]string{}
+		for _, f := range mtrXMLFieldRe.FindAllSubmatch(hub[2], -1) {
+			fields[string(f[1])] = html.UnescapeString(string(f[2]))
+		}
+		asn := hubAttrs["ASN"]
+		if ext := mtrXMLExtRe.FindSubmatch(hub[2]); ext != nil && asn == "" {
+			asn = xmlAttrs(ext[1])["ASN"]
+		}
+		ttl := int(parseMTRFloat(hubAttrs["COUNT"]))
+		imp.MTR = append(imp.MTR, mtrStat(ttl, hubAttrs["HOST"], asn, func(name string) float64 {
+			return parseMTRFloat(fields[name])
+		}))
+	}
+	if net.ParseIP(imp.Target) != nil {
+		imp.TargetIP = imp.Target
+	}
+	return imp, nil
+}
+
+// shiftZeroBasedTTLs renumbers hops when a tool counted them from zero.
+func shiftZeroBasedTTLs(stats []trace.MTRHopStat) {
+	for _, s := range stats {
+		if s.TTL == 0 {
+			for i := range stats {
+				stats[i].TTL++
+			}
+			return
+		}
+	}
+}
+
+func xmlAttrs(raw []byte) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range mtrXMLAttrRe.FindAllSubmatch(raw, -1) {
+		attrs[strings.ToUpper(string(m[1]))] = html.UnescapeString(string(m[2]))
+	}
+	return attrs
+}
+
+// parseMTRCSV reads mtr --csv. Columns are located by the header row, which
+// gains an Asn column with -z.
+func parseMTRCSV(data []byte) (*Import, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	for _, need := range []string{"Hop", "Ip", "Snt"} {
+		if _, ok := col[need]; !ok {
+			return nil, errors.New("missing column " + need)
+		}
+	}
+	imp := &Import{MTR: []trace.MTRHopStat{}}
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return rec[i]
+			}
+			return ""
+		}
+		if imp.Target == "" {
+			imp.Target = value("Host")
+		}
+		ttl := int(parseMTRFloat(value("Hop")))
+		imp.MTR = append(imp.MTR, mtrStat(ttl, value("Ip"), value("Asn"), func(name string) float64 {
+			return parseMTRFloat(value(name))
+		}))
+	}
+	if net.ParseIP(imp.Target) != nil {
+		imp.TargetIP = imp.Target
+	}
+	return imp, nil
+}
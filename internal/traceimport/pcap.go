@@ -0,0 +1,23 @@
+package traceimport
+
+import (
+	"bytes"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// parsePcap rebuilds the traceroutes of a packet capture. Only the first is
+// imported, like the first result of an Atlas measurement.
+func parsePcap(data []byte) (*Import, error) {
+	traces, err := trace.TracesFromPcap(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	t := traces[0]
+	return &Import{
+		Source:   t.Source.String(),
+		Target:   t.Target.String(),
+		TargetIP: t.Target.String(),
+		Result:   t.Result,
+	}, nil
+}
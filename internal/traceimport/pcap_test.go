@@ -0,0 +1,74 @@
+package traceimport
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// icmpTracePcap captures an ICMP traceroute over Ethernet: TTL 1 answered
+// by a router, TTL 2 by the target.
+func icmpTracePcap(t *testing.T) []byte {
+	t.Helper()
+	host, router, target := net.ParseIP("192.0.2.10").To4(), net.ParseIP("203.0.113.1").To4(), net.ParseIP("198.51.100.1").To4()
+	var buf bytes.Buffer
+	w := pcapgo.NewWriter(&buf)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	write := func(at time.Time, ls ...gopacket.SerializableLayer) []byte {
+		eth := &layers.Ethernet{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{2, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+		out := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(out, gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}, append([]gopacket.SerializableLayer{eth}, ls...)...); err != nil {
+			t.Fatal(err)
+		}
+		data := out.Bytes()
+		if err := w.WritePacket(gopacket.CaptureInfo{Timestamp: at, CaptureLength: len(data), Length: len(data)}, data); err != nil {
+			t.Fatal(err)
+		}
+		return data[14:]
+	}
+	echo := func(ttl int, at time.Time) []byte {
+		return write(at,
+			&layers.IPv4{Version: 4, IHL: 5, SrcIP: host, DstIP: target, Protocol: layers.IPProtocolICMPv4, TTL: uint8(ttl)},
+			&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 7, Seq: uint16(ttl)},
+			gopacket.Payload("ntr"))
+	}
+	p1 := echo(1, start)
+	echo(2, start.Add(time.Millisecond))
+	write(start.Add(4*time.Millisecond),
+		&layers.IPv4{Version: 4, IHL: 5, SrcIP: router, DstIP: host, Protocol: layers.IPProtocolICMPv4, TTL: 64},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimeExceeded, 0)},
+		gopacket.Payload(p1[:28]))
+	write(start.Add(11*time.Millisecond),
+		&layers.IPv4{Version: 4, IHL: 5, SrcIP: target, DstIP: host, Protocol: layers.IPProtocolICMPv4, TTL: 60},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0), Id: 7, Seq: 2},
+		gopacket.Payload("ntr"))
+	return buf.Bytes()
+}
+
+func TestParsePcap(t *testing.T) {
+	imp, err := Parse(icmpTracePcap(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imp.Format != FormatPcap || imp.Source != "192.0.2.10" || imp.TargetIP != "198.51.100.1" || imp.Target != "198.51.100.1" {
+		t.Fatalf("import = %+v", imp)
+	}
+	hops := imp.Result.Hops
+	if len(hops) != 2 {
+		t.Fatalf("TTLs = %d, want 2", len(hops))
+	}
+	if h := hops[0][0]; h.Address.String() != "203.0.113.1" || h.RTT != 4*time.Millisecond {
+		t.Fatalf("ttl 1 = %+v", h)
+	}
+	if h := hops[1][0]; h.Address.String() != "198.51.100.1" || h.RTT != 10*time.Millisecond {
+		t.Fatalf("ttl 2 = %+v", h)
+	}
+}
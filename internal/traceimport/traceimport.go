@@ -0,0 +1,243 @@
+// Package traceimport parses traceroute and mtr output saved by other tools
+// into NextTrace results, so a customer's paste can be enriched with our geo
+// sources and re-rendered by any of the printers.
+package traceimport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// Format names an input format.
+type Format string
+
+const (
+	FormatAuto       Format = "auto"
+	FormatTraceroute Format = "traceroute"
+	FormatTracert    Format = "tracert"
+	FormatMTRJSON    Format = "mtr-json"
+	FormatMTRXML     Format = "mtr-xml"
+	FormatMTRCSV     Format = "mtr-csv"
+	FormatAtlas      Format = "atlas"
+	FormatPcap       Format = "pcap"
+)
+
+// Formats lists the concrete formats Parse understands.
+var Formats = []Format{FormatTraceroute, FormatTracert, FormatMTRJSON, FormatMTRXML, FormatMTRCSV, FormatAtlas, FormatPcap}
+
+var ErrUnknownFormat = errors.New("unrecognized input: expected traceroute, tracert, mtr --json, mtr --xml, mtr --csv or RIPE Atlas output, or a pcap/pcapng capture")
+
+// Import is one parsed output. Result is always set; MTR formats also carry
+// their per-hop statistics in MTR.
+type Import struct {
+	Format   Format
+	Source   string
+	Target   string
+	TargetIP string
+	Result   *trace.Result
+	MTR      []trace.MTRHopStat
+}
+
+// Parse detects the format of data and parses it.
+func Parse(data []byte) (*Import, error) {
+	return ParseFormat(data, FormatAuto)
+}
+
+// ParseFormat parses data as format; FormatAuto detects it.
+func ParseFormat(data []byte, format Format) (*Import, error) {
+	if format == "" || format == FormatAuto {
+		format = Detect(data)
+		if format == "" {
+			return nil, ErrUnknownFormat
+		}
+	}
+	var (
+		imp *Import
+		err error
+	)
+	switch format {
+	case FormatTraceroute:
+		imp, err = parseTraceroute(data)
+	case FormatTracert:
+		imp, err = parseTracert(data)
+	case FormatMTRJSON:
+		imp, err = parseMTRJSON(data)
+	case FormatMTRXML:
+		imp, err = parseMTRXML(data)
+	case FormatMTRCSV:
+		imp, err = parseMTRCSV(data)
+	case FormatAtlas:
+		imp, err = parseAtlas(data)
+	case FormatPcap:
+		imp, err = parsePcap(data)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", format, err)
+	}
+	imp.Format = format
+	if imp.MTR != nil {
+		shiftZeroBasedTTLs(imp.MTR)
+		if imp.Result, err = resultFromStats(imp.MTR); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", format, err)
+		}
+	}
+	if len(imp.Result.Hops) == 0 {
+		return nil, fmt.Errorf("parse %s: no hops found", format)
+	}
+	fillGaps(imp.Result)
+	if imp.TargetIP == "" {
+		imp.TargetIP = lastAddress(imp.Result)
+	}
+	if imp.Target == "" {
+		imp.Target = imp.TargetIP
+	}
+	return imp, nil
+}
+
+// tracert hop lines start with an RTT column, traceroute ones with a host,
+// an address or a timeout.
+var (
+	tracertHopRe    = regexp.MustCompile(`(?m)^\s*\d+\s+(?:\*\s+)*<?\d+\s*ms\s`)
+	tracerouteHopRe = regexp.MustCompile(`(?m)^\s*\d+\s+(?:\*|\S+\s+\(|[0-9A-Fa-f:.]+\s+\S+\s+ms)`)
+)
+
+// pcapMagics start pcap files of either byte order and timestamp resolution,
+// and pcapng files.
+var pcapMagics = [][]byte{
+	{0xD4, 0xC3, 0xB2, 0xA1}, {0xA1, 0xB2, 0xC3, 0xD4},
+	{0x4D, 0x3C, 0xB2, 0xA1}, {0xA1, 0xB2, 0x3C, 0x4D},
+	{0x0A, 0x0D, 0x0D, 0x0A},
+}
+
+// Detect guesses the format of data, or returns "" when nothing matches.
+func Detect(data []byte) Format {
+	for _, magic := range pcapMagics {
+		if bytes.HasPrefix(data, magic) {
+			return FormatPcap
+		}
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return ""
+	case trimmed[0] == '[', trimmed[0] == '{' && bytes.Contains(trimmed, []byte(`"dst_addr"`)):
+		return FormatAtlas
+	case trimmed[0] == '{':
+		return FormatMTRJSON
+	case bytes.Contains(trimmed, []byte("<MTR ")):
+		return FormatMTRXML
+	case bytes.HasPrefix(trimmed, []byte("Mtr_Version,")):
+		return FormatMTRCSV
+	case tracertHopRe.Match(trimmed):
+		return FormatTracert
+	case tracerouteHopRe.Match(trimmed):
+		return FormatTraceroute
+	}
+	return ""
+}
+
+// Enrich looks up geo data and, when cfg.RDNS is set, PTR names with cfg's
+// geo source. MTR rows are enriched first and the result rebuilt from them.
+func (imp *Import) Enrich(cfg trace.Config) {
+	if imp.MTR != nil {
+		trace.EnrichMTRStats(imp.MTR, cfg)
+		// Parse already rejected out-of-range TTLs.
+		if res, err := resultFromStats(imp.MTR); err == nil {
+			imp.Result = res
+			fillGaps(imp.Result)
+		}
+		return
+	}
+	trace.EnrichResult(imp.Result, cfg)
+}
+
+// Stats returns MTR rows for the report printers; traceroute imports are
+// aggregated the way a single local MTR round would be.
+func (imp *Import) Stats() []trace.MTRHopStat {
+	if imp.MTR != nil {
+		return imp.MTR
+	}
+	return trace.NewMTRAggregator().Update(imp.Result, 0)
+}
+
+// resultFromStats turns MTR rows into a result with one reply per row, timed
+// with the row's average, so the traceroute printers can show them.
+func resultFromStats(stats []trace.MTRHopStat) (*trace.Result, error) {
+	res := &trace.Result{}
+	for _, s := range stats {
+		if s.TTL <= 0 {
+			continue
+		}
+		hop := trace.Hop{TTL: s.TTL, Hostname: s.Host, Geo: s.Geo}
+		if ip := net.ParseIP(s.IP); ip != nil {
+			hop.Address = &net.IPAddr{IP: ip}
+			hop.Success = s.Received > 0 || s.Loss < 100
+			hop.RTT = msDuration(s.Avg)
+		}
+		if err := addHop(res, hop); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// maxImportTTL is the largest TTL an IPv4 or IPv6 header can carry. Larger
+// values in a paste are corrupt and would size the hop slice unbounded.
+const maxImportTTL = 255
+
+// addHop appends hop at its TTL.
+func addHop(res *trace.Result, hop trace.Hop) error {
+	if hop.TTL < 1 || hop.TTL > maxImportTTL {
+		return fmt.Errorf("hop %d: TTL must be between 1 and %d", hop.TTL, maxImportTTL)
+	}
+	for len(res.Hops) < hop.TTL {
+		res.Hops = append(res.Hops, nil)
+	}
+	res.Hops[hop.TTL-1] = append(res.Hops[hop.TTL-1], hop)
+	return nil
+}
+
+// fillGaps marks TTLs the tool skipped as timeouts.
+func fillGaps(res *trace.Result) {
+	for i, hops := range res.Hops {
+		if len(hops) == 0 {
+			res.Hops[i] = []trace.Hop{{TTL: i + 1}}
+		}
+	}
+}
+
+func lastAddress(res *trace.Result) string {
+	for i := len(res.Hops) - 1; i >= 0; i-- {
+		if h := trace.PathHopAt(res, i); h != nil {
+			return h.Address.String()
+		}
+	}
+	return ""
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// asnGeo keeps an ASN the tool printed (AS13335, 13335) until enrichment
+// replaces it. Unknown markers such as AS??? are dropped.
+func asnGeo(raw string) *ipgeo.IPGeoData {
+	asn := strings.TrimSpace(raw)
+	if len(asn) > 2 && strings.EqualFold(asn[:2], "AS") {
+		asn = asn[2:]
+	}
+	if asn == "" || strings.Trim(asn, "0123456789") != "" {
+		return nil
+	}
+	return &ipgeo.IPGeoData{Asnumber: asn}
+}
@@ -0,0 +1,324 @@
+package traceimport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/internal/traceexport"
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/printer"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+const linuxTraceroute = `traceroute to example.com (93.184.216.34), 30 hops max, 60 byte packets
+ 1  _gateway (192.168.1.1)  0.512 ms  0.480 ms  0.470 ms
+ 2  * * *
+ 3  ae1.r01.example.net (198.51.100.1)  5.100 ms 198.51.100.2 (198.51.100.2)  6.000 ms !H  5.900 ms
+     MPLS Label=24012 CoS=0 TTL=1 S=1
+ 4  93.184.216.34  11.2 ms  11.0 ms  *
+`
+
+const windowsTracert = "\r\nTracing route to example.com [93.184.216.34]\r\n" +
+	"over a maximum of 30 hops:\r\n\r\n" +
+	"  1    <1 ms    <1 ms    <1 ms  192.168.1.1 \r\n" +
+	"  2     *        *        *     Request timed out.\r\n" +
+	"  3    12 ms    11 ms    13 ms  edge.example.net [198.51.100.1] \r\n" +
+	"  4    20 ms     *       21 ms  93.184.216.34 \r\n\r\nTrace complete.\r\n"
+
+const mtrJSON = `{"report":{"mtr":{"src":"probe-1","dst":"1.1.1.1","tos":0,"tests":10,"psize":"64","bitpattern":"0x00"},
+"hubs":[
+ {"count":1,"host":"192.168.1.1","ASN":"AS???","Loss%":0.00,"Snt":10,"Last":0.42,"Avg":0.45,"Best":0.38,"Wrst":0.57,"StDev":0.05},
+ {"count":"2","host":"???","ASN":"AS???","Loss%":"100.0","Snt":"10","Last":"0.0","Avg":"0.0","Best":"0.0","Wrst":"0.0","StDev":"0.0"},
+ {"count":3,"host":"one.one.one.one (1.1.1.1)","ASN":"AS13335","Loss%":10.0,"Snt":10,"Last":3.1,"Avg":3.2,"Best":3.0,"Wrst":3.9,"StDev":0.2}
+]}}`
+
+const mtrXML = `<?xml version="1.0"?>
+<MTR SRC="probe-1" DST="1.1.1.1" TOS="0x0" PSIZE="64" BITPATTERN="0x00" TESTS="10">
+    <HUB COUNT="1" HOST="192.168.1.1">
+        <Loss%>0.0%</Loss%>
+        <Snt>10</Snt>
+        <Last>0.4</Last>
+        <Avg>0.5</Avg>
+        <Best>0.4</Best>
+        <Wrst>0.6</Wrst>
+        <StDev>0.1</StDev>
+    </HUB>
+    <HUB COUNT="2" HOST="1.1.1.1">
+        <Loss%>20.0%</Loss%>
+        <Snt>10</Snt>
+        <Last>3.1</Last>
+        <Avg>3.2</Avg>
+        <Best>3.0</Best>
+        <Wrst>3.9</Wrst>
+        <StDev>0.2</StDev>
+    </HUB>
+</MTR>
+`
+
+const mtrCSV = `Mtr_Version,Start_Time,Status,Host,Hop,Ip,Asn,Loss%,Snt, ,Last,Avg,Best,Wrst,StDev,
+MTR.0.95,1700000000,OK,1.1.1.1,1,192.168.1.1,AS???,0.00,10,0,0.42,0.45,0.38,0.57,0.05,
+MTR.0.95,1700000000,OK,1.1.1.1,2,1.1.1.1,AS13335,50.00,10,0,3.10,3.20,3.00,3.90,0.20,
+`
+
+const atlasJSON = `[{"fw":5020,"type":"traceroute","msm_id":5001,"prb_id":6012,"dst_name":"k.root-servers.net","dst_addr":"193.0.14.129","src_addr":"10.0.0.5","proto":"ICMP","af":4,"size":48,"paris_id":1,"timestamp":1700000000,"endtime":1700000004,
+"result":[
+ {"hop":1,"result":[{"from":"10.0.0.1","rtt":1.2,"size":76,"ttl":64},{"from":"10.0.0.1","rtt":1.1,"size":76,"ttl":64},{"x":"*"}]},
+ {"hop":2,"result":[{"x":"*"},{"x":"*"},{"x":"*"}]},
+ {"hop":3,"result":[{"from":"198.51.100.1","rtt":5.5,"size":140,"ttl":253,"icmpext":{"version":2,"rfc4884":1,"obj":[{"class":1,"type":1,"mpls":[{"exp":0,"label":24012,"s":1,"ttl":1}]}]}}]},
+ {"hop":4,"result":[{"from":"193.0.14.129","rtt":9.9,"size":48,"ttl":60}]}
+]}]`
+
+func TestDetect(t *testing.T) {
+	for want, input := range map[Format]string{
+		FormatTraceroute: linuxTraceroute,
+		FormatTracert:    windowsTracert,
+		FormatMTRJSON:    mtrJSON,
+		FormatMTRXML:     mtrXML,
+		FormatMTRCSV:     mtrCSV,
+		FormatAtlas:      atlasJSON,
+		FormatPcap:       "\xd4\xc3\xb2\xa1\x02\x00\x04\x00",
+	} {
+		if got := Detect([]byte(input)); got != want {
+			t.Errorf("Detect(%s) = %q", want, got)
+		}
+	}
+	if got := Detect([]byte("\x0a\x0d\x0d\x0a\x1c\x00\x00\x00")); got != FormatPcap {
+		t.Errorf("Detect(pcapng) = %q", got)
+	}
+	if _, err := Parse([]byte("hello world\n")); err != ErrUnknownFormat {
+		t.Fatalf("Parse(free text) error = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestParseTraceroute(t *testing.T) {
+	imp, err := Parse([]byte(linuxTraceroute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imp.Format != FormatTraceroute || imp.Target != "example.com" || imp.TargetIP != "93.184.216.34" {
+		t.Fatalf("header = %+v", imp)
+	}
+	hops := imp.Result.Hops
+	if len(hops) != 4 {
+		t.Fatalf("TTLs = %d, want 4", len(hops))
+	}
+	if first := hops[0][0]; !first.Success || first.Hostname != "_gateway" || first.RTT != 512*time.Microsecond {
+		t.Fatalf("hop 1 = %+v", first)
+	}
+	if len(hops[1]) != 3 || hops[1][0].Success {
+		t.Fatalf("hop 2 = %+v, want three timeouts", hops[1])
+	}
+	third := hops[2]
+	if len(third) != 3 || third[0].Address.String() != "198.51.100.1" || third[1].Address.String() != "198.51.100.2" || third[2].Address.String() != "198.51.100.2" {
+		t.Fatalf("hop 3 = %+v, want RTTs bound to the address before them", third)
+	}
+	if len(third[2].MPLS) != 1 || third[2].MPLS[0] != "[MPLS: Lbl 24012, TC 0, S 1, TTL 1]" {
+		t.Fatalf("hop 3 MPLS = %q", third[2].MPLS)
+	}
+	if last := hops[3]; len(last) != 3 || !last[1].Success || last[2].Success || last[0].Hostname != "" {
+		t.Fatalf("hop 4 = %+v", last)
+	}
+
+	stats := imp.Stats()
+	if len(stats) == 0 || stats[0].IP != "192.168.1.1" || stats[0].Snt != 3 {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+}
+
+func TestParseTracert(t *testing.T) {
+	imp, err := Parse([]byte(windowsTracert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imp.Target != "example.com" || imp.TargetIP != "93.184.216.34" {
+		t.Fatalf("header = %q %q", imp.Target, imp.TargetIP)
+	}
+	hops := imp.Result.Hops
+	if len(hops) != 4 {
+		t.Fatalf("TTLs = %d, want 4", len(hops))
+	}
+	if h := hops[0][0]; !h.Success || h.RTT != time.Millisecond {
+		t.Fatalf("<1 ms hop = %+v", h)
+	}
+	if hops[1][0].Success || hops[1][0].Address != nil {
+		t.Fatalf("timed out hop = %+v", hops[1][0])
+	}
+	if h := hops[2][1]; h.Hostname != "edge.example.net" || h.Address.String() != "198.51.100.1" || h.RTT != 11*time.Millisecond {
+		t.Fatalf("named hop = %+v", h)
+	}
+	if hops[3][1].Success || !hops[3][2].Success {
+		t.Fatalf("partial hop = %+v", hops[3])
+	}
+}
+
+func TestParseMTRFormats(t *testing.T) {
+	for _, input := range []string{mtrJSON, mtrXML, mtrCSV} {
+		imp, err := Parse([]byte(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imp.Target != "1.1.1.1" || imp.TargetIP != "1.1.1.1" {
+			t.Fatalf("%s target = %q/%q", imp.Format, imp.Target, imp.TargetIP)
+		}
+		first := imp.MTR[0]
+		if first.TTL != 1 || first.IP != "192.168.1.1" || first.Snt != 10 || first.Received != 10 || first.Avg == 0 {
+			t.Fatalf("%s first row = %+v", imp.Format, first)
+		}
+		last := imp.MTR[len(imp.MTR)-1]
+		if last.IP != "1.1.1.1" || last.Loss == 0 || last.Received >= last.Snt {
+			t.Fatalf("%s last row = %+v", imp.Format, last)
+		}
+		if got := trace.PathHopAt(imp.Result, len(imp.Result.Hops)-1); got == nil || got.Address.String() != "1.1.1.1" {
+			t.Fatalf("%s result does not end at the target: %+v", imp.Format, imp.Result.Hops)
+		}
+	}
+
+	imp, _ := Parse([]byte(mtrJSON))
+	if imp.Source != "probe-1" {
+		t.Fatalf("Source = %q", imp.Source)
+	}
+	if imp.MTR[0].Geo != nil || imp.MTR[2].Geo == nil || imp.MTR[2].Geo.Asnumber != "13335" {
+		t.Fatalf("ASN column not kept: %+v / %+v", imp.MTR[0].Geo, imp.MTR[2].Geo)
+	}
+	if imp.MTR[1].IP != "" || imp.MTR[1].Loss != 100 {
+		t.Fatalf("??? row = %+v", imp.MTR[1])
+	}
+	if imp.MTR[2].Host != "one.one.one.one" {
+		t.Fatalf("mtr -b host = %q", imp.MTR[2].Host)
+	}
+}
+
+func TestEnrichKeepsASNWithoutSource(t *testing.T) {
+	imp, err := Parse([]byte(mtrCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp.Enrich(trace.Config{})
+	if geo := imp.MTR[1].Geo; geo == nil || geo.Asnumber != "13335" {
+		t.Fatalf("Geo = %+v, want the imported ASN", geo)
+	}
+	if h := trace.PathHopAt(imp.Result, 1); h == nil || h.Geo == nil || h.Geo.Asnumber != "13335" {
+		t.Fatalf("result hop = %+v, want geo copied from the row", h)
+	}
+}
+
+func TestEnrichKeepsASNWhenProviderHasNone(t *testing.T) {
+	imp, err := Parse([]byte(mtrCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp.Enrich(trace.Config{
+		Timeout: time.Second,
+		IPGeoSource: func(ip string, _ time.Duration, _ string, _ bool) (*ipgeo.IPGeoData, error) {
+			return &ipgeo.IPGeoData{IP: ip, Country: "Anycast"}, nil
+		},
+	})
+	geo := imp.MTR[1].Geo
+	if geo == nil || geo.Asnumber != "13335" || geo.Country != "Anycast" {
+		t.Fatalf("Geo = %+v, want provider data plus the imported ASN", geo)
+	}
+}
+
+func TestEnrichResultKeepsASNWhenProviderHasNone(t *testing.T) {
+	imp, err := Parse([]byte(atlasJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp.Result.Hops[3][0].Geo = &ipgeo.IPGeoData{Asnumber: "25152"}
+	imp.Enrich(trace.Config{
+		Timeout: time.Second,
+		IPGeoSource: func(ip string, _ time.Duration, _ string, _ bool) (*ipgeo.IPGeoData, error) {
+			return &ipgeo.IPGeoData{IP: ip, Country: "Netherlands"}, nil
+		},
+	})
+	geo := imp.Result.Hops[3][0].Geo
+	if geo == nil || geo.Asnumber != "25152" || geo.Country != "Netherlands" {
+		t.Fatalf("Geo = %+v, want provider data plus the imported ASN", geo)
+	}
+}
+
+func TestParseRejectsOutOfRangeTTL(t *testing.T) {
+	for name, input := range map[string]string{
+		"atlas":      `{"type":"traceroute","dst_addr":"192.0.2.1","result":[{"hop":2000000000,"result":[{"x":"*"}]}]}`,
+		"traceroute": "traceroute to 192.0.2.1 (192.0.2.1), 30 hops max\n 1  192.0.2.254  1.0 ms\n 256  192.0.2.1  2.0 ms\n",
+		"mtr-csv":    "Mtr_Version,Start_Time,Status,Host,Hop,Ip,Loss%,Snt, ,Last,Avg,Best,Wrst,StDev,\nMTR.0.95,1,OK,192.0.2.1,999999999,192.0.2.1,0.00,1,0,1.0,1.0,1.0,1.0,0.0\n",
+	} {
+		if _, err := Parse([]byte(input)); err == nil || !strings.Contains(err.Error(), "TTL must be between 1 and 255") {
+			t.Fatalf("%s: Parse() error = %v, want TTL range error", name, err)
+		}
+	}
+}
+
+func TestParseNextTraceMTRExports(t *testing.T) {
+	imp, err := Parse([]byte(mtrJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{printer.MTRFormatJSON, printer.MTRFormatXML, printer.MTRFormatCSV} {
+		var buf bytes.Buffer
+		if err := printer.WriteMTRReport(&buf, format, imp.MTR, printer.MTRExportOptions{SrcHost: "probe-1", Dst: "1.1.1.1", Tests: 10}); err != nil {
+			t.Fatal(err)
+		}
+		back, err := Parse(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(back.MTR) != len(imp.MTR) {
+			t.Fatalf("%s rows = %d, want %d", format, len(back.MTR), len(imp.MTR))
+		}
+		last := back.MTR[2]
+		if last.IP != "1.1.1.1" && last.Host != "one.one.one.one" {
+			t.Fatalf("%s last row = %+v", format, last)
+		}
+		if last.Geo == nil || last.Geo.Asnumber != "13335" || last.Snt != 10 || last.Loss != 10 {
+			t.Fatalf("%s last row = %+v (geo %+v)", format, last, last.Geo)
+		}
+	}
+}
+
+func TestParseAtlas(t *testing.T) {
+	imp, err := Parse([]byte(atlasJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imp.Format != FormatAtlas || imp.Target != "k.root-servers.net" || imp.TargetIP != "193.0.14.129" || imp.Source != "RIPE Atlas probe 6012" {
+		t.Fatalf("header = %+v", imp)
+	}
+	hops := imp.Result.Hops
+	if len(hops) != 4 || len(hops[0]) != 3 || hops[0][2].Success || hops[1][0].Success {
+		t.Fatalf("hops = %+v", hops)
+	}
+	if h := hops[2][0]; !h.Success || h.RTT != 5500*time.Microsecond || len(h.MPLS) != 1 || h.MPLS[0] != "[MPLS: Lbl 24012, TC 0, S 1, TTL 1]" {
+		t.Fatalf("hop 3 = %+v", h)
+	}
+	if h := hops[0][0]; h.ReplyTTL != 64 || h.ReturnHops != 1 || h.Asymmetric {
+		t.Fatalf("hop 1 return path = %+v", h)
+	}
+	if h := hops[3][0]; h.ReturnHops != 5 || h.Asymmetric {
+		t.Fatalf("hop 4 return path = %+v", h)
+	}
+}
+
+func TestParseNextTraceAtlasExport(t *testing.T) {
+	imp, err := Parse([]byte(linuxTraceroute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	meta := traceexport.Meta{Target: imp.Target, DstAddr: imp.TargetIP, Method: trace.UDPTrace}
+	if err := traceexport.Write(&buf, traceexport.FormatAtlas, imp.Result, meta); err != nil {
+		t.Fatal(err)
+	}
+	back, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Format != FormatAtlas || back.TargetIP != "93.184.216.34" || len(back.Result.Hops) != len(imp.Result.Hops) {
+		t.Fatalf("round trip = %+v", back)
+	}
+	if got := back.Result.Hops[2][2].MPLS; len(got) != 1 || got[0] != imp.Result.Hops[2][2].MPLS[0] {
+		t.Fatalf("MPLS = %q", got)
+	}
+}
@@ -0,0 +1,185 @@
+package traceimport
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+var (
+	tracerouteHeaderRe = regexp.MustCompile(`^traceroute6?\s+to\s+(\S+)(?:\s+\(([^)]+)\))?`)
+	numberedLineRe     = regexp.MustCompile(`^\s*(\d+)\s+(.*)$`)
+	mplsLineRe         = regexp.MustCompile(`^\s*MPLS\s+Label=(\d+)\s+CoS=(\d+)\s+TTL=(\d+)\s+S=(\d+)`)
+)
+
+// parseTraceroute reads the output of Linux, BSD and macOS traceroute,
+// numeric or not, including the extra responder lines BSD prints below a hop
+// and the MPLS label lines of traceroute -e.
+func parseTraceroute(data []byte) (*Import, error) {
+	imp := &Import{Result: &trace.Result{}}
+	ttl := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := tracerouteHeaderRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			imp.Target, imp.TargetIP = m[1], m[2]
+			continue
+		}
+		if m := mplsLineRe.FindStringSubmatch(line); m != nil {
+			if last := lastHop(imp.Result, ttl); last != nil {
+				last.MPLS = append(last.MPLS, trace.MPLSLabel{Label: atoi(m[1]), TC: atoi(m[2]), TTL: atoi(m[3]), S: atoi(m[4])}.String())
+			}
+			continue
+		}
+		body := ""
+		if m := numberedLineRe.FindStringSubmatch(line); m != nil {
+			n, err := strconv.Atoi(m[1])
+			if err != nil || n <= 0 {
+				continue
+			}
+			ttl, body = n, m[2]
+		} else if ttl > 0 && strings.TrimSpace(line) != "" && (line[0] == ' ' || line[0] == '\t') {
+			body = line
+		} else {
+			continue
+		}
+		for _, hop := range parseTracerouteProbes(ttl, body) {
+			if err := addHop(imp.Result, hop); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return imp, scanner.Err()
+}
+
+// parseTracerouteProbes walks "host (ip)  1.2 ms  1.3 ms ip2  1.5 ms *".
+// Each RTT belongs to the last address named before it.
+func parseTracerouteProbes(ttl int, body string) []trace.Hop {
+	var (
+		hops       []trace.Hop
+		host, addr string
+	)
+	fields := strings.Fields(body)
+	for i := 0; i < len(fields); i++ {
+		tok := fields[i]
+		switch {
+		case tok == "*":
+			hops = append(hops, trace.Hop{TTL: ttl})
+		case tok == "ms" || strings.HasPrefix(tok, "!") || strings.HasPrefix(tok, "[") || strings.HasPrefix(tok, "<"):
+			// unit, ICMP annotations such as !H, traceroute -A's [AS13335]
+			// and traceroute -e's inline <MPLS:L=...> labels
+		case strings.HasPrefix(tok, "(") && strings.HasSuffix(tok, ")"):
+			addr = strings.Trim(tok, "()")
+		default:
+			if rtt, ok := parseRTT(tok, fields, i); ok {
+				hops = append(hops, tracerouteHop(ttl, host, addr, rtt))
+				if !strings.HasSuffix(tok, "ms") {
+					i++
+				}
+				continue
+			}
+			host, addr = tok, ""
+			if net.ParseIP(tok) != nil {
+				host, addr = "", tok
+			}
+		}
+	}
+	return hops
+}
+
+// parseRTT accepts "1.234 ms" split over two fields and "1.234ms".
+func parseRTT(tok string, fields []string, i int) (float64, bool) {
+	if v, found := strings.CutSuffix(tok, "ms"); found {
+		rtt, err := strconv.ParseFloat(v, 64)
+		return rtt, err == nil
+	}
+	if i+1 >= len(fields) || fields[i+1] != "ms" {
+		return 0, false
+	}
+	rtt, err := strconv.ParseFloat(tok, 64)
+	return rtt, err == nil
+}
+
+func tracerouteHop(ttl int, host, addr string, rtt float64) trace.Hop {
+	hop := trace.Hop{TTL: ttl, RTT: msDuration(rtt)}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		ip = net.ParseIP(host)
+	}
+	if ip == nil {
+		return hop
+	}
+	hop.Success = true
+	hop.Address = &net.IPAddr{IP: ip}
+	if host != "" && net.ParseIP(host) == nil {
+		hop.Hostname = trace.CanonicalHostname(host)
+	}
+	return hop
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func lastHop(res *trace.Result, ttl int) *trace.Hop {
+	if ttl <= 0 || ttl > len(res.Hops) || len(res.Hops[ttl-1]) == 0 {
+		return nil
+	}
+	return &res.Hops[ttl-1][len(res.Hops[ttl-1])-1]
+}
+
+var (
+	tracertHeaderRe  = regexp.MustCompile(`(\S+)\s+\[([0-9A-Fa-f:.%]+)\]`)
+	tracertLineRe    = regexp.MustCompile(`^\s*(\d+)\s+(\*|<?\d+\s*ms)\s+(\*|<?\d+\s*ms)\s+(\*|<?\d+\s*ms)\s+(.*)$`)
+	tracertAddressRe = regexp.MustCompile(`^(\S+)\s+\[([^\]]+)\]`)
+	tracertRTTRe     = regexp.MustCompile(`^<?(\d+)\s*ms$`)
+)
+
+// parseTracert reads Windows tracert output. Only the column layout is
+// relied on, so localized headers and messages still parse; "<1 ms" is
+// recorded as 1 ms.
+func parseTracert(data []byte) (*Import, error) {
+	imp := &Import{Result: &trace.Result{}}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		m := tracertLineRe.FindStringSubmatch(line)
+		if m == nil {
+			if imp.Target == "" && len(imp.Result.Hops) == 0 {
+				if h := tracertHeaderRe.FindStringSubmatch(line); h != nil {
+					imp.Target, imp.TargetIP = h[1], h[2]
+				}
+			}
+			continue
+		}
+		ttl, err := strconv.Atoi(m[1])
+		if err != nil || ttl <= 0 {
+			continue
+		}
+		host, addr := "", ""
+		rest := strings.TrimSpace(m[5])
+		if a := tracertAddressRe.FindStringSubmatch(rest); a != nil {
+			host, addr = a[1], a[2]
+		} else if fields := strings.Fields(rest); len(fields) > 0 && net.ParseIP(fields[0]) != nil {
+			addr = fields[0]
+		}
+		for _, col := range m[2:5] {
+			r := tracertRTTRe.FindStringSubmatch(col)
+			hop := trace.Hop{TTL: ttl}
+			if r != nil && addr != "" {
+				rtt, _ := strconv.ParseFloat(r[1], 64)
+				hop = tracerouteHop(ttl, host, addr, rtt)
+			}
+			if err := addHop(imp.Result, hop); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return imp, scanner.Err()
+}
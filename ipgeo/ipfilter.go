@@ -104,3 +104,16 @@ func Filter(ip string) (*IPGeoData, bool) {
 
 	return nil, false
 }
+
+// ReservedWhois reports whether ip belongs to a reserved (RFC special-purpose)
+// or private range, returning the defining RFC.
+func ReservedWhois(ip string) (string, bool) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return "", false
+	}
+	if whois, ok := matchCIDRFilterRule(ip, reservedCIDRRules); ok {
+		return whois, true
+	}
+	return classifyPrivateIP(parsedIP, ip)
+}
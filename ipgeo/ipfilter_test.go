@@ -140,3 +140,23 @@ func TestFilter_IPv6_InvalidScope(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, "INVALID", geo.Whois)
 }
+
+// ──────── ReservedWhois ────────
+
+func TestReservedWhois(t *testing.T) {
+	for ip, want := range map[string]string{
+		"10.0.0.1":    "RFC1918",
+		"127.0.0.1":   "RFC1122",
+		"fd00::1":     "RFC4193",
+		"169.254.1.1": "RFC3927",
+		"::1":         "RFC4291",
+	} {
+		whois, ok := ReservedWhois(ip)
+		require.True(t, ok, "expected %s to be reserved", ip)
+		assert.Equal(t, want, whois, "ip=%s", ip)
+	}
+	for _, ip := range []string{"1.1.1.1", "2606:4700::1111", "11.0.0.1", "notanip"} {
+		_, ok := ReservedWhois(ip)
+		assert.False(t, ok, "ip=%s", ip)
+	}
+}
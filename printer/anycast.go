@@ -0,0 +1,68 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// PrintAnycastSite 打印推断出的 anycast 站点及各条线索
+func PrintAnycastSite(s trace.AnycastSite) {
+	writeAnycastSite(os.Stdout, s)
+}
+
+func writeAnycastSite(w io.Writer, s trace.AnycastSite) {
+	switch {
+	case s.Site != "":
+		_, _ = fmt.Fprintf(w, "Anycast site: %s, inferred from %s\n", s.Site, s.Source)
+	default:
+		_, _ = fmt.Fprintln(w, "Anycast site: unknown, no identity answer or hints")
+	}
+	if s.Identity != nil && s.Identity.Value() == "" && s.Identity.Error != "" {
+		_, _ = fmt.Fprintf(w, "DNS identity query: %s\n", s.Identity.Error)
+	}
+	if len(s.Hints) == 0 {
+		return
+	}
+	tbl := table.New("Hint", "Hop", "Value", "Site")
+	tbl.WithHeaderFormatter(color.New(color.FgGreen, color.Underline).SprintfFunc()).
+		WithFirstColumnFormatter(color.New(color.FgYellow).SprintfFunc()).
+		WithWriter(w)
+	for _, h := range s.Hints {
+		hop, site := "-", "-"
+		if h.TTL > 0 {
+			hop = fmt.Sprint(h.TTL)
+		}
+		if h.Site != "" {
+			site = h.Site
+		}
+		tbl.AddRow(h.Source, hop, h.Value, site)
+	}
+	tbl.Print()
+}
+
+// PrintAnycastCatchment 打印 MTR 过程中的站点切换
+func PrintAnycastCatchment(c *trace.AnycastCatchment) {
+	writeAnycastCatchment(os.Stdout, c)
+}
+
+func writeAnycastCatchment(w io.Writer, c *trace.AnycastCatchment) {
+	flips := c.Flips()
+	if len(flips) == 0 {
+		_, _ = fmt.Fprintf(w, "Catchment: no flips (%d identity answers)\n", c.Samples())
+		return
+	}
+	_, _ = fmt.Fprintf(w, "Catchment: %d flips (%d identity answers)\n", len(flips), c.Samples())
+	for _, f := range flips {
+		signal := "identity"
+		if f.Signal == "return_hops" {
+			signal = "return hops"
+		}
+		_, _ = fmt.Fprintf(w, "  %s round %d: %s %s -> %s\n", f.Time.Format("15:04:05"), f.Round, signal, f.From, f.To)
+	}
+}
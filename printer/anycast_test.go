@@ -0,0 +1,55 @@
+package printer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestWriteAnycastSiteAndCatchment(t *testing.T) {
+	prevNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prevNoColor }()
+
+	var buf bytes.Buffer
+	writeAnycastSite(&buf, trace.AnycastSite{
+		Target: "example.com",
+		Site:   "b4.fra",
+		Source: "hostname.bind",
+		Hints: []trace.AnycastHint{
+			{Source: "hostname.bind", Value: "b4.fra"},
+			{Source: "ptr", TTL: 9, Value: "ae-1.fra01.example.net", Site: "fra (Frankfurt)"},
+		},
+	})
+	writeAnycastSite(&buf, trace.AnycastSite{Identity: &trace.AnycastIdentity{Error: "i/o timeout"}})
+
+	var c trace.AnycastCatchment
+	dst := net.ParseIP("192.0.2.53")
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.ObserveIdentity(at, 1, trace.AnycastIdentity{HostnameBind: "b4.fra"})
+	c.ObserveIdentity(at, 2, trace.AnycastIdentity{HostnameBind: "b4.ams"})
+	c.ObserveStats(at, 2, dst, []trace.MTRHopStat{{IP: "192.0.2.53", ReturnHops: 4}})
+	c.ObserveStats(at, 3, dst, []trace.MTRHopStat{{IP: "192.0.2.53", ReturnHops: 6}})
+	writeAnycastCatchment(&buf, &c)
+
+	out := buf.String()
+	for _, want := range []string{
+		"Anycast site: b4.fra, inferred from hostname.bind",
+		"ptr            9    ae-1.fra01.example.net  fra (Frankfurt)",
+		"Anycast site: unknown, no identity answer or hints",
+		"DNS identity query: i/o timeout",
+		"Catchment: 2 flips (2 identity answers)",
+		"03:04:05 round 2: identity b4.fra -> b4.ams",
+		"round 3: return hops 4 -> 6",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// PrintDualStackComparison 打印 IPv4 与 IPv6 路径的汇总、逐跳对照与结论
+func PrintDualStackComparison(c *trace.DualStackComparison) {
+	writeDualStackComparison(os.Stdout, c)
+}
+
+func writeDualStackComparison(w io.Writer, c *trace.DualStackComparison) {
+	_, _ = fmt.Fprintf(w, "Dual-stack comparison: %s\n", c.Target)
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	summary := table.New("Family", "Address", "Hops", "RTT", "Loss", "AS path")
+	summary.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWriter(w)
+	for _, s := range []trace.DualStackSide{c.IPv4, c.IPv6} {
+		name := "IPv4"
+		if s.Family == "ipv6" {
+			name = "IPv6"
+		}
+		switch {
+		case s.Error != "":
+			summary.AddRow(name, s.IP, "-", "-", "-", s.Error)
+		case s.Reached:
+			summary.AddRow(name, s.IP, s.HopCount, fmt.Sprintf("%.2f ms", s.RTTMs), fmt.Sprintf("%.0f%%", s.LossPct), dualStackASPath(s.ASPath))
+		default:
+			summary.AddRow(name, s.IP, fmt.Sprintf("%d (not reached)", s.HopCount), "*", "100%", dualStackASPath(s.ASPath))
+		}
+	}
+	summary.Print()
+
+	if c.IPv4.Result != nil && c.IPv6.Result != nil {
+		_, _ = fmt.Fprintln(w)
+		hops := table.New("Hop", "IPv4", "ASN", "RTT", "IPv6", "ASN", "RTT")
+		hops.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWriter(w)
+		n := max(c.IPv4.HopCount, c.IPv6.HopCount)
+		for i := 0; i < n; i++ {
+			v4 := dualStackHopCells(c.IPv4, i)
+			v6 := dualStackHopCells(c.IPv6, i)
+			hops.AddRow(i+1, v4[0], v4[1], v4[2], v6[0], v6[1], v6[2])
+		}
+		hops.Print()
+	}
+	for _, line := range c.Verdict {
+		_, _ = fmt.Fprintf(w, "Verdict: %s\n", line)
+	}
+}
+
+// dualStackHopCells 为一侧第 i 跳的地址、ASN 与时延；HopCount 之后（到达目标或不再有应答）留空
+func dualStackHopCells(s trace.DualStackSide, i int) [3]string {
+	if i >= s.HopCount {
+		return [3]string{"", "", ""}
+	}
+	h := trace.PathHopAt(s.Result, i)
+	if h == nil {
+		return [3]string{"*", "", ""}
+	}
+	asn := "-"
+	if v := trace.PathHopASN(h); v != "" {
+		asn = "AS" + v
+	}
+	return [3]string{h.Address.String(), asn, fmt.Sprintf("%.2f ms", trace.PathHopRTT(h))}
+}
+
+func dualStackASPath(path []string) string {
+	if len(path) == 0 {
+		return "-"
+	}
+	return "AS" + strings.Join(path, " AS")
+}
@@ -0,0 +1,43 @@
+package printer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestWriteDualStackComparison(t *testing.T) {
+	prevNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prevNoColor }()
+
+	hop := func(ip, asn string) []trace.Hop {
+		return []trace.Hop{{Success: true, Address: &net.IPAddr{IP: net.ParseIP(ip)}, Geo: &ipgeo.IPGeoData{Asnumber: asn}}}
+	}
+	v4 := &trace.Result{Hops: [][]trace.Hop{hop("10.0.0.1", "64512"), hop("192.0.2.1", "13335")}}
+	v6 := &trace.Result{Hops: [][]trace.Hop{hop("fd00::1", "64512"), {{}}, {{}}}}
+	cmp := trace.CompareDualStack("example.com",
+		trace.DualStackSideFromResult(net.ParseIP("192.0.2.1"), v4),
+		trace.DualStackSideFromResult(net.ParseIP("2001:db8::1"), v6))
+
+	var buf bytes.Buffer
+	writeDualStackComparison(&buf, cmp)
+	out := buf.String()
+	for _, want := range []string{
+		"Dual-stack comparison: example.com",
+		"AS64512 AS13335",
+		"1 (not reached)",
+		"192.0.2.1  AS13335",
+		"Verdict: only IPv4 reaches the destination; IPv6's last reply is at hop 1",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
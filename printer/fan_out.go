@@ -0,0 +1,54 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// PrintFanOutReport 打印各解析器的应答、按时延排名的各地址路径与结论
+func PrintFanOutReport(r *trace.FanOutReport) {
+	writeFanOutReport(os.Stdout, r)
+}
+
+func writeFanOutReport(w io.Writer, r *trace.FanOutReport) {
+	_, _ = fmt.Fprintf(w, "Fan-out: %s (%d addresses)\n", r.Target, len(r.Paths))
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	resolvers := table.New("Resolver", "Addresses")
+	resolvers.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWriter(w)
+	for _, res := range r.Resolvers {
+		if res.Error != "" {
+			resolvers.AddRow(res.Name, "failed: "+res.Error)
+			continue
+		}
+		resolvers.AddRow(res.Name, strings.Join(res.Addresses, ", "))
+	}
+	resolvers.Print()
+	_, _ = fmt.Fprintln(w)
+
+	paths := table.New("Rank", "Address", "Resolvers", "Hops", "RTT", "Loss", "AS path")
+	paths.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWriter(w)
+	for _, p := range r.Paths {
+		by := strings.Join(p.Resolvers, ", ")
+		switch {
+		case p.Error != "":
+			paths.AddRow(p.Rank, p.IP, by, "-", "-", "-", p.Error)
+		case p.Reached:
+			paths.AddRow(p.Rank, p.IP, by, p.HopCount, fmt.Sprintf("%.2f ms", p.RTTMs), fmt.Sprintf("%.0f%%", p.LossPct), dualStackASPath(p.ASPath))
+		default:
+			paths.AddRow(p.Rank, p.IP, by, fmt.Sprintf("%d (not reached)", p.HopCount), "*", "100%", dualStackASPath(p.ASPath))
+		}
+	}
+	paths.Print()
+	for _, line := range r.Verdict {
+		_, _ = fmt.Fprintf(w, "Verdict: %s\n", line)
+	}
+}
@@ -0,0 +1,50 @@
+package printer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestWriteFanOutReport(t *testing.T) {
+	prevNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prevNoColor }()
+
+	reached := &trace.Result{Hops: [][]trace.Hop{{{
+		Success: true,
+		Address: &net.IPAddr{IP: net.ParseIP("192.0.2.1")},
+		Geo:     &ipgeo.IPGeoData{Asnumber: "13335"},
+	}}}}
+	r := trace.NewFanOutReport("example.com",
+		[]trace.FanOutResolver{
+			{Name: "system", Addresses: []string{"192.0.2.1", "192.0.2.2"}},
+			{Name: "google", Error: "i/o timeout"},
+		},
+		[]trace.DualStackSide{
+			trace.DualStackSideFromResult(net.ParseIP("192.0.2.2"), &trace.Result{Hops: [][]trace.Hop{{{}}}}),
+			trace.DualStackSideFromResult(net.ParseIP("192.0.2.1"), reached),
+		})
+
+	var buf bytes.Buffer
+	writeFanOutReport(&buf, r)
+	out := buf.String()
+	for _, want := range []string{
+		"Fan-out: example.com (2 addresses)",
+		"192.0.2.1, 192.0.2.2",
+		"failed: i/o timeout",
+		"1     192.0.2.1  system",
+		"0 (not reached)",
+		"Verdict: only 192.0.2.1 reaches it: 0.00 ms, 1 hops",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
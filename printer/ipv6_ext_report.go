@@ -0,0 +1,39 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// PrintIPv6ExtReport 打印扩展头探测与对照探测的逐跳对比与结论
+func PrintIPv6ExtReport(r trace.IPv6ExtReport) {
+	writeIPv6ExtReport(os.Stdout, r)
+}
+
+func writeIPv6ExtReport(w io.Writer, r trace.IPv6ExtReport) {
+	_, _ = fmt.Fprintf(w, "IPv6 extension header check: %s against a baseline without them\n", r.Headers)
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Hop", "Baseline", "With headers")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWriter(w)
+	for _, h := range r.Hops {
+		tbl.AddRow(h.TTL, orStar(h.Baseline), orStar(h.WithExt))
+	}
+	tbl.Print()
+	for _, line := range r.Verdict {
+		_, _ = fmt.Fprintf(w, "Verdict: %s\n", line)
+	}
+}
+
+func orStar(addr string) string {
+	if addr == "" {
+		return "*"
+	}
+	return addr
+}
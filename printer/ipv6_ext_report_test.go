@@ -0,0 +1,37 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestWriteIPv6ExtReport(t *testing.T) {
+	prevNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prevNoColor }()
+
+	var buf bytes.Buffer
+	writeIPv6ExtReport(&buf, trace.IPv6ExtReport{
+		Headers: "HBH(8)",
+		Hops: []trace.IPv6ExtHopCheck{
+			{TTL: 1, Baseline: "2001:db8::1", WithExt: "2001:db8::1"},
+			{TTL: 2, Baseline: "2001:db8::2"},
+		},
+		Verdict: []string{"packets with HBH(8) stop being forwarded after hop 1 (2001:db8::1)"},
+	})
+	out := buf.String()
+	for _, want := range []string{
+		"IPv6 extension header check: HBH(8) against a baseline without them",
+		"2001:db8::2  *",
+		"Verdict: packets with HBH(8) stop being forwarded after hop 1 (2001:db8::1)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
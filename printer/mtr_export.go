@@ -0,0 +1,293 @@
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// MTR report output formats. Text is MTRReportPrint; the others follow
+// mtr --json, --xml and --csv.
+const (
+	MTRFormatText = "text"
+	MTRFormatJSON = "json"
+	MTRFormatXML  = "xml"
+	MTRFormatCSV  = "csv"
+)
+
+// MTRReportFormats lists the values accepted by WriteMTRReport.
+var MTRReportFormats = []string{MTRFormatText, MTRFormatJSON, MTRFormatXML, MTRFormatCSV}
+
+// MTRExportOptions carries the run parameters mtr writes into its report
+// header.
+type MTRExportOptions struct {
+	StartTime  time.Time
+	SrcHost    string
+	Dst        string
+	TOS        int
+	PacketSize int
+	Tests      int
+	ShowIPs    bool
+	Lang       string
+	Version    string
+}
+
+// MTRExportGeo is the "nexttrace" extension block attached to every hub.
+// mtr consumers ignore it; it carries what our providers know about the hop.
+type MTRExportGeo struct {
+	IP       string   `json:"ip,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+	ASN      string   `json:"asn,omitempty"`
+	Country  string   `json:"country,omitempty"`
+	Prov     string   `json:"prov,omitempty"`
+	City     string   `json:"city,omitempty"`
+	Owner    string   `json:"owner,omitempty"`
+	Prefix   string   `json:"prefix,omitempty"`
+	Lat      float64  `json:"lat,omitempty"`
+	Lng      float64  `json:"lng,omitempty"`
+	MPLS     []string `json:"mpls,omitempty"`
+
+	ReplyTTL   int  `json:"reply_ttl,omitempty"`
+	ReturnHops int  `json:"return_hops,omitempty"`
+	Asymmetric bool `json:"asymmetric,omitempty"`
+}
+
+// WriteMTRReport writes stats in one of the mtr formats. The text report is
+// printed by MTRReportPrint instead.
+func WriteMTRReport(w io.Writer, format string, stats []trace.MTRHopStat, opts MTRExportOptions) error {
+	switch format {
+	case MTRFormatJSON:
+		return WriteMTRJSON(w, stats, opts)
+	case MTRFormatXML:
+		return WriteMTRXML(w, stats, opts)
+	case MTRFormatCSV:
+		return WriteMTRCSV(w, stats, opts)
+	}
+	return fmt.Errorf("unsupported MTR report format %q", format)
+}
+
+type mtrJSONReport struct {
+	Report struct {
+		MTR struct {
+			Src        string `json:"src"`
+			Dst        string `json:"dst"`
+			TOS        int    `json:"tos"`
+			Tests      int    `json:"tests"`
+			PSize      string `json:"psize"`
+			BitPattern string `json:"bitpattern"`
+		} `json:"mtr"`
+		Hubs []mtrJSONHub `json:"hubs"`
+	} `json:"report"`
+}
+
+type mtrJSONHub struct {
+	Count     int           `json:"count"`
+	Host      string        `json:"host"`
+	ASN       string        `json:"ASN"`
+	Loss      json.Number   `json:"Loss%"`
+	Snt       int           `json:"Snt"`
+	Last      json.Number   `json:"Last"`
+	Avg       json.Number   `json:"Avg"`
+	Best      json.Number   `json:"Best"`
+	Wrst      json.Number   `json:"Wrst"`
+	StDev     json.Number   `json:"StDev"`
+	NextTrace *MTRExportGeo `json:"nexttrace,omitempty"`
+}
+
+// WriteMTRJSON writes the layout of mtr --json -z: four-space indentation and
+// reals with five significant digits, as jansson prints them.
+func WriteMTRJSON(w io.Writer, stats []trace.MTRHopStat, opts MTRExportOptions) error {
+	var doc mtrJSONReport
+	doc.Report.MTR.Src = opts.SrcHost
+	doc.Report.MTR.Dst = opts.Dst
+	doc.Report.MTR.TOS = opts.TOS
+	doc.Report.MTR.Tests = opts.Tests
+	doc.Report.MTR.PSize = mtrExportPSize(opts.PacketSize)
+	doc.Report.MTR.BitPattern = "0x00"
+	doc.Report.Hubs = make([]mtrJSONHub, 0, len(stats))
+	for _, s := range stats {
+		doc.Report.Hubs = append(doc.Report.Hubs, mtrJSONHub{
+			Count:     s.TTL,
+			Host:      mtrExportHost(s, opts.ShowIPs),
+			ASN:       mtrExportASN(s.Geo),
+			Loss:      mtrJSONReal(s.Loss),
+			Snt:       s.Snt,
+			Last:      mtrJSONReal(s.Last),
+			Avg:       mtrJSONReal(s.Avg),
+			Best:      mtrJSONReal(s.Best),
+			Wrst:      mtrJSONReal(s.Wrst),
+			StDev:     mtrJSONReal(s.StDev),
+			NextTrace: mtrExportGeo(s, opts.Lang),
+		})
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// mtrJSONReal formats v like jansson's JSON_REAL_PRECISION(5): %.5g with a
+// trailing ".0" on whole numbers.
+func mtrJSONReal(v float64) json.Number {
+	s := strconv.FormatFloat(v, 'g', 5, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return json.Number(s)
+}
+
+// WriteMTRXML writes the layout of mtr --xml, including its padded values
+// and unescaped "Loss%" element names. Geo data goes into a self-closing
+// <NEXTTRACE> element per hub.
+func WriteMTRXML(w io.Writer, stats []trace.MTRHopStat, opts MTRExportOptions) error {
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\"?>\n")
+	fmt.Fprintf(&b, "<MTR SRC=\"%s\" DST=\"%s\" TOS=\"0x%X\" PSIZE=\"%s\" BITPATTERN=\"0x00\" TESTS=\"%d\">\n",
+		html.EscapeString(opts.SrcHost), html.EscapeString(opts.Dst), opts.TOS, mtrExportPSize(opts.PacketSize), opts.Tests)
+	for _, s := range stats {
+		fmt.Fprintf(&b, "    <HUB COUNT=\"%d\" HOST=\"%s\">\n", s.TTL, html.EscapeString(mtrExportHost(s, opts.ShowIPs)))
+		fmt.Fprintf(&b, "        <Loss%%>%4.1f%%</Loss%%>\n", s.Loss)
+		fmt.Fprintf(&b, "        <Snt>%5d</Snt>\n", s.Snt)
+		for _, f := range []struct {
+			name  string
+			value float64
+		}{{"Last", s.Last}, {"Avg", s.Avg}, {"Best", s.Best}, {"Wrst", s.Wrst}, {"StDev", s.StDev}} {
+			fmt.Fprintf(&b, "        <%s>%5.1f</%s>\n", f.name, f.value, f.name)
+		}
+		if geo := mtrExportGeo(s, opts.Lang); geo != nil {
+			b.WriteString("        <NEXTTRACE")
+			for _, a := range [][2]string{
+				{"IP", geo.IP}, {"HOSTNAME", geo.Hostname}, {"ASN", geo.ASN}, {"COUNTRY", geo.Country},
+				{"PROV", geo.Prov}, {"CITY", geo.City}, {"OWNER", geo.Owner}, {"PREFIX", geo.Prefix},
+				{"MPLS", strings.Join(geo.MPLS, "; ")},
+				{"REPLY_TTL", mtrXMLCount(geo.ReplyTTL)}, {"RETURN_HOPS", mtrXMLCount(geo.ReturnHops)},
+				{"ASYMMETRIC", mtrXMLFlag(geo.Asymmetric)},
+			} {
+				if a[1] != "" {
+					fmt.Fprintf(&b, " %s=\"%s\"", a[0], html.EscapeString(a[1]))
+				}
+			}
+			b.WriteString("/>\n")
+		}
+		b.WriteString("    </HUB>\n")
+	}
+	b.WriteString("</MTR>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mtrXMLCount and mtrXMLFlag leave unknown values out of the NEXTTRACE
+// element.
+func mtrXMLCount(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func mtrXMLFlag(b bool) string {
+	if !b {
+		return ""
+	}
+	return "1"
+}
+
+// mtrCSVExtraColumns follow mtr's own columns so readers that index by
+// header name keep working.
+var mtrCSVExtraColumns = []string{"NT_Hostname", "NT_Country", "NT_Prov", "NT_City", "NT_Owner", "NT_Prefix"}
+
+// WriteMTRCSV writes the layout of mtr --csv -z, including the unnamed " "
+// column, followed by the NT_* geo columns.
+func WriteMTRCSV(w io.Writer, stats []trace.MTRHopStat, opts MTRExportOptions) error {
+	var b strings.Builder
+	b.WriteString("Mtr_Version,Start_Time,Status,Host,Hop,Ip,Asn,Loss%,Snt, ,Last,Avg,Best,Wrst,StDev,")
+	b.WriteString(strings.Join(mtrCSVExtraColumns, ",") + ",\n")
+	version := "NextTrace." + opts.Version
+	for _, s := range stats {
+		fmt.Fprintf(&b, "%s,%d,OK,%s,%d,%s,%s,%.2f,%d,0,%.2f,%.2f,%.2f,%.2f,%.2f",
+			mtrCSVField(version), opts.StartTime.Unix(), mtrCSVField(opts.Dst), s.TTL,
+			mtrCSVField(mtrExportHost(s, opts.ShowIPs)), mtrExportASN(s.Geo),
+			s.Loss, s.Snt, s.Last, s.Avg, s.Best, s.Wrst, s.StDev)
+		geo := mtrExportGeo(s, opts.Lang)
+		if geo == nil {
+			geo = &MTRExportGeo{}
+		}
+		for _, v := range []string{geo.Hostname, geo.Country, geo.Prov, geo.City, geo.Owner, geo.Prefix} {
+			b.WriteString("," + mtrCSVField(v))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mtrCSVField quotes values that would break the row; mtr itself never
+// quotes, so plain values stay byte-identical.
+func mtrCSVField(v string) string {
+	if !strings.ContainsAny(v, ",\"\r\n") {
+		return v
+	}
+	return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+}
+
+// mtrExportPSize renders a negative (random) --psize the way mtr does.
+func mtrExportPSize(size int) string {
+	if size < 0 {
+		return fmt.Sprintf("rand(%d)", -size)
+	}
+	return strconv.Itoa(size)
+}
+
+// mtrExportHost mirrors mtr's host column: the PTR name, "name (ip)" with
+// --show-ips (mtr -b), the address without a name, and ??? for no reply.
+func mtrExportHost(s trace.MTRHopStat, showIPs bool) string {
+	switch {
+	case s.Host != "" && s.IP != "" && showIPs:
+		return s.Host + " (" + s.IP + ")"
+	case s.Host != "":
+		return s.Host
+	case s.IP != "":
+		return s.IP
+	}
+	return "???"
+}
+
+func mtrExportASN(geo *ipgeo.IPGeoData) string {
+	if label := mtrASNLabel(geo); label != "" {
+		return label
+	}
+	return "AS???"
+}
+
+func mtrExportGeo(s trace.MTRHopStat, lang string) *MTRExportGeo {
+	if s.IP == "" && s.Host == "" {
+		return nil
+	}
+	out := &MTRExportGeo{
+		IP: s.IP, Hostname: s.Host, MPLS: s.MPLS,
+		ReplyTTL: s.ReplyTTL, ReturnHops: s.ReturnHops, Asymmetric: s.Asymmetric,
+	}
+	if g := s.Geo; g != nil && g.Source != trace.PendingGeoSource {
+		out.ASN = g.Asnumber
+		out.Country = geoField(g.Country, g.CountryEn, lang)
+		out.Prov = geoField(g.Prov, g.ProvEn, lang)
+		out.City = geoField(g.City, g.CityEn, lang)
+		out.Owner = mtrGeoOwner(g)
+		out.Prefix = g.Prefix
+		out.Lat, out.Lng = g.Lat, g.Lng
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package printer
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func mtrExportFixture() ([]trace.MTRHopStat, MTRExportOptions) {
+	stats := []trace.MTRHopStat{
+		{TTL: 1, IP: "192.168.1.1", Snt: 10, Received: 10, Last: 0.42, Avg: 0.45, Best: 0.38, Wrst: 0.57, StDev: 0.05},
+		{TTL: 2, Loss: 100, Snt: 10},
+		{TTL: 3, Host: "one.one.one.one", IP: "1.1.1.1", Loss: 10, Snt: 10, Received: 9, Last: 3.1, Avg: 3.2, Best: 3, Wrst: 3.9, StDev: 0.2,
+			Geo: &ipgeo.IPGeoData{Asnumber: "13335", Country: "美国", CountryEn: "United States", Owner: "Cloudflare, Inc."}},
+	}
+	return stats, MTRExportOptions{
+		StartTime:  time.Unix(1700000000, 0),
+		SrcHost:    "probe-1",
+		Dst:        "one.one.one.one",
+		PacketSize: 64,
+		Tests:      10,
+		Lang:       "en",
+		Version:    "v1.0.0",
+	}
+}
+
+func TestWriteMTRJSON(t *testing.T) {
+	stats, opts := mtrExportFixture()
+	var buf bytes.Buffer
+	if err := WriteMTRJSON(&buf, stats, opts); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"{\n    \"report\": {\n        \"mtr\": {\n            \"src\": \"probe-1\",",
+		`"psize": "64",`,
+		`"Loss%": 0.0,`,
+		`"Last": 0.42,`,
+		`"host": "???",`,
+		`"ASN": "AS13335",`,
+		`"owner": "Cloudflare, Inc."`,
+		`"country": "United States"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	var doc struct {
+		Report struct {
+			Hubs []map[string]any `json:"hubs"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Report.Hubs) != 3 || doc.Report.Hubs[1]["nexttrace"] != nil {
+		t.Fatalf("hubs = %+v, want no extension on the silent hop", doc.Report.Hubs)
+	}
+}
+
+func TestWriteMTRXML(t *testing.T) {
+	stats, opts := mtrExportFixture()
+	opts.ShowIPs = true
+	var buf bytes.Buffer
+	if err := WriteMTRXML(&buf, stats, opts); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<MTR SRC=\"probe-1\" DST=\"one.one.one.one\" TOS=\"0x0\" PSIZE=\"64\" BITPATTERN=\"0x00\" TESTS=\"10\">\n",
+		"    <HUB COUNT=\"1\" HOST=\"192.168.1.1\">\n        <Loss%> 0.0%</Loss%>\n        <Snt>   10</Snt>\n        <Last>  0.4</Last>\n",
+		`<HUB COUNT="3" HOST="one.one.one.one (1.1.1.1)">`,
+		`<NEXTTRACE IP="1.1.1.1" HOSTNAME="one.one.one.one" ASN="13335" COUNTRY="United States" OWNER="Cloudflare, Inc."/>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteMTRCSV(t *testing.T) {
+	stats, opts := mtrExportFixture()
+	var buf bytes.Buffer
+	if err := WriteMTRCSV(&buf, stats, opts); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("lines = %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "Mtr_Version,Start_Time,Status,Host,Hop,Ip,Asn,Loss%,Snt, ,Last,Avg,Best,Wrst,StDev,NT_") {
+		t.Fatalf("header = %q", lines[0])
+	}
+	if want := "NextTrace.v1.0.0,1700000000,OK,one.one.one.one,1,192.168.1.1,AS???,0.00,10,0,0.42,0.45,0.38,0.57,0.05,,,,,,"; lines[1] != want {
+		t.Fatalf("row 1 = %q, want %q", lines[1], want)
+	}
+	if !strings.HasSuffix(lines[3], `,AS13335,10.00,10,0,3.10,3.20,3.00,3.90,0.20,one.one.one.one,United States,,,"Cloudflare, Inc.",`) {
+		t.Fatalf("row 3 = %q", lines[3])
+	}
+}
+
+func TestWriteMTRReportRejectsText(t *testing.T) {
+	stats, opts := mtrExportFixture()
+	if err := WriteMTRReport(&bytes.Buffer{}, MTRFormatText, stats, opts); err == nil {
+		t.Fatal("text format accepted")
+	}
+}
@@ -283,11 +283,13 @@ func buildMTRHostParts(s trace.MTRHopStat, mode int, nameMode int, lang string,
 	}
 
 	parts := mtrHostParts{base: formatMTRHostBase(s, nameMode, showIPs)}
-	if mode == HostModeBase || s.Geo == nil {
-		return parts
+	if mode != HostModeBase && s.Geo != nil {
+		parts.asn = mtrASNLabel(s.Geo)
+		parts.extras = mtrGeoExtras(s.Geo, mode, lang)
+	}
+	if s.Asymmetric {
+		parts.extras = append(parts.extras, fmt.Sprintf("(asym ret %d)", s.ReturnHops))
 	}
-	parts.asn = mtrASNLabel(s.Geo)
-	parts.extras = mtrGeoExtras(s.Geo, mode, lang)
 	return parts
 }
 
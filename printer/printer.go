@@ -49,6 +49,9 @@ func HopPrinter(h trace.Hop, info HopInfo) {
 		for _, v := range h.MPLS {
 			txt += " " + v
 		}
+		if rp := formatReturnPath(h); rp != "" {
+			txt += " " + rp
+		}
 		switch info {
 		case IXP:
 			fmt.Print(CYAN_PREFIX)
@@ -68,6 +71,46 @@ func HopPrinter(h trace.Hop, info HopInfo) {
 	}
 }
 
+// formatReturnPath 给出正向与回程跳数，如 "[fwd 5 / ret 7 asym]"；
+// 回包 TTL 未知时返回空串
+func formatReturnPath(h trace.Hop) string {
+	if h.ReturnHops <= 0 {
+		return ""
+	}
+	if h.Asymmetric {
+		return fmt.Sprintf("[fwd %d / ret %d asym]", h.TTL, h.ReturnHops)
+	}
+	return fmt.Sprintf("[fwd %d / ret %d]", h.TTL, h.ReturnHops)
+}
+
+// PrintTCPDestinationReply 报告目标对 TCP 探测的应答：SYN-ACK、RST 或无应答
+func PrintTCPDestinationReply(profile, reply string) {
+	var txt string
+	switch reply {
+	case trace.TCPReplySynAck:
+		txt = "destination answered SYN-ACK"
+	case trace.TCPReplyRST:
+		txt = "destination answered RST"
+	default:
+		txt = "no TCP answer from the destination"
+	}
+	fmt.Printf("TCP probe [%s]: %s\n", profile, txt)
+}
+
+// PrintSCTPDestinationReply 报告目标对 SCTP INIT 探测的应答：INIT-ACK、ABORT 或无应答
+func PrintSCTPDestinationReply(reply string) {
+	var txt string
+	switch reply {
+	case trace.SCTPReplyInitAck:
+		txt = "destination answered INIT-ACK"
+	case trace.SCTPReplyAbort:
+		txt = "destination answered ABORT"
+	default:
+		txt = "no SCTP answer from the destination"
+	}
+	fmt.Printf("SCTP probe: %s\n", txt)
+}
+
 func FormatIPGeoData(ip string, data *ipgeo.IPGeoData) string {
 	var res = make([]string, 0, 10)
 	if data.Source == "timeout" {
@@ -146,6 +146,18 @@ func printHopMPLS(labels []string) {
 	}
 }
 
+func printHopReturnPath(hop *trace.Hop) {
+	rp := formatReturnPath(*hop)
+	if rp == "" {
+		return
+	}
+	style := color.New(color.FgHiBlack, color.Bold)
+	if hop.Asymmetric {
+		style = color.New(color.FgHiYellow, color.Bold)
+	}
+	fmt.Fprintf(color.Output, " %s", style.Sprint(rp))
+}
+
 func renderRealtimeHopLine(res *trace.Result, ttl int, group hoprender.Group, blockDisplay bool) {
 	if blockDisplay {
 		fmt.Printf("%4s", "")
@@ -164,6 +176,7 @@ func renderRealtimeHopLine(res *trace.Result, ttl int, group hoprender.Group, bl
 	}
 	printLocationLine(hop, group.IP, isIPv6)
 	printTimingSeries(group.Timings)
+	printHopReturnPath(hop)
 	printHopMPLS(hop.MPLS)
 	fmt.Println()
 }
@@ -191,5 +204,6 @@ func renderRouterHopLine(res *trace.Result, ttl int, group hoprender.Group, bloc
 	}
 	printLocationLine(hop, group.IP, isIPv6)
 	printTimingSeries(group.Timings)
+	printHopReturnPath(hop)
 	fmt.Println()
 }
@@ -17,6 +17,7 @@ type rowData struct {
 	Hop      string
 	IP       string
 	Latency  string
+	Return   string
 	Asnumber string
 	Country  string
 	Prov     string
@@ -35,14 +36,14 @@ func writeTracerouteTable(w io.Writer, res *trace.Result, clearScreen bool) {
 				data.Hop = ""
 			}
 			if data.Country == "" && data.Prov == "" && data.City == "" {
-				tbl.AddRow(data.Hop, data.IP, data.Latency, data.Asnumber, "", data.Owner)
+				tbl.AddRow(data.Hop, data.IP, data.Latency, data.Return, data.Asnumber, "", data.Owner)
 			} else {
 				if data.City != "" {
-					tbl.AddRow(data.Hop, data.IP, data.Latency, data.Asnumber, data.City+", "+data.Prov+", "+data.Country, data.Owner)
+					tbl.AddRow(data.Hop, data.IP, data.Latency, data.Return, data.Asnumber, data.City+", "+data.Prov+", "+data.Country, data.Owner)
 				} else if data.Prov != "" {
-					tbl.AddRow(data.Hop, data.IP, data.Latency, data.Asnumber, data.Prov+", "+data.Country, data.Owner)
+					tbl.AddRow(data.Hop, data.IP, data.Latency, data.Return, data.Asnumber, data.Prov+", "+data.Country, data.Owner)
 				} else {
-					tbl.AddRow(data.Hop, data.IP, data.Latency, data.Asnumber, data.Country, data.Owner)
+					tbl.AddRow(data.Hop, data.IP, data.Latency, data.Return, data.Asnumber, data.Country, data.Owner)
 				}
 
 			}
@@ -64,7 +65,7 @@ func New() table.Table {
 	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 	columnFmt := color.New(color.FgYellow).SprintfFunc()
 
-	tbl := table.New("Hop", "IP", "Latency", "ASN", "Location", "Owner")
+	tbl := table.New("Hop", "IP", "Latency", "Return", "ASN", "Location", "Owner")
 	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
 	return tbl
 }
@@ -78,12 +79,20 @@ func tableDataGenerator(h trace.Hop) *rowData {
 	} else {
 		latency := fmt.Sprintf("%.2fms", h.RTT.Seconds()*1000)
 		IP := h.Address.String()
+		ret := ""
+		if h.ReturnHops > 0 {
+			ret = fmt.Sprint(h.ReturnHops)
+			if h.Asymmetric {
+				ret += " asym"
+			}
+		}
 
 		if strings.HasPrefix(IP, "9.") {
 			return &rowData{
 				Hop:     fmt.Sprint(h.TTL),
 				IP:      IP,
 				Latency: latency,
+				Return:  ret,
 				Country: "LAN Address",
 				Prov:    "",
 				Owner:   "",
@@ -93,6 +102,7 @@ func tableDataGenerator(h trace.Hop) *rowData {
 				Hop:     fmt.Sprint(h.TTL),
 				IP:      IP,
 				Latency: latency,
+				Return:  ret,
 				Country: "LAN Address",
 				Prov:    "",
 				Owner:   "",
@@ -115,6 +125,7 @@ func tableDataGenerator(h trace.Hop) *rowData {
 			Hop:      fmt.Sprint(h.TTL),
 			IP:       IP,
 			Latency:  latency,
+			Return:   ret,
 			Asnumber: h.Geo.Asnumber,
 			Country:  h.Geo.CountryEn,
 			Prov:     h.Geo.ProvEn,
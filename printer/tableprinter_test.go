@@ -65,3 +65,20 @@ func TestWriteTracerouteTableTTYIncludesClearScreenANSI(t *testing.T) {
 		t.Fatalf("output should start with clear-screen ANSI:\n%q", output)
 	}
 }
+
+func TestWriteTracerouteTableShowsReturnHops(t *testing.T) {
+	prevNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prevNoColor }()
+
+	res := testTracerouteTableResult()
+	res.Hops[0][0].SetReplyTTL(251)
+	var buf bytes.Buffer
+	writeTracerouteTable(&buf, res, false)
+	if output := buf.String(); !strings.Contains(output, "Return") || !strings.Contains(output, "5 asym") {
+		t.Fatalf("output missing the return hop count:\n%q", output)
+	}
+	if got := formatReturnPath(res.Hops[0][0]); got != "[fwd 1 / ret 5 asym]" {
+		t.Fatalf("formatReturnPath() = %q", got)
+	}
+}
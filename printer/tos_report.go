@@ -0,0 +1,41 @@
+package printer
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+// PrintTOSReport 打印 DSCP / ECN 透传检查的逐跳表格与结论
+func PrintTOSReport(r trace.TOSReport) {
+	writeTOSReport(os.Stdout, r)
+}
+
+func writeTOSReport(w io.Writer, r trace.TOSReport) {
+	_, _ = fmt.Fprintf(w, "DSCP/ECN check: sent DSCP %s, ECN %s\n", trace.DSCPName(r.SentDSCP), trace.ECNName(r.SentECN))
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Hop", "IP", "DSCP", "ECN")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWriter(w)
+	for _, h := range r.Hops {
+		switch {
+		case h.Address == "":
+			tbl.AddRow(h.TTL, "*", "", "")
+		case !h.Quoted:
+			tbl.AddRow(h.TTL, h.Address, "no quotation", "")
+		default:
+			tbl.AddRow(h.TTL, h.Address,
+				fmt.Sprintf("%s %s", trace.DSCPName(h.DSCP), h.DSCPStatus),
+				fmt.Sprintf("%s %s", trace.ECNName(h.ECN), h.ECNStatus))
+		}
+	}
+	tbl.Print()
+	for _, line := range r.Verdict {
+		_, _ = fmt.Fprintf(w, "Verdict: %s\n", line)
+	}
+}
@@ -0,0 +1,43 @@
+package printer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func TestWriteTOSReport(t *testing.T) {
+	prevNoColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = prevNoColor }()
+
+	var buf bytes.Buffer
+	writeTOSReport(&buf, trace.TOSReport{
+		SentDSCP: 46,
+		SentECN:  trace.ECNECT0,
+		Hops: []trace.TOSHopCheck{
+			{TTL: 1, Address: "192.0.2.1", Quoted: true, DSCP: 46, ECN: trace.ECNECT0, DSCPStatus: trace.TOSKept, ECNStatus: trace.TOSKept},
+			{TTL: 2},
+			{TTL: 3, Address: "192.0.2.3", Quoted: true, DSCP: 0, ECN: trace.ECNNotECT, DSCPStatus: trace.TOSBleached, ECNStatus: trace.ECNCleared},
+			{TTL: 4, Address: "198.51.100.9", Destination: true},
+		},
+		Verdict: []string{"DSCP EF (46) bleached to CS0 (0) at hop 3 (192.0.2.3)"},
+	})
+	out := buf.String()
+	for _, want := range []string{
+		"DSCP/ECN check: sent DSCP EF (46), ECN ECT(0)",
+		"EF (46) kept",
+		"CS0 (0) bleached",
+		"Not-ECT cleared",
+		"no quotation",
+		"Verdict: DSCP EF (46) bleached to CS0 (0) at hop 3 (192.0.2.3)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+}
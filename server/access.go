@@ -0,0 +1,451 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/nxtrace/NTrace-core/config"
+	"github.com/nxtrace/NTrace-core/internal/service"
+)
+
+const (
+	scopeTrace   = "trace"
+	scopeMTR     = "mtr"
+	scopeMTU     = "mtu"
+	scopeSpeed   = "speed"
+	scopeGeo     = "geo"
+	scopeMCP     = "mcp"
+	scopeHistory = "history"
+	scopeAdmin   = "admin"
+)
+
+var deployScopes = []string{scopeTrace, scopeMTR, scopeMTU, scopeSpeed, scopeGeo, scopeMCP, scopeHistory, scopeAdmin}
+
+const legacyDeployTokenName = "default"
+
+// TokenConfig describes one named deploy token. Either Token or TokenSHA256
+// (hex digest of the token) must be set.
+type TokenConfig struct {
+	Name              string   `mapstructure:"name"`
+	Token             string   `mapstructure:"token"`
+	TokenSHA256       string   `mapstructure:"token_sha256"`
+	Scopes            []string `mapstructure:"scopes"`
+	RequestsPerMinute int      `mapstructure:"requests_per_minute"`
+	ProbesPerHour     int      `mapstructure:"probes_per_hour"`
+	ExpiresAt         string   `mapstructure:"expires_at"`
+}
+
+// AccessConfig is the "deploy" section of nt_config.yaml, or the content of a
+// --deploy-tokens file.
+type AccessConfig struct {
+	Tokens   []TokenConfig        `mapstructure:"tokens"`
+	AuditLog string               `mapstructure:"audit_log"`
+	Policy   service.PolicyConfig `mapstructure:"policy"`
+	History  HistoryConfig        `mapstructure:"history"`
+}
+
+// LoadAccessConfig reads named deploy tokens from path. An empty path falls
+// back to the "deploy" section of nt_config.yaml when one exists. Files may
+// hold the fields at top level or under a "deploy" key.
+func LoadAccessConfig(path string) (AccessConfig, error) {
+	path = strings.TrimSpace(path)
+	v, err := config.Load(path)
+	if err != nil || v == nil {
+		return AccessConfig{}, err
+	}
+	return decodeAccessConfig(v, path == "")
+}
+
+func decodeAccessConfig(v *viper.Viper, sectionOnly bool) (AccessConfig, error) {
+	var cfg AccessConfig
+	if sectionOnly && !v.IsSet("deploy") {
+		return cfg, nil
+	}
+	if v.IsSet("deploy") {
+		if err := v.UnmarshalKey("deploy", &cfg); err != nil {
+			return AccessConfig{}, fmt.Errorf("decode deploy section: %w", err)
+		}
+		return cfg, nil
+	}
+	if err := v.Unmarshal(&cfg); err != nil {
+		return AccessConfig{}, fmt.Errorf("decode deploy tokens: %w", err)
+	}
+	return cfg, nil
+}
+
+type deployPrincipal struct {
+	Name      string
+	scopes    map[string]struct{}
+	expiresAt time.Time
+	quota     *deployQuota
+}
+
+func (p *deployPrincipal) hasScope(scope string) bool {
+	if p == nil || scope == "" {
+		return true
+	}
+	_, ok := p.scopes[scope]
+	return ok
+}
+
+func (p *deployPrincipal) expired(now time.Time) bool {
+	return p != nil && !p.expiresAt.IsZero() && !now.Before(p.expiresAt)
+}
+
+type deployTokenEntry struct {
+	digest    [sha256.Size]byte
+	cookie    string
+	principal *deployPrincipal
+}
+
+type deployTokenRegistry struct {
+	entries []deployTokenEntry
+}
+
+func newDeployTokenRegistry(tokens []TokenConfig) (*deployTokenRegistry, error) {
+	reg := &deployTokenRegistry{}
+	seen := make(map[string]struct{}, len(tokens))
+	for i, tc := range tokens {
+		name := strings.TrimSpace(tc.Name)
+		if name == "" {
+			return nil, fmt.Errorf("deploy token #%d: name is required", i+1)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("deploy token %q: duplicate name", name)
+		}
+		seen[name] = struct{}{}
+
+		digest, err := tokenConfigDigest(tc)
+		if err != nil {
+			return nil, fmt.Errorf("deploy token %q: %w", name, err)
+		}
+		scopes, err := normalizeDeployScopes(tc.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("deploy token %q: %w", name, err)
+		}
+		expiresAt, err := parseTokenExpiry(tc.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("deploy token %q: %w", name, err)
+		}
+		if tc.RequestsPerMinute < 0 || tc.ProbesPerHour < 0 {
+			return nil, fmt.Errorf("deploy token %q: quotas must not be negative", name)
+		}
+		reg.entries = append(reg.entries, deployTokenEntry{
+			digest: digest,
+			cookie: namedDeployCookieValue(name),
+			principal: &deployPrincipal{
+				Name:      name,
+				scopes:    scopes,
+				expiresAt: expiresAt,
+				quota:     newDeployQuota(tc.RequestsPerMinute, tc.ProbesPerHour),
+			},
+		})
+	}
+	return reg, nil
+}
+
+func tokenConfigDigest(tc TokenConfig) ([sha256.Size]byte, error) {
+	var digest [sha256.Size]byte
+	token := strings.TrimSpace(tc.Token)
+	hashed := strings.TrimSpace(tc.TokenSHA256)
+	switch {
+	case token != "" && hashed != "":
+		return digest, errors.New("set either token or token_sha256, not both")
+	case token != "":
+		return sha256.Sum256([]byte(token)), nil
+	case hashed != "":
+		raw, err := hex.DecodeString(hashed)
+		if err != nil || len(raw) != sha256.Size {
+			return digest, errors.New("token_sha256 must be a 64-character hex digest")
+		}
+		copy(digest[:], raw)
+		return digest, nil
+	default:
+		return digest, errors.New("token or token_sha256 is required")
+	}
+}
+
+func normalizeDeployScopes(raw []string) (map[string]struct{}, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	scopes := make(map[string]struct{}, len(raw))
+	for _, scope := range raw {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "*" || scope == "all" {
+			for _, s := range deployScopes {
+				scopes[s] = struct{}{}
+			}
+			continue
+		}
+		if !contains(deployScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q (supported: %s)", scope, strings.Join(deployScopes, ", "))
+		}
+		scopes[scope] = struct{}{}
+	}
+	return scopes, nil
+}
+
+func parseTokenExpiry(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, raw, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expires_at %q (want RFC3339 or YYYY-MM-DD)", raw)
+}
+
+func (r *deployTokenRegistry) size() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.entries)
+}
+
+// lookup compares the presented token against every entry so the timing does
+// not reveal which name matched.
+func (r *deployTokenRegistry) lookup(token string) *deployPrincipal {
+	token = strings.TrimSpace(token)
+	if r == nil || token == "" {
+		return nil
+	}
+	got := sha256.Sum256([]byte(token))
+	var found *deployPrincipal
+	for i := range r.entries {
+		if subtle.ConstantTimeCompare(got[:], r.entries[i].digest[:]) == 1 {
+			found = r.entries[i].principal
+		}
+	}
+	return found
+}
+
+func (r *deployTokenRegistry) lookupCookie(value string) *deployPrincipal {
+	if r == nil {
+		return nil
+	}
+	var found *deployPrincipal
+	for i := range r.entries {
+		if deployTokenMatches(value, r.entries[i].cookie) {
+			found = r.entries[i].principal
+		}
+	}
+	return found
+}
+
+func (r *deployTokenRegistry) byName(name string) *deployPrincipal {
+	if r == nil {
+		return nil
+	}
+	for i := range r.entries {
+		if r.entries[i].principal.Name == name {
+			return r.entries[i].principal
+		}
+	}
+	return nil
+}
+
+func (r *deployTokenRegistry) cookieFor(p *deployPrincipal) string {
+	if r == nil {
+		return ""
+	}
+	for i := range r.entries {
+		if r.entries[i].principal == p {
+			return r.entries[i].cookie
+		}
+	}
+	return ""
+}
+
+func newLegacyDeployPrincipal() *deployPrincipal {
+	scopes := make(map[string]struct{}, len(deployScopes))
+	for _, s := range deployScopes {
+		scopes[s] = struct{}{}
+	}
+	return &deployPrincipal{Name: legacyDeployTokenName, scopes: scopes, quota: newDeployQuota(0, 0)}
+}
+
+// deployQuota enforces fixed-window request and probe budgets. Zero disables
+// the corresponding limit.
+type deployQuota struct {
+	mu                sync.Mutex
+	requestsPerMinute int
+	probesPerHour     int
+	requestWindow     time.Time
+	requests          int
+	probeWindow       time.Time
+	probes            int
+}
+
+func newDeployQuota(requestsPerMinute, probesPerHour int) *deployQuota {
+	return &deployQuota{requestsPerMinute: requestsPerMinute, probesPerHour: probesPerHour}
+}
+
+func (q *deployQuota) allowRequest(now time.Time) bool {
+	if q == nil || q.requestsPerMinute <= 0 {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if now.Sub(q.requestWindow) >= time.Minute {
+		q.requestWindow = now
+		q.requests = 0
+	}
+	if q.requests >= q.requestsPerMinute {
+		return false
+	}
+	q.requests++
+	return true
+}
+
+func (q *deployQuota) allowProbe(now time.Time) bool {
+	if q == nil || q.probesPerHour <= 0 {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if now.Sub(q.probeWindow) >= time.Hour {
+		q.probeWindow = now
+		q.probes = 0
+	}
+	if q.probes >= q.probesPerHour {
+		return false
+	}
+	q.probes++
+	return true
+}
+
+// deployAccessError carries the HTTP status for scope and quota rejections.
+type deployAccessError struct {
+	Status  int
+	Message string
+}
+
+func (e *deployAccessError) Error() string {
+	return e.Message
+}
+
+func deployAccessStatus(err error, fallback int) int {
+	var accessErr *deployAccessError
+	if errors.As(err, &accessErr) {
+		return accessErr.Status
+	}
+	return fallback
+}
+
+// deployCaller is attached to every request context by the auth middleware.
+// principal is nil when deploy auth is disabled.
+type deployCaller struct {
+	principal *deployPrincipal
+	remote    string
+	audit     *auditLogger
+	now       func() time.Time
+}
+
+type deployCallerKey struct{}
+
+func withDeployCaller(ctx context.Context, caller *deployCaller) context.Context {
+	return context.WithValue(ctx, deployCallerKey{}, caller)
+}
+
+func deployCallerFromContext(ctx context.Context) *deployCaller {
+	if ctx == nil {
+		return nil
+	}
+	caller, _ := ctx.Value(deployCallerKey{}).(*deployCaller)
+	return caller
+}
+
+func (c *deployCaller) tokenName() string {
+	if c == nil || c.principal == nil {
+		return ""
+	}
+	return c.principal.Name
+}
+
+// enforced reports whether the caller carries a token or an audit sink.
+func (c *deployCaller) enforced() bool {
+	return c != nil && (c.principal != nil || c.audit != nil)
+}
+
+func (c *deployCaller) currentTime() time.Time {
+	if c != nil && c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// authorize checks that the caller holds scope and, for probe-generating
+// actions, consumes one unit of the token's probe quota.
+func (c *deployCaller) authorize(scope string, probe bool) error {
+	if c == nil || c.principal == nil {
+		return nil
+	}
+	if !c.principal.hasScope(scope) {
+		return &deployAccessError{Status: http.StatusForbidden, Message: fmt.Sprintf("token %q lacks scope %q", c.principal.Name, scope)}
+	}
+	if probe && !c.principal.quota.allowProbe(c.currentTime()) {
+		return &deployAccessError{Status: http.StatusTooManyRequests, Message: fmt.Sprintf("token %q probe quota exceeded", c.principal.Name)}
+	}
+	return nil
+}
+
+func (c *deployCaller) record(action, target string, params any, err error) {
+	if c == nil || c.audit == nil {
+		return
+	}
+	rec := auditRecord{
+		Time:    c.currentTime().UTC(),
+		Token:   c.tokenName(),
+		Remote:  c.remote,
+		Action:  action,
+		Target:  target,
+		Params:  params,
+		Outcome: auditOutcomeOK,
+	}
+	if err != nil {
+		rec.Outcome = auditOutcomeError
+		var accessErr *deployAccessError
+		var policyErr *service.PolicyError
+		if errors.As(err, &accessErr) || errors.As(err, &policyErr) {
+			rec.Outcome = auditOutcomeDenied
+		}
+		rec.Error = err.Error()
+	}
+	c.audit.log(rec)
+}
+
+func deployRouteScope(path string) string {
+	switch path {
+	case "/api/trace":
+		return scopeTrace
+	case "/api/cache/clear":
+		return scopeAdmin
+	case "/api/map":
+		return scopeGeo
+	case "/mcp":
+		return scopeMCP
+	}
+	if path == "/api/history" || strings.HasPrefix(path, "/api/history/") || path == "/api/share" || strings.HasPrefix(path, "/api/share/") {
+		return scopeHistory
+	}
+	return ""
+}
+
+func deployRouteMetered(path string) bool {
+	return strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/ws/") || path == "/mcp"
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newNamedTokenTestAuth(t *testing.T, tokens []TokenConfig, audit *auditLogger) deployAuth {
+	t.Helper()
+	reg, err := newDeployTokenRegistry(tokens)
+	if err != nil {
+		t.Fatalf("newDeployTokenRegistry() error = %v", err)
+	}
+	return deployAuth{Enabled: true, Tokens: reg, Audit: audit}
+}
+
+func newScopedTestRouter(auth deployAuth) *gin.Engine {
+	router := newDeployAuthTestRouter(auth)
+	router.POST("/api/trace", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	router.POST("/api/cache/clear", cacheClearHandler)
+	return router
+}
+
+func serveWithToken(router http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(context.Background(), method, path, nil)
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestNewDeployTokenRegistryValidatesEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []TokenConfig
+		want   string
+	}{
+		{"missing name", []TokenConfig{{Token: "a", Scopes: []string{"trace"}}}, "name is required"},
+		{"duplicate", []TokenConfig{{Name: "a", Token: "a", Scopes: []string{"trace"}}, {Name: "a", Token: "b", Scopes: []string{"trace"}}}, "duplicate"},
+		{"missing secret", []TokenConfig{{Name: "a", Scopes: []string{"trace"}}}, "token or token_sha256"},
+		{"both secrets", []TokenConfig{{Name: "a", Token: "a", TokenSHA256: strings.Repeat("0", 64), Scopes: []string{"trace"}}}, "not both"},
+		{"bad digest", []TokenConfig{{Name: "a", TokenSHA256: "abc", Scopes: []string{"trace"}}}, "64-character"},
+		{"no scopes", []TokenConfig{{Name: "a", Token: "a"}}, "at least one scope"},
+		{"unknown scope", []TokenConfig{{Name: "a", Token: "a", Scopes: []string{"root"}}}, "unknown scope"},
+		{"bad expiry", []TokenConfig{{Name: "a", Token: "a", Scopes: []string{"trace"}, ExpiresAt: "tomorrow"}}, "expires_at"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newDeployTokenRegistry(tt.tokens)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeployTokenRegistryLookupSupportsHashedTokens(t *testing.T) {
+	sum := sha256.Sum256([]byte("hashed-secret"))
+	reg, err := newDeployTokenRegistry([]TokenConfig{
+		{Name: "plain", Token: "plain-secret", Scopes: []string{"trace"}},
+		{Name: "hashed", TokenSHA256: hex.EncodeToString(sum[:]), Scopes: []string{"all"}},
+	})
+	if err != nil {
+		t.Fatalf("newDeployTokenRegistry() error = %v", err)
+	}
+	if p := reg.lookup("plain-secret"); p == nil || p.Name != "plain" {
+		t.Fatalf("lookup(plain) = %+v", p)
+	}
+	p := reg.lookup("hashed-secret")
+	if p == nil || p.Name != "hashed" {
+		t.Fatalf("lookup(hashed) = %+v", p)
+	}
+	for _, scope := range deployScopes {
+		if !p.hasScope(scope) {
+			t.Fatalf("all-scope token lacks %q", scope)
+		}
+	}
+	if reg.lookup("wrong") != nil {
+		t.Fatal("lookup(wrong) returned a principal")
+	}
+	// token_sha256 alone must not be enough to forge a session cookie.
+	if reg.lookupCookie(deployCookieValue(hex.EncodeToString(sum[:]))) != nil {
+		t.Fatal("cookie derived from token_sha256 accepted")
+	}
+	if got := reg.lookupCookie(namedDeployCookieValue("hashed")); got == nil || got.Name != "hashed" {
+		t.Fatalf("lookupCookie(session) = %+v", got)
+	}
+}
+
+func TestDeployAuthNamedTokenScopes(t *testing.T) {
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "tracer", Token: "trace-secret", Scopes: []string{"trace"}},
+		{Name: "ops", Token: "ops-secret", Scopes: []string{"trace", "admin"}},
+	}, nil)
+	router := newScopedTestRouter(auth)
+
+	if resp := serveWithToken(router, http.MethodPost, "/api/trace", "trace-secret"); resp.Code != http.StatusOK {
+		t.Fatalf("trace scope status = %d, want 200", resp.Code)
+	}
+	if resp := serveWithToken(router, http.MethodPost, "/api/cache/clear", "trace-secret"); resp.Code != http.StatusForbidden {
+		t.Fatalf("cache clear without admin status = %d, want 403", resp.Code)
+	}
+	if resp := serveWithToken(router, http.MethodPost, "/api/cache/clear", "ops-secret"); resp.Code != http.StatusOK {
+		t.Fatalf("cache clear with admin status = %d, want 200", resp.Code)
+	}
+	if resp := serveWithToken(router, http.MethodGet, "/mcp", "trace-secret"); resp.Code != http.StatusForbidden {
+		t.Fatalf("mcp without mcp scope status = %d, want 403", resp.Code)
+	}
+}
+
+func TestDeployRouteScope(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/trace":       scopeTrace,
+		"/api/cache/clear": scopeAdmin,
+		"/api/map":         scopeGeo,
+		"/mcp":             scopeMCP,
+		"/api/history":     scopeHistory,
+		"/api/history/abc": scopeHistory,
+		"/api/share":       scopeHistory,
+		"/api/options":     "",
+	} {
+		if got := deployRouteScope(path); got != want {
+			t.Errorf("deployRouteScope(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestDeployAuthNamedTokenExpiry(t *testing.T) {
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "old", Token: "old-secret", Scopes: []string{"trace"}, ExpiresAt: "2000-01-01T00:00:00Z"},
+	}, nil)
+	router := newScopedTestRouter(auth)
+
+	resp := serveWithToken(router, http.MethodGet, "/api/options", "old-secret")
+	if resp.Code != http.StatusUnauthorized || !strings.Contains(resp.Body.String(), "expired") {
+		t.Fatalf("expired token status = %d body=%s, want 401 expired", resp.Code, resp.Body.String())
+	}
+}
+
+func TestDeployAuthNamedTokenRateLimit(t *testing.T) {
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "limited", Token: "limited-secret", Scopes: []string{"trace"}, RequestsPerMinute: 2},
+	}, nil)
+	router := newScopedTestRouter(auth)
+
+	for i := 0; i < 2; i++ {
+		if resp := serveWithToken(router, http.MethodGet, "/api/options", "limited-secret"); resp.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i+1, resp.Code)
+		}
+	}
+	if resp := serveWithToken(router, http.MethodGet, "/api/options", "limited-secret"); resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request status = %d, want 429", resp.Code)
+	}
+	if resp := serveWithToken(router, http.MethodGet, "/", "limited-secret"); resp.Code != http.StatusOK {
+		t.Fatalf("static route status = %d, want 200 (not metered)", resp.Code)
+	}
+}
+
+func TestDeployAuthNamedTokenLoginCookie(t *testing.T) {
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "web", Token: "web-secret", Scopes: []string{"trace"}},
+	}, nil)
+	router := newScopedTestRouter(auth)
+
+	loginResp := httptest.NewRecorder()
+	loginReq := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/auth/login", strings.NewReader(`{"token":"web-secret"}`))
+	loginReq.Header.Set("Content-Type", "application/json")
+	loginReq.Header.Set("Accept", "application/json")
+	router.ServeHTTP(loginResp, loginReq)
+	if loginResp.Code != http.StatusOK {
+		t.Fatalf("login status = %d, want 200", loginResp.Code)
+	}
+	cookie := findDeployAuthCookie(t, loginResp.Result().Cookies())
+	if strings.Contains(cookie.Value, "web-secret") {
+		t.Fatal("cookie must not embed the raw token")
+	}
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/api/trace", nil)
+	req.Header.Set("Accept", "application/json")
+	req.AddCookie(cookie)
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("cookie trace status = %d, want 200", resp.Code)
+	}
+}
+
+func TestDeployCallerProbeQuota(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	caller := &deployCaller{
+		principal: &deployPrincipal{Name: "q", scopes: map[string]struct{}{scopeTrace: {}}, quota: newDeployQuota(0, 1)},
+		now:       func() time.Time { return now },
+	}
+	if err := caller.authorize(scopeTrace, true); err != nil {
+		t.Fatalf("first probe error = %v", err)
+	}
+	err := caller.authorize(scopeTrace, true)
+	if deployAccessStatus(err, 0) != http.StatusTooManyRequests {
+		t.Fatalf("second probe error = %v, want 429", err)
+	}
+	if err := caller.authorize(scopeTrace, false); err != nil {
+		t.Fatalf("non-probe action error = %v, want nil", err)
+	}
+	now = now.Add(time.Hour)
+	if err := caller.authorize(scopeTrace, true); err != nil {
+		t.Fatalf("probe after window reset error = %v", err)
+	}
+	if err := caller.authorize(scopeMTR, false); deployAccessStatus(err, 0) != http.StatusForbidden {
+		t.Fatalf("missing scope error = %v, want 403", err)
+	}
+}
+
+func TestDeployCallerRecordWritesAuditLines(t *testing.T) {
+	var buf bytes.Buffer
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "tracer", Token: "trace-secret", Scopes: []string{"trace"}},
+	}, newAuditLogger(&buf))
+	router := newScopedTestRouter(auth)
+
+	serveWithToken(router, http.MethodPost, "/api/cache/clear", "trace-secret")
+
+	var rec auditRecord
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &rec); err != nil {
+		t.Fatalf("audit line %q: %v", buf.String(), err)
+	}
+	if rec.Token != "tracer" || rec.Action != "/api/cache/clear" || rec.Outcome != auditOutcomeDenied {
+		t.Fatalf("audit record = %+v", rec)
+	}
+}
+
+func TestLoadAccessConfigReadsDeploySectionAndTopLevel(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "nested.yaml")
+	if err := os.WriteFile(nested, []byte("deploy:\n  audit_log: /tmp/audit.jsonl\n  tokens:\n    - name: a\n      token: s\n      scopes: [trace, mtr]\n      probes_per_hour: 5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	flat := filepath.Join(dir, "flat.yaml")
+	if err := os.WriteFile(flat, []byte("tokens:\n  - name: b\n    token: t\n    scopes: [geo]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadAccessConfig(nested)
+	if err != nil {
+		t.Fatalf("LoadAccessConfig(nested) error = %v", err)
+	}
+	if cfg.AuditLog != "/tmp/audit.jsonl" || len(cfg.Tokens) != 1 || cfg.Tokens[0].ProbesPerHour != 5 || len(cfg.Tokens[0].Scopes) != 2 {
+		t.Fatalf("nested config = %+v", cfg)
+	}
+	cfg, err = LoadAccessConfig(flat)
+	if err != nil {
+		t.Fatalf("LoadAccessConfig(flat) error = %v", err)
+	}
+	if len(cfg.Tokens) != 1 || cfg.Tokens[0].Name != "b" {
+		t.Fatalf("flat config = %+v", cfg)
+	}
+}
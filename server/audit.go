@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	auditOutcomeOK     = "ok"
+	auditOutcomeError  = "error"
+	auditOutcomeDenied = "denied"
+)
+
+// auditRecord is one JSON line in the deploy audit log.
+type auditRecord struct {
+	Time    time.Time `json:"time"`
+	Token   string    `json:"token,omitempty"`
+	Remote  string    `json:"remote,omitempty"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target,omitempty"`
+	Params  any       `json:"params,omitempty"`
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type auditLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func newAuditLogger(w io.Writer) *auditLogger {
+	if w == nil {
+		return nil
+	}
+	return &auditLogger{w: w, enc: json.NewEncoder(w)}
+}
+
+func openAuditLog(path string) (*auditLogger, io.Closer, error) {
+	if path == "" {
+		return nil, nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return newAuditLogger(f), f, nil
+}
+
+func (l *auditLogger) log(rec auditRecord) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(rec); err != nil {
+		log.Printf("[deploy] audit log write failed: %v", err)
+	}
+}
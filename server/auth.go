@@ -1,12 +1,15 @@
 package server
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"html"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,29 +19,58 @@ const deployAuthCookieName = "nexttrace_deploy_auth"
 type deployAuth struct {
 	Enabled bool
 	Token   string
+	Tokens  *deployTokenRegistry
+	Audit   *auditLogger
+	// ClientCerts accepts verified mTLS client certificates as credentials.
+	ClientCerts bool
 }
 
 func (a deployAuth) tokenConfigured() bool {
-	return strings.TrimSpace(a.Token) != ""
+	return strings.TrimSpace(a.Token) != "" || a.Tokens.size() > 0 || a.ClientCerts
 }
 
 func deployAuthMiddleware(auth deployAuth) gin.HandlerFunc {
+	legacy := newLegacyDeployPrincipal()
 	return func(c *gin.Context) {
-		if !auth.Enabled || c.Request.Method == http.MethodOptions || isDeployAuthRoute(c.Request.URL.Path) {
+		if c.Request.Method == http.MethodOptions || isDeployAuthRoute(c.Request.URL.Path) || isDeploySharePage(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
-		if !auth.tokenConfigured() {
-			writeDeployUnauthorized(c)
-			c.Abort()
-			return
-		}
-		if deployRequestAuthorized(c.Request, auth.Token) {
-			c.Next()
-			return
+		caller := &deployCaller{remote: c.ClientIP(), audit: auth.Audit}
+		if auth.Enabled {
+			if !auth.tokenConfigured() {
+				writeDeployUnauthorized(c)
+				c.Abort()
+				return
+			}
+			principal := auth.authenticate(c.Request, legacy)
+			if principal == nil {
+				writeDeployUnauthorized(c)
+				c.Abort()
+				return
+			}
+			now := time.Now()
+			if principal.expired(now) {
+				caller.record(c.Request.URL.Path, "", nil, &deployAccessError{Status: http.StatusUnauthorized, Message: "deploy token expired"})
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "deploy token expired"})
+				return
+			}
+			caller.principal = principal
+			path := c.Request.URL.Path
+			if deployRouteMetered(path) && !principal.quota.allowRequest(now) {
+				err := &deployAccessError{Status: http.StatusTooManyRequests, Message: "deploy token rate limit exceeded"}
+				caller.record(path, "", nil, err)
+				c.AbortWithStatusJSON(err.Status, gin.H{"error": err.Message})
+				return
+			}
+			if err := caller.authorize(deployRouteScope(path), false); err != nil {
+				caller.record(path, "", nil, err)
+				c.AbortWithStatusJSON(deployAccessStatus(err, http.StatusForbidden), gin.H{"error": err.Error()})
+				return
+			}
 		}
-		writeDeployUnauthorized(c)
-		c.Abort()
+		c.Request = c.Request.WithContext(withDeployCaller(c.Request.Context(), caller))
+		c.Next()
 	}
 }
 
@@ -46,17 +78,60 @@ func isDeployAuthRoute(path string) bool {
 	return path == "/auth/login"
 }
 
-func deployRequestAuthorized(r *http.Request, token string) bool {
-	if deployTokenMatches(bearerToken(r.Header.Get("Authorization")), token) {
-		return true
+// authenticate resolves the request credentials to a principal. The single
+// --deploy-token maps to the all-scope legacy principal.
+func (a deployAuth) authenticate(r *http.Request, legacy *deployPrincipal) *deployPrincipal {
+	if a.ClientCerts {
+		if name := clientCertificateName(r.TLS); name != "" {
+			if principal := a.certPrincipal(name); principal != nil {
+				return principal
+			}
+		}
 	}
-	if deployTokenMatches(r.Header.Get("X-NextTrace-Token"), token) {
-		return true
+	for _, presented := range []string{bearerToken(r.Header.Get("Authorization")), r.Header.Get("X-NextTrace-Token")} {
+		if principal := a.principalForToken(presented, legacy); principal != nil {
+			return principal
+		}
 	}
-	if cookie, err := r.Cookie(deployAuthCookieName); err == nil {
-		return deployTokenMatches(cookie.Value, deployCookieValue(token))
+	cookie, err := r.Cookie(deployAuthCookieName)
+	if err != nil {
+		return nil
 	}
-	return false
+	if strings.TrimSpace(a.Token) != "" && deployTokenMatches(cookie.Value, deployCookieValue(a.Token)) {
+		return legacy
+	}
+	return a.Tokens.lookupCookie(cookie.Value)
+}
+
+// certPrincipal maps a client certificate to the named token of the same
+// name. Without named tokens every certificate the CA signed gets all scopes.
+func (a deployAuth) certPrincipal(name string) *deployPrincipal {
+	if a.Tokens.size() > 0 {
+		return a.Tokens.byName(name)
+	}
+	principal := newLegacyDeployPrincipal()
+	principal.Name = "cert:" + name
+	return principal
+}
+
+func (a deployAuth) principalForToken(token string, legacy *deployPrincipal) *deployPrincipal {
+	if deployTokenMatches(token, a.Token) {
+		return legacy
+	}
+	return a.Tokens.lookup(token)
+}
+
+// loginCookie returns the session cookie value for a submitted login token,
+// or "" when the token is unknown or expired.
+func (a deployAuth) loginCookie(token string) string {
+	if deployTokenMatches(token, a.Token) {
+		return deployCookieValue(a.Token)
+	}
+	principal := a.Tokens.lookup(token)
+	if principal == nil || principal.expired(time.Now()) {
+		return ""
+	}
+	return a.Tokens.cookieFor(principal)
 }
 
 func bearerToken(header string) string {
@@ -76,6 +151,23 @@ func deployTokenMatches(got, want string) bool {
 	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
 }
 
+// deploySessionSecret keys the session cookies of named tokens. It is drawn
+// per process so a cookie cannot be derived from token_sha256 in the tokens
+// file; sessions end when the server restarts.
+var deploySessionSecret = newDeploySessionSecret()
+
+func newDeploySessionSecret() []byte {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return secret
+}
+
+func namedDeployCookieValue(name string) string {
+	mac := hmac.New(sha256.New, deploySessionSecret)
+	mac.Write([]byte("nexttrace-deploy-session\x00" + name))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
 func deployCookieValue(token string) string {
 	sum := sha256.Sum256([]byte("nexttrace-deploy-auth\x00" + token))
 	return base64.RawURLEncoding.EncodeToString(sum[:])
@@ -147,7 +239,8 @@ func registerDeployAuthRoutes(router *gin.Engine, auth deployAuth) {
 			_ = c.ShouldBindJSON(&body)
 			token = strings.TrimSpace(body.Token)
 		}
-		if !deployTokenMatches(token, auth.Token) {
+		cookieValue := auth.loginCookie(token)
+		if cookieValue == "" {
 			if acceptsHTML(c.Request) {
 				c.Data(http.StatusUnauthorized, "text/html; charset=utf-8", []byte(deployLoginPage("Invalid token")))
 				return
@@ -157,7 +250,7 @@ func registerDeployAuthRoutes(router *gin.Engine, auth deployAuth) {
 		}
 		http.SetCookie(c.Writer, &http.Cookie{
 			Name:     deployAuthCookieName,
-			Value:    deployCookieValue(auth.Token),
+			Value:    cookieValue,
 			Path:     "/",
 			HttpOnly: true,
 			SameSite: http.SameSiteLaxMode,
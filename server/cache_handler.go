@@ -10,5 +10,6 @@ import (
 
 func cacheClearHandler(c *gin.Context) {
 	trace.ClearCaches()
+	deployCallerFromContext(c.Request.Context()).record("cache_clear", "", nil, nil)
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
@@ -4,10 +4,12 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/trace"
 )
 
 var (
-	supportedProtocols = []string{"icmp", "udp", "tcp"}
+	supportedProtocols = []string{"icmp", "udp", "tcp", "sctp"}
 	dataProviders      = []string{
 		"LeoMoeAPI",
 		"IP.SB",
@@ -32,12 +34,14 @@ var (
 		"language":          "cn",
 		"data_provider":     "LeoMoeAPI",
 		"disable_maptrace":  false,
+		"udp_payload":       string(trace.UDPPayloadRandom),
 	}
 )
 
 func optionsHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"protocols":      supportedProtocols,
+		"udpPayloads":    trace.UDPPayloadProfiles,
 		"dataProviders":  dataProviders,
 		"defaultOptions": defaults,
 	})
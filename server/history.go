@@ -0,0 +1,448 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/history"
+	"github.com/nxtrace/NTrace-core/internal/service"
+	"github.com/nxtrace/NTrace-core/trace"
+	mtutrace "github.com/nxtrace/NTrace-core/trace/mtu"
+)
+
+const (
+	historySourceAPI = "api"
+	historySourceWeb = "web"
+	historySourceMCP = "mcp"
+	maxHistoryLimit  = 500
+	// maxHistoryMTRRecords bounds a stored web MTR session (about an hour of
+	// 30 hops at one probe per second); later records are dropped.
+	maxHistoryMTRRecords = 100000
+)
+
+// HistoryConfig is the "history" block of the deploy section. Zero retention
+// values fall back to the history package defaults; negative values disable
+// the limit.
+type HistoryConfig struct {
+	Dir        string        `mapstructure:"dir"`
+	MaxEntries int           `mapstructure:"max_entries"`
+	MaxAge     time.Duration `mapstructure:"max_age"`
+}
+
+// historyDir resolves the --history-dir override against the configured dir.
+func historyDir(dir string, cfg HistoryConfig) string {
+	if dir = strings.TrimSpace(dir); dir != "" {
+		return dir
+	}
+	return strings.TrimSpace(cfg.Dir)
+}
+
+func openHistoryStore(dir string, cfg HistoryConfig) (*history.Store, error) {
+	dir = historyDir(dir, cfg)
+	if dir == "" {
+		return nil, nil
+	}
+	retention := history.Retention{MaxEntries: cfg.MaxEntries, MaxAge: cfg.MaxAge}
+	if retention.MaxEntries == 0 {
+		retention.MaxEntries = history.DefaultMaxEntries
+	}
+	if retention.MaxAge == 0 {
+		retention.MaxAge = history.DefaultMaxAge
+	}
+	return history.Open(dir, retention)
+}
+
+type historyStoreKey struct{}
+
+// deployHistoryMiddleware attaches the history store so handlers can save
+// finished results without extra plumbing.
+func deployHistoryMiddleware(store *history.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store != nil {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), historyStoreKey{}, store))
+		}
+		c.Next()
+	}
+}
+
+func historyStoreFromContext(ctx context.Context) *history.Store {
+	if ctx == nil {
+		return nil
+	}
+	store, _ := ctx.Value(historyStoreKey{}).(*history.Store)
+	return store
+}
+
+// saveHistory stores result under entry. Failures are logged; they never fail
+// the probe that produced the result.
+func saveHistory(store *history.Store, caller *deployCaller, entry history.Entry, result any) {
+	if store == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("[deploy] history encode failed target=%s error=%v", sanitizeLogParam(entry.Target), err)
+		return
+	}
+	entry.Result = data
+	entry.Token = caller.tokenName()
+	if _, err := store.Add(entry); err != nil {
+		log.Printf("[deploy] history save failed target=%s error=%v", sanitizeLogParam(entry.Target), err)
+	}
+}
+
+func traceHistoryParams(setup *traceExecution) map[string]any {
+	params := traceAuditParams(setup.Req)
+	params["protocol"] = setup.Protocol
+	params["data_provider"] = setup.DataProvider
+	params["max_hops"] = setup.Config.MaxHops
+	if setup.Req.Mode != "mtr" && setup.Req.Mode != "continuous" {
+		params["queries"] = setup.Config.NumMeasurements
+	}
+	return params
+}
+
+func saveTraceHistory(ctx context.Context, source string, setup *traceExecution, resp traceResponse) {
+	saveHistory(historyStoreFromContext(ctx), deployCallerFromContext(ctx), history.Entry{Summary: history.Summary{
+		Kind:       history.KindTrace,
+		Source:     source,
+		Target:     setup.Target,
+		ResolvedIP: resp.ResolvedIP,
+		Params:     traceHistoryParams(setup),
+		DurationMs: resp.DurationMs,
+		ASNs:       hopResponseASNs(resp.Hops),
+	}}, resp)
+}
+
+// historyMTRReport is the stored shape of web and MCP MTR runs. MCP runs
+// carry the per-TTL stats of the MTR report; web runs carry the raw probe
+// records, which the web UI aggregates exactly as it did live.
+type historyMTRReport struct {
+	Target       string               `json:"target"`
+	ResolvedIP   string               `json:"resolved_ip"`
+	Protocol     string               `json:"protocol"`
+	DataProvider string               `json:"data_provider,omitempty"`
+	Iteration    int                  `json:"iteration,omitempty"`
+	Stats        []mtrHopJSON         `json:"stats,omitempty"`
+	Records      []trace.MTRRawRecord `json:"records,omitempty"`
+	Truncated    bool                 `json:"truncated,omitempty"`
+	DurationMs   int64                `json:"duration_ms"`
+}
+
+func saveMTRHistory(ctx context.Context, source string, setup *traceExecution, report historyMTRReport) {
+	if len(report.Stats) == 0 && len(report.Records) == 0 {
+		return
+	}
+	saveHistory(historyStoreFromContext(ctx), deployCallerFromContext(ctx), history.Entry{Summary: history.Summary{
+		Kind:       history.KindMTR,
+		Source:     source,
+		Target:     setup.Target,
+		ResolvedIP: report.ResolvedIP,
+		Params:     traceHistoryParams(setup),
+		DurationMs: report.DurationMs,
+		ASNs:       append(mtrStatASNs(report.Stats), mtrRecordASNs(report.Records)...),
+	}}, report)
+}
+
+// mtrRawLog keeps the raw records of a web MTR session. History stores the
+// records rather than per-TTL rows so the browser rebuilds the table with the
+// same aggregation it used live; there is no second copy of it on the server.
+type mtrRawLog struct {
+	mu        sync.Mutex
+	records   []trace.MTRRawRecord
+	iteration int
+	truncated bool
+}
+
+func (l *mtrRawLog) add(rec trace.MTRRawRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rec.Iteration > l.iteration {
+		l.iteration = rec.Iteration
+	}
+	if len(l.records) >= maxHistoryMTRRecords {
+		l.truncated = true
+		return
+	}
+	l.records = append(l.records, rec)
+}
+
+func (l *mtrRawLog) snapshot() (int, []trace.MTRRawRecord, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.iteration, append([]trace.MTRRawRecord(nil), l.records...), l.truncated
+}
+
+// mtrStatsToHopJSON converts MCP report rows to the web MTR row shape.
+func mtrStatsToHopJSON(stats []trace.MTRHopStat) []mtrHopJSON {
+	out := make([]mtrHopJSON, 0, len(stats))
+	for _, s := range stats {
+		loss := max(0, s.Snt-s.Received)
+		row := mtrHopJSON{
+			TTL:         s.TTL,
+			Host:        s.Host,
+			IP:          s.IP,
+			Sent:        s.Snt,
+			Received:    s.Received,
+			LossPercent: s.Loss,
+			LossCount:   loss,
+			Last:        s.Last,
+			Avg:         s.Avg,
+			Best:        s.Best,
+			Worst:       s.Wrst,
+			Geo:         s.Geo,
+			MPLS:        s.MPLS,
+		}
+		row.FailureType = failureTypeFromErrors(nil, s.Received, loss)
+		out = append(out, row)
+	}
+	return out
+}
+
+func hopResponseASNs(hops []hopResponse) []string {
+	var asns []string
+	for _, hop := range hops {
+		for _, attempt := range hop.Attempts {
+			if attempt.Geo != nil {
+				asns = append(asns, attempt.Geo.Asnumber)
+			}
+		}
+	}
+	return asns
+}
+
+func serviceHopASNs(hops []service.Hop) []string {
+	var asns []string
+	for _, hop := range hops {
+		for _, attempt := range hop.Attempts {
+			if attempt.Geo != nil {
+				asns = append(asns, attempt.Geo.Asnumber)
+			}
+		}
+	}
+	return asns
+}
+
+func mtrStatASNs(stats []mtrHopJSON) []string {
+	var asns []string
+	for _, stat := range stats {
+		if stat.Geo != nil {
+			asns = append(asns, stat.Geo.Asnumber)
+		}
+	}
+	return asns
+}
+
+func mtrRecordASNs(records []trace.MTRRawRecord) []string {
+	var asns []string
+	for _, rec := range records {
+		if rec.ASN != "" {
+			asns = append(asns, rec.ASN)
+		}
+	}
+	return asns
+}
+
+func mtuHopASNs(hops []mtutrace.Hop) []string {
+	var asns []string
+	for _, hop := range hops {
+		if hop.Geo != nil {
+			asns = append(asns, hop.Geo.Asnumber)
+		}
+	}
+	return asns
+}
+
+// historyMCPService saves successful traceroute, MTR report and MTU results
+// made through MCP.
+type historyMCPService struct {
+	nexttraceMCPService
+	store  *history.Store
+	caller *deployCaller
+}
+
+func withMCPHistory(svc nexttraceMCPService, store *history.Store, caller *deployCaller) nexttraceMCPService {
+	if store == nil {
+		return svc
+	}
+	return historyMCPService{nexttraceMCPService: svc, store: store, caller: caller}
+}
+
+func (h historyMCPService) Traceroute(ctx context.Context, req service.TraceRequest) (service.TraceResponse, error) {
+	out, err := h.nexttraceMCPService.Traceroute(ctx, req)
+	if err == nil {
+		saveHistory(h.store, h.caller, history.Entry{Summary: history.Summary{
+			Kind:       history.KindTrace,
+			Source:     historySourceMCP,
+			Target:     out.Target,
+			ResolvedIP: out.ResolvedIP,
+			Params:     mcpTraceHistoryParams(req, out.Protocol),
+			DurationMs: out.DurationMs,
+			ASNs:       serviceHopASNs(out.Hops),
+		}}, out)
+	}
+	return out, err
+}
+
+func (h historyMCPService) MTRReport(ctx context.Context, req service.MTRReportRequest) (service.MTRReportResponse, error) {
+	out, err := h.nexttraceMCPService.MTRReport(ctx, req)
+	if err == nil && len(out.Stats) > 0 {
+		stats := mtrStatsToHopJSON(out.Stats)
+		saveHistory(h.store, h.caller, history.Entry{Summary: history.Summary{
+			Kind:       history.KindMTR,
+			Source:     historySourceMCP,
+			Target:     out.Target,
+			ResolvedIP: out.ResolvedIP,
+			Params:     mcpTraceHistoryParams(req.TraceRequest, out.Protocol),
+			DurationMs: out.DurationMs,
+			ASNs:       mtrStatASNs(stats),
+		}}, historyMTRReport{
+			Target:     out.Target,
+			ResolvedIP: out.ResolvedIP,
+			Protocol:   out.Protocol,
+			Stats:      stats,
+			DurationMs: out.DurationMs,
+		})
+	}
+	return out, err
+}
+
+func (h historyMCPService) MTUTrace(ctx context.Context, req service.MTUTraceRequest) (service.MTUTraceResponse, error) {
+	out, err := h.nexttraceMCPService.MTUTrace(ctx, req)
+	if err == nil {
+		params := map[string]any{"max_hops": req.MaxHops, "queries": req.Queries}
+		if req.Port > 0 {
+			params["port"] = req.Port
+		}
+		saveHistory(h.store, h.caller, history.Entry{Summary: history.Summary{
+			Kind:       history.KindMTU,
+			Source:     historySourceMCP,
+			Target:     out.Target,
+			ResolvedIP: out.ResolvedIP,
+			Params:     params,
+			DurationMs: out.DurationMs,
+			ASNs:       mtuHopASNs(out.Hops),
+		}}, out)
+	}
+	return out, err
+}
+
+func mcpTraceHistoryParams(req service.TraceRequest, protocol string) map[string]any {
+	params := map[string]any{"protocol": protocol, "max_hops": req.MaxHops, "queries": req.Queries}
+	if req.Port > 0 {
+		params["port"] = req.Port
+	}
+	if req.DataProvider != "" {
+		params["data_provider"] = req.DataProvider
+	}
+	return params
+}
+
+// historyOwner returns the token whose entries the caller may read. Callers
+// without a named token and holders of the admin scope see every entry.
+func (c *deployCaller) historyOwner() (string, bool) {
+	if c == nil || c.principal == nil || c.principal.hasScope(scopeAdmin) {
+		return "", false
+	}
+	return c.principal.Name, true
+}
+
+// getHistoryEntry loads id if the caller may read it. Entries of other tokens
+// are reported as missing so their IDs cannot be probed.
+func getHistoryEntry(ctx context.Context, store *history.Store, id string) (history.Entry, error) {
+	entry, err := store.Get(id)
+	if err != nil {
+		return history.Entry{}, err
+	}
+	if owner, scoped := deployCallerFromContext(ctx).historyOwner(); scoped && entry.Token != owner {
+		return history.Entry{}, history.ErrNotFound
+	}
+	return entry, nil
+}
+
+func historyListHandler(c *gin.Context) {
+	store := historyStoreFromContext(c.Request.Context())
+	if store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "history is disabled"})
+		return
+	}
+	filter := history.Filter{
+		Target: c.Query("target"),
+		ASN:    c.Query("asn"),
+		Kind:   c.Query("kind"),
+		Token:  c.Query("token"),
+	}
+	if owner, scoped := deployCallerFromContext(c.Request.Context()).historyOwner(); scoped {
+		if filter.Token != "" && filter.Token != owner {
+			c.JSON(http.StatusOK, gin.H{"entries": []history.Summary{}})
+			return
+		}
+		filter.Token = owner
+	}
+	var err error
+	if filter.Since, err = history.ParseTime(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Until, err = history.ParseTime(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		filter.Limit = min(limit, maxHistoryLimit)
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": store.List(filter)})
+}
+
+func historyGetHandler(c *gin.Context) {
+	store := historyStoreFromContext(c.Request.Context())
+	if store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "history is disabled"})
+		return
+	}
+	entry, err := getHistoryEntry(c.Request.Context(), store, c.Param("id"))
+	if err != nil {
+		writeHistoryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+func historyDeleteHandler(c *gin.Context) {
+	store := historyStoreFromContext(c.Request.Context())
+	if store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "history is disabled"})
+		return
+	}
+	if err := deployCallerFromContext(c.Request.Context()).authorize(scopeAdmin, false); err != nil {
+		c.JSON(deployAccessStatus(err, http.StatusForbidden), gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.Delete(c.Param("id")); err != nil {
+		writeHistoryError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func writeHistoryError(c *gin.Context, err error) {
+	if errors.Is(err, history.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/history"
+	"github.com/nxtrace/NTrace-core/internal/service"
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func openTestHistory(t *testing.T) *history.Store {
+	t.Helper()
+	store, err := openHistoryStore(t.TempDir(), HistoryConfig{})
+	if err != nil {
+		t.Fatalf("openHistoryStore() error = %v", err)
+	}
+	return store
+}
+
+func newHistoryTestRouter(auth deployAuth, store *history.Store) *gin.Engine {
+	router := newDeployAuthTestRouter(auth)
+	router.Use(deployHistoryMiddleware(store))
+	router.GET("/api/history", historyListHandler)
+	router.GET("/api/history/:id", historyGetHandler)
+	router.DELETE("/api/history/:id", historyDeleteHandler)
+	return router
+}
+
+func TestSaveTraceHistoryRecordsTokenAndASNs(t *testing.T) {
+	store := openTestHistory(t)
+	caller := &deployCaller{principal: &deployPrincipal{Name: "noc"}}
+	ctx := withDeployCaller(context.WithValue(context.Background(), historyStoreKey{}, store), caller)
+	setup := &traceExecution{
+		Req:      traceRequest{Target: "one.one.one.one", Protocol: "tcp", Port: 443},
+		Target:   "one.one.one.one",
+		Protocol: "tcp",
+		IP:       net.ParseIP("1.1.1.1"),
+		Config:   trace.Config{MaxHops: 30, NumMeasurements: 3},
+	}
+	resp := traceResponse{
+		Target:     setup.Target,
+		ResolvedIP: "1.1.1.1",
+		Hops: []hopResponse{{TTL: 1, Attempts: []hopAttempt{
+			{Success: true, IP: "1.1.1.1", Geo: &ipgeo.IPGeoData{Asnumber: "13335"}},
+		}}},
+	}
+
+	saveTraceHistory(ctx, historySourceAPI, setup, resp)
+
+	entries := store.List(history.Filter{ASN: "AS13335"})
+	if len(entries) != 1 {
+		t.Fatalf("List() = %+v, want one trace entry", entries)
+	}
+	got := entries[0]
+	if got.Kind != history.KindTrace || got.Token != "noc" || got.Source != historySourceAPI || got.Params["port"] != 443 {
+		t.Fatalf("entry = %+v", got)
+	}
+}
+
+func TestHistoryHandlersListFetchAndDelete(t *testing.T) {
+	store := openTestHistory(t)
+	entry, err := store.Add(history.Entry{
+		Summary: history.Summary{Kind: history.KindTrace, Target: "example.com", Token: "viewer"},
+		Result:  json.RawMessage(`{"target":"example.com","hops":[]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "viewer", Token: "viewer-secret", Scopes: []string{"history"}},
+		{Name: "prober", Token: "prober-secret", Scopes: []string{"trace"}},
+		{Name: "admin", Token: "admin-secret", Scopes: []string{"all"}},
+	}, nil)
+	router := newHistoryTestRouter(auth, store)
+
+	resp := serveWithToken(router, http.MethodGet, "/api/history?target=EXAMPLE", "viewer-secret")
+	var list struct {
+		Entries []history.Summary `json:"entries"`
+	}
+	if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &list) != nil || len(list.Entries) != 1 {
+		t.Fatalf("list status=%d body=%s", resp.Code, resp.Body.String())
+	}
+
+	resp = serveWithToken(router, http.MethodGet, "/api/history/"+entry.ID, "viewer-secret")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("get status=%d body=%s", resp.Code, resp.Body.String())
+	}
+	if got := serveWithToken(router, http.MethodGet, "/api/history/"+entry.ID, "prober-secret").Code; got != http.StatusForbidden {
+		t.Fatalf("token without history scope status = %d, want 403", got)
+	}
+	if got := serveWithToken(router, http.MethodGet, "/api/history?from=yesterday", "viewer-secret").Code; got != http.StatusBadRequest {
+		t.Fatalf("invalid from status = %d, want 400", got)
+	}
+	if got := serveWithToken(router, http.MethodDelete, "/api/history/"+entry.ID, "viewer-secret").Code; got != http.StatusForbidden {
+		t.Fatalf("delete without admin status = %d, want 403", got)
+	}
+	if got := serveWithToken(router, http.MethodDelete, "/api/history/"+entry.ID, "admin-secret").Code; got != http.StatusNoContent {
+		t.Fatalf("admin delete status = %d, want 204", got)
+	}
+	if got := serveWithToken(router, http.MethodGet, "/api/history/"+entry.ID, "admin-secret").Code; got != http.StatusNotFound {
+		t.Fatalf("deleted entry status = %d, want 404", got)
+	}
+}
+
+func TestHistoryHandlersReportDisabledStore(t *testing.T) {
+	router := newHistoryTestRouter(deployAuth{}, nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/history", nil))
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404 when history is disabled", resp.Code)
+	}
+}
+
+func TestHistoryHandlersScopeEntriesToToken(t *testing.T) {
+	store := openTestHistory(t)
+	own, err := store.Add(history.Entry{
+		Summary: history.Summary{Kind: history.KindTrace, Target: "own.example", Token: "viewer"},
+		Result:  json.RawMessage(`{"target":"own.example","hops":[]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.Add(history.Entry{
+		Summary: history.Summary{Kind: history.KindTrace, Target: "other.example", Token: "other"},
+		Result:  json.RawMessage(`{"target":"other.example","hops":[]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "viewer", Token: "viewer-secret", Scopes: []string{"history"}},
+		{Name: "admin", Token: "admin-secret", Scopes: []string{"history", "admin"}},
+	}, nil)
+	router := newHistoryTestRouter(auth, store)
+
+	list := func(path, token string) []history.Summary {
+		t.Helper()
+		resp := serveWithToken(router, http.MethodGet, path, token)
+		var body struct {
+			Entries []history.Summary `json:"entries"`
+		}
+		if resp.Code != http.StatusOK || json.Unmarshal(resp.Body.Bytes(), &body) != nil {
+			t.Fatalf("%s status=%d body=%s", path, resp.Code, resp.Body.String())
+		}
+		return body.Entries
+	}
+	if got := list("/api/history", "viewer-secret"); len(got) != 1 || got[0].ID != own.ID {
+		t.Fatalf("viewer list = %+v, want only its own entry", got)
+	}
+	if got := list("/api/history?token=other", "viewer-secret"); len(got) != 0 {
+		t.Fatalf("viewer list of other token = %+v, want none", got)
+	}
+	if got := list("/api/history", "admin-secret"); len(got) != 2 {
+		t.Fatalf("admin list = %+v, want every entry", got)
+	}
+	if got := serveWithToken(router, http.MethodGet, "/api/history/"+other.ID, "viewer-secret").Code; got != http.StatusNotFound {
+		t.Fatalf("viewer get of other entry status = %d, want 404", got)
+	}
+	if got := serveWithToken(router, http.MethodGet, "/api/history/"+other.ID, "admin-secret").Code; got != http.StatusOK {
+		t.Fatalf("admin get of other entry status = %d, want 200", got)
+	}
+}
+
+func TestWebMTRHistoryStoresRawRecords(t *testing.T) {
+	store := openTestHistory(t)
+	ctx := context.WithValue(context.Background(), historyStoreKey{}, store)
+	setup := &traceExecution{Req: traceRequest{Target: "1.1.1.1", Mode: "mtr"}, Target: "1.1.1.1", IP: net.ParseIP("1.1.1.1")}
+	raw := &mtrRawLog{}
+	for _, rec := range []trace.MTRRawRecord{
+		{Iteration: 1, TTL: 1, Success: true, IP: "10.0.0.1", RTTMs: 2, Lat: 10, Lng: 10},
+		{Iteration: 1, TTL: 2, Success: true, IP: "1.1.1.1", RTTMs: 10, ASN: "13335", Lat: 20, Lng: 20},
+		{Iteration: 1, TTL: 3, Success: true, IP: "1.1.1.1", RTTMs: 11, Lat: 20, Lng: 20},
+		{Iteration: 2, TTL: 1, Success: false},
+	} {
+		raw.add(rec)
+	}
+	rounds, records, truncated := raw.snapshot()
+	saveMTRHistory(ctx, historySourceWeb, setup, historyMTRReport{Target: setup.Target, ResolvedIP: "1.1.1.1", Iteration: rounds, Records: records, Truncated: truncated})
+
+	entries := store.List(history.Filter{ASN: "13335"})
+	if len(entries) != 1 || entries[0].Kind != history.KindMTR {
+		t.Fatalf("List() = %+v, want one MTR entry", entries)
+	}
+	entry, err := store.Get(entries[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored historyMTRReport
+	if err := json.Unmarshal(entry.Result, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Iteration != 2 || len(stored.Records) != 4 || len(stored.Stats) != 0 || stored.Truncated {
+		t.Fatalf("stored = %+v, want the raw records only", stored)
+	}
+	points, err := snapshotMapPoints(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].TTL != 1 || points[1].TTL != 2 {
+		t.Fatalf("points = %+v, want TTL 1 and the destination at TTL 2", points)
+	}
+}
+
+func TestMCPHistoryRecordsSuccessfulCalls(t *testing.T) {
+	store := openTestHistory(t)
+	inner := newRecordingMCPService()
+	svc := withMCPHistory(inner, store, &deployCaller{principal: &deployPrincipal{Name: "agent"}})
+
+	if _, err := svc.Traceroute(context.Background(), service.TraceRequest{Target: "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.MTUTrace(context.Background(), service.MTUTraceRequest{Target: "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	inner.failTool = "nexttrace_traceroute"
+	_, _ = svc.Traceroute(context.Background(), service.TraceRequest{Target: "example.com"})
+
+	entries := store.List(history.Filter{})
+	if len(entries) != 2 {
+		t.Fatalf("List() = %+v, want traceroute and MTU entries only", entries)
+	}
+	if entries[0].Kind != history.KindMTU || entries[1].Kind != history.KindTrace || entries[0].Token != "agent" || entries[0].Source != historySourceMCP {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
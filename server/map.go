@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/history"
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+	"github.com/nxtrace/NTrace-core/tracemap"
+)
+
+// mapHandler draws a result on the offline basemap, without sending it to
+// the MapTrace service. It takes the same body as POST /api/export and
+// returns a standalone HTML page, or GeoJSON with ?format=geojson.
+func mapHandler(c *gin.Context) {
+	format := tracemap.Format(strings.ToLower(c.DefaultQuery("format", string(tracemap.FormatHTML))))
+	if format != tracemap.FormatHTML && format != tracemap.FormatGeoJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported map format %q", format)})
+		return
+	}
+	entry, ok := bindSnapshotRequest(c)
+	if !ok {
+		return
+	}
+	points, err := snapshotMapPoints(entry)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Geo fields in stored results are already localised.
+	var buf bytes.Buffer
+	if err := tracemap.WriteLocal(&buf, format, points, entry.Target, ""); err != nil {
+		log.Printf("[deploy] map render failed target=%s error=%v", sanitizeLogParam(entry.Target), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	contentType := "text/html; charset=utf-8"
+	if format == tracemap.FormatGeoJSON {
+		contentType = "application/geo+json"
+	}
+	filename := strings.TrimSuffix(snapshotFilename(entry), ".html") + "-map." + string(format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// snapshotMapPoints picks one located address per TTL from a stored trace,
+// MTR or MTU result, like the map of the web console.
+func snapshotMapPoints(entry history.Entry) ([]tracemap.Point, error) {
+	var result struct {
+		Hops []struct {
+			TTL      int              `json:"ttl"`
+			IP       string           `json:"ip"`
+			Hostname string           `json:"hostname"`
+			RTTMs    float64          `json:"rtt_ms"`
+			Geo      *ipgeo.IPGeoData `json:"geo"`
+			Attempts []hopAttempt     `json:"attempts"`
+		} `json:"hops"`
+		Stats      []mtrHopJSON         `json:"stats"`
+		Records    []trace.MTRRawRecord `json:"records"`
+		ResolvedIP string               `json:"resolved_ip"`
+	}
+	if err := json.Unmarshal(entry.Result, &result); err != nil {
+		return nil, errors.New("result must be a JSON object")
+	}
+
+	var points []tracemap.Point
+	seen := map[int]bool{}
+	add := func(p tracemap.Point) {
+		if p.IP != "" && p.Located() && !seen[p.TTL] {
+			seen[p.TTL] = true
+			points = append(points, p)
+		}
+	}
+	switch entry.Kind {
+	case history.KindMTR:
+		for _, row := range result.Stats {
+			add(tracemap.Point{TTL: row.TTL, IP: row.IP, Hostname: row.Host, RTT: row.Avg, MPLS: row.MPLS, Geo: row.Geo})
+		}
+		// Web runs store raw records; TTLs past the first one the
+		// destination answered are echoes of it, as in the live table.
+		finalTTL := 0
+		for _, rec := range result.Records {
+			if rec.Success && rec.IP != "" && rec.IP == result.ResolvedIP && (finalTTL == 0 || rec.TTL < finalTTL) {
+				finalTTL = rec.TTL
+			}
+		}
+		for _, rec := range result.Records {
+			if !rec.Success || (finalTTL > 0 && rec.TTL > finalTTL) {
+				continue
+			}
+			add(tracemap.Point{TTL: rec.TTL, IP: rec.IP, Hostname: rec.Host, RTT: rec.RTTMs, MPLS: rec.MPLS, Geo: &ipgeo.IPGeoData{
+				Asnumber: rec.ASN, Country: rec.Country, Prov: rec.Prov, City: rec.City, District: rec.District, Owner: rec.Owner, Lat: rec.Lat, Lng: rec.Lng,
+			}})
+		}
+	case history.KindMTU:
+		for _, hop := range result.Hops {
+			add(tracemap.Point{TTL: hop.TTL, IP: hop.IP, Hostname: hop.Hostname, RTT: hop.RTTMs, Geo: hop.Geo})
+		}
+	default:
+		for _, hop := range result.Hops {
+			for _, a := range hop.Attempts {
+				if a.Success {
+					add(tracemap.Point{TTL: hop.TTL, IP: a.IP, Hostname: a.Hostname, RTT: a.RTT, MPLS: a.MPLS, Geo: a.Geo})
+				}
+			}
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].TTL < points[j].TTL })
+	return points, nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/internal/history"
+)
+
+func TestSnapshotMapPoints(t *testing.T) {
+	trace := history.Entry{Summary: history.Summary{Kind: history.KindTrace}, Result: json.RawMessage(`{"target":"a.example","hops":[
+		{"ttl":1,"attempts":[{"success":true,"ip":"192.168.1.1","geo":{"lat":0,"lng":0}}]},
+		{"ttl":2,"attempts":[{"success":false},{"success":true,"ip":"192.0.2.1","rtt_ms":3.5,"geo":{"city":"Frankfurt","lat":50.11,"lng":8.68}}]},
+		{"ttl":3,"attempts":[{"success":true,"ip":"192.0.2.2","geo":{"city":"Paris","lat":48.86,"lng":2.35}}]}]}`)}
+	points, err := snapshotMapPoints(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].TTL != 2 || points[0].IP != "192.0.2.1" || points[0].RTT != 3.5 || points[1].TTL != 3 {
+		t.Fatalf("trace points = %+v", points)
+	}
+
+	mtr := history.Entry{Summary: history.Summary{Kind: history.KindMTR}, Result: json.RawMessage(`{"target":"a.example","stats":[
+		{"ttl":3,"ip":"192.0.2.3","avg_ms":9,"geo":{"lat":1,"lng":2}},
+		{"ttl":2,"ip":"192.0.2.2","avg_ms":5,"geo":{"lat":1,"lng":1}},
+		{"ttl":2,"ip":"192.0.2.9","avg_ms":6,"geo":{"lat":3,"lng":3}}]}`)}
+	points, err = snapshotMapPoints(mtr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].IP != "192.0.2.2" || points[1].IP != "192.0.2.3" {
+		t.Fatalf("mtr points = %+v", points)
+	}
+}
+
+func TestMapHandler(t *testing.T) {
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "prober", Token: "prober-secret", Scopes: []string{"geo"}},
+		{Name: "tracer", Token: "tracer-secret", Scopes: []string{"trace"}},
+	}, nil)
+	router := newShareTestRouter(auth, nil, nil)
+	router.POST("/api/map", mapHandler)
+	body := `{"kind":"trace","result":{"target":"a.example","hops":[
+		{"ttl":1,"attempts":[{"success":true,"ip":"192.0.2.1","geo":{"city":"Frankfurt","lat":50.11,"lng":8.68}}]},
+		{"ttl":2,"attempts":[{"success":true,"ip":"192.0.2.2","geo":{"city":"Paris","lat":48.86,"lng":2.35}}]}]}}`
+
+	if got := postJSON(router, "/api/map", "tracer-secret", body).Code; got != http.StatusForbidden {
+		t.Fatalf("map without geo scope status = %d, want 403", got)
+	}
+	resp := postJSON(router, "/api/map", "prober-secret", body)
+	if resp.Code != http.StatusOK || !strings.HasPrefix(resp.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("html map status=%d headers=%v", resp.Code, resp.Header())
+	}
+	if !strings.Contains(resp.Body.String(), `<polyline class="path"`) || !strings.Contains(resp.Header().Get("Content-Disposition"), "-map.html") {
+		t.Fatalf("html map body=%s", resp.Body.String())
+	}
+
+	resp = postJSON(router, "/api/map?format=geojson", "prober-secret", body)
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "application/geo+json" {
+		t.Fatalf("geojson status=%d headers=%v", resp.Code, resp.Header())
+	}
+	var fc struct {
+		Features []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &fc); err != nil || len(fc.Features) != 3 {
+		t.Fatalf("geojson body=%s err=%v", resp.Body.String(), err)
+	}
+
+	if got := postJSON(router, "/api/map?format=png", "prober-secret", body).Code; got != http.StatusBadRequest {
+		t.Fatalf("unknown format status = %d, want 400", got)
+	}
+}
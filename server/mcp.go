@@ -8,6 +8,7 @@ import (
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"github.com/nxtrace/NTrace-core/config"
+	"github.com/nxtrace/NTrace-core/internal/history"
 	"github.com/nxtrace/NTrace-core/internal/service"
 )
 
@@ -16,6 +17,7 @@ type nexttraceMCPService interface {
 	Traceroute(context.Context, service.TraceRequest) (service.TraceResponse, error)
 	MTRReport(context.Context, service.MTRReportRequest) (service.MTRReportResponse, error)
 	MTRRaw(context.Context, service.MTRRawRequest) (service.MTRRawResponse, error)
+	DualStack(context.Context, service.DualStackRequest) (service.DualStackResponse, error)
 	MTUTrace(context.Context, service.MTUTraceRequest) (service.MTUTraceResponse, error)
 	SpeedTest(context.Context, service.SpeedTestRequest) (service.SpeedTestResponse, error)
 	AnnotateIPs(context.Context, service.AnnotateIPsRequest) (service.AnnotateIPsResponse, error)
@@ -25,26 +27,37 @@ type nexttraceMCPService interface {
 	GlobalpingGetMeasurement(context.Context, service.GlobalpingGetMeasurementRequest) (service.GlobalpingMeasurementResponse, error)
 }
 
-func newMCPHTTPHandler() http.Handler {
-	return newMCPHTTPHandlerWithService(service.New())
+func newMCPHTTPHandler(policy *service.Policy, store *history.Store) http.Handler {
+	return newMCPHTTPHandlerWithService(service.NewWithPolicy(policy), store)
 }
 
-func newMCPHTTPHandlerWithService(svc nexttraceMCPService) http.Handler {
+func newMCPHTTPHandlerWithService(svc nexttraceMCPService, store *history.Store) http.Handler {
+	shared := newMCPServer(withMCPHistory(svc, store, nil))
+	return mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
+		// Stateless mode lets each request carry its own caller, so token
+		// scopes, audit records and history entries follow the request that
+		// made the call.
+		if caller := deployCallerFromContext(r.Context()); caller.enforced() {
+			return newMCPServer(withMCPHistory(guardMCPService(svc, caller), store, caller))
+		}
+		return shared
+	}, &mcp.StreamableHTTPOptions{
+		Stateless:      true,
+		JSONResponse:   true,
+		SessionTimeout: 5 * time.Minute,
+	})
+}
+
+func newMCPServer(svc nexttraceMCPService) *mcp.Server {
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "nexttrace",
 		Title:   "NextTrace Deploy MCP",
 		Version: config.Version,
 	}, &mcp.ServerOptions{
-		Instructions: "Use NextTrace tools for local traceroute, MTR, MTU, speed, IP annotation, GeoIP lookup, and Globalping multi-location traceroute.",
+		Instructions: "Use NextTrace tools for local traceroute, MTR, IPv4/IPv6 dual-stack comparison, MTU, speed, IP annotation, GeoIP lookup, and Globalping multi-location traceroute.",
 	})
 	registerMCPTools(server, svc)
-	return mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
-		return server
-	}, &mcp.StreamableHTTPOptions{
-		Stateless:      true,
-		JSONResponse:   true,
-		SessionTimeout: 5 * time.Minute,
-	})
+	return server
 }
 
 func registerMCPTools(server *mcp.Server, svc nexttraceMCPService) {
@@ -58,7 +71,7 @@ func registerMCPTools(server *mcp.Server, svc nexttraceMCPService) {
 
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "nexttrace_traceroute",
-		Description: "Run local NextTrace ICMP/TCP/UDP traceroute and return structured hop attempts.",
+		Description: "Run local NextTrace ICMP/TCP/UDP/SCTP traceroute and return structured hop attempts.",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, input service.TraceRequest) (*mcp.CallToolResult, service.TraceResponse, error) {
 		out, err := svc.Traceroute(ctx, input)
 		return nil, out, err
@@ -80,6 +93,14 @@ func registerMCPTools(server *mcp.Server, svc nexttraceMCPService) {
 		return nil, out, err
 	})
 
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "nexttrace_dual_stack",
+		Description: "Trace (or MTR with mtr=true) the IPv4 and IPv6 addresses of one hostname at the same time and compare hop counts, RTT/loss, AS paths and where they diverge.",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, input service.DualStackRequest) (*mcp.CallToolResult, service.DualStackResponse, error) {
+		out, err := svc.DualStack(ctx, input)
+		return nil, out, err
+	})
+
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "nexttrace_mtu_trace",
 		Description: "Run UDP path-MTU discovery and return structured MTU hops.",
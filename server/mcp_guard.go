@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+
+	"github.com/nxtrace/NTrace-core/internal/service"
+)
+
+// guardedMCPService enforces per-token scopes, probe quotas and audit logging
+// for every MCP tool call made by one HTTP request's caller.
+type guardedMCPService struct {
+	inner  nexttraceMCPService
+	caller *deployCaller
+}
+
+func guardMCPService(svc nexttraceMCPService, caller *deployCaller) nexttraceMCPService {
+	if !caller.enforced() {
+		return svc
+	}
+	return guardedMCPService{inner: svc, caller: caller}
+}
+
+func guardMCPCall[T any](caller *deployCaller, tool, scope string, probe bool, target string, params any, call func() (T, error)) (T, error) {
+	if err := caller.authorize(scope, probe); err != nil {
+		caller.record(tool, target, params, err)
+		var zero T
+		return zero, err
+	}
+	out, err := call()
+	caller.record(tool, target, params, err)
+	return out, err
+}
+
+func (g guardedMCPService) Capabilities(ctx context.Context, req service.CapabilitiesRequest) (service.CapabilitiesResponse, error) {
+	return g.inner.Capabilities(ctx, req)
+}
+
+func (g guardedMCPService) Traceroute(ctx context.Context, req service.TraceRequest) (service.TraceResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_traceroute", scopeTrace, true, req.Target, req, func() (service.TraceResponse, error) {
+		return g.inner.Traceroute(ctx, req)
+	})
+}
+
+func (g guardedMCPService) MTRReport(ctx context.Context, req service.MTRReportRequest) (service.MTRReportResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_mtr_report", scopeMTR, true, req.Target, req, func() (service.MTRReportResponse, error) {
+		return g.inner.MTRReport(ctx, req)
+	})
+}
+
+func (g guardedMCPService) MTRRaw(ctx context.Context, req service.MTRRawRequest) (service.MTRRawResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_mtr_raw", scopeMTR, true, req.Target, req, func() (service.MTRRawResponse, error) {
+		return g.inner.MTRRaw(ctx, req)
+	})
+}
+
+func (g guardedMCPService) DualStack(ctx context.Context, req service.DualStackRequest) (service.DualStackResponse, error) {
+	scope := scopeTrace
+	if req.MTR {
+		scope = scopeMTR
+	}
+	return guardMCPCall(g.caller, "nexttrace_dual_stack", scope, true, req.Target, req, func() (service.DualStackResponse, error) {
+		return g.inner.DualStack(ctx, req)
+	})
+}
+
+func (g guardedMCPService) MTUTrace(ctx context.Context, req service.MTUTraceRequest) (service.MTUTraceResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_mtu_trace", scopeMTU, true, req.Target, req, func() (service.MTUTraceResponse, error) {
+		return g.inner.MTUTrace(ctx, req)
+	})
+}
+
+func (g guardedMCPService) SpeedTest(ctx context.Context, req service.SpeedTestRequest) (service.SpeedTestResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_speed_test", scopeSpeed, true, req.EndpointIP, req, func() (service.SpeedTestResponse, error) {
+		return g.inner.SpeedTest(ctx, req)
+	})
+}
+
+func (g guardedMCPService) AnnotateIPs(ctx context.Context, req service.AnnotateIPsRequest) (service.AnnotateIPsResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_annotate_ips", scopeGeo, false, "", nil, func() (service.AnnotateIPsResponse, error) {
+		return g.inner.AnnotateIPs(ctx, req)
+	})
+}
+
+func (g guardedMCPService) GeoLookup(ctx context.Context, req service.GeoLookupRequest) (service.GeoLookupResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_geo_lookup", scopeGeo, false, req.Query, nil, func() (service.GeoLookupResponse, error) {
+		return g.inner.GeoLookup(ctx, req)
+	})
+}
+
+func (g guardedMCPService) GlobalpingTrace(ctx context.Context, req service.GlobalpingTraceRequest) (service.GlobalpingMeasurementResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_globalping_trace", scopeTrace, true, req.Target, req, func() (service.GlobalpingMeasurementResponse, error) {
+		return g.inner.GlobalpingTrace(ctx, req)
+	})
+}
+
+func (g guardedMCPService) GlobalpingLimits(ctx context.Context, req service.GlobalpingLimitsRequest) (service.GlobalpingLimitsResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_globalping_limits", scopeTrace, false, "", nil, func() (service.GlobalpingLimitsResponse, error) {
+		return g.inner.GlobalpingLimits(ctx, req)
+	})
+}
+
+func (g guardedMCPService) GlobalpingGetMeasurement(ctx context.Context, req service.GlobalpingGetMeasurementRequest) (service.GlobalpingMeasurementResponse, error) {
+	return guardMCPCall(g.caller, "nexttrace_globalping_get_measurement", scopeTrace, false, req.MeasurementID, nil, func() (service.GlobalpingMeasurementResponse, error) {
+		return g.inner.GlobalpingGetMeasurement(ctx, req)
+	})
+}
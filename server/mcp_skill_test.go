@@ -41,6 +41,7 @@ func TestNextTraceSkillFilesAndToolNames(t *testing.T) {
 		"nexttrace_traceroute",
 		"nexttrace_mtr_report",
 		"nexttrace_mtr_raw",
+		"nexttrace_dual_stack",
 		"nexttrace_mtu_trace",
 		"nexttrace_speed_test",
 		"nexttrace_annotate_ips",
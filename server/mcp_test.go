@@ -72,6 +72,13 @@ func (s *recordingMCPService) MTRRaw(_ context.Context, input service.MTRRawRequ
 	return service.MTRRawResponse{Target: "example.com", ResolvedIP: "93.184.216.34", Protocol: "icmp"}, nil
 }
 
+func (s *recordingMCPService) DualStack(_ context.Context, input service.DualStackRequest) (service.DualStackResponse, error) {
+	if err := s.record("nexttrace_dual_stack", input); err != nil {
+		return service.DualStackResponse{}, err
+	}
+	return service.DualStackResponse{Target: "example.com", Protocol: "icmp", Mode: "trace"}, nil
+}
+
 func (s *recordingMCPService) MTUTrace(_ context.Context, input service.MTUTraceRequest) (service.MTUTraceResponse, error) {
 	if err := s.record("nexttrace_mtu_trace", input); err != nil {
 		return service.MTUTraceResponse{}, err
@@ -153,6 +160,7 @@ func TestMCPHandlerRegistersAllToolsWithSchemas(t *testing.T) {
 		"nexttrace_traceroute",
 		"nexttrace_mtr_report",
 		"nexttrace_mtr_raw",
+		"nexttrace_dual_stack",
 		"nexttrace_mtu_trace",
 		"nexttrace_speed_test",
 		"nexttrace_annotate_ips",
@@ -243,6 +251,20 @@ func TestMCPHandlerCallsEveryToolWithStructuredContent(t *testing.T) {
 			},
 			wantOutputKey: "records",
 		},
+		{
+			name: "nexttrace_dual_stack",
+			args: map[string]any{
+				"target":      "example.com",
+				"mtr":         true,
+				"max_per_hop": 5,
+			},
+			wantInput: service.DualStackRequest{
+				TraceRequest: service.TraceRequest{Target: "example.com"},
+				MTR:          true,
+				MaxPerHop:    5,
+			},
+			wantOutputKey: "verdict",
+		},
 		{
 			name: "nexttrace_mtu_trace",
 			args: map[string]any{
@@ -377,7 +399,7 @@ func TestMCPHandlerReturnsServiceErrorsAsToolErrors(t *testing.T) {
 func newTestMCPSession(t *testing.T, svc nexttraceMCPService) (*mcp.ClientSession, func()) {
 	t.Helper()
 
-	ts := httptest.NewServer(newMCPHTTPHandlerWithService(svc))
+	ts := httptest.NewServer(newMCPHTTPHandlerWithService(svc, nil))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	connectOK := false
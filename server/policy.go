@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/service"
+)
+
+// deployPolicyMiddleware attaches the target policy to every request so the
+// REST and WebSocket handlers apply the same rules as the MCP tools.
+func deployPolicyMiddleware(policy *service.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy != nil {
+			c.Request = c.Request.WithContext(service.WithPolicy(c.Request.Context(), policy))
+		}
+		c.Next()
+	}
+}
+
+func policyToolForMode(mode string) string {
+	if wsTraceAction(mode) == "mtr" {
+		return service.PolicyToolMTR
+	}
+	return service.PolicyToolTrace
+}
+
+// applyTracePolicy checks the tool switch and ceilings for a web trace request
+// and fills unset hop/query values with the capped defaults.
+func applyTracePolicy(policy *service.Policy, req *traceRequest) error {
+	tool := policyToolForMode(req.Mode)
+	if err := policy.CheckTool(tool); err != nil {
+		return err
+	}
+	if tool == service.PolicyToolMTR {
+		limits, err := policy.CheckLimits(tool,
+			service.PolicyLimits{MaxHops: req.MaxHops, Queries: req.MaxRounds},
+			service.PolicyLimits{MaxHops: defaults["max_hops"].(int)})
+		if err != nil {
+			return err
+		}
+		req.MaxHops, req.MaxRounds = limits.MaxHops, limits.Queries
+		return nil
+	}
+	limits, err := policy.CheckLimits(tool,
+		service.PolicyLimits{MaxHops: req.MaxHops, Queries: req.Queries},
+		service.PolicyLimits{MaxHops: defaults["max_hops"].(int), Queries: defaults["queries"].(int)})
+	if err != nil {
+		return err
+	}
+	req.MaxHops, req.Queries = limits.MaxHops, limits.Queries
+	return nil
+}
+
+// policyErrorDetail returns the structured policy rejection inside err, or nil.
+func policyErrorDetail(err error) any {
+	var policyErr *service.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr
+	}
+	return nil
+}
+
+// traceErrorBody adds the structured policy rejection next to the message.
+func traceErrorBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	if detail := policyErrorDetail(err); detail != nil {
+		body["policy"] = detail
+	}
+	return body
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/service"
+)
+
+func TestPrepareTraceAppliesPolicyToResolvedAddress(t *testing.T) {
+	oldLookup := traceDomainLookupFn
+	traceDomainLookupFn = func(context.Context, string, string, string, bool) (net.IP, error) {
+		return net.ParseIP("10.1.2.3"), nil
+	}
+	defer func() { traceDomainLookupFn = oldLookup }()
+
+	policy, err := service.NewPolicy(service.PolicyConfig{BlockReserved: true, MaxHops: 16})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	ctx := service.WithPolicy(context.Background(), policy)
+
+	_, status, err := prepareTrace(ctx, traceRequest{Target: "rebind.example"})
+	if status != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403 (err=%v)", status, err)
+	}
+	if detail, ok := policyErrorDetail(err).(*service.PolicyError); !ok || detail.Code != service.PolicyCodeReservedTarget {
+		t.Fatalf("policy detail = %#v, want reserved_target", policyErrorDetail(err))
+	}
+
+	_, status, err = prepareTrace(ctx, traceRequest{Target: "1.1.1.1", MaxHops: 30})
+	if status != http.StatusForbidden || !strings.Contains(err.Error(), "max_hops") {
+		t.Fatalf("status=%d err=%v, want 403 max_hops", status, err)
+	}
+}
+
+func TestApplyTracePolicyCapsDefaultsPerMode(t *testing.T) {
+	policy, err := service.NewPolicy(service.PolicyConfig{MaxHops: 16, MaxQueries: 2, Tools: map[string]bool{service.PolicyToolMTR: false}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	req := traceRequest{}
+	if err := applyTracePolicy(policy, &req); err != nil {
+		t.Fatalf("applyTracePolicy(single) error = %v", err)
+	}
+	if req.MaxHops != 16 || req.Queries != 2 {
+		t.Fatalf("single request = max_hops %d queries %d, want 16/2", req.MaxHops, req.Queries)
+	}
+
+	mtr := traceRequest{Mode: "mtr"}
+	if err := applyTracePolicy(policy, &mtr); policyErrorDetail(err) == nil {
+		t.Fatalf("applyTracePolicy(mtr) error = %v, want tool_disabled", err)
+	}
+}
+
+func TestTraceHandlerReturnsStructuredPolicyError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy, err := service.NewPolicy(service.PolicyConfig{DenyCIDRs: []string{"192.0.2.0/24"}})
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+	router := gin.New()
+	router.Use(deployPolicyMiddleware(policy))
+	router.POST("/api/trace", traceHandler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/trace", strings.NewReader(`{"target":"192.0.2.7"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403 body=%s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Error  string              `json:"error"`
+		Policy service.PolicyError `json:"policy"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Policy.Code != service.PolicyCodeTargetDenied || body.Policy.Rule != "192.0.2.0/24" || body.Policy.Tool != service.PolicyToolTrace {
+		t.Fatalf("policy body = %+v", body.Policy)
+	}
+}
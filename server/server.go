@@ -15,6 +15,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/service"
 )
 
 //go:embed web/*
@@ -30,6 +32,15 @@ type Options struct {
 	EnableMCP   bool
 	AuthEnabled bool
 	DeployToken string
+	// AccessConfigPath points to a named-token file; empty falls back to the
+	// "deploy" section of nt_config.yaml.
+	AccessConfigPath string
+	// AuditLogPath overrides the audit_log configured alongside the tokens.
+	AuditLogPath string
+	// HistoryDir overrides the history directory configured alongside the
+	// tokens; empty with no configured directory disables history.
+	HistoryDir string
+	TLS        TLSOptions
 }
 
 func init() {
@@ -62,17 +73,56 @@ func RunWithOptions(opts Options, onReady func(net.Addr)) error {
 		listenAddr = defaultListenAddr
 	}
 	deployToken := strings.TrimSpace(opts.DeployToken)
-	if opts.AuthEnabled && deployToken == "" {
+	access, err := LoadAccessConfig(opts.AccessConfigPath)
+	if err != nil {
+		return err
+	}
+	tokens, err := newDeployTokenRegistry(access.Tokens)
+	if err != nil {
+		return err
+	}
+	policy, err := service.NewPolicy(access.Policy)
+	if err != nil {
+		return err
+	}
+	clientCerts := strings.TrimSpace(opts.TLS.ClientCAFile) != ""
+	if clientCerts && !opts.TLS.enabled() {
+		return errors.New("--tls-client-ca requires --tls-cert/--tls-key or --tls-self-signed")
+	}
+	if opts.AuthEnabled && deployToken == "" && tokens.size() == 0 && !clientCerts {
 		return errors.New("deploy auth enabled without token")
 	}
+	auditPath := strings.TrimSpace(opts.AuditLogPath)
+	if auditPath == "" {
+		auditPath = strings.TrimSpace(access.AuditLog)
+	}
+	audit, auditCloser, err := openAuditLog(auditPath)
+	if err != nil {
+		return err
+	}
+	if auditCloser != nil {
+		defer auditCloser.Close()
+	}
+
+	historyStore, err := openHistoryStore(opts.HistoryDir, access.History)
+	if err != nil {
+		return err
+	}
+	shareStore, err := openShareStore(opts.HistoryDir, access.History)
+	if err != nil {
+		return err
+	}
 
-	auth := deployAuth{Enabled: opts.AuthEnabled, Token: deployToken}
+	auth := deployAuth{Enabled: opts.AuthEnabled, Token: deployToken, Tokens: tokens, Audit: audit, ClientCerts: clientCerts}
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Logger(), gin.Recovery())
 	router.Use(browserAccessMiddleware())
 	registerDeployAuthRoutes(router, auth)
 	router.Use(deployAuthMiddleware(auth))
+	router.Use(deployPolicyMiddleware(policy))
+	router.Use(deployHistoryMiddleware(historyStore))
+	router.Use(deployShareMiddleware(shareStore))
 
 	router.OPTIONS("/*path", func(c *gin.Context) {
 		c.Status(http.StatusNoContent)
@@ -88,14 +138,33 @@ func RunWithOptions(opts Options, onReady func(net.Addr)) error {
 	router.POST("/api/trace", traceHandler)
 	router.POST("/api/cache/clear", cacheClearHandler)
 	router.GET("/ws/trace", traceWebsocketHandler)
+	router.GET("/api/history", historyListHandler)
+	router.GET("/api/history/:id", historyGetHandler)
+	router.DELETE("/api/history/:id", historyDeleteHandler)
+	router.POST("/api/share", shareCreateHandler)
+	router.DELETE("/api/share/:id", shareDeleteHandler)
+	router.POST("/api/export", exportHandler)
+	router.POST("/api/map", mapHandler)
+	router.GET("/share/:id", sharePageHandler)
 	if opts.EnableMCP {
-		mcpHandler := gin.WrapH(newMCPHTTPHandler())
+		mcpHandler := gin.WrapH(newMCPHTTPHandler(policy, historyStore))
 		router.GET("/mcp", mcpHandler)
 		router.POST("/mcp", mcpHandler)
 		router.DELETE("/mcp", mcpHandler)
 	}
 
 	srv := &http.Server{Addr: listenAddr, Handler: router}
+	var reloader *certReloader
+	if opts.TLS.enabled() {
+		var certInfo CertificateInfo
+		srv.TLSConfig, reloader, certInfo, err = newTLSConfig(opts.TLS, listenAddr)
+		if err != nil {
+			return err
+		}
+		if opts.TLS.OnCertificate != nil {
+			opts.TLS.OnCertificate(certInfo)
+		}
+	}
 	listener, err := listenHTTP(listenAddr)
 	if err != nil {
 		return err
@@ -106,6 +175,9 @@ func RunWithOptions(opts Options, onReady func(net.Addr)) error {
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
+	if reloader != nil {
+		go reloader.watch(ctx)
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -114,7 +186,11 @@ func RunWithOptions(opts Options, onReady func(net.Addr)) error {
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	err = srv.Serve(listener)
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(listener, "", "")
+	} else {
+		err = srv.Serve(listener)
+	}
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
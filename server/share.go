@@ -0,0 +1,373 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/history"
+)
+
+const (
+	historySourceShare    = "share"
+	maxShareRequestBytes  = 4 << 20
+	shareDirName          = "shares"
+	sharePagePrefix       = "/share/"
+	snapshotFilenameLimit = 48
+)
+
+// openShareStore keeps shared snapshots next to the history entries. Shares
+// are links handed out to other people, so they are never pruned; admins
+// remove them explicitly.
+func openShareStore(dir string, cfg HistoryConfig) (*history.Store, error) {
+	dir = historyDir(dir, cfg)
+	if dir == "" {
+		return nil, nil
+	}
+	return history.Open(filepath.Join(dir, shareDirName), history.Retention{})
+}
+
+type shareStoreKey struct{}
+
+func deployShareMiddleware(store *history.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store != nil {
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), shareStoreKey{}, store))
+		}
+		c.Next()
+	}
+}
+
+func shareStoreFromContext(ctx context.Context) *history.Store {
+	if ctx == nil {
+		return nil
+	}
+	store, _ := ctx.Value(shareStoreKey{}).(*history.Store)
+	return store
+}
+
+// isDeploySharePage reports whether path is a shared snapshot page. The
+// unguessable snapshot ID is the credential, so these pages skip deploy auth.
+func isDeploySharePage(path string) bool {
+	return strings.HasPrefix(path, sharePagePrefix) && len(path) > len(sharePagePrefix)
+}
+
+// snapshotRequest is the body of POST /api/share and POST /api/export: either
+// a saved history entry or a result the web console rendered itself.
+type snapshotRequest struct {
+	HistoryID string          `json:"history_id"`
+	Kind      string          `json:"kind"`
+	Result    json.RawMessage `json:"result"`
+}
+
+func bindSnapshotRequest(c *gin.Context) (history.Entry, bool) {
+	var req snapshotRequest
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxShareRequestBytes)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request payload too large"})
+			return history.Entry{}, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload", "details": err.Error()})
+		return history.Entry{}, false
+	}
+	entry, err := snapshotEntry(c.Request.Context(), req)
+	if err != nil {
+		var accessErr *deployAccessError
+		switch {
+		case errors.As(err, &accessErr):
+			c.JSON(accessErr.Status, gin.H{"error": accessErr.Message})
+		case errors.Is(err, history.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return history.Entry{}, false
+	}
+	return entry, true
+}
+
+func snapshotEntry(ctx context.Context, req snapshotRequest) (history.Entry, error) {
+	if id := strings.TrimSpace(req.HistoryID); id != "" {
+		if err := deployCallerFromContext(ctx).authorize(scopeHistory, false); err != nil {
+			return history.Entry{}, err
+		}
+		store := historyStoreFromContext(ctx)
+		if store == nil {
+			return history.Entry{}, history.ErrNotFound
+		}
+		return getHistoryEntry(ctx, store, id)
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	switch kind {
+	case history.KindTrace, history.KindMTR, history.KindMTU:
+	default:
+		return history.Entry{}, fmt.Errorf("unsupported result kind %q", req.Kind)
+	}
+	var head struct {
+		Target      string `json:"target"`
+		ResolvedIP  string `json:"resolved_ip"`
+		DurationMs  int64  `json:"duration_ms"`
+		TraceMapURL string `json:"trace_map_url"`
+	}
+	if len(bytes.TrimSpace(req.Result)) == 0 || json.Unmarshal(req.Result, &head) != nil {
+		return history.Entry{}, errors.New("result must be a JSON object")
+	}
+	if strings.TrimSpace(head.Target) == "" {
+		return history.Entry{}, errors.New("result target is required")
+	}
+	// The page renders trace_map_url as a link for whoever opens the share.
+	if head.TraceMapURL != "" && !isHTTPURL(head.TraceMapURL) {
+		return history.Entry{}, errors.New("result trace_map_url must be an http or https URL")
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, req.Result); err != nil {
+		return history.Entry{}, errors.New("result must be a JSON object")
+	}
+	return history.Entry{
+		Summary: history.Summary{
+			Kind:       kind,
+			Source:     historySourceWeb,
+			Target:     strings.TrimSpace(head.Target),
+			ResolvedIP: head.ResolvedIP,
+			DurationMs: head.DurationMs,
+		},
+		Result: compact.Bytes(),
+	}, nil
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func shareCreateHandler(c *gin.Context) {
+	shares := shareStoreFromContext(c.Request.Context())
+	if shares == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sharing is disabled; configure a history directory"})
+		return
+	}
+	entry, ok := bindSnapshotRequest(c)
+	if !ok {
+		return
+	}
+	entry.Source = historySourceShare
+	entry.Token = deployCallerFromContext(c.Request.Context()).tokenName()
+	saved, err := shares.Add(entry)
+	if err != nil {
+		log.Printf("[deploy] share save failed target=%s error=%v", sanitizeLogParam(entry.Target), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[deploy] share created id=%s kind=%s target=%s", saved.ID, saved.Kind, sanitizeLogParam(saved.Target))
+	path := sharePagePrefix + saved.ID
+	c.JSON(http.StatusCreated, gin.H{"id": saved.ID, "path": path, "url": requestBaseURL(c.Request) + path})
+}
+
+func sharePageHandler(c *gin.Context) {
+	entry, err := shareStoreFromContext(c.Request.Context()).Get(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, history.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.Data(status, "text/plain; charset=utf-8", []byte(http.StatusText(status)+"\n"))
+		return
+	}
+	// The link is the credential: keep it out of Referer headers and indexes.
+	h := c.Writer.Header()
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("X-Robots-Tag", "noindex")
+	download := c.Query("download") != ""
+	downloadURL := ""
+	if !download {
+		downloadURL = sharePagePrefix + entry.ID + "?download=1"
+	}
+	writeSnapshotPage(c, entry, downloadURL, download)
+}
+
+func shareDeleteHandler(c *gin.Context) {
+	shares := shareStoreFromContext(c.Request.Context())
+	if shares == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sharing is disabled; configure a history directory"})
+		return
+	}
+	if err := deployCallerFromContext(c.Request.Context()).authorize(scopeAdmin, false); err != nil {
+		c.JSON(deployAccessStatus(err, http.StatusForbidden), gin.H{"error": err.Error()})
+		return
+	}
+	if err := shares.Delete(c.Param("id")); err != nil {
+		writeHistoryError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// exportHandler returns a result as a standalone HTML file without storing it.
+func exportHandler(c *gin.Context) {
+	entry, ok := bindSnapshotRequest(c)
+	if !ok {
+		return
+	}
+	writeSnapshotPage(c, entry, "", true)
+}
+
+func writeSnapshotPage(c *gin.Context, entry history.Entry, downloadURL string, attachment bool) {
+	page, csp, err := renderSnapshotPage(entry, downloadURL)
+	if err != nil {
+		log.Printf("[deploy] snapshot render failed target=%s error=%v", sanitizeLogParam(entry.Target), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Security-Policy", csp+"; frame-ancestors 'none'")
+	if attachment {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, snapshotFilename(entry)))
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// snapshotData is what the exported page renders. Token names and request
+// parameters stay on the server.
+type snapshotData struct {
+	ID          string          `json:"id,omitempty"`
+	Kind        string          `json:"kind"`
+	Target      string          `json:"target"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Result      json.RawMessage `json:"result"`
+	DownloadURL string          `json:"download_url,omitempty"`
+}
+
+var (
+	snapshotCharset    = `<meta charset="utf-8">`
+	snapshotStylesheet = `<link rel="stylesheet" href="/assets/style.css">`
+	snapshotScriptRe   = regexp.MustCompile(`<script src="/assets/([A-Za-z0-9_.-]+\.js)" defer></script>`)
+)
+
+// renderSnapshotPage turns index.html into a single offline file: the
+// stylesheet and scripts are inlined from the embedded assets and the result
+// is handed to app.js, which renders it read-only. The page carries a
+// Content-Security-Policy that only admits those exact scripts by hash, also
+// returned for the response header.
+func renderSnapshotPage(entry history.Entry, downloadURL string) ([]byte, string, error) {
+	createdAt := entry.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+	// encoding/json escapes <, > and &, so the payload cannot close the
+	// surrounding script element.
+	data, err := json.Marshal(snapshotData{
+		ID:          entry.ID,
+		Kind:        entry.Kind,
+		Target:      entry.Target,
+		CreatedAt:   createdAt,
+		Result:      entry.Result,
+		DownloadURL: downloadURL,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	page := string(indexPage)
+	css, err := readWebAsset("style.css")
+	if err != nil {
+		return nil, "", err
+	}
+	if !strings.Contains(page, snapshotStylesheet) {
+		return nil, "", errors.New("index.html does not reference style.css")
+	}
+	page = strings.Replace(page, snapshotStylesheet, "<style>\n"+css+"\n</style>", 1)
+
+	matches := snapshotScriptRe.FindAllStringSubmatchIndex(page, -1)
+	if len(matches) == 0 {
+		return nil, "", errors.New("index.html does not reference any scripts")
+	}
+	var out strings.Builder
+	var hashes []string
+	inline := func(js string) {
+		sum := sha256.Sum256([]byte(js))
+		hashes = append(hashes, "'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+		out.WriteString("<script>" + js + "</script>")
+	}
+	last := 0
+	for i, m := range matches {
+		out.WriteString(page[last:m[0]])
+		if i == 0 {
+			inline("window.NEXTTRACE_SNAPSHOT = " + string(data) + ";")
+			out.WriteString("\n  ")
+		}
+		js, err := readWebAsset(page[m[2]:m[3]])
+		if err != nil {
+			return nil, "", err
+		}
+		if strings.Contains(strings.ToLower(js), "</script") {
+			return nil, "", fmt.Errorf("asset %s cannot be inlined", page[m[2]:m[3]])
+		}
+		inline("\n" + js + "\n")
+		last = m[1]
+	}
+	out.WriteString(page[last:])
+
+	// Inline style is allowed for the inlined stylesheet; nothing may load
+	// from elsewhere and no inline script runs unless its hash is listed.
+	csp := "default-src 'none'; script-src " + strings.Join(hashes, " ") +
+		"; style-src 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; base-uri 'none'; form-action 'none'"
+	html := out.String()
+	if !strings.Contains(html, snapshotCharset) {
+		return nil, "", errors.New("index.html does not declare its charset")
+	}
+	html = strings.Replace(html, snapshotCharset, snapshotCharset+"\n  <meta http-equiv=\"Content-Security-Policy\" content=\""+csp+"\">", 1)
+	return []byte(html), csp, nil
+}
+
+func readWebAsset(name string) (string, error) {
+	data, err := fs.ReadFile(assetsFS, name)
+	if err != nil {
+		return "", fmt.Errorf("read web asset %s: %w", name, err)
+	}
+	return string(data), nil
+}
+
+var snapshotFilenameUnsafe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+func snapshotFilename(entry history.Entry) string {
+	target := strings.Trim(snapshotFilenameUnsafe.ReplaceAllString(entry.Target, "_"), "._")
+	if len(target) > snapshotFilenameLimit {
+		target = target[:snapshotFilenameLimit]
+	}
+	if target == "" {
+		target = "result"
+	}
+	at := entry.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	kind := entry.Kind
+	if kind == "" {
+		kind = history.KindTrace
+	}
+	return fmt.Sprintf("nexttrace-%s-%s-%s.html", kind, target, at.UTC().Format("20060102-150405"))
+}
+
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if deployRequestIsHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/nxtrace/NTrace-core/internal/history"
+)
+
+func newShareTestRouter(auth deployAuth, store, shares *history.Store) *gin.Engine {
+	router := newDeployAuthTestRouter(auth)
+	router.Use(deployHistoryMiddleware(store))
+	router.Use(deployShareMiddleware(shares))
+	router.POST("/api/share", shareCreateHandler)
+	router.DELETE("/api/share/:id", shareDeleteHandler)
+	router.POST("/api/export", exportHandler)
+	router.GET("/share/:id", sharePageHandler)
+	return router
+}
+
+func postJSON(router http.Handler, path, token, body string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestRenderSnapshotPageInlinesAssets(t *testing.T) {
+	page, csp, err := renderSnapshotPage(history.Entry{
+		Summary: history.Summary{ID: "abc-1", Kind: history.KindTrace, Target: "</script><b>x"},
+		Result:  json.RawMessage(`{"target":"</script><b>x","hops":[]}`),
+	}, "")
+	if err != nil {
+		t.Fatalf("renderSnapshotPage() error = %v", err)
+	}
+	html := string(page)
+	if strings.Contains(html, `src="/assets/`) || strings.Contains(html, `href="/assets/`) {
+		t.Fatal("snapshot still references /assets; it would not open offline")
+	}
+	for _, want := range []string{"window.NEXTTRACE_SNAPSHOT = ", "nextTraceMTRAgg", "function renderHistoryView", ".result-map"} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("snapshot missing %q", want)
+		}
+	}
+	if strings.Count(html, "</script><b>x") != 0 {
+		t.Fatal("result payload was not escaped inside the script element")
+	}
+	if !strings.Contains(csp, "default-src 'none'") || !strings.Contains(csp, "script-src 'sha256-") {
+		t.Fatalf("csp = %q, want hashed scripts only", csp)
+	}
+	if !strings.Contains(html, `<meta http-equiv="Content-Security-Policy" content="`+csp+`">`) {
+		t.Fatal("snapshot does not carry its CSP for offline use")
+	}
+	scripts := regexp.MustCompile(`(?s)<script>(.*?)</script>`).FindAllStringSubmatch(html, -1)
+	if len(scripts) < 2 {
+		t.Fatalf("found %d inline scripts", len(scripts))
+	}
+	for _, m := range scripts {
+		sum := sha256.Sum256([]byte(m[1]))
+		if !strings.Contains(csp, "'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'") {
+			t.Fatalf("inline script %.40q is not allowed by the CSP", m[1])
+		}
+	}
+}
+
+func TestShareCreateAndPublicPage(t *testing.T) {
+	store := openTestHistory(t)
+	shares, err := openShareStore(t.TempDir(), HistoryConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "viewer", Token: "viewer-secret", Scopes: []string{"history"}},
+		{Name: "prober", Token: "prober-secret", Scopes: []string{"trace"}},
+	}, nil)
+	router := newShareTestRouter(auth, store, shares)
+
+	evil := `{"kind":"trace","result":{"target":"example.com","trace_map_url":"javascript:alert(1)","hops":[]}}`
+	if got := postJSON(router, "/api/share", "viewer-secret", evil).Code; got != http.StatusBadRequest {
+		t.Fatalf("share with javascript: map URL status = %d, want 400", got)
+	}
+	body := `{"kind":"trace","result":{"target":"example.com","resolved_ip":"192.0.2.1","hops":[]}}`
+	if got := postJSON(router, "/api/share", "prober-secret", body).Code; got != http.StatusForbidden {
+		t.Fatalf("share without history scope status = %d, want 403", got)
+	}
+	resp := postJSON(router, "/api/share", "viewer-secret", body)
+	var created struct {
+		ID   string `json:"id"`
+		Path string `json:"path"`
+		URL  string `json:"url"`
+	}
+	if resp.Code != http.StatusCreated || json.Unmarshal(resp.Body.Bytes(), &created) != nil {
+		t.Fatalf("share status=%d body=%s", resp.Code, resp.Body.String())
+	}
+	if created.Path != "/share/"+created.ID || !strings.HasSuffix(created.URL, created.Path) {
+		t.Fatalf("share response = %+v", created)
+	}
+	saved, err := shares.Get(created.ID)
+	if err != nil || saved.Token != "viewer" || saved.Target != "example.com" {
+		t.Fatalf("saved share = %+v, %v", saved.Summary, err)
+	}
+
+	page := serveWithToken(router, http.MethodGet, created.Path, "")
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), `"download_url":"/share/`+created.ID) {
+		t.Fatalf("public share page status=%d", page.Code)
+	}
+	if strings.Contains(page.Body.String(), `"viewer"`) {
+		t.Fatal("share page leaks the creating token name")
+	}
+	if got := page.Header().Get("Referrer-Policy"); got != "no-referrer" {
+		t.Fatalf("Referrer-Policy = %q", got)
+	}
+	if csp := page.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'sha256-") || !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Fatalf("share page CSP = %q", csp)
+	}
+	download := serveWithToken(router, http.MethodGet, created.Path+"?download=1", "")
+	if cd := download.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="nexttrace-trace-example.com-`) {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+	if got := serveWithToken(router, http.MethodGet, "/share/unknown-id", "").Code; got != http.StatusNotFound {
+		t.Fatalf("unknown share status = %d, want 404", got)
+	}
+	if got := serveWithToken(router, http.MethodDelete, "/api/share/"+created.ID, "viewer-secret").Code; got != http.StatusForbidden {
+		t.Fatalf("delete without admin status = %d, want 403", got)
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	store := openTestHistory(t)
+	entry, err := store.Add(history.Entry{
+		Summary: history.Summary{Kind: history.KindMTR, Target: "1.1.1.1", Token: "viewer"},
+		Result:  json.RawMessage(`{"target":"1.1.1.1","stats":[]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "viewer", Token: "viewer-secret", Scopes: []string{"history"}},
+		{Name: "prober", Token: "prober-secret", Scopes: []string{"trace"}},
+	}, nil)
+	router := newShareTestRouter(auth, store, nil)
+
+	resp := postJSON(router, "/api/export", "viewer-secret", `{"history_id":"`+entry.ID+`"}`)
+	if resp.Code != http.StatusOK || !strings.Contains(resp.Header().Get("Content-Disposition"), "nexttrace-mtr-1.1.1.1-") {
+		t.Fatalf("export status=%d headers=%v", resp.Code, resp.Header())
+	}
+	if got := postJSON(router, "/api/export", "prober-secret", `{"history_id":"`+entry.ID+`"}`).Code; got != http.StatusForbidden {
+		t.Fatalf("export of history without scope status = %d, want 403", got)
+	}
+	if got := postJSON(router, "/api/export", "prober-secret", `{"kind":"trace","result":{"target":"a.example","hops":[]}}`).Code; got != http.StatusOK {
+		t.Fatalf("export of on-screen result status = %d, want 200", got)
+	}
+	if got := postJSON(router, "/api/export", "prober-secret", `{"kind":"pcap","result":{"target":"a.example"}}`).Code; got != http.StatusBadRequest {
+		t.Fatalf("export of unknown kind status = %d, want 400", got)
+	}
+	if got := postJSON(router, "/api/share", "viewer-secret", `{"history_id":"`+entry.ID+`"}`).Code; got != http.StatusNotFound {
+		t.Fatalf("share with sharing disabled status = %d, want 404", got)
+	}
+}
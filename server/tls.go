@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	tlsReloadPollInterval = 5 * time.Second
+	selfSignedValidity    = 365 * 24 * time.Hour
+)
+
+// TLSOptions enables HTTPS for --deploy. TLS is on when CertFile/KeyFile are
+// set or SelfSigned is true.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// SelfSigned generates a certificate when none is configured. If CertFile
+	// and KeyFile are set but missing, the generated pair is written there so
+	// the fingerprint survives restarts.
+	SelfSigned bool
+	// ClientCAFile enables mutual TLS: client certificates signed by this CA
+	// authenticate like a deploy token.
+	ClientCAFile string
+	// OnCertificate is called once the serving certificate is loaded.
+	OnCertificate func(CertificateInfo)
+}
+
+// CertificateInfo describes the certificate the deploy server presents.
+type CertificateInfo struct {
+	Fingerprint string
+	SelfSigned  bool
+	NotAfter    time.Time
+}
+
+func (o TLSOptions) enabled() bool {
+	return o.SelfSigned || strings.TrimSpace(o.CertFile) != "" || strings.TrimSpace(o.KeyFile) != ""
+}
+
+// certReloader serves the current certificate and client CA pool and swaps
+// them when the files change or the process receives SIGHUP.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    map[string]fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newTLSConfig(opts TLSOptions, listenAddr string) (*tls.Config, *certReloader, CertificateInfo, error) {
+	certFile := strings.TrimSpace(opts.CertFile)
+	keyFile := strings.TrimSpace(opts.KeyFile)
+	if (certFile == "") != (keyFile == "") {
+		return nil, nil, CertificateInfo{}, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caFile: strings.TrimSpace(opts.ClientCAFile)}
+	info := CertificateInfo{}
+
+	generate := certFile == "" || (opts.SelfSigned && !fileExists(certFile) && !fileExists(keyFile))
+	if generate {
+		certPEM, keyPEM, err := generateSelfSignedPEM(listenAddr, time.Now())
+		if err != nil {
+			return nil, nil, CertificateInfo{}, err
+		}
+		if certFile != "" {
+			if err := writeSelfSignedPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+				return nil, nil, CertificateInfo{}, err
+			}
+		} else {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return nil, nil, CertificateInfo{}, err
+			}
+			r.cert = &cert
+		}
+		info.SelfSigned = true
+	}
+	if err := r.reload(); err != nil {
+		return nil, nil, CertificateInfo{}, err
+	}
+	info.Fingerprint, info.NotAfter = certificateFingerprint(r.current())
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.current(), nil
+		},
+	}
+	if r.caFile != "" {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		base := cfg.Clone()
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := base.Clone()
+			c.ClientCAs = r.currentClientCAs()
+			return c, nil
+		}
+	}
+	return cfg, r, info, nil
+}
+
+func (r *certReloader) current() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+func (r *certReloader) currentClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCAs
+}
+
+// reload re-reads every configured file. On error the previous material stays
+// in use.
+func (r *certReloader) reload() error {
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("load TLS certificate: %w", err)
+		}
+		cert = &loaded
+	}
+	pool, err := loadClientCAPool(r.caFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cert != nil {
+		r.cert = cert
+	}
+	r.clientCAs = pool
+	r.stamps = r.statFiles()
+	return nil
+}
+
+func (r *certReloader) statFiles() map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+	for _, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := r.statFiles()
+	if len(now) != len(r.stamps) {
+		return true
+	}
+	for path, stamp := range now {
+		if prev, ok := r.stamps[path]; !ok || !prev.modTime.Equal(stamp.modTime) || prev.size != stamp.size {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) reloadAndLog(reason string) {
+	if err := r.reload(); err != nil {
+		log.Printf("[deploy] TLS reload (%s) failed, keeping previous certificate: %v", reason, err)
+		return
+	}
+	fingerprint, notAfter := certificateFingerprint(r.current())
+	log.Printf("[deploy] TLS certificate reloaded (%s) sha256=%s not_after=%s", reason, fingerprint, notAfter.Format(time.RFC3339))
+}
+
+// watch reloads on SIGHUP and when the watched files change on disk.
+func (r *certReloader) watch(ctx context.Context) {
+	if r.certFile == "" && r.caFile == "" {
+		return
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(tlsReloadPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reloadAndLog("SIGHUP")
+		case <-ticker.C:
+			if r.changed() {
+				r.reloadAndLog("file change")
+			}
+		}
+	}
+}
+
+func loadClientCAPool(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read TLS client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("TLS client CA %s contains no PEM certificates", path)
+	}
+	return pool, nil
+}
+
+func certificateFingerprint(cert *tls.Certificate) (string, time.Time) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return "", time.Time{}
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	var notAfter time.Time
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		notAfter = leaf.NotAfter
+	}
+	return formatFingerprint(sum[:]), notAfter
+}
+
+func formatFingerprint(sum []byte) string {
+	hexed := strings.ToUpper(hex.EncodeToString(sum))
+	parts := make([]string, 0, len(sum))
+	for i := 0; i < len(hexed); i += 2 {
+		parts = append(parts, hexed[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+func generateSelfSignedPEM(listenAddr string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate TLS key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate TLS serial: %w", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "NextTrace deploy", Organization: []string{"NextTrace"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	tmpl.DNSNames, tmpl.IPAddresses = selfSignedSubjects(listenAddr)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create self-signed certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode TLS key: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// selfSignedSubjects covers loopback, the host name and the listen host.
+func selfSignedSubjects(listenAddr string) ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		dnsNames = append(dnsNames, hostname)
+	}
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return dnsNames, ips
+	}
+	host = strings.Trim(host, "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		if !ip.IsUnspecified() && !ip.IsLoopback() {
+			ips = append(ips, ip)
+		}
+	} else if host != "" && !strings.EqualFold(host, "localhost") {
+		dnsNames = append(dnsNames, host)
+	}
+	return dnsNames, ips
+}
+
+func writeSelfSignedPair(certFile, keyFile string, certPEM, keyPEM []byte) error {
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("write TLS key: %w", err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return fmt.Errorf("write TLS certificate: %w", err)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// clientCertificateName returns the subject of a verified mTLS client
+// certificate, or "" when the request did not present one.
+func clientCertificateName(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	leaf := state.VerifiedChains[0][0]
+	if name := strings.TrimSpace(leaf.Subject.CommonName); name != "" {
+		return name
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	if len(leaf.EmailAddresses) > 0 {
+		return leaf.EmailAddresses[0]
+	}
+	return leaf.SerialNumber.String()
+}
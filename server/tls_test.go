@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTLSConfigGeneratesSelfSignedCertificate(t *testing.T) {
+	cfg, reloader, info, err := newTLSConfig(TLSOptions{SelfSigned: true}, "192.0.2.5:1080")
+	if err != nil {
+		t.Fatalf("newTLSConfig() error = %v", err)
+	}
+	if !info.SelfSigned || len(strings.Split(info.Fingerprint, ":")) != 32 {
+		t.Fatalf("info = %+v, want self-signed SHA-256 fingerprint", info)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.ClientAuth != tls.NoClientCert {
+		t.Fatalf("config min=%x auth=%v", cfg.MinVersion, cfg.ClientAuth)
+	}
+	cert, err := cfg.GetCertificate(nil)
+	if err != nil || cert != reloader.current() {
+		t.Fatalf("GetCertificate() = %v, %v", cert, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	if err := leaf.VerifyHostname("192.0.2.5"); err != nil {
+		t.Fatalf("certificate does not cover listen host: %v", err)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Fatalf("certificate does not cover localhost: %v", err)
+	}
+}
+
+func TestNewTLSConfigWritesSelfSignedPairToMissingPaths(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "deploy.crt")
+	keyFile := filepath.Join(dir, "deploy.key")
+	opts := TLSOptions{CertFile: certFile, KeyFile: keyFile, SelfSigned: true}
+
+	_, _, first, err := newTLSConfig(opts, "127.0.0.1:1080")
+	if err != nil {
+		t.Fatalf("newTLSConfig() error = %v", err)
+	}
+	fi, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("key not written: %v", err)
+	}
+	if fi.Mode().Perm()&0o077 != 0 {
+		t.Fatalf("key mode = %v, want owner-only", fi.Mode().Perm())
+	}
+
+	_, _, second, err := newTLSConfig(opts, "127.0.0.1:1080")
+	if err != nil {
+		t.Fatalf("newTLSConfig(restart) error = %v", err)
+	}
+	if second.SelfSigned || second.Fingerprint != first.Fingerprint {
+		t.Fatalf("restart info = %+v, want the stored certificate %s reused", second, first.Fingerprint)
+	}
+}
+
+func TestNewTLSConfigRequiresCertAndKeyTogether(t *testing.T) {
+	_, _, _, err := newTLSConfig(TLSOptions{CertFile: "deploy.crt"}, "127.0.0.1:1080")
+	if err == nil || !strings.Contains(err.Error(), "--tls-key") {
+		t.Fatalf("error = %v, want cert/key pairing error", err)
+	}
+	_, _, _, err = newTLSConfig(TLSOptions{CertFile: filepath.Join(t.TempDir(), "missing.crt"), KeyFile: "missing.key"}, "127.0.0.1:1080")
+	if err == nil {
+		t.Fatal("newTLSConfig() with missing files and no --tls-self-signed should fail")
+	}
+}
+
+func TestCertReloaderPicksUpReplacedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "deploy.crt")
+	keyFile := filepath.Join(dir, "deploy.key")
+	_, reloader, info, err := newTLSConfig(TLSOptions{CertFile: certFile, KeyFile: keyFile, SelfSigned: true}, "127.0.0.1:1080")
+	if err != nil {
+		t.Fatalf("newTLSConfig() error = %v", err)
+	}
+	if reloader.changed() {
+		t.Fatal("changed() = true right after load")
+	}
+
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !reloader.changed() {
+		t.Fatal("changed() = false after rewriting the certificate")
+	}
+	reloader.reloadAndLog("test")
+	if got, _ := certificateFingerprint(reloader.current()); got != info.Fingerprint {
+		t.Fatalf("broken file replaced the serving certificate: %s", got)
+	}
+
+	certPEM, keyPEM, err := generateSelfSignedPEM("127.0.0.1:1080", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSelfSignedPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	if got, _ := certificateFingerprint(reloader.current()); got == info.Fingerprint || got == "" {
+		t.Fatalf("fingerprint after reload = %q, want a new certificate", got)
+	}
+}
+
+func tlsStateFor(cn string) *tls.ConnectionState {
+	leaf := &x509.Certificate{Subject: pkix.Name{CommonName: cn}, SerialNumber: big.NewInt(7)}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+}
+
+func TestDeployAuthAcceptsVerifiedClientCertificate(t *testing.T) {
+	router := newScopedTestRouter(deployAuth{Enabled: true, ClientCerts: true})
+
+	serve := func(state *tls.ConnectionState) int {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/api/trace", nil)
+		req.Header.Set("Accept", "application/json")
+		req.TLS = state
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	if got := serve(tlsStateFor("ops-laptop")); got != http.StatusOK {
+		t.Fatalf("verified client certificate status = %d, want 200", got)
+	}
+	if got := serve(&tls.ConnectionState{}); got != http.StatusUnauthorized {
+		t.Fatalf("unverified TLS status = %d, want 401", got)
+	}
+	if got := serve(nil); got != http.StatusUnauthorized {
+		t.Fatalf("plain request status = %d, want 401", got)
+	}
+}
+
+func TestDeployAuthClientCertificateMapsToNamedToken(t *testing.T) {
+	auth := newNamedTokenTestAuth(t, []TokenConfig{
+		{Name: "ci", Token: "ci-secret", Scopes: []string{"trace"}},
+	}, nil)
+	auth.ClientCerts = true
+
+	if p := auth.certPrincipal("ci"); p == nil || p.Name != "ci" {
+		t.Fatalf("certPrincipal(ci) = %+v, want the ci token", p)
+	}
+	if p := auth.certPrincipal("stranger"); p != nil {
+		t.Fatalf("certPrincipal(stranger) = %+v, want nil without a matching token", p)
+	}
+	if p := (deployAuth{ClientCerts: true}).certPrincipal("ops"); p == nil || p.Name != "cert:ops" {
+		t.Fatalf("certPrincipal without named tokens = %+v, want cert:ops", p)
+	}
+}
+
+func TestClientCertificateNameFallsBack(t *testing.T) {
+	leaf := &x509.Certificate{DNSNames: []string{"probe.example"}, SerialNumber: big.NewInt(1)}
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	if got := clientCertificateName(state); got != "probe.example" {
+		t.Fatalf("clientCertificateName() = %q, want DNS SAN", got)
+	}
+}
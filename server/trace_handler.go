@@ -74,6 +74,7 @@ type traceRequest struct {
 	PacketInterval    int    `json:"packet_interval"`
 	TTLInterval       int    `json:"ttl_interval"`
 	MaxAttempts       int    `json:"max_attempts"`
+	UDPPayload        string `json:"udp_payload"`
 	AlwaysWaitRDNS    bool   `json:"always_wait_rdns"`
 	Maptrace          *bool  `json:"maptrace"` // deprecated toggle compatibility
 	LanguageOverride  string `json:"language_override"`
@@ -92,6 +93,10 @@ type hopAttempt struct {
 	Error    string           `json:"error,omitempty"`
 	MPLS     []string         `json:"mpls,omitempty"`
 	Geo      *ipgeo.IPGeoData `json:"geo,omitempty"`
+
+	ReplyTTL   int  `json:"reply_ttl,omitempty"`
+	ReturnHops int  `json:"return_hops,omitempty"`
+	Asymmetric bool `json:"asymmetric,omitempty"`
 }
 
 type hopResponse struct {
@@ -155,6 +160,21 @@ func resolveTraceProtocol(req traceRequest) (traceProtocolSelection, int, error)
 		method = trace.UDPTrace
 	case "tcp":
 		method = trace.TCPTrace
+	case "sctp":
+		method = trace.SCTPTrace
+	}
+
+	udpPayload, err := trace.ParseUDPPayloadProfile(req.UDPPayload)
+	if err != nil {
+		return traceProtocolSelection{}, http.StatusBadRequest, err
+	}
+	if udpPayload != trace.UDPPayloadRandom {
+		if method != trace.UDPTrace {
+			return traceProtocolSelection{}, http.StatusBadRequest, fmt.Errorf("udp_payload %q requires protocol udp", udpPayload)
+		}
+		if req.PacketSize != nil {
+			return traceProtocolSelection{}, http.StatusBadRequest, errors.New("udp_payload cannot be combined with packet_size")
+		}
 	}
 
 	dstPort := req.Port
@@ -162,7 +182,10 @@ func resolveTraceProtocol(req traceRequest) (traceProtocolSelection, int, error)
 		switch method {
 		case trace.UDPTrace:
 			dstPort = 33494
-		case trace.TCPTrace:
+			if port := udpPayload.DefaultPort(); port > 0 {
+				dstPort = port
+			}
+		case trace.TCPTrace, trace.SCTPTrace:
 			dstPort = 80
 		}
 	}
@@ -217,11 +240,19 @@ func prepareTrace(ctx context.Context, req traceRequest) (*traceExecution, int,
 	if statusCode, err := normalizeTraceRequest(&exec.Req); err != nil {
 		return nil, statusCode, err
 	}
+	policy := service.PolicyFromContext(ctx)
+	if err := applyTracePolicy(policy, &exec.Req); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	tool := policyToolForMode(exec.Req.Mode)
 
 	target, err := normalizeTarget(exec.Req.Target)
 	if err != nil {
 		return nil, http.StatusBadRequest, err
 	}
+	if err := policy.CheckHost(tool, target); err != nil {
+		return nil, http.StatusForbidden, err
+	}
 	exec.Target = target
 
 	protocol, statusCode, err := resolveTraceProtocol(exec.Req)
@@ -236,6 +267,9 @@ func prepareTrace(ctx context.Context, req traceRequest) (*traceExecution, int,
 	if err != nil {
 		return nil, http.StatusInternalServerError, err
 	}
+	if err := policy.CheckIP(tool, target, ip); err != nil {
+		return nil, http.StatusForbidden, err
+	}
 	exec.IP = ip
 
 	exec.DataProvider = dataProvider
@@ -267,8 +301,22 @@ func traceHandler(c *gin.Context) {
 		return
 	}
 
-	setup, statusCode, err := prepareTrace(c.Request.Context(), req)
+	caller := deployCallerFromContext(c.Request.Context())
+	var auditErr error
+	defer func() {
+		caller.record("trace", req.Target, traceAuditParams(req), auditErr)
+	}()
+	if err := caller.authorize(scopeTrace, true); err != nil {
+		auditErr = err
+		c.JSON(deployAccessStatus(err, http.StatusForbidden), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := service.PolicyFromContext(c.Request.Context()).WithDeadline(c.Request.Context())
+	defer cancel()
+	setup, statusCode, err := prepareTrace(ctx, req)
 	if err != nil {
+		auditErr = err
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return
 		}
@@ -276,7 +324,7 @@ func traceHandler(c *gin.Context) {
 			statusCode = 500
 		}
 		log.Printf("[deploy] prepare trace failed target=%s error=%v", sanitizeLogParam(req.Target), err)
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		c.JSON(statusCode, traceErrorBody(err))
 		return
 	}
 
@@ -291,6 +339,7 @@ func traceHandler(c *gin.Context) {
 			ensureLeoMoeConnection()
 			return struct{}{}, nil
 		}); err != nil {
+			auditErr = err
 			log.Printf("[deploy] failed to initialize LeoMoeAPI connection target=%s error=%v", sanitizeLogParam(setup.Target), err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -306,6 +355,7 @@ func traceHandler(c *gin.Context) {
 	})
 	duration := time.Since(start)
 	if err != nil {
+		auditErr = err
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return
 		}
@@ -331,9 +381,32 @@ func traceHandler(c *gin.Context) {
 	}
 
 	log.Printf("[deploy] trace completed target=%s hops=%d duration=%s", sanitizeLogParam(setup.Target), len(response.Hops), duration)
+	saveTraceHistory(c.Request.Context(), historySourceAPI, setup, response)
 	c.JSON(200, response)
 }
 
+// traceAuditParams keeps the audit log focused on what was probed and how.
+func traceAuditParams(req traceRequest) map[string]any {
+	params := map[string]any{
+		"protocol": req.Protocol,
+		"queries":  req.Queries,
+		"max_hops": req.MaxHops,
+	}
+	if req.Port > 0 {
+		params["port"] = req.Port
+	}
+	if req.Mode != "" {
+		params["mode"] = req.Mode
+	}
+	if req.SourceAddress != "" {
+		params["source_address"] = req.SourceAddress
+	}
+	if req.SourceDevice != "" {
+		params["source_device"] = req.SourceDevice
+	}
+	return params
+}
+
 func buildTraceConfig(req traceRequest, method trace.Method, ip net.IP, dataProvider string, port int) (trace.Config, error) {
 	lang := strings.TrimSpace(req.Language)
 	if lang == "" {
@@ -349,6 +422,13 @@ func buildTraceConfig(req traceRequest, method trace.Method, ip net.IP, dataProv
 	if req.PacketSize != nil {
 		packetSize = *req.PacketSize
 	}
+	udpPayload, err := trace.ParseUDPPayloadProfile(req.UDPPayload)
+	if err != nil {
+		return trace.Config{}, err
+	}
+	if size, ok := trace.UDPPayloadPacketSize(udpPayload, ip, port); ok && method == trace.UDPTrace {
+		packetSize = size
+	}
 	packetSizeSpec, err := trace.NormalizePacketSize(method, ip, packetSize)
 	if err != nil {
 		return trace.Config{}, err
@@ -422,6 +502,7 @@ func buildTraceConfig(req traceRequest, method trace.Method, ip net.IP, dataProv
 		TOS:              tos,
 		Maptrace:         !req.DisableMaptrace,
 		DisableMPLS:      req.DisableMPLS,
+		UDPPayload:       udpPayload,
 	}, nil
 }
 
@@ -509,8 +590,11 @@ func buildHopResponse(attempts []trace.Hop, idx int, lang string) hopResponse {
 
 	for _, attempt := range attempts {
 		ha := hopAttempt{
-			Success: attempt.Success,
-			MPLS:    attempt.MPLS,
+			Success:    attempt.Success,
+			MPLS:       attempt.MPLS,
+			ReplyTTL:   attempt.ReplyTTL,
+			ReturnHops: attempt.ReturnHops,
+			Asymmetric: attempt.Asymmetric,
 		}
 		if attempt.Address != nil {
 			ha.IP = attempt.Address.String()
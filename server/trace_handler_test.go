@@ -103,6 +103,39 @@ func TestBuildTraceConfig_DefaultsPacketSizeByProtocolAndFamily(t *testing.T) {
 	}
 }
 
+func TestResolveTraceProtocol_UDPPayloadDefaultsPort(t *testing.T) {
+	sel, _, err := resolveTraceProtocol(traceRequest{Protocol: "udp", UDPPayload: "stun"})
+	if err != nil {
+		t.Fatalf("resolveTraceProtocol returned error: %v", err)
+	}
+	if sel.dstPort != 3478 {
+		t.Fatalf("dstPort = %d, want 3478", sel.dstPort)
+	}
+	if _, statusCode, err := resolveTraceProtocol(traceRequest{Protocol: "tcp", UDPPayload: "dns"}); err == nil || statusCode != http.StatusBadRequest {
+		t.Fatalf("tcp with udp_payload: status=%d err=%v", statusCode, err)
+	}
+}
+
+func TestResolveTraceProtocol_SCTPDefaultsPort(t *testing.T) {
+	sel, _, err := resolveTraceProtocol(traceRequest{Protocol: "SCTP"})
+	if err != nil {
+		t.Fatalf("resolveTraceProtocol returned error: %v", err)
+	}
+	if sel.method != trace.SCTPTrace || sel.dstPort != 80 {
+		t.Fatalf("method = %q dstPort = %d, want sctp and 80", sel.method, sel.dstPort)
+	}
+}
+
+func TestBuildTraceConfig_UDPPayloadFixesPacketSize(t *testing.T) {
+	cfg, err := buildTraceConfig(traceRequest{UDPPayload: "dns"}, trace.UDPTrace, net.ParseIP("1.1.1.1"), "disable-geoip", 53)
+	if err != nil {
+		t.Fatalf("buildTraceConfig returned error: %v", err)
+	}
+	if cfg.UDPPayload != trace.UDPPayloadDNS || cfg.PktSize != 40 {
+		t.Fatalf("UDPPayload = %q PktSize = %d, want dns and 40", cfg.UDPPayload, cfg.PktSize)
+	}
+}
+
 func TestNormalizeTraceRequest_RejectsInvalidTOS(t *testing.T) {
 	tos := 256
 	statusCode, err := normalizeTraceRequest(&traceRequest{TOS: &tos})
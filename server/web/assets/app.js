@@ -8,6 +8,8 @@ const dstPortHint = document.getElementById('dst-port-hint');
 const dstPortInput = document.getElementById('dst-port');
 const payloadSizeInput = document.getElementById('payload-size');
 const tosInput = document.getElementById('tos');
+const udpPayloadSelect = document.getElementById('udp-payload');
+const udpPayloadHint = document.getElementById('udp-payload-hint');
 const modeSelect = document.getElementById('mode');
 const statusNode = document.getElementById('status');
 const resultNode = document.getElementById('result');
@@ -28,11 +30,26 @@ const labelDisableMap = document.getElementById('label-disable-map');
 const labelDstPort = document.getElementById('label-dst-port');
 const labelPSize = document.getElementById('label-psize');
 const labelTOS = document.getElementById('label-tos');
+const labelUDPPayload = document.getElementById('label-udp-payload');
 const labelMode = document.getElementById('label-mode');
 const targetInput = document.getElementById('target');
 const groupBasicParams = document.getElementById('group-basic-params');
 const groupAdvancedParams = document.getElementById('group-advanced-params');
 const groupDisableMap = document.getElementById('group-disable-map');
+const historyPanel = document.getElementById('history-panel');
+const historyTitle = document.getElementById('history-title');
+const historyRefreshBtn = document.getElementById('history-refresh');
+const historyFilterForm = document.getElementById('history-filter');
+const historyTargetInput = document.getElementById('history-target');
+const historyASNInput = document.getElementById('history-asn');
+const historyFromInput = document.getElementById('history-from');
+const historyToInput = document.getElementById('history-to');
+const historySearchBtn = document.getElementById('history-search');
+const historyList = document.getElementById('history-list');
+const resultActions = document.getElementById('result-actions');
+const shareBtn = document.getElementById('share-btn');
+const exportBtn = document.getElementById('export-btn');
+const resultMapNode = document.getElementById('result-map');
 
 const wsScheme = window.location.protocol === 'https:' ? 'wss' : 'ws';
 const wsUrl = `${wsScheme}://${window.location.host}/ws/trace`;
@@ -54,7 +71,13 @@ let mtrRenderTimer = null;
 let mtrRenderRAF = null;
 let mtrRenderLastAt = 0;
 let mtrRawKnownFinalTTL = Infinity;
+let historyView = null;
+let historyEntries = [];
+let historyRefreshTimer = null;
+const HISTORY_REFRESH_DELAY_MS = 800;
 const traceFormHelpers = globalThis.NextTraceForm || {};
+// Set by shared and exported pages, which render one saved result read-only.
+const snapshot = globalThis.NEXTTRACE_SNAPSHOT || null;
 
 const uiText = {
   cn: {
@@ -70,6 +93,7 @@ const uiText = {
     labelDstPort: '目的端口',
     labelPSize: '探测包大小',
     labelTOS: 'TOS',
+    labelUDPPayload: 'UDP 载荷',
     labelMode: '探测模式',
     buttonStartSingle: '开始探测',
     buttonStartMtr: '开始持续探测',
@@ -117,11 +141,34 @@ const uiText = {
     unknownAddress: '未知地址',
     unknownError: '未知错误',
     hintDstPort: '仅 TCP/UDP 模式有效',
+    hintUDPPayload: '仅 UDP 模式有效；协议载荷的大小固定，忽略探测包大小',
     attemptBadge: '探测',
     noResult: '未获取到有效路由信息。',
     footer: '当前会话仅提供基础功能，更多高级选项请使用 CLI。',
     modeSingle: '单次探测',
     modeMTR: '持续探测',
+    historyTitle: '历史记录',
+    historyRefresh: '刷新',
+    historyFilter: '筛选',
+    historyTargetPlaceholder: '目标或 IP',
+    historyEmpty: '暂无历史记录。',
+    historyLoadFailed: '无法加载历史记录:',
+    historyViewing: '正在查看历史记录',
+    historyKindTrace: '路由',
+    historyKindMTR: 'MTR',
+    historyKindMTU: 'MTU',
+    colEvent: '事件',
+    colPMTU: 'PMTU',
+    metaPathMTU: '路径 MTU',
+    buttonShare: '分享',
+    buttonExport: '导出 HTML',
+    statusSharing: '正在生成分享链接…',
+    statusShared: '分享链接：',
+    statusShareCopied: '分享链接已复制：',
+    statusShareFailed: '分享失败:',
+    statusExportFailed: '导出失败:',
+    snapshotViewing: '共享的探测结果',
+    mapCaption: '跳点地理位置（离线示意，无底图）',
   },
   en: {
     title: 'NextTrace Web',
@@ -136,6 +183,7 @@ const uiText = {
     labelDstPort: 'Destination Port',
     labelPSize: 'Probe Packet Size',
     labelTOS: 'TOS',
+    labelUDPPayload: 'UDP Payload',
     labelMode: 'Mode',
     buttonStartSingle: 'Start Trace',
     buttonStartMtr: 'Start Continuous Trace',
@@ -183,11 +231,34 @@ const uiText = {
     unknownAddress: 'Unknown',
     unknownError: 'Unknown error',
     hintDstPort: 'Active for TCP/UDP only',
+    hintUDPPayload: 'UDP only; protocol payloads have a fixed size and ignore the packet size',
     attemptBadge: 'Probe',
     noResult: 'No valid hops collected yet.',
     footer: 'For advanced options, please use the CLI.',
     modeSingle: 'Single Trace',
     modeMTR: 'Continuous Trace',
+    historyTitle: 'History',
+    historyRefresh: 'Refresh',
+    historyFilter: 'Filter',
+    historyTargetPlaceholder: 'Target or IP',
+    historyEmpty: 'No history yet.',
+    historyLoadFailed: 'Failed to load history:',
+    historyViewing: 'Viewing saved result',
+    historyKindTrace: 'Trace',
+    historyKindMTR: 'MTR',
+    historyKindMTU: 'MTU',
+    colEvent: 'Event',
+    colPMTU: 'PMTU',
+    metaPathMTU: 'Path MTU',
+    buttonShare: 'Share',
+    buttonExport: 'Export HTML',
+    statusSharing: 'Creating share link…',
+    statusShared: 'Share link:',
+    statusShareCopied: 'Share link copied:',
+    statusShareFailed: 'Share failed:',
+    statusExportFailed: 'Export failed:',
+    snapshotViewing: 'Shared result',
+    mapCaption: 'Hop locations (offline sketch, no base map)',
   },
 };
 
@@ -236,6 +307,7 @@ async function loadOptions() {
     payloadSizeInput.value = defaultOptionValue(data.defaultOptions, 'packet_size', payloadSizeInput.value || '') ?? '';
     tosInput.value = defaultOptionValue(data.defaultOptions, 'tos', tosInput.value || 0);
     dstPortInput.value = data.defaultOptions.port || dstPortInput.value || '';
+    fillSelect(udpPayloadSelect, data.udpPayloads || ['random'], defaultOptionValue(data.defaultOptions, 'udp_payload', 'random'));
     updateDstPortState();
     updateModeUI();
   } catch (err) {
@@ -272,6 +344,8 @@ function clearResult(resetState = false) {
   resultNode.classList.add('hidden');
   resultMetaNode.innerHTML = '';
   resultMetaNode.classList.add('hidden');
+  resultMapNode.innerHTML = '';
+  resultMapNode.classList.add('hidden');
   if (resetState) {
     hopStore.clear();
     latestSummary = {};
@@ -280,9 +354,11 @@ function clearResult(resetState = false) {
     mtrRawOrderSeq = 0;
     mtrRenderLastAt = 0;
     mtrRawKnownFinalTTL = Infinity;
+    historyView = null;
     stopBtn.classList.add('hidden');
     stopBtn.disabled = true;
   }
+  updateResultActions();
 }
 
 function renderMeta(summary = {}) {
@@ -299,9 +375,13 @@ function renderMeta(summary = {}) {
   if (summary.iteration) {
     rows.push(`${t('metaIterations')}：<strong>${escapeHTML(summary.iteration)}</strong>`);
   }
-  if (summary.trace_map_url) {
+  if (summary.path_mtu) {
+    rows.push(`${t('metaPathMTU')}：<strong>${escapeHTML(summary.path_mtu)}</strong>`);
+  }
+  const mapURL = safeLinkURL(summary.trace_map_url);
+  if (mapURL) {
     // t('mapOpen') is assumed not user-supplied; escape only the URL
-    rows.push(`${t('metaMap')}：<a href="${escapeHTML(summary.trace_map_url)}" target="_blank" rel="noreferrer">${t('mapOpen')}</a>`);
+    rows.push(`${t('metaMap')}：<a href="${escapeHTML(mapURL)}" target="_blank" rel="noreferrer">${t('mapOpen')}</a>`);
   }
   if (rows.length === 0) {
     resultMetaNode.classList.add('hidden');
@@ -589,6 +669,22 @@ function renderHopsFromStore() {
   renderHops(hops);
 }
 
+// safeLinkURL returns raw when it is an absolute http(s) URL. Shared and
+// exported results come from other users, so javascript: and similar schemes
+// must never reach an href.
+function safeLinkURL(raw) {
+  if (!raw) {
+    return '';
+  }
+  let url;
+  try {
+    url = new URL(String(raw));
+  } catch (err) {
+    return '';
+  }
+  return url.protocol === 'http:' || url.protocol === 'https:' ? url.href : '';
+}
+
 function escapeHTML(str) {
   return String(str)
     .replace(/&/g, '&amp;')
@@ -624,6 +720,7 @@ function buildPayload() {
     dstPort: dstPortInput.value,
     packetSize: payloadSizeInput.value,
     tos: tosInput.value,
+    udpPayload: udpPayloadSelect.value,
   });
   if (payload.mode === 'mtr' && queriesInput.value !== '10') {
     queriesInput.value = '10';
@@ -802,6 +899,8 @@ function handleSocketMessage(event) {
       }
       setStatus('success', 'statusSuccess');
       closeExistingSocket();
+      updateResultActions();
+      scheduleHistoryRefresh();
       break;
     }
     case 'error': {
@@ -811,6 +910,7 @@ function handleSocketMessage(event) {
       const text = msg.error || t('statusTraceFailed');
       setStatus('error', text, !msg.error);
       closeExistingSocket();
+      updateResultActions();
       break;
     }
     default:
@@ -912,7 +1012,9 @@ async function clearCache(silent = false) {
 function toggleLanguage() {
   currentLang = currentLang === 'cn' ? 'en' : 'cn';
   applyTranslations();
-  clearCache(true);
+  if (!snapshot) {
+    clearCache(true);
+  }
 }
 
 function applyTranslations() {
@@ -929,13 +1031,17 @@ function applyTranslations() {
   labelDstPort.textContent = t('labelDstPort');
   labelPSize.textContent = t('labelPSize');
   labelTOS.textContent = t('labelTOS');
+  labelUDPPayload.textContent = t('labelUDPPayload');
   labelMode.textContent = t('labelMode');
   dstPortHint.textContent = t('hintDstPort');
+  udpPayloadHint.textContent = t('hintUDPPayload');
   targetInput.placeholder = t('placeholderTarget');
   updateStartButtonText();
   cacheBtn.textContent = t('buttonClearCache');
   langToggleBtn.textContent = t('langToggle');
   stopBtn.textContent = t('buttonStop');
+  shareBtn.textContent = t('buttonShare');
+  exportBtn.textContent = t('buttonExport');
   const options = modeSelect.options;
   if (options.length >= 2) {
     options[0].textContent = t('modeSingle');
@@ -947,11 +1053,14 @@ function applyTranslations() {
   groupAdvancedParams.classList.toggle('hidden', isMtr);
   groupDisableMap.classList.toggle('hidden', isMtr);
   renderMeta(latestSummary);
-  if (currentMode === 'mtr') {
+  if (historyView) {
+    renderHistoryView();
+  } else if (currentMode === 'mtr') {
     renderMTRStats(mtrStatsStore);
   } else {
     renderHopsFromStore();
   }
+  applyHistoryTranslations();
   refreshStatus();
   updateModeUI();
   updateDstPortState();
@@ -960,23 +1069,42 @@ function applyTranslations() {
 
 function updateDstPortState() {
   const proto = (protocolSelect.value || '').toLowerCase();
-  const enabled = proto === 'tcp' || proto === 'udp';
+  const enabled = proto === 'tcp' || proto === 'udp' || proto === 'sctp';
   dstPortInput.disabled = !enabled;
   dstPortInput.parentElement.classList.toggle('disabled', !enabled);
   if (!enabled) {
     dstPortInput.value = '';
   } else if (!dstPortInput.value) {
-    dstPortInput.value = proto === 'tcp' ? '80' : '33494';
+    dstPortInput.value = proto === 'udp' ? '33494' : '80';
   }
+  const udp = proto === 'udp';
+  udpPayloadSelect.disabled = !udp;
+  udpPayloadSelect.parentElement.classList.toggle('disabled', !udp);
+}
+
+// Follow the payload profile's well-known port unless the user typed their own.
+function updateUDPPayloadPort(previous) {
+  const portFor = traceFormHelpers.udpPayloadDefaultPort || (() => 0);
+  const current = dstPortInput.value;
+  if (current !== '' && current !== '33494' && current !== String(portFor(previous))) {
+    return;
+  }
+  dstPortInput.value = String(portFor(udpPayloadSelect.value) || 33494);
 }
 
 document.addEventListener('DOMContentLoaded', () => {
   applyTranslations();
   updateModeUI();
   setStatus('idle', 'statusReady');
+  langToggleBtn.addEventListener('click', toggleLanguage);
+  shareBtn.addEventListener('click', shareResult);
+  exportBtn.addEventListener('click', exportResult);
+  if (snapshot) {
+    openSnapshot();
+    return;
+  }
   loadOptions();
   form.addEventListener('submit', runTrace);
-  langToggleBtn.addEventListener('click', toggleLanguage);
   cacheBtn.addEventListener('click', () => clearCache(false));
   providerSelect.addEventListener('change', () => clearCache(true));
   protocolSelect.addEventListener('change', () => {
@@ -984,6 +1112,12 @@ document.addEventListener('DOMContentLoaded', () => {
     clearCache(true);
   });
   payloadSizeInput.addEventListener('change', () => clearCache(true));
+  let lastUDPPayload = udpPayloadSelect.value;
+  udpPayloadSelect.addEventListener('change', () => {
+    updateUDPPayloadPort(lastUDPPayload);
+    lastUDPPayload = udpPayloadSelect.value;
+    clearCache(true);
+  });
   queriesInput.addEventListener('input', () => {
     if (!queriesInput.disabled) {
       singleModeQueriesValue = queriesInput.value;
@@ -991,6 +1125,12 @@ document.addEventListener('DOMContentLoaded', () => {
   });
   modeSelect.addEventListener('change', updateModeUI);
   stopBtn.addEventListener('click', stopTrace);
+  historyRefreshBtn.addEventListener('click', loadHistory);
+  historyFilterForm.addEventListener('submit', (evt) => {
+    evt.preventDefault();
+    loadHistory();
+  });
+  loadHistory();
 });
 
 function updateStartButtonText() {
@@ -1051,6 +1191,8 @@ function stopTrace() {
   closeExistingSocket();
   submitBtn.disabled = false;
   setStatus('idle', 'statusReady');
+  updateResultActions();
+  scheduleHistoryRefresh();
 }
 
 function mtrRawKey(rec) {
@@ -1367,3 +1509,471 @@ function formatGeoDisplay(geo) {
   }
   return parts.filter(Boolean).join(' · ');
 }
+
+function applyHistoryTranslations() {
+  historyTitle.textContent = t('historyTitle');
+  historyRefreshBtn.textContent = t('historyRefresh');
+  historySearchBtn.textContent = t('historyFilter');
+  historyTargetInput.placeholder = t('historyTargetPlaceholder');
+  renderHistoryList(historyEntries);
+}
+
+function scheduleHistoryRefresh() {
+  if (historyPanel.classList.contains('hidden')) {
+    return;
+  }
+  if (historyRefreshTimer !== null) {
+    clearTimeout(historyRefreshTimer);
+  }
+  // MTR sessions are saved when the server side of the socket winds down.
+  historyRefreshTimer = setTimeout(() => {
+    historyRefreshTimer = null;
+    loadHistory();
+  }, HISTORY_REFRESH_DELAY_MS);
+}
+
+async function loadHistory() {
+  const params = new URLSearchParams({limit: '50'});
+  const filters = {
+    target: historyTargetInput.value.trim(),
+    asn: historyASNInput.value.trim(),
+    from: historyFromInput.value,
+    to: historyToInput.value,
+  };
+  Object.entries(filters).forEach(([key, value]) => {
+    if (value) {
+      params.set(key, value);
+    }
+  });
+  let res;
+  try {
+    res = await fetch(`/api/history?${params.toString()}`, {headers: {Accept: 'application/json'}});
+  } catch (_) {
+    return;
+  }
+  // History is optional on the server and may be outside the token's scopes.
+  if (res.status === 401 || res.status === 403 || res.status === 404) {
+    historyPanel.classList.add('hidden');
+    updateResultActions();
+    return;
+  }
+  historyPanel.classList.remove('hidden');
+  updateResultActions();
+  if (!res.ok) {
+    const errRes = await res.json().catch(() => ({}));
+    setStatus('error', `${t('historyLoadFailed')} ${errRes.error || `HTTP ${res.status}`}`, false);
+    return;
+  }
+  const data = await res.json().catch(() => ({}));
+  historyEntries = Array.isArray(data.entries) ? data.entries : [];
+  renderHistoryList(historyEntries);
+}
+
+function historyKindLabel(kind) {
+  switch (kind) {
+    case 'mtr':
+      return t('historyKindMTR');
+    case 'mtu':
+      return t('historyKindMTU');
+    default:
+      return t('historyKindTrace');
+  }
+}
+
+function renderHistoryList(entries) {
+  historyList.innerHTML = '';
+  if (!entries || entries.length === 0) {
+    const empty = document.createElement('li');
+    empty.className = 'history__empty';
+    empty.textContent = t('historyEmpty');
+    historyList.appendChild(empty);
+    return;
+  }
+  entries.forEach((entry) => {
+    const item = document.createElement('li');
+    item.className = 'history__item';
+    if (historyView && historyView.id === entry.id) {
+      item.classList.add('history__item--active');
+    }
+    item.tabIndex = 0;
+
+    const kind = document.createElement('span');
+    kind.className = 'history__kind';
+    kind.textContent = historyKindLabel(entry.kind);
+    item.appendChild(kind);
+
+    const target = document.createElement('span');
+    target.className = 'history__target';
+    target.textContent = entry.resolved_ip && entry.resolved_ip !== entry.target
+      ? `${entry.target} (${entry.resolved_ip})`
+      : entry.target;
+    item.appendChild(target);
+
+    const meta = document.createElement('span');
+    meta.className = 'history__meta';
+    const when = new Date(entry.created_at);
+    const parts = [Number.isNaN(when.getTime()) ? entry.created_at : when.toLocaleString()];
+    if (entry.token) {
+      parts.push(entry.token);
+    }
+    meta.textContent = parts.join(' · ');
+    item.appendChild(meta);
+
+    const open = () => openHistoryEntry(entry.id);
+    item.addEventListener('click', open);
+    item.addEventListener('keydown', (evt) => {
+      if (evt.key === 'Enter') {
+        open();
+      }
+    });
+    historyList.appendChild(item);
+  });
+}
+
+async function openHistoryEntry(id) {
+  let entry;
+  try {
+    const res = await fetch(`/api/history/${encodeURIComponent(id)}`, {headers: {Accept: 'application/json'}});
+    if (!res.ok) {
+      const errRes = await res.json().catch(() => ({}));
+      throw new Error(errRes.error || `HTTP ${res.status}`);
+    }
+    entry = await res.json();
+  } catch (err) {
+    setStatus('error', `${t('historyLoadFailed')} ${err.message}`, false);
+    return;
+  }
+  traceCompleted = true;
+  closeExistingSocket();
+  submitBtn.disabled = false;
+  clearResult(true);
+  historyView = {id: entry.id, kind: entry.kind, createdAt: entry.created_at, result: entry.result || {}, shared: false};
+  renderHistoryView();
+  renderHistoryList(historyEntries);
+}
+
+function renderHistoryView() {
+  if (!historyView) {
+    return;
+  }
+  const result = historyView.result;
+  latestSummary = {
+    resolved_ip: result.resolved_ip,
+    data_provider: result.data_provider,
+    duration_ms: result.duration_ms,
+    trace_map_url: result.trace_map_url,
+    iteration: result.iteration,
+    path_mtu: result.path_mtu,
+  };
+  let mapResult = result;
+  if (historyView.kind === 'mtr') {
+    const stats = historyMTRStats(result);
+    mapResult = {...result, stats};
+    renderMTRStats(stats);
+  } else if (historyView.kind === 'mtu') {
+    renderMTUHops(result.hops);
+  } else {
+    hopStore.clear();
+    (result.hops || []).forEach((hop) => {
+      if (hop && typeof hop.ttl === 'number') {
+        hopStore.set(hop.ttl, hop);
+      }
+    });
+    renderHopsFromStore();
+  }
+  renderMeta(latestSummary);
+  renderHopMap(hopMapPoints(historyView.kind, mapResult));
+  const when = new Date(historyView.createdAt);
+  const stamp = Number.isNaN(when.getTime()) ? historyView.createdAt : when.toLocaleString();
+  const label = historyView.shared ? t('snapshotViewing') : t('historyViewing');
+  setStatus('idle', `${label} · ${result.target || ''} · ${stamp}`, false);
+  updateResultActions();
+}
+
+// historyMTRStats rebuilds the table of a web MTR run from its raw records
+// with the same aggregation as the live view; MCP runs store their stats.
+function historyMTRStats(result) {
+  if (!Array.isArray(result.records)) {
+    return Array.isArray(result.stats) ? result.stats : [];
+  }
+  mtrRawAggStore = new Map();
+  mtrRawOrderSeq = 0;
+  mtrRawKnownFinalTTL = Infinity;
+  result.records.forEach(ingestMTRRawRecord);
+  return buildMTRStatsFromRawAgg();
+}
+
+function renderMTUHops(hops) {
+  if (!Array.isArray(hops) || hops.length === 0) {
+    resultNode.innerHTML = `<p>${t('noResult')}</p>`;
+    resultNode.classList.remove('hidden');
+    return;
+  }
+  const table = document.createElement('table');
+  const thead = document.createElement('thead');
+  thead.innerHTML = `
+    <tr>
+      <th>${t('tableTTL')}</th>
+      <th>${t('colEvent')}</th>
+      <th>${t('colHost')}</th>
+      <th>${t('colLast')}</th>
+      <th>${t('colPMTU')}</th>
+    </tr>
+  `;
+  table.appendChild(thead);
+  const tbody = document.createElement('tbody');
+  hops.forEach((hop) => {
+    const row = document.createElement('tr');
+    const appendCell = (value) => {
+      const td = document.createElement('td');
+      td.textContent = value;
+      row.appendChild(td);
+      return td;
+    };
+    appendCell(hop.ttl);
+    appendCell(hop.event || '');
+    const hostCell = appendCell([hop.ip, hop.hostname && hop.hostname !== hop.ip ? hop.hostname : ''].filter(Boolean).join(' ') || '--');
+    const geoText = formatGeoDisplay(hop.geo);
+    if (geoText) {
+      const geoDiv = document.createElement('div');
+      geoDiv.className = 'attempt__geo';
+      geoDiv.textContent = geoText;
+      hostCell.appendChild(geoDiv);
+    }
+    appendCell(formatLatency(hop.rtt_ms, hop.rtt_ms > 0 ? 1 : 0));
+    appendCell(hop.pmtu || '--');
+    tbody.appendChild(row);
+  });
+  table.appendChild(tbody);
+  resultNode.innerHTML = '';
+  resultNode.appendChild(table);
+  resultNode.classList.remove('hidden');
+}
+
+function openSnapshot() {
+  document.body.classList.add('snapshot');
+  traceCompleted = true;
+  submitBtn.disabled = true;
+  historyView = {
+    id: snapshot.id || '',
+    kind: snapshot.kind,
+    createdAt: snapshot.created_at,
+    result: snapshot.result || {},
+    shared: true,
+  };
+  if (snapshot.target) {
+    document.title = `NextTrace · ${snapshot.target}`;
+  }
+  renderHistoryView();
+}
+
+// currentResult returns the finished result on screen in the shape the
+// history API stores, or null while a trace is still running.
+function currentResult() {
+  if (historyView) {
+    return {kind: historyView.kind || 'trace', result: historyView.result, historyID: historyView.shared ? '' : historyView.id};
+  }
+  if (!traceCompleted) {
+    return null;
+  }
+  if (currentMode === 'mtr') {
+    if (mtrStatsStore.length === 0) {
+      return null;
+    }
+    return {kind: 'mtr', result: {...latestSummary, stats: mtrStatsStore}};
+  }
+  if (hopStore.size === 0) {
+    return null;
+  }
+  const hops = Array.from(hopStore.values()).sort((a, b) => a.ttl - b.ttl);
+  return {kind: 'trace', result: {...latestSummary, hops}};
+}
+
+function updateResultActions() {
+  const current = currentResult();
+  if (snapshot) {
+    shareBtn.classList.add('hidden');
+    exportBtn.classList.toggle('hidden', !snapshot.download_url);
+    resultActions.classList.toggle('hidden', !snapshot.download_url);
+    return;
+  }
+  // Shares live next to the history entries, so they follow its visibility.
+  shareBtn.classList.toggle('hidden', historyPanel.classList.contains('hidden'));
+  resultActions.classList.toggle('hidden', !current);
+}
+
+function snapshotRequestBody(current) {
+  if (current.historyID) {
+    return JSON.stringify({history_id: current.historyID});
+  }
+  return JSON.stringify({kind: current.kind, result: current.result});
+}
+
+async function shareResult() {
+  const current = currentResult();
+  if (!current) {
+    return;
+  }
+  shareBtn.disabled = true;
+  setStatus('running', 'statusSharing');
+  try {
+    const res = await fetch('/api/share', {
+      method: 'POST',
+      headers: {'Content-Type': 'application/json', Accept: 'application/json'},
+      body: snapshotRequestBody(current),
+    });
+    const data = await res.json().catch(() => ({}));
+    if (!res.ok) {
+      throw new Error(data.error || `HTTP ${res.status}`);
+    }
+    const link = data.url || new URL(data.path, window.location.href).toString();
+    let copied = false;
+    if (navigator.clipboard && window.isSecureContext) {
+      copied = await navigator.clipboard.writeText(link).then(() => true, () => false);
+    }
+    setStatus('success', `${t(copied ? 'statusShareCopied' : 'statusShared')} ${link}`, false);
+  } catch (err) {
+    setStatus('error', `${t('statusShareFailed')} ${err.message}`, false);
+  } finally {
+    shareBtn.disabled = false;
+  }
+}
+
+async function exportResult() {
+  if (snapshot) {
+    if (snapshot.download_url) {
+      window.location.href = snapshot.download_url;
+    }
+    return;
+  }
+  const current = currentResult();
+  if (!current) {
+    return;
+  }
+  exportBtn.disabled = true;
+  try {
+    const res = await fetch('/api/export', {
+      method: 'POST',
+      headers: {'Content-Type': 'application/json'},
+      body: snapshotRequestBody(current),
+    });
+    if (!res.ok) {
+      const errRes = await res.json().catch(() => ({}));
+      throw new Error(errRes.error || `HTTP ${res.status}`);
+    }
+    const disposition = res.headers.get('Content-Disposition') || '';
+    const match = disposition.match(/filename="([^"]+)"/);
+    const blob = await res.blob();
+    const href = URL.createObjectURL(blob);
+    const link = document.createElement('a');
+    link.href = href;
+    link.download = match ? match[1] : 'nexttrace.html';
+    document.body.appendChild(link);
+    link.click();
+    link.remove();
+    setTimeout(() => URL.revokeObjectURL(href), 0);
+  } catch (err) {
+    setStatus('error', `${t('statusExportFailed')} ${err.message}`, false);
+  } finally {
+    exportBtn.disabled = false;
+  }
+}
+
+function geoPoint(ttl, ip, geo) {
+  if (!geo) {
+    return null;
+  }
+  const lat = Number(geo.lat);
+  const lng = Number(geo.lng);
+  if (!Number.isFinite(lat) || !Number.isFinite(lng) || (lat === 0 && lng === 0)) {
+    return null;
+  }
+  return {ttl: Number(ttl), ip: ip || '', lat, lng, label: formatGeoDisplay(geo)};
+}
+
+// hopMapPoints picks one located address per TTL, in hop order.
+function hopMapPoints(kind, result) {
+  const points = [];
+  const seen = new Set();
+  const push = (point) => {
+    if (point && !seen.has(point.ttl)) {
+      seen.add(point.ttl);
+      points.push(point);
+    }
+  };
+  if (kind === 'mtr') {
+    (result.stats || []).forEach((row) => push(geoPoint(row.ttl, row.ip, row.geo)));
+  } else if (kind === 'mtu') {
+    (result.hops || []).forEach((hop) => push(geoPoint(hop.ttl, hop.ip, hop.geo)));
+  } else {
+    (result.hops || []).forEach((hop) => {
+      const attempt = (hop.attempts || []).find((a) => a && a.success && geoPoint(hop.ttl, a.ip, a.geo));
+      if (attempt) {
+        push(geoPoint(hop.ttl, attempt.ip, attempt.geo));
+      }
+    });
+  }
+  return points.sort((a, b) => a.ttl - b.ttl);
+}
+
+// renderHopMap draws the hop coordinates on a plain equirectangular grid so
+// exported pages need no tile server.
+function renderHopMap(points) {
+  resultMapNode.innerHTML = '';
+  if (!points || points.length < 2) {
+    resultMapNode.classList.add('hidden');
+    return;
+  }
+  const width = 640;
+  const height = 320;
+  const pad = 24;
+  const lngs = points.map((p) => p.lng);
+  const lats = points.map((p) => p.lat);
+  const minLng = Math.min(...lngs) - 2;
+  const maxLng = Math.max(...lngs) + 2;
+  const minLat = Math.min(...lats) - 2;
+  const maxLat = Math.max(...lats) + 2;
+  const scale = Math.min((width - pad * 2) / (maxLng - minLng), (height - pad * 2) / (maxLat - minLat));
+  const offsetX = (width - (maxLng - minLng) * scale) / 2;
+  const offsetY = (height - (maxLat - minLat) * scale) / 2;
+  const project = (p) => [offsetX + (p.lng - minLng) * scale, offsetY + (maxLat - p.lat) * scale];
+
+  const ns = 'http://www.w3.org/2000/svg';
+  const svg = document.createElementNS(ns, 'svg');
+  svg.setAttribute('viewBox', `0 0 ${width} ${height}`);
+  svg.setAttribute('role', 'img');
+  const path = document.createElementNS(ns, 'polyline');
+  path.setAttribute('class', 'result-map__path');
+  path.setAttribute('points', points.map((p) => project(p).map((v) => v.toFixed(1)).join(',')).join(' '));
+  svg.appendChild(path);
+  let lastLabel = null;
+  points.forEach((p) => {
+    const [x, y] = project(p);
+    const dot = document.createElementNS(ns, 'circle');
+    dot.setAttribute('class', 'result-map__hop');
+    dot.setAttribute('cx', x.toFixed(1));
+    dot.setAttribute('cy', y.toFixed(1));
+    dot.setAttribute('r', '4');
+    const title = document.createElementNS(ns, 'title');
+    title.textContent = [`TTL ${p.ttl}`, p.ip, p.label].filter(Boolean).join(' · ');
+    dot.appendChild(title);
+    svg.appendChild(dot);
+    // Hops in the same city overlap; label only the first of each cluster.
+    if (lastLabel && Math.hypot(lastLabel[0] - x, lastLabel[1] - y) < 14) {
+      return;
+    }
+    lastLabel = [x, y];
+    const text = document.createElementNS(ns, 'text');
+    text.setAttribute('class', 'result-map__label');
+    text.setAttribute('x', (x + 6).toFixed(1));
+    text.setAttribute('y', (y - 6).toFixed(1));
+    text.textContent = String(p.ttl);
+    svg.appendChild(text);
+  });
+  const caption = document.createElement('p');
+  caption.className = 'result-map__caption';
+  caption.textContent = t('mapCaption');
+  resultMapNode.appendChild(caption);
+  resultMapNode.appendChild(svg);
+  resultMapNode.classList.remove('hidden');
+}
@@ -14,6 +14,17 @@
     return Number.isFinite(num) ? num : undefined;
   }
 
+  const udpPayloadPorts = {
+    dns: 53,
+    quic: 443,
+    ntp: 123,
+    stun: 3478,
+  };
+
+  function udpPayloadDefaultPort(profile) {
+    return udpPayloadPorts[String(profile || '').toLowerCase()] || 0;
+  }
+
   function defaultOptionValue(defaultOptions, key, fallback) {
     if (defaultOptions && Object.prototype.hasOwnProperty.call(defaultOptions, key)) {
       return defaultOptions[key];
@@ -53,8 +64,14 @@
       payload.port = dstPort;
     }
 
+    const udpPayload = String(values.udpPayload || '').trim().toLowerCase();
+    if (payload.protocol === 'udp' && udpPayload !== '' && udpPayload !== 'random') {
+      payload.udp_payload = udpPayload;
+    }
+
+    // Protocol payloads have a fixed size; the server rejects packet_size with them.
     const packetSize = readNumericValueFromRaw(values.packetSize);
-    if (packetSize !== undefined) {
+    if (packetSize !== undefined && payload.udp_payload === undefined) {
       payload.packet_size = packetSize;
     }
 
@@ -70,5 +87,6 @@
     buildTracePayload,
     defaultOptionValue,
     readNumericValueFromRaw,
+    udpPayloadDefaultPort,
   };
 });
@@ -1,7 +1,7 @@
 const test = require('node:test');
 const assert = require('node:assert/strict');
 
-const { buildTracePayload, defaultOptionValue } = require('./trace_form.js');
+const { buildTracePayload, defaultOptionValue, udpPayloadDefaultPort } = require('./trace_form.js');
 
 test('buildTracePayload preserves negative packet_size and zero tos', () => {
   const payload = buildTracePayload({
@@ -54,3 +54,32 @@ test('defaultOptionValue keeps explicit zero', () => {
 test('defaultOptionValue preserves explicit null for auto packet size', () => {
   assert.equal(defaultOptionValue({ packet_size: null }, 'packet_size', 52), null);
 });
+
+test('buildTracePayload sends udp_payload for udp only and drops packet_size', () => {
+  const values = {
+    target: '1.1.1.1',
+    protocol: 'udp',
+    dataProvider: 'LeoMoeAPI',
+    language: 'cn',
+    mode: 'single',
+    dstPort: '53',
+    packetSize: '80',
+    udpPayload: 'dns',
+  };
+  const payload = buildTracePayload(values);
+  assert.equal(payload.udp_payload, 'dns');
+  assert.equal(payload.port, 53);
+  assert.equal(payload.packet_size, undefined);
+
+  const random = buildTracePayload({ ...values, udpPayload: 'random' });
+  assert.equal(random.udp_payload, undefined);
+  assert.equal(random.packet_size, 80);
+
+  const tcp = buildTracePayload({ ...values, protocol: 'tcp' });
+  assert.equal(tcp.udp_payload, undefined);
+});
+
+test('udpPayloadDefaultPort maps protocol profiles to their ports', () => {
+  assert.equal(udpPayloadDefaultPort('quic'), 443);
+  assert.equal(udpPayloadDefaultPort('auto'), 0);
+});
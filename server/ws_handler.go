@@ -15,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 
+	"github.com/nxtrace/NTrace-core/internal/service"
 	"github.com/nxtrace/NTrace-core/trace"
 )
 
@@ -216,8 +217,26 @@ func traceWebsocketHandler(c *gin.Context) {
 		return
 	}
 
+	caller := deployCallerFromContext(c.Request.Context())
+	action := wsTraceAction(req.Mode)
+	var auditErr error
+	defer func() {
+		caller.record(action, req.Target, traceAuditParams(req), auditErr)
+	}()
+	scope := scopeTrace
+	if action == "mtr" {
+		scope = scopeMTR
+	}
+	if err := caller.authorize(scope, true); err != nil {
+		auditErr = err
+		_ = conn.WriteJSON(wsEnvelope{Type: "error", Error: err.Error(), Status: deployAccessStatus(err, http.StatusForbidden)})
+		return
+	}
+
 	sessionCtx, cancel := newWSSessionContext(c.Request.Context())
 	defer cancel()
+	sessionCtx, cancelPolicy := service.PolicyFromContext(sessionCtx).WithDeadline(sessionCtx)
+	defer cancelPolicy()
 	var sessionRef atomic.Pointer[wsTraceSession]
 	go func() {
 		for {
@@ -233,6 +252,7 @@ func traceWebsocketHandler(c *gin.Context) {
 
 	setup, statusCode, err := prepareTrace(sessionCtx, req)
 	if err != nil {
+		auditErr = err
 		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 			return
 		}
@@ -240,7 +260,7 @@ func traceWebsocketHandler(c *gin.Context) {
 			statusCode = 500
 		}
 		log.Printf("[deploy] websocket prepare trace failed target=%s error=%v", sanitizeLogParam(req.Target), err)
-		_ = conn.WriteJSON(wsEnvelope{Type: "error", Error: err.Error(), Status: statusCode})
+		_ = conn.WriteJSON(wsEnvelope{Type: "error", Data: policyErrorDetail(err), Error: err.Error(), Status: statusCode})
 		return
 	}
 
@@ -276,6 +296,15 @@ func traceWebsocketHandler(c *gin.Context) {
 	}
 }
 
+func wsTraceAction(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "mtr", "continuous":
+		return "mtr"
+	default:
+		return "trace"
+	}
+}
+
 func runSingleTrace(ctx context.Context, session *wsTraceSession, setup *traceExecution) {
 	session.seen = make(map[int]int)
 
@@ -337,6 +366,7 @@ func runSingleTrace(ctx context.Context, session *wsTraceSession, setup *traceEx
 		DurationMs:   duration.Milliseconds(),
 	}
 
+	saveTraceHistory(ctx, historySourceWeb, setup, final)
 	if err := session.send(wsEnvelope{Type: "complete", Data: final}); err != nil {
 		log.Printf("[deploy] websocket send complete failed: %v", err)
 	}
@@ -351,6 +381,23 @@ func runMTRTrace(parentCtx context.Context, session *wsTraceSession, setup *trac
 	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel()
 
+	report := &mtrRawLog{}
+	start := time.Now()
+	// A stopped or disconnected session still keeps what it collected.
+	defer func() {
+		rounds, records, truncated := report.snapshot()
+		saveMTRHistory(parentCtx, historySourceWeb, setup, historyMTRReport{
+			Target:       setup.Target,
+			ResolvedIP:   setup.IP.String(),
+			Protocol:     setup.Protocol,
+			DataProvider: setup.DataProvider,
+			Iteration:    rounds,
+			Records:      records,
+			Truncated:    truncated,
+			DurationMs:   time.Since(start).Milliseconds(),
+		})
+	}()
+
 	err := executeMTRRaw(ctx, session, setup, trace.MTRRawOptions{
 		HopInterval: hopInterval,
 		MaxPerHop:   maxPerHop,
@@ -358,6 +405,7 @@ func runMTRTrace(parentCtx context.Context, session *wsTraceSession, setup *trac
 		if rec.Iteration > iteration {
 			iteration = rec.Iteration
 		}
+		report.add(rec)
 		if err := session.send(wsEnvelope{Type: "mtr_raw", Data: rec}); err != nil {
 			cancel()
 		}
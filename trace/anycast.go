@@ -0,0 +1,446 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// AnycastIdentity 为目标 53 端口对 DNS 身份查询的应答：
+// CHAOS TXT hostname.bind 与 id.server，以及两次查询都携带的 EDNS NSID 选项
+type AnycastIdentity struct {
+	HostnameBind string `json:"hostname_bind,omitempty"`
+	IDServer     string `json:"id_server,omitempty"`
+	NSID         string `json:"nsid,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Value 返回最能代表应答实例的一项，没有应答时为空
+func (id AnycastIdentity) Value() string {
+	for _, v := range []string{id.HostnameBind, id.IDServer, id.NSID} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// AnycastHint 为推断站点的一条线索
+type AnycastHint struct {
+	// Source 为 hostname.bind、id.server、nsid、ptr 或 geo
+	Source string `json:"source"`
+	TTL    int    `json:"ttl,omitempty"`
+	Value  string `json:"value"`
+	// Site 为按 ptr.csv 从 Value 识别出的站点
+	Site string `json:"site,omitempty"`
+}
+
+// AnycastSite 为对应答目标的 anycast 站点的推断
+type AnycastSite struct {
+	Target   string           `json:"target"`
+	Reached  bool             `json:"reached"`
+	Identity *AnycastIdentity `json:"identity,omitempty"`
+	Hints    []AnycastHint    `json:"hints,omitempty"`
+	// Site 为推断出的站点，Source 为所依据线索的 Source；都为空表示无从推断
+	Site   string `json:"site,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// AnycastSiteLookup 从主机名或身份字符串中识别站点，无法识别时返回 false
+type AnycastSiteLookup func(name string) (string, bool)
+
+const (
+	anycastDNSPort  = 53
+	anycastNSIDCode = 3
+	// anycastHintHops 为目标之前取 PTR 线索的跳数
+	anycastHintHops = 3
+)
+
+var anycastIdentityNames = []string{"hostname.bind", "id.server"}
+
+// QueryAnycastIdentity 向 dst 的 53 端口发送 CHAOS TXT hostname.bind 与 id.server 查询。
+// srcAddr 非空时从该地址发出；两次都没有应答时 Error 为最后一次的错误。
+func QueryAnycastIdentity(ctx context.Context, srcAddr string, dst net.IP, timeout time.Duration) AnycastIdentity {
+	var id AnycastIdentity
+	var lastErr error
+	for _, name := range anycastIdentityNames {
+		txt, nsid, err := queryAnycastName(ctx, srcAddr, dst, name, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if name == "hostname.bind" {
+			id.HostnameBind = txt
+		} else {
+			id.IDServer = txt
+		}
+		if id.NSID == "" {
+			id.NSID = nsid
+		}
+	}
+	if id.Value() == "" && lastErr != nil {
+		id.Error = lastErr.Error()
+	}
+	return id
+}
+
+func queryAnycastName(ctx context.Context, srcAddr string, dst net.IP, name string, timeout time.Duration) (txt, nsid string, err error) {
+	qid := uint16(rand.Intn(1 << 16))
+	query, err := buildAnycastQuery(qid, name)
+	if err != nil {
+		return "", "", err
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	if srcAddr != "" {
+		dialer.LocalAddr = &net.UDPAddr{IP: net.ParseIP(srcAddr)}
+	}
+	conn, err := util.DialContext(ctx, &dialer, "udp", net.JoinHostPort(dst.String(), strconv.Itoa(anycastDNSPort)))
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	if _, err = conn.Write(query); err != nil {
+		return "", "", err
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return "", "", err
+		}
+		txt, nsid, err = parseAnycastReply(buf[:n], qid)
+		// 与本次查询 ID 不符的应答丢弃，继续等待
+		if !errors.Is(err, errAnycastReplyID) {
+			return txt, nsid, err
+		}
+	}
+}
+
+var errAnycastReplyID = errors.New("dns reply id mismatch")
+
+func buildAnycastQuery(qid uint16, name string) ([]byte, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, err
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: qid})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassCHAOS}); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(1232, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{Options: []dnsmessage.Option{{Code: anycastNSIDCode}}}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// parseAnycastReply 取出应答中的 TXT 记录与 NSID。拒绝 CHAOS 查询的服务器仍可能带回 NSID，
+// 两者都没有时才报错。
+func parseAnycastReply(msg []byte, qid uint16) (txt, nsid string, err error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return "", "", err
+	}
+	if h.ID != qid || !h.Response {
+		return "", "", errAnycastReplyID
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return "", "", err
+	}
+	for {
+		rh, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if rh.Type != dnsmessage.TypeTXT {
+			if err := p.SkipAnswer(); err != nil {
+				return "", "", err
+			}
+			continue
+		}
+		r, err := p.TXTResource()
+		if err != nil {
+			return "", "", err
+		}
+		if txt == "" {
+			txt = strings.Join(r.TXT, "")
+		}
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return "", "", err
+	}
+	for {
+		rh, err := p.AdditionalHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if rh.Type != dnsmessage.TypeOPT {
+			if err := p.SkipAdditional(); err != nil {
+				return "", "", err
+			}
+			continue
+		}
+		r, err := p.OPTResource()
+		if err != nil {
+			return "", "", err
+		}
+		for _, o := range r.Options {
+			if o.Code == anycastNSIDCode && len(o.Data) > 0 {
+				nsid = decodeNSID(o.Data)
+			}
+		}
+	}
+	if txt == "" && nsid == "" {
+		return "", "", fmt.Errorf("dns reply: %s", strings.TrimPrefix(h.RCode.String(), "RCode"))
+	}
+	return txt, nsid, nil
+}
+
+// decodeNSID 可打印时按文本返回，否则按十六进制
+func decodeNSID(data []byte) string {
+	for _, c := range data {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("%x", data)
+		}
+	}
+	return string(data)
+}
+
+// anycastHop 为推断站点用到的一跳
+type anycastHop struct {
+	ttl  int
+	ip   net.IP
+	host string
+	geo  string
+}
+
+// AnycastSiteFromResult 依据一次追踪与目标的身份应答推断站点
+func AnycastSiteFromResult(target string, dst net.IP, res *Result, id *AnycastIdentity, lookup AnycastSiteLookup) AnycastSite {
+	var hops []anycastHop
+	for i := 0; i < pathLen(res); i++ {
+		if h := PathHopAt(res, i); h != nil {
+			hops = append(hops, anycastHop{ttl: i + 1, ip: util.AddrIP(h.Address), host: h.Hostname, geo: anycastGeo(h.Geo)})
+		}
+	}
+	return inferAnycastSite(target, dst, hops, id, lookup)
+}
+
+// AnycastSiteFromMTR 依据 MTR 的最终统计与目标最近一次的身份应答推断站点
+func AnycastSiteFromMTR(target string, dst net.IP, stats []MTRHopStat, id *AnycastIdentity, lookup AnycastSiteLookup) AnycastSite {
+	var hops []anycastHop
+	for _, st := range stats {
+		if st.IP == "" || st.Received == 0 {
+			continue
+		}
+		h := anycastHop{ttl: st.TTL, ip: net.ParseIP(st.IP), host: st.Host, geo: anycastGeo(st.Geo)}
+		// 同一 TTL 有多个地址时取第一个，但目标优先
+		if n := len(hops); n > 0 && hops[n-1].ttl == st.TTL {
+			if h.ip != nil && h.ip.Equal(dst) {
+				hops[n-1] = h
+			}
+			continue
+		}
+		hops = append(hops, h)
+	}
+	return inferAnycastSite(target, dst, hops, id, lookup)
+}
+
+func anycastGeo(geo *ipgeo.IPGeoData) string {
+	if geo == nil {
+		return ""
+	}
+	var parts []string
+	for _, pair := range [][2]string{{geo.CityEn, geo.City}, {geo.CountryEn, geo.Country}} {
+		v := pair[0]
+		if v == "" {
+			v = pair[1]
+		}
+		if v != "" && !slices.Contains(parts, v) {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// inferAnycastSite 收集线索并选出站点：身份应答中识别出的站点优先，其次是身份应答本身，
+// 再次是目标前几跳 PTR 中识别出的站点，最后是目标前一跳的地理位置。
+// 目标本身的地理位置对 anycast 地址没有意义，不作为线索。
+func inferAnycastSite(target string, dst net.IP, hops []anycastHop, id *AnycastIdentity, lookup AnycastSiteLookup) AnycastSite {
+	s := AnycastSite{Target: target, Identity: id}
+	site := func(v string) string {
+		if lookup == nil || v == "" {
+			return ""
+		}
+		name, _ := lookup(v)
+		return name
+	}
+	if id != nil {
+		for _, h := range []AnycastHint{
+			{Source: "hostname.bind", Value: id.HostnameBind},
+			{Source: "id.server", Value: id.IDServer},
+			{Source: "nsid", Value: id.NSID},
+		} {
+			if h.Value != "" {
+				h.Site = site(h.Value)
+				s.Hints = append(s.Hints, h)
+			}
+		}
+	}
+	// 目标之前的跳，从近到远
+	before := hops
+	for i, h := range hops {
+		if h.ip != nil && h.ip.Equal(dst) {
+			s.Reached = true
+			before = hops[:i]
+			break
+		}
+	}
+	var geo *AnycastHint
+	for i := len(before) - 1; i >= 0 && i >= len(before)-anycastHintHops; i-- {
+		h := before[i]
+		if h.host != "" {
+			s.Hints = append(s.Hints, AnycastHint{Source: "ptr", TTL: h.ttl, Value: h.host, Site: site(h.host)})
+		}
+		if geo == nil && h.geo != "" {
+			geo = &AnycastHint{Source: "geo", TTL: h.ttl, Value: h.geo}
+		}
+	}
+	if geo != nil {
+		s.Hints = append(s.Hints, *geo)
+	}
+	s.Site, s.Source = pickAnycastSite(s.Hints)
+	return s
+}
+
+func pickAnycastSite(hints []AnycastHint) (string, string) {
+	isIdentity := func(h AnycastHint) bool { return h.Source != "ptr" && h.Source != "geo" }
+	for _, pass := range []func(AnycastHint) (string, bool){
+		func(h AnycastHint) (string, bool) { return h.Site, isIdentity(h) && h.Site != "" },
+		func(h AnycastHint) (string, bool) { return h.Value, isIdentity(h) },
+		func(h AnycastHint) (string, bool) { return h.Site, h.Source == "ptr" && h.Site != "" },
+		func(h AnycastHint) (string, bool) { return h.Value, h.Source == "geo" },
+	} {
+		for _, h := range hints {
+			if v, ok := pass(h); ok {
+				return v, h.Source
+			}
+		}
+	}
+	return "", ""
+}
+
+// AnycastFlip 为 MTR 过程中一次站点切换的迹象
+type AnycastFlip struct {
+	Time  time.Time `json:"time"`
+	Round int       `json:"round"`
+	// Signal 为 identity（身份应答改变）或 return_hops（目标回包的回程跳数改变）
+	Signal string `json:"signal"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// AnycastCatchment 跟踪 MTR 各轮中目标身份应答与回程跳数的变化；并发安全
+type AnycastCatchment struct {
+	mu sync.Mutex
+	// identity 保存每个来源最近一次的应答，某个查询丢失时保留上一次的值
+	identity   AnycastIdentity
+	returnHops int
+	samples    int
+	flips      []AnycastFlip
+}
+
+// ObserveIdentity 记录一次身份应答；没有应答的不计入。
+// 各来源分别与自身上一次的应答比较，某一项查询丢失不会被当作切换；一轮最多记录一次切换。
+func (c *AnycastCatchment) ObserveIdentity(t time.Time, round int, id AnycastIdentity) {
+	if id.Value() == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples++
+	flipped := false
+	for _, f := range []struct {
+		prev *string
+		cur  string
+	}{
+		{&c.identity.HostnameBind, id.HostnameBind},
+		{&c.identity.IDServer, id.IDServer},
+		{&c.identity.NSID, id.NSID},
+	} {
+		if f.cur == "" {
+			continue
+		}
+		if !flipped && *f.prev != "" && *f.prev != f.cur {
+			c.flips = append(c.flips, AnycastFlip{Time: t, Round: round, Signal: "identity", From: *f.prev, To: f.cur})
+			flipped = true
+		}
+		*f.prev = f.cur
+	}
+}
+
+// ObserveStats 记录 MTR 快照中目标一行的回程跳数
+func (c *AnycastCatchment) ObserveStats(t time.Time, round int, dst net.IP, stats []MTRHopStat) {
+	hops := 0
+	for _, st := range stats {
+		if ip := net.ParseIP(st.IP); ip != nil && ip.Equal(dst) && st.ReturnHops > 0 {
+			hops = st.ReturnHops
+			break
+		}
+	}
+	if hops == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.returnHops != 0 && c.returnHops != hops {
+		c.flips = append(c.flips, AnycastFlip{Time: t, Round: round, Signal: "return_hops", From: strconv.Itoa(c.returnHops), To: strconv.Itoa(hops)})
+	}
+	c.returnHops = hops
+}
+
+// Samples 返回有应答的身份查询次数
+func (c *AnycastCatchment) Samples() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.samples
+}
+
+// Flips 返回按时间顺序的切换记录
+func (c *AnycastCatchment) Flips() []AnycastFlip {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]AnycastFlip(nil), c.flips...)
+}
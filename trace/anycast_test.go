@@ -0,0 +1,142 @@
+package trace
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+)
+
+// anycastTestReply 构造对 CHAOS 查询的应答，txt 或 nsid 为空时省略对应部分
+func anycastTestReply(t *testing.T, qid uint16, rcode dnsmessage.RCode, txt string, nsid []byte) []byte {
+	t.Helper()
+	name := dnsmessage.MustNewName("hostname.bind.")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: qid, Response: true, RCode: rcode})
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(b.StartQuestions())
+	must(b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassCHAOS}))
+	must(b.StartAnswers())
+	if txt != "" {
+		must(b.TXTResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassCHAOS}, dnsmessage.TXTResource{TXT: []string{txt}}))
+	}
+	must(b.StartAdditionals())
+	if nsid != nil {
+		var opt dnsmessage.ResourceHeader
+		must(opt.SetEDNS0(1232, dnsmessage.RCodeSuccess, false))
+		must(b.OPTResource(opt, dnsmessage.OPTResource{Options: []dnsmessage.Option{{Code: anycastNSIDCode, Data: nsid}}}))
+	}
+	msg, err := b.Finish()
+	must(err)
+	return msg
+}
+
+func TestAnycastQueryAndReply(t *testing.T) {
+	query, err := buildAnycastQuery(0x1234, "id.server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p dnsmessage.Parser
+	if _, err := p.Start(query); err != nil {
+		t.Fatal(err)
+	}
+	q, err := p.Question()
+	if err != nil || q.Name.String() != "id.server." || q.Class != dnsmessage.ClassCHAOS || q.Type != dnsmessage.TypeTXT {
+		t.Fatalf("question = %+v, %v", q, err)
+	}
+
+	txt, nsid, err := parseAnycastReply(anycastTestReply(t, 7, dnsmessage.RCodeSuccess, "b4.fra", []byte("fra1")), 7)
+	if err != nil || txt != "b4.fra" || nsid != "fra1" {
+		t.Fatalf("reply = %q %q %v", txt, nsid, err)
+	}
+	// 拒绝 CHAOS 查询但带回 NSID，NSID 不可打印时按十六进制
+	if _, nsid, err = parseAnycastReply(anycastTestReply(t, 7, dnsmessage.RCodeRefused, "", []byte{0x01, 0xff}), 7); err != nil || nsid != "01ff" {
+		t.Fatalf("refused reply = %q %v", nsid, err)
+	}
+	if _, _, err = parseAnycastReply(anycastTestReply(t, 7, dnsmessage.RCodeRefused, "", nil), 7); err == nil || !strings.Contains(err.Error(), "Refused") {
+		t.Fatalf("empty refused reply err = %v", err)
+	}
+	if _, _, err = parseAnycastReply(anycastTestReply(t, 8, dnsmessage.RCodeSuccess, "b4.fra", nil), 7); err != errAnycastReplyID {
+		t.Fatalf("mismatched id err = %v", err)
+	}
+}
+
+func TestAnycastSiteFromResult(t *testing.T) {
+	res := pathTestResult("10.0.0.1/64512", "198.51.100.1/13335", "203.0.113.1/13335", "192.0.2.53/13335")
+	res.Hops[1][0].Hostname = "ae-1.fra01.example.net"
+	res.Hops[2][0].Hostname = "core.example.net"
+	res.Hops[2][0].Geo.CityEn, res.Hops[2][0].Geo.CountryEn = "Frankfurt", "Germany"
+	lookup := func(name string) (string, bool) {
+		if strings.Contains(name, "fra") {
+			return "fra (Frankfurt)", true
+		}
+		return "", false
+	}
+	dst := net.ParseIP("192.0.2.53")
+
+	s := AnycastSiteFromResult("example.com", dst, res, nil, lookup)
+	if !s.Reached || s.Site != "fra (Frankfurt)" || s.Source != "ptr" {
+		t.Fatalf("site = %+v", s)
+	}
+	var sources []string
+	for _, h := range s.Hints {
+		sources = append(sources, h.Source)
+	}
+	if strings.Join(sources, ",") != "ptr,ptr,geo" || s.Hints[0].TTL != 3 || s.Hints[2].Value != "Frankfurt, Germany" {
+		t.Fatalf("hints = %+v", s.Hints)
+	}
+
+	// 身份应答优先于 PTR，即使无法识别为站点
+	s = AnycastSiteFromResult("example.com", dst, res, &AnycastIdentity{IDServer: "ams3"}, lookup)
+	if s.Site != "ams3" || s.Source != "id.server" {
+		t.Fatalf("identity site = %+v", s)
+	}
+	// 前几跳既无 PTR 也无地理位置时无从推断
+	s = AnycastSiteFromResult("example.com", dst, pathTestResult("10.0.0.1/64512", "192.0.2.53/13335"), nil, lookup)
+	if s.Site != "" || len(s.Hints) != 0 {
+		t.Fatalf("empty site = %+v", s)
+	}
+}
+
+func TestAnycastSiteFromMTRAndCatchment(t *testing.T) {
+	dst := net.ParseIP("192.0.2.53")
+	stats := []MTRHopStat{
+		{TTL: 1, IP: "10.0.0.1", Received: 3, Geo: &ipgeo.IPGeoData{City: "Tokyo"}},
+		{TTL: 2, IP: "203.0.113.9", Received: 1},
+		{TTL: 2, IP: "192.0.2.53", Received: 2, ReturnHops: 5},
+	}
+	s := AnycastSiteFromMTR("example.com", dst, stats, nil, nil)
+	if !s.Reached || s.Site != "Tokyo" || s.Source != "geo" {
+		t.Fatalf("site = %+v", s)
+	}
+
+	var c AnycastCatchment
+	now := time.Now()
+	c.ObserveIdentity(now, 1, AnycastIdentity{HostnameBind: "nrt1"})
+	c.ObserveIdentity(now, 2, AnycastIdentity{Error: "i/o timeout"})
+	c.ObserveIdentity(now, 3, AnycastIdentity{HostnameBind: "hkg2"})
+	// hostname.bind 丢失只剩 NSID 时不算切换
+	c.ObserveIdentity(now, 4, AnycastIdentity{NSID: "hkg2-ns"})
+	c.ObserveIdentity(now, 5, AnycastIdentity{HostnameBind: "hkg2", NSID: "hkg2-ns"})
+	c.ObserveStats(now, 3, dst, stats)
+	stats[2].ReturnHops = 7
+	c.ObserveStats(now, 4, dst, stats)
+	flips := c.Flips()
+	if c.Samples() != 4 || len(flips) != 2 {
+		t.Fatalf("samples = %d, flips = %+v", c.Samples(), flips)
+	}
+	if f := flips[0]; f.Signal != "identity" || f.From != "nrt1" || f.To != "hkg2" || f.Round != 3 {
+		t.Fatalf("identity flip = %+v", f)
+	}
+	if f := flips[1]; f.Signal != "return_hops" || f.From != "5" || f.To != "7" {
+		t.Fatalf("return hops flip = %+v", f)
+	}
+}
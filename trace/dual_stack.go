@@ -0,0 +1,235 @@
+package trace
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// DualStackSide 汇总同一目标在一个地址族上的路径
+type DualStackSide struct {
+	Family string `json:"family"`
+	IP     string `json:"ip"`
+	// Reached 表示目标有应答；HopCount 为目标所在跳，未到达时为最后有应答的跳
+	Reached  bool    `json:"reached"`
+	HopCount int     `json:"hop_count"`
+	RTTMs    float64 `json:"rtt_ms,omitempty"`
+	// LossPct 为发往目标那一跳的探测丢失比例，未到达时为 100
+	LossPct float64       `json:"loss_percent"`
+	ASPath  []string      `json:"as_path,omitempty"`
+	Result  *Result       `json:"result,omitempty"`
+	MTR     []MTRHopStat  `json:"mtr,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	asHops  []dualStackAS // ASPath 各项首次出现的跳
+}
+
+type dualStackAS struct {
+	asn string
+	ttl int
+}
+
+// DualStackDiverge 为两条 AS 路径首次不同的位置
+type DualStackDiverge struct {
+	// AfterASN 为分叉前最后一个共同的 AS，空表示第一个 AS 就不同
+	AfterASN string `json:"after_asn,omitempty"`
+	IPv4ASN  string `json:"ipv4_asn,omitempty"`
+	IPv4TTL  int    `json:"ipv4_ttl,omitempty"`
+	IPv6ASN  string `json:"ipv6_asn,omitempty"`
+	IPv6TTL  int    `json:"ipv6_ttl,omitempty"`
+}
+
+// DualStackComparison 对照同一主机名的 IPv4 与 IPv6 路径
+type DualStackComparison struct {
+	Target string        `json:"target"`
+	IPv4   DualStackSide `json:"ipv4"`
+	IPv6   DualStackSide `json:"ipv6"`
+	// Diverge 为 nil 表示两条 AS 路径一致
+	Diverge *DualStackDiverge `json:"diverge,omitempty"`
+	Verdict []string          `json:"verdict"`
+}
+
+// dualStackRTTTolerance 以内的时延差视为相当
+const dualStackRTTTolerance = 1.0
+
+func dualStackFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// DualStackSideFromResult 汇总一次追踪：到达目标的跳、目标的平均时延与丢包、AS 路径
+func DualStackSideFromResult(ip net.IP, res *Result) DualStackSide {
+	s := DualStackSide{Family: dualStackFamily(ip), IP: ip.String(), Result: res, LossPct: 100}
+	for i := 0; i < pathLen(res); i++ {
+		if h := PathHopAt(res, i); h != nil {
+			s.HopCount = i + 1
+			s.addASN(PathHopASN(h), i+1)
+		}
+		sent, received := 0, 0
+		var rtt time.Duration
+		for _, h := range res.Hops[i] {
+			sent++
+			if hopIP := util.AddrIP(h.Address); h.Success && hopIP != nil && hopIP.Equal(ip) {
+				received++
+				rtt += h.RTT
+			}
+		}
+		if received > 0 {
+			s.Reached = true
+			s.RTTMs = float64(rtt) / float64(received) / float64(time.Millisecond)
+			s.LossPct = float64(sent-received) * 100 / float64(sent)
+			break
+		}
+	}
+	return s
+}
+
+// DualStackSideError 记录一个地址族追踪失败
+func DualStackSideError(ip net.IP, err error) DualStackSide {
+	return DualStackSide{Family: dualStackFamily(ip), IP: ip.String(), LossPct: 100, Error: err.Error()}
+}
+
+// DualStackSideFromMTR 汇总一次 MTR 报告的最终统计
+func DualStackSideFromMTR(ip net.IP, stats []MTRHopStat) DualStackSide {
+	s := DualStackSide{Family: dualStackFamily(ip), IP: ip.String(), MTR: stats, LossPct: 100}
+	for _, st := range stats {
+		if st.IP == "" || st.Received == 0 {
+			continue
+		}
+		s.HopCount = st.TTL
+		s.addASN(PathHopASN(&Hop{Geo: st.Geo}), st.TTL)
+		if hopIP := net.ParseIP(st.IP); hopIP != nil && hopIP.Equal(ip) {
+			s.Reached = true
+			s.RTTMs = st.Avg
+			s.LossPct = st.Loss
+			break
+		}
+	}
+	return s
+}
+
+func (s *DualStackSide) addASN(asn string, ttl int) {
+	if asn == "" || (len(s.ASPath) > 0 && s.ASPath[len(s.ASPath)-1] == asn) {
+		return
+	}
+	s.ASPath = append(s.ASPath, asn)
+	s.asHops = append(s.asHops, dualStackAS{asn: asn, ttl: ttl})
+}
+
+// CompareDualStack 对照两个地址族的汇总，找出 AS 路径分叉处并给出结论
+func CompareDualStack(target string, v4, v6 DualStackSide) *DualStackComparison {
+	c := &DualStackComparison{Target: target, IPv4: v4, IPv6: v6}
+	if v4.Error == "" && v6.Error == "" {
+		c.Diverge = divergeASPaths(v4.asHops, v6.asHops)
+	}
+	c.Verdict = c.verdict()
+	return c
+}
+
+func divergeASPaths(v4, v6 []dualStackAS) *DualStackDiverge {
+	k := 0
+	for k < len(v4) && k < len(v6) && v4[k].asn == v6[k].asn {
+		k++
+	}
+	if k == len(v4) && k == len(v6) {
+		return nil
+	}
+	d := &DualStackDiverge{}
+	if k > 0 {
+		d.AfterASN = v4[k-1].asn
+	}
+	if k < len(v4) {
+		d.IPv4ASN, d.IPv4TTL = v4[k].asn, v4[k].ttl
+	}
+	if k < len(v6) {
+		d.IPv6ASN, d.IPv6TTL = v6[k].asn, v6[k].ttl
+	}
+	return d
+}
+
+func (c *DualStackComparison) verdict() []string {
+	var lines []string
+	for _, s := range []DualStackSide{c.IPv4, c.IPv6} {
+		if s.Error != "" {
+			lines = append(lines, fmt.Sprintf("%s failed: %s", dualStackLabel(s.Family), s.Error))
+		}
+	}
+	if len(lines) > 0 {
+		return lines
+	}
+	v4, v6 := c.IPv4, c.IPv6
+	switch {
+	case !v4.Reached && !v6.Reached:
+		lines = append(lines, fmt.Sprintf("neither IPv4 (last reply at hop %d) nor IPv6 (last reply at hop %d) reaches the destination", v4.HopCount, v6.HopCount))
+	case !v4.Reached:
+		lines = append(lines, fmt.Sprintf("only IPv6 reaches the destination; IPv4's last reply is at hop %d", v4.HopCount))
+	case !v6.Reached:
+		lines = append(lines, fmt.Sprintf("only IPv4 reaches the destination; IPv6's last reply is at hop %d", v6.HopCount))
+	default:
+		lines = append(lines, compareDualStackRTT(v4.RTTMs, v6.RTTMs))
+		if d := v6.HopCount - v4.HopCount; d != 0 {
+			lines = append(lines, fmt.Sprintf("IPv6 takes %d %s hops than IPv4 (%d vs %d)", max(d, -d), moreOrFewer(d), v6.HopCount, v4.HopCount))
+		}
+		if v4.LossPct != v6.LossPct {
+			lines = append(lines, fmt.Sprintf("loss at the destination: IPv4 %.0f%%, IPv6 %.0f%%", v4.LossPct, v6.LossPct))
+		}
+	}
+	lines = append(lines, c.asPathVerdict())
+	return lines
+}
+
+func compareDualStackRTT(v4, v6 float64) string {
+	diff := v6 - v4
+	if math.Abs(diff) <= dualStackRTTTolerance {
+		return fmt.Sprintf("IPv4 and IPv6 have about the same latency (%.2f ms vs %.2f ms)", v4, v6)
+	}
+	faster, slower, fast, slow := "IPv4", "IPv6", v4, v6
+	if diff < 0 {
+		faster, slower, fast, slow = "IPv6", "IPv4", v6, v4
+	}
+	pct := ""
+	if fast > 0 {
+		pct = fmt.Sprintf(", %.0f%%", (slow-fast)*100/fast)
+	}
+	return fmt.Sprintf("%s is %.2f ms slower than %s (%.2f ms vs %.2f ms%s)", slower, slow-fast, faster, slow, fast, pct)
+}
+
+func (c *DualStackComparison) asPathVerdict() string {
+	d := c.Diverge
+	switch {
+	case len(c.IPv4.ASPath) == 0 && len(c.IPv6.ASPath) == 0:
+		return "no AS information to compare the paths"
+	case d == nil:
+		return "IPv4 and IPv6 follow the same AS path"
+	}
+	where := "the AS paths differ from the first AS"
+	if d.AfterASN != "" {
+		where = fmt.Sprintf("the AS paths diverge after AS%s", d.AfterASN)
+	}
+	return fmt.Sprintf("%s: IPv4 continues %s, IPv6 %s", where, divergeStep(d.IPv4ASN, d.IPv4TTL), divergeStep(d.IPv6ASN, d.IPv6TTL))
+}
+
+func divergeStep(asn string, ttl int) string {
+	if asn == "" {
+		return "no further"
+	}
+	return fmt.Sprintf("to AS%s at hop %d", asn, ttl)
+}
+
+func dualStackLabel(family string) string {
+	if family == "ipv4" {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+func moreOrFewer(d int) string {
+	if d > 0 {
+		return "more"
+	}
+	return "fewer"
+}
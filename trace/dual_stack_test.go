@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCompareDualStackFromResults(t *testing.T) {
+	v4 := pathTestResult("10.0.0.1/64512", "198.51.100.1/4134", "203.0.113.1/4809", "192.0.2.1/13335")
+	v6 := pathTestResult("fd00::1/64512", "2001:db8:1::1/4134", "", "2001:db8:2::1/1299", "2001:db8:3::1/13335", "2001:db8::1/13335")
+	// 目标第二次探测丢失
+	v6.Hops[5] = append(v6.Hops[5], Hop{TTL: 6})
+
+	cmp := CompareDualStack("example.com",
+		DualStackSideFromResult(net.ParseIP("192.0.2.1"), v4),
+		DualStackSideFromResult(net.ParseIP("2001:db8::1"), v6))
+	if s := cmp.IPv4; !s.Reached || s.HopCount != 4 || s.RTTMs != 4 || s.LossPct != 0 || strings.Join(s.ASPath, " ") != "64512 4134 4809 13335" {
+		t.Fatalf("IPv4 side = %+v", s)
+	}
+	if s := cmp.IPv6; !s.Reached || s.HopCount != 6 || s.RTTMs != 6 || s.LossPct != 50 || strings.Join(s.ASPath, " ") != "64512 4134 1299 13335" {
+		t.Fatalf("IPv6 side = %+v", s)
+	}
+	if d := cmp.Diverge; d == nil || d.AfterASN != "4134" || d.IPv4ASN != "4809" || d.IPv4TTL != 3 || d.IPv6ASN != "1299" || d.IPv6TTL != 4 {
+		t.Fatalf("Diverge = %+v", cmp.Diverge)
+	}
+	want := []string{
+		"IPv6 is 2.00 ms slower than IPv4 (6.00 ms vs 4.00 ms, 50%)",
+		"IPv6 takes 2 more hops than IPv4 (6 vs 4)",
+		"loss at the destination: IPv4 0%, IPv6 50%",
+		"the AS paths diverge after AS4134: IPv4 continues to AS4809 at hop 3, IPv6 to AS1299 at hop 4",
+	}
+	if strings.Join(cmp.Verdict, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Verdict = %q", cmp.Verdict)
+	}
+}
+
+func TestCompareDualStackUnreachedAndFailed(t *testing.T) {
+	v4 := DualStackSideFromResult(net.ParseIP("192.0.2.1"), pathTestResult("10.0.0.1/64512", "192.0.2.1/64512"))
+	v6 := DualStackSideFromResult(net.ParseIP("2001:db8::1"), pathTestResult("fd00::1/64512", "", ""))
+	cmp := CompareDualStack("example.com", v4, v6)
+	if cmp.IPv6.Reached || cmp.IPv6.HopCount != 1 || cmp.IPv6.LossPct != 100 || cmp.Diverge != nil {
+		t.Fatalf("comparison = %+v", cmp)
+	}
+	if cmp.Verdict[0] != "only IPv4 reaches the destination; IPv6's last reply is at hop 1" ||
+		cmp.Verdict[1] != "IPv4 and IPv6 follow the same AS path" {
+		t.Fatalf("Verdict = %q", cmp.Verdict)
+	}
+
+	failed := CompareDualStack("example.com", v4, DualStackSideError(net.ParseIP("2001:db8::1"), errors.New("network is unreachable")))
+	if len(failed.Verdict) != 1 || failed.Verdict[0] != "IPv6 failed: network is unreachable" {
+		t.Fatalf("Verdict = %q", failed.Verdict)
+	}
+}
+
+func TestDualStackSideFromMTR(t *testing.T) {
+	s := DualStackSideFromMTR(net.ParseIP("192.0.2.1"), []MTRHopStat{
+		{TTL: 1, IP: "10.0.0.1", Received: 5},
+		{TTL: 2},
+		{TTL: 3, IP: "192.0.2.1", Received: 4, Loss: 20, Avg: 12},
+	})
+	if !s.Reached || s.HopCount != 3 || s.RTTMs != 12 || s.LossPct != 20 || s.ASPath != nil {
+		t.Fatalf("side = %+v", s)
+	}
+}
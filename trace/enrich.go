@@ -0,0 +1,86 @@
+package trace
+
+import (
+	"net"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+)
+
+// EnrichResult fills in geo data, and PTR names when config.RDNS is set, for
+// every answering hop of a result that was not produced by a live trace, such
+// as one parsed from another tool's output. Each address is looked up once;
+// an ASN the hop already carries is kept when the source has none.
+func EnrichResult(res *Result, config Config) {
+	if res == nil {
+		return
+	}
+	seen := map[string]*Hop{}
+	for i := range res.Hops {
+		for j := range res.Hops[i] {
+			h := &res.Hops[i][j]
+			if h.Address == nil {
+				continue
+			}
+			ip := h.Address.String()
+			if done, ok := seen[ip]; ok {
+				if done.Geo != nil {
+					h.Geo = keepImportedASN(done.Geo, h.Geo)
+				}
+				if h.Hostname == "" {
+					h.Hostname = done.Hostname
+				}
+				continue
+			}
+			if h.Lang == "" {
+				h.Lang = config.Lang
+			}
+			// A hop that already has geo data would skip the lookup.
+			prev := h.Geo
+			h.Geo = nil
+			_ = h.fetchIPData(config)
+			if h.Geo == nil {
+				h.Geo = prev
+			} else {
+				h.Geo = keepImportedASN(h.Geo, prev)
+			}
+			seen[ip] = h
+		}
+	}
+}
+
+// EnrichMTRStats is EnrichResult for MTR rows. Geo data the rows already
+// carry, such as the ASN column of mtr -z, is kept when the configured
+// source has nothing for the address.
+func EnrichMTRStats(stats []MTRHopStat, config Config) {
+	seen := map[string]*Hop{}
+	for i := range stats {
+		s := &stats[i]
+		ip := net.ParseIP(s.IP)
+		if ip == nil {
+			continue
+		}
+		h, ok := seen[s.IP]
+		if !ok {
+			h = &Hop{Address: &net.IPAddr{IP: ip}, Hostname: s.Host, TTL: s.TTL, Lang: config.Lang}
+			_ = h.fetchIPData(config)
+			seen[s.IP] = h
+		}
+		if h.Geo != nil {
+			s.Geo = keepImportedASN(h.Geo, s.Geo)
+		}
+		if s.Host == "" {
+			s.Host = h.Hostname
+		}
+	}
+}
+
+// keepImportedASN returns geo, carrying over the ASN of prev when the
+// provider answered without one.
+func keepImportedASN(geo, prev *ipgeo.IPGeoData) *ipgeo.IPGeoData {
+	if geo.Asnumber != "" || prev == nil || prev.Asnumber == "" {
+		return geo
+	}
+	merged := *geo
+	merged.Asnumber = prev.Asnumber
+	return &merged
+}
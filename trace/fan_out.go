@@ -0,0 +1,169 @@
+package trace
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FanOutResolver 为一个解析器对目标的应答
+type FanOutResolver struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// FanOutPath 汇总到一个解析结果地址的路径
+type FanOutPath struct {
+	// Rank 为按时延的排名，从 1 开始；未到达与失败的地址排在最后
+	Rank int `json:"rank"`
+	DualStackSide
+	// Resolvers 为返回了该地址的解析器
+	Resolvers []string `json:"resolvers"`
+}
+
+// FanOutReport 汇总对一个主机名全部解析结果的追踪
+type FanOutReport struct {
+	Target    string           `json:"target"`
+	Resolvers []FanOutResolver `json:"resolvers"`
+	Paths     []FanOutPath     `json:"paths"`
+	Verdict   []string         `json:"verdict"`
+}
+
+// FanOutAddresses 按首次出现的顺序合并各解析器返回的地址
+func FanOutAddresses(resolvers []FanOutResolver) []net.IP {
+	var ips []net.IP
+	seen := map[string]bool{}
+	for _, r := range resolvers {
+		for _, addr := range r.Addresses {
+			ip := net.ParseIP(addr)
+			if ip == nil || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// NewFanOutReport 按时延为各地址的路径排名，并给出各解析器把目标引向了哪里
+func NewFanOutReport(target string, resolvers []FanOutResolver, sides []DualStackSide) *FanOutReport {
+	r := &FanOutReport{Target: target, Resolvers: resolvers}
+	for _, s := range sides {
+		p := FanOutPath{DualStackSide: s}
+		for _, res := range resolvers {
+			if slices.ContainsFunc(res.Addresses, func(addr string) bool { return sameIP(addr, s.IP) }) {
+				p.Resolvers = append(p.Resolvers, res.Name)
+			}
+		}
+		r.Paths = append(r.Paths, p)
+	}
+	sort.SliceStable(r.Paths, func(i, j int) bool { return fanOutLess(r.Paths[i].DualStackSide, r.Paths[j].DualStackSide) })
+	for i := range r.Paths {
+		r.Paths[i].Rank = i + 1
+	}
+	r.Verdict = r.verdict()
+	return r
+}
+
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipB != nil && ipA.Equal(ipB)
+}
+
+// fanOutLess 先比较是否到达目标，到达的按时延与跳数，未到达的按最后有应答的跳（越远越好），失败的排最后
+func fanOutLess(a, b DualStackSide) bool {
+	if (a.Error == "") != (b.Error == "") {
+		return a.Error == ""
+	}
+	if a.Reached != b.Reached {
+		return a.Reached
+	}
+	if !a.Reached {
+		return a.HopCount > b.HopCount
+	}
+	if a.RTTMs != b.RTTMs {
+		return a.RTTMs < b.RTTMs
+	}
+	return a.HopCount < b.HopCount
+}
+
+func (r *FanOutReport) verdict() []string {
+	var reached []FanOutPath
+	for _, p := range r.Paths {
+		if p.Reached {
+			reached = append(reached, p)
+		}
+	}
+	lines := []string{fmt.Sprintf("%d of %d addresses reach the destination", len(reached), len(r.Paths))}
+	switch len(reached) {
+	case 0:
+	case 1:
+		lines = append(lines, fmt.Sprintf("only %s reaches it: %s", reached[0].IP, fanOutPathSummary(reached[0])))
+	default:
+		first, last := reached[0], reached[len(reached)-1]
+		lines = append(lines, fmt.Sprintf("fastest %s: %s; slowest %s: %s", first.IP, fanOutPathSummary(first), last.IP, fanOutPathSummary(last)))
+	}
+	if origins := fanOutOrigins(reached); len(origins) > 1 {
+		lines = append(lines, fmt.Sprintf("the addresses are announced from %d ASes: AS%s", len(origins), strings.Join(origins, ", AS")))
+	}
+	return append(lines, r.resolverVerdict()...)
+}
+
+func fanOutPathSummary(p FanOutPath) string {
+	return fmt.Sprintf("%.2f ms, %d hops", p.RTTMs, p.HopCount)
+}
+
+// fanOutOrigins 为各地址 AS 路径的最后一个 AS，即目标所在的 AS
+func fanOutOrigins(paths []FanOutPath) []string {
+	var origins []string
+	for _, p := range paths {
+		if n := len(p.ASPath); n > 0 && !slices.Contains(origins, p.ASPath[n-1]) {
+			origins = append(origins, p.ASPath[n-1])
+		}
+	}
+	return origins
+}
+
+// resolverVerdict 在多个解析器时说明它们是否给出相同的地址，不同时列出各自排名最高的地址
+func (r *FanOutReport) resolverVerdict() []string {
+	if len(r.Resolvers) < 2 {
+		return nil
+	}
+	var lines []string
+	var answered [][]string
+	for _, res := range r.Resolvers {
+		if res.Error != "" {
+			lines = append(lines, fmt.Sprintf("resolver %s failed: %s", res.Name, res.Error))
+			continue
+		}
+		addrs := slices.Clone(res.Addresses)
+		slices.Sort(addrs)
+		answered = append(answered, addrs)
+	}
+	if len(answered) < 2 {
+		return lines
+	}
+	same := true
+	for _, addrs := range answered[1:] {
+		same = same && slices.Equal(addrs, answered[0])
+	}
+	if same {
+		return append(lines, fmt.Sprintf("%d resolvers return the same addresses", len(answered)))
+	}
+	for _, res := range r.Resolvers {
+		if res.Error != "" {
+			continue
+		}
+		for _, p := range r.Paths {
+			if slices.Contains(p.Resolvers, res.Name) {
+				lines = append(lines, fmt.Sprintf("resolver %s steers to %s (rank %d of %d)", res.Name, p.IP, p.Rank, len(r.Paths)))
+				break
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,61 @@
+package trace
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNewFanOutReportRanksAddresses(t *testing.T) {
+	resolvers := []FanOutResolver{
+		{Name: "system", Addresses: []string{"192.0.2.1", "192.0.2.2"}},
+		{Name: "google", Addresses: []string{"198.51.100.1"}},
+		{Name: "cloudflare", Error: "i/o timeout"},
+	}
+	if ips := FanOutAddresses(append(resolvers, FanOutResolver{Name: "dnssb", Addresses: []string{"192.0.2.2"}})); len(ips) != 3 {
+		t.Fatalf("FanOutAddresses = %v", ips)
+	}
+	sides := []DualStackSide{
+		DualStackSideFromResult(net.ParseIP("192.0.2.1"), pathTestResult("10.0.0.1/64512", "203.0.113.1/4134", "192.0.2.1/13335")),
+		DualStackSideFromResult(net.ParseIP("192.0.2.2"), pathTestResult("10.0.0.1/64512", "", "")),
+		DualStackSideFromResult(net.ParseIP("198.51.100.1"), pathTestResult("10.0.0.1/64512", "198.51.100.1/20940")),
+	}
+	r := NewFanOutReport("example.com", resolvers, sides)
+	var order []string
+	for _, p := range r.Paths {
+		order = append(order, p.IP+"/"+strings.Join(p.Resolvers, ","))
+	}
+	if got := strings.Join(order, " "); got != "198.51.100.1/google 192.0.2.1/system 192.0.2.2/system" || r.Paths[2].Rank != 3 {
+		t.Fatalf("paths = %s", got)
+	}
+	want := []string{
+		"2 of 3 addresses reach the destination",
+		"fastest 198.51.100.1: 2.00 ms, 2 hops; slowest 192.0.2.1: 3.00 ms, 3 hops",
+		"the addresses are announced from 2 ASes: AS20940, AS13335",
+		"resolver cloudflare failed: i/o timeout",
+		"resolver system steers to 192.0.2.1 (rank 2 of 3)",
+		"resolver google steers to 198.51.100.1 (rank 1 of 3)",
+	}
+	if strings.Join(r.Verdict, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("Verdict = %q", r.Verdict)
+	}
+}
+
+func TestNewFanOutReportSameAnswersAndFailures(t *testing.T) {
+	resolvers := []FanOutResolver{
+		{Name: "system", Addresses: []string{"192.0.2.1", "2001:db8::1"}},
+		{Name: "google", Addresses: []string{"2001:db8::1", "192.0.2.1"}},
+	}
+	sides := []DualStackSide{
+		DualStackSideError(net.ParseIP("192.0.2.1"), errors.New("network is unreachable")),
+		DualStackSideFromResult(net.ParseIP("2001:db8::1"), pathTestResult("fd00::1/64512", "")),
+	}
+	r := NewFanOutReport("example.com", resolvers, sides)
+	if r.Paths[0].IP != "2001:db8::1" || r.Paths[1].Error == "" {
+		t.Fatalf("paths = %+v", r.Paths)
+	}
+	if strings.Join(r.Verdict, "\n") != "0 of 2 addresses reach the destination\n2 resolvers return the same addresses" {
+		t.Fatalf("Verdict = %q", r.Verdict)
+	}
+}
@@ -180,8 +180,13 @@ func resolveGlobalpingHopLimit(opts *GlobalpingOptions, config *Config, total in
 }
 
 func buildGlobalpingResult(gpHops []globalping.MTRHop, limit int, config *Config) *Result {
+	return buildGlobalpingResultWithGeo(gpHops, limit, config, map[string]*ipgeo.IPGeoData{})
+}
+
+// buildGlobalpingResultWithGeo shares geoMap between calls so hops seen by
+// several probes are looked up once.
+func buildGlobalpingResultWithGeo(gpHops []globalping.MTRHop, limit int, config *Config, geoMap map[string]*ipgeo.IPGeoData) *Result {
 	result := &Result{}
-	geoMap := map[string]*ipgeo.IPGeoData{}
 	maxTimings := maxGlobalpingTimings(gpHops, limit)
 	for i := 0; i < limit; i++ {
 		result.Hops = append(result.Hops, buildGlobalpingTTLHops(i+1, &gpHops[i], maxTimings, geoMap, config))
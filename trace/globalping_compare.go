@@ -0,0 +1,223 @@
+//go:build !flavor_tiny && !flavor_ntr
+
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jsdelivr/globalping-cli/globalping"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+)
+
+// GlobalpingProbeSummary is one vantage point of a comparison.
+type GlobalpingProbeSummary struct {
+	Location   string   `json:"location"`
+	ProbeASN   int      `json:"probe_asn,omitempty"`
+	Status     string   `json:"status"`
+	ResolvedIP string   `json:"resolved_ip,omitempty"`
+	Reached    bool     `json:"reached"`
+	HopCount   int      `json:"hop_count"`
+	FinalRTTMs float64  `json:"final_rtt_ms,omitempty"`
+	ASPath     []string `json:"as_path,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Result     *Result  `json:"result,omitempty"`
+}
+
+// GlobalpingHopGeo is one distinct hop address across all probes, enriched
+// with the configured IP geo source.
+type GlobalpingHopGeo struct {
+	IP     string           `json:"ip"`
+	SeenBy int              `json:"seen_by"`
+	Geo    *ipgeo.IPGeoData `json:"geo,omitempty"`
+}
+
+// GlobalpingComparison renders every probe of one measurement side by side.
+// ASNs lists the union of path ASNs in first-seen order; the matrix of which
+// probe crosses which ASN is derived from each probe's ASPath.
+type GlobalpingComparison struct {
+	Target string                   `json:"target"`
+	Probes []GlobalpingProbeSummary `json:"probes"`
+	ASNs   []string                 `json:"asns"`
+	Hops   []GlobalpingHopGeo       `json:"hops"`
+}
+
+// Crosses reports whether probe i's path includes asn.
+func (c *GlobalpingComparison) Crosses(i int, asn string) bool {
+	if c == nil || i < 0 || i >= len(c.Probes) {
+		return false
+	}
+	for _, hop := range c.Probes[i].ASPath {
+		if hop == asn {
+			return true
+		}
+	}
+	return false
+}
+
+// GlobalpingCompare runs one Globalping MTR measurement from several
+// locations and summarizes every probe that answered.
+func GlobalpingCompare(opts *GlobalpingOptions, config *Config) (*GlobalpingComparison, *globalping.Measurement, error) {
+	ctx := context.Background()
+	if config != nil && config.Context != nil {
+		ctx = config.Context
+	}
+	client := newGlobalpingClient(ctx)
+	measurement, err := createGlobalpingMeasurement(ctx, client, buildGlobalpingCompareMeasurement(opts))
+	if err != nil {
+		return nil, nil, err
+	}
+	cmp, err := buildGlobalpingComparison(opts, config, measurement)
+	return cmp, measurement, err
+}
+
+func buildGlobalpingCompareMeasurement(opts *GlobalpingOptions) *globalping.MeasurementCreate {
+	req := buildGlobalpingMeasurement(opts)
+	req.Locations = req.Locations[:0]
+	for _, loc := range opts.Locations {
+		if loc = strings.TrimSpace(loc); loc != "" {
+			req.Locations = append(req.Locations, globalping.Locations{Magic: loc})
+		}
+	}
+	if len(req.Locations) == 0 {
+		req.Locations = append(req.Locations, globalping.Locations{Magic: "world"})
+	}
+	req.Limit = opts.Probes
+	if req.Limit < len(req.Locations) {
+		req.Limit = len(req.Locations)
+	}
+	return req
+}
+
+func buildGlobalpingComparison(opts *GlobalpingOptions, config *Config, measurement *globalping.Measurement) (*GlobalpingComparison, error) {
+	if measurement.Status != globalping.StatusFinished {
+		return nil, fmt.Errorf("measurement did not complete successfully: %s", measurement.Status)
+	}
+	if len(measurement.Results) == 0 {
+		return nil, fmt.Errorf("globalping measurement returned no probe results")
+	}
+	cmp := &GlobalpingComparison{Target: opts.Target}
+	geoMap := map[string]*ipgeo.IPGeoData{}
+	seenBy := map[string]int{}
+	var hopOrder []string
+	asnSeen := map[string]bool{}
+
+	for i := range measurement.Results {
+		probe := &measurement.Results[i]
+		summary := GlobalpingProbeSummary{
+			Location:   GlobalpingFormatLocation(probe),
+			ProbeASN:   probe.Probe.ASN,
+			Status:     string(probe.Result.Status),
+			ResolvedIP: probe.Result.ResolvedAddress,
+		}
+		gpHops, err := decodeGlobalpingProbeHops(probe)
+		if err != nil {
+			summary.Error = err.Error()
+			cmp.Probes = append(cmp.Probes, summary)
+			continue
+		}
+		limit := resolveGlobalpingHopLimit(opts, config, len(gpHops))
+		summary.Result = buildGlobalpingResultWithGeo(gpHops, limit, config, geoMap)
+		summary.HopCount = limit
+		summarizeGlobalpingPath(&summary, gpHops[:limit])
+
+		probeIPs := map[string]bool{}
+		for _, hop := range gpHops[:limit] {
+			ip := hop.ResolvedAddress
+			if ip == "" || probeIPs[ip] {
+				continue
+			}
+			probeIPs[ip] = true
+			if seenBy[ip] == 0 {
+				hopOrder = append(hopOrder, ip)
+			}
+			seenBy[ip]++
+		}
+		for _, asn := range summary.ASPath {
+			if !asnSeen[asn] {
+				asnSeen[asn] = true
+				cmp.ASNs = append(cmp.ASNs, asn)
+			}
+		}
+		cmp.Probes = append(cmp.Probes, summary)
+	}
+	for _, ip := range hopOrder {
+		cmp.Hops = append(cmp.Hops, GlobalpingHopGeo{IP: ip, SeenBy: seenBy[ip], Geo: geoMap[ip]})
+	}
+	return cmp, nil
+}
+
+func decodeGlobalpingProbeHops(probe *globalping.ProbeMeasurement) ([]globalping.MTRHop, error) {
+	if probe.Result.Status != globalping.StatusFinished {
+		return nil, fmt.Errorf("probe %s", probe.Result.Status)
+	}
+	if len(probe.Result.HopsRaw) == 0 {
+		return nil, fmt.Errorf("probe returned no hop data")
+	}
+	hops, err := globalping.DecodeMTRHops(probe.Result.HopsRaw)
+	if err == nil && len(hops) == 0 {
+		err = fmt.Errorf("probe returned no hop data")
+	}
+	return hops, err
+}
+
+// summarizeGlobalpingPath fills the reachability, final RTT and AS path of
+// one probe. Hop ASNs come from our geo source when it knows the address and
+// fall back to the ASNs Globalping reported.
+func summarizeGlobalpingPath(summary *GlobalpingProbeSummary, hops []globalping.MTRHop) {
+	if len(hops) == 0 {
+		return
+	}
+	last := hops[len(hops)-1]
+	summary.Reached = last.ResolvedAddress != "" && sameIP(last.ResolvedAddress, summary.ResolvedIP)
+	if summary.Reached {
+		summary.FinalRTTMs = globalpingHopRTT(last)
+	}
+	var prev string
+	for i, hop := range hops {
+		asn := ""
+		if summary.Result != nil && i < len(summary.Result.Hops) {
+			for _, h := range summary.Result.Hops[i] {
+				if h.Geo != nil && h.Geo.Asnumber != "" {
+					asn = normalizeGlobalpingASN(h.Geo.Asnumber)
+					break
+				}
+			}
+		}
+		if asn == "" && len(hop.ASN) > 0 && hop.ASN[0] > 0 {
+			asn = strconv.Itoa(hop.ASN[0])
+		}
+		if asn == "" || asn == prev {
+			continue
+		}
+		summary.ASPath = append(summary.ASPath, asn)
+		prev = asn
+	}
+}
+
+func globalpingHopRTT(hop globalping.MTRHop) float64 {
+	if hop.Stats.Avg > 0 {
+		return hop.Stats.Avg
+	}
+	best := 0.0
+	for _, timing := range hop.Timings {
+		if timing.RTT > 0 && (best == 0 || timing.RTT < best) {
+			best = timing.RTT
+		}
+	}
+	return best
+}
+
+func normalizeGlobalpingASN(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > 2 && strings.EqualFold(raw[:2], "AS") {
+		raw = raw[2:]
+	}
+	if raw == "*" {
+		return ""
+	}
+	return raw
+}
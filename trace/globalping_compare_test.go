@@ -0,0 +1,87 @@
+//go:build !flavor_tiny && !flavor_ntr
+
+package trace
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jsdelivr/globalping-cli/globalping"
+)
+
+func globalpingTestProbe(city string, asn int, status globalping.MeasurementStatus, resolved string, hops string) globalping.ProbeMeasurement {
+	return globalping.ProbeMeasurement{
+		Probe: globalping.ProbeDetails{City: city, Country: "DE", ASN: asn},
+		Result: globalping.ProbeResult{
+			Status:          status,
+			ResolvedAddress: resolved,
+			HopsRaw:         json.RawMessage(hops),
+		},
+	}
+}
+
+func TestBuildGlobalpingCompareMeasurementUsesEveryLocation(t *testing.T) {
+	req := buildGlobalpingCompareMeasurement(&GlobalpingOptions{
+		Target:    "example.com",
+		Locations: []string{"Germany", " ", "AS13335"},
+		Probes:    1,
+	})
+	if len(req.Locations) != 2 || req.Locations[0].Magic != "Germany" || req.Locations[1].Magic != "AS13335" {
+		t.Fatalf("Locations = %#v", req.Locations)
+	}
+	if req.Limit != 2 {
+		t.Fatalf("Limit = %d, want at least one probe per location", req.Limit)
+	}
+	if req.Type != "mtr" {
+		t.Fatalf("Type = %q, want mtr", req.Type)
+	}
+}
+
+func TestBuildGlobalpingComparisonSummarizesProbes(t *testing.T) {
+	measurement := &globalping.Measurement{
+		Status: globalping.StatusFinished,
+		Results: []globalping.ProbeMeasurement{
+			globalpingTestProbe("Berlin", 3320, globalping.StatusFinished, "192.0.2.1", `[
+				{"resolvedAddress":"198.51.100.1","asn":[3320],"timings":[{"rtt":1.5}]},
+				{"resolvedAddress":"203.0.113.9","asn":[3356],"timings":[{"rtt":9}]},
+				{"resolvedAddress":"192.0.2.1","asn":[64500],"stats":{"avg":12.5},"timings":[{"rtt":12}]}
+			]`),
+			globalpingTestProbe("Munich", 8881, globalping.StatusFinished, "192.0.2.1", `[
+				{"resolvedAddress":"203.0.113.9","asn":[3356],"timings":[{"rtt":4}]},
+				{"resolvedAddress":"","asn":[],"timings":[]}
+			]`),
+			globalpingTestProbe("Hamburg", 0, globalping.StatusFailed, "", `[]`),
+		},
+	}
+
+	cmp, err := buildGlobalpingComparison(&GlobalpingOptions{Target: "example.com"}, nil, measurement)
+	if err != nil {
+		t.Fatalf("buildGlobalpingComparison() error = %v", err)
+	}
+	if len(cmp.Probes) != 3 {
+		t.Fatalf("Probes = %d, want 3", len(cmp.Probes))
+	}
+	reached, stuck, failed := cmp.Probes[0], cmp.Probes[1], cmp.Probes[2]
+	if !reached.Reached || reached.HopCount != 3 || reached.FinalRTTMs != 12.5 {
+		t.Fatalf("reached probe = %+v", reached)
+	}
+	if got := strings.Join(reached.ASPath, ","); got != "3320,3356,64500" {
+		t.Fatalf("AS path = %s", got)
+	}
+	if stuck.Reached || stuck.FinalRTTMs != 0 || stuck.HopCount != 2 {
+		t.Fatalf("unreached probe = %+v", stuck)
+	}
+	if failed.Error == "" || failed.Result != nil {
+		t.Fatalf("failed probe = %+v, want error and no result", failed)
+	}
+	if got := strings.Join(cmp.ASNs, ","); got != "3320,3356,64500" {
+		t.Fatalf("ASNs = %s", got)
+	}
+	if !cmp.Crosses(1, "3356") || cmp.Crosses(1, "3320") {
+		t.Fatal("ASN matrix does not match the probe paths")
+	}
+	if len(cmp.Hops) != 3 || cmp.Hops[1].IP != "203.0.113.9" || cmp.Hops[1].SeenBy != 2 {
+		t.Fatalf("Hops = %+v, want merged addresses with per-probe counts", cmp.Hops)
+	}
+}
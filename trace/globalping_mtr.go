@@ -0,0 +1,157 @@
+//go:build !flavor_tiny && !flavor_ntr
+
+package trace
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/jsdelivr/globalping-cli/globalping"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+)
+
+// GlobalpingMTRProbe is the final MTR table one Globalping probe reported.
+type GlobalpingMTRProbe struct {
+	Location string       `json:"location"`
+	Error    string       `json:"error,omitempty"`
+	Stats    []MTRHopStat `json:"stats,omitempty"`
+
+	// Records holds one raw MTR event per timing; it is only filled when
+	// opts.RawPrint asks for the streaming output.
+	Records []MTRRawRecord `json:"-"`
+}
+
+// GlobalpingMTR runs a Globalping MTR measurement and converts every probe's
+// per-hop statistics into MTRHopStat rows, so the local MTR renderers can
+// print them. Geo data comes from config.IPGeoSource, not from Globalping.
+func GlobalpingMTR(opts *GlobalpingOptions, config *Config) ([]GlobalpingMTRProbe, *globalping.Measurement, error) {
+	ctx := context.Background()
+	if config != nil && config.Context != nil {
+		ctx = config.Context
+	}
+	req := buildGlobalpingMeasurement(opts)
+	if len(opts.Locations) > 1 || opts.Probes > 1 {
+		req = buildGlobalpingCompareMeasurement(opts)
+	}
+	client := newGlobalpingClient(ctx)
+	measurement, err := createGlobalpingMeasurement(ctx, client, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	probes, err := buildGlobalpingMTRProbes(opts, config, measurement)
+	return probes, measurement, err
+}
+
+func buildGlobalpingMTRProbes(opts *GlobalpingOptions, config *Config, measurement *globalping.Measurement) ([]GlobalpingMTRProbe, error) {
+	if measurement.Status != globalping.StatusFinished {
+		return nil, fmt.Errorf("measurement did not complete successfully: %s", measurement.Status)
+	}
+	if len(measurement.Results) == 0 {
+		return nil, fmt.Errorf("globalping measurement returned no probe results")
+	}
+	geoMap := map[string]*ipgeo.IPGeoData{}
+	probes := make([]GlobalpingMTRProbe, 0, len(measurement.Results))
+	for i := range measurement.Results {
+		probe := &measurement.Results[i]
+		out := GlobalpingMTRProbe{Location: GlobalpingFormatLocation(probe)}
+		gpHops, err := decodeGlobalpingProbeHops(probe)
+		if err != nil {
+			out.Error = err.Error()
+		} else {
+			limit := resolveGlobalpingHopLimit(opts, config, len(gpHops))
+			out.Stats = buildGlobalpingMTRStats(gpHops, limit, config, geoMap)
+			if opts.RawPrint {
+				out.Records = buildGlobalpingMTRRawRecords(gpHops, limit, config, geoMap)
+			}
+		}
+		probes = append(probes, out)
+	}
+	if len(probes) == 1 && probes[0].Error != "" {
+		return nil, fmt.Errorf("globalping %s", probes[0].Error)
+	}
+	return probes, nil
+}
+
+// buildGlobalpingMTRStats maps Globalping's per-hop summary onto the columns
+// of a local MTR run. Globalping omits the summary for silent hops, so Snt,
+// Loss and the RTT columns fall back to the raw timings.
+func buildGlobalpingMTRStats(gpHops []globalping.MTRHop, limit int, config *Config, geoMap map[string]*ipgeo.IPGeoData) []MTRHopStat {
+	stats := make([]MTRHopStat, 0, limit)
+	for i := 0; i < limit; i++ {
+		gpHop := &gpHops[i]
+		hop := mapGlobalpingHop(i+1, gpHop, nil, geoMap, config)
+		stat := MTRHopStat{
+			TTL:  i + 1,
+			Host: hop.Hostname,
+			IP:   gpHop.ResolvedAddress,
+			Geo:  hop.Geo,
+		}
+
+		var rtts []float64
+		for _, timing := range gpHop.Timings {
+			if timing.RTT > 0 {
+				rtts = append(rtts, timing.RTT)
+			}
+		}
+		stat.Snt = gpHop.Stats.Total
+		stat.Received = gpHop.Stats.Rcv
+		if stat.Snt == 0 {
+			stat.Snt = len(gpHop.Timings)
+			stat.Received = len(rtts)
+		}
+		if stat.Snt > 0 {
+			stat.Loss = float64(stat.Snt-stat.Received) / float64(stat.Snt) * 100
+		}
+		if len(rtts) > 0 {
+			stat.Last = rtts[len(rtts)-1]
+		}
+		stat.Avg, stat.Best, stat.Wrst, stat.StDev = gpHop.Stats.Avg, gpHop.Stats.Min, gpHop.Stats.Max, gpHop.Stats.StDev
+		if stat.Avg == 0 && len(rtts) > 0 {
+			stat.Avg, stat.Best, stat.Wrst, stat.StDev = summarizeRTTs(rtts)
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// buildGlobalpingMTRRawRecords replays the timings round by round, the order
+// a local --raw run emits them in. Missing or zero timings become timeouts.
+func buildGlobalpingMTRRawRecords(gpHops []globalping.MTRHop, limit int, config *Config, geoMap map[string]*ipgeo.IPGeoData) []MTRRawRecord {
+	var cfg Config
+	if config != nil {
+		cfg = *config
+	}
+	rounds := maxGlobalpingTimings(gpHops, limit)
+	records := make([]MTRRawRecord, 0, rounds*limit)
+	for j := 0; j < rounds; j++ {
+		for i := 0; i < limit; i++ {
+			timing := globalpingTimingAt(&gpHops[i], j)
+			if timing == nil || timing.RTT <= 0 {
+				records = append(records, MTRRawRecord{Iteration: j + 1, TTL: i + 1})
+				continue
+			}
+			hop := mapGlobalpingHop(i+1, &gpHops[i], timing, geoMap, config)
+			records = append(records, buildMTRRawRecord(j+1, hop, cfg))
+		}
+	}
+	return records
+}
+
+func summarizeRTTs(rtts []float64) (avg, best, worst, stdev float64) {
+	best, worst = rtts[0], rtts[0]
+	var sum, sumSq float64
+	for _, rtt := range rtts {
+		sum += rtt
+		sumSq += rtt * rtt
+		best = math.Min(best, rtt)
+		worst = math.Max(worst, rtt)
+	}
+	n := float64(len(rtts))
+	avg = sum / n
+	if len(rtts) > 1 {
+		stdev = math.Sqrt(math.Max(0, (sumSq-n*avg*avg)/(n-1)))
+	}
+	return avg, best, worst, stdev
+}
@@ -0,0 +1,90 @@
+//go:build !flavor_tiny && !flavor_ntr
+
+package trace
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/jsdelivr/globalping-cli/globalping"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+)
+
+func TestBuildGlobalpingMTRStats(t *testing.T) {
+	hops, err := globalping.DecodeMTRHops(json.RawMessage(`[
+		{"resolvedAddress":"192.0.2.1","resolvedHostname":"gw.example.net.",
+		 "stats":{"min":1,"avg":2,"max":3,"stDev":0.5,"total":4,"rcv":3},
+		 "timings":[{"rtt":1},{"rtt":3},{"rtt":2}]},
+		{"resolvedAddress":"","timings":[]},
+		{"resolvedAddress":"198.51.100.7","timings":[{"rtt":10},{"rtt":0},{"rtt":14}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo := &ipgeo.IPGeoData{Asnumber: "64500"}
+	stats := buildGlobalpingMTRStats(hops, len(hops), &Config{RDNS: true}, map[string]*ipgeo.IPGeoData{"192.0.2.1": geo})
+	if len(stats) != 3 {
+		t.Fatalf("stats = %d rows, want 3", len(stats))
+	}
+
+	first := stats[0]
+	if first.TTL != 1 || first.IP != "192.0.2.1" || first.Host != "gw.example.net" || first.Geo != geo {
+		t.Fatalf("first hop = %+v", first)
+	}
+	if first.Snt != 4 || first.Received != 3 || first.Loss != 25 || first.Last != 2 {
+		t.Fatalf("first hop counters = %+v", first)
+	}
+	if first.Avg != 2 || first.Best != 1 || first.Wrst != 3 || first.StDev != 0.5 {
+		t.Fatalf("first hop RTTs = %+v, want Globalping stats", first)
+	}
+
+	if silent := stats[1]; silent.IP != "" || silent.Snt != 0 || silent.Loss != 0 {
+		t.Fatalf("silent hop = %+v", silent)
+	}
+
+	third := stats[2]
+	if third.Snt != 3 || third.Received != 2 || math.Abs(third.Loss-100.0/3) > 1e-9 {
+		t.Fatalf("third hop counters = %+v, want timings fallback", third)
+	}
+	if third.Avg != 12 || third.Best != 10 || third.Wrst != 14 || math.Abs(third.StDev-math.Sqrt(8)) > 1e-9 {
+		t.Fatalf("third hop RTTs = %+v", third)
+	}
+}
+
+func TestBuildGlobalpingMTRProbes(t *testing.T) {
+	measurement := &globalping.Measurement{
+		Status: globalping.StatusFinished,
+		Results: []globalping.ProbeMeasurement{
+			globalpingTestProbe("Berlin", 3320, globalping.StatusFinished, "192.0.2.1", `[
+				{"resolvedAddress":"198.51.100.1","timings":[{"rtt":1.5},{"rtt":2.5}]},
+				{"resolvedAddress":"192.0.2.1","timings":[{"rtt":9}]}
+			]`),
+			globalpingTestProbe("Hamburg", 0, globalping.StatusFailed, "", `[]`),
+		},
+	}
+	probes, err := buildGlobalpingMTRProbes(&GlobalpingOptions{RawPrint: true}, nil, measurement)
+	if err != nil {
+		t.Fatalf("buildGlobalpingMTRProbes() error = %v", err)
+	}
+	if len(probes) != 2 || len(probes[0].Stats) != 2 || probes[1].Error == "" {
+		t.Fatalf("probes = %+v", probes)
+	}
+	// Two rounds over two hops; the second hop answered once.
+	records := probes[0].Records
+	if len(records) != 4 {
+		t.Fatalf("raw records = %d, want 4", len(records))
+	}
+	if records[1].TTL != 2 || !records[1].Success || records[1].RTTMs != 9 {
+		t.Fatalf("round 1 hop 2 = %+v", records[1])
+	}
+	if last := records[3]; last.Iteration != 2 || last.TTL != 2 || last.Success || last.IP != "" {
+		t.Fatalf("round 2 hop 2 = %+v, want timeout", last)
+	}
+
+	measurement.Results = measurement.Results[1:]
+	if _, err := buildGlobalpingMTRProbes(&GlobalpingOptions{}, nil, measurement); err == nil {
+		t.Fatal("a single failed probe should be reported as an error")
+	}
+}
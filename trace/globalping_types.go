@@ -14,6 +14,13 @@ type GlobalpingOptions struct {
 	Packets int
 	MaxHops int
 
+	// Locations and Probes drive the multi-vantage comparison; From is the
+	// single-location form. CompareLocal pairs the single probe with a local
+	// trace instead.
+	Locations    []string
+	Probes       int
+	CompareLocal bool
+
 	DisableMaptrace bool
 	DataOrigin      string
 
@@ -22,4 +29,11 @@ type GlobalpingOptions struct {
 	ClassicPrint bool
 	RawPrint     bool
 	JSONPrint    bool
+
+	// MTRPrint renders the measurement with the MTR table/report printers;
+	// ReportPrint, WidePrint and ShowIPs mirror --report, --wide and --show-ips.
+	MTRPrint    bool
+	ReportPrint bool
+	WidePrint   bool
+	ShowIPs     bool
 }
@@ -13,6 +13,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"golang.org/x/sync/semaphore"
 
@@ -170,12 +171,13 @@ func (t *ICMPTracer) dropSent(seq int) {
 	delete(t.sentAt, seq)
 }
 
-func (t *ICMPTracer) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duration, mpls []string) {
+func (t *ICMPTracer) addHopWithIndex(h Hop, i int) {
+	ttl := h.TTL
 	if f := t.final.Load(); f != -1 && ttl > int(f) {
 		return
 	}
 
-	if ip := util.AddrIP(peer); ip != nil && ip.Equal(t.DstIP) {
+	if ip := util.AddrIP(h.Address); ip != nil && ip.Equal(t.DstIP) {
 		for {
 			old := t.final.Load()
 			if old != -1 && ttl >= int(old) {
@@ -187,13 +189,6 @@ func (t *ICMPTracer) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duratio
 		}
 	}
 
-	h := Hop{
-		Success: true,
-		Address: peer,
-		TTL:     ttl,
-		RTT:     rtt,
-		MPLS:    mpls,
-	}
 	t.res.addWithGeoAsync(h, i, t.NumMeasurements, t.MaxAttempts, t.Config)
 }
 
@@ -222,6 +217,7 @@ func (t *ICMPTracer) matchWorker(ctx context.Context) {
 			// 尝试一次匹配
 			start, ok := t.lookupSent(task.seq)
 			if !ok {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionNoProbe)
 				continue
 			}
 
@@ -236,7 +232,10 @@ func (t *ICMPTracer) matchWorker(ctx context.Context) {
 
 			if t.clearPending(task.seq) {
 				rtt := task.finish.Sub(start)
-				t.addHopWithIndex(task.peer, ttl, i, rtt, task.mpls)
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, matchedDecision(ttl, i, rtt))
+				t.addHopWithIndex(task.hop(ttl, rtt), i)
+			} else {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, lateDecision(ttl, i))
 			}
 			t.dropSent(task.seq)
 		}
@@ -282,6 +281,7 @@ func (t *ICMPTracer) Execute() (res *Result, err error) {
 		t.DstIP,
 	)
 	applyICMPSourceDevice(s, t.OSType, t.SourceDevice)
+	s.OnDiscard = t.Capture.discardFunc(t.SrcIP)
 
 	s.InitICMP()
 	defer s.Close()
@@ -358,9 +358,11 @@ func (t *ICMPTracer) handleICMPMessage(msg internal.ReceivedMessage, finish time
 	select {
 	case t.matchQ <- matchTask{
 		seq: seq, peer: msg.Peer, finish: finish, mpls: mpls,
+		proto: layers.IPProtocolICMPv4, raw: msg.Msg, replyTTL: msg.TTL,
 	}:
 	default:
 		// 丢弃以避免阻塞抓包循环
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionQueueFull)
 	}
 }
 
@@ -446,5 +448,6 @@ func (t *ICMPTracer) send(ctx context.Context, s *internal.ICMPSpec, ttl, i int)
 		return err
 	}
 	t.storeSent(seq, start)
+	t.Capture.probe(start, ttl, i, ipHeader, icmpHeader, gopacket.Payload(payload))
 	return nil
 }
@@ -13,6 +13,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"golang.org/x/sync/semaphore"
 
@@ -34,6 +35,7 @@ type ICMPTracerv6 struct {
 	sem       *semaphore.Weighted
 	matchQ    chan matchTask
 	readyICMP chan struct{}
+	ipv6      *ipv6Prober
 }
 
 func (t *ICMPTracerv6) waitAllReady(ctx context.Context) {
@@ -170,12 +172,13 @@ func (t *ICMPTracerv6) dropSent(seq int) {
 	delete(t.sentAt, seq)
 }
 
-func (t *ICMPTracerv6) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duration, mpls []string) {
+func (t *ICMPTracerv6) addHopWithIndex(h Hop, i int) {
+	ttl := h.TTL
 	if f := t.final.Load(); f != -1 && ttl > int(f) {
 		return
 	}
 
-	if ip := util.AddrIP(peer); ip != nil && ip.Equal(t.DstIP) {
+	if ip := util.AddrIP(h.Address); ip != nil && ip.Equal(t.DstIP) {
 		for {
 			old := t.final.Load()
 			if old != -1 && ttl >= int(old) {
@@ -187,13 +190,6 @@ func (t *ICMPTracerv6) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Durat
 		}
 	}
 
-	h := Hop{
-		Success: true,
-		Address: peer,
-		TTL:     ttl,
-		RTT:     rtt,
-		MPLS:    mpls,
-	}
 	t.res.addWithGeoAsync(h, i, t.NumMeasurements, t.MaxAttempts, t.Config)
 }
 
@@ -222,6 +218,7 @@ func (t *ICMPTracerv6) matchWorker(ctx context.Context) {
 			// 尝试一次匹配
 			start, ok := t.lookupSent(task.seq)
 			if !ok {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionNoProbe)
 				continue
 			}
 
@@ -236,7 +233,10 @@ func (t *ICMPTracerv6) matchWorker(ctx context.Context) {
 
 			if t.clearPending(task.seq) {
 				rtt := task.finish.Sub(start)
-				t.addHopWithIndex(task.peer, ttl, i, rtt, task.mpls)
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, matchedDecision(ttl, i, rtt))
+				t.addHopWithIndex(task.hop(ttl, rtt), i)
+			} else {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, lateDecision(ttl, i))
 			}
 			t.dropSent(task.seq)
 		}
@@ -273,6 +273,11 @@ func (t *ICMPTracerv6) Execute() (res *Result, err error) {
 	if t.SrcIP == nil {
 		return nil, errors.New("cannot determine local IPv6 address")
 	}
+	t.ipv6, err = newIPv6Prober(t.IPv6, t.SrcIP, t.DstIP, t.SourceDevice)
+	if err != nil {
+		return nil, err
+	}
+	defer t.ipv6.close()
 
 	s := internal.NewICMPSpec(
 		6,
@@ -282,6 +287,7 @@ func (t *ICMPTracerv6) Execute() (res *Result, err error) {
 		t.DstIP,
 	)
 	applyICMPSourceDevice(s, t.OSType, t.SourceDevice)
+	s.OnDiscard = t.Capture.discardFunc(t.SrcIP)
 
 	s.InitICMP()
 	defer s.Close()
@@ -358,9 +364,11 @@ func (t *ICMPTracerv6) handleICMPMessage(msg internal.ReceivedMessage, finish ti
 	select {
 	case t.matchQ <- matchTask{
 		seq: seq, peer: msg.Peer, finish: finish, mpls: mpls,
+		proto: layers.IPProtocolICMPv6, raw: msg.Msg, replyTTL: msg.TTL,
 	}:
 	default:
 		// 丢弃以避免阻塞抓包循环
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv6, msg.TTL, msg.Msg, decisionQueueFull)
 	}
 }
 
@@ -443,11 +451,19 @@ func (t *ICMPTracerv6) send(ctx context.Context, s *internal.ICMPSpec, ttl, i in
 		t.dropSent(seq)
 	}(seq, ttl, i)
 
-	start, err := s.SendICMP(ctx, ipHeader, icmpHeader, icmpEcho, payload)
+	var start time.Time
+	var err error
+	sent := []gopacket.SerializableLayer{ipHeader, icmpHeader, icmpEcho, gopacket.Payload(payload)}
+	if t.ipv6 != nil {
+		start, sent, err = t.ipv6.send(ctx, ipHeader, icmpHeader, icmpEcho, gopacket.Payload(payload))
+	} else {
+		start, err = s.SendICMP(ctx, ipHeader, icmpHeader, icmpEcho, payload)
+	}
 	if err != nil {
 		_ = t.clearPending(seq)
 		return err
 	}
 	t.storeSent(seq, start)
+	t.Capture.probe(start, ttl, i, sent...)
 	return nil
 }
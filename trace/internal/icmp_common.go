@@ -70,6 +70,8 @@ func (s *ICMPSpec) listenICMPSock(ctx context.Context, ready chan struct{}, onIC
 			finish, seq, ok := s.decodeICMPSocketMessage(msg)
 			if ok {
 				onICMP(msg, finish, seq)
+			} else {
+				s.OnDiscard.call(msg, finish, icmpProtocol(s.IPVersion))
 			}
 		}
 	}
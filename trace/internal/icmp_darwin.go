@@ -27,6 +27,7 @@ type ICMPSpec struct {
 	SrcIP        net.IP
 	DstIP        net.IP
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	icmp         net.PacketConn
 	icmp4        *ipv4.PacketConn
 	icmp6        *ipv6.PacketConn
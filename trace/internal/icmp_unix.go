@@ -14,6 +14,8 @@ import (
 	"github.com/google/gopacket/layers"
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
+
+	"github.com/nxtrace/NTrace-core/util"
 )
 
 type ICMPSpec struct {
@@ -23,6 +25,7 @@ type ICMPSpec struct {
 	SrcIP        net.IP
 	DstIP        net.IP
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	icmp         net.PacketConn
 	icmp4        *ipv4.PacketConn
 	icmp6        *ipv6.PacketConn
@@ -30,7 +33,7 @@ type ICMPSpec struct {
 }
 
 func ListenPacket(network string, laddr string) (net.PacketConn, error) {
-	return net.ListenPacket(network, laddr)
+	return util.ListenPacket(network, laddr)
 }
 
 func (s *ICMPSpec) Close() {
@@ -0,0 +1,43 @@
+//go:build linux
+
+package internal
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// IPv6RawSender 发送自带 IPv6 头的完整报文。
+// Linux 上协议号为 IPPROTO_RAW 的 IPv6 原始套接字隐含 IPV6_HDRINCL，
+// 流标签与扩展头按原样发出；回包仍由各协议原有的套接字接收
+type IPv6RawSender struct {
+	conn net.PacketConn
+	dst  *net.IPAddr
+}
+
+func NewIPv6RawSender(srcIP, dstIP net.IP, sourceDevice string) (*IPv6RawSender, error) {
+	conn, err := util.ListenPacket("ip6:255", srcIP.String())
+	if err != nil {
+		return nil, fmt.Errorf("open raw IPv6 socket: %w", err)
+	}
+	if err := bindPacketConnToSourceDevice(conn, 6, sourceDevice); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &IPv6RawSender{conn: conn, dst: &net.IPAddr{IP: dstIP}}, nil
+}
+
+func (s *IPv6RawSender) Send(packet []byte) (time.Time, error) {
+	start := time.Now()
+	if _, err := s.conn.WriteTo(packet, s.dst); err != nil {
+		return time.Time{}, err
+	}
+	return start, nil
+}
+
+func (s *IPv6RawSender) Close() error {
+	return s.conn.Close()
+}
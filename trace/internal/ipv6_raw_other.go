@@ -0,0 +1,24 @@
+//go:build !linux && !(windows && amd64)
+
+package internal
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// IPv6RawSender 在本平台不可用：没有可以自带 IPv6 头发送的原始套接字
+type IPv6RawSender struct{}
+
+func NewIPv6RawSender(_, _ net.IP, _ string) (*IPv6RawSender, error) {
+	return nil, errors.New("IPv6 flow label and extension headers are only supported on Linux and Windows")
+}
+
+func (s *IPv6RawSender) Send(_ []byte) (time.Time, error) {
+	return time.Time{}, errors.ErrUnsupported
+}
+
+func (s *IPv6RawSender) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+//go:build windows && amd64
+
+package internal
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	wd "github.com/xjasonlyu/windivert-go"
+)
+
+// IPv6RawSender 经 WinDivert 注入自带 IPv6 头的完整报文，流标签与扩展头按原样发出
+type IPv6RawSender struct {
+	handle wd.Handle
+	addr   wd.Address
+	mu     sync.Mutex
+}
+
+func NewIPv6RawSender(_, _ net.IP, sourceDevice string) (*IPv6RawSender, error) {
+	if sourceDevice != "" {
+		return nil, fmt.Errorf("source_device %q is not supported with IPv6 flow label or extension headers on Windows", sourceDevice)
+	}
+	handle, err := OpenWinDivertHandle("false", 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", formatWinDivertRequiredError("Windows IPv6 flow label / extension headers", err), err)
+	}
+	s := &IPv6RawSender{handle: handle}
+	s.addr.SetLayer(wd.LayerNetwork)
+	s.addr.SetEvent(wd.EventNetworkPacket)
+	s.addr.SetOutbound()
+	s.addr.SetIPv6()
+	return s, nil
+}
+
+func (s *IPv6RawSender) Send(packet []byte) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := time.Now()
+	if _, err := s.handle.Send(packet, &s.addr); err != nil {
+		return time.Time{}, err
+	}
+	return start, nil
+}
+
+func (s *IPv6RawSender) Close() error {
+	return s.handle.Close()
+}
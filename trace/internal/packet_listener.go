@@ -5,12 +5,48 @@ import (
 	"errors"
 	"net"
 	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/nxtrace/NTrace-core/util"
 )
 
 type ReceivedMessage struct {
 	Peer net.Addr
 	Msg  []byte
-	Err  error
+	// TTL 为报文到达时 IP 头中的 TTL / Hop Limit，0 表示未知
+	TTL int
+	Err error
+}
+
+// DiscardFunc 接收监听器读到但没有交给回调的消息，proto 为消息所属协议
+type DiscardFunc func(msg ReceivedMessage, finish time.Time, proto layers.IPProtocol)
+
+func (f DiscardFunc) call(msg ReceivedMessage, finish time.Time, proto layers.IPProtocol) {
+	if f != nil && msg.Err == nil {
+		f(msg, finish, proto)
+	}
+}
+
+// packetTTL 返回抓到的报文 IP 头中的 TTL / Hop Limit，没有 IP 层时返回 0
+func packetTTL(pkt gopacket.Packet) int {
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		return int(ip.TTL)
+	case *layers.IPv6:
+		return int(ip.HopLimit)
+	}
+	return 0
+}
+
+func icmpProtocol(ipVersion int) layers.IPProtocol {
+	if ipVersion == 6 {
+		return layers.IPProtocolICMPv6
+	}
+	return layers.IPProtocolICMPv4
 }
 
 // PacketListener 负责监听网络数据包并通过通道传递接收到的消息
@@ -39,9 +75,10 @@ func (l *PacketListener) Start(ctx context.Context) {
 	}()
 
 	buf := make([]byte, 4096)
+	read := newTTLReader(l.Conn)
 
 	for {
-		n, peer, err := l.Conn.ReadFrom(buf)
+		n, ttl, peer, err := read(buf)
 		if err != nil {
 			// 连接关闭或 ctx 取消：直接退出
 			if errors.Is(err, net.ErrClosed) || ctx.Err() != nil {
@@ -67,10 +104,51 @@ func (l *PacketListener) Start(ctx context.Context) {
 
 		// 限时等待投递数据；超时或取消就丢弃/退出
 		select {
-		case l.ch <- ReceivedMessage{Peer: peer, Msg: pkt}:
+		case l.ch <- ReceivedMessage{Peer: peer, Msg: pkt, TTL: ttl}:
 		case <-ctx.Done():
 			return
 		case <-time.After(5 * time.Second):
 		}
 	}
 }
+
+// ttlReader 读取一个报文，同时返回它到达时的 TTL / Hop Limit（0 表示未知）
+type ttlReader func(b []byte) (n, ttl int, peer net.Addr, err error)
+
+// newTTLReader 尝试通过 IP_RECVTTL / IPV6_RECVHOPLIMIT 控制消息取得回包 TTL；
+// 平台或套接字不支持时退回普通的 ReadFrom
+func newTTLReader(conn net.PacketConn) ttlReader {
+	plain := func(b []byte) (int, int, net.Addr, error) {
+		n, peer, err := conn.ReadFrom(b)
+		return n, 0, peer, err
+	}
+
+	ip := util.AddrIP(conn.LocalAddr())
+	if ip == nil {
+		return plain
+	}
+	if ip.To4() != nil {
+		p := ipv4.NewPacketConn(conn)
+		if err := p.SetControlMessage(ipv4.FlagTTL, true); err != nil {
+			return plain
+		}
+		return func(b []byte) (int, int, net.Addr, error) {
+			n, cm, peer, err := p.ReadFrom(b)
+			if cm == nil {
+				return n, 0, peer, err
+			}
+			return n, cm.TTL, peer, err
+		}
+	}
+	p := ipv6.NewPacketConn(conn)
+	if err := p.SetControlMessage(ipv6.FlagHopLimit, true); err != nil {
+		return plain
+	}
+	return func(b []byte) (int, int, net.Addr, error) {
+		n, cm, peer, err := p.ReadFrom(b)
+		if cm == nil {
+			return n, 0, peer, err
+		}
+		return n, cm.HopLimit, peer, err
+	}
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"github.com/google/gopacket"
+	"golang.org/x/net/icmp"
+)
+
+// 以下导出函数供离线解析抓包文件使用，复用与实时探测相同的解码逻辑
+
+// DecodeICMPError 返回 ICMP 差错报文（超时、不可达、包过大）引用的原始探测包
+func DecodeICMPError(ipVersion int, msg []byte) ([]byte, bool) {
+	rm, ok := parseSocketICMPMessage(ipVersion, msg)
+	if !ok {
+		return nil, false
+	}
+	return extractSocketICMPErrorBody(ipVersion, rm)
+}
+
+// DecodeICMPEchoReply 返回 Echo Reply 的 ID 与序号
+func DecodeICMPEchoReply(ipVersion int, msg []byte) (id, seq int, ok bool) {
+	rm, ok := parseSocketICMPMessage(ipVersion, msg)
+	if !ok || !isSocketICMPEchoReply(ipVersion, rm) {
+		return 0, 0, false
+	}
+	echo, ok := rm.Body.(*icmp.Echo)
+	if !ok || echo == nil {
+		return 0, 0, false
+	}
+	return echo.ID, echo.Seq, true
+}
+
+// DecodeTCPProbeReply 按 TCP 探测器的规则解析目标回应的 SYN/ACK 或 RST：
+// srcPort 为探测包的源端口；SYN/ACK 给出探测序号 seq，RST 给出确认号 ack
+func DecodeTCPProbeReply(ipVersion, dstPort int, pkt gopacket.Packet) (srcPort, seq, ack int, ok bool) {
+	srcPort, seq, ack, _, ok = decodeTCPProbePacket(ipVersion, dstPort, pkt)
+	return srcPort, seq, ack, ok
+}
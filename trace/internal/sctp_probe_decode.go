@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"encoding/binary"
+)
+
+const (
+	sctpChunkInitAck = 2
+	sctpChunkAbort   = 6
+)
+
+// sctpNetwork 为收发 SCTP 的原始套接字网络名；Go 的协议表不含 sctp，直接用协议号
+func sctpNetwork(ipVersion int) string {
+	if ipVersion == 6 {
+		return "ip6:132"
+	}
+	return "ip4:132"
+}
+
+// sctpProbeReply 从目标回的 SCTP 报文中取出探测的源端口与验证标签。
+// 只接受首个 chunk 为 INIT-ACK 或 ABORT 的报文：两者的验证标签都是探测 INIT 的 Initiate Tag；
+// 置了 T 位的 ABORT 反射的是探测包自身为 0 的验证标签，此时返回 tag 0，由上层按端口匹配
+func sctpProbeReply(data []byte, dstPort int) (srcPort, tag int, ok bool) {
+	if len(data) < 16 {
+		return 0, 0, false
+	}
+	if int(binary.BigEndian.Uint16(data[0:2])) != dstPort {
+		return 0, 0, false
+	}
+	switch data[12] {
+	case sctpChunkInitAck:
+	case sctpChunkAbort:
+		if data[13]&0x01 != 0 {
+			return int(binary.BigEndian.Uint16(data[2:4])), 0, true
+		}
+	default:
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint16(data[2:4])), int(binary.BigEndian.Uint32(data[4:8])), true
+}
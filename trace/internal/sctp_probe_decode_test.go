@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func sctpReplyBytes(srcPort, dstPort uint16, vtag uint32, chunk, flags byte) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint16(b[0:2], srcPort)
+	binary.BigEndian.PutUint16(b[2:4], dstPort)
+	binary.BigEndian.PutUint32(b[4:8], vtag)
+	b[12] = chunk
+	b[13] = flags
+	binary.BigEndian.PutUint16(b[14:16], 4)
+	return b
+}
+
+func TestSCTPProbeReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantPort int
+		wantTag  int
+		wantOK   bool
+	}{
+		{name: "init-ack", data: sctpReplyBytes(80, 40000, 0x03000001, sctpChunkInitAck, 0), wantPort: 40000, wantTag: 0x03000001, wantOK: true},
+		{name: "abort", data: sctpReplyBytes(80, 40000, 0x03000001, sctpChunkAbort, 0), wantPort: 40000, wantTag: 0x03000001, wantOK: true},
+		{name: "abort-t-bit", data: sctpReplyBytes(80, 40000, 0, sctpChunkAbort, 0x01), wantPort: 40000, wantTag: 0, wantOK: true},
+		{name: "other-port", data: sctpReplyBytes(443, 40000, 1, sctpChunkInitAck, 0)},
+		{name: "heartbeat", data: sctpReplyBytes(80, 40000, 1, 4, 0)},
+		{name: "truncated", data: sctpReplyBytes(80, 40000, 1, sctpChunkInitAck, 0)[:12]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, tag, ok := sctpProbeReply(tt.data, 80)
+			if ok != tt.wantOK || port != tt.wantPort || tag != tt.wantTag {
+				t.Fatalf("sctpProbeReply() = %d, %#x, %v; want %d, %#x, %v", port, tag, ok, tt.wantPort, tt.wantTag, tt.wantOK)
+			}
+		})
+	}
+	if got := sctpNetwork(6); got != "ip6:132" {
+		t.Fatalf("sctpNetwork(6) = %q", got)
+	}
+}
@@ -0,0 +1,150 @@
+//go:build !(windows && amd64)
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+type SCTPSpec struct {
+	IPVersion    int
+	ICMPMode     int
+	SrcIP        net.IP
+	DstIP        net.IP
+	DstPort      int
+	SourceDevice string
+	OnDiscard    DiscardFunc
+	icmp         net.PacketConn
+	sctp         net.PacketConn
+	sctp4        *ipv4.PacketConn
+	sctp6        *ipv6.PacketConn
+	hopLimitLock sync.Mutex
+}
+
+func (s *SCTPSpec) InitSCTP() {
+	network := sctpNetwork(s.IPVersion)
+
+	sctp, err := util.ListenPacket(network, s.SrcIP.String())
+	if err != nil {
+		if util.EnvDevMode {
+			panic(fmt.Errorf("(InitSCTP) ListenPacket(%s, %s) failed: %v", network, s.SrcIP, err))
+		}
+		log.Fatalf("(InitSCTP) ListenPacket(%s, %s) failed: %v", network, s.SrcIP, err)
+	}
+	if s.SourceDevice != "" {
+		if err := bindPacketConnToSourceDevice(sctp, s.IPVersion, s.SourceDevice); err != nil {
+			_ = sctp.Close()
+			if util.EnvDevMode {
+				panic(fmt.Errorf("(InitSCTP) bind source device %q failed: %v", s.SourceDevice, err))
+			}
+			log.Fatalf("(InitSCTP) bind source device %q failed: %v", s.SourceDevice, err)
+		}
+	}
+	s.sctp = sctp
+
+	if s.IPVersion == 4 {
+		s.sctp4 = ipv4.NewPacketConn(s.sctp)
+	} else {
+		s.sctp6 = ipv6.NewPacketConn(s.sctp)
+	}
+}
+
+func (s *SCTPSpec) Close() {
+	_ = s.icmp.Close()
+	_ = s.sctp.Close()
+}
+
+func (s *SCTPSpec) ListenICMP(ctx context.Context, ready chan struct{}, onICMP func(msg ReceivedMessage, finish time.Time, data []byte)) {
+	s.listenICMPSock(ctx, ready, onICMP)
+}
+
+func (s *SCTPSpec) ListenSCTP(ctx context.Context, ready chan struct{}, onSCTP func(srcPort, tag int, msg ReceivedMessage, finish time.Time)) {
+	lc := NewPacketListener(s.sctp)
+	go lc.Start(ctx)
+	close(ready)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-lc.Messages:
+			if !ok {
+				return
+			}
+
+			if msg.Err != nil {
+				continue
+			}
+			finish := time.Now()
+
+			// 原始 SCTP 套接字能看到本机的全部 SCTP 流量，只关心来自目标的报文
+			if ip := util.AddrIP(msg.Peer); ip == nil || !ip.Equal(s.DstIP) {
+				continue
+			}
+
+			srcPort, tag, ok := sctpProbeReply(msg.Msg, s.DstPort)
+			if !ok {
+				s.OnDiscard.call(msg, finish, layers.IPProtocolSCTP)
+				continue
+			}
+			onSCTP(srcPort, tag, msg, finish)
+		}
+	}
+}
+
+// SendSCTP 发送已带校验和的 SCTP 报文；IP 头由内核按 ipHdr 中的 TTL 与 TOS 生成
+func (s *SCTPSpec) SendSCTP(ctx context.Context, ipHdr gopacket.NetworkLayer, packet []byte) (time.Time, error) {
+	select {
+	case <-ctx.Done():
+		return time.Time{}, context.Canceled
+	default:
+	}
+
+	// 串行设置 TTL / HopLimit + 发送，放在同一把锁里保证并发安全
+	s.hopLimitLock.Lock()
+	defer s.hopLimitLock.Unlock()
+
+	if s.IPVersion == 4 {
+		ip4, ok := ipHdr.(*layers.IPv4)
+		if !ok || ip4 == nil {
+			return time.Time{}, errors.New("SendSCTP: expect *layers.IPv4 when s.IPVersion==4")
+		}
+		if err := s.sctp4.SetTOS(int(ip4.TOS)); err != nil {
+			return time.Time{}, err
+		}
+		if err := s.sctp4.SetTTL(int(ip4.TTL)); err != nil {
+			return time.Time{}, err
+		}
+	} else {
+		ip6, ok := ipHdr.(*layers.IPv6)
+		if !ok || ip6 == nil {
+			return time.Time{}, errors.New("SendSCTP: expect *layers.IPv6 when s.IPVersion==6")
+		}
+		if err := s.sctp6.SetTrafficClass(int(ip6.TrafficClass)); err != nil {
+			return time.Time{}, err
+		}
+		if err := s.sctp6.SetHopLimit(int(ip6.HopLimit)); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	start := time.Now()
+
+	if _, err := s.sctp.WriteTo(packet, &net.IPAddr{IP: s.DstIP}); err != nil {
+		return time.Time{}, err
+	}
+	return start, nil
+}
@@ -0,0 +1,186 @@
+//go:build windows && amd64
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	wd "github.com/xjasonlyu/windivert-go"
+)
+
+type SCTPSpec struct {
+	IPVersion    int
+	ICMPMode     int
+	SrcIP        net.IP
+	DstIP        net.IP
+	DstPort      int
+	icmp         net.PacketConn
+	SourceDevice string
+	OnDiscard    DiscardFunc
+	addr         wd.Address
+	handle       wd.Handle
+}
+
+func (s *SCTPSpec) sourceDeviceUnsupportedErr() error {
+	if s.SourceDevice == "" {
+		return nil
+	}
+	return fmt.Errorf("source_device %q is not supported on Windows SCTP traces", s.SourceDevice)
+}
+
+func (s *SCTPSpec) InitSCTP() {
+	if err := s.sourceDeviceUnsupportedErr(); err != nil {
+		log.Fatal(err)
+	}
+
+	handle, err := OpenWinDivertHandle("false", 0)
+	if err != nil {
+		log.Fatal(formatWinDivertRequiredError("Windows SCTP 探测", err))
+	}
+	s.handle = handle
+
+	// 设置出站 Address
+	s.addr.SetLayer(wd.LayerNetwork)
+	s.addr.SetEvent(wd.EventNetworkPacket)
+	s.addr.SetOutbound()
+}
+
+func (s *SCTPSpec) Close() {
+	_ = s.icmp.Close()
+	_ = s.handle.Close()
+}
+
+// resolveICMPMode 进行最终模式判定
+func (s *SCTPSpec) resolveICMPMode() int {
+	icmpMode := s.ICMPMode
+	if icmpMode != 1 && icmpMode != 2 {
+		icmpMode = 0 // 统一成 Auto
+	}
+
+	// 指定 1=Socket：直接返回
+	if icmpMode == 1 {
+		return 1
+	}
+
+	// Auto(0) 或强制 Sniff(2) → 尝试 WinDivert
+	ok, err := detectWinDivertAvailability()
+	if !ok {
+		if icmpMode == 2 {
+			log.Printf("%s", formatWinDivertFallbackMessage("WinDivert 嗅探模式", err))
+		}
+		return 1
+	}
+	return 2
+}
+
+func (s *SCTPSpec) ListenICMP(ctx context.Context, ready chan struct{}, onICMP func(msg ReceivedMessage, finish time.Time, data []byte)) {
+	switch s.resolveICMPMode() {
+	case 1:
+		s.listenICMPSock(ctx, ready, onICMP)
+	case 2:
+		s.listenICMPWinDivert(ctx, ready, onICMP)
+	}
+}
+
+func (s *SCTPSpec) listenICMPWinDivert(ctx context.Context, ready chan struct{}, onICMP func(msg ReceivedMessage, finish time.Time, data []byte)) {
+	sniffHandle, closeHandleICMP := openWinDivertSniffHandle(ctx, winDivertICMPFilter(s.IPVersion, s.SrcIP), "ListenICMP")
+	defer closeHandleICMP()
+	close(ready)
+
+	buf := make([]byte, 65535)
+	var addr wd.Address
+
+	for {
+		raw, finish, ok := receiveWinDivertPacket(ctx, sniffHandle, buf, &addr)
+		if !ok {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		packet, ok := decodeWinDivertICMPPacket(s.IPVersion, raw)
+		if !ok {
+			continue
+		}
+		data, ok := packet.errorPayloadFor(s.DstIP)
+		if !ok {
+			continue
+		}
+		onICMP(packet.message(), finish, data)
+	}
+}
+
+func (s *SCTPSpec) ListenSCTP(ctx context.Context, ready chan struct{}, onSCTP func(srcPort, tag int, msg ReceivedMessage, finish time.Time)) {
+	sniffHandle, closeHandleSCTP := openWinDivertSniffHandle(
+		ctx,
+		winDivertSCTPFilter(s.IPVersion, s.DstIP, s.SrcIP),
+		"ListenSCTP",
+	)
+	defer closeHandleSCTP()
+
+	close(ready)
+
+	buf := make([]byte, 65535)
+	var addr wd.Address
+
+	for {
+		raw, finish, ok := receiveWinDivertPacket(ctx, sniffHandle, buf, &addr)
+		if !ok {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		pkt := gopacket.NewPacket(raw, packetDecoderForIPVersion(s.IPVersion), gopacket.NoCopy)
+		var msg ReceivedMessage
+		if peerIP, ok := tcpProbePeerIP(s.IPVersion, pkt); ok {
+			msg.Peer = &net.IPAddr{IP: peerIP}
+		}
+		if nl := pkt.NetworkLayer(); nl != nil {
+			msg.Msg = append([]byte(nil), nl.LayerPayload()...)
+		}
+		msg.TTL = packetTTL(pkt)
+
+		srcPort, tag, ok := sctpProbeReply(msg.Msg, s.DstPort)
+		if !ok {
+			s.OnDiscard.call(msg, finish, layers.IPProtocolSCTP)
+			continue
+		}
+		onSCTP(srcPort, tag, msg, finish)
+	}
+}
+
+// SendSCTP 经 WinDivert 注入带 IP 头的 SCTP 报文
+func (s *SCTPSpec) SendSCTP(ctx context.Context, ipHdr ipLayer, packet []byte) (time.Time, error) {
+	select {
+	case <-ctx.Done():
+		return time.Time{}, context.Canceled
+	default:
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}
+
+	if err := gopacket.SerializeLayers(buf, opts, ipHdr, gopacket.Payload(packet)); err != nil {
+		return time.Time{}, err
+	}
+
+	start := time.Now()
+
+	// 复用预置的出站 Address
+	if _, err := s.handle.Send(buf.Bytes(), &s.addr); err != nil {
+		return time.Time{}, err
+	}
+	return start, nil
+}
@@ -28,6 +28,7 @@ type TCPSpec struct {
 	DstPort      int
 	PktSize      int
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	icmp         net.PacketConn
 	tcp          net.PacketConn
 	tcp4         *ipv4.PacketConn
@@ -41,7 +42,7 @@ func (s *TCPSpec) InitTCP() {
 		network = "ip6:tcp"
 	}
 
-	tcp, err := net.ListenPacket(network, s.SrcIP.String())
+	tcp, err := util.ListenPacket(network, s.SrcIP.String())
 	if err != nil {
 		if util.EnvDevMode {
 			panic(fmt.Errorf("(InitTCP) ListenPacket(%s, %s) failed: %v", network, s.SrcIP, err))
@@ -115,7 +116,7 @@ func mustSetDarwinTCPFilter(handle *pcap.Handle, filter string) {
 	}
 }
 
-func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func(srcPort, seq, ack int, peer net.Addr, finish time.Time)) {
+func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func(srcPort, seq, ack int, msg ReceivedMessage, finish time.Time)) {
 	handle := mustOpenDarwinTCPSniffHandle(s.captureDevice())
 	defer handle.Close()
 
@@ -133,11 +134,13 @@ func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func
 				return
 			}
 			finish := pkt.Metadata().Timestamp
-			srcPort, seq, ack, peer, ok := decodeTCPProbePacket(s.IPVersion, s.DstPort, pkt)
+			msg := tcpProbeMessage(s.IPVersion, pkt)
+			srcPort, seq, ack, _, ok := decodeTCPProbePacket(s.IPVersion, s.DstPort, pkt)
 			if !ok {
+				s.OnDiscard.call(msg, finish, layers.IPProtocolTCP)
 				continue
 			}
-			onTCP(srcPort, seq, ack, peer, finish)
+			onTCP(srcPort, seq, ack, msg, finish)
 		}
 	}
 }
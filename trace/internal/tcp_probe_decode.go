@@ -21,6 +21,10 @@ func tcpProbeReply(tcp *layers.TCP) (seq int, ack int, ok bool) {
 	if tcp.ACK && tcp.RST {
 		return 0, int(tcp.Ack), true
 	}
+	// ACK 探测得到的 RST 不带 ACK，其序号即探测包的确认号
+	if tcp.RST {
+		return int(tcp.Seq), 0, true
+	}
 	if tcp.ACK && tcp.SYN {
 		return int(tcp.Ack) - 1, 0, true
 	}
@@ -43,6 +47,20 @@ func tcpProbePeerIP(ipVersion int, pkt gopacket.Packet) (net.IP, bool) {
 	return ip6.SrcIP, true
 }
 
+// tcpProbeMessage 拷贝出抓到的 TCP 头与载荷及其来源地址，
+// 与原始 TCP 套接字读到的消息形式一致
+func tcpProbeMessage(ipVersion int, pkt gopacket.Packet) ReceivedMessage {
+	var msg ReceivedMessage
+	if peerIP, ok := tcpProbePeerIP(ipVersion, pkt); ok {
+		msg.Peer = &net.IPAddr{IP: peerIP}
+	}
+	if tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP); ok && tcp != nil {
+		msg.Msg = append(append([]byte(nil), tcp.Contents...), tcp.Payload...)
+	}
+	msg.TTL = packetTTL(pkt)
+	return msg
+}
+
 func decodeTCPProbePacket(ipVersion, dstPort int, pkt gopacket.Packet) (srcPort, seq, ack int, peer net.Addr, ok bool) {
 	tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
 	if !ok || tcp == nil || int(tcp.SrcPort) != dstPort {
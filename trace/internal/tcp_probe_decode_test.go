@@ -119,3 +119,25 @@ func TestDecodeTCPProbePacketRejectsUnexpectedPort(t *testing.T) {
 		t.Fatalf("decodeTCPProbePacket() ok = true, want false")
 	}
 }
+
+func TestDecodeTCPProbePacketBareRST(t *testing.T) {
+	ip4 := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP("5.5.5.5"),
+		DstIP:    net.ParseIP("6.6.6.6"),
+	}
+	tcp := &layers.TCP{
+		SrcPort: 443,
+		DstPort: 50000,
+		RST:     true,
+		Seq:     7 << 24,
+	}
+
+	pkt := mustSerializeTCPProbePacket(t, ip4, tcp)
+	srcPort, seq, ack, _, ok := decodeTCPProbePacket(4, 443, pkt)
+	if !ok || srcPort != 50000 || seq != 7<<24 || ack != 0 {
+		t.Fatalf("decodeTCPProbePacket() = (%d, %d, %d, %v), want (50000, %d, 0, true)", srcPort, seq, ack, ok, 7<<24)
+	}
+}
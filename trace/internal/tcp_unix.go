@@ -27,6 +27,7 @@ type TCPSpec struct {
 	DstPort      int
 	PktSize      int
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	icmp         net.PacketConn
 	tcp          net.PacketConn
 	tcp4         *ipv4.PacketConn
@@ -40,7 +41,7 @@ func (s *TCPSpec) InitTCP() {
 		network = "ip6:tcp"
 	}
 
-	tcp, err := net.ListenPacket(network, s.SrcIP.String())
+	tcp, err := util.ListenPacket(network, s.SrcIP.String())
 	if err != nil {
 		if util.EnvDevMode {
 			panic(fmt.Errorf("(InitTCP) ListenPacket(%s, %s) failed: %v", network, s.SrcIP, err))
@@ -74,7 +75,7 @@ func (s *TCPSpec) ListenICMP(ctx context.Context, ready chan struct{}, onICMP fu
 	s.listenICMPSock(ctx, ready, onICMP)
 }
 
-func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func(srcPort, seq, ack int, peer net.Addr, finish time.Time)) {
+func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func(srcPort, seq, ack int, msg ReceivedMessage, finish time.Time)) {
 	lc := NewPacketListener(s.tcp)
 	go lc.Start(ctx)
 	close(ready)
@@ -93,6 +94,7 @@ func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func
 			}
 			finish := time.Now()
 
+			// 原始 TCP 套接字能看到本机的全部 TCP 流量，只关心来自目标的报文
 			if ip := util.AddrIP(msg.Peer); ip == nil || !ip.Equal(s.DstIP) {
 				continue
 			}
@@ -100,22 +102,25 @@ func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func
 			// 解包
 			packet := gopacket.NewPacket(msg.Msg, layers.LayerTypeTCP, gopacket.Default)
 			if packet.ErrorLayer() != nil {
+				s.OnDiscard.call(msg, finish, layers.IPProtocolTCP)
 				continue
 			}
 
 			// 从包中获取 TCP 层信息
 			tl, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
 			if !ok || tl == nil || int(tl.SrcPort) != s.DstPort {
+				s.OnDiscard.call(msg, finish, layers.IPProtocolTCP)
 				continue
 			}
 
 			seq, ack, ok := tcpProbeReply(tl)
 			if !ok {
+				s.OnDiscard.call(msg, finish, layers.IPProtocolTCP)
 				continue
 			}
 
 			srcPort := int(tl.DstPort)
-			onTCP(srcPort, seq, ack, msg.Peer, finish)
+			onTCP(srcPort, seq, ack, msg, finish)
 		}
 	}
 }
@@ -23,6 +23,7 @@ type TCPSpec struct {
 	icmp         net.PacketConn
 	PktSize      int
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	addr         wd.Address
 	handle       wd.Handle
 }
@@ -121,7 +122,7 @@ func (s *TCPSpec) listenICMPWinDivert(ctx context.Context, ready chan struct{},
 	}
 }
 
-func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func(srcPort, seq, ack int, peer net.Addr, finish time.Time)) {
+func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func(srcPort, seq, ack int, msg ReceivedMessage, finish time.Time)) {
 	if err := s.sourceDeviceUnsupportedErr(); err != nil {
 		log.Fatal(err)
 	}
@@ -147,11 +148,14 @@ func (s *TCPSpec) ListenTCP(ctx context.Context, ready chan struct{}, onTCP func
 			continue
 		}
 
-		srcPort, seq, ack, peer, ok := decodeWinDivertTCPPacket(s.IPVersion, raw, s.DstPort)
+		pkt := gopacket.NewPacket(raw, packetDecoderForIPVersion(s.IPVersion), gopacket.NoCopy)
+		msg := tcpProbeMessage(s.IPVersion, pkt)
+		srcPort, seq, ack, _, ok := decodeTCPProbePacket(s.IPVersion, s.DstPort, pkt)
 		if !ok {
+			s.OnDiscard.call(msg, finish, layers.IPProtocolTCP)
 			continue
 		}
-		onTCP(srcPort, seq, ack, peer, finish)
+		onTCP(srcPort, seq, ack, msg, finish)
 	}
 }
 
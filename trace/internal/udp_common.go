@@ -20,7 +20,7 @@ func (s *UDPSpec) InitICMP() {
 		network = "ip6:ipv6-icmp"
 	}
 
-	icmpConn, err := net.ListenPacket(network, s.SrcIP.String())
+	icmpConn, err := util.ListenPacket(network, s.SrcIP.String())
 	if err != nil {
 		if util.EnvDevMode {
 			panic(fmt.Errorf("(InitICMP) ListenPacket(%s, %s) failed: %v", network, s.SrcIP, err))
@@ -46,6 +46,8 @@ func (s *UDPSpec) listenICMPSock(ctx context.Context, ready chan struct{}, onICM
 			finish, data, ok := s.decodeICMPSocketMessage(msg)
 			if ok {
 				onICMP(msg, finish, data)
+			} else {
+				s.OnDiscard.call(msg, finish, icmpProtocol(s.IPVersion))
 			}
 		}
 	}
@@ -26,6 +26,7 @@ type UDPSpec struct {
 	DstIP        net.IP
 	DstPort      int
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	icmp         net.PacketConn
 	udp          net.PacketConn
 	udp4         *ipv4.PacketConn
@@ -39,7 +40,7 @@ func (s *UDPSpec) InitUDP() {
 		network = "ip6:udp"
 	}
 
-	udp, err := net.ListenPacket(network, s.SrcIP.String())
+	udp, err := util.ListenPacket(network, s.SrcIP.String())
 	if err != nil {
 		if util.EnvDevMode {
 			panic(fmt.Errorf("(InitUDP) ListenPacket(%s, %s) failed: %v", network, s.SrcIP, err))
@@ -150,6 +151,63 @@ func (s *UDPSpec) ListenICMP(ctx context.Context, ready chan struct{}, onICMP fu
 	s.listenICMPSock(ctx, ready, onICMP)
 }
 
+// ListenUDP 抓取目标从 DstPort 发回的 UDP 应答，onUDP 收到本地端口与应用层载荷
+func (s *UDPSpec) ListenUDP(ctx context.Context, ready chan struct{}, onUDP func(srcPort int, payload []byte, msg ReceivedMessage, finish time.Time)) {
+	dev := "en0"
+	if s.SourceDevice != "" {
+		dev = s.SourceDevice
+	} else if d, err := util.PcapDeviceByIP(s.SrcIP); err == nil {
+		dev = d
+	}
+
+	handle, err := util.OpenLiveImmediate(dev, 65535, false, 4<<20)
+	if err != nil {
+		if util.EnvDevMode {
+			panic(fmt.Errorf("(ListenUDP) pcap open failed on %s: %v", dev, err))
+		}
+		log.Fatalf("(ListenUDP) pcap open failed on %s: %v", dev, err)
+	}
+	defer handle.Close()
+
+	ipPrefix := "ip"
+	if s.IPVersion == 6 {
+		ipPrefix = "ip6"
+	}
+	filter := fmt.Sprintf(
+		"%s and udp and src host %s and dst host %s and src port %d",
+		ipPrefix, s.DstIP.String(), s.SrcIP.String(), s.DstPort,
+	)
+	if err := handle.SetBPFFilter(filter); err != nil {
+		if util.EnvDevMode {
+			panic(fmt.Errorf("(ListenUDP) set BPF failed: %v (filter=%q)", err, filter))
+		}
+		log.Fatalf("(ListenUDP) set BPF failed: %v (filter=%q)", err, filter)
+	}
+
+	src := gopacket.NewPacketSource(handle, handle.LinkType())
+	pktCh := src.Packets()
+	close(ready)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pkt, ok := <-pktCh:
+			if !ok {
+				return
+			}
+			finish := pkt.Metadata().Timestamp
+			msg := udpReplyMessage(s.IPVersion, pkt)
+			srcPort, payload, ok := decodeUDPReply(s.DstPort, pkt)
+			if !ok {
+				s.OnDiscard.call(msg, finish, layers.IPProtocolUDP)
+				continue
+			}
+			onUDP(srcPort, payload, msg, finish)
+		}
+	}
+}
+
 func (s *UDPSpec) SendUDP(ctx context.Context, ipHdr gopacket.NetworkLayer, udpHdr *layers.UDP, payload []byte) (time.Time, error) {
 	select {
 	case <-ctx.Done():
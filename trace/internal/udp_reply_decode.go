@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// udpReplyMessage 拷贝出抓到的 UDP 头与载荷及其来源地址，
+// 与原始 UDP 套接字读到的消息形式一致
+func udpReplyMessage(ipVersion int, pkt gopacket.Packet) ReceivedMessage {
+	var msg ReceivedMessage
+	if peerIP, ok := tcpProbePeerIP(ipVersion, pkt); ok {
+		msg.Peer = &net.IPAddr{IP: peerIP}
+	}
+	if udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP); ok && udp != nil {
+		msg.Msg = append(append([]byte(nil), udp.Contents...), udp.Payload...)
+	}
+	msg.TTL = packetTTL(pkt)
+	return msg
+}
+
+// decodeUDPReply 取出目标从 dstPort 发回的 UDP 报文，返回本地端口与载荷
+func decodeUDPReply(dstPort int, pkt gopacket.Packet) (srcPort int, payload []byte, ok bool) {
+	udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !ok || udp == nil || int(udp.SrcPort) != dstPort {
+		return 0, nil, false
+	}
+	return int(udp.DstPort), udp.Payload, true
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestDecodeUDPReply(t *testing.T) {
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      57,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("192.0.2.53").To4(),
+		DstIP:    net.ParseIP("198.51.100.7").To4(),
+	}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 40001}
+	if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, udp, gopacket.Payload("answer")); err != nil {
+		t.Fatal(err)
+	}
+	pkt := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.NoCopy)
+
+	srcPort, payload, ok := decodeUDPReply(53, pkt)
+	if !ok || srcPort != 40001 || string(payload) != "answer" {
+		t.Fatalf("decodeUDPReply = %d %q %v", srcPort, payload, ok)
+	}
+	if _, _, ok := decodeUDPReply(443, pkt); ok {
+		t.Fatal("reply from another port accepted")
+	}
+
+	msg := udpReplyMessage(4, pkt)
+	if msg.TTL != 57 || msg.Peer.String() != "192.0.2.53" || !bytes.HasSuffix(msg.Msg, []byte("answer")) || len(msg.Msg) != 8+len("answer") {
+		t.Fatalf("udpReplyMessage = %+v", msg)
+	}
+}
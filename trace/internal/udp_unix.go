@@ -26,6 +26,7 @@ type UDPSpec struct {
 	DstIP        net.IP
 	DstPort      int
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	icmp         net.PacketConn
 	udp          net.PacketConn
 	udp4         *ipv4.RawConn
@@ -40,7 +41,7 @@ func (s *UDPSpec) InitUDP() {
 		network = "ip6:udp"
 	}
 
-	udp, err := net.ListenPacket(network, s.SrcIP.String())
+	udp, err := util.ListenPacket(network, s.SrcIP.String())
 	if err != nil {
 		if util.EnvDevMode {
 			panic(fmt.Errorf("(InitUDP) ListenPacket(%s, %s) failed: %v", network, s.SrcIP, err))
@@ -91,6 +92,42 @@ func (s *UDPSpec) ListenICMP(ctx context.Context, ready chan struct{}, onICMP fu
 	s.listenICMPSock(ctx, ready, onICMP)
 }
 
+// ListenUDP 读取目标从 DstPort 发回的 UDP 应答，onUDP 收到本地端口与应用层载荷
+func (s *UDPSpec) ListenUDP(ctx context.Context, ready chan struct{}, onUDP func(srcPort int, payload []byte, msg ReceivedMessage, finish time.Time)) {
+	lc := NewPacketListener(s.udp)
+	go lc.Start(ctx)
+	close(ready)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-lc.Messages:
+			if !ok {
+				return
+			}
+
+			if msg.Err != nil {
+				continue
+			}
+			finish := time.Now()
+
+			// 原始 UDP 套接字能看到本机的全部 UDP 流量，只关心来自目标的报文
+			if ip := util.AddrIP(msg.Peer); ip == nil || !ip.Equal(s.DstIP) {
+				continue
+			}
+
+			packet := gopacket.NewPacket(msg.Msg, layers.LayerTypeUDP, gopacket.Default)
+			srcPort, payload, ok := decodeUDPReply(s.DstPort, packet)
+			if !ok {
+				s.OnDiscard.call(msg, finish, layers.IPProtocolUDP)
+				continue
+			}
+			onUDP(srcPort, payload, msg, finish)
+		}
+	}
+}
+
 func serializeUDPPacket(payload []byte, layersToSerialize ...gopacket.SerializableLayer) ([]byte, error) {
 	buf := gopacket.NewSerializeBuffer()
 	opts := gopacket.SerializeOptions{
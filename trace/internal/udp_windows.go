@@ -21,6 +21,7 @@ type UDPSpec struct {
 	DstIP        net.IP
 	DstPort      int
 	SourceDevice string
+	OnDiscard    DiscardFunc
 	icmp         net.PacketConn
 	addr         wd.Address
 	handle       wd.Handle
@@ -108,6 +109,39 @@ func (s *UDPSpec) listenICMPWinDivert(ctx context.Context, ready chan struct{},
 	}
 }
 
+// ListenUDP 嗅探目标从 DstPort 发回的 UDP 应答，onUDP 收到本地端口与应用层载荷
+func (s *UDPSpec) ListenUDP(ctx context.Context, ready chan struct{}, onUDP func(srcPort int, payload []byte, msg ReceivedMessage, finish time.Time)) {
+	sniffHandle, closeHandle := openWinDivertSniffHandle(
+		ctx,
+		winDivertUDPFilter(s.IPVersion, s.DstIP, s.SrcIP, s.DstPort),
+		"ListenUDP",
+	)
+	defer closeHandle()
+	close(ready)
+
+	buf := make([]byte, 65535)
+	var addr wd.Address
+
+	for {
+		raw, finish, ok := receiveWinDivertPacket(ctx, sniffHandle, buf, &addr)
+		if !ok {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		pkt := gopacket.NewPacket(raw, packetDecoderForIPVersion(s.IPVersion), gopacket.NoCopy)
+		msg := udpReplyMessage(s.IPVersion, pkt)
+		srcPort, payload, ok := decodeUDPReply(s.DstPort, pkt)
+		if !ok {
+			s.OnDiscard.call(msg, finish, layers.IPProtocolUDP)
+			continue
+		}
+		onUDP(srcPort, payload, msg, finish)
+	}
+}
+
 func (s *UDPSpec) SendUDP(ctx context.Context, ipHdr ipLayer, udpHdr *layers.UDP, payload []byte) (time.Time, error) {
 	select {
 	case <-ctx.Done():
@@ -19,6 +19,7 @@ import (
 type winDivertICMPPacket struct {
 	ipVersion int
 	peerIP    net.IP
+	ttl       int
 	outer     []byte
 	errorData []byte
 	echoID    int
@@ -52,6 +53,27 @@ func winDivertTCPFilter(ipVersion int, dstIP, srcIP net.IP, dstPort int) string
 	)
 }
 
+func winDivertUDPFilter(ipVersion int, dstIP, srcIP net.IP, dstPort int) string {
+	if ipVersion == 4 {
+		return fmt.Sprintf(
+			"inbound and udp and ip.SrcAddr == %s and ip.DstAddr == %s and udp.SrcPort == %d",
+			dstIP.String(), srcIP.String(), dstPort,
+		)
+	}
+	return fmt.Sprintf(
+		"inbound and udp and ipv6.SrcAddr == %s and ipv6.DstAddr == %s and udp.SrcPort == %d",
+		dstIP.String(), srcIP.String(), dstPort,
+	)
+}
+
+// winDivertSCTPFilter 按协议号过滤，WinDivert 不解析 SCTP 端口
+func winDivertSCTPFilter(ipVersion int, dstIP, srcIP net.IP) string {
+	if ipVersion == 4 {
+		return fmt.Sprintf("inbound and ip.Protocol == 132 and ip.SrcAddr == %s and ip.DstAddr == %s", dstIP.String(), srcIP.String())
+	}
+	return fmt.Sprintf("inbound and ipv6.NextHdr == 132 and ipv6.SrcAddr == %s and ipv6.DstAddr == %s", dstIP.String(), srcIP.String())
+}
+
 func openWinDivertSniffHandle(ctx context.Context, filter, action string) (wd.Handle, func()) {
 	handle, err := openWinDivertSniffCall(filter, wd.FlagSniff|wd.FlagRecvOnly)
 	if err != nil {
@@ -113,11 +135,6 @@ func decodeWinDivertICMPPacket(ipVersion int, raw []byte) (*winDivertICMPPacket,
 	return decodeWinDivertICMPv6Packet(pkt, raw)
 }
 
-func decodeWinDivertTCPPacket(ipVersion int, raw []byte, dstPort int) (srcPort, seq, ack int, peer net.Addr, ok bool) {
-	pkt := gopacket.NewPacket(raw, packetDecoderForIPVersion(ipVersion), gopacket.NoCopy)
-	return decodeTCPProbePacket(ipVersion, dstPort, pkt)
-}
-
 func decodeWinDivertICMPv4Packet(pkt gopacket.Packet, raw []byte) (*winDivertICMPPacket, bool) {
 	ip4, ok := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
 	if !ok || ip4 == nil {
@@ -131,6 +148,7 @@ func decodeWinDivertICMPv4Packet(pkt gopacket.Packet, raw []byte) (*winDivertICM
 	packet := &winDivertICMPPacket{
 		ipVersion: 4,
 		peerIP:    ip4.SrcIP,
+		ttl:       int(ip4.TTL),
 		outer:     raw,
 	}
 
@@ -161,6 +179,7 @@ func decodeWinDivertICMPv6Packet(pkt gopacket.Packet, raw []byte) (*winDivertICM
 	packet := &winDivertICMPPacket{
 		ipVersion: 6,
 		peerIP:    ip6.SrcIP,
+		ttl:       int(ip6.HopLimit),
 		outer:     raw,
 	}
 
@@ -186,6 +205,7 @@ func (p *winDivertICMPPacket) message() ReceivedMessage {
 	return ReceivedMessage{
 		Peer: &net.IPAddr{IP: p.peerIP},
 		Msg:  p.outer,
+		TTL:  p.ttl,
 	}
 }
 
@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// IPv6ExtHopCheck 为同一 TTL 上对照探测与带扩展头探测的应答地址，空串表示无应答
+type IPv6ExtHopCheck struct {
+	TTL      int
+	Baseline string
+	WithExt  string
+}
+
+// IPv6ExtReport 对照不带扩展头的探测，找出带扩展头的探测不再被转发的位置
+type IPv6ExtReport struct {
+	Headers string
+	Hops    []IPv6ExtHopCheck
+	// BaselineLast / ExtLast 为各自最后一个有应答的跳，0 表示全无应答
+	BaselineLast    int
+	ExtLast         int
+	BaselineReached bool
+	ExtReached      bool
+	// DroppedAfter 为带扩展头的探测最后有应答的跳，对照探测在其之后仍有应答；
+	// -1 表示未见扩展头导致的丢弃
+	DroppedAfter int
+	Verdict      []string
+}
+
+// AnalyzeIPv6Ext 逐跳对照两次追踪
+func AnalyzeIPv6Ext(withExt, baseline *Result, dst net.IP, headers string) IPv6ExtReport {
+	r := IPv6ExtReport{Headers: headers, DroppedAfter: -1}
+	n := max(pathLen(withExt), pathLen(baseline))
+	for i := 0; i < n; i++ {
+		c := IPv6ExtHopCheck{TTL: i + 1}
+		c.Baseline = ipv6ExtAnswer(baseline, i, &r.BaselineLast, &r.BaselineReached, dst)
+		c.WithExt = ipv6ExtAnswer(withExt, i, &r.ExtLast, &r.ExtReached, dst)
+		r.Hops = append(r.Hops, c)
+	}
+	// 目标之后的 TTL 不再有意义，截到两侧都结束的位置
+	r.Hops = r.Hops[:max(r.BaselineLast, r.ExtLast)]
+	if !r.ExtReached && r.BaselineLast > r.ExtLast {
+		r.DroppedAfter = r.ExtLast
+	}
+	r.Verdict = r.verdict()
+	return r
+}
+
+// ipv6ExtAnswer 取一侧第 i 跳的应答地址；该侧到达目标后的跳不再计入
+func ipv6ExtAnswer(res *Result, i int, last *int, reached *bool, dst net.IP) string {
+	h := PathHopAt(res, i)
+	if h == nil || *reached {
+		return ""
+	}
+	*last = i + 1
+	if ip := util.AddrIP(h.Address); ip != nil && ip.Equal(dst) {
+		*reached = true
+	}
+	return addrToIPString(h.Address)
+}
+
+func (r IPv6ExtReport) hop(ttl int) IPv6ExtHopCheck {
+	return r.Hops[ttl-1]
+}
+
+func (r IPv6ExtReport) baselineEnd() string {
+	if r.BaselineReached {
+		return fmt.Sprintf("the baseline reaches the destination at hop %d", r.BaselineLast)
+	}
+	if r.BaselineLast == 0 {
+		return "the baseline got no reply either"
+	}
+	return fmt.Sprintf("the baseline's last reply is at hop %d", r.BaselineLast)
+}
+
+func (r IPv6ExtReport) verdict() []string {
+	switch {
+	case r.DroppedAfter == 0:
+		return []string{fmt.Sprintf("no hop answered packets with %s; %s", r.Headers, r.baselineEnd())}
+	case r.DroppedAfter > 0:
+		h := r.hop(r.DroppedAfter)
+		lines := []string{fmt.Sprintf("packets with %s stop being forwarded after hop %d (%s); %s", r.Headers, h.TTL, h.WithExt, r.baselineEnd())}
+		if next := r.hop(r.DroppedAfter + 1); next.Baseline != "" {
+			lines = append(lines, fmt.Sprintf("the drop is likely at hop %d (%s), the next hop on the baseline path", next.TTL, next.Baseline))
+		}
+		return lines
+	case r.ExtReached && r.BaselineReached:
+		return []string{fmt.Sprintf("packets with %s reach the destination like the baseline", r.Headers)}
+	case r.ExtReached:
+		return []string{fmt.Sprintf("packets with %s reach the destination; %s", r.Headers, r.baselineEnd())}
+	case r.BaselineReached:
+		return []string{fmt.Sprintf("packets with %s do not reach the destination (last reply at hop %d); %s", r.Headers, r.ExtLast, r.baselineEnd())}
+	}
+	return []string{fmt.Sprintf("neither run reached the destination (with %s: last reply at hop %d; %s); no drop caused by the headers was seen", r.Headers, r.ExtLast, r.baselineEnd())}
+}
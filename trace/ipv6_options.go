@@ -0,0 +1,281 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/nxtrace/NTrace-core/trace/internal"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// IPv6ExtHeaderNames 为可选的扩展头，发送时按此顺序排列：
+// 逐跳选项头必须紧随 IPv6 头，目的选项头放在分片头之后，只由目标处理
+var IPv6ExtHeaderNames = []string{"hbh", "frag", "dst"}
+
+const (
+	ipv6FlowLabelMax = 0xFFFFF
+
+	ipv6ExtDefaultSize = 8
+	ipv6ExtMaxSize     = 2048 // 长度字段为 8 位，以 8 字节为单位且不含首个 8 字节
+	ipv6FragHeaderSize = 8
+
+	// ipv6OptExperiment 为 RFC 4727 的实验选项，最高两位为 00：不认识的节点跳过它
+	ipv6OptExperiment = 0x1e
+	ipv6OptPadN       = 1
+	// Linux 等实现拒绝连续超过 7 字节的填充，更长的头改用实验选项填满
+	ipv6MaxPadding = 7
+)
+
+// IPv6ExtHeader 为一个要插入探测包的扩展头；Size 为整个头的字节数
+type IPv6ExtHeader struct {
+	Name string
+	Size int
+}
+
+// IPv6Options 为 IPv6 探测包的流标签与扩展头。零值即原来的探测包，由内核填流标签。
+type IPv6Options struct {
+	// FlowLabel 为固定流标签，nil 表示不指定
+	FlowLabel *uint32
+	// RandomFlowLabel 为每个探测包取不同的随机流标签
+	RandomFlowLabel bool
+	ExtHeaders      []IPv6ExtHeader
+}
+
+// ParseIPv6Options 解析流标签（0-1048575 或 random）与逗号分隔的扩展头列表；
+// 扩展头写作 hbh、dst 或 frag，hbh 与 dst 可用 hbh:64 指定 8 的倍数的大小
+func ParseIPv6Options(flowLabel, extHeaders string) (IPv6Options, error) {
+	var o IPv6Options
+	switch label := strings.ToLower(strings.TrimSpace(flowLabel)); label {
+	case "":
+	case "random":
+		o.RandomFlowLabel = true
+	default:
+		v, err := strconv.ParseUint(label, 0, 32)
+		if err != nil || v > ipv6FlowLabelMax {
+			return IPv6Options{}, fmt.Errorf("unsupported flow label %q; use 0-%d or random", flowLabel, ipv6FlowLabelMax)
+		}
+		fl := uint32(v)
+		o.FlowLabel = &fl
+	}
+
+	extHeaders = strings.ToLower(strings.TrimSpace(extHeaders))
+	if extHeaders == "" {
+		return o, nil
+	}
+	sizes := map[string]int{}
+	for _, item := range strings.Split(extHeaders, ",") {
+		name, sizeText, hasSize := strings.Cut(strings.TrimSpace(item), ":")
+		if !util.StringInSlice(name, IPv6ExtHeaderNames) {
+			return IPv6Options{}, fmt.Errorf("unsupported ipv6 extension header %q; choose from %s", item, strings.Join(IPv6ExtHeaderNames, ", "))
+		}
+		if _, dup := sizes[name]; dup {
+			return IPv6Options{}, fmt.Errorf("ipv6 extension header %q given twice", name)
+		}
+		size := ipv6ExtDefaultSize
+		if hasSize {
+			if name == "frag" {
+				return IPv6Options{}, fmt.Errorf("the fragment header has a fixed size of %d bytes", ipv6FragHeaderSize)
+			}
+			v, err := strconv.Atoi(sizeText)
+			if err != nil || v < ipv6ExtDefaultSize || v > ipv6ExtMaxSize || v%8 != 0 {
+				return IPv6Options{}, fmt.Errorf("unsupported %s header size %q; use a multiple of 8 from 8 to %d", name, sizeText, ipv6ExtMaxSize)
+			}
+			size = v
+		}
+		sizes[name] = size
+	}
+	for _, name := range IPv6ExtHeaderNames {
+		if size, ok := sizes[name]; ok {
+			o.ExtHeaders = append(o.ExtHeaders, IPv6ExtHeader{Name: name, Size: size})
+		}
+	}
+	return o, nil
+}
+
+// Enabled 报告是否需要自行构造 IPv6 头发送
+func (o IPv6Options) Enabled() bool {
+	return o.FlowLabel != nil || o.RandomFlowLabel || len(o.ExtHeaders) > 0
+}
+
+// WithoutExtHeaders 为对照用的探测：保留流标签以走同一条 ECMP 路径，去掉扩展头
+func (o IPv6Options) WithoutExtHeaders() IPv6Options {
+	o.ExtHeaders = nil
+	return o
+}
+
+// ExtHeadersString 形如 "HBH(8), Fragment, DestOpt(64)"
+func (o IPv6Options) ExtHeadersString() string {
+	parts := make([]string, 0, len(o.ExtHeaders))
+	for _, h := range o.ExtHeaders {
+		switch h.Name {
+		case "hbh":
+			parts = append(parts, fmt.Sprintf("HBH(%d)", h.Size))
+		case "dst":
+			parts = append(parts, fmt.Sprintf("DestOpt(%d)", h.Size))
+		case "frag":
+			parts = append(parts, "Fragment")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// String 形如 "flow-label 12345 HBH(8), Fragment"，用于启动时的提示行
+func (o IPv6Options) String() string {
+	var parts []string
+	switch {
+	case o.RandomFlowLabel:
+		parts = append(parts, "flow-label random")
+	case o.FlowLabel != nil:
+		parts = append(parts, fmt.Sprintf("flow-label %d", *o.FlowLabel))
+	}
+	if len(o.ExtHeaders) > 0 {
+		parts = append(parts, o.ExtHeadersString())
+	}
+	return strings.Join(parts, " ")
+}
+
+func ipv6ExtProtocol(name string) layers.IPProtocol {
+	switch name {
+	case "hbh":
+		return layers.IPProtocolIPv6HopByHop
+	case "frag":
+		return layers.IPProtocolIPv6Fragment
+	}
+	return layers.IPProtocolIPv6Destination
+}
+
+// ipv6ExtLayer 把扩展头链序列化在 IPv6 头与上层协议之间
+type ipv6ExtLayer struct {
+	headers []IPv6ExtHeader
+	// next 为最后一个扩展头之后的上层协议
+	next   layers.IPProtocol
+	fragID uint32
+}
+
+func (l *ipv6ExtLayer) LayerType() gopacket.LayerType {
+	return ipv6ExtProtocol(l.headers[0].Name).LayerType()
+}
+
+func (l *ipv6ExtLayer) SerializeTo(b gopacket.SerializeBuffer, _ gopacket.SerializeOptions) error {
+	next := l.next
+	for k := len(l.headers) - 1; k >= 0; k-- {
+		h := l.headers[k]
+		bytes, err := b.PrependBytes(h.Size)
+		if err != nil {
+			return err
+		}
+		clear(bytes)
+		bytes[0] = byte(next)
+		if h.Name == "frag" {
+			// 偏移 0 且 M 位为 0 的原子分片（RFC 6946），目标直接按未分片处理
+			binary.BigEndian.PutUint32(bytes[4:8], l.fragID)
+		} else {
+			bytes[1] = byte(h.Size/8 - 1)
+			fillIPv6Options(bytes[2:])
+		}
+		next = ipv6ExtProtocol(h.Name)
+	}
+	return nil
+}
+
+// fillIPv6Options 以 PadN 或实验选项填满选项区
+func fillIPv6Options(b []byte) {
+	if len(b) <= ipv6MaxPadding {
+		b[0] = ipv6OptPadN
+		b[1] = byte(len(b) - 2)
+		return
+	}
+	for len(b) > 0 {
+		n := min(len(b), 2+255)
+		if len(b)-n == 1 {
+			// 剩 1 字节时留给 Pad1
+			n--
+		}
+		if n == 1 {
+			b[0] = 0 // Pad1
+			return
+		}
+		b[0] = ipv6OptExperiment
+		b[1] = byte(n - 2)
+		b = b[n:]
+	}
+}
+
+// ipv6Prober 按 IPv6Options 自行构造 IPv6 头发送探测包：
+// 内核套接字既不能指定流标签也不能插入分片头，这里绕开它们直接发完整报文
+type ipv6Prober struct {
+	opts   IPv6Options
+	sender *internal.IPv6RawSender
+}
+
+// newIPv6Prober 在启用了选项时打开发送套接字，否则返回 nil
+func newIPv6Prober(opts IPv6Options, srcIP, dstIP net.IP, sourceDevice string) (*ipv6Prober, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	sender, err := internal.NewIPv6RawSender(srcIP, dstIP, sourceDevice)
+	if err != nil {
+		return nil, err
+	}
+	return &ipv6Prober{opts: opts, sender: sender}, nil
+}
+
+func (p *ipv6Prober) close() {
+	if p != nil {
+		_ = p.sender.Close()
+	}
+}
+
+// stack 填入流标签并在 IPv6 头与上层之间插入扩展头，返回完整的层序列
+func (p *ipv6Prober) stack(ip6 *layers.IPv6, upper ...gopacket.SerializableLayer) []gopacket.SerializableLayer {
+	switch {
+	case p.opts.RandomFlowLabel:
+		ip6.FlowLabel = rand.Uint32() & ipv6FlowLabelMax
+	case p.opts.FlowLabel != nil:
+		ip6.FlowLabel = *p.opts.FlowLabel
+	}
+	stack := []gopacket.SerializableLayer{ip6}
+	if len(p.opts.ExtHeaders) > 0 {
+		ext := &ipv6ExtLayer{headers: p.opts.ExtHeaders, next: ip6.NextHeader, fragID: rand.Uint32()}
+		ip6.NextHeader = ipv6ExtProtocol(p.opts.ExtHeaders[0].Name)
+		stack = append(stack, ext)
+	}
+	for _, l := range upper {
+		if l == nil {
+			continue
+		}
+		if cl, ok := l.(interface {
+			SetNetworkLayerForChecksum(gopacket.NetworkLayer) error
+		}); ok {
+			_ = cl.SetNetworkLayerForChecksum(ip6)
+		}
+		stack = append(stack, l)
+	}
+	return stack
+}
+
+// send 发出探测包，返回发送时刻与实际发送的层序列（供抓包记录）
+func (p *ipv6Prober) send(ctx context.Context, ip6 *layers.IPv6, upper ...gopacket.SerializableLayer) (time.Time, []gopacket.SerializableLayer, error) {
+	select {
+	case <-ctx.Done():
+		return time.Time{}, nil, context.Canceled
+	default:
+	}
+	stack := p.stack(ip6, upper...)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, stack...); err != nil {
+		return time.Time{}, nil, err
+	}
+	start, err := p.sender.Send(buf.Bytes())
+	return start, stack, err
+}
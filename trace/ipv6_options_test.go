@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestParseIPv6Options(t *testing.T) {
+	o, err := ParseIPv6Options("0x3039", "dst:64, HBH ,frag")
+	if err != nil {
+		t.Fatalf("ParseIPv6Options() error = %v", err)
+	}
+	if o.FlowLabel == nil || *o.FlowLabel != 12345 || o.RandomFlowLabel {
+		t.Fatalf("flow label = %v random=%v", o.FlowLabel, o.RandomFlowLabel)
+	}
+	if got := o.String(); got != "flow-label 12345 HBH(8), Fragment, DestOpt(64)" {
+		t.Fatalf("String() = %q", got)
+	}
+	if o.WithoutExtHeaders().ExtHeaders != nil || !o.WithoutExtHeaders().Enabled() {
+		t.Fatalf("options = %+v", o)
+	}
+
+	o, err = ParseIPv6Options("random", "")
+	if err != nil || !o.RandomFlowLabel || !o.Enabled() {
+		t.Fatalf("random flow label = %+v, %v", o, err)
+	}
+	if o, _ := ParseIPv6Options("", ""); o.Enabled() {
+		t.Fatal("empty options enabled")
+	}
+
+	for _, bad := range [][2]string{
+		{"1048576", ""}, {"-1", ""}, {"", "rthdr"}, {"", "hbh,hbh"}, {"", "frag:16"}, {"", "hbh:12"}, {"", "dst:2056"}, {"", "hbh:0"},
+	} {
+		if _, err := ParseIPv6Options(bad[0], bad[1]); err == nil {
+			t.Fatalf("ParseIPv6Options(%q, %q) accepted", bad[0], bad[1])
+		}
+	}
+}
+
+func TestIPv6ProberStack(t *testing.T) {
+	opts, _ := ParseIPv6Options("7", "hbh:2048,frag,dst")
+	p := &ipv6Prober{opts: opts}
+	src, dst := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	ip6 := &layers.IPv6{Version: 6, SrcIP: src, DstIP: dst, NextHeader: layers.IPProtocolICMPv6, HopLimit: 3}
+	icmpHdr := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)}
+	echo := &layers.ICMPv6Echo{Identifier: 0x1234, SeqNumber: 0x0301}
+
+	buf := gopacket.NewSerializeBuffer()
+	stack := p.stack(ip6, icmpHdr, echo, gopacket.Payload([]byte("ntr")))
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}, stack...); err != nil {
+		t.Fatalf("SerializeLayers() error = %v", err)
+	}
+	raw := buf.Bytes()
+	if len(raw) != 40+2048+8+8+8+3 {
+		t.Fatalf("len = %d", len(raw))
+	}
+
+	pkt := gopacket.NewPacket(raw, layers.LayerTypeIPv6, gopacket.Default)
+	got, ok := pkt.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if !ok || got.FlowLabel != 7 || got.HopLimit != 3 || got.NextHeader != layers.IPProtocolIPv6HopByHop {
+		t.Fatalf("ipv6 = %+v", got)
+	}
+	if got.HopByHop == nil || len(got.HopByHop.Options) == 0 {
+		t.Fatalf("hop-by-hop = %+v", got.HopByHop)
+	}
+	for _, opt := range got.HopByHop.Options {
+		if opt.OptionType != ipv6OptExperiment && opt.OptionType != 0 {
+			t.Fatalf("hop-by-hop option type = %#x", opt.OptionType)
+		}
+	}
+	frag, ok := pkt.Layer(layers.LayerTypeIPv6Fragment).(*layers.IPv6Fragment)
+	if !ok || frag.FragmentOffset != 0 || frag.MoreFragments || frag.NextHeader != layers.IPProtocolIPv6Destination {
+		t.Fatalf("fragment = %+v", frag)
+	}
+	// gopacket 不解码分片之后的内容，从分片载荷接着解
+	inner := gopacket.NewPacket(frag.Payload, layers.LayerTypeIPv6Destination, gopacket.Default)
+	dstOpts, ok := inner.Layer(layers.LayerTypeIPv6Destination).(*layers.IPv6Destination)
+	if !ok || dstOpts.NextHeader != layers.IPProtocolICMPv6 || len(dstOpts.Options) != 1 || dstOpts.Options[0].OptionType != ipv6OptPadN {
+		t.Fatalf("destination options = %+v", dstOpts)
+	}
+
+	// 上层校验和不受扩展头影响：与不带扩展头时算出的一致
+	plain := gopacket.NewSerializeBuffer()
+	plainIP := &layers.IPv6{Version: 6, SrcIP: src, DstIP: dst, NextHeader: layers.IPProtocolICMPv6, HopLimit: 3}
+	plainICMP := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)}
+	_ = plainICMP.SetNetworkLayerForChecksum(plainIP)
+	if err := gopacket.SerializeLayers(plain, gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}, plainIP, plainICMP, echo, gopacket.Payload([]byte("ntr"))); err != nil {
+		t.Fatalf("SerializeLayers(plain) error = %v", err)
+	}
+	if icmp, ok := inner.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6); !ok || icmp.Checksum != plainICMP.Checksum {
+		t.Fatalf("icmpv6 checksum = %+v, want %#x", icmp, plainICMP.Checksum)
+	}
+}
+
+func TestFillIPv6Options(t *testing.T) {
+	for _, size := range []int{8, 16, 264, 266, 2048} {
+		b := make([]byte, size-2)
+		fillIPv6Options(b)
+		// 逐个选项走完应正好落在末尾
+		off := 0
+		for off < len(b) {
+			if b[off] == 0 {
+				off++
+				continue
+			}
+			off += 2 + int(b[off+1])
+		}
+		if off != len(b) {
+			t.Fatalf("size %d: options end at %d, want %d", size, off, len(b))
+		}
+	}
+}
+
+func extHop(ttl int, ip string) Hop {
+	return Hop{Success: true, TTL: ttl, Address: &net.IPAddr{IP: net.ParseIP(ip)}}
+}
+
+func TestAnalyzeIPv6Ext(t *testing.T) {
+	dst := net.ParseIP("2001:db8::9")
+	baseline := &Result{Hops: [][]Hop{
+		{extHop(1, "2001:db8::1")},
+		{extHop(2, "2001:db8::2")},
+		{extHop(3, "2001:db8::3")},
+		{extHop(4, "2001:db8::9")},
+		{extHop(5, "2001:db8::9")},
+	}}
+	withExt := &Result{Hops: [][]Hop{
+		{extHop(1, "2001:db8::1")},
+		{extHop(2, "2001:db8::2")},
+		{{TTL: 3}},
+		{{TTL: 4}},
+		{{TTL: 5}},
+	}}
+	r := AnalyzeIPv6Ext(withExt, baseline, dst, "HBH(8)")
+	if r.DroppedAfter != 2 || !r.BaselineReached || r.ExtReached || len(r.Hops) != 4 {
+		t.Fatalf("report = %+v", r)
+	}
+	want := "packets with HBH(8) stop being forwarded after hop 2 (2001:db8::2); the baseline reaches the destination at hop 4\n" +
+		"the drop is likely at hop 3 (2001:db8::3), the next hop on the baseline path"
+	if got := strings.Join(r.Verdict, "\n"); got != want {
+		t.Fatalf("verdict = %q", got)
+	}
+
+	r = AnalyzeIPv6Ext(baseline, baseline, dst, "Fragment")
+	if r.DroppedAfter != -1 || len(r.Hops) != 4 || strings.Join(r.Verdict, "\n") != "packets with Fragment reach the destination like the baseline" {
+		t.Fatalf("report = %+v", r)
+	}
+
+	r = AnalyzeIPv6Ext(&Result{Hops: [][]Hop{{{TTL: 1}}}}, baseline, dst, "DestOpt(8)")
+	if r.DroppedAfter != 0 || r.Verdict[0] != "no hop answered packets with DestOpt(8); the baseline reaches the destination at hop 4" {
+		t.Fatalf("report = %+v", r)
+	}
+}
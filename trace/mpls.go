@@ -0,0 +1,35 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// MPLSLabel is one label stack entry quoted in an ICMP extension (RFC 4950).
+type MPLSLabel struct {
+	Label int
+	TC    int
+	S     int
+	TTL   int
+}
+
+// String renders the entry the way Hop.MPLS stores it.
+func (l MPLSLabel) String() string {
+	return fmt.Sprintf("[MPLS: Lbl %d, TC %d, S %d, TTL %d]", l.Label, l.TC, l.S, l.TTL)
+}
+
+var mplsEntryRe = regexp.MustCompile(`^\[MPLS: Lbl (\d+), TC (\d+), S (\d+), TTL (\d+)\]$`)
+
+// ParseMPLSLabel reads back an entry of Hop.MPLS.
+func ParseMPLSLabel(s string) (MPLSLabel, bool) {
+	m := mplsEntryRe.FindStringSubmatch(s)
+	if m == nil {
+		return MPLSLabel{}, false
+	}
+	var v [4]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return MPLSLabel{Label: v[0], TC: v[1], S: v[2], TTL: v[3]}, true
+}
@@ -49,6 +49,10 @@ type MTRRawRecord struct {
 	Lat       float64  `json:"lat"`
 	Lng       float64  `json:"lng"`
 	MPLS      []string `json:"mpls,omitempty"`
+	// 回包到达时的 TTL / Hop Limit 以及据此推算的回程跳数
+	ReplyTTL   int  `json:"reply_ttl,omitempty"`
+	ReturnHops int  `json:"return_hops,omitempty"`
+	Asymmetric bool `json:"asymmetric,omitempty"`
 }
 
 // MTRRawOnRecord is called for each probe event.
@@ -318,6 +322,11 @@ func newMTRRawRecord(iteration int, pr mtrProbeResult) MTRRawRecord {
 	if len(pr.MPLS) > 0 {
 		rec.MPLS = append([]string(nil), pr.MPLS...)
 	}
+	if rec.Success && pr.ReplyTTL > 0 {
+		h := Hop{TTL: pr.TTL}
+		h.SetReplyTTL(pr.ReplyTTL)
+		rec.ReplyTTL, rec.ReturnHops, rec.Asymmetric = h.ReplyTTL, h.ReturnHops, h.Asymmetric
+	}
 	return rec
 }
 
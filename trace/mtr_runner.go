@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 
 	"github.com/nxtrace/NTrace-core/trace/internal"
@@ -97,7 +98,7 @@ type mtrPeeker interface {
 //
 // 当 opts.HopInterval == 0 时使用 legacy round-based 调度（Web MTR 兼容）：
 //
-//	ICMP 使用持久 raw socket 跨轮复用；TCP/UDP 以 per-round Traceroute 回退。
+//	ICMP 使用持久 raw socket 跨轮复用；TCP/UDP/SCTP 以 per-round Traceroute 回退。
 func RunMTR(ctx context.Context, method Method, baseConfig Config, opts MTROptions, onSnapshot MTROnSnapshot) error {
 	if opts.HopInterval > 0 {
 		return runMTRPerHop(ctx, method, baseConfig, opts, onSnapshot)
@@ -266,6 +267,8 @@ type mtrICMPEngine struct {
 	echoID int
 	srcIP  net.IP
 	ipVer  int
+	// ipv6 在设置了流标签或扩展头时自行构造 IPv6 头发送，跨 rotateEngine 保留
+	ipv6 *ipv6Prober
 
 	// 单调递增序列号，避免跨轮 seq 冲突
 	seqCounter uint32
@@ -304,9 +307,10 @@ type mtrProbeMeta struct {
 }
 
 type mtrProbeReply struct {
-	peer net.Addr
-	rtt  time.Duration
-	mpls []string
+	peer     net.Addr
+	rtt      time.Duration
+	mpls     []string
+	replyTTL int
 }
 
 func newMTRICMPEngine(config Config) (*mtrICMPEngine, error) {
@@ -350,6 +354,13 @@ func (e *mtrICMPEngine) start(ctx context.Context) error {
 	e.spec = internal.NewICMPSpec(e.ipVer, e.config.ICMPMode, e.echoID, e.srcIP, e.config.DstIP)
 	applyICMPSourceDevice(e.spec, e.config.OSType, e.config.SourceDevice)
 	e.spec.InitICMP()
+	if e.ipVer == 6 {
+		var err error
+		if e.ipv6, err = newIPv6Prober(e.config.IPv6, e.srcIP, e.config.DstIP, e.config.SourceDevice); err != nil {
+			e.close()
+			return err
+		}
+	}
 
 	e.notifyCh = make(chan struct{}, 1)
 	e.sentAt = make(map[int]mtrProbeMeta)
@@ -377,6 +388,8 @@ func (e *mtrICMPEngine) close() {
 		e.spec.Close()
 		e.spec = nil
 	}
+	e.ipv6.close()
+	e.ipv6 = nil
 }
 
 // resetFinalTTL 清除已知目的地 TTL 缓存（r 键重置统计时调用）。
@@ -529,9 +542,10 @@ func (e *mtrICMPEngine) discardProbeLocked(seq int) {
 
 func (e *mtrICMPEngine) storeProbeReplyLocked(seq int, msg internal.ReceivedMessage, rtt time.Duration) {
 	e.replied[seq] = &mtrProbeReply{
-		peer: msg.Peer,
-		rtt:  rtt,
-		mpls: extractMPLS(msg, e.config.DisableMPLS),
+		peer:     msg.Peer,
+		rtt:      rtt,
+		mpls:     extractMPLS(msg, e.config.DisableMPLS),
+		replyTTL: msg.TTL,
 	}
 	delete(e.sentAt, seq)
 	e.closeProbeNotifyLocked(seq)
@@ -626,6 +640,10 @@ func (e *mtrICMPEngine) sendProbe(ctx context.Context, ttl, seq int) (time.Time,
 		Identifier: uint16(e.echoID),
 		SeqNumber:  uint16(seq),
 	}
+	if e.ipv6 != nil {
+		start, _, err := e.ipv6.send(ctx, ipHdr, icmpHdr, icmpEcho, gopacket.Payload(payload))
+		return start, err
+	}
 	return e.spec.SendICMP(ctx, ipHdr, icmpHdr, icmpEcho, payload)
 }
 
@@ -850,13 +868,15 @@ func (e *mtrICMPEngine) buildProbeRoundResult(beginHop, finalMax int) *Result {
 func (e *mtrICMPEngine) probeRoundHop(ttl int) Hop {
 	if seq, sent := e.curTtlSeq[ttl]; sent {
 		if reply, ok := e.replied[seq]; ok {
-			return Hop{
+			h := Hop{
 				Success: true,
 				Address: reply.peer,
 				TTL:     ttl,
 				RTT:     reply.rtt,
 				MPLS:    reply.mpls,
 			}
+			h.SetReplyTTL(reply.replyTTL)
+			return h
 		}
 	}
 	return Hop{
@@ -869,7 +889,7 @@ func (e *mtrICMPEngine) probeRoundHop(ttl int) Hop {
 }
 
 // ---------------------------------------------------------------------------
-// TCP/UDP 回退 prober：每轮调用 Traceroute + 指数退避
+// TCP/UDP/SCTP 回退 prober：每轮调用 Traceroute + 指数退避
 // ---------------------------------------------------------------------------
 
 type mtrFallbackProber struct {
@@ -951,11 +971,12 @@ func (e *mtrICMPEngine) ProbeTTL(ctx context.Context, ttl int) (mtrProbeResult,
 
 		if ok && reply != nil {
 			return mtrProbeResult{
-				TTL:     ttl,
-				Success: true,
-				Addr:    reply.peer,
-				RTT:     reply.rtt,
-				MPLS:    reply.mpls,
+				TTL:      ttl,
+				Success:  true,
+				Addr:     reply.peer,
+				RTT:      reply.rtt,
+				MPLS:     reply.mpls,
+				ReplyTTL: reply.replyTTL,
 			}, nil
 		}
 		// Notified but no reply → was discarded (stale/bad RTT)
@@ -1002,10 +1023,10 @@ func (e *mtrICMPEngine) Close() error {
 }
 
 // ---------------------------------------------------------------------------
-// TCP/UDP 回退 TTL prober：单 TTL 探测
+// TCP/UDP/SCTP 回退 TTL prober：单 TTL 探测
 // ---------------------------------------------------------------------------
 
-// mtrFallbackTTLProber uses Traceroute for single-TTL probing (TCP/UDP fallback).
+// mtrFallbackTTLProber uses Traceroute for single-TTL probing (TCP/UDP/SCTP fallback).
 type mtrFallbackTTLProber struct {
 	method        Method
 	config        Config
@@ -1044,6 +1065,7 @@ func (p *mtrFallbackTTLProber) ProbeTTL(ctx context.Context, ttl int) (mtrProbeR
 		Addr:     h.Address,
 		RTT:      h.RTT,
 		MPLS:     h.MPLS,
+		ReplyTTL: h.ReplyTTL,
 		Hostname: h.Hostname,
 		Geo:      h.Geo,
 	}, nil
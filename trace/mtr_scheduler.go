@@ -19,6 +19,7 @@ type mtrProbeResult struct {
 	Addr     net.Addr
 	RTT      time.Duration
 	MPLS     []string
+	ReplyTTL int              // TTL / hop limit of the reply, 0 if unknown
 	Hostname string           // pre-resolved PTR (fallback prober)
 	Geo      *ipgeo.IPGeoData // pre-resolved geo  (fallback prober)
 }
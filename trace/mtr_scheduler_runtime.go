@@ -733,6 +733,7 @@ func (rt *mtrSchedulerRuntime) singleProbeResult(ttl int, result mtrProbeResult)
 		Geo:      result.Geo,
 		Lang:     rt.cfg.BaseConfig.Lang,
 	}
+	hop.SetReplyTTL(result.ReplyTTL)
 	if !hop.Success && hop.Address == nil {
 		hop.Error = errHopLimitTimeout
 	}
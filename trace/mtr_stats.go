@@ -27,6 +27,11 @@ type MTRHopStat struct {
 	Geo      *ipgeo.IPGeoData `json:"geo,omitempty"`
 	MPLS     []string         `json:"mpls,omitempty"`
 	Received int              `json:"received"`
+	// ReplyTTL 为最近一次回包的 TTL / Hop Limit；ReturnHops 为据此推算的回程跳数，
+	// Asymmetric 表示回程跳数与正向跳数（TTL）不一致
+	ReplyTTL   int  `json:"reply_ttl,omitempty"`
+	ReturnHops int  `json:"return_hops,omitempty"`
+	Asymmetric bool `json:"asymmetric,omitempty"`
 }
 
 // MTRSnapshot 是某一时刻的完整快照。
@@ -54,6 +59,7 @@ type mtrHopAccum struct {
 	geo      *ipgeo.IPGeoData
 	order    int
 	mplsSet  map[string]struct{}
+	replyTTL int
 }
 
 // MTRAggregator 跨轮次聚合 hop 统计。线程安全。
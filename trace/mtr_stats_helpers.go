@@ -21,6 +21,7 @@ type mtrHopGroup struct {
 	received int
 	count    int
 	mpls     map[string]struct{}
+	replyTTL int
 }
 
 func newMTRHopGroup(host, ip string) *mtrHopGroup {
@@ -62,6 +63,9 @@ func (g *mtrHopGroup) includeAttempt(attempt Hop) {
 	g.sumSq += rttMs * rttMs
 	g.received++
 	g.last = rttMs
+	if attempt.ReplyTTL > 0 {
+		g.replyTTL = attempt.ReplyTTL
+	}
 	if rttMs > g.worst {
 		g.worst = rttMs
 	}
@@ -123,6 +127,9 @@ func mergeMTRHopGroupIntoAccum(acc *mtrHopAccum, group *mtrHopGroup) {
 			acc.worst = group.worst
 		}
 	}
+	if group.replyTTL > 0 {
+		acc.replyTTL = group.replyTTL
+	}
 	mergeMTRLabelSet(acc.mplsSet, group.mpls)
 }
 
@@ -149,6 +156,9 @@ func mergeMTRHopAccum(dst, src *mtrHopAccum) {
 	if dst.ip == "" && src.ip != "" {
 		dst.ip = src.ip
 	}
+	if src.replyTTL > 0 && src.received > 0 {
+		dst.replyTTL = src.replyTTL
+	}
 	mergeMTRLabelSet(dst.mplsSet, src.mplsSet)
 }
 
@@ -240,6 +250,8 @@ func buildMTRHopStat(acc *mtrHopAccum) MTRHopStat {
 		sort.Strings(mpls)
 	}
 
+	returnHops := InferReturnHops(acc.replyTTL)
+
 	return MTRHopStat{
 		TTL:      acc.ttl,
 		Host:     acc.host,
@@ -254,5 +266,9 @@ func buildMTRHopStat(acc *mtrHopAccum) MTRHopStat {
 		Geo:      acc.geo,
 		MPLS:     mpls,
 		Received: acc.received,
+
+		ReplyTTL:   acc.replyTTL,
+		ReturnHops: returnHops,
+		Asymmetric: IsAsymmetric(acc.ttl, returnHops),
 	}
 }
@@ -191,6 +191,20 @@ func TestGeoPropagation(t *testing.T) {
 	}
 }
 
+func TestReplyTTLPropagation(t *testing.T) {
+	agg := NewMTRAggregator()
+	hop := mkHop(2, "2.2.2.2", 10*time.Millisecond)
+	hop.SetReplyTTL(58)
+	agg.Update(mkResult([]Hop{mkTimeoutHop(1)}, []Hop{hop}), 1)
+
+	// A round whose reply TTL is unknown keeps the last known value.
+	stats := agg.Update(mkResult([]Hop{mkTimeoutHop(1)}, []Hop{mkHop(2, "2.2.2.2", 12*time.Millisecond)}), 1)
+	s := stats[len(stats)-1]
+	if s.ReplyTTL != 58 || s.ReturnHops != 7 || !s.Asymmetric {
+		t.Fatalf("stat = %+v, want reply TTL 58, 7 return hops, asymmetric", s)
+	}
+}
+
 func TestStDevSingleSample(t *testing.T) {
 	agg := NewMTRAggregator()
 	res := mkResult([]Hop{mkHop(1, "1.1.1.1", 10*time.Millisecond)})
@@ -36,10 +36,11 @@ func newSocketProber(cfg Config) (*socketProber, error) {
 	}
 
 	localAddr := &net.UDPAddr{IP: cfg.SrcIP, Port: cfg.SrcPort}
-	udpConn, err := net.ListenUDP(network, localAddr)
+	conn, err := util.ListenPacket(network, localAddr.String())
 	if err != nil {
 		return nil, err
 	}
+	udpConn := conn.(*net.UDPConn)
 	if err := configurePMTUSocket(udpConn, cfg.ipVersion()); err != nil {
 		udpConn.Close()
 		return nil, err
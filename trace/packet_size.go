@@ -9,12 +9,13 @@ import (
 )
 
 const (
-	ipv4HeaderBytes     = 20
-	ipv6HeaderBytes     = 40
-	icmpHeaderBytes     = 8
-	udpHeaderBytes      = 8
-	tcpProbeHeaderBytes = 24
-	udpV6MinPayload     = 2
+	ipv4HeaderBytes      = 20
+	ipv6HeaderBytes      = 40
+	icmpHeaderBytes      = 8
+	udpHeaderBytes       = 8
+	tcpProbeHeaderBytes  = 24
+	sctpProbeHeaderBytes = 32
+	udpV6MinPayload      = 2
 )
 
 type PacketSizeSpec struct {
@@ -37,6 +38,8 @@ func packetSizeProtocolHeaderBytes(method Method) int {
 	switch method {
 	case TCPTrace:
 		return tcpProbeHeaderBytes
+	case SCTPTrace:
+		return sctpProbeHeaderBytes
 	case UDPTrace:
 		return udpHeaderBytes
 	default:
@@ -20,6 +20,7 @@ func TestNormalizePacketSize(t *testing.T) {
 		{name: "udp6", method: UDPTrace, ip: net.ParseIP("2001:db8::1"), packetSize: 64, wantSize: 16},
 		{name: "tcp4", method: TCPTrace, ip: net.ParseIP("1.1.1.1"), packetSize: 64, wantSize: 20},
 		{name: "tcp6-random", method: TCPTrace, ip: net.ParseIP("2001:db8::1"), packetSize: -96, wantSize: 32, wantRandom: true},
+		{name: "sctp4", method: SCTPTrace, ip: net.ParseIP("1.1.1.1"), packetSize: 64, wantSize: 12},
 	}
 
 	for _, tt := range tests {
@@ -74,6 +75,7 @@ func TestMinPacketSize(t *testing.T) {
 		{method: UDPTrace, ip: net.ParseIP("2001:db8::1"), want: 50},
 		{method: TCPTrace, ip: net.ParseIP("1.1.1.1"), want: 44},
 		{method: TCPTrace, ip: net.ParseIP("2001:db8::1"), want: 64},
+		{method: SCTPTrace, ip: net.ParseIP("1.1.1.1"), want: 52},
 	}
 
 	for _, tt := range tests {
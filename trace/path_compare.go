@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"strings"
+	"time"
+)
+
+// PathPoint locates one address or ASN on both sides of a PathComparison.
+type PathPoint struct {
+	IP        string `json:"ip,omitempty"`
+	ASN       string `json:"asn,omitempty"`
+	LocalTTL  int    `json:"local_ttl"`
+	RemoteTTL int    `json:"remote_ttl"`
+}
+
+// PathComparison pairs a local traceroute with a remote one to the same
+// target. ConvergeIP and ConvergeASN are the first address and ASN of the
+// remote path that also appear on the local path; Diverge is the first
+// TTL-aligned hop after ConvergeIP where the two paths split again.
+type PathComparison struct {
+	Target         string     `json:"target"`
+	RemoteLocation string     `json:"remote_location,omitempty"`
+	Local          *Result    `json:"local"`
+	Remote         *Result    `json:"remote"`
+	ConvergeIP     *PathPoint `json:"converge_ip,omitempty"`
+	ConvergeASN    *PathPoint `json:"converge_asn,omitempty"`
+	Diverge        *PathPoint `json:"diverge,omitempty"`
+}
+
+// PathRow is one TTL of the side-by-side view.
+type PathRow struct {
+	TTL    int
+	Local  *Hop
+	Remote *Hop
+}
+
+// ComparePaths finds where a local and a remote path meet and split.
+func ComparePaths(target, remoteLocation string, local, remote *Result) *PathComparison {
+	cmp := &PathComparison{Target: target, RemoteLocation: remoteLocation, Local: local, Remote: remote}
+	localIPs, localASNs := pathIndex(local)
+
+	for i := 0; i < pathLen(remote); i++ {
+		hop := PathHopAt(remote, i)
+		if hop == nil {
+			continue
+		}
+		if cmp.ConvergeIP == nil {
+			if ttl, ok := localIPs[addrToIPString(hop.Address)]; ok {
+				cmp.ConvergeIP = &PathPoint{IP: addrToIPString(hop.Address), ASN: PathHopASN(hop), LocalTTL: ttl, RemoteTTL: i + 1}
+			}
+		}
+		if cmp.ConvergeASN == nil {
+			if ttl, ok := localASNs[PathHopASN(hop)]; ok {
+				cmp.ConvergeASN = &PathPoint{ASN: PathHopASN(hop), LocalTTL: ttl, RemoteTTL: i + 1}
+			}
+		}
+	}
+
+	if cmp.ConvergeIP != nil {
+		for l, r := cmp.ConvergeIP.LocalTTL, cmp.ConvergeIP.RemoteTTL; l < pathLen(local) && r < pathLen(remote); l, r = l+1, r+1 {
+			lh, rh := PathHopAt(local, l), PathHopAt(remote, r)
+			if lh == nil || rh == nil {
+				continue
+			}
+			if lip, rip := addrToIPString(lh.Address), addrToIPString(rh.Address); lip != rip {
+				cmp.Diverge = &PathPoint{LocalTTL: l + 1, RemoteTTL: r + 1}
+				break
+			}
+		}
+	}
+	return cmp
+}
+
+// Rows aligns both paths by TTL.
+func (c *PathComparison) Rows() []PathRow {
+	n := max(pathLen(c.Local), pathLen(c.Remote))
+	rows := make([]PathRow, 0, n)
+	for i := 0; i < n; i++ {
+		rows = append(rows, PathRow{TTL: i + 1, Local: PathHopAt(c.Local, i), Remote: PathHopAt(c.Remote, i)})
+	}
+	return rows
+}
+
+// PathHopAt returns the first answering hop at TTL index i, or nil.
+func PathHopAt(res *Result, i int) *Hop {
+	if res == nil || i < 0 || i >= len(res.Hops) {
+		return nil
+	}
+	for j := range res.Hops[i] {
+		if h := &res.Hops[i][j]; h.Success && h.Address != nil {
+			return h
+		}
+	}
+	return nil
+}
+
+// PathHopASN returns the hop's ASN without the "AS" prefix.
+func PathHopASN(h *Hop) string {
+	if h == nil || h.Geo == nil {
+		return ""
+	}
+	asn := strings.TrimSpace(h.Geo.Asnumber)
+	if len(asn) > 2 && strings.EqualFold(asn[:2], "AS") {
+		asn = asn[2:]
+	}
+	if asn == "*" {
+		return ""
+	}
+	return asn
+}
+
+// PathHopRTT returns the hop's RTT in milliseconds.
+func PathHopRTT(h *Hop) float64 {
+	if h == nil {
+		return 0
+	}
+	return float64(h.RTT) / float64(time.Millisecond)
+}
+
+func pathLen(res *Result) int {
+	if res == nil {
+		return 0
+	}
+	return len(res.Hops)
+}
+
+func pathIndex(res *Result) (ips, asns map[string]int) {
+	ips, asns = map[string]int{}, map[string]int{}
+	for i := 0; i < pathLen(res); i++ {
+		hop := PathHopAt(res, i)
+		if hop == nil {
+			continue
+		}
+		if ip := addrToIPString(hop.Address); ip != "" {
+			if _, ok := ips[ip]; !ok {
+				ips[ip] = i + 1
+			}
+		}
+		if asn := PathHopASN(hop); asn != "" {
+			if _, ok := asns[asn]; !ok {
+				asns[asn] = i + 1
+			}
+		}
+	}
+	return ips, asns
+}
@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+)
+
+func pathTestResult(hops ...string) *Result {
+	res := &Result{}
+	for i, spec := range hops {
+		if spec == "" {
+			res.Hops = append(res.Hops, []Hop{{TTL: i + 1}})
+			continue
+		}
+		ip, asn, _ := strings.Cut(spec, "/")
+		res.Hops = append(res.Hops, []Hop{{
+			Success: true,
+			TTL:     i + 1,
+			Address: &net.IPAddr{IP: net.ParseIP(ip)},
+			RTT:     time.Duration(i+1) * time.Millisecond,
+			Geo:     &ipgeo.IPGeoData{Asnumber: asn},
+		}})
+	}
+	return res
+}
+
+func TestComparePathsConvergeAndDiverge(t *testing.T) {
+	local := pathTestResult("10.0.0.1/64512", "198.51.100.1/3320", "203.0.113.1/1299", "203.0.113.2/1299", "192.0.2.9/13335")
+	remote := pathTestResult("172.16.0.1", "", "198.51.100.77/1299", "203.0.113.1/1299", "203.0.113.2/1299", "192.0.2.1/13335")
+
+	cmp := ComparePaths("example.com", "Frankfurt, DE", local, remote)
+	if p := cmp.ConvergeASN; p == nil || p.ASN != "1299" || p.LocalTTL != 3 || p.RemoteTTL != 3 {
+		t.Fatalf("ConvergeASN = %+v", p)
+	}
+	if p := cmp.ConvergeIP; p == nil || p.IP != "203.0.113.1" || p.LocalTTL != 3 || p.RemoteTTL != 4 {
+		t.Fatalf("ConvergeIP = %+v", p)
+	}
+	if p := cmp.Diverge; p == nil || p.LocalTTL != 5 || p.RemoteTTL != 6 {
+		t.Fatalf("Diverge = %+v, want the hop after the shared 203.0.113.2", p)
+	}
+
+	rows := cmp.Rows()
+	if len(rows) != 6 || rows[1].Remote != nil || rows[5].Local != nil || rows[5].Remote == nil {
+		t.Fatalf("rows are not aligned by TTL: %+v", rows)
+	}
+	if got := PathHopRTT(rows[0].Local); got != 1 {
+		t.Fatalf("PathHopRTT = %v, want 1", got)
+	}
+}
+
+func TestComparePathsWithoutCommonHop(t *testing.T) {
+	cmp := ComparePaths("example.com", "", pathTestResult("10.0.0.1/AS64512"), pathTestResult("10.1.0.1/AS64513"))
+	if cmp.ConvergeIP != nil || cmp.ConvergeASN != nil || cmp.Diverge != nil {
+		t.Fatalf("comparison = %+v, want no meeting point", cmp)
+	}
+	if got := PathHopASN(PathHopAt(cmp.Local, 0)); got != "64512" {
+		t.Fatalf("PathHopASN = %q, want the AS prefix stripped", got)
+	}
+}
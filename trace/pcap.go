@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/nxtrace/NTrace-core/internal/pcapng"
+	"github.com/nxtrace/NTrace-core/trace/internal"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// PacketCapture records the probes and replies of one trace to a pcapng
+// file. Probes are written as the tracers built them. Raw sockets hand over
+// replies without their IP header, so an IPv4 or IPv6 header is rebuilt in
+// front of them, carrying the TTL or hop limit the reply arrived with, or 0
+// when the socket could not report it. A nil *PacketCapture records nothing.
+type PacketCapture struct {
+	mu  sync.Mutex
+	w   *pcapng.Writer
+	err error
+}
+
+// NewPacketCapture writes the pcapng headers to w. target names the capture
+// interface so the file says what was traced.
+func NewPacketCapture(w io.Writer, target string) (*PacketCapture, error) {
+	pw, err := pcapng.NewWriter(w, "NextTrace", target)
+	if err != nil {
+		return nil, err
+	}
+	return &PacketCapture{w: pw}, nil
+}
+
+// Close flushes the capture and returns the first write error.
+func (c *PacketCapture) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.w.Flush(); err != nil && c.err == nil {
+		c.err = err
+	}
+	return c.err
+}
+
+func (c *PacketCapture) write(at time.Time, data []byte, dir pcapng.Direction, comment string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = c.w.WritePacket(at, data, dir, comment)
+}
+
+// probe records a sent probe. ls starts with the IP header; nil layers are
+// skipped. i is the zero-based attempt index used by the tracers.
+func (c *PacketCapture) probe(at time.Time, ttl, i int, ls ...gopacket.SerializableLayer) {
+	if c == nil {
+		return
+	}
+	var stack []gopacket.SerializableLayer
+	for _, l := range ls {
+		if l != nil {
+			stack = append(stack, l)
+		}
+	}
+	if len(stack) == 0 {
+		return
+	}
+	if nl, ok := stack[0].(gopacket.NetworkLayer); ok {
+		for _, l := range stack[1:] {
+			if cl, ok := l.(interface {
+				SetNetworkLayerForChecksum(gopacket.NetworkLayer) error
+			}); ok {
+				_ = cl.SetNetworkLayerForChecksum(nl)
+			}
+		}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, stack...); err != nil {
+		return
+	}
+	c.write(at, buf.Bytes(), pcapng.Outbound, fmt.Sprintf("probe ttl=%d attempt=%d", ttl, i+1))
+}
+
+// reply records a received ICMP message or TCP segment from peer to local
+// together with what the tracer made of it. ttl is the TTL or hop limit the
+// reply arrived with, 0 when the socket could not report it.
+func (c *PacketCapture) reply(at time.Time, peer net.Addr, local net.IP, proto layers.IPProtocol, ttl int, msg []byte, decision string) {
+	if c == nil || len(msg) == 0 {
+		return
+	}
+	src := util.AddrIP(peer)
+	var ip gopacket.SerializableLayer
+	if src.To4() != nil && (local == nil || local.To4() != nil) {
+		ip = &layers.IPv4{Version: 4, IHL: 5, TTL: uint8(ttl), Protocol: proto, SrcIP: src.To4(), DstIP: local.To4()}
+	} else {
+		if proto == layers.IPProtocolICMPv4 {
+			proto = layers.IPProtocolICMPv6
+		}
+		ip = &layers.IPv6{Version: 6, NextHeader: proto, HopLimit: uint8(ttl), SrcIP: src, DstIP: local}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, gopacket.Payload(msg)); err != nil {
+		return
+	}
+	c.write(at, buf.Bytes(), pcapng.Inbound, "reply "+decision)
+}
+
+// discardFunc hands the packets a listener dropped to the capture.
+func (c *PacketCapture) discardFunc(local net.IP) internal.DiscardFunc {
+	if c == nil {
+		return nil
+	}
+	return func(msg internal.ReceivedMessage, finish time.Time, proto layers.IPProtocol) {
+		c.reply(finish, msg.Peer, local, proto, msg.TTL, msg.Msg, decisionNotProbe)
+	}
+}
+
+// Match decisions written next to captured replies.
+func matchedDecision(ttl, i int, rtt time.Duration) string {
+	return fmt.Sprintf("matched ttl=%d attempt=%d rtt=%.3fms", ttl, i+1, float64(rtt)/float64(time.Millisecond))
+}
+
+func lateDecision(ttl, i int) string {
+	return fmt.Sprintf("late: probe ttl=%d attempt=%d already timed out or answered", ttl, i+1)
+}
+
+func dstPortDecision(port int) string {
+	return fmt.Sprintf("unmatched: quoted destination port %d is not the target port", port)
+}
+
+const (
+	decisionNotProbe  = "unmatched: does not quote a probe of this trace"
+	decisionNoProbe   = "unmatched: no outstanding probe with this sequence"
+	decisionSrcPort   = "unmatched: source port differs from the probe"
+	decisionQueueFull = "dropped: match queue full"
+)
@@ -0,0 +1,411 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"github.com/nxtrace/NTrace-core/trace/internal"
+)
+
+// PcapTrace is one traceroute rebuilt from a packet capture.
+type PcapTrace struct {
+	Method Method
+	Source net.IP
+	Target net.IP
+	Start  time.Time
+	// Result holds the probes of every TTL in the order they were sent.
+	// TTLs no probe was sent with are left empty.
+	Result *Result
+}
+
+// pcapMaxProbeTTL bounds the TTL of a probe. Other traffic leaves with 64,
+// 128 or 255 and must not be taken for one.
+const pcapMaxProbeTTL = 63
+
+var ErrNoPcapTrace = errors.New("no traceroute probes answered by ICMP time exceeded found in the capture")
+
+type pcapProbe struct {
+	key    pcapTraceKey
+	at     time.Time
+	ttl    int
+	tcpSeq uint32
+	tcpEnd uint32
+	// udpPayload is kept to match protocol answers from the target.
+	udpPayload []byte
+	hop        *Hop
+	final      bool
+}
+
+type pcapTraceKey struct {
+	method   Method
+	src, dst string
+}
+
+// pcapReplay matches replies to the probes read so far.
+type pcapReplay struct {
+	probes []*pcapProbe
+	// byQuote finds a probe by the bytes an ICMP error quotes of it.
+	byQuote map[string][]*pcapProbe
+	byEcho  map[string][]*pcapProbe
+	byFlow  map[string][]*pcapProbe
+	traced  map[pcapTraceKey]bool
+}
+
+// TracesFromPcap reads a pcap or pcapng capture and rebuilds every
+// traceroute in it, ordered by their first probe. A probe is an outgoing
+// UDP packet, TCP SYN or ICMP echo request with a TTL below 64. ICMP errors
+// quoting a probe, echo replies, SYN/ACK or RST answers and protocol answers
+// to UDP payload profiles from the target are matched back to it the way the
+// tracers do. Only flows with at least
+// one time exceeded reply count as traceroutes.
+func TracesFromPcap(r io.Reader) ([]PcapTrace, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("read capture: %w", err)
+	}
+	var next func() ([]byte, gopacket.CaptureInfo, layers.LinkType, error)
+	if bytes.Equal(magic, []byte{0x0A, 0x0D, 0x0D, 0x0A}) {
+		ng, err := pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, err
+		}
+		next = func() ([]byte, gopacket.CaptureInfo, layers.LinkType, error) {
+			data, ci, err := ng.ReadPacketData()
+			if err != nil {
+				return nil, ci, 0, err
+			}
+			link := ng.LinkType()
+			if iface, err := ng.Interface(ci.InterfaceIndex); err == nil {
+				link = iface.LinkType
+			}
+			return data, ci, link, nil
+		}
+	} else {
+		pr, err := pcapgo.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		next = func() ([]byte, gopacket.CaptureInfo, layers.LinkType, error) {
+			data, ci, err := pr.ReadPacketData()
+			return data, ci, pr.LinkType(), err
+		}
+	}
+
+	rp := &pcapReplay{
+		byQuote: map[string][]*pcapProbe{},
+		byEcho:  map[string][]*pcapProbe{},
+		byFlow:  map[string][]*pcapProbe{},
+		traced:  map[pcapTraceKey]bool{},
+	}
+	for {
+		data, ci, link, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// A capture cut short still holds the packets before the cut.
+			if len(rp.probes) > 0 {
+				break
+			}
+			return nil, err
+		}
+		rp.packet(data, ci.Timestamp, link)
+	}
+	traces := rp.traces()
+	if len(traces) == 0 {
+		return nil, ErrNoPcapTrace
+	}
+	return traces, nil
+}
+
+func (rp *pcapReplay) packet(data []byte, at time.Time, link layers.LinkType) {
+	var first gopacket.Decoder = link
+	switch link {
+	case layers.LinkTypeIPv4:
+		first = layers.LayerTypeIPv4
+	case layers.LinkTypeIPv6:
+		first = layers.LayerTypeIPv6
+	}
+	pkt := gopacket.NewPacket(data, first, gopacket.NoCopy)
+	var (
+		version  int
+		src, dst net.IP
+		ttl      int
+		proto    layers.IPProtocol
+		ipBytes  []byte
+	)
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		version, src, dst, ttl, proto = 4, ip.SrcIP, ip.DstIP, int(ip.TTL), ip.Protocol
+		ipBytes = append(append([]byte(nil), ip.Contents...), ip.Payload...)
+	case *layers.IPv6:
+		version, src, dst, ttl, proto = 6, ip.SrcIP, ip.DstIP, int(ip.HopLimit), ip.NextHeader
+		ipBytes = append(append([]byte(nil), ip.Contents...), ip.Payload...)
+	default:
+		return
+	}
+	transport, ok := ipTransport(version, ipBytes)
+	if !ok {
+		return
+	}
+
+	switch proto {
+	case layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		if quote, ok := internal.DecodeICMPError(version, transport); ok {
+			rp.icmpError(at, src, ttl, quote, transport)
+			return
+		}
+		if id, seq, ok := internal.DecodeICMPEchoReply(version, transport); ok {
+			rp.answer(rp.byEcho, echoKey(dst, src, id, seq), at, src, ttl, nil, func(*pcapProbe) bool { return true })
+			return
+		}
+		if len(transport) >= 8 && isEchoRequest(version, transport[0]) && ttl <= pcapMaxProbeTTL {
+			p := rp.probe(ICMPTrace, src, dst, at, ttl, quoteKey(version, ipBytes))
+			key := echoKey(src, dst, int(binary.BigEndian.Uint16(transport[4:6])), int(binary.BigEndian.Uint16(transport[6:8])))
+			rp.byEcho[key] = append(rp.byEcho[key], p)
+		}
+	case layers.IPProtocolUDP:
+		if len(transport) < 8 {
+			return
+		}
+		srcPort, dstPort := int(binary.BigEndian.Uint16(transport[0:2])), int(binary.BigEndian.Uint16(transport[2:4]))
+		payload := transport[8:]
+		// A DNS, QUIC, NTP or STUN probe may be answered in kind by the target.
+		if rp.answer(rp.byFlow, flowKey(dst, src, dstPort, srcPort), at, src, ttl, nil, func(p *pcapProbe) bool {
+			return p.key.method == UDPTrace && udpPayloadAnswers(p.udpPayload, payload)
+		}) != nil {
+			return
+		}
+		if ttl <= pcapMaxProbeTTL {
+			p := rp.probe(UDPTrace, src, dst, at, ttl, quoteKey(version, ipBytes))
+			p.udpPayload = append([]byte(nil), payload...)
+			key := flowKey(src, dst, srcPort, dstPort)
+			rp.byFlow[key] = append(rp.byFlow[key], p)
+		}
+	case layers.IPProtocolTCP:
+		tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		if !ok || tcp == nil {
+			return
+		}
+		if isTCPProbeSegment(tcp) {
+			if ttl <= pcapMaxProbeTTL {
+				p := rp.probe(TCPTrace, src, dst, at, ttl, quoteKey(version, ipBytes))
+				p.tcpSeq = tcp.Seq
+				p.tcpEnd = tcp.Seq + uint32(len(tcp.Payload))
+				if tcp.SYN || tcp.FIN {
+					p.tcpEnd++
+				}
+				key := flowKey(src, dst, int(tcp.SrcPort), int(tcp.DstPort))
+				rp.byFlow[key] = append(rp.byFlow[key], p)
+			}
+			return
+		}
+		srcPort, seq, ack, ok := internal.DecodeTCPProbeReply(version, int(tcp.SrcPort), pkt)
+		if !ok {
+			return
+		}
+		rp.answer(rp.byFlow, flowKey(dst, src, srcPort, int(tcp.SrcPort)), at, src, ttl, nil, func(p *pcapProbe) bool {
+			if ack != 0 {
+				return uint32(ack) == p.tcpEnd || uint32(ack) == p.tcpSeq+1
+			}
+			return uint32(seq) == p.tcpSeq
+		})
+	}
+}
+
+// isTCPProbeSegment reports whether a segment has the shape of a TCP probe:
+// a SYN, FIN or NULL probe, or an ACK probe whose ack number repeats its
+// sequence number so that the RST it draws carries the probe's sequence.
+func isTCPProbeSegment(tcp *layers.TCP) bool {
+	switch {
+	case tcp.RST || tcp.PSH || tcp.URG || (tcp.SYN && tcp.FIN):
+		return false
+	case tcp.ACK:
+		return !tcp.SYN && !tcp.FIN && tcp.Ack == tcp.Seq
+	}
+	return true
+}
+
+func (rp *pcapReplay) probe(method Method, src, dst net.IP, at time.Time, ttl int, quote string) *pcapProbe {
+	p := &pcapProbe{key: pcapTraceKey{method: method, src: src.String(), dst: dst.String()}, at: at, ttl: ttl}
+	rp.probes = append(rp.probes, p)
+	if quote != "" {
+		rp.byQuote[quote] = append(rp.byQuote[quote], p)
+	}
+	return p
+}
+
+// icmpError matches an ICMP error to the probe it quotes. Time exceeded
+// marks the flow as a traceroute; any other error from the target itself,
+// such as port unreachable, ends the path. ttl is the TTL the error
+// arrived with.
+func (rp *pcapReplay) icmpError(at time.Time, peer net.IP, ttl int, quote, msg []byte) {
+	if len(quote) == 0 {
+		return
+	}
+	version := int(quote[0] >> 4)
+	key := quoteKey(version, quote)
+	if key == "" {
+		return
+	}
+	mpls := extractMPLS(internal.ReceivedMessage{Msg: msg}, false)
+	p := rp.answer(rp.byQuote, key, at, peer, ttl, mpls, func(*pcapProbe) bool { return true })
+	if p == nil {
+		return
+	}
+	p.hop.QuotedTOS = quotedIPTOS(quote)
+	if isTimeExceeded(version, msg[0]) {
+		rp.traced[p.key] = true
+	}
+}
+
+// answer gives the reply to the oldest unanswered probe under key that
+// accepts it.
+func (rp *pcapReplay) answer(index map[string][]*pcapProbe, key string, at time.Time, peer net.IP, replyTTL int, mpls []string, accept func(*pcapProbe) bool) *pcapProbe {
+	for _, p := range index[key] {
+		if p.hop != nil || at.Before(p.at) || !accept(p) {
+			continue
+		}
+		p.hop = &Hop{
+			Success: true,
+			Address: &net.IPAddr{IP: append(net.IP(nil), peer...)},
+			TTL:     p.ttl,
+			RTT:     at.Sub(p.at),
+			MPLS:    mpls,
+		}
+		p.hop.SetReplyTTL(replyTTL)
+		p.final = peer.String() == p.key.dst
+		return p
+	}
+	return nil
+}
+
+func (rp *pcapReplay) traces() []PcapTrace {
+	byKey := map[pcapTraceKey]*PcapTrace{}
+	var order []pcapTraceKey
+	final := map[pcapTraceKey]int{}
+	for _, p := range rp.probes {
+		if !rp.traced[p.key] {
+			continue
+		}
+		t := byKey[p.key]
+		if t == nil {
+			t = &PcapTrace{
+				Method: p.key.method,
+				Source: net.ParseIP(p.key.src),
+				Target: net.ParseIP(p.key.dst),
+				Start:  p.at,
+				Result: &Result{},
+			}
+			byKey[p.key] = t
+			order = append(order, p.key)
+		}
+		if p.final && (final[p.key] == 0 || p.ttl < final[p.key]) {
+			final[p.key] = p.ttl
+		}
+	}
+	for _, p := range rp.probes {
+		t := byKey[p.key]
+		if t == nil || (final[p.key] > 0 && p.ttl > final[p.key]) {
+			continue
+		}
+		for len(t.Result.Hops) < p.ttl {
+			t.Result.Hops = append(t.Result.Hops, nil)
+		}
+		hop := Hop{TTL: p.ttl, Error: errHopLimitTimeout}
+		if p.hop != nil {
+			hop = *p.hop
+		}
+		t.Result.Hops[p.ttl-1] = append(t.Result.Hops[p.ttl-1], hop)
+	}
+	traces := make([]PcapTrace, 0, len(order))
+	for _, k := range order {
+		traces = append(traces, *byKey[k])
+	}
+	sort.SliceStable(traces, func(i, j int) bool { return traces[i].Start.Before(traces[j].Start) })
+	return traces
+}
+
+// ipTransport returns what follows the fixed IP header.
+func ipTransport(version int, b []byte) ([]byte, bool) {
+	switch version {
+	case 4:
+		if len(b) < 20 {
+			return nil, false
+		}
+		ihl := int(b[0]&0x0F) * 4
+		if ihl < 20 || len(b) < ihl {
+			return nil, false
+		}
+		return b[ihl:], true
+	case 6:
+		if len(b) < 40 {
+			return nil, false
+		}
+		return b[40:], true
+	}
+	return nil, false
+}
+
+// quoteKey identifies a probe by the fields an ICMP error quotes unchanged:
+// the addresses, the protocol, the IPv4 ID and the first 8 bytes of the
+// transport header less any checksum in them. Probes sent through kernel
+// sockets are captured before checksum offload fills the UDP or ICMP
+// checksum, so the quoted copy may differ there.
+func quoteKey(version int, b []byte) string {
+	transport, ok := ipTransport(version, b)
+	if !ok || len(transport) < 8 {
+		return ""
+	}
+	var proto byte
+	if version == 4 {
+		proto = b[9]
+	} else {
+		proto = b[6]
+	}
+	head := append([]byte(nil), transport[:8]...)
+	switch layers.IPProtocol(proto) {
+	case layers.IPProtocolUDP, layers.IPProtocolUDPLite:
+		head[6], head[7] = 0, 0
+	case layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		head[2], head[3] = 0, 0
+	}
+	if version == 4 {
+		return fmt.Sprintf("%s>%s/%d/%x/%x", net.IP(b[12:16]), net.IP(b[16:20]), proto, b[4:6], head)
+	}
+	return fmt.Sprintf("%s>%s/%d/%x", net.IP(b[8:24]), net.IP(b[24:40]), proto, head)
+}
+
+func echoKey(src, dst net.IP, id, seq int) string {
+	return fmt.Sprintf("%s>%s/%d/%d", src, dst, id, seq)
+}
+
+func flowKey(src, dst net.IP, srcPort, dstPort int) string {
+	return fmt.Sprintf("%s:%d>%s:%d", src, srcPort, dst, dstPort)
+}
+
+func isEchoRequest(version int, typ byte) bool {
+	if version == 6 {
+		return typ == byte(layers.ICMPv6TypeEchoRequest)
+	}
+	return typ == layers.ICMPv4TypeEchoRequest
+}
+
+func isTimeExceeded(version int, typ byte) bool {
+	if version == 6 {
+		return typ == byte(layers.ICMPv6TypeTimeExceeded)
+	}
+	return typ == layers.ICMPv4TypeTimeExceeded
+}
@@ -0,0 +1,258 @@
+package trace
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/nxtrace/NTrace-core/internal/pcapng"
+)
+
+func serializeTestPacket(t *testing.T, ls ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	switch l4 := ls[1].(type) {
+	case *layers.UDP:
+		_ = l4.SetNetworkLayerForChecksum(ls[0].(gopacket.NetworkLayer))
+	case *layers.TCP:
+		_ = l4.SetNetworkLayerForChecksum(ls[0].(gopacket.NetworkLayer))
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}, ls...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTracesFromPcapRebuildsUDPTrace(t *testing.T) {
+	src := net.ParseIP("192.0.2.10").To4()
+	dst := net.ParseIP("198.51.100.1").To4()
+	router := net.ParseIP("203.0.113.1")
+
+	var buf bytes.Buffer
+	c, err := NewPacketCapture(&buf, "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	probe := func(ttl, port int, at time.Time) []byte {
+		ip := &layers.IPv4{Version: 4, IHL: 5, Id: uint16(ttl << 8), SrcIP: src, DstIP: dst, Protocol: layers.IPProtocolUDP, TTL: uint8(ttl)}
+		udp := &layers.UDP{SrcPort: 40000, DstPort: layers.UDPPort(port)}
+		c.probe(at, ttl, 0, ip, udp, gopacket.Payload("nexttrace"))
+		return serializeTestPacket(t, ip, udp, gopacket.Payload("nexttrace"))
+	}
+	icmpError := func(typ byte, quoted []byte) []byte {
+		return append([]byte{typ, 0, 0, 0, 0, 0, 0, 0}, quoted[:28]...)
+	}
+
+	p1 := probe(1, 33434, start)
+	_ = probe(2, 33435, start.Add(time.Millisecond))
+	p3 := probe(3, 33436, start.Add(2*time.Millisecond))
+	_ = probe(4, 33437, start.Add(3*time.Millisecond))
+	// Ordinary traffic to the target is not a probe.
+	_ = probe(64, 53, start.Add(4*time.Millisecond))
+	c.reply(start.Add(5*time.Millisecond), &net.IPAddr{IP: router}, src, layers.IPProtocolICMPv4, 255, icmpError(11, p1), "")
+	c.reply(start.Add(22*time.Millisecond), &net.IPAddr{IP: dst}, src, layers.IPProtocolICMPv4, 61, icmpError(3, p3), "")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	traces, err := TracesFromPcap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 {
+		t.Fatalf("traces = %d, want 1", len(traces))
+	}
+	tr := traces[0]
+	if tr.Method != UDPTrace || !tr.Source.Equal(src) || !tr.Target.Equal(dst) {
+		t.Fatalf("trace = %s %v > %v", tr.Method, tr.Source, tr.Target)
+	}
+	hops := tr.Result.Hops
+	if len(hops) != 3 {
+		t.Fatalf("hops = %d, want 3 (probes past the target dropped)", len(hops))
+	}
+	if h := hops[0][0]; !h.Success || h.Address.String() != "203.0.113.1" || h.RTT != 5*time.Millisecond || h.ReturnHops != 1 || h.Asymmetric {
+		t.Fatalf("ttl 1 = %+v", h)
+	}
+	if h := hops[1][0]; h.Success {
+		t.Fatalf("ttl 2 = %+v, want a timeout", h)
+	}
+	if h := hops[2][0]; !h.Success || h.Address.String() != "198.51.100.1" || h.RTT != 20*time.Millisecond || h.ReplyTTL != 61 || h.ReturnHops != 4 || h.Asymmetric {
+		t.Fatalf("ttl 3 = %+v", h)
+	}
+}
+
+func TestTracesFromPcapIgnoresUnfilledProbeChecksum(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		src, dst net.IP
+		router   net.IP
+		checksum int // offset of the UDP checksum in the packet
+		replyTyp byte
+		dstType  [2]byte // unreachable type and code sent by the target
+		replyLen int
+		proto    layers.IPProtocol
+	}{
+		{
+			name: "ipv4 zeroed", src: net.ParseIP("192.0.2.10").To4(), dst: net.ParseIP("198.51.100.1").To4(), router: net.ParseIP("203.0.113.1"),
+			checksum: 26, replyTyp: 11, dstType: [2]byte{3, 3}, replyLen: 28, proto: layers.IPProtocolICMPv4,
+		},
+		{
+			name: "ipv6 partial", src: net.ParseIP("2001:db8::10"), dst: net.ParseIP("2001:db8:1::1"), router: net.ParseIP("2001:db8:2::1"),
+			checksum: 46, replyTyp: 3, dstType: [2]byte{1, 4}, replyLen: 57, proto: layers.IPProtocolICMPv6,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c, err := NewPacketCapture(&buf, tc.dst.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			for ttl := 1; ttl <= 2; ttl++ {
+				var ip gopacket.SerializableLayer
+				if tc.src.To4() != nil {
+					ip = &layers.IPv4{Version: 4, IHL: 5, Id: uint16(ttl << 8), SrcIP: tc.src, DstIP: tc.dst, Protocol: layers.IPProtocolUDP, TTL: uint8(ttl)}
+				} else {
+					ip = &layers.IPv6{Version: 6, SrcIP: tc.src, DstIP: tc.dst, NextHeader: layers.IPProtocolUDP, HopLimit: uint8(ttl)}
+				}
+				sent := serializeTestPacket(t, ip, &layers.UDP{SrcPort: 40000, DstPort: layers.UDPPort(33433 + ttl)}, gopacket.Payload("nexttrace"))
+				// The capture sees the probe before the NIC fills in the checksum.
+				captured := append([]byte(nil), sent...)
+				captured[tc.checksum], captured[tc.checksum+1] = 0, byte(ttl)
+				c.write(start.Add(time.Duration(ttl)*time.Millisecond), captured, pcapng.Outbound, "probe")
+				peer, typ, code := tc.router, tc.replyTyp, byte(0)
+				if ttl == 2 {
+					peer, typ, code = tc.dst, tc.dstType[0], tc.dstType[1]
+				}
+				msg := append([]byte{typ, code, 0, 0, 0, 0, 0, 0}, sent[:tc.replyLen]...)
+				c.reply(start.Add(time.Duration(ttl)*10*time.Millisecond), &net.IPAddr{IP: peer}, tc.src, tc.proto, 60, msg, "")
+			}
+			if err := c.Close(); err != nil {
+				t.Fatal(err)
+			}
+			traces, err := TracesFromPcap(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hops := traces[0].Result.Hops
+			if len(hops) != 2 || !hops[0][0].Success || !hops[0][0].Address.(*net.IPAddr).IP.Equal(tc.router) || !hops[1][0].Success {
+				t.Fatalf("hops = %+v, want both probes matched to their quoted copies", hops)
+			}
+		})
+	}
+}
+
+func TestTracesFromPcapMatchesProtocolAnswer(t *testing.T) {
+	src := net.ParseIP("192.0.2.10").To4()
+	dst := net.ParseIP("198.51.100.53").To4()
+
+	var buf bytes.Buffer
+	c, err := NewPacketCapture(&buf, "198.51.100.53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var first, last []byte
+	for ttl := 1; ttl <= 2; ttl++ {
+		payload, _, _ := buildUDPPayload(UDPPayloadDNS, ttl<<8, 0)
+		ip := &layers.IPv4{Version: 4, IHL: 5, Id: uint16(ttl << 8), SrcIP: src, DstIP: dst, Protocol: layers.IPProtocolUDP, TTL: uint8(ttl)}
+		udp := &layers.UDP{SrcPort: 40000, DstPort: 53}
+		c.probe(start.Add(time.Duration(ttl)*time.Millisecond), ttl, 0, ip, udp, gopacket.Payload(payload))
+		if first == nil {
+			first = serializeTestPacket(t, ip, udp, gopacket.Payload(payload))
+		}
+		last = payload
+	}
+	c.reply(start.Add(6*time.Millisecond), &net.IPAddr{IP: net.ParseIP("203.0.113.1")}, src, layers.IPProtocolICMPv4, 255,
+		append([]byte{11, 0, 0, 0, 0, 0, 0, 0}, first[:28]...), "")
+	answer := append([]byte(nil), last...)
+	answer[2] |= 0x80
+	udp := serializeTestPacket(t,
+		&layers.IPv4{Version: 4, IHL: 5, SrcIP: dst, DstIP: src, Protocol: layers.IPProtocolUDP, TTL: 60},
+		&layers.UDP{SrcPort: 53, DstPort: 40000}, gopacket.Payload(answer))
+	c.reply(start.Add(12*time.Millisecond), &net.IPAddr{IP: dst}, src, layers.IPProtocolUDP, 60, udp[20:], "")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	traces, err := TracesFromPcap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hops := traces[0].Result.Hops
+	if len(hops) != 2 || !hops[0][0].Success {
+		t.Fatalf("hops = %+v", hops)
+	}
+	if h := hops[1][0]; !h.Success || h.Address.String() != "198.51.100.53" || h.RTT != 10*time.Millisecond {
+		t.Fatalf("ttl 2 = %+v", h)
+	}
+}
+
+func TestTracesFromPcapMatchesACKProbeRST(t *testing.T) {
+	src := net.ParseIP("192.0.2.10").To4()
+	dst := net.ParseIP("198.51.100.80").To4()
+
+	var buf bytes.Buffer
+	c, err := NewPacketCapture(&buf, "198.51.100.80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var first []byte
+	for ttl := 1; ttl <= 2; ttl++ {
+		ip := &layers.IPv4{Version: 4, IHL: 5, SrcIP: src, DstIP: dst, Protocol: layers.IPProtocolTCP, TTL: uint8(ttl)}
+		tcp := TCPProbeProfile{Flags: TCPProbeACK}.header(40000, 80, ttl<<24, 1460)
+		c.probe(start.Add(time.Duration(ttl)*time.Millisecond), ttl, 0, ip, tcp)
+		if first == nil {
+			first = serializeTestPacket(t, ip, tcp)
+		}
+	}
+	c.reply(start.Add(6*time.Millisecond), &net.IPAddr{IP: net.ParseIP("203.0.113.1")}, src, layers.IPProtocolICMPv4, 255,
+		append([]byte{11, 0, 0, 0, 0, 0, 0, 0}, first[:28]...), "")
+	rst := serializeTestPacket(t,
+		&layers.IPv4{Version: 4, IHL: 5, SrcIP: dst, DstIP: src, Protocol: layers.IPProtocolTCP, TTL: 60},
+		&layers.TCP{SrcPort: 80, DstPort: 40000, RST: true, Seq: 2 << 24})
+	c.reply(start.Add(12*time.Millisecond), &net.IPAddr{IP: dst}, src, layers.IPProtocolTCP, 60, rst[20:], "")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	traces, err := TracesFromPcap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if traces[0].Method != TCPTrace {
+		t.Fatalf("method = %s", traces[0].Method)
+	}
+	hops := traces[0].Result.Hops
+	if len(hops) != 2 || !hops[0][0].Success {
+		t.Fatalf("hops = %+v", hops)
+	}
+	if h := hops[1][0]; !h.Success || h.Address.String() != "198.51.100.80" || h.RTT != 10*time.Millisecond {
+		t.Fatalf("ttl 2 = %+v", h)
+	}
+}
+
+func TestTracesFromPcapWithoutTrace(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewPacketCapture(&buf, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := &layers.IPv4{Version: 4, SrcIP: net.ParseIP("192.0.2.10").To4(), DstIP: net.ParseIP("198.51.100.1").To4(), Protocol: layers.IPProtocolUDP, TTL: 1}
+	c.probe(time.Now(), 1, 0, ip, &layers.UDP{SrcPort: 1, DstPort: 2})
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TracesFromPcap(&buf); err != ErrNoPcapTrace {
+		t.Fatalf("err = %v, want ErrNoPcapTrace", err)
+	}
+	if _, err := TracesFromPcap(bytes.NewReader([]byte("not a capture"))); err == nil {
+		t.Fatal("text accepted as a capture")
+	}
+}
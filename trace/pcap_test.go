@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func TestPacketCaptureProbeAndReply(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewPacketCapture(&buf, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, dst := net.ParseIP("192.0.2.10").To4(), net.ParseIP("198.51.100.1").To4()
+	ip := &layers.IPv4{Version: 4, SrcIP: src, DstIP: dst, Protocol: layers.IPProtocolUDP, TTL: 3}
+	udp := &layers.UDP{SrcPort: 40000, DstPort: 33494}
+	at := time.Now()
+	c.probe(at, 3, 1, ip, udp, gopacket.Payload([]byte("ntr")))
+
+	reply := []byte{11, 0, 0, 0, 0, 0, 0, 0}
+	c.reply(at.Add(5*time.Millisecond), &net.IPAddr{IP: net.ParseIP("203.0.113.7")}, src, layers.IPProtocolICMPv4, 250, reply, matchedDecision(3, 1, 5*time.Millisecond))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "probe ttl=3 attempt=2") || !strings.Contains(buf.String(), "reply matched ttl=3 attempt=2 rtt=5.000ms") {
+		t.Fatal("capture is missing the packet comments")
+	}
+
+	r, err := pcapgo.NewNgReader(&buf, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := r.ReadPacketData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt := gopacket.NewPacket(data, layers.LayerTypeIPv4, gopacket.Default)
+	gotIP, _ := pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	gotUDP, _ := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if gotIP == nil || gotUDP == nil || gotIP.TTL != 3 || gotUDP.DstPort != 33494 || gotUDP.Checksum == 0 {
+		t.Fatalf("probe = %v", pkt)
+	}
+
+	data, _, err = r.ReadPacketData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkt = gopacket.NewPacket(data, layers.LayerTypeIPv4, gopacket.Default)
+	gotIP, _ = pkt.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+	if gotIP == nil || !gotIP.SrcIP.Equal(net.ParseIP("203.0.113.7")) || !gotIP.DstIP.Equal(src) || gotIP.TTL != 250 || pkt.Layer(layers.LayerTypeICMPv4) == nil {
+		t.Fatalf("reply = %v", pkt)
+	}
+}
+
+func TestPacketCaptureNil(t *testing.T) {
+	var c *PacketCapture
+	c.probe(time.Now(), 1, 0, &layers.IPv4{})
+	c.reply(time.Now(), nil, nil, layers.IPProtocolTCP, 0, []byte{1}, decisionNoProbe)
+	if c.discardFunc(nil) != nil {
+		t.Fatal("nil capture returned a discard hook")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
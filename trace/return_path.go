@@ -0,0 +1,41 @@
+package trace
+
+// 常见操作系统与网络设备发出报文时使用的初始 TTL / Hop Limit
+var commonInitialTTLs = []int{64, 128, 255}
+
+// InferReturnHops 按常见初始 TTL（64/128/255）推算回包经过的跳数：
+// 取不小于 replyTTL 的最小初始值，回程跳数 = 初始值 - replyTTL + 1，
+// 与正向 TTL 的计数方式一致（直连的下一跳记为 1）。replyTTL 未知时返回 0
+func InferReturnHops(replyTTL int) int {
+	if replyTTL <= 0 {
+		return 0
+	}
+	for _, initial := range commonInitialTTLs {
+		if replyTTL <= initial {
+			return initial - replyTTL + 1
+		}
+	}
+	return 0
+}
+
+// AsymmetryTolerance 为判定路径不对称时允许的回程与正向跳数之差。
+// 回程跳数依赖对初始 TTL 的猜测，隧道、不减 TTL 的设备与从其他接口
+// 发出的回包都会带来一两跳的偏差
+const AsymmetryTolerance = 2
+
+// IsAsymmetric 报告回程跳数与正向跳数之差是否超出 AsymmetryTolerance，
+// 任一跳数未知时返回 false
+func IsAsymmetric(ttl, returnHops int) bool {
+	if ttl <= 0 || returnHops <= 0 {
+		return false
+	}
+	diff := returnHops - ttl
+	return diff > AsymmetryTolerance || diff < -AsymmetryTolerance
+}
+
+// SetReplyTTL 记录回包 TTL，并据此推算回程跳数与是否不对称
+func (h *Hop) SetReplyTTL(replyTTL int) {
+	h.ReplyTTL = replyTTL
+	h.ReturnHops = InferReturnHops(replyTTL)
+	h.Asymmetric = IsAsymmetric(h.TTL, h.ReturnHops)
+}
@@ -0,0 +1,45 @@
+package trace
+
+import "testing"
+
+func TestInferReturnHops(t *testing.T) {
+	tests := []struct {
+		replyTTL int
+		want     int
+	}{
+		{0, 0},
+		{64, 1},
+		{58, 7},
+		{65, 64},
+		{120, 9},
+		{255, 1},
+		{243, 13},
+		{300, 0},
+	}
+	for _, tt := range tests {
+		if got := InferReturnHops(tt.replyTTL); got != tt.want {
+			t.Errorf("InferReturnHops(%d) = %d, want %d", tt.replyTTL, got, tt.want)
+		}
+	}
+}
+
+func TestHopSetReplyTTL(t *testing.T) {
+	h := Hop{TTL: 5}
+	h.SetReplyTTL(60)
+	if h.ReplyTTL != 60 || h.ReturnHops != 5 || h.Asymmetric {
+		t.Fatalf("symmetric hop = %+v", h)
+	}
+	// 推算的回程跳数存在误差，相差不超过 AsymmetryTolerance 不算不对称
+	h.SetReplyTTL(58)
+	if h.ReturnHops != 7 || h.Asymmetric {
+		t.Fatalf("hop within tolerance = %+v", h)
+	}
+	h.SetReplyTTL(247)
+	if h.ReturnHops != 9 || !h.Asymmetric {
+		t.Fatalf("asymmetric hop = %+v", h)
+	}
+	h.SetReplyTTL(0)
+	if h.ReturnHops != 0 || h.Asymmetric {
+		t.Fatalf("unknown reply TTL = %+v", h)
+	}
+}
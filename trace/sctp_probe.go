@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"time"
+)
+
+const (
+	sctpChunkInit        = 1
+	sctpParamPadding     = 0x8005 // RFC 4820，未识别时接收方跳过且不报告
+	sctpInitChunkBytes   = 20
+	sctpCommonHeaderSize = 12
+
+	SCTPReplyInitAck = "init-ack"
+	SCTPReplyAbort   = "abort"
+)
+
+var sctpCRC32c = crc32.MakeTable(crc32.Castagnoli)
+
+// sctpInitPacket 生成 SCTP INIT 探测包（不含 IP 头）。
+//
+// INIT 的验证标签必须为 0，因此把 tag（即 seq）写进 Initiate Tag：
+// 目标回的 INIT-ACK 与 ABORT 都以它作为验证标签；ICMP 差错引用够长时也能从中读出。
+// payloadSize 大于 0 时追加 Padding 参数，参数长度补齐到 4 字节
+func sctpInitPacket(srcPort, dstPort int, tag uint32, payloadSize int) []byte {
+	padding := 0
+	if payloadSize > 0 {
+		padding = max(4, (payloadSize+3)/4*4)
+	}
+	b := make([]byte, sctpCommonHeaderSize+sctpInitChunkBytes+padding)
+	binary.BigEndian.PutUint16(b[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(b[2:4], uint16(dstPort))
+
+	chunk := b[sctpCommonHeaderSize:]
+	chunk[0] = sctpChunkInit
+	binary.BigEndian.PutUint16(chunk[2:4], uint16(sctpInitChunkBytes+padding))
+	binary.BigEndian.PutUint32(chunk[4:8], tag)
+	binary.BigEndian.PutUint32(chunk[8:12], 65535) // a_rwnd
+	binary.BigEndian.PutUint16(chunk[12:14], 10)   // outbound streams
+	binary.BigEndian.PutUint16(chunk[14:16], 65535)
+	binary.BigEndian.PutUint32(chunk[16:20], tag) // initial TSN
+	if padding > 0 {
+		binary.BigEndian.PutUint16(chunk[20:22], sctpParamPadding)
+		binary.BigEndian.PutUint16(chunk[22:24], uint16(padding))
+	}
+
+	binary.LittleEndian.PutUint32(b[8:12], crc32.Checksum(b, sctpCRC32c))
+	return b
+}
+
+// sctpQuotedProbe 从 ICMP 差错引用的 SCTP 头取出端口与探测的 Initiate Tag；
+// 引用只有前 8 字节时 tag 为 0，由调用方按源端口匹配
+func sctpQuotedProbe(header []byte) (srcPort, dstPort, tag int, ok bool) {
+	if len(header) < 8 {
+		return 0, 0, 0, false
+	}
+	srcPort = int(binary.BigEndian.Uint16(header[0:2]))
+	dstPort = int(binary.BigEndian.Uint16(header[2:4]))
+	if binary.BigEndian.Uint32(header[4:8]) != 0 {
+		// 探测 INIT 的验证标签恒为 0
+		return 0, 0, 0, false
+	}
+	if len(header) >= sctpCommonHeaderSize+8 && header[sctpCommonHeaderSize] == sctpChunkInit {
+		tag = int(binary.BigEndian.Uint32(header[sctpCommonHeaderSize+4 : sctpCommonHeaderSize+8]))
+	}
+	return srcPort, dstPort, tag, true
+}
+
+// sctpReplyKind 由目标回包的首个 chunk 给出应答类型
+func sctpReplyKind(raw []byte) string {
+	if len(raw) <= sctpCommonHeaderSize {
+		return ""
+	}
+	switch raw[sctpCommonHeaderSize] {
+	case 2:
+		return SCTPReplyInitAck
+	case 6:
+		return SCTPReplyAbort
+	}
+	return ""
+}
+
+// lookupSCTPSentByPort 在引用或 ABORT 不带 tag 时按源端口找出唯一未应答的探测；
+// 多个探测共用源端口时无法区分，放弃匹配
+func lookupSCTPSentByPort(sentAt map[int]sentInfo, srcPort int) (seq int, start time.Time, ok bool) {
+	for candidateSeq, info := range sentAt {
+		if info.srcPort != srcPort {
+			continue
+		}
+		if ok {
+			return 0, time.Time{}, false
+		}
+		seq, start, ok = candidateSeq, info.start, true
+	}
+	return seq, start, ok
+}
+
+// SCTPDestinationReply 汇总目标对 SCTP 探测的应答：init-ack、abort，都没有时为 none
+func (r *Result) SCTPDestinationReply() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	reply := "none"
+	for _, hops := range r.Hops {
+		for _, h := range hops {
+			switch h.SCTPReply {
+			case SCTPReplyInitAck:
+				return SCTPReplyInitAck
+			case SCTPReplyAbort:
+				reply = SCTPReplyAbort
+			}
+		}
+	}
+	return reply
+}
@@ -0,0 +1,116 @@
+package trace
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestSCTPInitPacket(t *testing.T) {
+	tag := uint32(7<<24 | 3)
+	b := sctpInitPacket(40000, 80, tag, 10)
+	// 10 字节负载补齐为 12 字节的 Padding 参数
+	if len(b) != sctpCommonHeaderSize+sctpInitChunkBytes+12 {
+		t.Fatalf("len = %d", len(b))
+	}
+
+	pkt := gopacket.NewPacket(b, layers.LayerTypeSCTP, gopacket.Default)
+	sctp, ok := pkt.Layer(layers.LayerTypeSCTP).(*layers.SCTP)
+	if !ok {
+		t.Fatalf("no SCTP layer: %v", pkt.ErrorLayer())
+	}
+	if sctp.SrcPort != 40000 || sctp.DstPort != 80 || sctp.VerificationTag != 0 {
+		t.Fatalf("header = %+v", sctp)
+	}
+	init, ok := pkt.Layer(layers.LayerTypeSCTPInit).(*layers.SCTPInit)
+	if !ok {
+		t.Fatalf("no INIT chunk: %v", pkt.ErrorLayer())
+	}
+	if init.InitiateTag != tag || init.InitialTSN != tag || init.Length != 32 {
+		t.Fatalf("init = %+v", init)
+	}
+
+	sum := binary.LittleEndian.Uint32(b[8:12])
+	zeroed := append([]byte(nil), b...)
+	copy(zeroed[8:12], []byte{0, 0, 0, 0})
+	if want := crc32.Checksum(zeroed, crc32.MakeTable(crc32.Castagnoli)); sum != want {
+		t.Fatalf("checksum = %#x, want %#x", sum, want)
+	}
+
+	if got := len(sctpInitPacket(40000, 80, tag, 0)); got != sctpCommonHeaderSize+sctpInitChunkBytes {
+		t.Fatalf("bare INIT len = %d", got)
+	}
+}
+
+func TestSCTPQuotedProbe(t *testing.T) {
+	b := sctpInitPacket(40000, 443, 0x05000002, 0)
+	src, dst, tag, ok := sctpQuotedProbe(b)
+	if !ok || src != 40000 || dst != 443 || tag != 0x05000002 {
+		t.Fatalf("full quote = %d %d %#x %v", src, dst, tag, ok)
+	}
+	// 只引用 8 字节时没有 Initiate Tag
+	src, _, tag, ok = sctpQuotedProbe(b[:8])
+	if !ok || src != 40000 || tag != 0 {
+		t.Fatalf("short quote = %d %#x %v", src, tag, ok)
+	}
+	// 验证标签非 0 的不是探测包
+	other := append([]byte(nil), b...)
+	other[7] = 1
+	if _, _, _, ok := sctpQuotedProbe(other); ok {
+		t.Fatal("accepted a quote with a non-zero verification tag")
+	}
+	if _, _, _, ok := sctpQuotedProbe(b[:6]); ok {
+		t.Fatal("accepted a truncated quote")
+	}
+}
+
+func TestSCTPReplyKind(t *testing.T) {
+	reply := make([]byte, 16)
+	reply[12] = 2
+	if got := sctpReplyKind(reply); got != SCTPReplyInitAck {
+		t.Fatalf("INIT-ACK kind = %q", got)
+	}
+	reply[12] = 6
+	if got := sctpReplyKind(reply); got != SCTPReplyAbort {
+		t.Fatalf("ABORT kind = %q", got)
+	}
+	if got := sctpReplyKind(reply[:12]); got != "" {
+		t.Fatalf("header-only kind = %q", got)
+	}
+}
+
+func TestLookupSCTPSentByPort(t *testing.T) {
+	now := time.Now()
+	sentAt := map[int]sentInfo{
+		1<<24 | 0: {srcPort: 40001, start: now},
+		2<<24 | 0: {srcPort: 40002, start: now},
+		2<<24 | 1: {srcPort: 40002, start: now},
+	}
+	if seq, _, ok := lookupSCTPSentByPort(sentAt, 40001); !ok || seq != 1<<24 {
+		t.Fatalf("unique port = %d %v", seq, ok)
+	}
+	if _, _, ok := lookupSCTPSentByPort(sentAt, 40002); ok {
+		t.Fatal("matched a shared source port")
+	}
+	if _, _, ok := lookupSCTPSentByPort(sentAt, 40003); ok {
+		t.Fatal("matched an unknown source port")
+	}
+}
+
+func TestSCTPDestinationReply(t *testing.T) {
+	res := &Result{Hops: [][]Hop{{{TTL: 1}}, {{TTL: 2, SCTPReply: SCTPReplyAbort}}}}
+	if got := res.SCTPDestinationReply(); got != SCTPReplyAbort {
+		t.Fatalf("reply = %q", got)
+	}
+	res.Hops[1] = append(res.Hops[1], Hop{TTL: 2, SCTPReply: SCTPReplyInitAck})
+	if got := res.SCTPDestinationReply(); got != SCTPReplyInitAck {
+		t.Fatalf("reply = %q", got)
+	}
+	if got := (&Result{}).SCTPDestinationReply(); got != "none" {
+		t.Fatalf("empty reply = %q", got)
+	}
+}
@@ -22,7 +22,11 @@ func ResolveSourceDevice(device string) (*net.Interface, error) {
 	if trimmed == "" {
 		return nil, nil
 	}
-	dev, err := lookupSourceDeviceByName(trimmed)
+	var dev *net.Interface
+	err := util.RunInNetNS(func() (err error) {
+		dev, err = lookupSourceDeviceByName(trimmed)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to resolve source device %q: %w", trimmed, err)
 	}
@@ -36,7 +40,11 @@ func ResolveSourceDeviceAddr(dev *net.Interface, dstIP net.IP) (string, error) {
 	if dev == nil || dstIP == nil {
 		return "", nil
 	}
-	addrs, err := loadSourceDeviceAddrs(dev)
+	var addrs []net.Addr
+	err := util.RunInNetNS(func() (err error) {
+		addrs, err = loadSourceDeviceAddrs(dev)
+		return err
+	})
 	if err != nil {
 		return "", fmt.Errorf("load source device %q addresses: %w", dev.Name, err)
 	}
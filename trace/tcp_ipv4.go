@@ -13,6 +13,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"golang.org/x/sync/semaphore"
 
@@ -139,7 +140,7 @@ func (t *TCPTracer) clearPending(seq int) bool {
 func (t *TCPTracer) storeSent(seq, srcPort, payloadSize int, start time.Time) {
 	t.sentMu.Lock()
 	defer t.sentMu.Unlock()
-	t.sentAt[seq] = sentInfo{srcPort: srcPort, payloadSize: payloadSize, start: start}
+	t.sentAt[seq] = sentInfo{srcPort: srcPort, payloadSize: payloadSize, tcpFlags: t.TCPProbe.flags(), start: start}
 }
 
 func (t *TCPTracer) lookupSent(seq int) (srcPort int, start time.Time, ok bool) {
@@ -164,12 +165,13 @@ func (t *TCPTracer) dropSent(seq int) {
 	delete(t.sentAt, seq)
 }
 
-func (t *TCPTracer) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duration, mpls []string) {
+func (t *TCPTracer) addHopWithIndex(h Hop, i int) {
+	ttl := h.TTL
 	if f := t.final.Load(); f != -1 && ttl > int(f) {
 		return
 	}
 
-	if ip := util.AddrIP(peer); ip != nil && ip.Equal(t.DstIP) {
+	if ip := util.AddrIP(h.Address); ip != nil && ip.Equal(t.DstIP) {
 		for {
 			old := t.final.Load()
 			if old != -1 && ttl >= int(old) {
@@ -181,13 +183,6 @@ func (t *TCPTracer) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duration
 		}
 	}
 
-	h := Hop{
-		Success: true,
-		Address: peer,
-		TTL:     ttl,
-		RTT:     rtt,
-		MPLS:    mpls,
-	}
 	t.res.addWithGeoAsync(h, i, t.NumMeasurements, t.MaxAttempts, t.Config)
 }
 
@@ -225,7 +220,12 @@ func (t *TCPTracer) matchWorker(ctx context.Context) {
 			} else {
 				srcPort, start, matched = t.lookupSent(task.seq)
 			}
-			if !matched || task.srcPort != srcPort {
+			if !matched {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionNoProbe)
+				continue
+			}
+			if task.srcPort != srcPort {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionSrcPort)
 				continue
 			}
 
@@ -240,7 +240,10 @@ func (t *TCPTracer) matchWorker(ctx context.Context) {
 
 			if t.clearPending(task.seq) {
 				rtt := task.finish.Sub(start)
-				t.addHopWithIndex(task.peer, ttl, i, rtt, task.mpls)
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, matchedDecision(ttl, i, rtt))
+				t.addHopWithIndex(task.hop(ttl, rtt), i)
+			} else {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, lateDecision(ttl, i))
 			}
 			t.dropSent(task.seq)
 		}
@@ -285,6 +288,7 @@ func (t *TCPTracer) Execute() (res *Result, err error) {
 		t.PktSize,
 	)
 	s.SourceDevice = t.SourceDevice
+	s.OnDiscard = t.Capture.discardFunc(t.SrcIP)
 
 	s.InitICMP()
 	s.InitTCP()
@@ -314,14 +318,16 @@ func (t *TCPTracer) Execute() (res *Result, err error) {
 	t.wg.Add(1)
 	go func() {
 		defer t.wg.Done()
-		s.ListenTCP(ctx, t.readyTCP, func(srcPort, seq, ack int, peer net.Addr, finish time.Time) {
+		s.ListenTCP(ctx, t.readyTCP, func(srcPort, seq, ack int, msg internal.ReceivedMessage, finish time.Time) {
 			// 非阻塞投递，队列满则丢弃任务
 			select {
 			case t.matchQ <- matchTask{
-				srcPort: srcPort, seq: seq, ack: ack, peer: peer, finish: finish, mpls: nil,
+				srcPort: srcPort, seq: seq, ack: ack, peer: msg.Peer, finish: finish, mpls: nil,
+				proto: layers.IPProtocolTCP, raw: msg.Msg, replyTTL: msg.TTL,
 			}:
 			default:
 				// 丢弃以避免阻塞抓包循环
+				t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolTCP, msg.TTL, msg.Msg, decisionQueueFull)
 			}
 		})
 	}()
@@ -374,20 +380,24 @@ func (t *TCPTracer) handleICMPMessage(msg internal.ReceivedMessage, finish time.
 
 	header, err := util.GetICMPResponsePayload(data)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
 	srcPort, dstPort, err := util.GetTCPPorts(header)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
 	if dstPort != t.DstPort {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, dstPortDecision(dstPort))
 		return
 	}
 
 	seq, err := util.GetTCPSeq(header)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
@@ -395,9 +405,11 @@ func (t *TCPTracer) handleICMPMessage(msg internal.ReceivedMessage, finish time.
 	select {
 	case t.matchQ <- matchTask{
 		srcPort: srcPort, seq: seq, peer: msg.Peer, finish: finish, mpls: mpls,
+		proto: layers.IPProtocolICMPv4, raw: msg.Msg, replyTTL: msg.TTL,
 	}:
 	default:
 		// 丢弃以避免阻塞抓包循环
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionQueueFull)
 	}
 }
 
@@ -442,18 +454,9 @@ func (t *TCPTracer) send(ctx context.Context, s *internal.TCPSpec, ttl, i int) e
 		TOS:      uint8(t.TOS),
 	}
 
-	tcpHeader := &layers.TCP{
-		SrcPort: layers.TCPPort(SrcPort),
-		DstPort: layers.TCPPort(t.DstPort),
-		Seq:     uint32(seq),
-		SYN:     true,
-		Window:  65535,
-		Options: []layers.TCPOption{
-			{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}}, // MSS=1460
-		},
-	}
+	tcpHeader := t.TCPProbe.header(SrcPort, t.DstPort, seq, 1460) // 默认 MSS=1460
 
-	desiredPayloadSize := resolveProbePayloadSize(TCPTrace, t.DstIP, t.PktSize, t.RandomPacketSize)
+	desiredPayloadSize := t.TCPProbe.payloadSize(resolveProbePayloadSize(TCPTrace, t.DstIP, t.PktSize, t.RandomPacketSize))
 	payload := make([]byte, desiredPayloadSize)
 
 	// 设置随机种子
@@ -497,5 +500,6 @@ func (t *TCPTracer) send(ctx context.Context, s *internal.TCPSpec, ttl, i int) e
 		return err
 	}
 	t.storeSent(seq, SrcPort, desiredPayloadSize, start)
+	t.Capture.probe(start, ttl, i, ipHeader, tcpHeader, gopacket.Payload(payload))
 	return nil
 }
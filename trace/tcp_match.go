@@ -11,7 +11,7 @@ func lookupTCPSentByAck(sentAt map[int]sentInfo, srcPort, ack int) (seq int, sta
 		if info.srcPort != srcPort {
 			continue
 		}
-		if tcpReplyAckForProbe(candidateSeq, info.payloadSize) != ack {
+		if info.replyAck(candidateSeq) != ack {
 			continue
 		}
 		return candidateSeq, info.start, true
@@ -0,0 +1,228 @@
+package trace
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// TCPProbeFlags 为 TCP 探测包携带的控制位组合
+type TCPProbeFlags string
+
+const (
+	TCPProbeSYN  TCPProbeFlags = "syn"
+	TCPProbeACK  TCPProbeFlags = "ack"
+	TCPProbeFIN  TCPProbeFlags = "fin"
+	TCPProbeNULL TCPProbeFlags = "null"
+)
+
+// TCPProbeFlagNames 为可选的探测控制位
+var TCPProbeFlagNames = []string{
+	string(TCPProbeSYN),
+	string(TCPProbeACK),
+	string(TCPProbeFIN),
+	string(TCPProbeNULL),
+}
+
+// TCPProbeOptionNames 为可选的 TCP 选项，发送时按此顺序排列
+var TCPProbeOptionNames = []string{"mss", "sack", "ts", "wscale", "tfo"}
+
+const (
+	tcpOptionKindTFO = 34 // RFC 7413 Fast Open Cookie
+
+	TCPReplySynAck = "syn-ack"
+	TCPReplyRST    = "rst"
+)
+
+// TCPProbeProfile 描述 TCP 探测包的形态。零值即原来的探测：只带 MSS 选项的 SYN。
+//
+// 各种形态仍按 seq 匹配：ICMP 差错引用的 TCP 头前 8 字节里有 seq；
+// SYN 与 FIN 的 RST/ACK 确认号为 seq+载荷+1，NULL 的为 seq+载荷；
+// ACK 探测的确认号也写入 seq，目标回的 RST 以它为序号。
+type TCPProbeProfile struct {
+	Flags TCPProbeFlags
+	// Options 为要携带的选项名；nil 表示默认的 MSS，空切片表示不带选项
+	Options []string
+	// ECN 置 ECE 与 CWR 位，配合 SYN 即 RFC 3168 的 ECN-setup SYN
+	ECN bool
+}
+
+// ParseTCPProbeProfile 解析控制位名与逗号分隔的选项列表；选项为 "none" 时不带任何选项
+func ParseTCPProbeProfile(flags, options string, ecn bool) (TCPProbeProfile, error) {
+	var p TCPProbeProfile
+	name := strings.ToLower(strings.TrimSpace(flags))
+	if name != "" {
+		if !util.StringInSlice(name, TCPProbeFlagNames) {
+			return TCPProbeProfile{}, fmt.Errorf("unsupported tcp flags %q; choose one of %s", flags, strings.Join(TCPProbeFlagNames, ", "))
+		}
+		p.Flags = TCPProbeFlags(name)
+	}
+	p.ECN = ecn
+
+	options = strings.ToLower(strings.TrimSpace(options))
+	switch options {
+	case "":
+		return p, nil
+	case "none":
+		p.Options = []string{}
+		return p, nil
+	}
+	seen := map[string]bool{}
+	for _, opt := range strings.Split(options, ",") {
+		opt = strings.TrimSpace(opt)
+		if !util.StringInSlice(opt, TCPProbeOptionNames) {
+			return TCPProbeProfile{}, fmt.Errorf("unsupported tcp option %q; choose from %s or none", opt, strings.Join(TCPProbeOptionNames, ", "))
+		}
+		seen[opt] = true
+	}
+	p.Options = []string{}
+	for _, opt := range TCPProbeOptionNames {
+		if seen[opt] {
+			p.Options = append(p.Options, opt)
+		}
+	}
+	return p, nil
+}
+
+// IsDefault 报告是否为原来的 SYN+MSS 探测
+func (p TCPProbeProfile) IsDefault() bool {
+	return p.flags() == TCPProbeSYN && p.Options == nil && !p.ECN
+}
+
+// String 形如 "syn mss,ts,wscale ecn"，用于导航行与导出元数据
+func (p TCPProbeProfile) String() string {
+	parts := []string{string(p.flags())}
+	switch {
+	case p.Options == nil:
+		parts = append(parts, "mss")
+	case len(p.Options) == 0:
+		parts = append(parts, "no-options")
+	default:
+		parts = append(parts, strings.Join(p.Options, ","))
+	}
+	if p.ECN {
+		parts = append(parts, "ecn")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (p TCPProbeProfile) flags() TCPProbeFlags {
+	if p.Flags == "" {
+		return TCPProbeSYN
+	}
+	return p.Flags
+}
+
+func (p TCPProbeProfile) optionNames() []string {
+	if p.Options == nil {
+		return []string{"mss"}
+	}
+	return p.Options
+}
+
+// tcpOptions 生成探测包的选项，mss 为按地址族取的默认 MSS
+func (p TCPProbeProfile) tcpOptions(mss uint16) []layers.TCPOption {
+	var opts []layers.TCPOption
+	for _, name := range p.optionNames() {
+		switch name {
+		case "mss":
+			opts = append(opts, layers.TCPOption{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: binary.BigEndian.AppendUint16(nil, mss)})
+		case "sack":
+			opts = append(opts, layers.TCPOption{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2})
+		case "ts":
+			ts := binary.BigEndian.AppendUint32(nil, uint32(time.Now().UnixMilli()))
+			opts = append(opts, layers.TCPOption{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: append(ts, 0, 0, 0, 0)})
+		case "wscale":
+			opts = append(opts,
+				layers.TCPOption{OptionType: layers.TCPOptionKindNop, OptionLength: 1},
+				layers.TCPOption{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}})
+		case "tfo":
+			// 不带 cookie 即向服务器请求 cookie
+			opts = append(opts, layers.TCPOption{OptionType: tcpOptionKindTFO, OptionLength: 2})
+		}
+	}
+	return opts
+}
+
+// headerBytes 为 TCP 头加选项（补齐到 4 字节）的长度
+func (p TCPProbeProfile) headerBytes() int {
+	n := 0
+	for _, opt := range p.tcpOptions(0) {
+		n += int(opt.OptionLength)
+	}
+	return 20 + (n+3)/4*4
+}
+
+// payloadSize 扣除选项超出默认 MSS 的部分，使 --psize 仍为整包大小
+func (p TCPProbeProfile) payloadSize(size int) int {
+	return max(0, size+tcpProbeHeaderBytes-p.headerBytes())
+}
+
+// header 按 profile 生成探测包的 TCP 头
+func (p TCPProbeProfile) header(srcPort, dstPort, seq int, mss uint16) *layers.TCP {
+	h := &layers.TCP{
+		SrcPort: layers.TCPPort(srcPort),
+		DstPort: layers.TCPPort(dstPort),
+		Seq:     uint32(seq),
+		Window:  65535,
+		Options: p.tcpOptions(mss),
+		ECE:     p.ECN,
+		CWR:     p.ECN,
+	}
+	switch p.flags() {
+	case TCPProbeSYN:
+		h.SYN = true
+	case TCPProbeACK:
+		h.ACK = true
+		h.Ack = uint32(seq)
+	case TCPProbeFIN:
+		h.FIN = true
+	}
+	return h
+}
+
+// replyAck 为目标以 RST/ACK 应答该探测时的确认号；ACK 与 NULL 探测不占用额外序号
+func (si sentInfo) replyAck(seq int) int {
+	ack := tcpReplyAckForProbe(seq, si.payloadSize)
+	if si.tcpFlags == TCPProbeACK || si.tcpFlags == TCPProbeNULL {
+		ack--
+	}
+	return ack
+}
+
+// tcpReplyKind 由目标回包的 TCP 头给出应答类型
+func tcpReplyKind(raw []byte) string {
+	if len(raw) < 14 {
+		return ""
+	}
+	switch flags := raw[13]; {
+	case flags&0x04 != 0:
+		return TCPReplyRST
+	case flags&0x12 == 0x12:
+		return TCPReplySynAck
+	}
+	return ""
+}
+
+// TCPDestinationReply 汇总目标对 TCP 探测的应答：syn-ack、rst，都没有时为 none
+func (r *Result) TCPDestinationReply() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	reply := "none"
+	for _, hops := range r.Hops {
+		for _, h := range hops {
+			switch h.TCPReply {
+			case TCPReplySynAck:
+				return TCPReplySynAck
+			case TCPReplyRST:
+				reply = TCPReplyRST
+			}
+		}
+	}
+	return reply
+}
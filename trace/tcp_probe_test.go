@@ -0,0 +1,111 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestParseTCPProbeProfile(t *testing.T) {
+	p, err := ParseTCPProbeProfile("", "", false)
+	if err != nil || !p.IsDefault() || p.String() != "syn mss" {
+		t.Fatalf("default = %+v %q %v", p, p.String(), err)
+	}
+	p, err = ParseTCPProbeProfile("ACK", "wscale, mss,ts", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Flags != TCPProbeACK || p.String() != "ack mss,ts,wscale ecn" {
+		t.Fatalf("profile = %q", p.String())
+	}
+	p, err = ParseTCPProbeProfile("null", "none", false)
+	if err != nil || p.Options == nil || len(p.Options) != 0 || p.IsDefault() {
+		t.Fatalf("none = %+v %v", p, err)
+	}
+	if _, err := ParseTCPProbeProfile("xmas", "", false); err == nil {
+		t.Fatal("unknown flags accepted")
+	}
+	if _, err := ParseTCPProbeProfile("", "mss,md5", false); err == nil {
+		t.Fatal("unknown option accepted")
+	}
+}
+
+func TestTCPProbeProfileHeader(t *testing.T) {
+	all, _ := ParseTCPProbeProfile("syn", "mss,sack,ts,wscale,tfo", true)
+	h := all.header(40000, 443, 5<<24|1, 1460)
+	if !h.SYN || h.ACK || !h.ECE || !h.CWR || h.Seq != 5<<24|1 {
+		t.Fatalf("header flags = %+v", h)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := h.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(buf.Bytes()); got != all.headerBytes() || got != 44 {
+		t.Fatalf("header = %d bytes, headerBytes() = %d", got, all.headerBytes())
+	}
+	parsed := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeTCP, gopacket.Default).Layer(layers.LayerTypeTCP).(*layers.TCP)
+	var kinds []layers.TCPOptionKind
+	for _, opt := range parsed.Options {
+		if opt.OptionType != layers.TCPOptionKindNop && opt.OptionType != layers.TCPOptionKindEndList {
+			kinds = append(kinds, opt.OptionType)
+		}
+	}
+	want := []layers.TCPOptionKind{layers.TCPOptionKindMSS, layers.TCPOptionKindSACKPermitted, layers.TCPOptionKindTimestamps, layers.TCPOptionKindWindowScale, tcpOptionKindTFO}
+	if len(kinds) != len(want) {
+		t.Fatalf("options = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("options = %v, want %v", kinds, want)
+		}
+	}
+
+	ack := TCPProbeProfile{Flags: TCPProbeACK}.header(40000, 443, 7<<24, 1460)
+	if !ack.ACK || ack.SYN || ack.Ack != ack.Seq {
+		t.Fatalf("ack probe = %+v", ack)
+	}
+	null := TCPProbeProfile{Flags: TCPProbeNULL, Options: []string{}}.header(40000, 443, 7<<24, 1460)
+	if null.SYN || null.ACK || null.FIN || len(null.Options) != 0 {
+		t.Fatalf("null probe = %+v", null)
+	}
+
+	if got := (TCPProbeProfile{}).payloadSize(10); got != 10 {
+		t.Fatalf("default payloadSize = %d", got)
+	}
+	if got := all.payloadSize(10); got != 0 {
+		t.Fatalf("payloadSize with options = %d, want 0", got)
+	}
+}
+
+func TestLookupTCPSentByAckPerFlags(t *testing.T) {
+	start := time.Unix(10, 0)
+	for flags, ackOffset := range map[TCPProbeFlags]int{TCPProbeSYN: 21, TCPProbeFIN: 21, TCPProbeNULL: 20} {
+		sentAt := map[int]sentInfo{300: {srcPort: 40000, payloadSize: 20, tcpFlags: flags, start: start}}
+		if seq, _, ok := lookupTCPSentByAck(sentAt, 40000, 300+ackOffset); !ok || seq != 300 {
+			t.Errorf("%s: seq=%d ok=%v", flags, seq, ok)
+		}
+	}
+}
+
+func TestTCPReplyKindAndDestinationReply(t *testing.T) {
+	raw := make([]byte, 20)
+	raw[13] = 0x12
+	if got := tcpReplyKind(raw); got != TCPReplySynAck {
+		t.Fatalf("SYN-ACK = %q", got)
+	}
+	raw[13] = 0x04
+	if got := tcpReplyKind(raw); got != TCPReplyRST {
+		t.Fatalf("RST = %q", got)
+	}
+
+	res := &Result{Hops: [][]Hop{{{Success: true}}, {{Success: false}}}}
+	if got := res.TCPDestinationReply(); got != "none" {
+		t.Fatalf("no answer = %q", got)
+	}
+	res.Hops[1] = []Hop{{Success: true, TCPReply: TCPReplyRST}, {Success: true, TCPReply: TCPReplySynAck}}
+	if got := res.TCPDestinationReply(); got != TCPReplySynAck {
+		t.Fatalf("answer = %q", got)
+	}
+}
@@ -0,0 +1,282 @@
+package trace
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// ECN 码点（RFC 3168），取 TOS / Traffic Class 的低 2 位
+const (
+	ECNNotECT = 0
+	ECNECT1   = 1
+	ECNECT0   = 2
+	ECNCE     = 3
+)
+
+// ECNNames 为 --ecn 可选的码点名
+var ECNNames = []string{"not-ect", "ect0", "ect1", "ce"}
+
+var ecnByName = map[string]int{"not-ect": ECNNotECT, "ect0": ECNECT0, "ect1": ECNECT1, "ce": ECNCE}
+
+// dscpByName 为常用的 DSCP 名：CSx（RFC 2474）、AFxy（RFC 2597）、EF（RFC 3246）、
+// VOICE-ADMIT（RFC 5865）与 LE（RFC 8622）
+var dscpByName = map[string]int{
+	"cs0": 0, "cs1": 8, "cs2": 16, "cs3": 24, "cs4": 32, "cs5": 40, "cs6": 48, "cs7": 56,
+	"af11": 10, "af12": 12, "af13": 14,
+	"af21": 18, "af22": 20, "af23": 22,
+	"af31": 26, "af32": 28, "af33": 30,
+	"af41": 34, "af42": 36, "af43": 38,
+	"ef": 46, "va": 44, "le": 1,
+}
+
+// ParseDSCP 解析 DSCP 名（ef、af41、cs1 等）或 0-63 的数值
+func ParseDSCP(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := dscpByName[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > 63 {
+		return 0, fmt.Errorf("unsupported dscp %q; use a name such as ef, af41, cs1 or a value 0-63", s)
+	}
+	return v, nil
+}
+
+// ParseECN 解析 ECN 码点名：not-ect、ect0、ect1、ce
+func ParseECN(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if !util.StringInSlice(s, ECNNames) {
+		return 0, fmt.Errorf("unsupported ecn codepoint %q; choose one of %s", s, strings.Join(ECNNames, ", "))
+	}
+	return ecnByName[s], nil
+}
+
+// DSCPName 形如 "EF (46)"，没有名字的值只给数值
+func DSCPName(dscp int) string {
+	// 同一数值只有一个名字，按固定顺序查找以保证输出稳定
+	for _, name := range []string{"cs0", "le", "cs1", "af11", "af12", "af13", "cs2", "af21", "af22", "af23", "cs3", "af31", "af32", "af33",
+		"cs4", "af41", "af42", "af43", "cs5", "va", "ef", "cs6", "cs7"} {
+		if dscpByName[name] == dscp {
+			return fmt.Sprintf("%s (%d)", strings.ToUpper(name), dscp)
+		}
+	}
+	return strconv.Itoa(dscp)
+}
+
+// ECNName 为码点的常用写法
+func ECNName(ecn int) string {
+	switch ecn {
+	case ECNECT0:
+		return "ECT(0)"
+	case ECNECT1:
+		return "ECT(1)"
+	case ECNCE:
+		return "CE"
+	}
+	return "Not-ECT"
+}
+
+// quotedTOS 从 ICMP 差错报文引用的原始 IP 头取出 TOS / Traffic Class；
+// 回显应答、TCP 回包等不带引用的报文返回 nil
+func quotedTOS(proto layers.IPProtocol, raw []byte) *uint8 {
+	if len(raw) < 8 {
+		return nil
+	}
+	switch proto {
+	case layers.IPProtocolICMPv4:
+		switch raw[0] {
+		case 3, 4, 5, 11, 12:
+		default:
+			return nil
+		}
+	case layers.IPProtocolICMPv6:
+		// 类型 1-4 为差错报文
+		if raw[0] < 1 || raw[0] > 4 {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return quotedIPTOS(raw[8:])
+}
+
+// quotedIPTOS 读取引用的 IP 头中的 TOS（IPv4）或 Traffic Class（IPv6）
+func quotedIPTOS(quote []byte) *uint8 {
+	if len(quote) < 2 {
+		return nil
+	}
+	var tos uint8
+	switch quote[0] >> 4 {
+	case 4:
+		tos = quote[1]
+	case 6:
+		tos = quote[0]<<4 | quote[1]>>4
+	default:
+		return nil
+	}
+	return &tos
+}
+
+// 各跳 DSCP 与 ECN 的状态
+const (
+	TOSKept      = "kept"
+	TOSRemarked  = "remarked"
+	TOSBleached  = "bleached"
+	ECNCleared   = "cleared"
+	ECNCongested = "ce"
+	ECNChanged   = "changed"
+)
+
+// TOSHopCheck 为一跳的检查结果。Address 为空表示该跳无应答；
+// Quoted 为 false 表示有应答但不带引用（如目标的回显应答），无从判断
+type TOSHopCheck struct {
+	TTL     int
+	Address string
+	Quoted  bool
+	// Destination 表示应答来自目标
+	Destination bool
+	DSCP        int
+	ECN         int
+	DSCPStatus  string
+	ECNStatus   string
+}
+
+// TOSReport 为整条路径的 DSCP / ECN 透传检查。
+// 路由器引用的是它收到的探测包，因此某跳的引用与发送值不同，
+// 说明改写发生在该跳或其之前、上一个有引用的跳之后
+type TOSReport struct {
+	SentDSCP int
+	SentECN  int
+	Hops     []TOSHopCheck
+	// DSCPChangedAt / ECNChangedAt 为首次看到改变的跳，0 表示未见改变
+	DSCPChangedAt int
+	ECNChangedAt  int
+	// LastQuoted 为最后一个带引用的跳，Reached 表示目标有应答
+	LastQuoted int
+	Reached    bool
+	Verdict    []string
+}
+
+// AnalyzeTOS 对照发送的 TOS 检查各跳引用中的 DSCP 与 ECN
+func AnalyzeTOS(res *Result, dst net.IP, sentTOS int) TOSReport {
+	r := TOSReport{SentDSCP: sentTOS >> 2, SentECN: sentTOS & 0x03}
+	res.lock.RLock()
+	for idx, hops := range res.Hops {
+		c := TOSHopCheck{TTL: idx + 1}
+		for _, h := range hops {
+			if !h.Success || h.Address == nil {
+				continue
+			}
+			if c.Address == "" {
+				c.Address = h.Address.String()
+			}
+			if ip := util.AddrIP(h.Address); ip != nil && ip.Equal(dst) {
+				c.Destination = true
+				r.Reached = true
+			}
+			if h.QuotedTOS != nil && !c.Quoted {
+				c.Address = h.Address.String()
+				c.Quoted = true
+				c.DSCP = int(*h.QuotedTOS >> 2)
+				c.ECN = int(*h.QuotedTOS & 0x03)
+			}
+		}
+		if c.Quoted {
+			c.DSCPStatus = dscpStatus(r.SentDSCP, c.DSCP)
+			c.ECNStatus = ecnStatus(r.SentECN, c.ECN)
+			if c.DSCPStatus != TOSKept && r.DSCPChangedAt == 0 {
+				r.DSCPChangedAt = c.TTL
+			}
+			if c.ECNStatus != TOSKept && r.ECNChangedAt == 0 {
+				r.ECNChangedAt = c.TTL
+			}
+			r.LastQuoted = c.TTL
+		}
+		r.Hops = append(r.Hops, c)
+	}
+	res.lock.RUnlock()
+	r.Verdict = r.verdict()
+	return r
+}
+
+func dscpStatus(sent, quoted int) string {
+	switch {
+	case quoted == sent:
+		return TOSKept
+	case quoted == 0:
+		return TOSBleached
+	}
+	return TOSRemarked
+}
+
+func ecnStatus(sent, quoted int) string {
+	switch {
+	case quoted == sent:
+		return TOSKept
+	case quoted == ECNNotECT:
+		return ECNCleared
+	case quoted == ECNCE:
+		return ECNCongested
+	}
+	return ECNChanged
+}
+
+func (r TOSReport) hop(ttl int) TOSHopCheck {
+	return r.Hops[ttl-1]
+}
+
+// preservedThrough 描述未见改变时检查覆盖的范围
+func (r TOSReport) preservedThrough() string {
+	if r.hop(r.LastQuoted).Destination {
+		return "end-to-end"
+	}
+	return fmt.Sprintf("through hop %d", r.LastQuoted)
+}
+
+func (r TOSReport) verdict() []string {
+	if r.LastQuoted == 0 {
+		return []string{"no hop quoted the probe; DSCP and ECN could not be checked"}
+	}
+	var lines []string
+	sentDSCP := DSCPName(r.SentDSCP)
+	if r.DSCPChangedAt == 0 {
+		lines = append(lines, fmt.Sprintf("DSCP %s preserved %s", sentDSCP, r.preservedThrough()))
+	} else {
+		h := r.hop(r.DSCPChangedAt)
+		lines = append(lines, fmt.Sprintf("DSCP %s %s to %s at hop %d (%s)", sentDSCP, h.DSCPStatus, DSCPName(h.DSCP), h.TTL, h.Address))
+	}
+	sentECN := ECNName(r.SentECN)
+	if r.ECNChangedAt == 0 {
+		lines = append(lines, fmt.Sprintf("ECN %s preserved %s", sentECN, r.preservedThrough()))
+	} else {
+		h := r.hop(r.ECNChangedAt)
+		switch h.ECNStatus {
+		case ECNCongested:
+			lines = append(lines, fmt.Sprintf("ECN %s marked CE (congestion) at hop %d (%s)", sentECN, h.TTL, h.Address))
+		case ECNCleared:
+			lines = append(lines, fmt.Sprintf("ECN %s cleared at hop %d (%s)", sentECN, h.TTL, h.Address))
+		default:
+			lines = append(lines, fmt.Sprintf("ECN %s changed to %s at hop %d (%s)", sentECN, ECNName(h.ECN), h.TTL, h.Address))
+		}
+	}
+	if r.Reached {
+		if !r.hop(r.LastQuoted).Destination {
+			lines = append(lines, fmt.Sprintf("destination reached; its reply carries no quotation, so hops after %d are unchecked", r.LastQuoted))
+		}
+	} else {
+		last := 0
+		for _, h := range r.Hops {
+			if h.Address != "" {
+				last = h.TTL
+			}
+		}
+		lines = append(lines, fmt.Sprintf("destination not reached; last reply at hop %d, marked probes may be dropped beyond it", last))
+	}
+	return lines
+}
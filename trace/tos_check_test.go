@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestParseDSCPAndECN(t *testing.T) {
+	for in, want := range map[string]int{"ef": 46, "AF41": 34, "cs1": 8, "le": 1, "63": 63, "0": 0} {
+		if got, err := ParseDSCP(in); err != nil || got != want {
+			t.Fatalf("ParseDSCP(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"64", "-1", "af44", ""} {
+		if _, err := ParseDSCP(bad); err == nil {
+			t.Fatalf("ParseDSCP(%q) accepted", bad)
+		}
+	}
+	if got, err := ParseECN("ECT0"); err != nil || got != ECNECT0 {
+		t.Fatalf("ParseECN(ect0) = %d, %v", got, err)
+	}
+	if _, err := ParseECN("ect2"); err == nil {
+		t.Fatal("ParseECN accepted ect2")
+	}
+	if DSCPName(46) != "EF (46)" || DSCPName(0) != "CS0 (0)" || DSCPName(7) != "7" {
+		t.Fatalf("DSCPName = %q %q %q", DSCPName(46), DSCPName(0), DSCPName(7))
+	}
+}
+
+func TestQuotedTOS(t *testing.T) {
+	// ICMPv4 time exceeded quoting an IPv4 header with TOS 0xb8 (EF, Not-ECT)
+	v4 := append([]byte{11, 0, 0, 0, 0, 0, 0, 0}, 0x45, 0xb8, 0, 28)
+	if got := quotedTOS(layers.IPProtocolICMPv4, v4); got == nil || *got != 0xb8 {
+		t.Fatalf("v4 quoted tos = %v", got)
+	}
+	// ICMPv6 time exceeded quoting an IPv6 header with traffic class 0xba (EF, ECT(0))
+	v6 := append([]byte{3, 0, 0, 0, 0, 0, 0, 0}, 0x6b, 0xa0, 0, 0)
+	if got := quotedTOS(layers.IPProtocolICMPv6, v6); got == nil || *got != 0xba {
+		t.Fatalf("v6 quoted tos = %v", got)
+	}
+	echoReply := []byte{0, 0, 0, 0, 0, 1, 0, 1, 0x45, 0xb8}
+	if got := quotedTOS(layers.IPProtocolICMPv4, echoReply); got != nil {
+		t.Fatalf("echo reply quoted tos = %d", *got)
+	}
+	if got := quotedTOS(layers.IPProtocolTCP, v4); got != nil {
+		t.Fatalf("tcp reply quoted tos = %d", *got)
+	}
+}
+
+func tosHop(ttl int, ip string, tos int) Hop {
+	h := Hop{Success: true, TTL: ttl, Address: &net.IPAddr{IP: net.ParseIP(ip)}}
+	if tos >= 0 {
+		q := uint8(tos)
+		h.QuotedTOS = &q
+	}
+	return h
+}
+
+func TestAnalyzeTOS(t *testing.T) {
+	dst := net.ParseIP("198.51.100.9")
+	sent := 46<<2 | ECNECT0
+	res := &Result{Hops: [][]Hop{
+		{tosHop(1, "192.0.2.1", sent)},
+		{{TTL: 2}},
+		{tosHop(3, "192.0.2.3", 10<<2|ECNECT0)},
+		{tosHop(4, "192.0.2.4", 0)},
+		{tosHop(5, "198.51.100.9", -1)},
+	}}
+	r := AnalyzeTOS(res, dst, sent)
+	if r.SentDSCP != 46 || r.SentECN != ECNECT0 || len(r.Hops) != 5 {
+		t.Fatalf("report = %+v", r)
+	}
+	if r.Hops[1].Address != "" || r.Hops[4].Quoted || !r.Hops[4].Destination {
+		t.Fatalf("hops = %+v", r.Hops)
+	}
+	if r.Hops[2].DSCPStatus != TOSRemarked || r.Hops[2].ECNStatus != TOSKept {
+		t.Fatalf("hop 3 = %+v", r.Hops[2])
+	}
+	if r.Hops[3].DSCPStatus != TOSBleached || r.Hops[3].ECNStatus != ECNCleared {
+		t.Fatalf("hop 4 = %+v", r.Hops[3])
+	}
+	if r.DSCPChangedAt != 3 || r.ECNChangedAt != 4 || r.LastQuoted != 4 || !r.Reached {
+		t.Fatalf("summary = %+v", r)
+	}
+	want := []string{
+		"DSCP EF (46) remarked to AF11 (10) at hop 3 (192.0.2.3)",
+		"ECN ECT(0) cleared at hop 4 (192.0.2.4)",
+		"destination reached; its reply carries no quotation, so hops after 4 are unchecked",
+	}
+	if strings.Join(r.Verdict, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("verdict = %q", r.Verdict)
+	}
+}
+
+func TestAnalyzeTOSPreservedAndDropped(t *testing.T) {
+	dst := net.ParseIP("198.51.100.9")
+	sent := 34<<2 | ECNECT1
+	res := &Result{Hops: [][]Hop{
+		{tosHop(1, "192.0.2.1", sent)},
+		{tosHop(2, "198.51.100.9", sent)},
+	}}
+	r := AnalyzeTOS(res, dst, sent)
+	if strings.Join(r.Verdict, "\n") != "DSCP AF41 (34) preserved end-to-end\nECN ECT(1) preserved end-to-end" {
+		t.Fatalf("verdict = %q", r.Verdict)
+	}
+
+	res = &Result{Hops: [][]Hop{
+		{tosHop(1, "192.0.2.1", sent|ECNCE)},
+		{{TTL: 2}},
+	}}
+	r = AnalyzeTOS(res, dst, sent)
+	want := "DSCP AF41 (34) preserved through hop 1\nECN ECT(1) marked CE (congestion) at hop 1 (192.0.2.1)\n" +
+		"destination not reached; last reply at hop 1, marked probes may be dropped beyond it"
+	if strings.Join(r.Verdict, "\n") != want {
+		t.Fatalf("verdict = %q", r.Verdict)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/gopacket/layers"
 	"golang.org/x/net/idna"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/sync/singleflight"
@@ -45,7 +46,10 @@ type Config struct {
 	Timeout          time.Duration
 	DstIP            net.IP
 	DstPort          int
+	UDPPayload       UDPPayloadProfile
+	// Deprecated: 设置 UDPPayload 为 UDPPayloadQUIC。仅在 UDPPayload 为空时生效
 	Quic             bool
+	TCPProbe         TCPProbeProfile
 	IPGeoSource      ipgeo.Source
 	GeoLookupOffset  int
 	RDNS             bool
@@ -59,8 +63,10 @@ type Config struct {
 	PktSize          int
 	RandomPacketSize bool
 	TOS              int
+	IPv6             IPv6Options
 	Maptrace         bool
 	DisableMPLS      bool
+	Capture          *PacketCapture
 }
 
 type Method string
@@ -69,6 +75,7 @@ const (
 	ICMPTrace Method = "icmp"
 	UDPTrace  Method = "udp"
 	TCPTrace  Method = "tcp"
+	SCTPTrace Method = "sctp"
 )
 
 type attemptKey struct {
@@ -86,6 +93,7 @@ type sentInfo struct {
 	i           int
 	srcPort     int
 	payloadSize int
+	tcpFlags    TCPProbeFlags
 	start       time.Time
 }
 
@@ -96,6 +104,30 @@ type matchTask struct {
 	peer    net.Addr
 	finish  time.Time
 	mpls    []string
+	proto   layers.IPProtocol
+	raw     []byte
+	// replyTTL 为回包到达时的 TTL / Hop Limit，0 表示未知
+	replyTTL int
+}
+
+// hop 由匹配上的回包生成该跳记录
+func (task matchTask) hop(ttl int, rtt time.Duration) Hop {
+	h := Hop{
+		Success:   true,
+		Address:   task.peer,
+		TTL:       ttl,
+		RTT:       rtt,
+		MPLS:      task.mpls,
+		QuotedTOS: quotedTOS(task.proto, task.raw),
+	}
+	switch task.proto {
+	case layers.IPProtocolTCP:
+		h.TCPReply = tcpReplyKind(task.raw)
+	case layers.IPProtocolSCTP:
+		h.SCTPReply = sctpReplyKind(task.raw)
+	}
+	h.SetReplyTTL(task.replyTTL)
+	return h
 }
 
 type Tracer interface {
@@ -217,6 +249,11 @@ func selectTracer(method Method, config Config) (Tracer, error) {
 			return &TCPTracer{Config: config}, nil
 		}
 		return &TCPTracerIPv6{Config: config}, nil
+	case SCTPTrace:
+		if isIPv4 {
+			return &SCTPTracer{Config: config}, nil
+		}
+		return &SCTPTracerIPv6{Config: config}, nil
 	default:
 		return nil, errInvalidMethod
 	}
@@ -410,6 +447,17 @@ type Hop struct {
 	Geo      *ipgeo.IPGeoData
 	Lang     string
 	MPLS     []string
+	// ReplyTTL 为回包到达时的 TTL / Hop Limit，0 表示未知；
+	// ReturnHops 与 Asymmetric 由 SetReplyTTL 据此推算
+	ReplyTTL   int
+	ReturnHops int
+	Asymmetric bool
+	// TCPReply 为目标对 TCP 探测的应答类型：syn-ack 或 rst；其余回包为空
+	TCPReply string
+	// SCTPReply 为目标对 SCTP 探测的应答类型：init-ack 或 abort；其余回包为空
+	SCTPReply string
+	// QuotedTOS 为 ICMP 差错引用的探测包 TOS / Traffic Class，回包不带引用时为 nil
+	QuotedTOS *uint8
 }
 
 func isLDHASCII(label string) bool {
@@ -928,12 +976,13 @@ func extractMPLS(msg internal.ReceivedMessage, disableMPLS bool) []string {
 				}
 				v := uint32(vU)
 
-				lbl := (v >> 12) & 0xFFFFF // 20 bits
-				tc := (v >> 9) & 0x7       // 3 bits
-				s := (v >> 8) & 0x1        // 1 bit
-				ttl := v & 0xFF            // 8 bits
-
-				mplsLSEList = append(mplsLSEList, fmt.Sprintf("[MPLS: Lbl %d, TC %d, S %d, TTL %d]", lbl, tc, s, ttl))
+				lse := MPLSLabel{
+					Label: int((v >> 12) & 0xFFFFF), // 20 bits
+					TC:    int((v >> 9) & 0x7),      // 3 bits
+					S:     int((v >> 8) & 0x1),      // 1 bit
+					TTL:   int(v & 0xFF),            // 8 bits
+				}
+				mplsLSEList = append(mplsLSEList, lse.String())
 			}
 		}
 
@@ -13,6 +13,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"golang.org/x/sync/semaphore"
 
@@ -37,6 +38,7 @@ type UDPTracer struct {
 	readyOut  chan struct{}
 	readyICMP chan struct{}
 	readyUDP  chan struct{}
+	payload   UDPPayloadProfile
 }
 
 func (t *UDPTracer) waitAllReady(ctx context.Context) {
@@ -202,12 +204,13 @@ func (t *UDPTracer) dropByAttempt(ttl, i int) {
 	}
 }
 
-func (t *UDPTracer) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duration, mpls []string) {
+func (t *UDPTracer) addHopWithIndex(h Hop, i int) {
+	ttl := h.TTL
 	if f := t.final.Load(); f != -1 && ttl > int(f) {
 		return
 	}
 
-	if ip := util.AddrIP(peer); ip != nil && ip.Equal(t.DstIP) {
+	if ip := util.AddrIP(h.Address); ip != nil && ip.Equal(t.DstIP) {
 		for {
 			old := t.final.Load()
 			if old != -1 && ttl >= int(old) {
@@ -219,13 +222,6 @@ func (t *UDPTracer) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duration
 		}
 	}
 
-	h := Hop{
-		Success: true,
-		Address: peer,
-		TTL:     ttl,
-		RTT:     rtt,
-		MPLS:    mpls,
-	}
 	t.res.addWithGeoAsync(h, i, t.NumMeasurements, t.MaxAttempts, t.Config)
 }
 
@@ -254,10 +250,12 @@ func (t *UDPTracer) matchWorker(ctx context.Context) {
 			// 尝试一次匹配
 			ttl, i, srcPort, start, ok := t.lookupSent(task.seq)
 			if !ok {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionNoProbe)
 				continue
 			}
 
 			if task.srcPort != srcPort {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionSrcPort)
 				continue
 			}
 
@@ -274,7 +272,10 @@ func (t *UDPTracer) matchWorker(ctx context.Context) {
 
 			if t.clearPending(ttl, i) {
 				rtt := task.finish.Sub(start)
-				t.addHopWithIndex(task.peer, ttl, i, rtt, task.mpls)
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, matchedDecision(ttl, i, rtt))
+				t.addHopWithIndex(task.hop(ttl, rtt), i)
+			} else {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, lateDecision(ttl, i))
 			}
 			t.dropSent(task.seq)
 		}
@@ -292,6 +293,7 @@ func (t *UDPTracer) Execute() (res *Result, err error) {
 	t.readyOut = make(chan struct{})
 	t.readyICMP = make(chan struct{})
 	t.readyUDP = make(chan struct{})
+	t.payload = t.udpPayloadProfile().Resolve(t.DstPort)
 
 	if len(t.res.Hops) > 0 {
 		return &t.res, errTracerouteExecuted
@@ -320,6 +322,7 @@ func (t *UDPTracer) Execute() (res *Result, err error) {
 		t.DstPort,
 	)
 	s.SourceDevice = t.SourceDevice
+	s.OnDiscard = t.Capture.discardFunc(t.SrcIP)
 
 	s.InitICMP()
 	s.InitUDP()
@@ -362,6 +365,16 @@ func (t *UDPTracer) Execute() (res *Result, err error) {
 		},
 		)
 	}()
+	if t.payload != UDPPayloadRandom {
+		// 协议载荷可能让目标回应用层应答而不是端口不可达
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			s.ListenUDP(ctx, t.readyUDP, t.handleUDPReply)
+		}()
+	} else {
+		close(t.readyUDP)
+	}
 	t.waitAllReady(ctx)
 	t.wg.Add(1)
 	go t.PrintFunc(ctx, cancel)
@@ -406,25 +419,47 @@ func (t *UDPTracer) Execute() (res *Result, err error) {
 	return &t.res, nil
 }
 
+// handleUDPReply 把目标的协议应答按载荷回显的 seq 交给匹配流程
+func (t *UDPTracer) handleUDPReply(srcPort int, payload []byte, msg internal.ReceivedMessage, finish time.Time) {
+	seq, ok := t.payload.replySeq(payload)
+	if !ok {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolUDP, msg.TTL, msg.Msg, decisionNotProbe)
+		return
+	}
+
+	select {
+	case t.matchQ <- matchTask{
+		srcPort: srcPort, seq: seq, peer: msg.Peer, finish: finish,
+		proto: layers.IPProtocolUDP, raw: msg.Msg, replyTTL: msg.TTL,
+	}:
+	default:
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolUDP, msg.TTL, msg.Msg, decisionQueueFull)
+	}
+}
+
 func (t *UDPTracer) handleICMPMessage(msg internal.ReceivedMessage, finish time.Time, data []byte) {
 	mpls := extractMPLS(msg, t.DisableMPLS)
 
 	seq, err := util.GetUDPSeq(data)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
 	header, err := util.GetICMPResponsePayload(data)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
 	srcPort, dstPort, err := util.GetUDPPorts(header)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
 	if dstPort != t.DstPort {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, dstPortDecision(dstPort))
 		return
 	}
 
@@ -432,9 +467,11 @@ func (t *UDPTracer) handleICMPMessage(msg internal.ReceivedMessage, finish time.
 	select {
 	case t.matchQ <- matchTask{
 		srcPort: srcPort, seq: seq, peer: msg.Peer, finish: finish, mpls: mpls,
+		proto: layers.IPProtocolICMPv4, raw: msg.Msg, replyTTL: msg.TTL,
 	}:
 	default:
 		// 丢弃以避免阻塞抓包循环
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv4, msg.TTL, msg.Msg, decisionQueueFull)
 	}
 }
 
@@ -474,9 +511,14 @@ func (t *UDPTracer) resolveSourcePort() int {
 	return srcPort
 }
 
-func (t *UDPTracer) buildUDPPacket(ttl, i, srcPort int) (int, *layers.IPv4, *layers.UDP, []byte) {
+func (t *UDPTracer) buildUDPPacket(ttl, i, srcPort int) (int, *layers.IPv4, *layers.UDP, []byte, error) {
 	seq := (ttl << 8) | (i & 0xFF)
 	payloadSize := resolveProbePayloadSize(UDPTrace, t.DstIP, t.PktSize, t.RandomPacketSize)
+	// IPv4 以 IP ID 匹配，无需校验和补偿
+	payload, _, err := buildUDPPayload(t.payload, seq, payloadSize)
+	if err != nil {
+		return 0, nil, nil, nil, err
+	}
 	ipHeader := &layers.IPv4{
 		Version:  4,
 		Id:       uint16(seq),
@@ -490,7 +532,7 @@ func (t *UDPTracer) buildUDPPacket(ttl, i, srcPort int) (int, *layers.IPv4, *lay
 		SrcPort: layers.UDPPort(srcPort),
 		DstPort: layers.UDPPort(t.DstPort),
 	}
-	return seq, ipHeader, udpHeader, randomPayload(payloadSize, 0)
+	return seq, ipHeader, udpHeader, payload, nil
 }
 
 func (t *UDPTracer) startSendTimeout(ctx context.Context, ttl, i, seq int) {
@@ -551,7 +593,10 @@ func (t *UDPTracer) send(ctx context.Context, s *internal.UDPSpec, ttl, i int) e
 	defer release()
 
 	srcPort := t.resolveSourcePort()
-	seq, ipHeader, udpHeader, payload := t.buildUDPPacket(ttl, i, srcPort)
+	seq, ipHeader, udpHeader, payload, err := t.buildUDPPacket(ttl, i, srcPort)
+	if err != nil {
+		return err
+	}
 	t.prepareDarwinSend(ttl, i, srcPort)
 	t.startSendTimeout(ctx, ttl, i, seq)
 	start, err := s.SendUDP(ctx, ipHeader, udpHeader, payload)
@@ -560,5 +605,6 @@ func (t *UDPTracer) send(ctx context.Context, s *internal.UDPSpec, ttl, i int) e
 		return err
 	}
 	t.finalizeSent(seq, srcPort, start)
+	t.Capture.probe(start, ttl, i, ipHeader, udpHeader, gopacket.Payload(payload))
 	return nil
 }
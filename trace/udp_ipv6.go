@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"net"
 	"os"
 	"os/signal"
@@ -13,6 +12,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"golang.org/x/sync/semaphore"
 
@@ -34,6 +34,8 @@ type UDPTracerIPv6 struct {
 	matchQ    chan matchTask
 	readyICMP chan struct{}
 	readyUDP  chan struct{}
+	payload   UDPPayloadProfile
+	ipv6      *ipv6Prober
 }
 
 func (t *UDPTracerIPv6) waitAllReady(ctx context.Context) {
@@ -158,12 +160,13 @@ func (t *UDPTracerIPv6) dropSent(seq int) {
 	delete(t.sentAt, seq)
 }
 
-func (t *UDPTracerIPv6) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Duration, mpls []string) {
+func (t *UDPTracerIPv6) addHopWithIndex(h Hop, i int) {
+	ttl := h.TTL
 	if f := t.final.Load(); f != -1 && ttl > int(f) {
 		return
 	}
 
-	if ip := util.AddrIP(peer); ip != nil && ip.Equal(t.DstIP) {
+	if ip := util.AddrIP(h.Address); ip != nil && ip.Equal(t.DstIP) {
 		for {
 			old := t.final.Load()
 			if old != -1 && ttl >= int(old) {
@@ -175,13 +178,6 @@ func (t *UDPTracerIPv6) addHopWithIndex(peer net.Addr, ttl, i int, rtt time.Dura
 		}
 	}
 
-	h := Hop{
-		Success: true,
-		Address: peer,
-		TTL:     ttl,
-		RTT:     rtt,
-		MPLS:    mpls,
-	}
 	t.res.addWithGeoAsync(h, i, t.NumMeasurements, t.MaxAttempts, t.Config)
 }
 
@@ -210,10 +206,12 @@ func (t *UDPTracerIPv6) matchWorker(ctx context.Context) {
 			// 尝试一次匹配
 			srcPort, start, ok := t.lookupSent(task.seq)
 			if !ok {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionNoProbe)
 				continue
 			}
 
 			if task.srcPort != srcPort {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, decisionSrcPort)
 				continue
 			}
 
@@ -228,7 +226,10 @@ func (t *UDPTracerIPv6) matchWorker(ctx context.Context) {
 
 			if t.clearPending(task.seq) {
 				rtt := task.finish.Sub(start)
-				t.addHopWithIndex(task.peer, ttl, i, rtt, task.mpls)
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, matchedDecision(ttl, i, rtt))
+				t.addHopWithIndex(task.hop(ttl, rtt), i)
+			} else {
+				t.Capture.reply(task.finish, task.peer, t.SrcIP, task.proto, task.replyTTL, task.raw, lateDecision(ttl, i))
 			}
 			t.dropSent(task.seq)
 		}
@@ -244,6 +245,7 @@ func (t *UDPTracerIPv6) Execute() (res *Result, err error) {
 	// 创建就绪通道
 	t.readyICMP = make(chan struct{})
 	t.readyUDP = make(chan struct{})
+	t.payload = t.udpPayloadProfile().Resolve(t.DstPort)
 
 	if len(t.res.Hops) > 0 {
 		return &t.res, errTracerouteExecuted
@@ -263,6 +265,11 @@ func (t *UDPTracerIPv6) Execute() (res *Result, err error) {
 	if t.SrcIP == nil {
 		return nil, errors.New("cannot determine local IPv6 address")
 	}
+	t.ipv6, err = newIPv6Prober(t.IPv6, t.SrcIP, t.DstIP, t.SourceDevice)
+	if err != nil {
+		return nil, err
+	}
+	defer t.ipv6.close()
 
 	s := internal.NewUDPSpec(
 		6,
@@ -272,6 +279,7 @@ func (t *UDPTracerIPv6) Execute() (res *Result, err error) {
 		t.DstPort,
 	)
 	s.SourceDevice = t.SourceDevice
+	s.OnDiscard = t.Capture.discardFunc(t.SrcIP)
 
 	s.InitICMP()
 	s.InitUDP()
@@ -298,6 +306,16 @@ func (t *UDPTracerIPv6) Execute() (res *Result, err error) {
 		},
 		)
 	}()
+	if t.payload != UDPPayloadRandom {
+		// 协议载荷可能让目标回应用层应答而不是端口不可达
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			s.ListenUDP(ctx, t.readyUDP, t.handleUDPReply)
+		}()
+	} else {
+		close(t.readyUDP)
+	}
 	t.waitAllReady(ctx)
 	t.wg.Add(1)
 	go t.PrintFunc(ctx, cancel)
@@ -342,25 +360,47 @@ func (t *UDPTracerIPv6) Execute() (res *Result, err error) {
 	return &t.res, nil
 }
 
+// handleUDPReply 把目标的协议应答按载荷回显的 seq 交给匹配流程
+func (t *UDPTracerIPv6) handleUDPReply(srcPort int, payload []byte, msg internal.ReceivedMessage, finish time.Time) {
+	seq, ok := t.payload.replySeq(payload)
+	if !ok {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolUDP, msg.TTL, msg.Msg, decisionNotProbe)
+		return
+	}
+
+	select {
+	case t.matchQ <- matchTask{
+		srcPort: srcPort, seq: seq, peer: msg.Peer, finish: finish,
+		proto: layers.IPProtocolUDP, raw: msg.Msg, replyTTL: msg.TTL,
+	}:
+	default:
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolUDP, msg.TTL, msg.Msg, decisionQueueFull)
+	}
+}
+
 func (t *UDPTracerIPv6) handleICMPMessage(msg internal.ReceivedMessage, finish time.Time, data []byte) {
 	mpls := extractMPLS(msg, t.DisableMPLS)
 
 	header, err := util.GetICMPResponsePayload(data)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv6, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
 	srcPort, dstPort, err := util.GetUDPPorts(header)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv6, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
 	if dstPort != t.DstPort {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv6, msg.TTL, msg.Msg, dstPortDecision(dstPort))
 		return
 	}
 
 	seq, err := util.GetUDPSeqv6(header)
 	if err != nil {
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv6, msg.TTL, msg.Msg, decisionNotProbe)
 		return
 	}
 
@@ -368,9 +408,11 @@ func (t *UDPTracerIPv6) handleICMPMessage(msg internal.ReceivedMessage, finish t
 	select {
 	case t.matchQ <- matchTask{
 		srcPort: srcPort, seq: seq, peer: msg.Peer, finish: finish, mpls: mpls,
+		proto: layers.IPProtocolICMPv6, raw: msg.Msg, replyTTL: msg.TTL,
 	}:
 	default:
 		// 丢弃以避免阻塞抓包循环
+		t.Capture.reply(finish, msg.Peer, t.SrcIP, layers.IPProtocolICMPv6, msg.TTL, msg.Msg, decisionQueueFull)
 	}
 }
 
@@ -421,16 +463,13 @@ func (t *UDPTracerIPv6) send(ctx context.Context, s *internal.UDPSpec, ttl, i in
 	}
 
 	desiredPayloadSize := resolveProbePayloadSize(UDPTrace, t.DstIP, t.PktSize, t.RandomPacketSize)
-	payload := make([]byte, desiredPayloadSize)
-
-	// 设置随机种子
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	for k := 2; k < desiredPayloadSize; k++ {
-		payload[k] = byte(r.Intn(256))
+	payload, fudge, err := buildUDPPayload(t.payload, seq, desiredPayloadSize)
+	if err != nil {
+		return err
 	}
 
-	// 通过 payload[0:2] 补偿，使 UDP.Checksum 精确等于 seq
-	if err := util.MakePayloadWithTargetChecksum(payload, t.SrcIP, t.DstIP, SrcPort, t.DstPort, uint16(seq)); err != nil {
+	// 通过 payload[fudge:fudge+2] 补偿，使 UDP.Checksum 精确等于 seq
+	if err := util.MakePayloadWithTargetChecksumAt(payload, fudge, t.SrcIP, t.DstIP, SrcPort, t.DstPort, uint16(seq)); err != nil {
 		return err
 	}
 
@@ -463,11 +502,18 @@ func (t *UDPTracerIPv6) send(ctx context.Context, s *internal.UDPSpec, ttl, i in
 		t.dropSent(seq)
 	}(seq, ttl, i)
 
-	start, err := s.SendUDP(ctx, ipHeader, udpHeader, payload)
+	var start time.Time
+	sent := []gopacket.SerializableLayer{ipHeader, udpHeader, gopacket.Payload(payload)}
+	if t.ipv6 != nil {
+		start, sent, err = t.ipv6.send(ctx, ipHeader, udpHeader, gopacket.Payload(payload))
+	} else {
+		start, err = s.SendUDP(ctx, ipHeader, udpHeader, payload)
+	}
 	if err != nil {
 		_ = t.clearPending(seq)
 		return err
 	}
 	t.storeSent(seq, SrcPort, start)
+	t.Capture.probe(start, ttl, i, sent...)
 	return nil
 }
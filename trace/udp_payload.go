@@ -0,0 +1,292 @@
+package trace
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// UDPPayloadProfile 决定 UDP 探测包携带的载荷。random 为原来的随机字节；
+// 其余 profile 各构造一个合法的协议请求，便于穿过只放行正常协议流量的有状态防火墙。
+// 探测序号的编码方式不变（IPv4 在 IP ID，IPv6 在 UDP 校验和），协议载荷里
+// 另有一处目标会在应答中原样回显的字段也写入序号，用来匹配目标的协议应答；
+// IPv6 校验和的补偿字则放在对端不关心取值的字段里。
+type UDPPayloadProfile string
+
+const (
+	UDPPayloadRandom UDPPayloadProfile = "random"
+	UDPPayloadAuto   UDPPayloadProfile = "auto"
+	UDPPayloadDNS    UDPPayloadProfile = "dns"
+	UDPPayloadQUIC   UDPPayloadProfile = "quic"
+	UDPPayloadNTP    UDPPayloadProfile = "ntp"
+	UDPPayloadSTUN   UDPPayloadProfile = "stun"
+)
+
+// UDPPayloadProfiles 为可选的 profile 名称
+var UDPPayloadProfiles = []string{
+	string(UDPPayloadRandom),
+	string(UDPPayloadAuto),
+	string(UDPPayloadDNS),
+	string(UDPPayloadQUIC),
+	string(UDPPayloadNTP),
+	string(UDPPayloadSTUN),
+}
+
+// udpPayloadProtocols 按 auto 的匹配顺序列出各协议 profile 及其知名端口
+var udpPayloadProtocols = []struct {
+	profile UDPPayloadProfile
+	port    int
+}{
+	{UDPPayloadDNS, 53},
+	{UDPPayloadQUIC, 443},
+	{UDPPayloadNTP, 123},
+	{UDPPayloadSTUN, 3478},
+}
+
+const (
+	dnsProbeLen         = 40
+	dnsProbeFudgeOffset = 32 // EDNS COOKIE 选项中的 client cookie
+	quicProbeLen        = 1200
+	ntpProbeLen         = 48
+	ntpProbeSeqOffset   = 44 // transmit timestamp 的小数部分，服务器回显在 origin timestamp
+	ntpOriginSeqOffset  = 28
+	stunProbeLen        = 20
+	stunMagicCookie     = 0x2112A442
+	stunProbeSeqOffset  = 8 // transaction ID
+	stunBindingRequest  = 0x0001
+	stunClassMask       = 0x0110
+	stunClassResponse   = 0x0100 // 成功与错误响应都置此位
+)
+
+// ParseUDPPayloadProfile 解析 profile 名称，空串视为 random
+func ParseUDPPayloadProfile(raw string) (UDPPayloadProfile, error) {
+	name := strings.ToLower(strings.TrimSpace(raw))
+	if name == "" {
+		return UDPPayloadRandom, nil
+	}
+	if !util.StringInSlice(name, UDPPayloadProfiles) {
+		return "", fmt.Errorf("unsupported udp payload %q; choose one of %s", raw, strings.Join(UDPPayloadProfiles, ", "))
+	}
+	return UDPPayloadProfile(name), nil
+}
+
+// DefaultPort 返回协议 profile 的知名端口；random 与 auto 返回 0
+func (p UDPPayloadProfile) DefaultPort() int {
+	for _, proto := range udpPayloadProtocols {
+		if proto.profile == p {
+			return proto.port
+		}
+	}
+	return 0
+}
+
+// udpPayloadProfile 返回配置的 profile，兼容已弃用的 Config.Quic
+func (c *Config) udpPayloadProfile() UDPPayloadProfile {
+	if c.UDPPayload == "" && c.Quic {
+		return UDPPayloadQUIC
+	}
+	return c.UDPPayload
+}
+
+// Resolve 返回实际使用的 profile：auto 按目标端口选择协议，端口不对应任何协议时退回 random
+func (p UDPPayloadProfile) Resolve(dstPort int) UDPPayloadProfile {
+	switch p {
+	case "", UDPPayloadRandom:
+		return UDPPayloadRandom
+	case UDPPayloadAuto:
+		for _, proto := range udpPayloadProtocols {
+			if proto.port == dstPort {
+				return proto.profile
+			}
+		}
+		return UDPPayloadRandom
+	}
+	return p
+}
+
+// UDPPayloadPacketSize 返回使用协议 profile 时探测包的总长度（含 IP 与 UDP 头）。
+// random 的长度仍由 PktSize 决定，此时 ok 为 false。
+func UDPPayloadPacketSize(p UDPPayloadProfile, dstIP net.IP, dstPort int) (int, bool) {
+	size := udpPayloadLen(p.Resolve(dstPort))
+	if size == 0 {
+		return 0, false
+	}
+	return packetSizeIPHeaderBytes(dstIP) + udpHeaderBytes + size, true
+}
+
+func udpPayloadLen(p UDPPayloadProfile) int {
+	switch p {
+	case UDPPayloadDNS:
+		return dnsProbeLen
+	case UDPPayloadQUIC:
+		return quicProbeLen
+	case UDPPayloadNTP:
+		return ntpProbeLen
+	case UDPPayloadSTUN:
+		return stunProbeLen
+	}
+	return 0
+}
+
+// buildUDPPayload 生成 profile 对应的探测载荷，randomSize 只用于 random。
+// fudge 为 IPv6 校验和补偿字的偏移。
+func buildUDPPayload(p UDPPayloadProfile, seq, randomSize int) (payload []byte, fudge int, err error) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	switch p {
+	case UDPPayloadDNS:
+		return dnsProbePayload(seq, r), dnsProbeFudgeOffset, nil
+	case UDPPayloadQUIC:
+		return quicProbePayload(seq, r)
+	case UDPPayloadNTP:
+		return ntpProbePayload(seq, r), ntpProbeSeqOffset + 2, nil
+	case UDPPayloadSTUN:
+		return stunProbePayload(seq, r), stunProbeSeqOffset + 2, nil
+	}
+	return randomPayload(randomSize, 0), 0, nil
+}
+
+// dnsProbePayload 生成根域 NS 查询，ID 为 seq，并带 EDNS(0) OPT 记录与 COOKIE 选项
+func dnsProbePayload(seq int, r *rand.Rand) []byte {
+	b := make([]byte, dnsProbeLen)
+	binary.BigEndian.PutUint16(b[0:], uint16(seq))
+	binary.BigEndian.PutUint16(b[2:], 0x0100) // RD
+	binary.BigEndian.PutUint16(b[4:], 1)      // QDCOUNT
+	binary.BigEndian.PutUint16(b[10:], 1)     // ARCOUNT
+	// b[12] = 0：QNAME 为根域
+	binary.BigEndian.PutUint16(b[13:], 2) // QTYPE NS
+	binary.BigEndian.PutUint16(b[15:], 1) // QCLASS IN
+	// b[17] = 0：OPT 记录的 NAME
+	binary.BigEndian.PutUint16(b[18:], 41)   // TYPE OPT
+	binary.BigEndian.PutUint16(b[20:], 1232) // UDP payload size
+	binary.BigEndian.PutUint16(b[26:], 12)   // RDLENGTH
+	binary.BigEndian.PutUint16(b[28:], 10)   // OPTION-CODE COOKIE
+	binary.BigEndian.PutUint16(b[30:], 8)    // OPTION-LENGTH
+	r.Read(b[dnsProbeFudgeOffset:])
+	return b
+}
+
+// quicProbePayload 生成 1200 字节的数据报：SCID 前 2 字节为 seq 的 Initial 包，
+// 末尾 2 字节留作补偿字。服务器回包的 DCID 即此 SCID；尾部字节会被当作
+// 无法解析的合并包丢弃。
+func quicProbePayload(seq int, r *rand.Rand) ([]byte, int, error) {
+	dcid := make([]byte, quicConnIDLen)
+	r.Read(dcid)
+	scid := make([]byte, quicConnIDLen)
+	binary.BigEndian.PutUint16(scid, uint16(seq))
+	r.Read(scid[2:])
+	initial, err := buildQUICInitial(quicProbeLen-2, dcid, scid, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return append(initial, 0, 0), quicProbeLen - 2, nil
+}
+
+// ntpProbePayload 生成 NTPv4 客户端请求；transmit timestamp 的秒为当前时间，
+// 小数部分前 2 字节为 seq，后 2 字节留作补偿字
+func ntpProbePayload(seq int, r *rand.Rand) []byte {
+	b := make([]byte, ntpProbeLen)
+	b[0] = 0x23 // LI 0, VN 4, Mode 3 (client)
+	binary.BigEndian.PutUint32(b[40:], uint32(time.Now().Unix()+2208988800))
+	binary.BigEndian.PutUint16(b[ntpProbeSeqOffset:], uint16(seq))
+	r.Read(b[ntpProbeSeqOffset+2:])
+	return b
+}
+
+// stunProbePayload 生成不带属性的 STUN Binding 请求，transaction ID 前 2 字节为 seq，
+// 随后 2 字节留作补偿字
+func stunProbePayload(seq int, r *rand.Rand) []byte {
+	b := make([]byte, stunProbeLen)
+	binary.BigEndian.PutUint16(b[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(b[4:], stunMagicCookie)
+	binary.BigEndian.PutUint16(b[stunProbeSeqOffset:], uint16(seq))
+	r.Read(b[stunProbeSeqOffset+2:])
+	return b
+}
+
+// replySeq 从目标的协议应答中取回探测时写入的 seq
+func (p UDPPayloadProfile) replySeq(b []byte) (int, bool) {
+	switch p {
+	case UDPPayloadDNS:
+		if len(b) < 12 || b[2]&0x80 == 0 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[0:])), true
+	case UDPPayloadQUIC:
+		// 任何长包头（Initial、Retry、版本协商）的 DCID 都是探测包的 SCID
+		if len(b) < 6 || b[0]&0x80 == 0 {
+			return 0, false
+		}
+		n := int(b[5])
+		if n < 2 || len(b) < 6+n {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[6:])), true
+	case UDPPayloadNTP:
+		if len(b) < ntpProbeLen || b[0]&0x07 != 4 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[ntpOriginSeqOffset:])), true
+	case UDPPayloadSTUN:
+		if len(b) < stunProbeLen || binary.BigEndian.Uint32(b[4:]) != stunMagicCookie {
+			return 0, false
+		}
+		typ := binary.BigEndian.Uint16(b[0:])
+		if typ&^stunClassMask != stunBindingRequest || typ&stunClassResponse == 0 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[stunProbeSeqOffset:])), true
+	}
+	return 0, false
+}
+
+// probeSeq 从 profile 生成的探测载荷中取回 seq，供离线回放匹配目标应答
+func (p UDPPayloadProfile) probeSeq(b []byte) (int, bool) {
+	switch p {
+	case UDPPayloadDNS:
+		if len(b) < 12 || b[2]&0x80 != 0 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[0:])), true
+	case UDPPayloadQUIC:
+		// 头部保护不覆盖首字节的包类型位，Initial 为 0
+		if len(b) < 7 || b[0]&0xB0 != 0x80 || binary.BigEndian.Uint32(b[1:]) != quicVersion1 {
+			return 0, false
+		}
+		scid := 6 + int(b[5])
+		if len(b) < scid+3 || b[scid] < 2 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[scid+1:])), true
+	case UDPPayloadNTP:
+		if len(b) < ntpProbeLen || b[0]&0x07 != 3 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[ntpProbeSeqOffset:])), true
+	case UDPPayloadSTUN:
+		if len(b) < stunProbeLen || binary.BigEndian.Uint32(b[4:]) != stunMagicCookie ||
+			binary.BigEndian.Uint16(b[0:]) != stunBindingRequest {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(b[stunProbeSeqOffset:])), true
+	}
+	return 0, false
+}
+
+// udpPayloadAnswers 报告 reply 是否为对 probe 的协议应答
+func udpPayloadAnswers(probe, reply []byte) bool {
+	for _, proto := range udpPayloadProtocols {
+		want, ok := proto.profile.probeSeq(probe)
+		if !ok {
+			continue
+		}
+		if got, ok := proto.profile.replySeq(reply); ok && got == want {
+			return true
+		}
+	}
+	return false
+}
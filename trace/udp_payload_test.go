@@ -0,0 +1,232 @@
+package trace
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+func TestParseUDPPayloadProfile(t *testing.T) {
+	for raw, want := range map[string]UDPPayloadProfile{"": UDPPayloadRandom, " DNS ": UDPPayloadDNS, "auto": UDPPayloadAuto} {
+		got, err := ParseUDPPayloadProfile(raw)
+		if err != nil || got != want {
+			t.Fatalf("ParseUDPPayloadProfile(%q) = %q, %v", raw, got, err)
+		}
+	}
+	if _, err := ParseUDPPayloadProfile("http"); err == nil {
+		t.Fatal("unknown profile accepted")
+	}
+}
+
+func TestUDPPayloadResolve(t *testing.T) {
+	cases := []struct {
+		profile UDPPayloadProfile
+		port    int
+		want    UDPPayloadProfile
+	}{
+		{"", 53, UDPPayloadRandom},
+		{UDPPayloadAuto, 53, UDPPayloadDNS},
+		{UDPPayloadAuto, 443, UDPPayloadQUIC},
+		{UDPPayloadAuto, 123, UDPPayloadNTP},
+		{UDPPayloadAuto, 3478, UDPPayloadSTUN},
+		{UDPPayloadAuto, 33494, UDPPayloadRandom},
+		{UDPPayloadSTUN, 33494, UDPPayloadSTUN},
+	}
+	for _, c := range cases {
+		if got := c.profile.Resolve(c.port); got != c.want {
+			t.Errorf("%q.Resolve(%d) = %q, want %q", c.profile, c.port, got, c.want)
+		}
+	}
+	if UDPPayloadQUIC.DefaultPort() != 443 || UDPPayloadAuto.DefaultPort() != 0 {
+		t.Fatal("unexpected default ports")
+	}
+	if size, ok := UDPPayloadPacketSize(UDPPayloadAuto, net.ParseIP("2001:db8::1"), 443); !ok || size != 40+8+1200 {
+		t.Fatalf("QUIC packet size = %d %v", size, ok)
+	}
+	if _, ok := UDPPayloadPacketSize(UDPPayloadRandom, net.ParseIP("192.0.2.1"), 53); ok {
+		t.Fatal("random profile reported a fixed size")
+	}
+}
+
+// fakeUDPAnswer builds the reply a server of the profile's protocol sends.
+func fakeUDPAnswer(t *testing.T, p UDPPayloadProfile, probe []byte) []byte {
+	t.Helper()
+	switch p {
+	case UDPPayloadDNS:
+		b := append([]byte(nil), probe...)
+		b[2] |= 0x80
+		return b
+	case UDPPayloadQUIC:
+		scid := probe[7+quicConnIDLen : 7+2*quicConnIDLen]
+		b := []byte{0xC0, 0, 0, 0, 1, quicConnIDLen}
+		b = append(b, scid...)
+		return append(b, make([]byte, 40)...)
+	case UDPPayloadNTP:
+		b := make([]byte, ntpProbeLen)
+		b[0] = 0x24
+		copy(b[24:32], probe[40:48])
+		return b
+	case UDPPayloadSTUN:
+		b := append([]byte(nil), probe...)
+		binary.BigEndian.PutUint16(b[0:], 0x0101)
+		return b
+	}
+	t.Fatalf("no answer for %q", p)
+	return nil
+}
+
+func TestUDPPayloadProfilesKeepSeqMatchable(t *testing.T) {
+	src := net.ParseIP("2001:db8::10")
+	dst := net.ParseIP("2001:db8::53")
+	const seq = 7<<8 | 2
+	for _, proto := range udpPayloadProtocols {
+		p := proto.profile
+		payload, fudge, err := buildUDPPayload(p, seq, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if len(payload) != udpPayloadLen(p) {
+			t.Fatalf("%s: len = %d, want %d", p, len(payload), udpPayloadLen(p))
+		}
+		if err := util.MakePayloadWithTargetChecksumAt(payload, fudge, src, dst, 40000, proto.port, seq); err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		if sum := ^util.UDPBaseSum(src, dst, 40000, proto.port, 8+len(payload), payload); sum != seq {
+			t.Fatalf("%s: checksum = %#x, want %#x", p, sum, seq)
+		}
+		if got, ok := p.probeSeq(payload); !ok || got != seq {
+			t.Fatalf("%s: probeSeq = %d %v after the fudge word", p, got, ok)
+		}
+		// QUIC 的客户端与服务器 Initial 都是长包头，只能靠方向区分
+		if _, ok := p.replySeq(payload); ok && p != UDPPayloadQUIC {
+			t.Fatalf("%s: probe taken for an answer", p)
+		}
+		answer := fakeUDPAnswer(t, p, payload)
+		if got, ok := p.replySeq(answer); !ok || got != seq {
+			t.Fatalf("%s: replySeq = %d %v", p, got, ok)
+		}
+		if !udpPayloadAnswers(payload, answer) {
+			t.Fatalf("%s: answer not matched to its probe", p)
+		}
+		other, _, _ := buildUDPPayload(p, seq+1, 0)
+		if udpPayloadAnswers(other, answer) {
+			t.Fatalf("%s: answer matched to another probe", p)
+		}
+	}
+	if payload, _, _ := buildUDPPayload(UDPPayloadRandom, seq, 12); len(payload) != 12 {
+		t.Fatalf("random payload len = %d", len(payload))
+	}
+}
+
+func TestDNSProbePayloadIsRootNSQuery(t *testing.T) {
+	b := dnsProbePayload(0x0102, rand.New(rand.NewSource(1)))
+	want, _ := hex.DecodeString("010201000001000000000001000002000100002904d000000000000c000a0008")
+	if !bytes.Equal(b[:32], want) {
+		t.Fatalf("header = %x\nwant     %x", b[:32], want)
+	}
+}
+
+func TestQUICClientInitialKeysRFC9001(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	keys, err := quicClientInitialKeys(dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]struct{ got, want []byte }{
+		"key": {keys.key, mustHex(t, "1f369613dd76d5467730efcbe3b1a22d")},
+		"iv":  {keys.iv, mustHex(t, "fa044b2f42a3fd3b46fb255c")},
+		"hp":  {keys.hp, mustHex(t, "9f50449e04a0e810283a1e9933adedd2")},
+	} {
+		if !bytes.Equal(c.got, c.want) {
+			t.Errorf("%s = %x, want %x", name, c.got, c.want)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestQUICProbePayloadDecrypts(t *testing.T) {
+	payload, fudge, err := quicProbePayload(0x0a01, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != quicProbeLen || fudge != quicProbeLen-2 {
+		t.Fatalf("len = %d fudge = %d", len(payload), fudge)
+	}
+	packet := append([]byte(nil), payload[:fudge]...)
+	dcid := packet[6 : 6+quicConnIDLen]
+	keys, err := quicClientInitialKeys(dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pnOffset := 6 + quicConnIDLen + 1 + quicConnIDLen + 1 + 2
+	if length := int(binary.BigEndian.Uint16(packet[pnOffset-2:]) & 0x3fff); pnOffset+length != len(packet) {
+		t.Fatalf("Length field %d does not cover the packet", length)
+	}
+	hp, _ := aes.NewCipher(keys.hp)
+	mask := make([]byte, aes.BlockSize)
+	hp.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	if packet[0] != 0xC0 || packet[pnOffset] != 0 {
+		t.Fatalf("first byte %#x, packet number %d", packet[0], packet[pnOffset])
+	}
+
+	block, _ := aes.NewCipher(keys.key)
+	aead, _ := cipher.NewGCM(block)
+	header := packet[:pnOffset+1]
+	frames, err := aead.Open(nil, keys.iv, packet[pnOffset+1:], header)
+	if err != nil {
+		t.Fatalf("Initial does not decrypt: %v", err)
+	}
+	if frames[0] != 0x06 || frames[1] != 0 {
+		t.Fatalf("first frame %#x is not CRYPTO at offset 0", frames[0])
+	}
+	hello := frames[4 : 4+int(binary.BigEndian.Uint16(frames[2:])&0x3fff)]
+	if hello[0] != 0x01 || int(hello[1])<<16|int(hello[2])<<8|int(hello[3]) != len(hello)-4 {
+		t.Fatalf("CRYPTO data is not a ClientHello: %x", hello[:4])
+	}
+	scid := packet[7+quicConnIDLen : 7+2*quicConnIDLen]
+	if !bytes.Contains(hello, append([]byte{0x0f, quicConnIDLen}, scid...)) {
+		t.Fatal("transport parameters miss initial_source_connection_id")
+	}
+	for _, b := range frames[4+len(hello):] {
+		if b != 0 {
+			t.Fatal("trailing frames are not PADDING")
+		}
+	}
+}
+
+func TestDeprecatedQuicConfigMapsToQUICProfile(t *testing.T) {
+	cases := []struct {
+		conf Config
+		want UDPPayloadProfile
+	}{
+		{Config{Quic: true}, UDPPayloadQUIC},
+		{Config{Quic: true, UDPPayload: UDPPayloadDNS}, UDPPayloadDNS},
+		{Config{}, ""},
+	}
+	for _, c := range cases {
+		if got := c.conf.udpPayloadProfile(); got != c.want {
+			t.Errorf("udpPayloadProfile(%+v) = %q, want %q", c.conf, got, c.want)
+		}
+	}
+	if got := len(GenerateQuicPayloadWithRandomIds()); got != quicProbeLen {
+		t.Fatalf("GenerateQuicPayloadWithRandomIds() len = %d, want %d", got, quicProbeLen)
+	}
+}
@@ -0,0 +1,60 @@
+package tracemap
+
+// landOutlines is a deliberately coarse world basemap: one closed ring of
+// longitude,latitude pairs per land mass, a few degrees of accuracy. It is
+// only there so a path can be told apart from its neighbours offline.
+var landOutlines = [][]float64{
+	// North America
+	{-168, 66, -162, 70, -156, 71, -140, 70, -128, 70, -115, 68, -95, 72, -82, 73, -80, 63, -92, 58,
+		-82, 52, -78, 55, -77, 62, -65, 60, -60, 55, -56, 52, -66, 45, -70, 42, -76, 38, -76, 35,
+		-81, 31, -80, 25, -82, 27, -84, 30, -90, 29, -97, 27, -97, 22, -92, 18, -87, 21, -88, 16,
+		-83, 15, -83, 9, -78, 9, -80, 7, -86, 11, -92, 14, -105, 20, -106, 23, -112, 29, -110, 23,
+		-115, 30, -117, 32, -121, 35, -124, 40, -124, 47, -128, 51, -135, 58, -142, 60, -152, 59,
+		-158, 56, -165, 54, -158, 58, -162, 60, -166, 62, -165, 65},
+	// Greenland
+	{-73, 78, -60, 82, -30, 83, -20, 80, -20, 72, -30, 68, -42, 60, -50, 64, -55, 70, -65, 76},
+	// South America
+	{-80, 9, -75, 11, -72, 12, -62, 11, -52, 5, -50, 0, -44, -2, -35, -5, -35, -9, -39, -15,
+		-41, -22, -48, -26, -53, -34, -58, -38, -62, -40, -65, -45, -68, -50, -69, -55, -74, -53,
+		-75, -46, -73, -38, -71, -30, -70, -18, -76, -14, -81, -5, -80, 0, -78, 3, -77, 8},
+	// Eurasia
+	{-9, 43, -9, 37, -6, 36, -2, 37, 0, 39, 3, 42, 5, 43, 9, 44, 12, 42, 16, 38,
+		18, 40, 13, 45, 19, 42, 22, 37, 24, 38, 23, 41, 27, 41, 26, 37, 30, 36, 36, 36,
+		35, 33, 34, 31, 34, 28, 39, 21, 43, 13, 45, 13, 52, 16, 57, 19, 59, 22, 56, 26,
+		51, 24, 50, 27, 48, 30, 50, 30, 56, 27, 62, 25, 67, 25, 70, 21, 73, 17, 77, 8,
+		80, 10, 80, 15, 86, 20, 90, 22, 92, 21, 94, 16, 98, 16, 98, 8, 100, 4, 104, 1,
+		103, 5, 101, 7, 100, 13, 105, 9, 109, 12, 108, 16, 106, 19, 108, 21, 114, 22, 120, 26,
+		122, 30, 121, 32, 119, 35, 122, 37, 117, 39, 122, 41, 125, 40, 127, 35, 129, 35, 129, 42,
+		135, 43, 141, 47, 141, 53, 137, 54, 143, 59, 155, 59, 163, 62, 180, 66, 180, 69, 170, 70,
+		160, 70, 150, 72, 140, 72, 130, 71, 113, 74, 105, 78, 95, 76, 80, 73, 70, 73, 68, 69,
+		60, 70, 50, 68, 42, 67, 32, 70, 25, 71, 15, 68, 10, 63, 5, 60, 6, 58, 10, 59,
+		11, 56, 8, 57, 8, 54, 4, 52, 2, 51, -2, 48, -5, 48, -1, 46, -2, 44},
+	// Africa
+	{-6, 36, 10, 37, 11, 33, 20, 31, 25, 32, 32, 31, 34, 28, 37, 22, 39, 15, 43, 12,
+		51, 12, 48, 5, 40, -3, 40, -11, 35, -20, 35, -25, 32, -29, 27, -34, 20, -35, 18, -32,
+		14, -23, 12, -17, 13, -10, 9, -1, 9, 4, 5, 6, -2, 5, -8, 4, -13, 8, -17, 14,
+		-17, 21, -13, 27, -10, 30, -10, 35},
+	// Australia
+	{114, -22, 114, -34, 118, -35, 124, -33, 131, -31, 135, -35, 138, -35, 140, -38, 147, -39, 150, -37,
+		153, -31, 153, -25, 149, -20, 146, -19, 142, -11, 141, -17, 136, -15, 137, -12, 131, -11, 129, -15,
+		126, -14, 122, -18},
+	// Antarctica
+	{-180, -70, -120, -73, -60, -64, 0, -70, 60, -67, 120, -66, 180, -70, 180, -90, -180, -90},
+	// Great Britain
+	{-5, 50, 1, 51, 2, 53, -1, 55, -2, 58, -5, 58, -6, 56, -3, 54, -5, 52},
+	// Iceland
+	{-24, 65, -22, 66, -15, 66, -14, 65, -18, 63, -22, 64},
+	// Japan
+	{130, 31, 132, 34, 136, 34, 140, 35, 141, 38, 142, 42, 145, 44, 141, 45, 140, 41, 139, 38,
+		136, 37, 133, 35, 130, 34},
+	// Taiwan
+	{120, 22, 122, 25, 121, 22},
+	// Sumatra
+	{95, 5, 98, 4, 104, -2, 106, -6, 101, -3},
+	// Borneo
+	{109, 1, 111, -3, 116, -4, 119, 1, 117, 7, 113, 3},
+	// Madagascar
+	{44, -25, 47, -25, 50, -15, 49, -12, 44, -17},
+	// New Zealand
+	{167, -46, 172, -41, 174, -37, 178, -38, 174, -41, 171, -44},
+}
@@ -0,0 +1,217 @@
+package tracemap
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The page projects longitude and latitude onto a mapWidth x mapHeight
+// equirectangular plane and zooms in with the SVG viewBox.
+const (
+	mapWidth  = 1000.0
+	mapHeight = 500.0
+	// minSpanDeg keeps a path inside one city from filling the page.
+	minSpanDeg = 30.0
+)
+
+func project(lng, lat float64) (float64, float64) {
+	return (lng + 180) * mapWidth / 360, (90 - lat) * mapHeight / 180
+}
+
+// unwrapLongitudes shifts each longitude by whole turns so consecutive hops
+// are never more than 180° apart; a path over the Pacific then stays on
+// one side instead of crossing the whole map.
+func unwrapLongitudes(points []Point) []float64 {
+	out := make([]float64, len(points))
+	for i, p := range points {
+		lng := p.Geo.Lng
+		if i > 0 {
+			for lng-out[i-1] > 180 {
+				lng -= 360
+			}
+			for lng-out[i-1] < -180 {
+				lng += 360
+			}
+		}
+		out[i] = lng
+	}
+	return out
+}
+
+type htmlHop struct {
+	X, Y      string
+	Title     string
+	TTL       int
+	ShowLabel bool
+	LabelX    string
+	LabelY    string
+}
+
+type htmlRow struct {
+	TTL      int
+	IP       string
+	Hostname string
+	ASN      string
+	Owner    string
+	Location string
+	RTT      string
+}
+
+type htmlPage struct {
+	Target   string
+	ViewBox  string
+	Radius   string
+	FontSize string
+	Land     string
+	Grid     string
+	Path     string
+	Hops     []htmlHop
+	Rows     []htmlRow
+}
+
+// WriteHTML writes a standalone page that draws points on an embedded
+// vector basemap. It loads nothing from the network.
+func WriteHTML(w io.Writer, points []Point, target, lang string) error {
+	page := htmlPage{Target: target, Land: landPath(), Grid: gridPath()}
+	lngs := unwrapLongitudes(points)
+	minX, minY, maxX, maxY := 0.0, 0.0, mapWidth, mapHeight
+	if len(points) > 0 {
+		minX, minY = math.Inf(1), math.Inf(1)
+		maxX, maxY = math.Inf(-1), math.Inf(-1)
+	}
+	var path []string
+	for i, p := range points {
+		x, y := project(lngs[i], p.Geo.Lat)
+		minX, maxX = min(minX, x), max(maxX, x)
+		minY, maxY = min(minY, y), max(maxY, y)
+		path = append(path, svgNum(x)+","+svgNum(y))
+	}
+	page.Path = strings.Join(path, " ")
+
+	// Pad the bounding box and widen it to the 2:1 shape of the plane.
+	minSpan := minSpanDeg * mapWidth / 360
+	spanX := max(maxX-minX, minSpan) * 1.2
+	spanY := max(maxY-minY, minSpan/2) * 1.2
+	spanX, spanY = max(spanX, spanY*2), max(spanY, spanX/2)
+	viewX, viewY := (minX+maxX-spanX)/2, (minY+maxY-spanY)/2
+	page.ViewBox = strings.Join([]string{svgNum(viewX), svgNum(viewY), svgNum(spanX), svgNum(spanY)}, " ")
+	radius := spanX / 160
+	page.Radius = svgNum(radius)
+	page.FontSize = svgNum(spanX / 60)
+
+	var lastLabel []float64
+	for i, p := range points {
+		x, y := project(lngs[i], p.Geo.Lat)
+		loc := geoLocation(p.Geo, lang)
+		title := []string{"TTL " + strconv.Itoa(p.TTL), p.IP}
+		if p.Hostname != "" {
+			title = append(title, p.Hostname)
+		}
+		if loc != "" {
+			title = append(title, loc)
+		}
+		hop := htmlHop{X: svgNum(x), Y: svgNum(y), Title: strings.Join(title, " · "), TTL: p.TTL}
+		// Hops in the same city overlap; label only the first of each cluster.
+		if lastLabel == nil || math.Hypot(lastLabel[0]-x, lastLabel[1]-y) >= radius*4 {
+			lastLabel = []float64{x, y}
+			hop.ShowLabel = true
+			hop.LabelX, hop.LabelY = svgNum(x+radius*1.5), svgNum(y-radius*1.5)
+		}
+		page.Hops = append(page.Hops, hop)
+
+		row := htmlRow{TTL: p.TTL, IP: p.IP, Hostname: p.Hostname, Owner: geoOwner(p.Geo), Location: loc}
+		if p.Geo.Asnumber != "" {
+			row.ASN = "AS" + p.Geo.Asnumber
+		}
+		if p.RTT > 0 {
+			row.RTT = fmt.Sprintf("%.2f ms", p.RTT)
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	return htmlTemplate.Execute(w, page)
+}
+
+// landPath draws the basemap as one SVG path.
+func landPath() string {
+	var b strings.Builder
+	for _, ring := range landOutlines {
+		for i := 0; i+1 < len(ring); i += 2 {
+			x, y := project(ring[i], ring[i+1])
+			if i == 0 {
+				b.WriteString("M")
+			} else {
+				b.WriteString("L")
+			}
+			b.WriteString(svgNum(x) + "," + svgNum(y))
+		}
+		b.WriteString("Z")
+	}
+	return b.String()
+}
+
+// gridPath draws a graticule every 30°, wide enough for the basemap copies
+// either side of the antimeridian.
+func gridPath() string {
+	var b strings.Builder
+	for lng := -540.0; lng <= 540; lng += 30 {
+		x0, y0 := project(lng, 90)
+		_, y1 := project(lng, -90)
+		fmt.Fprintf(&b, "M%s,%sV%s", svgNum(x0), svgNum(y0), svgNum(y1))
+	}
+	for lat := -60.0; lat <= 60; lat += 30 {
+		x0, y0 := project(-540, lat)
+		x1, _ := project(540, lat)
+		fmt.Fprintf(&b, "M%s,%sH%s", svgNum(x0), svgNum(y0), svgNum(x1))
+	}
+	return b.String()
+}
+
+func svgNum(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+var htmlTemplate = template.Must(template.New("map").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>NextTrace map{{if .Target}} · {{.Target}}{{end}}</title>
+<style>
+body { margin: 0; padding: 24px; font: 14px/1.5 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1f2933; background: #f5f7fa; }
+h1 { font-size: 18px; margin: 0 0 16px; }
+svg { display: block; width: 100%; max-width: 1100px; background: #dbe9f6; border: 1px solid #c3cfd9; border-radius: 6px; }
+.land { fill: #f1ede4; stroke: #b9b2a2; stroke-width: 0.6; vector-effect: non-scaling-stroke; }
+.grid { fill: none; stroke: #b8cde0; stroke-width: 0.5; vector-effect: non-scaling-stroke; }
+.path { fill: none; stroke: #d64545; stroke-width: 2.5; stroke-linejoin: round; vector-effect: non-scaling-stroke; }
+.hop { fill: #fff; stroke: #d64545; stroke-width: 2; vector-effect: non-scaling-stroke; }
+.label { fill: #1f2933; font-weight: 600; paint-order: stroke; stroke: #fff; stroke-width: 3; vector-effect: non-scaling-stroke; }
+table { border-collapse: collapse; margin-top: 16px; background: #fff; }
+th, td { text-align: left; padding: 4px 12px; border-bottom: 1px solid #e4e7eb; }
+th { background: #e4e7eb; }
+.empty { color: #7b8794; }
+</style>
+</head>
+<body>
+<h1>NextTrace{{if .Target}} · {{.Target}}{{end}}</h1>
+<svg xmlns="http://www.w3.org/2000/svg" viewBox="{{.ViewBox}}" preserveAspectRatio="xMidYMid meet" role="img">
+<defs><path id="land" class="land" d="{{.Land}}"/></defs>
+<rect x="-1000" y="-500" width="3000" height="1500" fill="#dbe9f6"/>
+<path class="grid" d="{{.Grid}}"/>
+<use href="#land" x="-1000"/><use href="#land"/><use href="#land" x="1000"/>
+{{if .Path}}<polyline class="path" points="{{.Path}}"/>{{end}}
+{{range .Hops}}<circle class="hop" cx="{{.X}}" cy="{{.Y}}" r="{{$.Radius}}"><title>{{.Title}}</title></circle>
+{{if .ShowLabel}}<text class="label" x="{{.LabelX}}" y="{{.LabelY}}" font-size="{{$.FontSize}}">{{.TTL}}</text>
+{{end}}{{end}}</svg>
+{{if .Rows}}<table>
+<thead><tr><th>TTL</th><th>IP</th><th>Hostname</th><th>ASN</th><th>Owner</th><th>Location</th><th>RTT</th></tr></thead>
+<tbody>
+{{range .Rows}}<tr><td>{{.TTL}}</td><td>{{.IP}}</td><td>{{.Hostname}}</td><td>{{.ASN}}</td><td>{{.Owner}}</td><td>{{.Location}}</td><td>{{.RTT}}</td></tr>
+{{end}}</tbody>
+</table>{{else}}<p class="empty">No hop has a known location.</p>{{end}}
+</body>
+</html>
+`))
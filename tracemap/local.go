@@ -0,0 +1,202 @@
+package tracemap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+	"github.com/nxtrace/NTrace-core/util"
+)
+
+// Format names a locally rendered map format.
+type Format string
+
+const (
+	FormatGeoJSON Format = "geojson"
+	FormatHTML    Format = "html"
+)
+
+// Formats lists the local map formats.
+var Formats = []Format{FormatGeoJSON, FormatHTML}
+
+// FormatForPath picks the local map format from a file extension.
+func FormatForPath(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".geojson", ".json":
+		return FormatGeoJSON, true
+	case ".html", ".htm":
+		return FormatHTML, true
+	}
+	return "", false
+}
+
+// Point is one located hop of a locally rendered map.
+type Point struct {
+	TTL      int
+	IP       string
+	Hostname string
+	// RTT is in milliseconds; 0 when unknown.
+	RTT  float64
+	MPLS []string
+	Geo  *ipgeo.IPGeoData
+}
+
+// Located reports whether the hop has usable coordinates. Providers return
+// 0,0 for addresses they cannot place.
+func (p Point) Located() bool {
+	return p.Geo != nil && (p.Geo.Lat != 0 || p.Geo.Lng != 0)
+}
+
+// Points picks the first located reply of every TTL, in hop order, the same
+// way the web console draws its map.
+func Points(res *trace.Result) []Point {
+	if res == nil {
+		return nil
+	}
+	var out []Point
+	for i, hops := range res.Hops {
+		for j := range hops {
+			h := &hops[j]
+			ip := util.AddrIP(h.Address)
+			if !h.Success || ip == nil || h.Geo == nil || h.Geo.Source == trace.PendingGeoSource {
+				continue
+			}
+			p := Point{
+				TTL:      i + 1,
+				IP:       ip.String(),
+				Hostname: h.Hostname,
+				RTT:      float64(h.RTT) / float64(time.Millisecond),
+				MPLS:     h.MPLS,
+				Geo:      h.Geo,
+			}
+			if p.Located() {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// FeatureCollection is a GeoJSON (RFC 7946) feature collection.
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON feature.
+type Feature struct {
+	Type       string         `json:"type"`
+	Geometry   Geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Geometry is a GeoJSON Point or LineString.
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// GeoJSON returns the path towards target: a LineString through the located
+// hops, followed by one Point per hop carrying its details. lang selects the
+// language of place names.
+func GeoJSON(points []Point, target, lang string) FeatureCollection {
+	fc := FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+	if len(points) >= 2 {
+		line := make([][2]float64, 0, len(points))
+		for _, p := range points {
+			line = append(line, [2]float64{p.Geo.Lng, p.Geo.Lat})
+		}
+		props := map[string]any{"hops": len(points)}
+		if target != "" {
+			props["target"] = target
+		}
+		fc.Features = append(fc.Features, Feature{
+			Type:       "Feature",
+			Geometry:   Geometry{Type: "LineString", Coordinates: line},
+			Properties: props,
+		})
+	}
+	for _, p := range points {
+		fc.Features = append(fc.Features, Feature{
+			Type:       "Feature",
+			Geometry:   Geometry{Type: "Point", Coordinates: [2]float64{p.Geo.Lng, p.Geo.Lat}},
+			Properties: pointProperties(p, lang),
+		})
+	}
+	return fc
+}
+
+func pointProperties(p Point, lang string) map[string]any {
+	props := map[string]any{"ttl": p.TTL, "ip": p.IP}
+	for k, v := range map[string]string{
+		"hostname": p.Hostname,
+		"asn":      p.Geo.Asnumber,
+		"owner":    geoOwner(p.Geo),
+		"country":  geoField(p.Geo.Country, p.Geo.CountryEn, lang),
+		"prov":     geoField(p.Geo.Prov, p.Geo.ProvEn, lang),
+		"city":     geoField(p.Geo.City, p.Geo.CityEn, lang),
+		"source":   p.Geo.Source,
+	} {
+		if v != "" {
+			props[k] = v
+		}
+	}
+	if p.RTT > 0 {
+		props["rtt_ms"] = math.Round(p.RTT*1000) / 1000
+	}
+	if len(p.MPLS) > 0 {
+		props["mpls"] = p.MPLS
+	}
+	return props
+}
+
+// WriteGeoJSON writes the GeoJSON of points to w.
+func WriteGeoJSON(w io.Writer, points []Point, target, lang string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(GeoJSON(points, target, lang))
+}
+
+// WriteLocal writes points in format.
+func WriteLocal(w io.Writer, format Format, points []Point, target, lang string) error {
+	switch format {
+	case FormatGeoJSON:
+		return WriteGeoJSON(w, points, target, lang)
+	case FormatHTML:
+		return WriteHTML(w, points, target, lang)
+	}
+	return fmt.Errorf("unsupported map format %q", format)
+}
+
+func geoOwner(g *ipgeo.IPGeoData) string {
+	if g.Owner != "" {
+		return g.Owner
+	}
+	return g.Isp
+}
+
+func geoField(cn, en, lang string) string {
+	if lang == "en" && en != "" || cn == "" {
+		return en
+	}
+	return cn
+}
+
+// geoLocation joins country, province and city, skipping repeats such as
+// city-states.
+func geoLocation(g *ipgeo.IPGeoData, lang string) string {
+	var parts []string
+	for _, f := range [][2]string{{g.Country, g.CountryEn}, {g.Prov, g.ProvEn}, {g.City, g.CityEn}} {
+		if v := geoField(f[0], f[1], lang); v != "" && !util.StringInSlice(v, parts) {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,122 @@
+package tracemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nxtrace/NTrace-core/ipgeo"
+	"github.com/nxtrace/NTrace-core/trace"
+)
+
+func localTestResult() *trace.Result {
+	hop := func(ttl int, ip string, rtt time.Duration, geo *ipgeo.IPGeoData) trace.Hop {
+		return trace.Hop{Success: true, TTL: ttl, Address: &net.IPAddr{IP: net.ParseIP(ip)}, RTT: rtt, Geo: geo}
+	}
+	return &trace.Result{Hops: [][]trace.Hop{
+		{hop(1, "192.168.1.1", time.Millisecond, &ipgeo.IPGeoData{})},
+		{{TTL: 2}, hop(2, "203.0.113.1", 12500*time.Microsecond, &ipgeo.IPGeoData{
+			Asnumber: "64500", Country: "日本", CountryEn: "Japan", City: "东京", CityEn: "Tokyo", Owner: "Example <Net>", Lat: 35.68, Lng: 139.69})},
+		{{TTL: 3}},
+		{hop(4, "198.51.100.9", 110*time.Millisecond, &ipgeo.IPGeoData{
+			Asnumber: "64501", CountryEn: "United States", CityEn: "Los Angeles", Lat: 34.05, Lng: -118.24})},
+	}}
+}
+
+func TestPointsSkipsUnlocatedHops(t *testing.T) {
+	points := Points(localTestResult())
+	if len(points) != 2 || points[0].TTL != 2 || points[1].TTL != 4 {
+		t.Fatalf("Points() = %+v, want TTL 2 and 4", points)
+	}
+	if points[0].IP != "203.0.113.1" || points[0].RTT != 12.5 {
+		t.Fatalf("first point = %+v", points[0])
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteGeoJSON(&buf, Points(localTestResult()), "example.com", "en"); err != nil {
+		t.Fatal(err)
+	}
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &fc); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, buf.String())
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 3 {
+		t.Fatalf("got %s with %d features, want a collection of 3", fc.Type, len(fc.Features))
+	}
+	line := fc.Features[0]
+	var coords bytes.Buffer
+	_ = json.Compact(&coords, line.Geometry.Coordinates)
+	if line.Geometry.Type != "LineString" || coords.String() != "[[139.69,35.68],[-118.24,34.05]]" {
+		t.Fatalf("line = %s %s", line.Geometry.Type, coords.String())
+	}
+	if line.Properties["target"] != "example.com" {
+		t.Fatalf("line properties = %v", line.Properties)
+	}
+	hop := fc.Features[1].Properties
+	if hop["ttl"] != 2.0 || hop["asn"] != "64500" || hop["country"] != "Japan" || hop["city"] != "Tokyo" || hop["rtt_ms"] != 12.5 {
+		t.Fatalf("hop properties = %v", hop)
+	}
+	if _, ok := hop["prov"]; ok {
+		t.Fatalf("empty property written: %v", hop)
+	}
+}
+
+func TestGeoJSONWithoutLocatedHops(t *testing.T) {
+	fc := GeoJSON(nil, "example.com", "cn")
+	data, _ := json.Marshal(fc)
+	if string(data) != `{"type":"FeatureCollection","features":[]}` {
+		t.Fatalf("GeoJSON(nil) = %s", data)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, Points(localTestResult()), "example.com", "cn"); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{"<svg", `<path id="land"`, `<polyline class="path"`, "TTL 2 · 203.0.113.1 · 日本 东京", "AS64501", "Example &lt;Net&gt;", "12.50 ms"} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("page missing %q", want)
+		}
+	}
+	if strings.Contains(page, "http://") && strings.Count(page, "http://") != strings.Count(page, "http://www.w3.org/2000/svg") {
+		t.Fatal("page references the network")
+	}
+}
+
+func TestUnwrapLongitudesAcrossPacific(t *testing.T) {
+	points := []Point{
+		{Geo: &ipgeo.IPGeoData{Lng: 139.69}},
+		{Geo: &ipgeo.IPGeoData{Lng: -118.24}},
+	}
+	got := unwrapLongitudes(points)
+	if got[0] != 139.69 || got[1] != 241.76 {
+		t.Fatalf("unwrapLongitudes() = %v", got)
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	for path, want := range map[string]Format{"a.geojson": FormatGeoJSON, "a.JSON": FormatGeoJSON, "a.html": FormatHTML, "a.htm": FormatHTML} {
+		if got, ok := FormatForPath(path); !ok || got != want {
+			t.Fatalf("FormatForPath(%q) = %q, %v", path, got, ok)
+		}
+	}
+	if _, ok := FormatForPath("a.svg"); ok {
+		t.Fatal("FormatForPath(a.svg) should fail")
+	}
+}
@@ -138,6 +138,9 @@ func getGeoDNSConfig() (dotServer string, fallback bool) {
 	return geoDotServer, geoFallback
 }
 
+// DoTServerNames 是 ResolverForDot 支持的 DoT 服务器名字。
+var DoTServerNames = []string{"dnssb", "aliyun", "dnspod", "google", "cloudflare"}
+
 // ResolverForDot 根据 dotServer 名字返回对应的 *net.Resolver。
 // 空 / 未知名字返回 nil（表示"使用系统默认"）。
 func ResolverForDot(dotServer string) *net.Resolver {
@@ -3,6 +3,7 @@ package util
 import (
 	"context"
 	"net"
+	"slices"
 	"testing"
 	"time"
 )
@@ -27,6 +28,10 @@ func TestResolverMapping(t *testing.T) {
 			t.Errorf("ResolverForDot(%q) = %v, want nil", name, r)
 		}
 	}
+	// --dot-server 与 --fan-out-resolvers 的可选值来自 DoTServerNames
+	if !slices.Equal(DoTServerNames, known) {
+		t.Errorf("DoTServerNames = %v, want %v", DoTServerNames, known)
+	}
 }
 
 // ── IP 字面量短路 ────────────────────────────────────
@@ -46,7 +46,17 @@ func matchInterfaceIP(candidate, target net.IP, isIPv6 bool) bool {
 }
 
 // GetMTUByIPForDevice 根据给定 IPv4/IPv6 源地址返回所属网卡 MTU，优先使用指定网卡名。
+// 网卡在探测套接字所在的网络命名空间中查找。
 func GetMTUByIPForDevice(srcIP net.IP, srcDev string) int {
+	mtu := 0
+	_ = RunInNetNS(func() error {
+		mtu = getMTUByIPForDevice(srcIP, srcDev)
+		return nil
+	})
+	return mtu
+}
+
+func getMTUByIPForDevice(srcIP net.IP, srcDev string) int {
 	if mtu, ok := getNamedDeviceMTU(srcDev); ok {
 		return mtu
 	}
@@ -0,0 +1,149 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// SocketOptions 描述探测套接字所处的网络上下文，仅 Linux 支持：
+// 在指定网络命名空间中创建套接字，绑定到 VRF 设备，并设置 fwmark 供策略路由匹配
+type SocketOptions struct {
+	NetNS  string // 命名空间名称（/var/run/netns/NAME）或路径
+	VRF    string // VRF 设备名，通过 SO_BINDTODEVICE 绑定
+	FwMark uint32 // SO_MARK，0 表示不设置
+}
+
+var (
+	socketOptsMu sync.RWMutex
+	socketOpts   SocketOptions
+)
+
+func (o SocketOptions) IsZero() bool {
+	return o.NetNS == "" && o.VRF == "" && o.FwMark == 0
+}
+
+// Merge 以 override 中已设置的字段覆盖 o
+func (o SocketOptions) Merge(override SocketOptions) SocketOptions {
+	if override.NetNS != "" {
+		o.NetNS = override.NetNS
+	}
+	if override.VRF != "" {
+		o.VRF = override.VRF
+	}
+	if override.FwMark != 0 {
+		o.FwMark = override.FwMark
+	}
+	return o
+}
+
+// ParseFwMark 解析十进制或 0x 前缀十六进制的 fwmark
+func ParseFwMark(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fwmark %q: must be a 32-bit decimal or 0x-prefixed hex number", s)
+	}
+	return uint32(v), nil
+}
+
+// SetSocketOptions 设置此后创建的探测套接字所用的网络上下文
+func SetSocketOptions(o SocketOptions) {
+	socketOptsMu.Lock()
+	socketOpts = o
+	socketOptsMu.Unlock()
+}
+
+func CurrentSocketOptions() SocketOptions {
+	socketOptsMu.RLock()
+	defer socketOptsMu.RUnlock()
+	return socketOpts
+}
+
+// WithSocketOptions 在 callback 执行期间临时替换网络上下文，
+// 调用方需像其他进程级运行时设置一样自行串行化
+func WithSocketOptions[T any](o SocketOptions, callback func() (T, error)) (T, error) {
+	if callback == nil {
+		var zero T
+		return zero, nil
+	}
+	prev := CurrentSocketOptions()
+	SetSocketOptions(o)
+	defer SetSocketOptions(prev)
+	return callback()
+}
+
+// RunInNetNS 在当前网络上下文的命名空间中执行 fn，
+// 供网卡查询等需要与探测套接字处于同一命名空间的操作使用
+func RunInNetNS(fn func() error) error {
+	return CurrentSocketOptions().enter(fn)
+}
+
+// ListenPacket 在当前网络上下文中创建 PacketConn
+func ListenPacket(network, laddr string) (net.PacketConn, error) {
+	o := CurrentSocketOptions()
+	if o.IsZero() {
+		return net.ListenPacket(network, laddr)
+	}
+	lc := net.ListenConfig{Control: o.control}
+	var conn net.PacketConn
+	err := o.enter(func() (err error) {
+		conn, err = lc.ListenPacket(context.Background(), network, laddr)
+		return err
+	})
+	return conn, err
+}
+
+// Listen 在当前网络上下文中创建 Listener
+func Listen(network, laddr string) (net.Listener, error) {
+	o := CurrentSocketOptions()
+	if o.IsZero() {
+		return net.Listen(network, laddr)
+	}
+	lc := net.ListenConfig{Control: o.control}
+	var ln net.Listener
+	err := o.enter(func() (err error) {
+		ln, err = lc.Listen(context.Background(), network, laddr)
+		return err
+	})
+	return ln, err
+}
+
+// DialContext 在当前网络上下文中以 d 拨号，d 本身不会被修改
+func DialContext(ctx context.Context, d *net.Dialer, network, addr string) (net.Conn, error) {
+	o := CurrentSocketOptions()
+	if o.IsZero() {
+		return d.DialContext(ctx, network, addr)
+	}
+	dialer := *d
+	prevControl, prevControlContext := d.Control, d.ControlContext
+	dialer.Control = nil
+	dialer.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+		switch {
+		case prevControlContext != nil:
+			if err := prevControlContext(ctx, network, address, c); err != nil {
+				return err
+			}
+		case prevControl != nil:
+			if err := prevControl(network, address, c); err != nil {
+				return err
+			}
+		}
+		return o.control(network, address, c)
+	}
+	// 双栈竞速会在其他 goroutine 中建连，离开已切换命名空间的线程，故按地址顺序串行尝试
+	dialer.FallbackDelay = -1
+	var conn net.Conn
+	err := o.enter(func() (err error) {
+		conn, err = dialer.DialContext(ctx, network, addr)
+		return err
+	})
+	return conn, err
+}
@@ -0,0 +1,114 @@
+//go:build linux
+
+package util
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const netnsRunDir = "/var/run/netns"
+
+// netnsPath 将 ip netns 的命名空间名称展开为路径，含 / 的视为路径
+func netnsPath(name string) string {
+	if strings.ContainsRune(name, '/') {
+		return name
+	}
+	return filepath.Join(netnsRunDir, name)
+}
+
+// Validate 检查命名空间与 VRF 设备是否存在
+func (o SocketOptions) Validate() error {
+	if o.NetNS != "" {
+		if _, err := os.Stat(netnsPath(o.NetNS)); err != nil {
+			return fmt.Errorf("netns %q: %w", o.NetNS, err)
+		}
+	}
+	if o.VRF == "" {
+		return nil
+	}
+	return o.enter(func() error {
+		if _, err := net.InterfaceByName(o.VRF); err != nil {
+			return fmt.Errorf("VRF device %q: %w", o.VRF, err)
+		}
+		return nil
+	})
+}
+
+// enter 在专用 goroutine 锁定的系统线程上切换到目标命名空间执行 fn，结束后切回。
+// 其间创建的套接字属于目标命名空间，之后可在任意线程上收发；调用方的线程不会离开原命名空间
+func (o SocketOptions) enter(fn func() error) error {
+	if o.NetNS == "" {
+		return fn()
+	}
+	target, err := os.Open(netnsPath(o.NetNS))
+	if err != nil {
+		return fmt.Errorf("open netns %q: %w", o.NetNS, err)
+	}
+	defer target.Close()
+
+	type result struct {
+		err      error
+		panicked any
+	}
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() { done <- res }()
+		runtime.LockOSThread()
+		orig, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			res.err = fmt.Errorf("open current netns: %w", err)
+			return
+		}
+		defer orig.Close()
+		if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			res.err = fmt.Errorf("enter netns %q: %w", o.NetNS, err)
+			return
+		}
+		func() {
+			defer func() { res.panicked = recover() }()
+			res.err = fn()
+		}()
+		if err := unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET); err != nil {
+			// 切不回原命名空间时不解锁：本 goroutine 随即退出，运行时会终止这个线程而不是复用它
+			res.err = fmt.Errorf("leave netns %q: %w", o.NetNS, err)
+			return
+		}
+		runtime.UnlockOSThread()
+	}()
+	res := <-done
+	if res.panicked != nil {
+		panic(res.panicked)
+	}
+	return res.err
+}
+
+func (o SocketOptions) control(_, _ string, c syscall.RawConn) error {
+	var sockErr error
+	if err := c.Control(func(fd uintptr) {
+		if o.VRF != "" {
+			if err := syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, o.VRF); err != nil {
+				sockErr = fmt.Errorf("bind to VRF %q: %w", o.VRF, err)
+				return
+			}
+		}
+		if o.FwMark != 0 {
+			if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, int(o.FwMark)); err != nil {
+				sockErr = fmt.Errorf("set fwmark %#x: %w", o.FwMark, err)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	return sockErr
+}
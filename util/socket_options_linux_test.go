@@ -0,0 +1,85 @@
+//go:build linux
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestListenPacketAppliesVRFAndFwMark(t *testing.T) {
+	SetSocketOptions(SocketOptions{VRF: "lo", FwMark: 0x2a})
+	defer SetSocketOptions(SocketOptions{})
+
+	conn, err := ListenPacket("udp4", "127.0.0.1:0")
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("setting SO_MARK requires CAP_NET_ADMIN")
+	}
+	require.NoError(t, err)
+	defer conn.Close()
+
+	raw, err := conn.(*net.UDPConn).SyscallConn()
+	require.NoError(t, err)
+	var mark int
+	var dev string
+	var sockErr error
+	require.NoError(t, raw.Control(func(fd uintptr) {
+		if mark, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK); sockErr != nil {
+			return
+		}
+		dev, sockErr = unix.GetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE)
+	}))
+	require.NoError(t, sockErr)
+	assert.Equal(t, 0x2a, mark)
+	assert.Equal(t, "lo", dev)
+}
+
+func TestSocketOptionsValidate(t *testing.T) {
+	assert.NoError(t, SocketOptions{FwMark: 1}.Validate())
+	assert.ErrorContains(t, SocketOptions{NetNS: "nexttrace-missing-ns"}.Validate(), `netns "nexttrace-missing-ns"`)
+	assert.ErrorContains(t, SocketOptions{VRF: "nexttrace-missing0"}.Validate(), `VRF device "nexttrace-missing0"`)
+}
+
+func TestEnterNetNSLeavesCallerThreadAlone(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating a network namespace requires root")
+	}
+	const ns = "nexttrace-util-test"
+	if out, err := exec.Command("ip", "netns", "add", ns).CombinedOutput(); err != nil {
+		t.Skipf("ip netns add: %v: %s", err, out)
+	}
+	t.Cleanup(func() { _ = exec.Command("ip", "netns", "del", ns).Run() })
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	threadNS := func() string {
+		link, err := os.Readlink(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		require.NoError(t, err)
+		return link
+	}
+	callerTid, callerNS := unix.Gettid(), threadNS()
+
+	var fnTid int
+	var fnNS string
+	require.NoError(t, SocketOptions{NetNS: ns}.enter(func() error {
+		fnTid, fnNS = unix.Gettid(), threadNS()
+		return nil
+	}))
+	assert.NotEqual(t, callerTid, fnTid, "fn must run on its own thread")
+	assert.NotEqual(t, callerNS, fnNS, "fn must run inside the target netns")
+	assert.Equal(t, callerNS, threadNS())
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = SocketOptions{NetNS: ns}.enter(func() error { panic("boom") })
+	})
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package util
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errSocketOptionsUnsupported = errors.New("netns, VRF and fwmark are only supported on Linux")
+
+func (o SocketOptions) Validate() error {
+	if o.IsZero() {
+		return nil
+	}
+	return errSocketOptionsUnsupported
+}
+
+func (o SocketOptions) enter(fn func() error) error {
+	if o.NetNS != "" {
+		return errSocketOptionsUnsupported
+	}
+	return fn()
+}
+
+func (o SocketOptions) control(_, _ string, _ syscall.RawConn) error {
+	if o.IsZero() {
+		return nil
+	}
+	return errSocketOptionsUnsupported
+}
@@ -0,0 +1,35 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFwMark(t *testing.T) {
+	for in, want := range map[string]uint32{"": 0, "100": 100, "0x64": 100, " 0xffffffff ": 0xffffffff} {
+		got, err := ParseFwMark(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"-1", "0x100000000", "mark"} {
+		_, err := ParseFwMark(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestSocketOptionsMergeAndScope(t *testing.T) {
+	base := SocketOptions{NetNS: "blue", FwMark: 1}
+	assert.Equal(t, SocketOptions{NetNS: "blue", VRF: "vrf-red", FwMark: 1}, base.Merge(SocketOptions{VRF: "vrf-red"}))
+	assert.Equal(t, SocketOptions{NetNS: "green", FwMark: 2}, base.Merge(SocketOptions{NetNS: "green", FwMark: 2}))
+
+	SetSocketOptions(base)
+	defer SetSocketOptions(SocketOptions{})
+	got, err := WithSocketOptions(SocketOptions{FwMark: 9}, func() (SocketOptions, error) {
+		return CurrentSocketOptions(), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SocketOptions{FwMark: 9}, got)
+	assert.Equal(t, base, CurrentSocketOptions())
+}
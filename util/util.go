@@ -121,7 +121,7 @@ func getLocalIPPort(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 		bindIP = srcIP
 	} else {
 		serverAddr := &net.UDPAddr{IP: dstIP, Port: 12345}
-		con, err := net.DialUDP("udp4", nil, serverAddr)
+		con, err := DialContext(context.Background(), &net.Dialer{}, "udp4", serverAddr.String())
 		if err != nil {
 			return nil, -1
 		}
@@ -138,7 +138,7 @@ func getLocalIPPort(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 	case "icmp":
 		return bindIP, 0
 	case "tcp":
-		ln, err := net.ListenTCP("tcp4", &net.TCPAddr{IP: bindIP, Port: 0})
+		ln, err := Listen("tcp4", (&net.TCPAddr{IP: bindIP, Port: 0}).String())
 		if err != nil {
 			return nil, -1
 		}
@@ -146,7 +146,7 @@ func getLocalIPPort(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 		_ = ln.Close()
 		return bindIP, bindPort
 	case "udp":
-		pc, err := net.ListenUDP("udp4", &net.UDPAddr{IP: bindIP, Port: 0})
+		pc, err := ListenPacket("udp4", (&net.UDPAddr{IP: bindIP, Port: 0}).String())
 		if err != nil {
 			return nil, -1
 		}
@@ -176,7 +176,7 @@ func getLocalIPPortv6(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 		bindIP = srcIP
 	} else {
 		serverAddr := &net.UDPAddr{IP: dstIP, Port: 12345}
-		con, err := net.DialUDP("udp6", nil, serverAddr)
+		con, err := DialContext(context.Background(), &net.Dialer{}, "udp6", serverAddr.String())
 		if err != nil {
 			return nil, -1
 		}
@@ -193,7 +193,7 @@ func getLocalIPPortv6(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 	case "icmp6":
 		return bindIP, 0
 	case "tcp6":
-		ln, err := net.ListenTCP("tcp6", &net.TCPAddr{IP: bindIP, Port: 0})
+		ln, err := Listen("tcp6", (&net.TCPAddr{IP: bindIP, Port: 0}).String())
 		if err != nil {
 			return nil, -1
 		}
@@ -201,7 +201,7 @@ func getLocalIPPortv6(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 		_ = ln.Close()
 		return bindIP, bindPort
 	case "udp6":
-		pc, err := net.ListenUDP("udp6", &net.UDPAddr{IP: bindIP, Port: 0})
+		pc, err := ListenPacket("udp6", (&net.UDPAddr{IP: bindIP, Port: 0}).String())
 		if err != nil {
 			return nil, -1
 		}
@@ -214,8 +214,8 @@ func getLocalIPPortv6(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 
 // LocalIPPort 根据目标 IPv4（以及可选的源 IPv4 与协议）返回本地 IP 与一个可用端口
 func LocalIPPort(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
-	// 若开启随机端口模式，每次直接计算并返回
-	if RandomPortEnabled() {
+	// 若开启随机端口模式或指定了网络上下文（服务端可按请求切换），每次直接计算并返回
+	if RandomPortEnabled() || !CurrentSocketOptions().IsZero() {
 		return getLocalIPPort(dstIP, srcIP, proto)
 	}
 
@@ -232,8 +232,8 @@ func LocalIPPort(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
 
 // LocalIPPortv6 根据目标 IPv6（以及可选的源 IPv6 与协议）返回本地 IP 与一个可用端口
 func LocalIPPortv6(dstIP net.IP, srcIP net.IP, proto string) (net.IP, int) {
-	// 若开启随机端口模式，每次直接计算并返回
-	if RandomPortEnabled() {
+	// 若开启随机端口模式或指定了网络上下文（服务端可按请求切换），每次直接计算并返回
+	if RandomPortEnabled() || !CurrentSocketOptions().IsZero() {
 		return getLocalIPPortv6(dstIP, srcIP, proto)
 	}
 
@@ -537,6 +537,30 @@ func DomainLookUpWithContext(ctx context.Context, host string, ipVersion string,
 	return selected, nil
 }
 
+// DomainLookUpAllWithContext 返回 dotServer（空为系统解析器）对 host 给出的全部 ipVersion 地址，不提示选择
+func DomainLookUpAllWithContext(ctx context.Context, host string, ipVersion string, dotServer string) ([]net.IP, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+
+	ips, err := lookupIPs(lookupCtx, domainResolverFactory(dotServer), host)
+	if err != nil {
+		return nil, err
+	}
+	filtered := ips[:0]
+	for _, ip := range ips {
+		if ipVersion == "all" || (ipVersion == "4") == (ip.To4() != nil) {
+			filtered = append(filtered, ip)
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no %s DNS records found for %s", resolveFamilyLabel(ipVersion), host)
+	}
+	return filtered, nil
+}
+
 func GetHostAndPort() (host string, port string) {
 	// 解析域名
 	hostArr := strings.Split(EnvHostPort, ":")
@@ -678,7 +702,16 @@ func FudgeWordForSeq(S0, targetChecksum uint16) uint16 {
 // MakePayloadWithTargetChecksum 修改 payload，使最终 UDP.Checksum == targetChecksum
 // 要求：payload 长度 >= 2（前 2 字节作为补偿位写入）
 func MakePayloadWithTargetChecksum(payload []byte, srcIP, dstIP net.IP, srcPort, dstPort int, targetChecksum uint16) error {
-	if len(payload) < 2 {
+	return MakePayloadWithTargetChecksumAt(payload, 0, srcIP, dstIP, srcPort, dstPort, targetChecksum)
+}
+
+// MakePayloadWithTargetChecksumAt 与 MakePayloadWithTargetChecksum 相同，但补偿位写入 payload[offset:offset+2]
+// 要求：offset 为偶数（与校验和的 16 位字对齐），且 payload 长度 >= offset+2
+func MakePayloadWithTargetChecksumAt(payload []byte, offset int, srcIP, dstIP net.IP, srcPort, dstPort int, targetChecksum uint16) error {
+	if offset < 0 || offset%2 != 0 {
+		return errors.New("fudge offset must be even and non-negative")
+	}
+	if len(payload) < offset+2 {
 		return errors.New("payload too short, need >= 2 bytes for fudge")
 	}
 
@@ -688,13 +721,13 @@ func MakePayloadWithTargetChecksum(payload []byte, srcIP, dstIP net.IP, srcPort,
 	}
 
 	// 补偿位清零，再按“校验和字段=0”的前提计算 S0
-	payload[0], payload[1] = 0, 0
+	payload[offset], payload[offset+1] = 0, 0
 	udpLen := 8 + len(payload)
 	S0 := UDPBaseSum(srcIP, dstIP, srcPort, dstPort, udpLen, payload)
 	fudge := FudgeWordForSeq(S0, targetChecksum)
 
 	// 回写补偿位（网络序）
-	payload[0] = byte(fudge >> 8)
-	payload[1] = byte(fudge)
+	payload[offset] = byte(fudge >> 8)
+	payload[offset+1] = byte(fudge)
 	return nil
 }
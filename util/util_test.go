@@ -167,6 +167,23 @@ func TestMakePayloadWithTargetChecksum_VersionMismatch(t *testing.T) {
 	assert.Contains(t, err.Error(), "mismatch")
 }
 
+func TestMakePayloadWithTargetChecksumAt_Offset(t *testing.T) {
+	src := net.ParseIP("2001:db8::1")
+	dst := net.ParseIP("2001:db8::2")
+	payload := []byte{0xAB, 0xCD, 1, 2, 3, 4, 5, 6, 7}
+	targetCS := uint16(0x0302)
+
+	err := MakePayloadWithTargetChecksumAt(payload, 4, src, dst, 40000, 53, targetCS)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xAB, 0xCD, 1, 2}, payload[:4], "bytes before the fudge word must be kept")
+
+	finalSum := UDPBaseSum(src, dst, 40000, 53, 8+len(payload), payload)
+	assert.Equal(t, targetCS, ^finalSum)
+
+	require.Error(t, MakePayloadWithTargetChecksumAt(payload, 3, src, dst, 40000, 53, targetCS))
+	require.Error(t, MakePayloadWithTargetChecksumAt(payload, 8, src, dst, 40000, 53, targetCS))
+}
+
 type fakeHostLookupResolver struct {
 	hosts []string
 	err   error
@@ -237,6 +254,26 @@ func TestDomainLookUpWithContextReturnsContextCanceled(t *testing.T) {
 	}
 }
 
+func TestDomainLookUpAllWithContextKeepsEveryAddressOfFamily(t *testing.T) {
+	oldFactory := domainResolverFactory
+	var gotDot string
+	domainResolverFactory = func(dot string) hostLookupResolver {
+		gotDot = dot
+		return fakeHostLookupResolver{hosts: []string{"192.0.2.1", "2001:db8::1", "192.0.2.2"}}
+	}
+	defer func() { domainResolverFactory = oldFactory }()
+
+	ips, err := DomainLookUpAllWithContext(context.Background(), "example.com", "4", "google")
+	require.NoError(t, err)
+	require.Len(t, ips, 2)
+	assert.Equal(t, "192.0.2.2", ips[1].String())
+	assert.Equal(t, "google", gotDot)
+
+	ips, err = DomainLookUpAllWithContext(context.Background(), "example.com", "all", "")
+	require.NoError(t, err)
+	assert.Len(t, ips, 3)
+}
+
 func TestLookupAddrWithContextUsesCache(t *testing.T) {
 	oldResolver := rdnsResolver
 	rdnsResolver = fakeAddrLookupResolver{